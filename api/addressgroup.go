@@ -0,0 +1,284 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// MaxAddressGroupSize is the maximum number of addresses in one address group request
+const MaxAddressGroupSize = 100
+
+// addressGroupTxs is the merged confirmed history of a group of address descriptors, walked from the newest
+// transaction without holding the whole history in memory
+type addressGroupTxs struct {
+	w         *Worker
+	addrDescs []bchain.AddressDescriptor
+	group     map[string]struct{}
+}
+
+// walk passes the unique transactions of the group to fn from the newest, the transactions of one block are in reverse order
+// of their first occurrence in the histories of the addresses of the group; fn returns false to stop the walk
+func (g *addressGroupTxs) walk(fn func(tx *db.AddressGroupTx) (bool, error)) error {
+	var ferr error
+	err := g.w.db.GetAddrDescsHeightTransactionsReverse(g.addrDescs, 0, ^uint32(0), func(height uint32, txs []db.AddressGroupTx) error {
+		for i := len(txs) - 1; i >= 0; i-- {
+			next, err := fn(&txs[i])
+			if err != nil {
+				ferr = err
+				return &db.StopIteration{}
+			}
+			if !next {
+				return &db.StopIteration{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return ferr
+}
+
+// page returns the txids of the confirmed transactions from index from to to of the merged history
+func (g *addressGroupTxs) page(from, to int) ([]string, error) {
+	txids := make([]string, 0, to-from)
+	i := 0
+	err := g.walk(func(tx *db.AddressGroupTx) (bool, error) {
+		if i >= to {
+			return false, nil
+		}
+		if i >= from {
+			txids = append(txids, tx.Txid)
+		}
+		i++
+		return true, nil
+	})
+	return txids, err
+}
+
+// internalSat returns the value moved by the transaction between the addresses of the group, the lower of the values
+// of the inputs and of the outputs of the group, it is counted in TotalSent and TotalReceived of the addresses
+func (g *addressGroupTxs) internalSat(tx *db.AddressGroupTx) (*big.Int, error) {
+	var in, out big.Int
+	ta, err := g.w.db.GetTxAddresses(tx.Txid)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetTxAddresses %v", tx.Txid)
+	}
+	if ta == nil {
+		glog.Warning("DB inconsistency:  tx ", tx.Txid, ": not found in txAddresses")
+		return &in, nil
+	}
+	for i := range ta.Inputs {
+		if _, found := g.group[string(ta.Inputs[i].AddrDesc)]; found {
+			in.Add(&in, &ta.Inputs[i].ValueSat)
+		}
+	}
+	for i := range ta.Outputs {
+		if _, found := g.group[string(ta.Outputs[i].AddrDesc)]; found {
+			out.Add(&out, &ta.Outputs[i].ValueSat)
+		}
+	}
+	if in.Cmp(&out) < 0 {
+		return &in, nil
+	}
+	return &out, nil
+}
+
+// addressGroupHistory is one page of the merged history of a group of address descriptors
+type addressGroupHistory struct {
+	paging                  Paging
+	txs                     []*Tx
+	txids                   []string
+	txApperances            int
+	unconfirmedTxApperances int
+	unconfirmedBalanceSat   big.Int
+	// internalSat is the value moved between the addresses of the group by the confirmed transactions
+	internalSat big.Int
+}
+
+// getAddressGroupHistory returns the page of the merged history of the address descriptors, the mempool transactions
+// are listed only on the first page, the unconfirmed balance is computed from all of them
+func (w *Worker) getAddressGroupHistory(addrDescs []bchain.AddressDescriptor, page int, txsOnPage int, onlyTxids bool) (*addressGroupHistory, error) {
+	g := &addressGroupTxs{w: w, addrDescs: addrDescs, group: make(map[string]struct{}, len(addrDescs))}
+	for _, addrDesc := range addrDescs {
+		g.group[string(addrDesc)] = struct{}{}
+	}
+	h := &addressGroupHistory{}
+	// one pass over the merged history counts the transactions, nets out the internal transfers
+	// and collects the txids of the requested page
+	utxo := w.chainParser.IsUTXOChain()
+	from, to := page*txsOnPage, (page+1)*txsOnPage
+	var txc []string
+	err := g.walk(func(tx *db.AddressGroupTx) (bool, error) {
+		if h.txApperances >= from && h.txApperances < to {
+			txc = append(txc, tx.Txid)
+		}
+		h.txApperances++
+		if utxo && tx.Inputs && tx.Outputs {
+			v, err := g.internalSat(tx)
+			if err != nil {
+				return false, err
+			}
+			h.internalSat.Add(&h.internalSat, v)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAddrDescsHeightTransactionsReverse")
+	}
+	h.paging, from, to, page = computePaging(h.txApperances, page, txsOnPage)
+	// the page past the end of the history is replaced by the last page, which must be read again
+	if len(txc) != to-from {
+		if txc, err = g.page(from, to); err != nil {
+			return nil, errors.Annotatef(err, "GetAddrDescsHeightTransactionsReverse")
+		}
+	}
+	var txm []string
+	for _, addrDesc := range addrDescs {
+		m, err := w.getAddressTxids(addrDesc, true)
+		if err != nil {
+			return nil, errors.Annotatef(err, "getAddressTxids %v true", addrDesc)
+		}
+		txm = append(txm, m...)
+	}
+	txm = UniqueTxidsInReverse(txm)
+	bestheight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	h.unconfirmedTxApperances = len(txm)
+	var txs []*Tx
+	var txids []string
+	if onlyTxids {
+		txids = make([]string, 0, len(txm)+len(txc))
+	} else {
+		txs = make([]*Tx, 0, len(txm)+len(txc))
+	}
+	// the unconfirmed balance is computed from all mempool transactions, they are listed only on the first page
+	for _, txid := range txm {
+		tx, err := w.GetTransaction(txid, false)
+		// mempool transaction may fail
+		if err != nil {
+			glog.Error("GetTransaction in mempool ", txid, ": ", err)
+			continue
+		}
+		for _, addrDesc := range addrDescs {
+			h.unconfirmedBalanceSat.Add(&h.unconfirmedBalanceSat, tx.getAddrVoutValue(addrDesc))
+			h.unconfirmedBalanceSat.Sub(&h.unconfirmedBalanceSat, tx.getAddrVinValue(addrDesc))
+		}
+		if page == 0 {
+			if onlyTxids {
+				txids = append(txids, tx.Txid)
+			} else {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	for _, txid := range txc {
+		if onlyTxids {
+			txids = append(txids, txid)
+			continue
+		}
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", txid)
+		}
+		if ta == nil {
+			glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+			continue
+		}
+		bi, err := w.db.GetBlockInfo(ta.Height)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockInfo %v", ta.Height)
+		}
+		if bi == nil {
+			glog.Warning("DB inconsistency:  block height ", ta.Height, ": not found in db")
+			continue
+		}
+		txs = append(txs, w.txFromTxAddress(txid, ta, bi, bestheight))
+	}
+	h.txs = txs
+	h.txids = txids
+	return h, nil
+}
+
+// GetAddressGroup returns the summed balances and the merged history of a group of addresses, for example of all addresses
+// of a wallet; the transactions touching several addresses of the group are listed only once, the group balance is the sum
+// of the balances of the addresses, the value moved between the addresses of the group (e.g. change) is not counted
+// in TotalReceived and TotalSent
+func (w *Worker) GetAddressGroup(addresses []string, page int, txsOnPage int, onlyTxids bool) (*AddressGroup, error) {
+	start := time.Now()
+	page--
+	if page < 0 {
+		page = 0
+	}
+	if len(addresses) == 0 {
+		return nil, NewApiError("Missing addresses", true)
+	}
+	if len(addresses) > MaxAddressGroupSize {
+		return nil, NewApiError(fmt.Sprintf("Too many addresses, the maximum is %d", MaxAddressGroupSize), true)
+	}
+	addrDescs := make([]bchain.AddressDescriptor, 0, len(addresses))
+	groupAddresses := make([]string, 0, len(addresses))
+	seen := make(map[string]struct{}, len(addresses))
+	var balanceSat, receivedSat, sentSat big.Int
+	for _, address := range addresses {
+		addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+		if err != nil {
+			return nil, NewApiError(fmt.Sprintf("Address %v not found, %v", address, err), true)
+		}
+		if _, found := seen[string(addrDesc)]; found {
+			continue
+		}
+		seen[string(addrDesc)] = struct{}{}
+		// convert the address to the format defined by the parser
+		a, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+		if err != nil {
+			glog.V(2).Infof("GetAddressesFromAddrDesc error %v, %v", err, addrDesc)
+		}
+		if len(a) == 1 {
+			address = a[0]
+		}
+		// ba is nil if the address is only in mempool or not used at all
+		ba, err := w.db.GetAddrDescBalance(addrDesc)
+		if err != nil {
+			return nil, NewApiError(fmt.Sprintf("Address %v not found, %v", address, err), true)
+		}
+		if w.isLargeAddress(ba) {
+			return nil, w.largeAddressError(address)
+		}
+		if ba != nil {
+			balanceSat.Add(&balanceSat, &ba.BalanceSat)
+			receivedSat.Add(&receivedSat, ba.ReceivedSat())
+			sentSat.Add(&sentSat, &ba.SentSat)
+		}
+		addrDescs = append(addrDescs, addrDesc)
+		groupAddresses = append(groupAddresses, address)
+	}
+	h, err := w.getAddressGroupHistory(addrDescs, page, txsOnPage, onlyTxids)
+	if err != nil {
+		return nil, err
+	}
+	receivedSat.Sub(&receivedSat, &h.internalSat)
+	sentSat.Sub(&sentSat, &h.internalSat)
+	r := &AddressGroup{
+		Paging:                  h.paging,
+		Addresses:               groupAddresses,
+		Balance:                 w.formatAmount(&balanceSat),
+		TotalReceived:           w.formatAmount(&receivedSat),
+		TotalSent:               w.formatAmount(&sentSat),
+		TxApperances:            h.txApperances,
+		UnconfirmedBalance:      w.formatAmount(&h.unconfirmedBalanceSat),
+		UnconfirmedTxApperances: h.unconfirmedTxApperances,
+		Transactions:            h.txs,
+		Txids:                   h.txids,
+	}
+	glog.Info("GetAddressGroup ", len(addrDescs), " addresses finished in ", time.Since(start))
+	return r, nil
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// AmountUnit is the unit in which the amounts are returned by the API
+type AmountUnit int
+
+const (
+	// AmountUnitCoin returns the amounts as decimal numbers in the units of the coin (BTC, ETH), it is the default
+	AmountUnitCoin AmountUnit = iota
+	// AmountUnitBase returns the amounts as integers in the smallest units of the coin (satoshi, wei)
+	AmountUnitBase
+)
+
+// ParseAmountUnit converts the name of the unit to AmountUnit, empty string is the coin unit
+func ParseAmountUnit(s string) (AmountUnit, error) {
+	switch s {
+	case "", "coin":
+		return AmountUnitCoin, nil
+	case "base":
+		return AmountUnitBase, nil
+	}
+	return AmountUnitCoin, NewApiError(fmt.Sprintf("Unknown amount unit '%v', expecting 'coin' or 'base'", s), true)
+}
+
+type amountLocale struct {
+	decimalSeparator string
+	groupSeparator   string
+}
+
+// amountLocales are the supported locales of the localized amounts
+var amountLocales = map[string]amountLocale{
+	"en": {".", ","},
+	"de": {",", "."},
+	"es": {",", "."},
+	"it": {",", "."},
+	"nl": {",", "."},
+	"pt": {",", "."},
+	"fr": {",", " "},
+	"cs": {",", " "},
+	"pl": {",", " "},
+	"ru": {",", " "},
+	"ch": {".", "'"},
+}
+
+// AmountFormatter formats the amounts returned by the API in the unit of the coin given by the parser
+// and optionally localizes them (digit grouping and decimal separator)
+type AmountFormatter struct {
+	parser bchain.BlockChainParser
+	unit   AmountUnit
+	locale *amountLocale
+}
+
+// NewAmountFormatter creates the formatter, empty locale means no localization
+func NewAmountFormatter(parser bchain.BlockChainParser, unit AmountUnit, locale string) (*AmountFormatter, error) {
+	f := &AmountFormatter{parser: parser, unit: unit}
+	if locale != "" {
+		l, found := amountLocales[strings.ToLower(locale)]
+		if !found {
+			return nil, NewApiError(fmt.Sprintf("Unsupported locale '%v'", locale), true)
+		}
+		f.locale = &l
+	}
+	return f, nil
+}
+
+// Decimals returns the number of decimal places of the formatted amounts
+func (f *AmountFormatter) Decimals() int {
+	if f.unit == AmountUnitBase {
+		return 0
+	}
+	return f.parser.AmountDecimals()
+}
+
+// Format formats the amount given in the base units
+func (f *AmountFormatter) Format(a *big.Int) string {
+	var s string
+	if f.unit == AmountUnitBase {
+		s = a.String()
+	} else {
+		s = f.parser.AmountToDecimalString(a)
+	}
+	if f.locale == nil {
+		return s
+	}
+	return f.localize(s)
+}
+
+// cacheKey identifies the format of the amounts in the keys of the caches of the formatted responses
+func (f *AmountFormatter) cacheKey() string {
+	if f == nil {
+		return ""
+	}
+	k := fmt.Sprint(int(f.unit))
+	if f.locale != nil {
+		k += f.locale.decimalSeparator + f.locale.groupSeparator
+	}
+	return k
+}
+
+// localize groups the digits of the integer part of the decimal number s and replaces the decimal point
+func (f *AmountFormatter) localize(s string) string {
+	var sign string
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	i, d := s, ""
+	if p := strings.IndexByte(s, '.'); p >= 0 {
+		i, d = s[:p], s[p+1:]
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for j := 0; j < len(i); j++ {
+		if j > 0 && (len(i)-j)%3 == 0 {
+			b.WriteString(f.locale.groupSeparator)
+		}
+		b.WriteByte(i[j])
+	}
+	if d != "" {
+		b.WriteString(f.locale.decimalSeparator)
+		b.WriteString(d)
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"fmt"
+
+	"github.com/juju/errors"
+)
+
+// GetAmountAnomalies returns the triggered guards of the amount math of the address, or of all addresses if address is empty
+func (w *Worker) GetAmountAnomalies(address string) ([]AmountAnomaly, error) {
+	var addrDesc bchain.AddressDescriptor
+	if address != "" {
+		var err error
+		if addrDesc, err = w.chainParser.GetAddrDescFromAddress(address); err != nil {
+			return nil, NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+		}
+	}
+	as, err := w.db.GetAmountAnomalies(addrDesc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAmountAnomalies %v", addrDesc)
+	}
+	r := make([]AmountAnomaly, len(as))
+	for i := range as {
+		a := &as[i]
+		r[i] = AmountAnomaly{
+			Address:     w.flowAddress(a.AddrDesc),
+			Kind:        a.Kind.String(),
+			Count:       a.Count,
+			FirstHeight: a.FirstHeight,
+			LastHeight:  a.LastHeight,
+			Value:       w.formatAmount(&a.ValueSat),
+		}
+	}
+	return r, nil
+}
+
+// RecomputeAddressBalance recomputes the balance of the address from its indexed transactions, stores it and clears the anomalies of the address
+func (w *Worker) RecomputeAddressBalance(address string) (*BalanceRecompute, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("The recompute of the balance is available only for UTXO chains", true)
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	return w.recomputeAddrDescBalance(addrDesc, address)
+}
+
+// RecomputeAnomalousBalances recomputes the balances of all addresses with a recorded anomaly of the amount math
+func (w *Worker) RecomputeAnomalousBalances() ([]BalanceRecompute, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("The recompute of the balance is available only for UTXO chains", true)
+	}
+	as, err := w.db.GetAmountAnomalies(nil)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAmountAnomalies")
+	}
+	r := []BalanceRecompute{}
+	for i := range as {
+		// the anomalies of an address are stored next to each other
+		if i > 0 && string(as[i].AddrDesc) == string(as[i-1].AddrDesc) {
+			continue
+		}
+		br, err := w.recomputeAddrDescBalance(as[i].AddrDesc, w.flowAddress(as[i].AddrDesc))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, *br)
+	}
+	return r, nil
+}
+
+func (w *Worker) recomputeAddrDescBalance(addrDesc bchain.AddressDescriptor, address string) (*BalanceRecompute, error) {
+	rc, err := w.db.RecomputeAddrDescBalance(addrDesc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "RecomputeAddrDescBalance %v", addrDesc)
+	}
+	r := &BalanceRecompute{
+		Address:    address,
+		Txs:        rc.New.Txs,
+		Balance:    w.formatAmount(&rc.New.BalanceSat),
+		Sent:       w.formatAmount(&rc.New.SentSat),
+		Changed:    rc.Changed,
+		Unresolved: rc.Unresolved,
+	}
+	if rc.Old != nil {
+		r.OldTxs = rc.Old.Txs
+		r.OldBalance = w.formatAmount(&rc.Old.BalanceSat)
+		r.OldSent = w.formatAmount(&rc.Old.SentSat)
+	}
+	return r, nil
+}
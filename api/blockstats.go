@@ -0,0 +1,108 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// maximum number of blocks of the block stats
+const maxBlockStatsBlocks = 2000
+
+// GetBlockStats returns the statistics of the indexed blocks in range from-to in the format of getblockstats of bitcoind
+// and their aggregate, the statistics are read from the index, not from the backend
+func (w *Worker) GetBlockStats(from, to uint32) (*BlockStatsRange, error) {
+	start := time.Now()
+	if to < from {
+		return nil, NewApiError("Parameter 'to' must not be lower than parameter 'from'", true)
+	}
+	if to-from >= maxBlockStatsBlocks {
+		return nil, NewApiError(fmt.Sprintf("Too many blocks requested, the maximum is %v", maxBlockStatsBlocks), true)
+	}
+	bis, err := w.db.GetBlockInfos(from, to)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockInfos %v-%v", from, to)
+	}
+	fss, err := w.db.GetBlockFeeStats(from, to)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockFeeStats %v-%v", from, to)
+	}
+	fees := make(map[uint32]*db.BlockFeeStats, len(fss))
+	for i := range fss {
+		fees[fss[i].Height] = &fss[i]
+	}
+	r := &BlockStatsRange{
+		From:        from,
+		To:          to,
+		Percentiles: db.FeeRatePercentiles,
+		Blocks:      make([]BlockStats, len(bis)),
+	}
+	t := &r.Total
+	var totalFeesSat big.Int
+	var feeTxs, rateTxs uint64
+	rates := make([]float64, len(db.FeeRatePercentiles))
+	for i := range bis {
+		bi := &bis[i]
+		bs := &r.Blocks[i]
+		*bs = BlockStats{
+			Height:      bi.Height,
+			Hash:        bi.Hash,
+			Time:        bi.Time,
+			Txs:         bi.Txs,
+			TotalSize:   bi.Size,
+			TotalWeight: bi.Weight,
+			SigOps:      bi.SigOps,
+		}
+		if subsidy, err := w.chainParser.GetBlockSubsidy(bi.Height); err == nil {
+			bs.Subsidy = w.formatAmount(subsidy)
+		} else if err != bchain.ErrNotSupported {
+			return nil, errors.Annotatef(err, "GetBlockSubsidy %v", bi.Height)
+		}
+		t.Blocks++
+		t.Txs += uint64(bi.Txs)
+		t.TotalSize += uint64(bi.Size)
+		if bi.Weight > 0 {
+			t.WeightBlocks++
+			t.TotalWeight += uint64(bi.Weight)
+			t.SigOps += uint64(bi.SigOps)
+		}
+		fs := fees[bi.Height]
+		if fs == nil {
+			continue
+		}
+		bs.TotalFee = w.formatAmount(&fs.TotalFeesSat)
+		totalFeesSat.Add(&totalFeesSat, &fs.TotalFeesSat)
+		// the same as bitcoind, the average fee of the transactions except the coinbase
+		if bi.Txs > 1 {
+			bs.AvgFee = w.formatAmount(new(big.Int).Div(&fs.TotalFeesSat, big.NewInt(int64(bi.Txs-1))))
+			feeTxs += uint64(bi.Txs - 1)
+		}
+		if len(fs.FeeRates) == len(rates) {
+			bs.FeeRatePercentiles = make([]float64, len(rates))
+			for j, fr := range fs.FeeRates {
+				// stored rates are per 1000 virtual bytes
+				bs.FeeRatePercentiles[j] = float64(fr) / 1000
+				rates[j] += float64(fr) * float64(fs.Txs)
+			}
+			rateTxs += uint64(fs.Txs)
+		}
+	}
+	t.TotalFee = w.formatAmount(&totalFeesSat)
+	if feeTxs > 0 {
+		t.AvgFee = w.formatAmount(totalFeesSat.Div(&totalFeesSat, new(big.Int).SetUint64(feeTxs)))
+	}
+	// the percentiles of the range are the averages of the percentiles of the blocks weighted by the number of transactions
+	if rateTxs > 0 {
+		for j := range rates {
+			rates[j] /= float64(rateTxs) * 1000
+		}
+		t.FeeRatePercentiles = rates
+	}
+	glog.Info("GetBlockStats ", from, "-", to, " finished in ", time.Since(start))
+	return r, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"blockbook/db"
+	"fmt"
+
+	"github.com/juju/errors"
+)
+
+func (w *Worker) burnStatsFromDb(bs *db.BurnStats) BurnStats {
+	r := BurnStats{Outputs: bs.Outputs, Burned: w.formatAmount(&bs.BurnedSat)}
+	if len(bs.AddrDesc) > 0 {
+		r.Address = w.flowAddress(bs.AddrDesc)
+	}
+	return r
+}
+
+// GetBurns returns the cumulative burned supply of the indexed blocks, the unspendable outputs and the outputs to the known burn addresses
+func (w *Worker) GetBurns() (*Burns, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Burns are available only for UTXO chains", true)
+	}
+	if !w.db.BurnsEnabled() {
+		return nil, NewApiError("Burns are not indexed, enable them by the -burns parameter", true)
+	}
+	bestHeight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	bt, err := w.db.GetBurnTotals()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBurnTotals")
+	}
+	r := &Burns{
+		Height:      bestHeight,
+		Outputs:     bt.Outputs,
+		Burned:      w.formatAmount(&bt.BurnedSat),
+		Unspendable: w.burnStatsFromDb(&bt.Unspendable),
+		Addresses:   make([]BurnStats, len(bt.Addresses)),
+	}
+	for i := range bt.Addresses {
+		r.Addresses[i] = w.burnStatsFromDb(&bt.Addresses[i])
+	}
+	return r, nil
+}
+
+// GetAddressBurns returns the cumulative burned outputs to the burn address
+func (w *Worker) GetAddressBurns(address string) (*BurnStats, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Burns are available only for UTXO chains", true)
+	}
+	if !w.db.BurnsEnabled() {
+		return nil, NewApiError("Burns are not indexed, enable them by the -burns parameter", true)
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	bs, err := w.db.GetAddrDescBurns(addrDesc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAddrDescBurns %v", addrDesc)
+	}
+	if bs == nil {
+		bs = &db.BurnStats{}
+	}
+	r := w.burnStatsFromDb(bs)
+	r.Address = address
+	return &r, nil
+}
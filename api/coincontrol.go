@@ -0,0 +1,169 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"fmt"
+	"strconv"
+
+	"github.com/juju/errors"
+)
+
+// maximal length of the wallet identifier of the coin control data
+const maxCoinControlWalletLen = 64
+
+// maximal length of the label of an output
+const maxCoinControlLabelLen = 256
+
+// maximal number of outputs with coin control data of one wallet
+const maxCoinControlOutputs = 10000
+
+// the coin control data are kept per wallet, the wallet is identified by a string chosen by the client,
+// the data are set only through the internal server, the public API returns them to anybody knowing the wallet identifier,
+// the clients should use a random identifier not derived from the addresses of the wallet
+func validateCoinControlWallet(wallet string) error {
+	if wallet == "" || len(wallet) > maxCoinControlWalletLen {
+		return NewApiError(fmt.Sprintf("Wallet must be 1 to %d characters long", maxCoinControlWalletLen), true)
+	}
+	return nil
+}
+
+func coinControlKey(txid string, vout uint32) string {
+	return txid + ":" + strconv.FormatUint(uint64(vout), 10)
+}
+
+// GetCoinControl returns the labels and freeze flags of the outputs of the wallet
+func (w *Worker) GetCoinControl(wallet string) ([]db.CoinControl, error) {
+	if err := validateCoinControlWallet(wallet); err != nil {
+		return nil, err
+	}
+	r, err := w.db.GetCoinControl(wallet)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetCoinControl")
+	}
+	return r, nil
+}
+
+// SetCoinControl sets the label and the freeze flag of the output for the wallet, an empty label of not frozen output removes the data
+// the output must be in the index and the wallet can have the data of at most maxCoinControlOutputs outputs
+func (w *Worker) SetCoinControl(wallet string, cc *db.CoinControl) error {
+	if !w.chainParser.IsUTXOChain() {
+		return NewApiError("Coin control is available only for UTXO chains", true)
+	}
+	if err := validateCoinControlWallet(wallet); err != nil {
+		return err
+	}
+	if len(cc.Label) > maxCoinControlLabelLen {
+		return NewApiError(fmt.Sprintf("Label must be at most %d characters long", maxCoinControlLabelLen), true)
+	}
+	if _, err := w.chainParser.PackTxid(cc.Txid); err != nil {
+		return NewApiError(fmt.Sprintf("Invalid txid, %v", err), true)
+	}
+	ta, err := w.db.GetTxAddresses(cc.Txid)
+	if err != nil {
+		return errors.Annotatef(err, "GetTxAddresses %v", cc.Txid)
+	}
+	if ta == nil || int(cc.Vout) >= len(ta.Outputs) {
+		return NewApiError(fmt.Sprintf("Output %v not found", coinControlKey(cc.Txid, cc.Vout)), true)
+	}
+	if cc.Label != "" || cc.Frozen {
+		ccs, err := w.db.GetCoinControl(wallet)
+		if err != nil {
+			return errors.Annotatef(err, "GetCoinControl")
+		}
+		if len(ccs) >= maxCoinControlOutputs {
+			found := false
+			for i := range ccs {
+				if ccs[i].Txid == cc.Txid && ccs[i].Vout == cc.Vout {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return NewApiError(fmt.Sprintf("Wallet can have coin control data of at most %d outputs", maxCoinControlOutputs), true)
+			}
+		}
+	}
+	if err := w.db.SetCoinControl(wallet, []db.CoinControl{*cc}); err != nil {
+		return errors.Annotatef(err, "SetCoinControl")
+	}
+	return nil
+}
+
+// GetAddressUtxo returns the confirmed unspent outputs of the address, the oldest first
+// if the wallet is given, the outputs contain its coin control data and with excludeFrozen the frozen outputs are omitted
+func (w *Worker) GetAddressUtxo(address string, wallet string, excludeFrozen bool) ([]Utxo, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Unspent outputs are available only for UTXO chains", true)
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Invalid address, %v", err), true)
+	}
+	// the unspent outputs are found in the whole history of the address
+	if err := w.checkAddrDescScan(addrDesc, address); err != nil {
+		return nil, err
+	}
+	coinControl := make(map[string]*db.CoinControl)
+	if wallet != "" {
+		ccs, err := w.GetCoinControl(wallet)
+		if err != nil {
+			return nil, err
+		}
+		for i := range ccs {
+			coinControl[coinControlKey(ccs[i].Txid, ccs[i].Vout)] = &ccs[i]
+		}
+	}
+	bestheight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	r, err := w.getAddrDescUtxo(addrDesc, bestheight, coinControl, excludeFrozen)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAddrDescTransactions %v", address)
+	}
+	return r, nil
+}
+
+// getAddrDescUtxo returns the confirmed unspent outputs of the address descriptor, the oldest first,
+// with the coin control data from the map keyed by coinControlKey
+func (w *Worker) getAddrDescUtxo(addrDesc bchain.AddressDescriptor, bestheight uint32, coinControl map[string]*db.CoinControl, excludeFrozen bool) ([]Utxo, error) {
+	r := make([]Utxo, 0)
+	txas := make(map[string]*db.TxAddresses)
+	err := w.db.GetAddrDescTransactions(addrDesc, 0, ^uint32(0), func(txid string, vout uint32, isOutput bool) error {
+		if !isOutput {
+			return nil
+		}
+		ta, found := txas[txid]
+		if !found {
+			var err error
+			if ta, err = w.db.GetTxAddresses(txid); err != nil {
+				return err
+			}
+			txas[txid] = ta
+		}
+		if ta == nil || int(vout) >= len(ta.Outputs) || ta.Outputs[vout].Spent {
+			return nil
+		}
+		u := Utxo{
+			Txid:          txid,
+			Vout:          vout,
+			Value:         w.formatAmount(&ta.Outputs[vout].ValueSat),
+			Height:        ta.Height,
+			Confirmations: bestheight - ta.Height + 1,
+		}
+		if cc := coinControl[coinControlKey(txid, vout)]; cc != nil {
+			if cc.Frozen && excludeFrozen {
+				return nil
+			}
+			u.Label = cc.Label
+			u.Frozen = cc.Frozen
+		}
+		r = append(r, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
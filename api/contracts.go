@@ -0,0 +1,38 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// addressContractRecheckPeriod is the age of the cached flag of an address without code, after which the code is read again,
+// a contract can be deployed to an address which was already used (CREATE2); the contracts are not checked again
+const addressContractRecheckPeriod = 24 * time.Hour
+
+// isContract returns if there is a contract at the address of account based chain, the address seen for the first time
+// is checked by the backend and the flag is stored to the cache in db; if the backend fails, the stale cached flag is returned
+func (w *Worker) isContract(addrDesc bchain.AddressDescriptor) bool {
+	c, err := w.db.GetAddressContract(addrDesc)
+	if err != nil {
+		glog.Error("GetAddressContract ", addrDesc, ": ", err)
+		return false
+	}
+	if c != nil && (c.Contract || time.Since(time.Unix(c.Checked, 0)) < addressContractRecheckPeriod) {
+		return c.Contract
+	}
+	contract, err := w.chain.IsContract(addrDesc)
+	if err != nil {
+		if err != bchain.ErrNotSupported {
+			glog.Warning("IsContract ", addrDesc, ": ", err)
+		}
+		return c != nil && c.Contract
+	}
+	c = &db.AddressContract{Contract: contract, Checked: time.Now().Unix()}
+	if err = w.db.StoreAddressContract(addrDesc, c); err != nil {
+		glog.Error("StoreAddressContract ", addrDesc, ": ", err)
+	}
+	return contract
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// erc20ContractRefreshPeriod is the age of the cached metadata of ERC-20 token contract, after which they are read from the contract again
+const erc20ContractRefreshPeriod = 7 * 24 * time.Hour
+
+// tokenTypeErc20 is the type of the token transfers of ERC-20 contracts
+const tokenTypeErc20 = "ERC20"
+
+// the reads of the metadata of ERC-20 contracts from the backend triggered by the api requests are limited
+// to erc20ContractFetchRate per second with the burst of erc20ContractFetchBurst reads
+const (
+	erc20ContractFetchRate  = 2
+	erc20ContractFetchBurst = 10
+)
+
+// errErc20FetchLimited is returned if the metadata of the contract are not cached and the limit of the reads is exceeded
+var errErc20FetchLimited = errors.New("Limit of the reads of the contract metadata exceeded")
+
+// erc20FetchLimiter is the token bucket limiting the reads of the metadata of ERC-20 contracts from the backend
+type erc20FetchLimiter struct {
+	mux     sync.Mutex
+	tokens  float64
+	updated time.Time
+}
+
+// allow takes a token from the bucket, it returns false if there is none
+func (l *erc20FetchLimiter) allow(now time.Time) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.updated.IsZero() {
+		l.tokens = erc20ContractFetchBurst
+	} else {
+		l.tokens += now.Sub(l.updated).Seconds() * erc20ContractFetchRate
+		if l.tokens > erc20ContractFetchBurst {
+			l.tokens = erc20ContractFetchBurst
+		}
+	}
+	l.updated = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// getErc20Contract returns the metadata of ERC-20 token contract from the cache in db, the contracts seen for the first time
+// and the contracts with metadata older than erc20ContractRefreshPeriod are read from the backend and stored to the cache
+// if the backend fails or the limit of the reads is exceeded, the stale cached metadata are returned unless refresh is forced
+func (w *Worker) getErc20Contract(contract string, refresh bool) (*db.Erc20Contract, error) {
+	contractDesc, err := w.chainParser.GetAddrDescFromAddress(contract)
+	if err != nil {
+		return nil, NewApiError("Invalid contract address "+contract, true)
+	}
+	c, err := w.db.GetErc20Contract(contractDesc)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil && !refresh && time.Since(time.Unix(c.Fetched, 0)) < erc20ContractRefreshPeriod {
+		return c, nil
+	}
+	if !refresh && !w.erc20Fetches.allow(time.Now()) {
+		if c != nil {
+			return c, nil
+		}
+		return nil, errErc20FetchLimited
+	}
+	ci, err := w.chain.GetErc20ContractInfo(contractDesc)
+	if err != nil {
+		if c != nil && !refresh {
+			glog.Warning("GetErc20ContractInfo ", contract, ": ", err, ", using cached metadata")
+			return c, nil
+		}
+		return nil, errors.Annotatef(err, "GetErc20ContractInfo %v", contract)
+	}
+	c = &db.Erc20Contract{Erc20Contract: *ci, Fetched: time.Now().Unix()}
+	if err = w.db.StoreErc20Contract(contractDesc, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RefreshErc20Contract reads the metadata of ERC-20 token contract from the backend and replaces the cached metadata,
+// it is meant for the contracts which changed their name, symbol or decimals
+func (w *Worker) RefreshErc20Contract(contract string) (*db.Erc20Contract, error) {
+	if w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("ERC-20 tokens are supported only by ethereum type chains", true)
+	}
+	return w.getErc20Contract(contract, true)
+}
+
+// setTokenTransfers sets the ERC-20 token transfers of transaction of ethereum type chain together with the metadata of the tokens
+func (w *Worker) setTokenTransfers(tx *Tx, bchainTx *bchain.Tx) {
+	transfers, err := w.chainParser.GetErc20Transfers(bchainTx)
+	if err != nil {
+		glog.Warning("GetErc20Transfers ", bchainTx.Txid, ": ", err)
+		return
+	}
+	for i := range transfers {
+		t := &transfers[i]
+		tt := TokenTransfer{
+			Type:  tokenTypeErc20,
+			From:  t.From,
+			To:    t.To,
+			Token: t.Contract,
+		}
+		c, err := w.getErc20Contract(t.Contract, false)
+		if err == errErc20FetchLimited {
+			glog.V(1).Info("getErc20Contract ", t.Contract, ": ", err)
+		} else if err != nil {
+			glog.Warning("getErc20Contract ", t.Contract, ": ", err)
+		} else {
+			tt.Name = c.Name
+			tt.Symbol = c.Symbol
+			tt.Decimals = c.Decimals
+		}
+		tt.Value = bchain.AmountToDecimalString(&t.Tokens, tt.Decimals)
+		tx.TokenTransfers = append(tx.TokenTransfers, tt)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// ExportFormat is the CSV schema of the exported address history
+type ExportFormat int
+
+const (
+	// ExportFormatKoinly is the universal CSV format of Koinly
+	ExportFormatKoinly ExportFormat = iota
+	// ExportFormatCoinTracker is the CSV format of CoinTracker
+	ExportFormatCoinTracker
+)
+
+// ParseExportFormat converts the name of the format to ExportFormat
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch s {
+	case "koinly":
+		return ExportFormatKoinly, nil
+	case "cointracker":
+		return ExportFormatCoinTracker, nil
+	}
+	return ExportFormatKoinly, NewApiError(fmt.Sprintf("Unknown export format '%v', expecting 'koinly' or 'cointracker'", s), true)
+}
+
+// String returns the name of the format
+func (f ExportFormat) String() string {
+	if f == ExportFormatCoinTracker {
+		return "cointracker"
+	}
+	return "koinly"
+}
+
+// exportRecord is the movement of the funds of the address in one transaction
+// Sent is the value sent to other addresses excluding the fee, Fee is the part of the transaction fee paid by the address
+type exportRecord struct {
+	Time     time.Time
+	Txid     string
+	Sent     big.Int
+	Received big.Int
+	Fee      big.Int
+}
+
+// newExportRecord computes the movement of the funds of the address in the transaction
+// the fee is attributed to the address in proportion to its share of the transaction inputs,
+// if the address received more than it spent (e.g. a coinjoin), the difference is reported as received
+func newExportRecord(tx *Tx, addrDesc bchain.AddressDescriptor) *exportRecord {
+	r := &exportRecord{
+		Time: time.Unix(tx.Blocktime, 0).UTC(),
+		Txid: tx.Txid,
+	}
+	in := tx.getAddrVinValue(addrDesc)
+	out := tx.getAddrVoutValue(addrDesc)
+	if in.Sign() == 0 {
+		r.Received.Set(out)
+		return r
+	}
+	if tx.FeesSat.Sign() > 0 {
+		if tx.ValueInSat.Sign() > 0 && in.Cmp(&tx.ValueInSat) < 0 {
+			r.Fee.Mul(&tx.FeesSat, in)
+			r.Fee.Div(&r.Fee, &tx.ValueInSat)
+		} else {
+			r.Fee.Set(&tx.FeesSat)
+		}
+	}
+	var net big.Int
+	net.Sub(in, out)
+	net.Sub(&net, &r.Fee)
+	if net.Sign() >= 0 {
+		r.Sent.Set(&net)
+	} else {
+		r.Received.Neg(&net)
+	}
+	return r
+}
+
+// exportColumns returns the header row of the format
+func exportColumns(f ExportFormat) []string {
+	if f == ExportFormatCoinTracker {
+		return []string{"Date", "Received Quantity", "Received Currency", "Sent Quantity", "Sent Currency", "Fee Amount", "Fee Currency", "Tag"}
+	}
+	return []string{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency", "Fee Amount", "Fee Currency",
+		"Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"}
+}
+
+// exportRow formats the record in the format, the zero amounts are left empty together with their currency
+// Blockbook does not have historical fiat rates, the Koinly net worth columns are left empty and the tax tools fill them from their own price data
+func (w *Worker) exportRow(f ExportFormat, r *exportRecord) []string {
+	amount := func(v *big.Int) (string, string) {
+		if v.Sign() == 0 {
+			return "", ""
+		}
+		return w.chainParser.AmountToDecimalString(v), w.is.CoinShortcut
+	}
+	sent, sentCurrency := amount(&r.Sent)
+	received, receivedCurrency := amount(&r.Received)
+	fee, feeCurrency := amount(&r.Fee)
+	if f == ExportFormatCoinTracker {
+		return []string{r.Time.Format("01/02/2006 15:04:05"), received, receivedCurrency, sent, sentCurrency, fee, feeCurrency, ""}
+	}
+	return []string{r.Time.Format("2006-01-02 15:04:05 UTC"), sent, sentCurrency, received, receivedCurrency, fee, feeCurrency,
+		"", "", "", "", r.Txid}
+}
+
+// ExportAddressHistory writes the confirmed history of the address as CSV in the format of a tax tool, the oldest transaction first
+// the function header is called before anything is written, so that the caller can set the response headers
+func (w *Worker) ExportAddressHistory(address string, format ExportFormat, filter *AddressFilter, out io.Writer, header func() error) error {
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	cw := csv.NewWriter(out)
+	err = w.StreamAddressHistory(address, false, filter, func(h *AddressHistoryHeader) error {
+		if err := header(); err != nil {
+			return err
+		}
+		return cw.Write(exportColumns(format))
+	}, func(txid string, tx *Tx) error {
+		// unconfirmed transactions are not taxable events yet
+		if tx.Confirmations == 0 {
+			return nil
+		}
+		r := newExportRecord(tx, addrDesc)
+		if r.Sent.Sign() == 0 && r.Received.Sign() == 0 && r.Fee.Sign() == 0 {
+			return nil
+		}
+		return cw.Write(w.exportRow(format, r))
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
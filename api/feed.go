@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+const (
+	// defaultAddressFeedEntries and maxAddressFeedEntries are the default and the maximum number of transactions in the address feed
+	defaultAddressFeedEntries = 20
+	maxAddressFeedEntries     = 100
+)
+
+// AddressFeedEntry is a confirmed transaction of the address in the address feed,
+// Received and Sent are the values received and sent by the address in the transaction
+type AddressFeedEntry struct {
+	Txid        string
+	Blockheight uint32
+	Blocktime   int64
+	Received    string
+	Sent        string
+}
+
+// AddressFeed contains the newest confirmed transactions of the address, the newest first
+type AddressFeed struct {
+	Address    string
+	CoinName   string
+	BestHeight uint32
+	Entries    []AddressFeedEntry
+}
+
+// GetAddressFeed returns at most count newest confirmed transactions of the address for a feed of the address history,
+// only the returned part of the history is read so that the feed is cheap also for the large addresses
+func (w *Worker) GetAddressFeed(address string, count int) (*AddressFeed, error) {
+	if count <= 0 {
+		count = defaultAddressFeedEntries
+	} else if count > maxAddressFeedEntries {
+		count = maxAddressFeedEntries
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	bestheight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	txids, _, err := w.getAddressTxidsPage(addrDesc, nil, count)
+	if err != nil {
+		return nil, errors.Annotatef(err, "getAddressTxidsPage %v", address)
+	}
+	r := &AddressFeed{
+		Address:    address,
+		CoinName:   w.is.Coin,
+		BestHeight: bestheight,
+		Entries:    make([]AddressFeedEntry, 0, len(txids)),
+	}
+	for _, txid := range txids {
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", txid)
+		}
+		if ta == nil {
+			glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+			continue
+		}
+		bi, err := w.db.GetBlockInfo(ta.Height)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockInfo %v", ta.Height)
+		}
+		if bi == nil {
+			glog.Warning("DB inconsistency:  block height ", ta.Height, ": not found in db")
+			continue
+		}
+		tx := w.txFromTxAddress(txid, ta, bi, bestheight)
+		r.Entries = append(r.Entries, AddressFeedEntry{
+			Txid:        txid,
+			Blockheight: ta.Height,
+			Blocktime:   bi.Time,
+			Received:    w.formatAmount(tx.getAddrVoutValue(addrDesc)),
+			Sent:        w.formatAmount(tx.getAddrVinValue(addrDesc)),
+		})
+	}
+	return r, nil
+}
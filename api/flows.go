@@ -0,0 +1,196 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// maxFlowHops is the maximum length of the searched paths
+	maxFlowHops = 4
+	// maxFlowAddresses is the maximum number of addresses visited by the search
+	maxFlowAddresses = 2000
+	// maxFlowTxsPerAddress is the maximum number of the newest transactions spending from one address followed by the search
+	maxFlowTxsPerAddress = 200
+	// maxFlowTxReads is the maximum number of transactions read by one search
+	maxFlowTxReads = 10000
+	// maxFlowPaths is the maximum number of returned paths
+	maxFlowPaths = 50
+)
+
+// flowEdge is a transfer to an address discovered by the search
+type flowEdge struct {
+	fromDesc string
+	txid     string
+	height   uint32
+	value    big.Int
+}
+
+// GetFlows searches the transactions spending from address from for transfers to address to, directly or through
+// at most maxHops-1 intermediate addresses; the search is breadth-first and bounded, the shortest paths are returned,
+// the hops of a path follow each other in time (a hop is not in an earlier block than the previous one), the newest paths first
+func (w *Worker) GetFlows(from, to string, maxHops int) (*Flows, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Flows are supported only for UTXO chains", true)
+	}
+	if maxHops < 1 || maxHops > maxFlowHops {
+		return nil, NewApiError(fmt.Sprintf("Parameter maxHops must be between 1 and %d", maxFlowHops), true)
+	}
+	fromDesc, err := w.chainParser.GetAddrDescFromAddress(from)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Invalid address %v, %v", from, err), true)
+	}
+	toDesc, err := w.chainParser.GetAddrDescFromAddress(to)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Invalid address %v, %v", to, err), true)
+	}
+	if string(fromDesc) == string(toDesc) {
+		return nil, NewApiError("The addresses must be different", true)
+	}
+	r := &Flows{From: from, To: to, MaxHops: maxHops, Paths: [][]FlowHop{}}
+	// parents maps the discovered addresses to the transfers leading to them from the previous level of the search
+	parents := map[string][]flowEdge{string(fromDesc): nil}
+	level := []string{string(fromDesc)}
+	found := false
+	reads := maxFlowTxReads
+	for hop := 1; hop <= maxHops && !found && len(level) > 0; hop++ {
+		discovered := make(map[string][]flowEdge)
+		for _, ad := range level {
+			if reads <= 0 {
+				r.Truncated = true
+				break
+			}
+			edges, truncated, err := w.getFlowEdges(bchain.AddressDescriptor(ad), &reads)
+			if err != nil {
+				return nil, err
+			}
+			if truncated {
+				r.Truncated = true
+			}
+			for next, e := range edges {
+				if _, visited := parents[next]; visited {
+					continue
+				}
+				discovered[next] = append(discovered[next], e...)
+			}
+		}
+		level = level[:0]
+		for next, e := range discovered {
+			if len(parents) >= maxFlowAddresses {
+				r.Truncated = true
+				break
+			}
+			// the newest transfers first
+			sort.SliceStable(e, func(i, j int) bool { return e[i].height > e[j].height })
+			parents[next] = e
+			level = append(level, next)
+		}
+		_, found = discovered[string(toDesc)]
+	}
+	if found {
+		w.appendFlowPaths(r, parents, string(toDesc), string(fromDesc), nil, ^uint32(0))
+	}
+	return r, nil
+}
+
+// getFlowEdges returns the transfers from the address in the newest transactions spending from it, grouped by the receiving address
+// the change returned to the address itself is not a transfer; the read transactions are subtracted from reads
+func (w *Worker) getFlowEdges(addrDesc bchain.AddressDescriptor, reads *int) (map[string][]flowEdge, bool, error) {
+	var txids []string
+	seen := make(map[string]struct{})
+	truncated := false
+	err := w.db.GetAddrDescTransactionsReverse(addrDesc, 0, ^uint32(0), func(txid string, vout uint32, isOutput bool) error {
+		if isOutput {
+			return nil
+		}
+		if _, found := seen[txid]; found {
+			return nil
+		}
+		if len(txids) >= maxFlowTxsPerAddress || len(txids) >= *reads {
+			truncated = true
+			return &db.StopIteration{}
+		}
+		seen[txid] = struct{}{}
+		txids = append(txids, txid)
+		return nil
+	})
+	*reads -= len(txids)
+	if err != nil {
+		return nil, false, errors.Annotatef(err, "GetAddrDescTransactions %v", addrDesc)
+	}
+	edges := make(map[string][]flowEdge)
+	for _, txid := range txids {
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return nil, false, errors.Annotatef(err, "GetTxAddresses %v", txid)
+		}
+		if ta == nil {
+			continue
+		}
+		// sum the outputs of the transaction to the same address
+		sums := make(map[string]*flowEdge)
+		for i := range ta.Outputs {
+			o := &ta.Outputs[i]
+			to := string(o.AddrDesc)
+			if len(o.AddrDesc) == 0 || to == string(addrDesc) {
+				continue
+			}
+			e, found := sums[to]
+			if !found {
+				e = &flowEdge{fromDesc: string(addrDesc), txid: txid, height: ta.Height}
+				sums[to] = e
+			}
+			e.value.Add(&e.value, &o.ValueSat)
+		}
+		for to, e := range sums {
+			edges[to] = append(edges[to], *e)
+		}
+	}
+	return edges, truncated, nil
+}
+
+// appendFlowPaths walks the transfers back from the address addrDesc to the start of the search and appends the found paths,
+// the transfers to addrDesc must not be in a block after maxHeight, the block of the following hop of the path
+func (w *Worker) appendFlowPaths(r *Flows, parents map[string][]flowEdge, addrDesc, start string, path []FlowHop, maxHeight uint32) {
+	if addrDesc == start {
+		p := make([]FlowHop, len(path))
+		for i := range path {
+			p[i] = path[len(path)-1-i]
+		}
+		r.Paths = append(r.Paths, p)
+		return
+	}
+	to := w.flowAddress(bchain.AddressDescriptor(addrDesc))
+	for i := range parents[addrDesc] {
+		if len(r.Paths) >= maxFlowPaths {
+			r.Truncated = true
+			return
+		}
+		e := &parents[addrDesc][i]
+		if e.height > maxHeight {
+			continue
+		}
+		hop := FlowHop{
+			From:   w.flowAddress(bchain.AddressDescriptor(e.fromDesc)),
+			To:     to,
+			Txid:   e.txid,
+			Height: e.height,
+			Value:  w.formatAmount(&e.value),
+		}
+		w.appendFlowPaths(r, parents, e.fromDesc, start, append(path, hop), e.height)
+	}
+}
+
+// flowAddress returns the address of the address descriptor, or the hex of the descriptor if it is not an address
+func (w *Worker) flowAddress(addrDesc bchain.AddressDescriptor) string {
+	a, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil || len(a) == 0 {
+		return addrDesc.String()
+	}
+	return a[0]
+}
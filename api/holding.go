@@ -0,0 +1,39 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"math/big"
+
+	"github.com/juju/errors"
+)
+
+// secondsPerDay converts the coin-seconds of the holding stats to the coin-days
+var secondsPerDay = big.NewInt(24 * 60 * 60)
+
+// setAddressHolding sets the holding stats of the address, if they are computed by the index
+func (w *Worker) setAddressHolding(r *Address, addrDesc bchain.AddressDescriptor) error {
+	if !w.chainParser.IsUTXOChain() || !w.db.HoldingStatsEnabled() {
+		return nil
+	}
+	hs, err := w.db.GetAddrDescHoldingStats(addrDesc)
+	if err != nil {
+		return errors.Annotatef(err, "GetAddrDescHoldingStats %v", r.AddrStr)
+	}
+	if hs == nil {
+		return nil
+	}
+	var cdd, avg big.Int
+	cdd.Div(&hs.CoinSeconds, secondsPerDay)
+	h := &AddressHolding{
+		SpentOutputs:      hs.Outputs,
+		SpentValue:        w.formatAmount(&hs.ValueSat),
+		CoinDaysDestroyed: w.formatAmount(&cdd),
+		AvgHoldingTime:    int64(hs.HeldSeconds / hs.Outputs),
+	}
+	if hs.ValueSat.Sign() > 0 {
+		avg.Div(&hs.CoinSeconds, &hs.ValueSat)
+		h.AvgValueHoldingTime = avg.Int64()
+	}
+	r.Holding = h
+	return nil
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// SetLargeAddressTxs sets the number of confirmed transactions, above which an address is large, 0 disables the limit;
+// the history of a large address is returned in the summary-only mode page by page using the cursor
+// and the requests scanning the whole history of a large address are refused
+func (w *Worker) SetLargeAddressTxs(n uint32) {
+	w.largeAddressTxs = n
+}
+
+// isLargeAddress returns true if the address of the balance has more transactions than the limit set by SetLargeAddressTxs
+func (w *Worker) isLargeAddress(ba *db.AddrBalance) bool {
+	return w.largeAddressTxs > 0 && ba != nil && ba.Txs > w.largeAddressTxs
+}
+
+func (w *Worker) largeAddressError(address string) error {
+	return NewApiError(fmt.Sprintf("Address %v has more than %d transactions, its whole history is not available, use api/address/%v with the parameter cursor", address, w.largeAddressTxs, address), true)
+}
+
+// CheckAddressScan returns an error if the address is large and its whole history must not be scanned
+func (w *Worker) CheckAddressScan(address string) error {
+	if w.largeAddressTxs == 0 {
+		return nil
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	return w.checkAddrDescScan(addrDesc, address)
+}
+
+// checkAddrDescScan returns an error if the address descriptor is large and its whole history must not be scanned
+func (w *Worker) checkAddrDescScan(addrDesc bchain.AddressDescriptor, address string) error {
+	if w.largeAddressTxs == 0 {
+		return nil
+	}
+	ba, err := w.db.GetAddrDescBalance(addrDesc)
+	if err != nil {
+		return NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	if w.isLargeAddress(ba) {
+		return w.largeAddressError(address)
+	}
+	return nil
+}
+
+// addressCursor is the position in the history of a large address, the newest transactions first;
+// it points to the transaction skip (counted from the newest) of the address in the block height
+type addressCursor struct {
+	height uint32
+	skip   int
+}
+
+func (c *addressCursor) String() string {
+	return strconv.FormatUint(uint64(c.height), 10) + ":" + strconv.Itoa(c.skip)
+}
+
+func parseAddressCursor(s string) (*addressCursor, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, errors.New("Invalid cursor")
+	}
+	h, err := strconv.ParseUint(s[:i], 10, 32)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+	skip, err := strconv.Atoi(s[i+1:])
+	if err != nil || skip < 0 {
+		return nil, errors.New("Invalid cursor")
+	}
+	return &addressCursor{height: uint32(h), skip: skip}, nil
+}
+
+// AddressCursorBeforeTime returns the cursor of the history of an address, which starts by the newest transaction
+// in a block with the time lower than t (unix time); the block times are expected to grow with the height
+func (w *Worker) AddressCursorBeforeTime(t int64) (string, error) {
+	best, err := w.db.GetBestHeight()
+	if err != nil {
+		return "", errors.Annotatef(err, "GetBestHeight")
+	}
+	h, err := w.db.HeightAtTime(t, best)
+	if err != nil {
+		return "", errors.Annotatef(err, "HeightAtTime")
+	}
+	if h == 0 {
+		return "", NewApiError(fmt.Sprintf("No block before the time %d", t), true)
+	}
+	c := addressCursor{height: h - 1}
+	return c.String(), nil
+}
+
+// getAddressTxidsPage returns at most count confirmed transactions of the address starting at the cursor (the newest if nil),
+// and the cursor of the next page, which is nil if there are no more transactions; only the returned part of the history is read
+func (w *Worker) getAddressTxidsPage(addrDesc bchain.AddressDescriptor, cursor *addressCursor, count int) ([]string, *addressCursor, error) {
+	higher := ^uint32(0)
+	if cursor != nil {
+		higher = cursor.height
+	}
+	var r []string
+	var next *addressCursor
+	err := w.db.GetAddrDescHeightTransactionsReverse(addrDesc, 0, higher, func(height uint32, txids []string) error {
+		skip := 0
+		if cursor != nil && height == cursor.height {
+			skip = cursor.skip
+		}
+		// the transactions of the block from the newest, consistent with UniqueTxidsInReverse
+		for i := len(txids) - 1 - skip; i >= 0; i-- {
+			if len(r) == count {
+				next = &addressCursor{height: height, skip: len(txids) - 1 - i}
+				return &db.StopIteration{}
+			}
+			r = append(r, txids[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, next, nil
+}
+
+// getLargeAddress returns the summary of the address and one page of its history starting at the cursor (summary-only mode),
+// used for the large addresses and if the cursor is requested; the number of pages is not known, the next page is requested
+// by the returned cursor
+func (w *Worker) getLargeAddress(address string, addrDesc bchain.AddressDescriptor, ba *db.AddrBalance, cursor string, txsOnPage int, onlyTxids bool, filter *AddressFilter) (*Address, error) {
+	if filter != nil {
+		return nil, NewApiError("The history filter is not available in the summary-only mode of the address", true)
+	}
+	var c *addressCursor
+	if cursor != "" {
+		var err error
+		if c, err = parseAddressCursor(cursor); err != nil {
+			return nil, NewApiError(fmt.Sprintf("Invalid cursor '%v', expecting <height>:<skip>", cursor), true)
+		}
+	}
+	txc, next, err := w.getAddressTxidsPage(addrDesc, c, txsOnPage)
+	if err != nil {
+		return nil, errors.Annotatef(err, "getAddressTxidsPage %v", address)
+	}
+	txm, err := w.getAddressTxids(addrDesc, true)
+	if err != nil {
+		return nil, errors.Annotatef(err, "getAddressTxids %v true", address)
+	}
+	txm = UniqueTxidsInReverse(txm)
+	bestheight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	r := &Address{
+		Paging:                  Paging{ItemsOnPage: txsOnPage},
+		AddrStr:                 address,
+		Balance:                 w.formatAmount(&ba.BalanceSat),
+		TotalReceived:           w.formatAmount(ba.ReceivedSat()),
+		TotalSent:               w.formatAmount(&ba.SentSat),
+		TxApperances:            int(ba.Txs),
+		UnconfirmedTxApperances: len(txm),
+		SummaryOnly:             true,
+	}
+	if next != nil {
+		r.NextCursor = next.String()
+	}
+	// the mempool transactions are returned on the first page
+	var uBalSat big.Int
+	for _, txid := range txm {
+		tx, err := w.GetTransaction(txid, false)
+		// mempool transaction may fail
+		if err != nil {
+			glog.Error("GetTransaction in mempool ", txid, ": ", err)
+			continue
+		}
+		uBalSat.Add(&uBalSat, tx.getAddrVoutValue(addrDesc))
+		uBalSat.Sub(&uBalSat, tx.getAddrVinValue(addrDesc))
+		if c == nil {
+			if onlyTxids {
+				r.Txids = append(r.Txids, tx.Txid)
+			} else {
+				r.Transactions = append(r.Transactions, tx)
+			}
+		}
+	}
+	r.UnconfirmedBalance = w.formatAmount(&uBalSat)
+	for _, txid := range txc {
+		if onlyTxids {
+			r.Txids = append(r.Txids, txid)
+			continue
+		}
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", txid)
+		}
+		if ta == nil {
+			glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+			continue
+		}
+		bi, err := w.db.GetBlockInfo(ta.Height)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockInfo %v", ta.Height)
+		}
+		if bi == nil {
+			glog.Warning("DB inconsistency:  block height ", ta.Height, ": not found in db")
+			continue
+		}
+		r.Transactions = append(r.Transactions, w.txFromTxAddress(txid, ta, bi, bestheight))
+	}
+	if !w.chainParser.IsUTXOChain() {
+		r.IsContract = w.isContract(addrDesc)
+	}
+	if err = w.setAddressHolding(r, addrDesc); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"blockbook/db"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// GetLargestTxs returns n transactions with the highest total value of the outputs in the last window blocks,
+// the transactions are read from the rolling index of the largest transactions of the blocks
+func (w *Worker) GetLargestTxs(window uint32, n int) (*LargestTxs, error) {
+	start := time.Now()
+	if !w.db.LargestTxsEnabled() {
+		return nil, NewApiError("The largest transactions are not indexed, enable them by the -largesttxs parameter", true)
+	}
+	if window == 0 || window > db.MaxLargestTxsWindow {
+		return nil, NewApiError(fmt.Sprintf("Parameter 'window' must be between 1 and %v", db.MaxLargestTxsWindow), true)
+	}
+	if n <= 0 || n > db.MaxLargestTxs {
+		return nil, NewApiError(fmt.Sprintf("Parameter 'n' must be between 1 and %v", db.MaxLargestTxs), true)
+	}
+	bestheight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	txs, err := w.db.GetLargestTxs(window, n)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetLargestTxs %v %v", window, n)
+	}
+	r := &LargestTxs{
+		Window: window,
+		Txs:    make([]LargestTx, 0, len(txs)),
+	}
+	times := make(map[uint32]int64)
+	for i := range txs {
+		tx := &txs[i]
+		t, found := times[tx.Height]
+		if !found {
+			bi, err := w.db.GetBlockInfo(tx.Height)
+			if err != nil {
+				return nil, errors.Annotatef(err, "GetBlockInfo %v", tx.Height)
+			}
+			if bi != nil {
+				t = bi.Time
+			}
+			times[tx.Height] = t
+		}
+		r.Txs = append(r.Txs, LargestTx{
+			Txid:          tx.Txid,
+			Value:         w.formatAmount(&tx.ValueSat),
+			Blockheight:   int(tx.Height),
+			Confirmations: bestheight - tx.Height + 1,
+			Blocktime:     t,
+		})
+	}
+	glog.Info("GetLargestTxs ", window, " ", n, " finished in ", time.Since(start))
+	return r, nil
+}
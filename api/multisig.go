@@ -0,0 +1,42 @@
+package api
+
+import (
+	"blockbook/db"
+	"fmt"
+
+	"github.com/juju/errors"
+)
+
+const (
+	defaultMultisigFeedLimit = 100
+	maxMultisigFeedLimit     = 1000
+)
+
+// GetMultisigFeed returns the events of the registered multisig wallet starting from the sequence number from,
+// the returned Next is the sequence number from which the following events are requested,
+// the feed is ordered by the height, the events found by the scan of the history of the wallet are inserted before
+// the events of the connected blocks as the scan progresses (the feed is read again from 0 after the scan is done),
+// the feed is returned only with the token of the wallet
+func (w *Worker) GetMultisigFeed(wallet, token string, from uint64, limit int) (*MultisigFeed, error) {
+	mw := w.db.GetMultisigWallet(wallet)
+	// the unknown wallet and the invalid token are not distinguished, the names of the wallets are not disclosed
+	if mw == nil || !w.db.ValidMultisigWalletToken(wallet, token) {
+		return nil, NewApiError(fmt.Sprintf("Multisig wallet '%v' is not registered or the token is invalid", wallet), true)
+	}
+	if limit <= 0 {
+		limit = defaultMultisigFeedLimit
+	} else if limit > maxMultisigFeedLimit {
+		limit = maxMultisigFeedLimit
+	}
+	events, err := w.db.GetMultisigEvents(wallet, from, limit)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetMultisigEvents %v", wallet)
+	}
+	r := &MultisigFeed{Wallet: wallet, Events: events, Next: from, Scan: mw.Scan}
+	if len(events) > 0 {
+		r.Next = events[len(events)-1].Seq + 1
+	} else {
+		r.Events = []db.MultisigEvent{}
+	}
+	return r, nil
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"blockbook/bchain"
+
+	"github.com/juju/errors"
+)
+
+// GetName returns the current value and owner of the name and the history of its operations,
+// the name not updated within the expiration depth of the coin is returned as expired without the value and owner
+func (w *Worker) GetName(name string) (*Name, error) {
+	if _, err := w.chainParser.GetNameOperation(nil); err == bchain.ErrNotSupported {
+		return nil, NewApiError("Names are not supported by the coin", true)
+	}
+	records, err := w.db.GetNameHistory([]byte(name))
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetNameHistory %v", name)
+	}
+	if len(records) == 0 {
+		return nil, NewApiError("Name not found", true)
+	}
+	r := &Name{Name: name, History: make([]NameOp, len(records))}
+	for i := range records {
+		nr := &records[i]
+		op := &r.History[i]
+		op.Txid = nr.Txid
+		op.Vout = nr.Vout
+		op.Height = nr.Height
+		op.Op = nr.Op.String()
+		op.Value = string(nr.Value)
+		if a, _, err := w.chainParser.GetAddressesFromAddrDesc(nr.Owner); err == nil && len(a) > 0 {
+			op.Owner = a[0]
+		}
+	}
+	// the last operation determines the current state of the name
+	last := &r.History[len(r.History)-1]
+	r.Value = last.Value
+	r.Owner = last.Owner
+	r.Height = last.Height
+	r.Txid = last.Txid
+	// the name expires if it is not updated within the expiration depth valid at the current height
+	bestHeight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	if depth := w.chainParser.GetNameExpirationDepth(bestHeight); depth > 0 {
+		r.ExpiresAt = last.Height + depth
+		if r.ExpiresAt <= bestHeight {
+			r.Expired = true
+			r.Value = ""
+			r.Owner = ""
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"blockbook/db"
+	"fmt"
+
+	"github.com/juju/errors"
+)
+
+func (w *Worker) checkOrdinals() error {
+	if !w.db.OrdinalsEnabled() {
+		return NewApiError("Ordinals inscriptions are not tracked, enable them by the -ordinals parameter", true)
+	}
+	return nil
+}
+
+// inscriptionFromDb converts the inscription, the address of its location is set to address or resolved from the txAddresses of the location
+func (w *Worker) inscriptionFromDb(ins *db.Inscription, address string) Inscription {
+	r := Inscription{
+		ID:            ins.ID,
+		Height:        ins.Height,
+		ContentType:   ins.ContentType,
+		ContentLength: ins.ContentLength,
+		Txid:          ins.Txid,
+		Vout:          ins.Vout,
+		Offset:        ins.Offset,
+		Address:       address,
+	}
+	if address == "" && ins.Vout != db.InscriptionFeeVout {
+		ta, err := w.db.GetTxAddresses(ins.Txid)
+		if err == nil && ta != nil && int(ins.Vout) < len(ta.Outputs) {
+			if a, _, err := ta.Outputs[ins.Vout].Addresses(w.chainParser); err == nil && len(a) == 1 {
+				r.Address = a[0]
+			}
+		}
+	}
+	return r
+}
+
+// GetInscription returns the ordinals inscription with the id <genesis txid>i<index> and its current location
+func (w *Worker) GetInscription(id string) (*Inscription, error) {
+	if err := w.checkOrdinals(); err != nil {
+		return nil, err
+	}
+	ins, err := w.db.GetInscription(id)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Inscription not found, %v", err), true)
+	}
+	if ins == nil {
+		return nil, NewApiError("Inscription not found", true)
+	}
+	r := w.inscriptionFromDb(ins, "")
+	return &r, nil
+}
+
+// GetAddressInscriptions returns the ordinals inscriptions held by the unspent outputs of the address
+func (w *Worker) GetAddressInscriptions(address string) (*AddressInscriptions, error) {
+	if err := w.checkOrdinals(); err != nil {
+		return nil, err
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	inscriptions, err := w.db.GetAddrDescInscriptions(addrDesc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAddrDescInscriptions %v", addrDesc)
+	}
+	r := &AddressInscriptions{Address: address, Inscriptions: make([]Inscription, len(inscriptions))}
+	for i := range inscriptions {
+		r.Inscriptions[i] = w.inscriptionFromDb(&inscriptions[i], address)
+	}
+	return r, nil
+}
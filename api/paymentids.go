@@ -0,0 +1,83 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const (
+	defaultPaymentIDTxsLimit = 100
+	maxPaymentIDTxsLimit     = 1000
+)
+
+// setOutputMemo sets the memo and the hex encoded payment id attached to the output script
+func (w *Worker) setOutputMemo(vout *Vout, addrDesc bchain.AddressDescriptor) {
+	if len(addrDesc) == 0 {
+		return
+	}
+	m, err := w.chainParser.GetOutputMemo(addrDesc)
+	if err != nil || m == nil {
+		return
+	}
+	vout.Memo = m.Memo
+	if len(m.PaymentID) > 0 {
+		vout.PaymentID = hex.EncodeToString(m.PaymentID)
+	}
+}
+
+// parsePaymentIDCursor parses the cursor <height>:<txid> of the transactions with the payment id
+func parsePaymentIDCursor(cursor string) (uint32, string, error) {
+	i := strings.IndexByte(cursor, ':')
+	if i < 0 || i == len(cursor)-1 {
+		return 0, "", errors.New("Invalid cursor")
+	}
+	h, err := strconv.ParseUint(cursor[:i], 10, 32)
+	if err != nil {
+		return 0, "", errors.New("Invalid cursor")
+	}
+	return uint32(h), cursor[i+1:], nil
+}
+
+// GetPaymentIDTxs returns at most limit transactions with the outputs carrying the hex encoded payment id ordered by height,
+// starting at the cursor <height>:<txid> (from the first transaction if empty), the next page is requested by the returned cursor
+func (w *Worker) GetPaymentIDTxs(paymentID string, cursor string, limit int) (*PaymentIDTxs, error) {
+	if !w.db.PaymentIDsEnabled() {
+		return nil, NewApiError("Payment ids are not indexed, enable them by the -paymentids parameter", true)
+	}
+	id, err := hex.DecodeString(paymentID)
+	if err != nil || len(id) == 0 {
+		return nil, NewApiError("Invalid payment id, expecting hex encoded data", true)
+	}
+	var fromHeight uint32
+	var fromTxid string
+	if cursor != "" {
+		if fromHeight, fromTxid, err = parsePaymentIDCursor(cursor); err != nil {
+			return nil, NewApiError(fmt.Sprintf("Invalid cursor '%v', expecting <height>:<txid>", cursor), true)
+		}
+	}
+	if limit <= 0 {
+		limit = defaultPaymentIDTxsLimit
+	} else if limit > maxPaymentIDTxsLimit {
+		limit = maxPaymentIDTxsLimit
+	}
+	// one more transaction is read to find the cursor of the next page
+	txs, err := w.db.GetPaymentIDTxs(id, fromHeight, fromTxid, limit+1)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetPaymentIDTxs %v", paymentID)
+	}
+	r := &PaymentIDTxs{PaymentID: hex.EncodeToString(id)}
+	if len(txs) > limit {
+		r.NextCursor = strconv.FormatUint(uint64(txs[limit].Height), 10) + ":" + txs[limit].Txid
+		txs = txs[:limit]
+	}
+	r.Txs = make([]PaymentIDTx, len(txs))
+	for i := range txs {
+		r.Txs[i] = PaymentIDTx{Txid: txs[i].Txid, Height: txs[i].Height, Vouts: txs[i].Vouts}
+	}
+	return r, nil
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+func doubleSha256(b []byte) []byte {
+	h := sha256.Sum256(b)
+	h = sha256.Sum256(h[:])
+	return h[:]
+}
+
+// reversedHex decodes the hex string of a hash displayed in the reversed byte order (txid, block hash) to the internal byte order
+func reversedHex(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b, nil
+}
+
+func toReversedHex(b []byte) string {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return hex.EncodeToString(r)
+}
+
+// merkleBranch computes the merkle branch of the transaction at position pos and the merkle root of the txids in the bitcoin way,
+// the last hash of a level with odd number of hashes is paired with itself
+func merkleBranch(txids []string, pos int) ([]string, string, error) {
+	level := make([][]byte, len(txids))
+	for i, txid := range txids {
+		h, err := reversedHex(txid)
+		if err != nil {
+			return nil, "", errors.Annotatef(err, "txid %v", txid)
+		}
+		level[i] = h
+	}
+	branch := make([]string, 0)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, toReversedHex(level[pos^1]))
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			next[i] = doubleSha256(append(append([]byte(nil), level[2*i]...), level[2*i+1]...))
+		}
+		level = next
+		pos /= 2
+	}
+	return branch, toReversedHex(level[0]), nil
+}
+
+// serializeBlockHeader reconstructs the 80 byte header of a bitcoin type block and checks that its hash matches the block hash
+// returns nil if the header of the coin has a different format or the backend does not return all the fields
+func serializeBlockHeader(bi *bchain.BlockInfo) []byte {
+	version, err := bi.Version.Int64()
+	if err != nil {
+		return nil
+	}
+	nonce, err := strconv.ParseUint(string(bi.Nonce), 10, 32)
+	if err != nil {
+		return nil
+	}
+	bits, err := strconv.ParseUint(bi.Bits, 16, 32)
+	if err != nil {
+		return nil
+	}
+	prev := make([]byte, 32)
+	if bi.Prev != "" {
+		if prev, err = reversedHex(bi.Prev); err != nil || len(prev) != 32 {
+			return nil
+		}
+	}
+	root, err := reversedHex(bi.MerkleRoot)
+	if err != nil || len(root) != 32 {
+		return nil
+	}
+	h := make([]byte, 80)
+	binary.LittleEndian.PutUint32(h[0:], uint32(version))
+	copy(h[4:], prev)
+	copy(h[36:], root)
+	binary.LittleEndian.PutUint32(h[68:], uint32(bi.Time))
+	binary.LittleEndian.PutUint32(h[72:], uint32(bits))
+	binary.LittleEndian.PutUint32(h[76:], uint32(nonce))
+	hash, err := reversedHex(bi.Hash)
+	if err != nil || !bytes.Equal(doubleSha256(h), hash) {
+		return nil
+	}
+	return h
+}
+
+// GetTxProofBundle returns the raw confirmed transaction together with the block header and the merkle branch proving its inclusion in the block
+func (w *Worker) GetTxProofBundle(txid string) (*TxProofBundle, error) {
+	start := time.Now()
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Transaction proofs are supported only by UTXO chains", true)
+	}
+	bchainTx, height, err := w.txCache.GetTransaction(txid)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Tx not found, %v", err), true)
+	}
+	if bchainTx.Confirmations == 0 {
+		return nil, NewApiError(fmt.Sprintf("Transaction %v is not confirmed", txid), true)
+	}
+	hash, err := w.db.GetBlockHash(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHash %v", height)
+	}
+	bi, err := w.chain.GetBlockInfo(hash)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockInfo %v", hash)
+	}
+	pos := -1
+	for i := range bi.Txids {
+		if bi.Txids[i] == txid {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil, errors.Errorf("Transaction %v not found in block %v", txid, hash)
+	}
+	branch, root, err := merkleBranch(bi.Txids, pos)
+	if err != nil {
+		return nil, err
+	}
+	if bi.MerkleRoot != "" && bi.MerkleRoot != root {
+		return nil, errors.Errorf("Merkle root %v of block %v does not match the computed root %v", bi.MerkleRoot, hash, root)
+	}
+	r := &TxProofBundle{
+		Txid:          txid,
+		Hex:           bchainTx.Hex,
+		BlockHash:     hash,
+		BlockHeight:   height,
+		Confirmations: bchainTx.Confirmations,
+		MerkleRoot:    root,
+		Pos:           pos,
+		Merkle:        branch,
+	}
+	if h := serializeBlockHeader(bi); h != nil {
+		r.Header = hex.EncodeToString(h)
+	}
+	glog.Info("GetTxProofBundle ", txid, " finished in ", time.Since(start))
+	return r, nil
+}
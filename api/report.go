@@ -0,0 +1,139 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// MaxReportAddresses is the maximum number of addresses in one report request
+const MaxReportAddresses = 1000
+
+// GetReceivedReport returns the total value of the outputs to the set of addresses in the blocks from-to (heights)
+// and with the block time in fromTime-toTime (unix time, zero is not limited), for example to compute a settlement batch;
+// the outputs are streamed from the addresses index and only the sums are kept in memory
+func (w *Worker) GetReceivedReport(addresses []string, from, to uint32, fromTime, toTime int64) (*ReceivedReport, error) {
+	start := time.Now()
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Reports are available only for UTXO chains", true)
+	}
+	if len(addresses) == 0 {
+		return nil, NewApiError("Missing addresses", true)
+	}
+	if len(addresses) > MaxReportAddresses {
+		return nil, NewApiError(fmt.Sprintf("Too many addresses, the maximum is %d", MaxReportAddresses), true)
+	}
+	if to < from {
+		return nil, NewApiError("Parameter 'to' must not be lower than parameter 'from'", true)
+	}
+	if fromTime != 0 && toTime != 0 && toTime < fromTime {
+		return nil, NewApiError("Parameter 'toTime' must not be lower than parameter 'fromTime'", true)
+	}
+	best, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	if to > best {
+		to = best
+	}
+	if fromTime != 0 {
+		h, err := w.db.HeightAtTime(fromTime, best)
+		if err != nil {
+			return nil, errors.Annotatef(err, "HeightAtTime")
+		}
+		if h > from {
+			from = h
+		}
+	}
+	empty := from > to
+	if toTime != 0 {
+		h, err := w.db.HeightAtTime(toTime+1, best)
+		if err != nil {
+			return nil, errors.Annotatef(err, "HeightAtTime")
+		}
+		if h <= from {
+			// all blocks of the range are newer than toTime
+			empty = true
+		} else if h-1 < to {
+			to = h - 1
+		}
+	}
+	r := &ReceivedReport{
+		FromHeight: from,
+		ToHeight:   to,
+		FromTime:   fromTime,
+		ToTime:     toTime,
+		Addresses:  make([]ReceivedReportAddress, 0, len(addresses)),
+	}
+	var totalSat big.Int
+	seen := make(map[string]struct{}, len(addresses))
+	for _, address := range addresses {
+		addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+		if err != nil {
+			return nil, NewApiError(fmt.Sprintf("Address %v not found, %v", address, err), true)
+		}
+		if _, found := seen[string(addrDesc)]; found {
+			continue
+		}
+		seen[string(addrDesc)] = struct{}{}
+		if err := w.checkAddrDescScan(addrDesc, address); err != nil {
+			return nil, err
+		}
+		// convert the address to the format defined by the parser
+		a, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+		if err != nil {
+			glog.V(2).Infof("GetAddressesFromAddrDesc error %v, %v", err, addrDesc)
+		}
+		if len(a) == 1 {
+			address = a[0]
+		}
+		ra := ReceivedReportAddress{Address: address}
+		var receivedSat big.Int
+		if !empty {
+			if ra.Outputs, err = w.sumAddrDescOutputs(addrDesc, from, to, &receivedSat); err != nil {
+				return nil, errors.Annotatef(err, "sumAddrDescOutputs %v", address)
+			}
+			totalSat.Add(&totalSat, &receivedSat)
+			r.Outputs += ra.Outputs
+		}
+		ra.Received = w.formatAmount(&receivedSat)
+		r.Addresses = append(r.Addresses, ra)
+	}
+	r.Received = w.formatAmount(&totalSat)
+	glog.Info("GetReceivedReport ", len(r.Addresses), " addresses, blocks ", from, "-", to, ", finished in ", time.Since(start))
+	return r, nil
+}
+
+// sumAddrDescOutputs adds the values of the outputs to the address descriptor in the blocks lower-higher to sum
+// and returns the number of the outputs
+func (w *Worker) sumAddrDescOutputs(addrDesc bchain.AddressDescriptor, lower, higher uint32, sum *big.Int) (int, error) {
+	outputs := 0
+	var lastTxid string
+	var ta *db.TxAddresses
+	err := w.db.GetAddrDescTransactions(addrDesc, lower, higher, func(txid string, vout uint32, isOutput bool) error {
+		if !isOutput {
+			return nil
+		}
+		// the outputs of one transaction follow each other
+		if txid != lastTxid {
+			var err error
+			if ta, err = w.db.GetTxAddresses(txid); err != nil {
+				return errors.Annotatef(err, "GetTxAddresses %v", txid)
+			}
+			lastTxid = txid
+		}
+		if ta == nil || int(vout) >= len(ta.Outputs) {
+			glog.Warning("DB inconsistency:  tx ", txid, ": output ", vout, " not found in txAddresses")
+			return nil
+		}
+		sum.Add(sum, &ta.Outputs[vout].ValueSat)
+		outputs++
+		return nil
+	})
+	return outputs, err
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// GetSilentPaymentsHistory returns the outputs detected for the configured silent payments wallet, the oldest first
+func (w *Worker) GetSilentPaymentsHistory(wallet string) (*SilentPaymentsHistory, error) {
+	if w.db.GetSilentPaymentsWallet(wallet) == nil {
+		return nil, NewApiError(fmt.Sprintf("Silent payments wallet '%v' is not configured", wallet), true)
+	}
+	sps, err := w.db.GetSilentPayments(wallet)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetSilentPayments %v", wallet)
+	}
+	bestheight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	r := &SilentPaymentsHistory{Wallet: wallet, Payments: make([]SilentPayment, len(sps))}
+	var received, balance big.Int
+	txs := make(map[string]struct{})
+	for i := range sps {
+		sp := &sps[i]
+		ta, err := w.db.GetTxAddresses(sp.Txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", sp.Txid)
+		}
+		spent := ta != nil && int(sp.Vout) < len(ta.Outputs) && ta.Outputs[sp.Vout].Spent
+		r.Payments[i] = SilentPayment{
+			Txid:          sp.Txid,
+			Vout:          sp.Vout,
+			Value:         w.formatAmount(&sp.ValueSat),
+			Height:        sp.Height,
+			Confirmations: bestheight - sp.Height + 1,
+			K:             sp.K,
+			Tweak:         hex.EncodeToString(sp.Tweak),
+			Spent:         spent,
+		}
+		received.Add(&received, &sp.ValueSat)
+		if !spent {
+			balance.Add(&balance, &sp.ValueSat)
+			r.Unspent++
+		}
+		txs[sp.Txid] = struct{}{}
+	}
+	r.Received = w.formatAmount(&received)
+	r.Balance = w.formatAmount(&balance)
+	r.Txs = len(txs)
+	return r, nil
+}
+
+// RescanSilentPayments detects the outputs paying to the configured silent payments wallet in the already indexed blocks
+// from-to, the blocks are read again from the backend, returns the number of found outputs
+func (w *Worker) RescanSilentPayments(wallet string, from, to uint32) (int, error) {
+	spw := w.db.GetSilentPaymentsWallet(wallet)
+	if spw == nil {
+		return 0, NewApiError(fmt.Sprintf("Silent payments wallet '%v' is not configured", wallet), true)
+	}
+	bestheight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return 0, errors.Annotatef(err, "GetBestBlock")
+	}
+	if to > bestheight {
+		to = bestheight
+	}
+	if from > to {
+		return 0, NewApiError("Parameter 'from' must not be greater than 'to' and the best block", true)
+	}
+	found := 0
+	for h := from; h <= to; h++ {
+		block, err := w.chain.GetBlock("", h)
+		if err != nil {
+			return found, errors.Annotatef(err, "GetBlock %v", h)
+		}
+		n, err := w.db.RescanSilentPayments(block, spw)
+		if err != nil {
+			return found, errors.Annotatef(err, "RescanSilentPayments %v", h)
+		}
+		found += n
+		if h > from && (h-from)%1000 == 0 {
+			glog.Info("silent payments: rescan of wallet ", wallet, " at height ", h, ", found ", found)
+		}
+	}
+	return found, nil
+}
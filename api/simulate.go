@@ -0,0 +1,134 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/juju/errors"
+)
+
+// simulatedAddress collects the effect of the simulated transaction on an address
+type simulatedAddress struct {
+	addrDesc    bchain.AddressDescriptor
+	change      big.Int
+	unconfirmed big.Int
+	result      SimulatedAddress
+}
+
+// SimulateTx decodes the raw transaction and computes its effect on the balances of the involved addresses
+// according to the index, the transaction is not sent; the inputs spending outputs which are already spent
+// in the index or in the mempool, which are not known or which are spent by an earlier input of the transaction
+// are not counted to the balances and are reported separately
+func (w *Worker) SimulateTx(rawTx string) (*SimulatedTx, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Simulation of transactions is supported only for UTXO chains", true)
+	}
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, NewApiError("Invalid hex string", true)
+	}
+	tx, err := w.chainParser.ParseTx(b)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Cannot decode transaction, %v", err), true)
+	}
+	r := &SimulatedTx{Txid: tx.Txid, Addresses: []SimulatedAddress{}}
+	var addresses []*simulatedAddress
+	byDesc := make(map[string]*simulatedAddress)
+	getAddress := func(addrDesc bchain.AddressDescriptor) *simulatedAddress {
+		if a, found := byDesc[string(addrDesc)]; found {
+			return a
+		}
+		// only the addresses which can be indexed are reported
+		ad, searchable, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+		if err != nil || !searchable || len(ad) == 0 {
+			return nil
+		}
+		a := &simulatedAddress{addrDesc: addrDesc}
+		a.result.Address = ad[0]
+		byDesc[string(addrDesc)] = a
+		addresses = append(addresses, a)
+		return a
+	}
+	var valueIn, valueOut big.Int
+	inputs := make(map[string]struct{}, len(tx.Vin))
+	for i := range tx.Vin {
+		vin := &tx.Vin[i]
+		if vin.Txid != "" {
+			outpoint := vin.Txid + ":" + strconv.FormatUint(uint64(vin.Vout), 10)
+			if _, found := inputs[outpoint]; found {
+				r.DuplicateInputs = append(r.DuplicateInputs, i)
+				continue
+			}
+			inputs[outpoint] = struct{}{}
+		}
+		addrDesc, value, status, err := w.getSpentOutput(tx.Txid, vin)
+		if err != nil {
+			return nil, err
+		}
+		switch status {
+		case TestTxInputUnknown:
+			r.UnknownInputs = append(r.UnknownInputs, i)
+			continue
+		case TestTxInputSpent, TestTxInputSpentInMempool:
+			r.SpentInputs = append(r.SpentInputs, i)
+			continue
+		}
+		valueIn.Add(&valueIn, value)
+		if a := getAddress(addrDesc); a != nil {
+			a.change.Sub(&a.change, value)
+			// the unconfirmed outputs are not in the confirmed balance of the address
+			if status == TestTxInputMempool {
+				a.unconfirmed.Add(&a.unconfirmed, value)
+			}
+			a.result.ConsumedUtxos = append(a.result.ConsumedUtxos, SimulatedUtxo{
+				Txid:    vin.Txid,
+				Vout:    vin.Vout,
+				Value:   w.formatAmount(value),
+				Mempool: status == TestTxInputMempool,
+			})
+		}
+	}
+	for i := range tx.Vout {
+		vout := &tx.Vout[i]
+		valueOut.Add(&valueOut, &vout.ValueSat)
+		addrDesc, err := w.chainParser.GetAddrDescFromVout(vout)
+		if err != nil || len(addrDesc) == 0 {
+			continue
+		}
+		if a := getAddress(addrDesc); a != nil {
+			a.change.Add(&a.change, &vout.ValueSat)
+		}
+	}
+	for _, a := range addresses {
+		ab, err := w.db.GetAddrDescBalance(a.addrDesc)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetAddrDescBalance %v", a.result.Address)
+		}
+		var balance, newBalance big.Int
+		if ab != nil {
+			balance.Set(&ab.BalanceSat)
+		}
+		balance.Add(&balance, &a.unconfirmed)
+		newBalance.Add(&balance, &a.change)
+		if newBalance.Sign() < 0 {
+			// the unspent outputs in the index are not covered by the balance, the index is not consistent
+			return nil, errors.Errorf("Balance of address %v is lower than its unspent outputs spent by the transaction", a.result.Address)
+		}
+		a.result.Balance = w.formatAmount(&balance)
+		a.result.BalanceChange = w.formatAmount(&a.change)
+		a.result.NewBalance = w.formatAmount(&newBalance)
+		r.Addresses = append(r.Addresses, a.result)
+	}
+	r.ValueOut = w.formatAmount(&valueOut)
+	// the fees are known only if all inputs are known
+	if len(r.UnknownInputs) == 0 && len(r.SpentInputs) == 0 && len(r.DuplicateInputs) == 0 {
+		r.ValueIn = w.formatAmount(&valueIn)
+		var fees big.Int
+		fees.Sub(&valueIn, &valueOut)
+		r.Fees = w.formatAmount(&fees)
+	}
+	return r, nil
+}
@@ -51,14 +51,18 @@ type ScriptPubKey struct {
 	Type       string                   `json:"type,omitempty"`
 }
 type Vout struct {
-	Value        string       `json:"value"`
-	ValueSat     big.Int      `json:"-"`
-	N            int          `json:"n"`
-	ScriptPubKey ScriptPubKey `json:"scriptPubKey"`
-	Spent        bool         `json:"spent"`
-	SpentTxID    string       `json:"spentTxId,omitempty"`
-	SpentIndex   int          `json:"spentIndex,omitempty"`
-	SpentHeight  int          `json:"spentHeight,omitempty"`
+	Value        string                    `json:"value"`
+	ValueSat     big.Int                   `json:"-"`
+	N            int                       `json:"n"`
+	ScriptPubKey ScriptPubKey              `json:"scriptPubKey"`
+	Spent        bool                      `json:"spent"`
+	SpentTxID    string                    `json:"spentTxId,omitempty"`
+	SpentIndex   int                       `json:"spentIndex,omitempty"`
+	SpentHeight  int                       `json:"spentHeight,omitempty"`
+	Reward       string                    `json:"reward,omitempty"`
+	Annotations  []bchain.ScriptAnnotation `json:"annotations,omitempty"`
+	Memo         string                    `json:"memo,omitempty"`
+	PaymentID    string                    `json:"paymentId,omitempty"`
 }
 
 type Tx struct {
@@ -80,6 +84,102 @@ type Tx struct {
 	Fees          string  `json:"fees"`
 	FeesSat       big.Int `json:"-"`
 	Hex           string  `json:"hex"`
+	Type          string  `json:"type,omitempty"`
+	// Coinjoin describes the equal outputs of transactions tagged as coinjoin
+	Coinjoin *Coinjoin `json:"coinjoin,omitempty"`
+	// MempoolPackage describes the unconfirmed ancestors and descendants of unconfirmed transactions, which are mined together
+	// with the transaction (child pays for parent), it is set only if the transaction has any
+	MempoolPackage *bchain.MempoolPackage `json:"mempoolPackage,omitempty"`
+	// EthereumSpecific contains the gas parameters of transactions of ethereum type chains
+	EthereumSpecific *EthereumSpecific `json:"ethereumSpecific,omitempty"`
+	// TokenTransfers are the ERC-20 transfers of transactions of ethereum type chains
+	TokenTransfers []TokenTransfer `json:"tokenTransfers,omitempty"`
+	// ContractCall is the called method and its decoded parameters of the contract calls of ethereum type chains,
+	// it is set only if the selector of the call is in the dictionary of the method signatures
+	ContractCall *bchain.ContractCall `json:"contractCall,omitempty"`
+}
+
+// Coinjoin is the tag of the coinjoin transaction detected during the block connect, Type is the pattern of the coinjoin
+// (coinjoin, whirlpool or wasabi) and Denomination the value of the equal outputs
+type Coinjoin struct {
+	Type         string `json:"type"`
+	EqualOutputs int    `json:"equalOutputs"`
+	Denomination string `json:"denomination"`
+}
+
+// EthereumSpecific contains the gas parameters of ethereum transaction, the gas prices are in wei
+type EthereumSpecific struct {
+	Type                 uint32 `json:"type"`
+	GasLimit             uint64 `json:"gasLimit"`
+	GasPrice             string `json:"gasPrice"`
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+	EffectiveGasPrice    string `json:"effectiveGasPrice,omitempty"`
+	// blob parameters of EIP-4844 transactions, BlobGasUsed and BlobGasPrice are set only for mined transactions
+	MaxFeePerBlobGas    string   `json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes []string `json:"blobVersionedHashes,omitempty"`
+	BlobGasUsed         uint64   `json:"blobGasUsed,omitempty"`
+	BlobGasPrice        string   `json:"blobGasPrice,omitempty"`
+}
+
+// TokenTransfer is a transfer of ERC-20 tokens, Value is formatted using the decimals of the token
+// Name, Symbol and Decimals are empty if the metadata of the token contract are not available
+type TokenTransfer struct {
+	Type     string `json:"type"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+	Value    string `json:"value"`
+}
+
+// MessageVerification is the result of the verification of the message signed by the key of the address
+type MessageVerification struct {
+	Address string `json:"address"`
+	Valid   bool   `json:"valid"`
+}
+
+// Utxo is an unspent output of the address, with the coin control data of the wallet if the wallet was given
+type Utxo struct {
+	Txid          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Value         string `json:"value"`
+	Height        uint32 `json:"height"`
+	Confirmations uint32 `json:"confirmations"`
+	Label         string `json:"label,omitempty"`
+	Frozen        bool   `json:"frozen,omitempty"`
+}
+
+// SilentPayment is an output paying to a silent payments wallet, Tweak is the hex encoded tweak of the spend key of the wallet
+type SilentPayment struct {
+	Txid          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Value         string `json:"value"`
+	Height        uint32 `json:"height"`
+	Confirmations uint32 `json:"confirmations"`
+	K             uint32 `json:"k"`
+	Tweak         string `json:"tweak"`
+	Spent         bool   `json:"spent"`
+}
+
+// SilentPaymentsHistory is the history of a silent payments wallet aggregated from the detected outputs like the history of an address
+type SilentPaymentsHistory struct {
+	Wallet   string          `json:"wallet"`
+	Received string          `json:"received"`
+	Balance  string          `json:"balance"`
+	Txs      int             `json:"txs"`
+	Unspent  int             `json:"unspent"`
+	Payments []SilentPayment `json:"payments"`
+}
+
+// MultisigFeed is a page of the activity feed of a multisig wallet, Scan is the progress of the scan of the history of the wallet
+type MultisigFeed struct {
+	Wallet string             `json:"wallet"`
+	Events []db.MultisigEvent `json:"events"`
+	Next   uint64             `json:"next"`
+	Scan   *db.MultisigScan   `json:"scan,omitempty"`
 }
 
 type Paging struct {
@@ -91,6 +191,54 @@ type Paging struct {
 type Address struct {
 	Paging
 	AddrStr                 string   `json:"addrStr"`
+	IsContract              bool     `json:"isContract,omitempty"`
+	Balance                 string   `json:"balance"`
+	TotalReceived           string   `json:"totalReceived"`
+	TotalSent               string   `json:"totalSent"`
+	UnconfirmedBalance      string   `json:"unconfirmedBalance"`
+	UnconfirmedTxApperances int      `json:"unconfirmedTxApperances"`
+	TxApperances            int      `json:"txApperances"`
+	Transactions            []*Tx    `json:"txs,omitempty"`
+	Txids                   []string `json:"transactions,omitempty"`
+	// SummaryOnly is set if the history is paged by the cursor, the number of pages is not known
+	SummaryOnly bool   `json:"summaryOnly,omitempty"`
+	NextCursor  string `json:"nextCursor,omitempty"`
+	// the withdrawals from the beacon chain to the address are merged with the transactions by the height to one paged history
+	WithdrawalApperances int           `json:"withdrawalApperances,omitempty"`
+	TotalWithdrawn       string        `json:"totalWithdrawn,omitempty"`
+	Withdrawals          []*Withdrawal `json:"withdrawals,omitempty"`
+	// the holding stats of the spent outputs of the address, set only if enabled by the -holdingstats parameter
+	Holding *AddressHolding `json:"holding,omitempty"`
+}
+
+// AddressHolding are the stats of the outputs of the address spent since the holding stats were enabled;
+// the holding times are in seconds, AvgValueHoldingTime is weighted by the values of the outputs
+type AddressHolding struct {
+	SpentOutputs        uint64 `json:"spentOutputs"`
+	SpentValue          string `json:"spentValue"`
+	CoinDaysDestroyed   string `json:"coinDaysDestroyed"`
+	AvgHoldingTime      int64  `json:"avgHoldingTime"`
+	AvgValueHoldingTime int64  `json:"avgValueHoldingTime"`
+}
+
+// Withdrawal is the withdrawal from the beacon chain credited to the address, an entry of the address history of type withdrawal
+type Withdrawal struct {
+	Type           string `json:"type"`
+	Index          uint64 `json:"index"`
+	ValidatorIndex uint64 `json:"validatorIndex"`
+	Value          string `json:"value"`
+	Blockhash      string `json:"blockhash,omitempty"`
+	Blockheight    int    `json:"blockheight"`
+	Confirmations  uint32 `json:"confirmations"`
+	Blocktime      int64  `json:"blocktime"`
+}
+
+// AddressGroup is the merged history and the summed balances of a group of addresses,
+// a transaction touching several addresses of the group is listed once and the transfers
+// between the addresses of the group are not counted in TotalReceived and TotalSent
+type AddressGroup struct {
+	Paging
+	Addresses               []string `json:"addresses"`
 	Balance                 string   `json:"balance"`
 	TotalReceived           string   `json:"totalReceived"`
 	TotalSent               string   `json:"totalSent"`
@@ -101,39 +249,583 @@ type Address struct {
 	Txids                   []string `json:"transactions,omitempty"`
 }
 
+// WalletAccountAddress is a used address of a descriptor of the wallet account, Index is its derivation index
+type WalletAccountAddress struct {
+	Address string `json:"address"`
+	Index   uint32 `json:"index"`
+	Balance string `json:"balance"`
+	Txs     uint32 `json:"txs"`
+}
+
+// WalletAccountDescriptor is the part of the wallet account given by one output descriptor, NextIndex is the derivation index
+// following the highest used index; the descriptor is not returned, it would disclose all addresses of the wallet
+type WalletAccountDescriptor struct {
+	Balance       string                 `json:"balance"`
+	TotalReceived string                 `json:"totalReceived"`
+	TotalSent     string                 `json:"totalSent"`
+	UsedAddresses int                    `json:"usedAddresses"`
+	NextIndex     uint32                 `json:"nextIndex"`
+	Addresses     []WalletAccountAddress `json:"addresses,omitempty"`
+}
+
+// WalletAccount is the merged view of the addresses of all descriptors of a wallet account with the breakdown by descriptor
+type WalletAccount struct {
+	Paging
+	Name                    string                    `json:"name"`
+	Balance                 string                    `json:"balance"`
+	TotalReceived           string                    `json:"totalReceived"`
+	TotalSent               string                    `json:"totalSent"`
+	UnconfirmedBalance      string                    `json:"unconfirmedBalance"`
+	UnconfirmedTxApperances int                       `json:"unconfirmedTxApperances"`
+	TxApperances            int                       `json:"txApperances"`
+	Descriptors             []WalletAccountDescriptor `json:"descriptors"`
+	Transactions            []*Tx                     `json:"txs,omitempty"`
+	Txids                   []string                  `json:"transactions,omitempty"`
+}
+
+// WalletAccountUtxo is an unspent output of the wallet account, Descriptor is the index of the descriptor of the account
+// and Index the derivation index of the address
+type WalletAccountUtxo struct {
+	Utxo
+	Address    string `json:"address"`
+	Descriptor int    `json:"descriptor"`
+	Index      uint32 `json:"index"`
+}
+
+// AddressHistoryHeader is the part of the streamed address history preceding the transactions
+type AddressHistoryHeader struct {
+	AddrStr                 string `json:"addrStr"`
+	IsContract              bool   `json:"isContract,omitempty"`
+	Balance                 string `json:"balance"`
+	TotalReceived           string `json:"totalReceived"`
+	TotalSent               string `json:"totalSent"`
+	UnconfirmedBalance      string `json:"unconfirmedBalance"`
+	UnconfirmedTxApperances int    `json:"unconfirmedTxApperances"`
+	TxApperances            int    `json:"txApperances"`
+}
+
+// AddressFilterDirection selects the transactions in the address history by the direction of the transfer
+type AddressFilterDirection int
+
+const (
+	// AddressFilterDirectionAll does not filter the transactions
+	AddressFilterDirectionAll AddressFilterDirection = iota
+	// AddressFilterDirectionReceived selects the transactions in which the address is not on the input side
+	AddressFilterDirectionReceived
+	// AddressFilterDirectionSent selects the transactions in which the address is on the input side
+	AddressFilterDirectionSent
+)
+
+// AddressFilter restricts the transactions returned in the address history
+// MinValue and MaxValue limit the net amount transferred to or from the address in the transaction,
+// they are decimal amounts in the units of the coin, empty string means no limit
+type AddressFilter struct {
+	Direction   AddressFilterDirection
+	MinValue    string
+	MaxValue    string
+	ExcludeDust bool
+}
+
 type Blocks struct {
 	Paging
 	Blocks []db.BlockInfo `json:"blocks"`
 }
 
+const (
+	// RewardAnomalyOverpaid marks coinbase paying more than the expected subsidy and the collected fees
+	RewardAnomalyOverpaid = "overpaid"
+	// RewardAnomalyUnclaimed marks coinbase paying less than the expected subsidy and the collected fees
+	RewardAnomalyUnclaimed = "unclaimed"
+)
+
+// BlockReward compares the outputs of the coinbase transaction with the expected subsidy and the fees of the block
+type BlockReward struct {
+	Subsidy  string `json:"subsidy"`
+	Fees     string `json:"fees,omitempty"`
+	Coinbase string `json:"coinbase,omitempty"`
+	Anomaly  string `json:"anomaly,omitempty"`
+}
+
 type Block struct {
 	Paging
 	bchain.BlockInfo
-	TxCount      int   `json:"TxCount"`
-	Transactions []*Tx `json:"txs,omitempty"`
+	TxCount      int          `json:"TxCount"`
+	ArchiveCID   string       `json:"archiveCid,omitempty"`
+	Reward       *BlockReward `json:"reward,omitempty"`
+	Transactions []*Tx        `json:"txs,omitempty"`
+	// Extra are the chain specific fields of the block stored in the index
+	Extra bchain.BlockExtra `json:"extra,omitempty"`
+}
+
+// BlockAddresses are the addresses touched by the transactions of the block, Hash allows the client to detect a reorg
+type BlockAddresses struct {
+	Height    uint32   `json:"height"`
+	Hash      string   `json:"hash"`
+	Addresses []string `json:"addresses"`
+}
+
+// EmissionEra is a range of blocks with the same subsidy, Supply is the total emission at the end of the era
+type EmissionEra struct {
+	FromHeight uint32 `json:"fromHeight"`
+	ToHeight   uint32 `json:"toHeight"`
+	Subsidy    string `json:"subsidy"`
+	Supply     string `json:"supply"`
+}
+
+// EmissionSchedule is the emission schedule of the coin and the state of the emission at the best block
+type EmissionSchedule struct {
+	BestHeight     uint32        `json:"bestHeight"`
+	CurrentSubsidy string        `json:"currentSubsidy"`
+	NextHalving    uint32        `json:"nextHalving,omitempty"`
+	Supply         string        `json:"supply"`
+	MaxSupply      string        `json:"maxSupply"`
+	Eras           []EmissionEra `json:"eras"`
+}
+
+// CoinSupply compares the supply expected by the emission schedule with the supply computed from the indexed blocks
+// in the range FromHeight-Height, the range starts at the first block, the supply change of which is indexed
+// Created are the outputs minus the inputs of the indexed transactions, Indexed is Created minus Burned,
+// Difference is Created minus Expected and Divergent is set if the difference is not zero
+type CoinSupply struct {
+	FromHeight uint32 `json:"fromHeight"`
+	Height     uint32 `json:"height"`
+	Expected   string `json:"expected"`
+	Created    string `json:"created"`
+	Burned     string `json:"burned"`
+	Indexed    string `json:"indexed"`
+	Difference string `json:"difference"`
+	Divergent  bool   `json:"divergent"`
+}
+
+// BurnStats is the number and the value of the burned outputs paying to Address, Address is empty for the provably unspendable outputs
+type BurnStats struct {
+	Address string `json:"address,omitempty"`
+	Outputs uint64 `json:"outputs"`
+	Burned  string `json:"burned"`
+}
+
+// Burns is the cumulative burned supply of the indexed blocks up to Height, the sum of Unspendable and Addresses
+type Burns struct {
+	Height      uint32      `json:"height"`
+	Outputs     uint64      `json:"outputs"`
+	Burned      string      `json:"burned"`
+	Unspendable BurnStats   `json:"unspendable"`
+	Addresses   []BurnStats `json:"addresses"`
 }
 
 type BlockbookInfo struct {
-	Coin              string                       `json:"coin"`
-	Host              string                       `json:"host"`
-	Version           string                       `json:"version"`
-	GitCommit         string                       `json:"gitcommit"`
-	BuildTime         string                       `json:"buildtime"`
-	SyncMode          bool                         `json:"syncMode"`
-	InitialSync       bool                         `json:"initialsync"`
-	InSync            bool                         `json:"inSync"`
-	BestHeight        uint32                       `json:"bestHeight"`
-	LastBlockTime     time.Time                    `json:"lastBlockTime"`
-	InSyncMempool     bool                         `json:"inSyncMempool"`
-	LastMempoolTime   time.Time                    `json:"lastMempoolTime"`
-	MempoolSize       int                          `json:"mempoolSize"`
-	DbSize            int64                        `json:"dbSize"`
-	DbSizeFromColumns int64                        `json:"dbSizeFromColumns,omitempty"`
-	DbColumns         []common.InternalStateColumn `json:"dbColumns,omitempty"`
-	About             string                       `json:"about"`
+	Coin                 string                       `json:"coin"`
+	Host                 string                       `json:"host"`
+	Version              string                       `json:"version"`
+	GitCommit            string                       `json:"gitcommit"`
+	BuildTime            string                       `json:"buildtime"`
+	SyncMode             bool                         `json:"syncMode"`
+	InitialSync          bool                         `json:"initialsync"`
+	InSync               bool                         `json:"inSync"`
+	SyncPhase            common.SyncPhase             `json:"syncPhase"`
+	SyncPhaseSince       time.Time                    `json:"syncPhaseSince"`
+	InterruptedSyncPhase common.SyncPhase             `json:"interruptedSyncPhase,omitempty"`
+	VerifiedHeight       uint32                       `json:"verifiedHeight"`
+	VerifiedHash         string                       `json:"verifiedHash"`
+	BestHeight           uint32                       `json:"bestHeight"`
+	LastBlockTime        time.Time                    `json:"lastBlockTime"`
+	InSyncMempool        bool                         `json:"inSyncMempool"`
+	LastMempoolTime      time.Time                    `json:"lastMempoolTime"`
+	MempoolSize          int                          `json:"mempoolSize"`
+	DbSize               int64                        `json:"dbSize"`
+	DbSizeFromColumns    int64                        `json:"dbSizeFromColumns,omitempty"`
+	DbColumns            []common.InternalStateColumn `json:"dbColumns,omitempty"`
+	PendingCompactions   int                          `json:"pendingCompactions,omitempty"`
+	LastCompaction       *time.Time                   `json:"lastCompaction,omitempty"`
+	Decimals             int                          `json:"decimals"`
+	About                string                       `json:"about"`
 }
 
 type SystemInfo struct {
 	Blockbook *BlockbookInfo    `json:"blockbook"`
 	Backend   *bchain.ChainInfo `json:"backend"`
 }
+
+type FeeHistoryBlocks struct {
+	From         uint32    `json:"from"`
+	To           uint32    `json:"to"`
+	Time         int64     `json:"time"`
+	Txs          uint32    `json:"txs"`
+	TotalFees    string    `json:"totalFees"`
+	FeeRates     []float64 `json:"feeRates,omitempty"`
+	TotalFeesSat big.Int   `json:"-"`
+}
+
+type FeeHistoryEstimate struct {
+	Blocks uint32 `json:"blocks"`
+	Fee    string `json:"feePerKB"`
+}
+
+type FeeHistoryMempool struct {
+	Time      int64                `json:"time"`
+	Txs       uint32               `json:"txs"`
+	Estimates []FeeHistoryEstimate `json:"estimates,omitempty"`
+}
+
+type FeeHistory struct {
+	From        uint32              `json:"from"`
+	To          uint32              `json:"to"`
+	Resolution  int                 `json:"resolution"`
+	Percentiles []int               `json:"feeRatePercentiles"`
+	Blocks      []FeeHistoryBlocks  `json:"blocks"`
+	Mempool     []FeeHistoryMempool `json:"mempool"`
+}
+
+type PaymentRequest struct {
+	Valid        bool     `json:"valid"`
+	Address      string   `json:"address,omitempty"`
+	Amount       string   `json:"amount,omitempty"`
+	Label        string   `json:"label,omitempty"`
+	Message      string   `json:"message,omitempty"`
+	PaymentURL   string   `json:"paymentUrl,omitempty"`
+	Expires      int64    `json:"expires,omitempty"`
+	Expired      bool     `json:"expired"`
+	TxApperances int      `json:"txApperances"`
+	Balance      string   `json:"balance,omitempty"`
+	Errors       []string `json:"errors,omitempty"`
+	AmountSat    big.Int  `json:"-"`
+}
+
+type ReadSnapshot struct {
+	ID         string    `json:"id"`
+	Expires    time.Time `json:"expires"`
+	BestHeight uint32    `json:"bestHeight"`
+	BestHash   string    `json:"bestHash"`
+}
+
+type ScriptTemplateOutput struct {
+	Txid   string `json:"txid"`
+	Vout   uint32 `json:"vout"`
+	Height uint32 `json:"height"`
+}
+
+type ScriptTemplateOutputs struct {
+	Skeleton  string                 `json:"skeleton"`
+	From      uint32                 `json:"from"`
+	To        uint32                 `json:"to"`
+	Outputs   []ScriptTemplateOutput `json:"outputs"`
+	Truncated bool                   `json:"truncated,omitempty"`
+}
+
+type Nonce struct {
+	Address        string `json:"address"`
+	ConfirmedNonce uint64 `json:"confirmedNonce"`
+	NextNonce      uint64 `json:"nextNonce"`
+	PendingTxs     int    `json:"pendingTxs"`
+}
+
+type AddressActivity struct {
+	Txid   string `json:"txid"`
+	Height uint32 `json:"height"`
+	Time   int64  `json:"time"`
+}
+
+type Counterparty struct {
+	Addresses []string `json:"addresses"`
+	Txs       int      `json:"txs"`
+	Value     string   `json:"value"`
+}
+
+// AddressPrivacy are the statistics of the participation of the address in the coinjoin transactions, MixedOutputs are
+// the equal outputs of coinjoins received by the address and MixedValue their sum
+type AddressPrivacy struct {
+	CoinjoinTxs  int    `json:"coinjoinTxs"`
+	MixedOutputs int    `json:"mixedOutputs"`
+	MixedValue   string `json:"mixedValue"`
+}
+
+type AddressSummary struct {
+	Address        string           `json:"address"`
+	Balance        string           `json:"balance"`
+	TotalReceived  string           `json:"totalReceived"`
+	TotalSent      string           `json:"totalSent"`
+	Txs            int              `json:"txs"`
+	AverageTxValue string           `json:"averageTxValue"`
+	FirstActivity  *AddressActivity `json:"firstActivity"`
+	LastActivity   *AddressActivity `json:"lastActivity"`
+	Counterparties []Counterparty   `json:"counterparties"`
+	// EstimatedCounterparties is the estimated number of the distinct counterparties of the address in the blocks connected
+	// since the sketches of the counterparties are kept by the index, it is not limited by the scanned transactions
+	EstimatedCounterparties uint64          `json:"estimatedCounterparties,omitempty"`
+	ScannedTxs              int             `json:"scannedTxs"`
+	Privacy                 *AddressPrivacy `json:"privacy,omitempty"`
+	Truncated               bool            `json:"truncated,omitempty"`
+}
+
+const (
+	// SearchTypeBlock is the type of search result matching a block height or a block hash
+	SearchTypeBlock = "block"
+	// SearchTypeTx is the type of search result matching a txid
+	SearchTypeTx = "tx"
+	// SearchTypeAddress is the type of search result matching an address
+	SearchTypeAddress = "address"
+)
+
+type SearchResult struct {
+	Query   string `json:"query"`
+	Type    string `json:"type"`
+	Height  uint32 `json:"height,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Txid    string `json:"txid,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+const (
+	// TestTxInputUnspent is the status of the input spending an unspent output in the index
+	TestTxInputUnspent = "unspent"
+	// TestTxInputSpent is the status of the input spending an output already spent in the index
+	TestTxInputSpent = "spent"
+	// TestTxInputMempool is the status of the input spending an output of a mempool transaction
+	TestTxInputMempool = "mempool"
+	// TestTxInputSpentInMempool is the status of the input spending an output already spent by another mempool transaction
+	TestTxInputSpentInMempool = "spentInMempool"
+	// TestTxInputUnknown is the status of the input spending an output which is neither in the index nor in the mempool
+	TestTxInputUnknown = "unknown"
+)
+
+// TestTxInput is the input of the tested transaction with the state of the spent output according to the index
+type TestTxInput struct {
+	N         int      `json:"n"`
+	Txid      string   `json:"txid"`
+	Vout      uint32   `json:"vout"`
+	Status    string   `json:"status"`
+	Addresses []string `json:"addresses,omitempty"`
+	Value     string   `json:"value,omitempty"`
+}
+
+// TestTxResult is the result of the decode of the raw transaction and of the test of its acceptance by the backend
+type TestTxResult struct {
+	Txid string `json:"txid"`
+	// Tested is false if the backend does not support the test of the mempool acceptance
+	Tested       bool          `json:"tested"`
+	Allowed      bool          `json:"allowed"`
+	RejectReason string        `json:"rejectReason,omitempty"`
+	Vin          []TestTxInput `json:"vin,omitempty"`
+}
+
+// SimulatedUtxo is the output consumed by the simulated transaction, Mempool is true for the outputs of the mempool transactions
+type SimulatedUtxo struct {
+	Txid    string `json:"txid"`
+	Vout    uint32 `json:"vout"`
+	Value   string `json:"value"`
+	Mempool bool   `json:"mempool,omitempty"`
+}
+
+// SimulatedAddress is the effect of the simulated transaction on the balance of an address,
+// Balance is the confirmed balance plus the unconfirmed outputs of the address consumed by the transaction
+type SimulatedAddress struct {
+	Address       string          `json:"address"`
+	Balance       string          `json:"balance"`
+	BalanceChange string          `json:"balanceChange"`
+	NewBalance    string          `json:"newBalance"`
+	ConsumedUtxos []SimulatedUtxo `json:"consumedUtxos,omitempty"`
+}
+
+// SimulatedTx is the effect of the decoded transaction on the indexed addresses, SpentInputs, UnknownInputs and DuplicateInputs
+// are the indexes of the inputs spending outputs already spent in the index or in the mempool, unknown outputs or the outputs
+// spent by an earlier input of the transaction, ValueIn and Fees are returned only if there are no such inputs
+type SimulatedTx struct {
+	Txid            string             `json:"txid"`
+	ValueIn         string             `json:"valueIn,omitempty"`
+	ValueOut        string             `json:"valueOut"`
+	Fees            string             `json:"fees,omitempty"`
+	Addresses       []SimulatedAddress `json:"addresses"`
+	SpentInputs     []int              `json:"spentInputs,omitempty"`
+	UnknownInputs   []int              `json:"unknownInputs,omitempty"`
+	DuplicateInputs []int              `json:"duplicateInputs,omitempty"`
+}
+
+// NameOp is an operation setting the value and the owner of a name
+type NameOp struct {
+	Txid   string `json:"txid"`
+	Vout   uint32 `json:"vout"`
+	Height uint32 `json:"height"`
+	Op     string `json:"op"`
+	Value  string `json:"value"`
+	Owner  string `json:"owner,omitempty"`
+}
+
+// Name is the current value and owner of a name given by its last operation and the history of its operations,
+// the expired name has no value and owner, ExpiresAt is the height at which the name expires without a further update
+type Name struct {
+	Name      string   `json:"name"`
+	Value     string   `json:"value"`
+	Owner     string   `json:"owner,omitempty"`
+	Height    uint32   `json:"height"`
+	Txid      string   `json:"txid"`
+	ExpiresAt uint32   `json:"expiresAt,omitempty"`
+	Expired   bool     `json:"expired,omitempty"`
+	History   []NameOp `json:"history"`
+}
+
+// PaymentIDTx is a transaction with the outputs carrying the payment id
+type PaymentIDTx struct {
+	Txid   string   `json:"txid"`
+	Height uint32   `json:"height"`
+	Vouts  []uint32 `json:"vouts"`
+}
+
+// PaymentIDTxs are the transactions with the payment id, PaymentID is hex encoded,
+// NextCursor is the cursor of the next page, empty if there are no more transactions
+type PaymentIDTxs struct {
+	PaymentID  string        `json:"paymentId"`
+	Txs        []PaymentIDTx `json:"txs"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// Inscription is an ordinals inscription and its current location, the sat given by the offset in the output txid:vout,
+// vout 4294967295 means that the sat was spent as the fee of the transaction txid
+type Inscription struct {
+	ID            string `json:"id"`
+	Height        uint32 `json:"height"`
+	ContentType   string `json:"contentType,omitempty"`
+	ContentLength uint32 `json:"contentLength"`
+	Txid          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Offset        uint64 `json:"offset"`
+	Address       string `json:"address,omitempty"`
+}
+
+// AddressInscriptions are the inscriptions held by the unspent outputs of an address
+type AddressInscriptions struct {
+	Address      string        `json:"address"`
+	Inscriptions []Inscription `json:"inscriptions"`
+}
+
+// FlowHop is a transfer from an address to another address in a transaction
+type FlowHop struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Txid   string `json:"txid"`
+	Height uint32 `json:"height"`
+	Value  string `json:"value"`
+}
+
+// Flows are the paths of transfers from one address to another address found in the indexed transactions
+type Flows struct {
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	MaxHops   int         `json:"maxHops"`
+	Paths     [][]FlowHop `json:"paths"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// TxProofBundle contains the data needed by an SPV client to verify the inclusion of a confirmed transaction in a block in one response
+// Merkle are the hashes of the merkle branch from the leaf level up, in the same byte order as txids, Pos is the index of the tx in the block
+// Header is the serialized block header, it is omitted if the header of the coin cannot be reconstructed from the block info of the backend
+type TxProofBundle struct {
+	Txid          string   `json:"txid"`
+	Hex           string   `json:"hex"`
+	BlockHash     string   `json:"blockHash"`
+	BlockHeight   uint32   `json:"blockHeight"`
+	Confirmations uint32   `json:"confirmations"`
+	Header        string   `json:"header,omitempty"`
+	MerkleRoot    string   `json:"merkleRoot"`
+	Pos           int      `json:"pos"`
+	Merkle        []string `json:"merkle"`
+}
+
+// AmountAnomaly is a guard of the amount math triggered for Address during the sync between the blocks FirstHeight and LastHeight,
+// Kind is negative-balance, negative-sent, truncated-balance or truncated-value and Value is the value of the last trigger
+type AmountAnomaly struct {
+	Address     string `json:"address"`
+	Kind        string `json:"kind"`
+	Count       uint32 `json:"count"`
+	FirstHeight uint32 `json:"firstHeight"`
+	LastHeight  uint32 `json:"lastHeight"`
+	Value       string `json:"value"`
+}
+
+// BalanceRecompute is the balance of Address recomputed from its indexed transactions, the Old fields are the balance stored before,
+// Unresolved is set if the recomputed balance is not valid and the stored balance was kept
+type BalanceRecompute struct {
+	Address    string `json:"address"`
+	OldTxs     uint32 `json:"oldTxs"`
+	OldBalance string `json:"oldBalance,omitempty"`
+	OldSent    string `json:"oldSent,omitempty"`
+	Txs        uint32 `json:"txs"`
+	Balance    string `json:"balance"`
+	Sent       string `json:"sent"`
+	Changed    bool   `json:"changed"`
+	Unresolved bool   `json:"unresolved,omitempty"`
+}
+
+// BlockStats are the statistics of the block named the same as in getblockstats of bitcoind, TotalWeight is omitted if the weight
+// of the block is not known, SigOps is the number of the legacy signature operations of the block, the fee rates are in satoshi per
+// virtual byte and the percentiles (10, 25, 50, 75, 90) are of the fee rates of the transactions, not weighted by their size
+type BlockStats struct {
+	Height             uint32    `json:"height"`
+	Hash               string    `json:"blockhash"`
+	Time               int64     `json:"time"`
+	Txs                uint32    `json:"txs"`
+	TotalSize          uint32    `json:"total_size"`
+	TotalWeight        uint32    `json:"total_weight,omitempty"`
+	SigOps             uint32    `json:"sigops,omitempty"`
+	Subsidy            string    `json:"subsidy,omitempty"`
+	TotalFee           string    `json:"totalfee,omitempty"`
+	AvgFee             string    `json:"avgfee,omitempty"`
+	FeeRatePercentiles []float64 `json:"feerate_percentiles,omitempty"`
+}
+
+// BlockStatsTotal are the statistics of the blocks of the range aggregated, TotalWeight and SigOps are the sums over
+// the WeightBlocks blocks with known weight, the fee rate percentiles are the averages of the percentiles of the blocks
+// weighted by the number of their transactions
+type BlockStatsTotal struct {
+	Blocks             int       `json:"blocks"`
+	Txs                uint64    `json:"txs"`
+	TotalSize          uint64    `json:"total_size"`
+	WeightBlocks       int       `json:"weight_blocks"`
+	TotalWeight        uint64    `json:"total_weight"`
+	SigOps             uint64    `json:"sigops"`
+	TotalFee           string    `json:"totalfee"`
+	AvgFee             string    `json:"avgfee,omitempty"`
+	FeeRatePercentiles []float64 `json:"feerate_percentiles,omitempty"`
+}
+
+// ReceivedReport is the total value of the outputs to a set of addresses in the blocks FromHeight-ToHeight,
+// FromTime and ToTime are the limits of the block time given in the request
+type ReceivedReport struct {
+	FromHeight uint32                  `json:"fromHeight"`
+	ToHeight   uint32                  `json:"toHeight"`
+	FromTime   int64                   `json:"fromTime,omitempty"`
+	ToTime     int64                   `json:"toTime,omitempty"`
+	Received   string                  `json:"received"`
+	Outputs    int                     `json:"outputs"`
+	Addresses  []ReceivedReportAddress `json:"addresses"`
+}
+
+// ReceivedReportAddress is the value of the outputs to one address of the report
+type ReceivedReportAddress struct {
+	Address  string `json:"address"`
+	Received string `json:"received"`
+	Outputs  int    `json:"outputs"`
+}
+
+// LargestTxs are the transactions with the highest total value of the outputs in the last Window blocks, from the largest
+type LargestTxs struct {
+	Window uint32      `json:"window"`
+	Txs    []LargestTx `json:"txs"`
+}
+
+// LargestTx is the transaction of LargestTxs
+type LargestTx struct {
+	Txid          string `json:"txid"`
+	Value         string `json:"value"`
+	Blockheight   int    `json:"blockheight"`
+	Confirmations uint32 `json:"confirmations"`
+	Blocktime     int64  `json:"blocktime"`
+}
+
+// BlockStatsRange are the statistics of the indexed blocks in the range From-To
+type BlockStatsRange struct {
+	From        uint32          `json:"from"`
+	To          uint32          `json:"to"`
+	Percentiles []int           `json:"feeRatePercentiles"`
+	Blocks      []BlockStats    `json:"blocks"`
+	Total       BlockStatsTotal `json:"total"`
+}
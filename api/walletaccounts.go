@@ -0,0 +1,211 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// MaxWalletAccountAddresses is the maximum number of the addresses derived from one descriptor of a wallet account
+const MaxWalletAccountAddresses = 10000
+
+// walletAccountAddress is a used address of a descriptor of the wallet account, ba is nil if the address is only in mempool
+type walletAccountAddress struct {
+	addrDesc bchain.AddressDescriptor
+	index    uint32
+	ba       *db.AddrBalance
+}
+
+// discoverDescriptorAddresses returns the used addresses of the descriptor and the index following the highest used index,
+// the addresses of a ranged descriptor are derived until gap consecutive addresses are not used
+func (w *Worker) discoverDescriptorAddresses(descriptor string, gap uint32) ([]walletAccountAddress, uint32, error) {
+	// the descriptor without the wildcard returns one address regardless of the range
+	batch := gap
+	if batch < 2 {
+		batch = 2
+	}
+	var used []walletAccountAddress
+	next := uint32(0)
+	for from := uint32(0); from < next+gap; from += batch {
+		if from >= MaxWalletAccountAddresses {
+			return nil, 0, NewApiError(fmt.Sprintf("Descriptor %v has more than %d used addresses", descriptor, MaxWalletAccountAddresses), true)
+		}
+		addrDescs, err := w.chainParser.DeriveAddrDescs(descriptor, from, from+batch)
+		if err != nil {
+			return nil, 0, errors.Annotatef(err, "DeriveAddrDescs %v", descriptor)
+		}
+		for i, addrDesc := range addrDescs {
+			ba, err := w.db.GetAddrDescBalance(addrDesc)
+			if err != nil {
+				return nil, 0, errors.Annotatef(err, "GetAddrDescBalance %v", addrDesc)
+			}
+			if ba == nil {
+				txm, err := w.getAddressTxids(addrDesc, true)
+				if err != nil {
+					return nil, 0, errors.Annotatef(err, "getAddressTxids %v true", addrDesc)
+				}
+				if len(txm) == 0 {
+					continue
+				}
+			} else if w.isLargeAddress(ba) {
+				return nil, 0, w.largeAddressError(w.addressString(addrDesc))
+			}
+			index := from + uint32(i)
+			used = append(used, walletAccountAddress{addrDesc: addrDesc, index: index, ba: ba})
+			next = index + 1
+		}
+		if len(addrDescs) < int(batch) {
+			break
+		}
+	}
+	return used, next, nil
+}
+
+// addressString returns the address of the address descriptor in the format of the parser or the descriptor in hex
+func (w *Worker) addressString(addrDesc bchain.AddressDescriptor) string {
+	a, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil {
+		glog.V(2).Infof("GetAddressesFromAddrDesc error %v, %v", err, addrDesc)
+	}
+	if len(a) == 1 {
+		return a[0]
+	}
+	return addrDesc.String()
+}
+
+// getWalletAccount returns the registered wallet account and the used addresses of each of its descriptors,
+// the account is returned only with its token
+func (w *Worker) getWalletAccount(name, token string) (*db.WalletAccount, [][]walletAccountAddress, []uint32, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, nil, nil, NewApiError("Wallet accounts are available only for UTXO chains", true)
+	}
+	a, err := w.db.GetWalletAccount(name)
+	if err != nil {
+		return nil, nil, nil, errors.Annotatef(err, "GetWalletAccount %v", name)
+	}
+	// the unknown account and the invalid token are not distinguished, the names of the accounts are not disclosed
+	if a == nil || !db.ValidWalletAccountToken(a, token) {
+		return nil, nil, nil, NewApiError(fmt.Sprintf("Wallet account %v not found or the token is invalid", name), true)
+	}
+	used := make([][]walletAccountAddress, len(a.Descriptors))
+	next := make([]uint32, len(a.Descriptors))
+	for i, desc := range a.Descriptors {
+		if used[i], next[i], err = w.discoverDescriptorAddresses(desc, a.Gap); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return a, used, next, nil
+}
+
+// GetWalletAccount returns the balances and the merged history of the used addresses of all descriptors of the wallet account
+// together with the breakdown by descriptor; an address derived by several descriptors is counted in each of them,
+// but only once in the account, the totals of the account do not count the value moved between its addresses;
+// the descriptors themselves are not returned, the breakdown is in the order of the registered descriptors
+func (w *Worker) GetWalletAccount(name, token string, page int, txsOnPage int, onlyTxids bool) (*WalletAccount, error) {
+	start := time.Now()
+	page--
+	if page < 0 {
+		page = 0
+	}
+	a, used, next, err := w.getWalletAccount(name, token)
+	if err != nil {
+		return nil, err
+	}
+	r := &WalletAccount{
+		Name:        a.Name,
+		Descriptors: make([]WalletAccountDescriptor, len(a.Descriptors)),
+	}
+	var addrDescs []bchain.AddressDescriptor
+	seen := make(map[string]struct{})
+	var balanceSat, receivedSat, sentSat big.Int
+	for i := range a.Descriptors {
+		var dBalanceSat, dReceivedSat, dSentSat big.Int
+		ad := &r.Descriptors[i]
+		ad.UsedAddresses = len(used[i])
+		ad.NextIndex = next[i]
+		ad.Addresses = make([]WalletAccountAddress, len(used[i]))
+		for j := range used[i] {
+			u := &used[i][j]
+			aa := &ad.Addresses[j]
+			aa.Address = w.addressString(u.addrDesc)
+			aa.Index = u.index
+			if u.ba != nil {
+				aa.Balance = w.formatAmount(&u.ba.BalanceSat)
+				aa.Txs = u.ba.Txs
+				dBalanceSat.Add(&dBalanceSat, &u.ba.BalanceSat)
+				dReceivedSat.Add(&dReceivedSat, u.ba.ReceivedSat())
+				dSentSat.Add(&dSentSat, &u.ba.SentSat)
+			} else {
+				aa.Balance = "0"
+			}
+			if _, found := seen[string(u.addrDesc)]; found {
+				continue
+			}
+			seen[string(u.addrDesc)] = struct{}{}
+			addrDescs = append(addrDescs, u.addrDesc)
+			if u.ba != nil {
+				balanceSat.Add(&balanceSat, &u.ba.BalanceSat)
+				receivedSat.Add(&receivedSat, u.ba.ReceivedSat())
+				sentSat.Add(&sentSat, &u.ba.SentSat)
+			}
+		}
+		ad.Balance = w.formatAmount(&dBalanceSat)
+		ad.TotalReceived = w.formatAmount(&dReceivedSat)
+		ad.TotalSent = w.formatAmount(&dSentSat)
+	}
+	h, err := w.getAddressGroupHistory(addrDescs, page, txsOnPage, onlyTxids)
+	if err != nil {
+		return nil, err
+	}
+	receivedSat.Sub(&receivedSat, &h.internalSat)
+	sentSat.Sub(&sentSat, &h.internalSat)
+	r.Paging = h.paging
+	r.Balance = w.formatAmount(&balanceSat)
+	r.TotalReceived = w.formatAmount(&receivedSat)
+	r.TotalSent = w.formatAmount(&sentSat)
+	r.TxApperances = h.txApperances
+	r.UnconfirmedBalance = w.formatAmount(&h.unconfirmedBalanceSat)
+	r.UnconfirmedTxApperances = h.unconfirmedTxApperances
+	r.Transactions = h.txs
+	r.Txids = h.txids
+	glog.Info("GetWalletAccount ", name, ", ", len(addrDescs), " addresses finished in ", time.Since(start))
+	return r, nil
+}
+
+// GetWalletAccountUtxo returns the confirmed unspent outputs of all descriptors of the wallet account, the oldest first
+func (w *Worker) GetWalletAccountUtxo(name, token string) ([]WalletAccountUtxo, error) {
+	_, used, _, err := w.getWalletAccount(name, token)
+	if err != nil {
+		return nil, err
+	}
+	bestheight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	r := make([]WalletAccountUtxo, 0)
+	seen := make(map[string]struct{})
+	for i := range used {
+		for _, u := range used[i] {
+			if _, found := seen[string(u.addrDesc)]; found || u.ba == nil {
+				continue
+			}
+			seen[string(u.addrDesc)] = struct{}{}
+			utxos, err := w.getAddrDescUtxo(u.addrDesc, bestheight, nil, false)
+			if err != nil {
+				return nil, errors.Annotatef(err, "getAddrDescUtxo %v", u.addrDesc)
+			}
+			address := w.addressString(u.addrDesc)
+			for _, utxo := range utxos {
+				r = append(r, WalletAccountUtxo{Utxo: utxo, Address: address, Descriptor: i, Index: u.index})
+			}
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Height < r[j].Height })
+	return r, nil
+}
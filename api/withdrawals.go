@@ -0,0 +1,161 @@
+package api
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"math/big"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// historyTypeWithdrawal is the type of the entries of the address history, which are the withdrawals from the beacon chain
+const historyTypeWithdrawal = "withdrawal"
+
+// addressWithdrawals are the blocks with the withdrawals to the address, the newest first, and the number and the sum of the withdrawals
+type addressWithdrawals struct {
+	blocks []db.WithdrawalsBlock
+	count  int
+	total  big.Int
+}
+
+// getAddressWithdrawals returns the summary of the withdrawals from the beacon chain to the address or nil if there are none,
+// the withdrawals are indexed only for account based chains; the withdrawals of a large address are refused
+// as its history, the address with more withdrawals than the limit of the transactions is large too
+func (w *Worker) getAddressWithdrawals(address string, addrDesc bchain.AddressDescriptor, ba *db.AddrBalance) (*addressWithdrawals, error) {
+	if w.chainParser.IsUTXOChain() {
+		return nil, nil
+	}
+	if w.isLargeAddress(ba) {
+		return nil, w.largeAddressError(address)
+	}
+	blocks, total, err := w.db.GetAddrDescWithdrawalsSummary(addrDesc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAddrDescWithdrawalsSummary %v", address)
+	}
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	r := &addressWithdrawals{blocks: blocks, total: total}
+	for i := range blocks {
+		r.count += blocks[i].Count
+	}
+	if w.largeAddressTxs > 0 && r.count > int(w.largeAddressTxs) {
+		return nil, w.largeAddressError(address)
+	}
+	return r, nil
+}
+
+// getAddressTxidHeights returns the unique txids of the confirmed transactions of the address and their heights,
+// the newest first in the same order as UniqueTxidsInReverse
+func (w *Worker) getAddressTxidHeights(addrDesc bchain.AddressDescriptor) ([]string, []uint32, error) {
+	var txids []string
+	var heights []uint32
+	err := w.db.GetAddrDescHeightTransactionsReverse(addrDesc, 0, ^uint32(0), func(height uint32, ids []string) error {
+		for i := len(ids) - 1; i >= 0; i-- {
+			txids = append(txids, ids[i])
+			heights = append(heights, height)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return txids, heights, nil
+}
+
+// pageAddressHistory splits the page from-to of the address history to the transactions txFrom-txTo and the withdrawals wFrom-wTo;
+// in the history the transactions at txHeights and the withdrawals are merged newest first by the height and the index
+// of the withdrawal, the withdrawals of a block precede its transactions as they are processed after the transactions
+func pageAddressHistory(txHeights []uint32, wd *addressWithdrawals, from, to int) (txFrom, txTo, wFrom, wTo int) {
+	var blocks []db.WithdrawalsBlock
+	if wd != nil {
+		blocks = wd.blocks
+	}
+	var b, inBlock int
+	for i := 0; i < to; i++ {
+		if i == from {
+			txFrom, wFrom = txTo, wTo
+		}
+		if b < len(blocks) && (txTo == len(txHeights) || blocks[b].Height >= txHeights[txTo]) {
+			wTo++
+			if inBlock++; inBlock == blocks[b].Count {
+				b++
+				inBlock = 0
+			}
+		} else {
+			txTo++
+		}
+	}
+	if from >= to {
+		txFrom, wFrom = txTo, wTo
+	}
+	return txFrom, txTo, wFrom, wTo
+}
+
+// setAddressWithdrawals sets the number and the sum of the withdrawals to the address and loads the withdrawals wFrom-wTo
+// (in the order newest first) from the blocks containing them
+func (w *Worker) setAddressWithdrawals(r *Address, addrDesc bchain.AddressDescriptor, wd *addressWithdrawals, wFrom, wTo int, bestheight uint32) error {
+	if wd == nil {
+		return nil
+	}
+	r.WithdrawalApperances = wd.count
+	r.TotalWithdrawn = w.formatAmount(&wd.total)
+	if wFrom >= wTo {
+		return nil
+	}
+	// find the range of the heights of the page and the number of the withdrawals in the newer blocks of the range
+	var lower, higher uint32
+	var skip, n int
+	first := true
+	for i := range wd.blocks {
+		b := &wd.blocks[i]
+		if first && n+b.Count > wFrom {
+			higher = b.Height
+			skip = wFrom - n
+			first = false
+		}
+		n += b.Count
+		if n >= wTo {
+			lower = b.Height
+			break
+		}
+	}
+	ws, err := w.db.GetAddrDescWithdrawals(addrDesc, lower, higher)
+	if err != nil {
+		return errors.Annotatef(err, "GetAddrDescWithdrawals %v-%v", lower, higher)
+	}
+	// the withdrawals may be changed by a block connected after the summary was read
+	end := skip + wTo - wFrom
+	if end > len(ws) {
+		end = len(ws)
+	}
+	if skip > end {
+		skip = end
+	}
+	var bi *db.BlockInfo
+	for i := skip; i < end; i++ {
+		wdr := &ws[i]
+		if bi == nil || bi.Height != wdr.Height {
+			var err error
+			if bi, err = w.db.GetBlockInfo(wdr.Height); err != nil {
+				return errors.Annotatef(err, "GetBlockInfo %v", wdr.Height)
+			}
+			if bi == nil {
+				glog.Warning("DB inconsistency:  block height ", wdr.Height, ": not found in db")
+				continue
+			}
+		}
+		r.Withdrawals = append(r.Withdrawals, &Withdrawal{
+			Type:           historyTypeWithdrawal,
+			Index:          wdr.Index,
+			ValidatorIndex: wdr.ValidatorIndex,
+			Value:          w.formatAmount(&wdr.AmountSat),
+			Blockhash:      bi.Hash,
+			Blockheight:    int(wdr.Height),
+			Confirmations:  bestheight - wdr.Height + 1,
+			Blocktime:      bi.Time,
+		})
+	}
+	return nil
+}
@@ -5,9 +5,15 @@ import (
 	"blockbook/common"
 	"blockbook/db"
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -21,20 +27,42 @@ type Worker struct {
 	chain       bchain.BlockChain
 	chainParser bchain.BlockChainParser
 	is          *common.InternalState
+	summaries   *addressSummaryCache
+	// amounts is nil if the amounts are formatted in the default way by the parser
+	amounts *AmountFormatter
+	// largeAddressTxs is the number of transactions above which the address is large, 0 means no limit
+	largeAddressTxs uint32
+	erc20Fetches    *erc20FetchLimiter
 }
 
 // NewWorker creates new api worker
 func NewWorker(db *db.RocksDB, chain bchain.BlockChain, txCache *db.TxCache, is *common.InternalState) (*Worker, error) {
 	w := &Worker{
-		db:          db,
-		txCache:     txCache,
-		chain:       chain,
-		chainParser: chain.GetChainParser(),
-		is:          is,
+		db:           db,
+		txCache:      txCache,
+		chain:        chain,
+		chainParser:  chain.GetChainParser(),
+		is:           is,
+		summaries:    &addressSummaryCache{},
+		erc20Fetches: &erc20FetchLimiter{},
 	}
 	return w, nil
 }
 
+// WithAmountFormatter returns worker, which formats the amounts in its responses by the formatter
+func (w *Worker) WithAmountFormatter(f *AmountFormatter) *Worker {
+	c := *w
+	c.amounts = f
+	return &c
+}
+
+func (w *Worker) formatAmount(a *big.Int) string {
+	if w.amounts != nil {
+		return w.amounts.Format(a)
+	}
+	return w.chainParser.AmountToDecimalString(a)
+}
+
 func (w *Worker) getAddressesFromVout(vout *bchain.Vout) (bchain.AddressDescriptor, []string, bool, error) {
 	addrDesc, err := w.chainParser.GetAddrDescFromVout(vout)
 	if err != nil {
@@ -152,7 +180,7 @@ func (w *Worker) GetTransaction(txid string, spendingTxs bool) (*Tx, error) {
 				if len(tas.Outputs) > int(vin.Vout) {
 					output := &tas.Outputs[vin.Vout]
 					vin.ValueSat = output.ValueSat
-					vin.Value = w.chainParser.AmountToDecimalString(&vin.ValueSat)
+					vin.Value = w.formatAmount(&vin.ValueSat)
 					vin.AddrDesc = output.AddrDesc
 					vin.Addresses, vin.Searchable, err = output.Addresses(w.chainParser)
 					if err != nil {
@@ -160,7 +188,7 @@ func (w *Worker) GetTransaction(txid string, spendingTxs bool) (*Tx, error) {
 					}
 				}
 			}
-			vin.Value = w.chainParser.AmountToDecimalString(&vin.ValueSat)
+			vin.Value = w.formatAmount(&vin.ValueSat)
 			valInSat.Add(&valInSat, &vin.ValueSat)
 		}
 	}
@@ -170,13 +198,14 @@ func (w *Worker) GetTransaction(txid string, spendingTxs bool) (*Tx, error) {
 		vout := &vouts[i]
 		vout.N = i
 		vout.ValueSat = bchainVout.ValueSat
-		vout.Value = w.chainParser.AmountToDecimalString(&bchainVout.ValueSat)
+		vout.Value = w.formatAmount(&bchainVout.ValueSat)
 		valOutSat.Add(&valOutSat, &bchainVout.ValueSat)
 		vout.ScriptPubKey.Hex = bchainVout.ScriptPubKey.Hex
 		vout.ScriptPubKey.AddrDesc, vout.ScriptPubKey.Addresses, vout.ScriptPubKey.Searchable, err = w.getAddressesFromVout(bchainVout)
 		if err != nil {
 			glog.V(2).Infof("getAddressesFromVout error %v, %v, output %v", err, bchainTx.Txid, bchainVout.N)
 		}
+		w.setOutputMemo(vout, vout.ScriptPubKey.AddrDesc)
 		if ta != nil {
 			vout.Spent = ta.Outputs[i].Spent
 			if spendingTxs && vout.Spent {
@@ -199,26 +228,159 @@ func (w *Worker) GetTransaction(txid string, spendingTxs bool) (*Tx, error) {
 		Blockheight:   int(height),
 		Blocktime:     bchainTx.Blocktime,
 		Confirmations: bchainTx.Confirmations,
-		Fees:          w.chainParser.AmountToDecimalString(&feesSat),
+		Fees:          w.formatAmount(&feesSat),
 		FeesSat:       feesSat,
 		Locktime:      bchainTx.LockTime,
 		Time:          bchainTx.Time,
 		Txid:          bchainTx.Txid,
-		ValueIn:       w.chainParser.AmountToDecimalString(&valInSat),
+		ValueIn:       w.formatAmount(&valInSat),
 		ValueInSat:    valInSat,
-		ValueOut:      w.chainParser.AmountToDecimalString(&valOutSat),
+		ValueOut:      w.formatAmount(&valOutSat),
 		ValueOutSat:   valOutSat,
 		Version:       bchainTx.Version,
 		Hex:           bchainTx.Hex,
 		Vin:           vins,
 		Vout:          vouts,
 	}
+	if bchainTx.Confirmations > 0 {
+		w.setRewardTypes(r)
+		w.setCoinjoin(r)
+		w.setScriptAnnotations(r)
+	}
+	if bchainTx.Confirmations == 0 && w.chainParser.IsUTXOChain() {
+		w.setMempoolPackage(r)
+	}
+	if !w.chainParser.IsUTXOChain() {
+		w.setEthereumSpecific(r, bchainTx)
+		w.setTokenTransfers(r, bchainTx)
+		w.setContractCall(r, bchainTx)
+	}
 	if spendingTxs {
 		glog.Info("GetTransaction ", txid, " finished in ", time.Since(start))
 	}
 	return r, nil
 }
 
+// maxReorgHistory is the maximum number of the reorganizations returned by GetReorgHistory
+const maxReorgHistory = 1000
+
+// txTypeReward is the type of coinbase transactions with outputs classified as block rewards
+const txTypeReward = "reward"
+
+// txTypeCoinjoin is the type of transactions tagged as coinjoin
+const txTypeCoinjoin = "coinjoin"
+
+// setMempoolPackage sets the package of the unconfirmed ancestors and descendants of the mempool transaction
+func (w *Worker) setMempoolPackage(tx *Tx) {
+	p, err := w.chain.GetMempoolPackage(tx.Txid)
+	if err != nil {
+		if err != bchain.ErrNotSupported {
+			glog.Error("GetMempoolPackage ", tx.Txid, " error: ", err)
+		}
+		return
+	}
+	if p != nil && (len(p.Ancestors) > 0 || len(p.Descendants) > 0) {
+		tx.MempoolPackage = p
+	}
+}
+
+// GetMempoolEviction returns the record of the transaction removed from the mempool without being confirmed,
+// the records are kept only for a limited time after the removal
+func (w *Worker) GetMempoolEviction(txid string) (*bchain.MempoolEviction, error) {
+	e, err := w.chain.GetMempoolEviction(txid)
+	if err != nil {
+		if err == bchain.ErrNotSupported {
+			return nil, NewApiError("Not supported", true)
+		}
+		return nil, errors.Annotatef(err, "GetMempoolEviction %v", txid)
+	}
+	if e == nil {
+		return nil, NewApiError(fmt.Sprintf("Transaction %v was not removed from the mempool", txid), true)
+	}
+	return e, nil
+}
+
+// VerifyMessage verifies that the message was signed by the key of the address using the message signing scheme of the coin
+func (w *Worker) VerifyMessage(address, signature, message string) (*MessageVerification, error) {
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Invalid address, %v", err), true)
+	}
+	valid, err := w.chainParser.VerifyMessage(addrDesc, signature, message)
+	if err != nil {
+		if err == bchain.ErrNotSupported {
+			return nil, NewApiError("Message verification is not supported by the coin", true)
+		}
+		return nil, NewApiError(err.Error(), true)
+	}
+	return &MessageVerification{Address: address, Valid: valid}, nil
+}
+
+// GetReorgHistory returns at most limit of the latest reorganizations of the chain handled by the index, the latest first
+func (w *Worker) GetReorgHistory(limit int) ([]db.ReorgEvent, error) {
+	if limit <= 0 || limit > maxReorgHistory {
+		return nil, NewApiError(fmt.Sprintf("Limit must be between 1 and %d", maxReorgHistory), true)
+	}
+	r, err := w.db.GetReorgHistory(limit)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetReorgHistory")
+	}
+	return r, nil
+}
+
+// setRewardTypes sets the reward types of the outputs of coinbase transaction, classified during the block connect
+func (w *Worker) setRewardTypes(tx *Tx) {
+	rt, err := w.db.GetTxRewardTypes(tx.Txid)
+	if err != nil {
+		glog.Error("GetTxRewardTypes ", tx.Txid, ": ", err)
+		return
+	}
+	for i := range rt {
+		if i < len(tx.Vout) && rt[i] != bchain.RewardNone {
+			tx.Vout[i].Reward = rt[i].String()
+			tx.Type = txTypeReward
+		}
+	}
+}
+
+// setCoinjoin sets the coinjoin tag of the transaction, detected during the block connect
+func (w *Worker) setCoinjoin(tx *Tx) {
+	if !w.chainParser.IsUTXOChain() || !w.db.CoinjoinEnabled() {
+		return
+	}
+	c, err := w.db.GetCoinjoinTx(tx.Txid)
+	if err != nil {
+		glog.Error("GetCoinjoinTx ", tx.Txid, ": ", err)
+		return
+	}
+	if c == nil {
+		return
+	}
+	tx.Type = txTypeCoinjoin
+	tx.Coinjoin = &Coinjoin{
+		Type:         c.Type.String(),
+		EqualOutputs: int(c.EqualOutputs),
+		Denomination: w.formatAmount(&c.DenominationSat),
+	}
+}
+
+// setScriptAnnotations sets the annotations of the outputs by the custom script classifiers, stored during the block connect
+func (w *Worker) setScriptAnnotations(tx *Tx) {
+	if !bchain.HasScriptClassifiers() {
+		return
+	}
+	sa, err := w.db.GetScriptAnnotations(tx.Txid)
+	if err != nil {
+		glog.Error("GetScriptAnnotations ", tx.Txid, ": ", err)
+		return
+	}
+	for n, a := range sa {
+		if n < len(tx.Vout) {
+			tx.Vout[n].Annotations = a
+		}
+	}
+}
+
 func (w *Worker) getAddressTxids(addrDesc bchain.AddressDescriptor, mempool bool) ([]string, error) {
 	var err error
 	txids := make([]string, 0)
@@ -240,6 +402,127 @@ func (w *Worker) getAddressTxids(addrDesc bchain.AddressDescriptor, mempool bool
 	return txids, nil
 }
 
+// addressFilterValues are the parsed value limits of AddressFilter, nil means no limit
+type addressFilterValues struct {
+	minSat *big.Int
+	maxSat *big.Int
+}
+
+func (w *Worker) parseAddressFilterValues(filter *AddressFilter) (*addressFilterValues, error) {
+	var r addressFilterValues
+	parse := func(v, name string) (*big.Int, error) {
+		if v == "" {
+			return nil, nil
+		}
+		a, err := w.chainParser.AmountToBigInt(json.Number(v))
+		if err != nil || a.Sign() < 0 {
+			return nil, NewApiError(fmt.Sprintf("Invalid %v '%v'", name, v), true)
+		}
+		return &a, nil
+	}
+	var err error
+	if r.minSat, err = parse(filter.MinValue, "minValue"); err != nil {
+		return nil, err
+	}
+	if r.maxSat, err = parse(filter.MaxValue, "maxValue"); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// matches checks that the net value transferred by the transaction to or from the address is within the limits
+func (v *addressFilterValues) matches(receivedSat, sentSat *big.Int) bool {
+	if v.minSat == nil && v.maxSat == nil {
+		return true
+	}
+	var net big.Int
+	net.Sub(receivedSat, sentSat)
+	net.Abs(&net)
+	if v.minSat != nil && net.Cmp(v.minSat) < 0 {
+		return false
+	}
+	if v.maxSat != nil && net.Cmp(v.maxSat) > 0 {
+		return false
+	}
+	return true
+}
+
+// filterTxids removes from txids the transactions of the address in the blocks from lower to higher not matching the filter
+// the direction is evaluated from the addresses column, the values are read from the txAddresses column only if the limits are set
+func (w *Worker) filterTxids(addrDesc bchain.AddressDescriptor, txids []string, lower, higher uint32, filter *AddressFilter, values *addressFilterValues) ([]string, error) {
+	// transactions, in which the address is on the input side, are sent, the others are received
+	spending := make(map[string]struct{})
+	err := w.db.GetAddrDescTransactions(addrDesc, lower, higher, func(txid string, vout uint32, isOutput bool) error {
+		if !isOutput {
+			spending[txid] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := txids[:0]
+	for _, txid := range txids {
+		_, sent := spending[txid]
+		if (filter.Direction == AddressFilterDirectionReceived && sent) || (filter.Direction == AddressFilterDirectionSent && !sent) {
+			continue
+		}
+		// transactions, in which the address sends funds, are never filtered as dust
+		if filter.ExcludeDust && !sent {
+			dust, err := w.db.IsDustTx(txid)
+			if err != nil {
+				return nil, err
+			}
+			if dust {
+				continue
+			}
+		}
+		if values.minSat != nil || values.maxSat != nil {
+			ta, err := w.db.GetTxAddresses(txid)
+			if err != nil {
+				return nil, err
+			}
+			if ta == nil {
+				glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+				continue
+			}
+			var receivedSat, sentSat big.Int
+			for i := range ta.Outputs {
+				if bytes.Equal(ta.Outputs[i].AddrDesc, addrDesc) {
+					receivedSat.Add(&receivedSat, &ta.Outputs[i].ValueSat)
+				}
+			}
+			for i := range ta.Inputs {
+				if bytes.Equal(ta.Inputs[i].AddrDesc, addrDesc) {
+					sentSat.Add(&sentSat, &ta.Inputs[i].ValueSat)
+				}
+			}
+			if !values.matches(&receivedSat, &sentSat) {
+				continue
+			}
+		}
+		r = append(r, txid)
+	}
+	return r, nil
+}
+
+// matchesAddressFilter checks the mempool transaction against the filter, dust is not tagged in mempool
+func (t *Tx) matchesAddressFilter(addrDesc bchain.AddressDescriptor, filter *AddressFilter, values *addressFilterValues) bool {
+	receivedSat := t.getAddrVoutValue(addrDesc)
+	sentSat := t.getAddrVinValue(addrDesc)
+	sent := false
+	for i := range t.Vin {
+		if bytes.Equal(t.Vin[i].AddrDesc, addrDesc) {
+			sent = true
+			break
+		}
+	}
+	if (filter.Direction == AddressFilterDirectionReceived && sent) || (filter.Direction == AddressFilterDirectionSent && !sent) {
+		return false
+	}
+	return values.matches(receivedSat, sentSat)
+}
+
 func (t *Tx) getAddrVoutValue(addrDesc bchain.AddressDescriptor) *big.Int {
 	var val big.Int
 	for _, vout := range t.Vout {
@@ -285,7 +568,7 @@ func (w *Worker) txFromTxAddress(txid string, ta *db.TxAddresses, bi *db.BlockIn
 		vin := &vins[i]
 		vin.N = i
 		vin.ValueSat = tai.ValueSat
-		vin.Value = w.chainParser.AmountToDecimalString(&vin.ValueSat)
+		vin.Value = w.formatAmount(&vin.ValueSat)
 		valInSat.Add(&valInSat, &vin.ValueSat)
 		vin.Addresses, vin.Searchable, err = tai.Addresses(w.chainParser)
 		if err != nil {
@@ -298,12 +581,13 @@ func (w *Worker) txFromTxAddress(txid string, ta *db.TxAddresses, bi *db.BlockIn
 		vout := &vouts[i]
 		vout.N = i
 		vout.ValueSat = tao.ValueSat
-		vout.Value = w.chainParser.AmountToDecimalString(&vout.ValueSat)
+		vout.Value = w.formatAmount(&vout.ValueSat)
 		valOutSat.Add(&valOutSat, &vout.ValueSat)
 		vout.ScriptPubKey.Addresses, vout.ScriptPubKey.Searchable, err = tao.Addresses(w.chainParser)
 		if err != nil {
 			glog.Errorf("tai.Addresses error %v, tx %v, output %v, tao %+v", err, txid, i, tao)
 		}
+		w.setOutputMemo(vout, tao.AddrDesc)
 		vout.Spent = tao.Spent
 	}
 	// for coinbase transactions valIn is 0
@@ -316,14 +600,17 @@ func (w *Worker) txFromTxAddress(txid string, ta *db.TxAddresses, bi *db.BlockIn
 		Blockheight:   int(ta.Height),
 		Blocktime:     bi.Time,
 		Confirmations: bestheight - ta.Height + 1,
-		Fees:          w.chainParser.AmountToDecimalString(&feesSat),
+		Fees:          w.formatAmount(&feesSat),
 		Time:          bi.Time,
 		Txid:          txid,
-		ValueIn:       w.chainParser.AmountToDecimalString(&valInSat),
-		ValueOut:      w.chainParser.AmountToDecimalString(&valOutSat),
+		ValueIn:       w.formatAmount(&valInSat),
+		ValueOut:      w.formatAmount(&valOutSat),
 		Vin:           vins,
 		Vout:          vouts,
 	}
+	w.setRewardTypes(r)
+	w.setCoinjoin(r)
+	w.setScriptAnnotations(r)
 	return r
 }
 
@@ -349,7 +636,9 @@ func computePaging(count, page, itemsOnPage int) (Paging, int, int, int) {
 }
 
 // GetAddress computes address value and gets transactions for given address
-func (w *Worker) GetAddress(address string, page int, txsOnPage int, onlyTxids bool) (*Address, error) {
+// if filter is set, only the transactions matching the filter are returned in the address history,
+// if cursor is set or the address is large, the history is returned in the summary-only mode from the cursor
+func (w *Worker) GetAddress(address string, page int, txsOnPage int, onlyTxids bool, filter *AddressFilter, cursor string) (*Address, error) {
 	start := time.Now()
 	page--
 	if page < 0 {
@@ -372,37 +661,75 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, onlyTxids b
 	if len(addresses) == 1 {
 		address = addresses[0]
 	}
-	txc, err := w.getAddressTxids(addrDesc, false)
-	if err != nil {
-		return nil, errors.Annotatef(err, "getAddressTxids %v false", address)
+	if ba != nil && (cursor != "" || w.isLargeAddress(ba)) {
+		r, err := w.getLargeAddress(address, addrDesc, ba, cursor, txsOnPage, onlyTxids, filter)
+		if err == nil {
+			glog.Info("GetAddress ", address, " summary-only finished in ", time.Since(start))
+		}
+		return r, err
+	}
+	// the withdrawals are not transactions, they are not matched by the filter
+	var withdrawals *addressWithdrawals
+	if filter == nil {
+		if withdrawals, err = w.getAddressWithdrawals(address, addrDesc, ba); err != nil {
+			return nil, err
+		}
+	}
+	// the withdrawals are merged to the history by the heights of the transactions
+	var txc []string
+	var txHeights []uint32
+	if withdrawals != nil {
+		if txc, txHeights, err = w.getAddressTxidHeights(addrDesc); err != nil {
+			return nil, errors.Annotatef(err, "getAddressTxidHeights %v", address)
+		}
+	} else {
+		if txc, err = w.getAddressTxids(addrDesc, false); err != nil {
+			return nil, errors.Annotatef(err, "getAddressTxids %v false", address)
+		}
+		txc = UniqueTxidsInReverse(txc)
+	}
+	var values *addressFilterValues
+	if filter != nil {
+		if values, err = w.parseAddressFilterValues(filter); err != nil {
+			return nil, err
+		}
+		if txc, err = w.filterTxids(addrDesc, txc, 0, ^uint32(0), filter, values); err != nil {
+			return nil, errors.Annotatef(err, "filterTxids %v", address)
+		}
 	}
-	txc = UniqueTxidsInReverse(txc)
 	var txm []string
-	// if there are only unconfirmed transactions, ba is nil
+	// if there are only unconfirmed transactions (or withdrawals), ba is nil
 	if ba == nil {
 		ba = &db.AddrBalance{}
-		page = 0
+		if withdrawals == nil {
+			page = 0
+		}
 	}
 	txm, err = w.getAddressTxids(addrDesc, true)
 	if err != nil {
 		return nil, errors.Annotatef(err, "getAddressTxids %v true", address)
 	}
 	txm = UniqueTxidsInReverse(txm)
+	count := len(txc)
+	if withdrawals != nil {
+		count += withdrawals.count
+	}
 	// check if the address exist
-	if len(txc)+len(txm) == 0 {
+	if count+len(txm) == 0 {
 		return nil, NewApiError("Address not found", true)
 	}
-	bestheight, _, err := w.db.GetBestBlock()
+	bestheight, err := w.db.GetBestHeight()
 	if err != nil {
-		return nil, errors.Annotatef(err, "GetBestBlock")
+		return nil, errors.Annotatef(err, "GetBestHeight")
 	}
-	pg, from, to, page := computePaging(len(txc), page, txsOnPage)
+	pg, from, to, page := computePaging(count, page, txsOnPage)
+	txFrom, txTo, wFrom, wTo := pageAddressHistory(txHeights, withdrawals, from, to)
 	var txs []*Tx
 	var txids []string
 	if onlyTxids {
-		txids = make([]string, len(txm)+to-from)
+		txids = make([]string, len(txm)+txTo-txFrom)
 	} else {
-		txs = make([]*Tx, len(txm)+to-from)
+		txs = make([]*Tx, len(txm)+txTo-txFrom)
 	}
 	txi := 0
 	// load mempool transactions
@@ -415,7 +742,7 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, onlyTxids b
 		} else {
 			uBalSat.Add(&uBalSat, tx.getAddrVoutValue(addrDesc))
 			uBalSat.Sub(&uBalSat, tx.getAddrVinValue(addrDesc))
-			if page == 0 {
+			if page == 0 && (filter == nil || tx.matchesAddressFilter(addrDesc, filter, values)) {
 				if onlyTxids {
 					txids[txi] = tx.Txid
 				} else {
@@ -425,10 +752,10 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, onlyTxids b
 			}
 		}
 	}
-	if len(txc) != int(ba.Txs) {
+	if filter == nil && len(txc) != int(ba.Txs) {
 		glog.Warning("DB inconsistency for address ", address, ": number of txs from column addresses ", len(txc), ", from addressBalance ", ba.Txs)
 	}
-	for i := from; i < to; i++ {
+	for i := txFrom; i < txTo; i++ {
 		txid := txc[i]
 		if onlyTxids {
 			txids[txi] = txid
@@ -461,19 +788,251 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, onlyTxids b
 	r := &Address{
 		Paging:                  pg,
 		AddrStr:                 address,
-		Balance:                 w.chainParser.AmountToDecimalString(&ba.BalanceSat),
-		TotalReceived:           w.chainParser.AmountToDecimalString(ba.ReceivedSat()),
-		TotalSent:               w.chainParser.AmountToDecimalString(&ba.SentSat),
+		Balance:                 w.formatAmount(&ba.BalanceSat),
+		TotalReceived:           w.formatAmount(ba.ReceivedSat()),
+		TotalSent:               w.formatAmount(&ba.SentSat),
 		TxApperances:            len(txc),
-		UnconfirmedBalance:      w.chainParser.AmountToDecimalString(&uBalSat),
+		UnconfirmedBalance:      w.formatAmount(&uBalSat),
 		UnconfirmedTxApperances: len(txm),
 		Transactions:            txs,
 		Txids:                   txids,
 	}
+	if !w.chainParser.IsUTXOChain() {
+		r.IsContract = w.isContract(addrDesc)
+	}
+	if err = w.setAddressWithdrawals(r, addrDesc, withdrawals, wFrom, wTo, bestheight); err != nil {
+		return nil, err
+	}
+	if err = w.setAddressHolding(r, addrDesc); err != nil {
+		return nil, err
+	}
 	glog.Info("GetAddress ", address, " finished in ", time.Since(start))
 	return r, nil
 }
 
+// StreamAddressHistory passes the whole history of the address to the function item one transaction at a time,
+// loading only a chunk of the history to memory; the confirmed transactions are passed from the oldest,
+// followed by the mempool transactions. The header is passed before the first transaction.
+// If onlyTxids is set, the transactions are not loaded and item receives nil tx.
+func (w *Worker) StreamAddressHistory(address string, onlyTxids bool, filter *AddressFilter, header func(h *AddressHistoryHeader) error, item func(txid string, tx *Tx) error) error {
+	start := time.Now()
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	// ba can be nil if the address is only in mempool
+	ba, err := w.db.GetAddrDescBalance(addrDesc)
+	if err != nil {
+		return NewApiError(fmt.Sprintf("Address not found, %v", err), true)
+	}
+	if ba == nil {
+		ba = &db.AddrBalance{}
+	}
+	addresses, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil {
+		glog.V(2).Infof("GetAddressesFromAddrDesc error %v, %v", err, addrDesc)
+	}
+	if len(addresses) == 1 {
+		address = addresses[0]
+	}
+	if w.isLargeAddress(ba) {
+		return w.largeAddressError(address)
+	}
+	var values *addressFilterValues
+	if filter != nil {
+		if values, err = w.parseAddressFilterValues(filter); err != nil {
+			return err
+		}
+	}
+	txm, err := w.getAddressTxids(addrDesc, true)
+	if err != nil {
+		return errors.Annotatef(err, "getAddressTxids %v true", address)
+	}
+	txm = UniqueTxidsInReverse(txm)
+	if ba.Txs == 0 && len(txm) == 0 {
+		return NewApiError("Address not found", true)
+	}
+	// the mempool is small, its transactions are loaded before the header to compute the unconfirmed balance
+	var uBalSat big.Int
+	mempoolTxs := make([]*Tx, 0, len(txm))
+	for _, txid := range txm {
+		tx, err := w.GetTransaction(txid, false)
+		// mempool transaction may fail
+		if err != nil {
+			glog.Error("GetTransaction in mempool ", txid, ": ", err)
+			continue
+		}
+		uBalSat.Add(&uBalSat, tx.getAddrVoutValue(addrDesc))
+		uBalSat.Sub(&uBalSat, tx.getAddrVinValue(addrDesc))
+		if filter == nil || tx.matchesAddressFilter(addrDesc, filter, values) {
+			mempoolTxs = append(mempoolTxs, tx)
+		}
+	}
+	h := &AddressHistoryHeader{
+		AddrStr:                 address,
+		Balance:                 w.formatAmount(&ba.BalanceSat),
+		TotalReceived:           w.formatAmount(ba.ReceivedSat()),
+		TotalSent:               w.formatAmount(&ba.SentSat),
+		TxApperances:            int(ba.Txs),
+		UnconfirmedBalance:      w.formatAmount(&uBalSat),
+		UnconfirmedTxApperances: len(txm),
+	}
+	if !w.chainParser.IsUTXOChain() {
+		h.IsContract = w.isContract(addrDesc)
+	}
+	if err = header(h); err != nil {
+		return err
+	}
+	bestheight, err := w.db.GetBestHeight()
+	if err != nil {
+		return errors.Annotatef(err, "GetBestHeight")
+	}
+	count := 0
+	// the txids are read in chunks of the blocks, the chunk is written to the client after the iteration over the index
+	// is left, so that a slow client does not hold the iterator
+	for lower := uint32(0); lower <= bestheight; {
+		var chunk []heightTxids
+		txs := 0
+		err = w.db.GetAddrDescHeightTransactions(addrDesc, lower, bestheight, func(height uint32, txids []string) error {
+			chunk = append(chunk, heightTxids{height: height, txids: txids})
+			txs += len(txids)
+			if txs >= streamHistoryChunkTxs {
+				return &db.StopIteration{}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		for _, c := range chunk {
+			n, err := w.streamHistoryBlock(addrDesc, address, c.height, c.txids, onlyTxids, filter, values, bestheight, item)
+			if err != nil {
+				return err
+			}
+			count += n
+		}
+		if txs < streamHistoryChunkTxs {
+			break
+		}
+		lower = chunk[len(chunk)-1].height + 1
+		if lower == 0 {
+			break
+		}
+	}
+	for _, tx := range mempoolTxs {
+		if onlyTxids {
+			err = item(tx.Txid, nil)
+		} else {
+			err = item(tx.Txid, tx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	glog.Info("StreamAddressHistory ", address, ", ", count+len(mempoolTxs), " txs finished in ", time.Since(start))
+	return nil
+}
+
+// streamHistoryChunkTxs is the number of the transactions of the address history read from the index at once by StreamAddressHistory
+const streamHistoryChunkTxs = 1000
+
+// heightTxids are the txids of the address in the block at height
+type heightTxids struct {
+	height uint32
+	txids  []string
+}
+
+// streamHistoryBlock passes the transactions of the address in the block at height matching the filter to the function item,
+// returns the number of the passed transactions
+func (w *Worker) streamHistoryBlock(addrDesc bchain.AddressDescriptor, address string, height uint32, txids []string, onlyTxids bool,
+	filter *AddressFilter, values *addressFilterValues, bestheight uint32, item func(txid string, tx *Tx) error) (int, error) {
+	var err error
+	if filter != nil {
+		if txids, err = w.filterTxids(addrDesc, txids, height, height, filter, values); err != nil {
+			return 0, errors.Annotatef(err, "filterTxids %v", address)
+		}
+	}
+	if len(txids) == 0 {
+		return 0, nil
+	}
+	var bi *db.BlockInfo
+	if !onlyTxids {
+		if bi, err = w.db.GetBlockInfo(height); err != nil {
+			return 0, errors.Annotatef(err, "GetBlockInfo %v", height)
+		}
+		if bi == nil {
+			glog.Warning("DB inconsistency:  block height ", height, ": not found in db")
+			return 0, nil
+		}
+	}
+	count := 0
+	for _, txid := range txids {
+		var tx *Tx
+		if !onlyTxids {
+			ta, err := w.db.GetTxAddresses(txid)
+			if err != nil {
+				return count, errors.Annotatef(err, "GetTxAddresses %v", txid)
+			}
+			if ta == nil {
+				glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+				continue
+			}
+			tx = w.txFromTxAddress(txid, ta, bi, bestheight)
+		}
+		if err := item(txid, tx); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// CreateReadSnapshot pins the current state of the index for the time ttl on behalf of the client,
+// queries of the worker returned by WithReadSnapshot then see the same chain state
+func (w *Worker) CreateReadSnapshot(ttl time.Duration, client string) (*ReadSnapshot, error) {
+	s, err := w.db.CreateReadSnapshot(ttl, client)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Cannot create read snapshot, %v", err), true)
+	}
+	return &ReadSnapshot{
+		ID:         s.ID,
+		Expires:    s.Expires,
+		BestHeight: s.BestHeight,
+		BestHash:   s.BestHash,
+	}, nil
+}
+
+// ReleaseReadSnapshot releases the read snapshot before it expires
+func (w *Worker) ReleaseReadSnapshot(id string) error {
+	if err := w.db.ReleaseReadSnapshot(id); err != nil {
+		return NewApiError(err.Error(), true)
+	}
+	return nil
+}
+
+// WithReadSnapshot returns worker, which reads the index data from the read snapshot with given id,
+// and the function, which must be called when the worker is no longer used;
+// mempool and data fetched from the backend are not part of the snapshot
+func (w *Worker) WithReadSnapshot(id string) (*Worker, func(), error) {
+	d, s, err := w.db.ReadSnapshotView(id)
+	if err != nil {
+		return nil, nil, NewApiError(err.Error(), true)
+	}
+	done := func() { w.db.DoneReadSnapshotView(s) }
+	return &Worker{
+		db:              d,
+		txCache:         w.txCache.WithDB(d),
+		chain:           w.chain,
+		chainParser:     w.chainParser,
+		is:              w.is,
+		largeAddressTxs: w.largeAddressTxs,
+		erc20Fetches:    w.erc20Fetches,
+	}, done, nil
+}
+
 // GetBlocks returns BlockInfo for blocks on given page
 func (w *Worker) GetBlocks(page int, blocksOnPage int) (*Blocks, error) {
 	start := time.Now()
@@ -481,10 +1040,10 @@ func (w *Worker) GetBlocks(page int, blocksOnPage int) (*Blocks, error) {
 	if page < 0 {
 		page = 0
 	}
-	b, _, err := w.db.GetBestBlock()
+	b, err := w.db.GetBestHeight()
 	bestheight := int(b)
 	if err != nil {
-		return nil, errors.Annotatef(err, "GetBestBlock")
+		return nil, errors.Annotatef(err, "GetBestHeight")
 	}
 	pg, from, to, page := computePaging(bestheight+1, page, blocksOnPage)
 	r := &Blocks{Paging: pg}
@@ -536,9 +1095,9 @@ func (w *Worker) GetBlock(bid string, page int, txsOnPage int) (*Block, error) {
 		Time:   bi.Time,
 	}
 	txCount := len(bi.Txids)
-	bestheight, _, err := w.db.GetBestBlock()
+	bestheight, err := w.db.GetBestHeight()
 	if err != nil {
-		return nil, errors.Annotatef(err, "GetBestBlock")
+		return nil, errors.Annotatef(err, "GetBestHeight")
 	}
 	pg, from, to, page := computePaging(txCount, page, txsOnPage)
 	glog.Info("GetBlock ", bid, ", page ", page, " finished in ", time.Since(start))
@@ -558,50 +1117,1190 @@ func (w *Worker) GetBlock(bid string, page int, txsOnPage int) (*Block, error) {
 		txi++
 	}
 	txs = txs[:txi]
+	reward, err := w.getBlockReward(bi)
+	if err != nil {
+		return nil, err
+	}
 	bi.Txids = nil
+	var extra bchain.BlockExtra
+	if ibi, err := w.db.GetBlockInfo(bi.Height); err != nil {
+		glog.Error("GetBlockInfo ", bi.Height, ": ", err)
+	} else if ibi != nil && ibi.Hash == bi.Hash {
+		extra = ibi.Extra
+	}
+	var archiveCID string
+	ab, err := w.db.GetArchivedBlock(bi.Height)
+	if err != nil {
+		glog.Error("GetArchivedBlock ", bi.Height, ": ", err)
+	} else if ab != nil && ab.Hash == bi.Hash {
+		archiveCID = ab.CID
+	}
 	return &Block{
 		Paging:       pg,
 		BlockInfo:    *bi,
 		TxCount:      txCount,
+		ArchiveCID:   archiveCID,
+		Reward:       reward,
+		Extra:        extra,
 		Transactions: txs,
 	}, nil
 }
 
-// GetSystemInfo returns information about system
-func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
+// GetBlockAffectedAddresses returns the addresses touched by the transactions of the indexed block given by height or hash,
+// it allows the notification services to catch up with the blocks connected while they were offline
+func (w *Worker) GetBlockAffectedAddresses(bid string) (*BlockAddresses, error) {
 	start := time.Now()
-	ci, err := w.chain.GetChainInfo()
+	var height uint32
+	var hash string
+	if h, err := strconv.Atoi(bid); err == nil && h >= 0 && h < int(^uint32(0)) {
+		height = uint32(h)
+	} else {
+		bi, err := w.chain.GetBlockInfo(bid)
+		if err != nil {
+			return nil, NewApiError("Block not found", true)
+		}
+		height, hash = bi.Height, bi.Hash
+	}
+	bi, err := w.db.GetBlockInfo(height)
 	if err != nil {
-		return nil, errors.Annotatef(err, "GetChainInfo")
+		return nil, errors.Annotatef(err, "GetBlockInfo %v", height)
 	}
-	vi := common.GetVersionInfo()
-	ss, bh, st := w.is.GetSyncState()
-	ms, mt, msz := w.is.GetMempoolSyncState()
-	var dbc []common.InternalStateColumn
-	var dbs int64
-	if internal {
-		dbc = w.is.GetAllDBColumnStats()
-		dbs = w.is.DBSizeTotal()
+	// the block given by hash must be the indexed block at its height
+	if bi == nil || (hash != "" && bi.Hash != hash) {
+		return nil, NewApiError("Block not found in the index", true)
 	}
-	bi := &BlockbookInfo{
-		Coin:              w.is.Coin,
-		Host:              w.is.Host,
-		Version:           vi.Version,
-		GitCommit:         vi.GitCommit,
-		BuildTime:         vi.BuildTime,
-		SyncMode:          w.is.SyncMode,
-		InitialSync:       w.is.InitialSync,
-		InSync:            ss,
-		BestHeight:        bh,
-		LastBlockTime:     st,
-		InSyncMempool:     ms,
-		LastMempoolTime:   mt,
-		MempoolSize:       msz,
-		DbSize:            w.db.DatabaseSizeOnDisk(),
-		DbSizeFromColumns: dbs,
-		DbColumns:         dbc,
-		About:             Text.BlockbookAbout,
+	addrDescs, err := w.db.GetBlockAffectedAddresses(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockAffectedAddresses %v", height)
+	}
+	r := &BlockAddresses{
+		Height:    height,
+		Hash:      bi.Hash,
+		Addresses: make([]string, 0, len(addrDescs)),
+	}
+	for _, addrDesc := range addrDescs {
+		a, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+		if err != nil {
+			glog.V(2).Infof("GetAddressesFromAddrDesc error %v, %v", err, addrDesc)
+			continue
+		}
+		r.Addresses = append(r.Addresses, a...)
+	}
+	glog.Info("GetBlockAffectedAddresses ", bid, ", ", len(r.Addresses), " addresses, finished in ", time.Since(start))
+	return r, nil
+}
+
+// getBlockReward compares the outputs of the coinbase transaction with the expected subsidy and the fees of the block
+// returns nil if the emission schedule of the coin is not known
+func (w *Worker) getBlockReward(bi *bchain.BlockInfo) (*BlockReward, error) {
+	subsidy, err := w.chainParser.GetBlockSubsidy(bi.Height)
+	if err != nil {
+		if err == bchain.ErrNotSupported {
+			return nil, nil
+		}
+		return nil, errors.Annotatef(err, "GetBlockSubsidy %v", bi.Height)
+	}
+	r := &BlockReward{Subsidy: w.formatAmount(subsidy)}
+	if !w.chainParser.IsUTXOChain() || len(bi.Txids) == 0 {
+		return r, nil
+	}
+	var fees, coinbase *big.Int
+	if w.db.FeeStatsEnabled() {
+		fs, err := w.db.GetBlockFeeStats(bi.Height, bi.Height)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockFeeStats %v", bi.Height)
+		}
+		if len(fs) == 1 {
+			fees = &fs[0].TotalFeesSat
+			r.Fees = w.formatAmount(fees)
+		}
+	}
+	ta, err := w.db.GetTxAddresses(bi.Txids[0])
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetTxAddresses %v", bi.Txids[0])
+	}
+	if ta != nil {
+		coinbase = new(big.Int)
+		for i := range ta.Outputs {
+			coinbase.Add(coinbase, &ta.Outputs[i].ValueSat)
+		}
+		r.Coinbase = w.formatAmount(coinbase)
+	}
+	if fees != nil && coinbase != nil {
+		switch coinbase.Cmp(new(big.Int).Add(subsidy, fees)) {
+		case 1:
+			r.Anomaly = RewardAnomalyOverpaid
+		case -1:
+			r.Anomaly = RewardAnomalyUnclaimed
+		}
+	}
+	return r, nil
+}
+
+// GetEmissionSchedule returns the emission schedule of the coin and the expected supply at the best block
+func (w *Worker) GetEmissionSchedule() (*EmissionSchedule, error) {
+	eras, err := w.chainParser.GetEmissionSchedule()
+	if err != nil {
+		if err == bchain.ErrNotSupported {
+			return nil, NewApiError("Emission schedule is not known for this coin", true)
+		}
+		return nil, errors.Annotatef(err, "GetEmissionSchedule")
+	}
+	bestHeight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	r := &EmissionSchedule{
+		BestHeight: bestHeight,
+		Eras:       make([]EmissionEra, len(eras)),
+	}
+	var maxSupply, subsidy big.Int
+	for i := range eras {
+		e := &eras[i]
+		blocks := new(big.Int).SetUint64(uint64(e.ToHeight - e.FromHeight + 1))
+		maxSupply.Add(&maxSupply, blocks.Mul(blocks, &e.Subsidy))
+		// the current subsidy is the subsidy of the next block
+		if bestHeight+1 >= e.FromHeight && bestHeight+1 <= e.ToHeight {
+			subsidy.Set(&e.Subsidy)
+			r.NextHalving = e.ToHeight + 1
+		}
+		r.Eras[i] = EmissionEra{
+			FromHeight: e.FromHeight,
+			ToHeight:   e.ToHeight,
+			Subsidy:    w.formatAmount(&e.Subsidy),
+			Supply:     w.formatAmount(&maxSupply),
+		}
+	}
+	r.CurrentSubsidy = w.formatAmount(&subsidy)
+	r.Supply = w.formatAmount(emissionInRange(eras, 0, bestHeight))
+	r.MaxSupply = w.formatAmount(&maxSupply)
+	return r, nil
+}
+
+// emissionInRange returns the sum of the subsidies of the blocks in the range from-to given by the emission schedule
+func emissionInRange(eras []bchain.EmissionEra, from, to uint32) *big.Int {
+	r := new(big.Int)
+	for i := range eras {
+		e := &eras[i]
+		lower, higher := e.FromHeight, e.ToHeight
+		if from > lower {
+			lower = from
+		}
+		if to < higher {
+			higher = to
+		}
+		if lower > higher {
+			continue
+		}
+		blocks := new(big.Int).SetUint64(uint64(higher - lower + 1))
+		r.Add(r, blocks.Mul(blocks, &e.Subsidy))
+	}
+	return r
+}
+
+// GetCoinSupply compares the supply at the height expected by the emission schedule with the supply computed from the index
+func (w *Worker) GetCoinSupply(height uint32) (*CoinSupply, error) {
+	if !w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Coin supply is available only for UTXO chains", true)
+	}
+	if !w.db.BlockSupplyEnabled() {
+		return nil, NewApiError("Coin supply is not indexed, enable it by the -blocksupply parameter", true)
+	}
+	eras, err := w.chainParser.GetEmissionSchedule()
+	if err != nil {
+		if err == bchain.ErrNotSupported {
+			return nil, NewApiError("Emission schedule is not known for this coin", true)
+		}
+		return nil, errors.Annotatef(err, "GetEmissionSchedule")
+	}
+	bestHeight, err := w.db.GetBestHeight()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestHeight")
+	}
+	if height > bestHeight {
+		return nil, NewApiError(fmt.Sprintf("Height %d is above the best block %d", height, bestHeight), true)
+	}
+	is, err := w.db.GetIndexedSupply(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetIndexedSupply %v", height)
+	}
+	if is == nil {
+		return nil, NewApiError(fmt.Sprintf("Supply is not indexed up to height %d", height), true)
+	}
+	expected := emissionInRange(eras, is.FromHeight, height)
+	var created, indexed, difference big.Int
+	created.Sub(&is.OutputsSat, &is.InputsSat)
+	indexed.Sub(&created, &is.BurnedSat)
+	difference.Sub(&created, expected)
+	return &CoinSupply{
+		FromHeight: is.FromHeight,
+		Height:     height,
+		Expected:   w.formatAmount(expected),
+		Created:    w.formatAmount(&created),
+		Burned:     w.formatAmount(&is.BurnedSat),
+		Indexed:    w.formatAmount(&indexed),
+		Difference: w.formatAmount(&difference),
+		Divergent:  difference.Sign() != 0,
+	}, nil
+}
+
+// GetSystemInfo returns information about system
+func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
+	start := time.Now()
+	ci, err := w.chain.GetChainInfo()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetChainInfo")
+	}
+	vi := common.GetVersionInfo()
+	ss, bh, st := w.is.GetSyncState()
+	sp, sps, vh, vhash := w.is.GetSyncPhase()
+	ms, mt, msz := w.is.GetMempoolSyncState()
+	var dbc []common.InternalStateColumn
+	var dbs int64
+	var pc int
+	var lc *time.Time
+	if internal {
+		dbc = w.is.GetAllDBColumnStats()
+		dbs = w.is.DBSizeTotal()
+		var t time.Time
+		if pc, t = w.is.GetCompactionState(); !t.IsZero() {
+			lc = &t
+		}
+	}
+	bi := &BlockbookInfo{
+		Coin:                 w.is.Coin,
+		Host:                 w.is.Host,
+		Version:              vi.Version,
+		GitCommit:            vi.GitCommit,
+		BuildTime:            vi.BuildTime,
+		SyncMode:             sp != common.SyncPhaseIdle,
+		InitialSync:          w.is.InitialSync,
+		InSync:               ss,
+		SyncPhase:            sp,
+		SyncPhaseSince:       sps,
+		InterruptedSyncPhase: w.is.InterruptedSyncPhase,
+		VerifiedHeight:       vh,
+		VerifiedHash:         vhash,
+		BestHeight:           bh,
+		LastBlockTime:        st,
+		InSyncMempool:        ms,
+		LastMempoolTime:      mt,
+		MempoolSize:          msz,
+		DbSize:               w.db.DatabaseSizeOnDisk(),
+		DbSizeFromColumns:    dbs,
+		DbColumns:            dbc,
+		PendingCompactions:   pc,
+		LastCompaction:       lc,
+		Decimals:             w.chainParser.AmountDecimals(),
+		About:                Text.BlockbookAbout,
 	}
 	glog.Info("GetSystemInfo finished in ", time.Since(start))
 	return &SystemInfo{bi, ci}, nil
 }
+
+// maximum number of items of the fee history
+const maxFeeHistoryItems = 2000
+
+// GetFeeHistory returns fee statistics of blocks in range from-to aggregated by resolution blocks
+// and snapshots of the mempool taken in the same time range averaged by resolution snapshots (a snapshot is taken every 10 minutes)
+// fee rates are in satoshi per virtual byte
+func (w *Worker) GetFeeHistory(from, to uint32, resolution int) (*FeeHistory, error) {
+	start := time.Now()
+	if !w.db.FeeStatsEnabled() {
+		return nil, NewApiError("Fee history is not indexed, enable it by the -feestats parameter", true)
+	}
+	if to < from {
+		return nil, NewApiError("Parameter 'to' must not be lower than parameter 'from'", true)
+	}
+	if resolution < 1 {
+		resolution = 1
+	}
+	if int(to-from)/resolution > maxFeeHistoryItems {
+		return nil, NewApiError(fmt.Sprintf("Too many items requested, increase resolution to at least %v", int(to-from)/maxFeeHistoryItems+1), true)
+	}
+	stats, err := w.db.GetBlockFeeStats(from, to)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockFeeStats %v-%v", from, to)
+	}
+	r := &FeeHistory{
+		From:        from,
+		To:          to,
+		Resolution:  resolution,
+		Percentiles: db.FeeRatePercentiles,
+		Blocks:      make([]FeeHistoryBlocks, 0, len(stats)/resolution+1),
+	}
+	var fb *FeeHistoryBlocks
+	for i := range stats {
+		bf := &stats[i]
+		bucket := from + (bf.Height-from)/uint32(resolution)*uint32(resolution)
+		if fb == nil || fb.From != bucket {
+			if fb != nil {
+				w.finishFeeHistoryBlocks(fb)
+			}
+			r.Blocks = append(r.Blocks, FeeHistoryBlocks{From: bucket, FeeRates: make([]float64, len(db.FeeRatePercentiles))})
+			fb = &r.Blocks[len(r.Blocks)-1]
+		}
+		fb.To = bf.Height
+		fb.TotalFeesSat.Add(&fb.TotalFeesSat, &bf.TotalFeesSat)
+		// fee rates of the bucket are averages of block percentiles weighted by the number of transactions
+		if len(bf.FeeRates) == len(fb.FeeRates) {
+			for j, fr := range bf.FeeRates {
+				fb.FeeRates[j] += float64(fr) * float64(bf.Txs)
+			}
+			fb.Txs += bf.Txs
+		}
+	}
+	if fb != nil {
+		w.finishFeeHistoryBlocks(fb)
+	}
+	if len(r.Blocks) > 0 {
+		bf, err := w.db.GetBlockInfo(r.Blocks[0].From)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockInfo %v", r.Blocks[0].From)
+		}
+		bt, err := w.db.GetBlockInfo(r.Blocks[len(r.Blocks)-1].To)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockInfo %v", r.Blocks[len(r.Blocks)-1].To)
+		}
+		if bf != nil && bt != nil {
+			ms, err := w.db.GetMempoolSnapshots(bf.Time, bt.Time)
+			if err != nil {
+				return nil, errors.Annotatef(err, "GetMempoolSnapshots %v-%v", bf.Time, bt.Time)
+			}
+			r.Mempool = make([]FeeHistoryMempool, 0, len(ms)/resolution+1)
+			for i := 0; i < len(ms); i += resolution {
+				j := i + resolution
+				if j > len(ms) {
+					j = len(ms)
+				}
+				r.Mempool = append(r.Mempool, w.averageMempoolSnapshots(ms[i:j]))
+			}
+		}
+	}
+	glog.Info("GetFeeHistory ", from, "-", to, ", resolution ", resolution, " finished in ", time.Since(start))
+	return r, nil
+}
+
+// averageMempoolSnapshots merges consecutive mempool snapshots to one item with the time of the first snapshot,
+// the number of transactions and the fee estimates are the averages of all snapshots, no snapshot is skipped
+func (w *Worker) averageMempoolSnapshots(ms []db.MempoolSnapshot) FeeHistoryMempool {
+	fm := FeeHistoryMempool{Time: ms[0].Time}
+	var txs uint64
+	for i := range ms {
+		txs += uint64(ms[i].Txs)
+	}
+	fm.Txs = uint32(txs / uint64(len(ms)))
+	for j := range ms[0].FeeEstimates {
+		blocks := ms[0].FeeEstimates[j].Blocks
+		var sum, n big.Int
+		for i := range ms {
+			// the estimates of the same confirmation target
+			if j < len(ms[i].FeeEstimates) && ms[i].FeeEstimates[j].Blocks == blocks {
+				sum.Add(&sum, &ms[i].FeeEstimates[j].FeeSat)
+				n.Add(&n, big.NewInt(1))
+			}
+		}
+		sum.Div(&sum, &n)
+		fm.Estimates = append(fm.Estimates, FeeHistoryEstimate{
+			Blocks: blocks,
+			Fee:    w.formatAmount(&sum),
+		})
+	}
+	return fm
+}
+
+func (w *Worker) finishFeeHistoryBlocks(fb *FeeHistoryBlocks) {
+	fb.TotalFees = w.formatAmount(&fb.TotalFeesSat)
+	if fb.Txs > 0 {
+		for j := range fb.FeeRates {
+			// stored rates are per 1000 virtual bytes
+			fb.FeeRates[j] /= float64(fb.Txs) * 1000
+		}
+	} else {
+		fb.FeeRates = nil
+	}
+	if bi, err := w.db.GetBlockInfo(fb.To); err == nil && bi != nil {
+		fb.Time = bi.Time
+	}
+}
+
+// isAddressOfChain checks that the address converted back from address descriptor matches the original one,
+// decoding of some address formats does not check the network the address belongs to
+func (w *Worker) isAddressOfChain(addrDesc bchain.AddressDescriptor, address string) bool {
+	a, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil || len(a) != 1 {
+		return false
+	}
+	// ignore optional address prefix (cashaddr) and case (bech32, checksummed addresses)
+	stripPrefix := func(s string) string {
+		if i := strings.LastIndexByte(s, ':'); i >= 0 {
+			return s[i+1:]
+		}
+		return s
+	}
+	return strings.EqualFold(stripPrefix(a[0]), stripPrefix(address))
+}
+
+// ValidatePaymentRequest parses BIP21 URI (or plain address) and checks it against the index:
+// URI scheme and address format of this chain, amount vs dust threshold of the parser and expiration of the request;
+// Electrum style (time, exp) and BitPay style (expires) expiration parameters are recognized,
+// the errors are reported in the order of the URI parts and of the sorted parameter names
+func (w *Worker) ValidatePaymentRequest(uri string) (*PaymentRequest, error) {
+	uri = strings.TrimSpace(uri)
+	if uri == "" {
+		return nil, NewApiError("Missing payment request", true)
+	}
+	pr := &PaymentRequest{}
+	address := uri
+	var q url.Values
+	if i := strings.IndexByte(uri, ':'); i >= 0 {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, NewApiError("Invalid payment request URI", true)
+		}
+		address = u.Opaque
+		scheme := w.chainParser.GetPaymentURIScheme()
+		if scheme == "" {
+			pr.Errors = append(pr.Errors, "Payment request URIs are not supported by the chain")
+		} else if strings.ToLower(u.Scheme) != scheme {
+			// some chains (e.g. cashaddr) use the URI scheme as the address prefix
+			if _, err := w.chainParser.GetAddrDescFromAddress(u.Scheme + ":" + u.Opaque); err == nil {
+				address = u.Scheme + ":" + u.Opaque
+			} else {
+				pr.Errors = append(pr.Errors, "URI scheme '"+u.Scheme+"' does not match the chain, expected '"+scheme+"'")
+			}
+		}
+		if q, err = url.ParseQuery(u.RawQuery); err != nil {
+			return nil, NewApiError("Invalid payment request URI parameters", true)
+		}
+	}
+	pr.Address = address
+	if address == "" {
+		// BIP72 allows URI without address if there is a payment URL
+		if q.Get("r") == "" {
+			pr.Errors = append(pr.Errors, "Missing address")
+		}
+	} else {
+		addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+		if err == nil && !w.isAddressOfChain(addrDesc, address) {
+			err = errors.New("address of a different network")
+		}
+		if err != nil {
+			pr.Errors = append(pr.Errors, "Invalid address for this chain")
+		} else if w.chainParser.IsUTXOChain() {
+			ba, err := w.db.GetAddrDescBalance(addrDesc)
+			if err != nil {
+				return nil, errors.Annotatef(err, "GetAddrDescBalance %v", address)
+			}
+			if ba != nil {
+				pr.TxApperances = int(ba.Txs)
+				pr.Balance = w.formatAmount(&ba.BalanceSat)
+			}
+		}
+	}
+	now := time.Now().Unix()
+	dust := w.chainParser.GetDustThreshold()
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := q[k]
+		switch k {
+		case "amount":
+			a, err := w.chainParser.AmountToBigInt(json.Number(v[0]))
+			if err != nil || a.Sign() <= 0 {
+				pr.Errors = append(pr.Errors, "Invalid amount '"+v[0]+"'")
+				break
+			}
+			pr.AmountSat = a
+			pr.Amount = w.formatAmount(&a)
+			if dust != nil && a.Cmp(dust) < 0 {
+				pr.Errors = append(pr.Errors, "Amount is below the dust threshold")
+			}
+		case "label":
+			pr.Label = v[0]
+		case "message":
+			pr.Message = v[0]
+		case "r":
+			pr.PaymentURL = v[0]
+		case "expires":
+			e, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				pr.Errors = append(pr.Errors, "Invalid expiration '"+v[0]+"'")
+				break
+			}
+			pr.Expires = e
+		case "exp":
+			e, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil || e < 0 {
+				pr.Errors = append(pr.Errors, "Invalid expiration '"+v[0]+"'")
+				break
+			}
+			t := now
+			if ts := q.Get("time"); ts != "" {
+				if t, err = strconv.ParseInt(ts, 10, 64); err != nil {
+					pr.Errors = append(pr.Errors, "Invalid time '"+ts+"'")
+					break
+				}
+			}
+			if e > 0 {
+				pr.Expires = t + e
+			}
+		default:
+			// BIP21: parameters prefixed with req- are required, unknown ones make the request invalid
+			if strings.HasPrefix(k, "req-") {
+				pr.Errors = append(pr.Errors, "Unsupported required parameter '"+k+"'")
+			}
+		}
+	}
+	if pr.Expires > 0 && pr.Expires < now {
+		pr.Expired = true
+		pr.Errors = append(pr.Errors, "Payment request expired")
+	}
+	pr.Valid = len(pr.Errors) == 0
+	return pr, nil
+}
+
+// maximal number of outputs returned by GetScriptTemplateOutputs
+const maxScriptTemplateOutputs = 1000
+
+// GetScriptTemplateOutputs returns outputs in blocks from-to matching the script template
+// the template is given either as hex of the indexed script skeleton, which is used as is, or hex of a script,
+// from which the skeleton is computed
+func (w *Worker) GetScriptTemplateOutputs(script string, from, to uint32) (*ScriptTemplateOutputs, error) {
+	b, err := hex.DecodeString(script)
+	if err != nil || len(b) == 0 {
+		return nil, NewApiError("Invalid script template", true)
+	}
+	// the skeleton is usually not a valid script, its push opcodes miss the pushed data
+	skeleton := b
+	if !w.db.IsScriptTemplateIndexed(skeleton) {
+		if skeleton, err = db.ScriptSkeleton(b); err != nil {
+			return nil, NewApiError(fmt.Sprintf("Invalid script template, %v", err), true)
+		}
+	}
+	if !w.db.IsScriptTemplateIndexed(skeleton) {
+		return nil, NewApiError("Script template "+hex.EncodeToString(skeleton)+" is not indexed", true)
+	}
+	r := &ScriptTemplateOutputs{
+		Skeleton: hex.EncodeToString(skeleton),
+		From:     from,
+		To:       to,
+		Outputs:  make([]ScriptTemplateOutput, 0),
+	}
+	err = w.db.GetScriptTemplateOutputs(skeleton, from, to, func(txid string, vout uint32, height uint32) error {
+		if len(r.Outputs) >= maxScriptTemplateOutputs {
+			r.Truncated = true
+			return &db.StopIteration{}
+		}
+		r.Outputs = append(r.Outputs, ScriptTemplateOutput{Txid: txid, Vout: vout, Height: height})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetScriptTemplateOutputs %v", r.Skeleton)
+	}
+	return r, nil
+}
+
+func bigIntString(i *big.Int) string {
+	if i == nil {
+		return ""
+	}
+	return i.String()
+}
+
+// setEthereumSpecific sets the gas parameters of transaction of ethereum type chain
+func (w *Worker) setEthereumSpecific(tx *Tx, bchainTx *bchain.Tx) {
+	fd, err := w.chainParser.GetTxFeeData(bchainTx)
+	if err != nil {
+		glog.Warning("GetTxFeeData ", bchainTx.Txid, ": ", err)
+		return
+	}
+	tx.EthereumSpecific = &EthereumSpecific{
+		Type:                 fd.Type,
+		GasLimit:             fd.GasLimit,
+		GasPrice:             bigIntString(fd.GasPrice),
+		MaxFeePerGas:         bigIntString(fd.MaxFeePerGas),
+		MaxPriorityFeePerGas: bigIntString(fd.MaxPriorityFeePerGas),
+		EffectiveGasPrice:    bigIntString(fd.EffectiveGasPrice),
+		MaxFeePerBlobGas:     bigIntString(fd.MaxFeePerBlobGas),
+		BlobVersionedHashes:  fd.BlobVersionedHashes,
+		BlobGasUsed:          fd.BlobGasUsed,
+		BlobGasPrice:         bigIntString(fd.BlobGasPrice),
+	}
+}
+
+// setContractCall sets the called method of the contract call decoded by the first known signature of its selector,
+// which matches the call data; if none matches, only the signature and the name of the first one are set
+func (w *Worker) setContractCall(tx *Tx, bchainTx *bchain.Tx) {
+	selector, err := w.chainParser.GetContractCallSelector(bchainTx)
+	if err != nil {
+		glog.Warning("GetContractCallSelector ", bchainTx.Txid, ": ", err)
+		return
+	}
+	if selector == "" {
+		return
+	}
+	signatures, err := w.db.GetMethodSignatures(selector)
+	if err != nil {
+		glog.Warning("GetMethodSignatures ", selector, ": ", err)
+		return
+	}
+	for _, s := range signatures {
+		cc, err := w.chainParser.DecodeContractCall(bchainTx, s)
+		if err == nil && cc != nil {
+			tx.ContractCall = cc
+			return
+		}
+		glog.V(1).Info("DecodeContractCall ", bchainTx.Txid, " ", s, ": ", err)
+	}
+	if len(signatures) > 0 {
+		tx.ContractCall = &bchain.ContractCall{
+			Selector:  selector,
+			Signature: signatures[0],
+			Name:      signatures[0][:strings.IndexByte(signatures[0], '(')],
+		}
+	}
+}
+
+// GetNextNonce returns the next nonce of the address of account based chain
+// computed from the confirmed nonce stored in the index and the transactions of the address in mempool
+func (w *Worker) GetNextNonce(address string) (*Nonce, error) {
+	if w.chainParser.IsUTXOChain() {
+		return nil, NewApiError("Nonce is supported only by account based chains", true)
+	}
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Invalid address, %v", err), true)
+	}
+	confirmed, err := w.db.GetAddrDescNonce(addrDesc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAddrDescNonce %v", address)
+	}
+	txids, err := w.getAddressTxids(addrDesc, true)
+	if err != nil {
+		return nil, errors.Annotatef(err, "getAddressTxids %v true", address)
+	}
+	// nonces of pending transactions sent by the address
+	pending := make(map[uint64]struct{})
+	for _, txid := range UniqueTxidsInReverse(txids) {
+		tx, err := w.chain.GetTransactionForMempool(txid)
+		if err != nil {
+			// the transaction could be already removed from mempool
+			glog.V(1).Info("GetTransactionForMempool ", txid, ": ", err)
+			continue
+		}
+		if len(tx.Vin) == 0 || len(tx.Vin[0].Addresses) == 0 {
+			continue
+		}
+		sender, err := w.chainParser.GetAddrDescFromAddress(tx.Vin[0].Addresses[0])
+		if err != nil || !bytes.Equal(sender, addrDesc) {
+			continue
+		}
+		n, err := w.chainParser.GetTxNonce(tx)
+		if err != nil {
+			glog.Warning("GetTxNonce ", txid, ": ", err)
+			continue
+		}
+		pending[n] = struct{}{}
+	}
+	// the next nonce follows the continuous sequence of pending nonces after the confirmed nonce
+	next := confirmed
+	for {
+		if _, found := pending[next]; !found {
+			break
+		}
+		next++
+	}
+	return &Nonce{
+		Address:        address,
+		ConfirmedNonce: confirmed,
+		NextNonce:      next,
+		PendingTxs:     int(next - confirmed),
+	}, nil
+}
+
+const (
+	// addressSummaryTxs is the maximum number of the newest transactions scanned for the counterparties
+	addressSummaryTxs = 1000
+	// addressSummaryCounterparties is the number of the top counterparties returned in the summary
+	addressSummaryCounterparties = 10
+	// addressSummaryCacheSize is the maximum number of summaries kept in the cache
+	addressSummaryCacheSize = 1000
+)
+
+// addressSummaryCacheKey is the address and the format of the amounts of the cached summary,
+// the amounts are formatted in the unit and the locale of the request
+type addressSummaryCacheKey struct {
+	addrDesc string
+	amounts  string
+}
+
+// addressSummaryCache keeps the computed address summaries until the best block changes
+type addressSummaryCache struct {
+	mux       sync.Mutex
+	bestHash  string
+	summaries map[addressSummaryCacheKey]*AddressSummary
+}
+
+func (c *addressSummaryCache) get(addrDesc bchain.AddressDescriptor, amounts *AmountFormatter, bestHash string) *AddressSummary {
+	if c == nil {
+		return nil
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.bestHash != bestHash {
+		return nil
+	}
+	return c.summaries[addressSummaryCacheKey{string(addrDesc), amounts.cacheKey()}]
+}
+
+func (c *addressSummaryCache) set(addrDesc bchain.AddressDescriptor, amounts *AmountFormatter, bestHash string, s *AddressSummary) {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.bestHash != bestHash || len(c.summaries) >= addressSummaryCacheSize {
+		c.bestHash = bestHash
+		c.summaries = make(map[addressSummaryCacheKey]*AddressSummary)
+	}
+	c.summaries[addressSummaryCacheKey{string(addrDesc), amounts.cacheKey()}] = s
+}
+
+type counterparty struct {
+	addrDesc bchain.AddressDescriptor
+	txs      int
+	valueSat big.Int
+	lastTx   string
+}
+
+func (w *Worker) getActivity(txid string) (*AddressActivity, error) {
+	ta, err := w.db.GetTxAddresses(txid)
+	if err != nil {
+		return nil, err
+	}
+	if ta == nil {
+		return nil, errors.Errorf("Missing tx %v", txid)
+	}
+	a := &AddressActivity{Txid: txid, Height: ta.Height}
+	bi, err := w.db.GetBlockInfo(ta.Height)
+	if err != nil {
+		return nil, err
+	}
+	if bi != nil {
+		a.Time = bi.Time
+	}
+	return a, nil
+}
+
+// GetAddressSummary returns the totals, the first and the last activity, the top counterparties and the coinjoin statistics of the address
+// the counterparties and the coinjoin statistics (only if the coinjoin detection is enabled) are computed from at most addressSummaryTxs
+// newest confirmed transactions of the address, the summaries are cached until the next block is connected or disconnected
+func (w *Worker) GetAddressSummary(address string) (*AddressSummary, error) {
+	start := time.Now()
+	addrDesc, err := w.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Invalid address, %v", err), true)
+	}
+	_, bestHash, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	if s := w.summaries.get(addrDesc, w.amounts, bestHash); s != nil {
+		return s, nil
+	}
+	ba, err := w.db.GetAddrDescBalance(addrDesc)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetAddrDescBalance %v", address)
+	}
+	if ba == nil {
+		return nil, NewApiError("Address not found", true)
+	}
+	// convert the address to the format defined by the parser
+	addresses, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil {
+		glog.V(2).Infof("GetAddressesFromAddrDesc error %v, %v", err, addrDesc)
+	}
+	if len(addresses) == 1 {
+		address = addresses[0]
+	}
+	// newest transactions first, only the scanned part of the history and the oldest transaction are read,
+	// so that the summary of a large address does not load its whole history
+	txids, next, err := w.getAddressTxidsPage(addrDesc, nil, addressSummaryTxs)
+	if err != nil {
+		return nil, errors.Annotatef(err, "getAddressTxidsPage %v", address)
+	}
+	if len(txids) == 0 {
+		return nil, NewApiError("Address not found", true)
+	}
+	firstTxid := txids[len(txids)-1]
+	if next != nil {
+		err = w.db.GetAddrDescHeightTransactions(addrDesc, 0, ^uint32(0), func(height uint32, t []string) error {
+			if len(t) > 0 {
+				firstTxid = t[0]
+			}
+			return &db.StopIteration{}
+		})
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetAddrDescHeightTransactions %v", address)
+		}
+	}
+	s := &AddressSummary{
+		Address:       address,
+		Balance:       w.formatAmount(&ba.BalanceSat),
+		TotalReceived: w.formatAmount(ba.ReceivedSat()),
+		TotalSent:     w.formatAmount(&ba.SentSat),
+		Txs:           int(ba.Txs),
+	}
+	// average value moved by the address in a transaction, received and sent amounts are added
+	var avgSat big.Int
+	avgSat.Add(ba.ReceivedSat(), &ba.SentSat)
+	if ba.Txs > 0 {
+		avgSat.Div(&avgSat, big.NewInt(int64(ba.Txs)))
+	}
+	s.AverageTxValue = w.formatAmount(&avgSat)
+	if s.LastActivity, err = w.getActivity(txids[0]); err != nil {
+		return nil, errors.Annotatef(err, "getActivity %v", txids[0])
+	}
+	if s.FirstActivity, err = w.getActivity(firstTxid); err != nil {
+		return nil, errors.Annotatef(err, "getActivity %v", firstTxid)
+	}
+	s.Truncated = next != nil
+	s.ScannedTxs = len(txids)
+	if ba.Counterparties != nil {
+		s.EstimatedCounterparties = ba.Counterparties.Estimate()
+	}
+	cps := make(map[string]*counterparty)
+	add := func(ad bchain.AddressDescriptor, txid string, v *big.Int) {
+		if len(ad) == 0 || bytes.Equal(ad, addrDesc) {
+			return
+		}
+		cp, found := cps[string(ad)]
+		if !found {
+			cp = &counterparty{addrDesc: ad}
+			cps[string(ad)] = cp
+		}
+		// count each transaction only once for the counterparty
+		if cp.lastTx != txid {
+			cp.txs++
+			cp.lastTx = txid
+		}
+		cp.valueSat.Add(&cp.valueSat, v)
+	}
+	var privacy *AddressPrivacy
+	var mixedSat big.Int
+	if w.chainParser.IsUTXOChain() && w.db.CoinjoinEnabled() {
+		privacy = &AddressPrivacy{}
+	}
+	for _, txid := range txids {
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetTxAddresses %v", txid)
+		}
+		if ta == nil {
+			glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+			continue
+		}
+		if privacy != nil {
+			c, err := w.db.GetCoinjoinTx(txid)
+			if err != nil {
+				return nil, errors.Annotatef(err, "GetCoinjoinTx %v", txid)
+			}
+			if c != nil {
+				privacy.CoinjoinTxs++
+				for i := range ta.Outputs {
+					o := &ta.Outputs[i]
+					if bytes.Equal(o.AddrDesc, addrDesc) && o.ValueSat.Cmp(&c.DenominationSat) == 0 {
+						privacy.MixedOutputs++
+						mixedSat.Add(&mixedSat, &o.ValueSat)
+					}
+				}
+			}
+		}
+		sending := false
+		for i := range ta.Inputs {
+			if bytes.Equal(ta.Inputs[i].AddrDesc, addrDesc) {
+				sending = true
+				break
+			}
+		}
+		if sending {
+			// the counterparties are the recipients of the outputs
+			for i := range ta.Outputs {
+				add(ta.Outputs[i].AddrDesc, txid, &ta.Outputs[i].ValueSat)
+			}
+		} else {
+			// the counterparties are the senders, the amount received by the address is attributed to each of them
+			var received big.Int
+			for i := range ta.Outputs {
+				if bytes.Equal(ta.Outputs[i].AddrDesc, addrDesc) {
+					received.Add(&received, &ta.Outputs[i].ValueSat)
+				}
+			}
+			for i := range ta.Inputs {
+				add(ta.Inputs[i].AddrDesc, txid, &received)
+			}
+		}
+	}
+	top := make([]*counterparty, 0, len(cps))
+	for _, cp := range cps {
+		top = append(top, cp)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].txs != top[j].txs {
+			return top[i].txs > top[j].txs
+		}
+		return top[i].valueSat.Cmp(&top[j].valueSat) > 0
+	})
+	if len(top) > addressSummaryCounterparties {
+		top = top[:addressSummaryCounterparties]
+	}
+	s.Counterparties = make([]Counterparty, 0, len(top))
+	for _, cp := range top {
+		a, _, err := w.chainParser.GetAddressesFromAddrDesc(cp.addrDesc)
+		if err != nil {
+			glog.V(2).Infof("GetAddressesFromAddrDesc error %v, %v", err, cp.addrDesc)
+		}
+		s.Counterparties = append(s.Counterparties, Counterparty{
+			Addresses: a,
+			Txs:       cp.txs,
+			Value:     w.formatAmount(&cp.valueSat),
+		})
+	}
+	if privacy != nil {
+		privacy.MixedValue = w.formatAmount(&mixedSat)
+		s.Privacy = privacy
+	}
+	w.summaries.set(addrDesc, w.amounts, bestHash, s)
+	glog.Info("GetAddressSummary ", address, ", scanned ", s.ScannedTxs, " txs, finished in ", time.Since(start))
+	return s, nil
+}
+
+// isHashLike returns true if s is a hex encoded 32 byte hash, optionally prefixed by 0x
+func isHashLike(s string) bool {
+	if strings.HasPrefix(s, "0x") {
+		s = s[2:]
+	}
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// isXpubLike returns true if s looks like a base58 encoded extended public key
+func isXpubLike(s string) bool {
+	if len(s) != 111 {
+		return false
+	}
+	for _, p := range []string{"xpub", "ypub", "zpub", "tpub", "upub", "vpub"} {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search detects the type of the query (block height, block hash, txid or address) and returns the matching record
+func (w *Worker) Search(q string) (*SearchResult, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, NewApiError("Missing query", true)
+	}
+	r := &SearchResult{Query: q}
+	if h, err := strconv.ParseUint(q, 10, 32); err == nil {
+		hash, err := w.db.GetBlockHash(uint32(h))
+		if err != nil {
+			return nil, errors.Annotatef(err, "GetBlockHash %v", h)
+		}
+		if hash != "" {
+			r.Type = SearchTypeBlock
+			r.Height = uint32(h)
+			r.Hash = hash
+			return r, nil
+		}
+	}
+	if isHashLike(q) {
+		ta, err := w.db.GetTxAddresses(q)
+		if err != nil {
+			glog.V(1).Info("Search GetTxAddresses ", q, ": ", err)
+		} else if ta != nil {
+			r.Type = SearchTypeTx
+			r.Txid = q
+			r.Height = ta.Height
+			return r, nil
+		}
+		if bh, err := w.chain.GetBlockHeader(q); err == nil {
+			r.Type = SearchTypeBlock
+			r.Height = bh.Height
+			r.Hash = bh.Hash
+			return r, nil
+		}
+		// transactions in mempool and transactions of chains without txAddresses index
+		if tx, err := w.chain.GetTransaction(q); err == nil {
+			r.Type = SearchTypeTx
+			r.Txid = tx.Txid
+			if tx.Confirmations > 0 {
+				if bestheight, _, err := w.db.GetBestBlock(); err == nil {
+					r.Height = bestheight - tx.Confirmations + 1
+				}
+			}
+			return r, nil
+		}
+	}
+	if addrDesc, err := w.chainParser.GetAddrDescFromAddress(q); err == nil && len(addrDesc) > 0 {
+		r.Type = SearchTypeAddress
+		r.Address = q
+		// convert the address to the format defined by the parser
+		if addresses, _, err := w.chainParser.GetAddressesFromAddrDesc(addrDesc); err == nil && len(addresses) == 1 {
+			r.Address = addresses[0]
+		}
+		return r, nil
+	}
+	if isXpubLike(q) {
+		return nil, NewApiError("Search by xpub is not supported", true)
+	}
+	if strings.HasSuffix(strings.ToLower(q), ".eth") {
+		return nil, NewApiError("Search by ENS name is not supported", true)
+	}
+	return nil, NewApiError(fmt.Sprintf("No matching records found for '%v'", q), true)
+}
+
+// rpcErrMethodNotFound is the json-rpc error code returned by the backends not supporting the method
+const rpcErrMethodNotFound = -32601
+
+// DecodeAndTest decodes the raw transaction, finds the state of its inputs in the index
+// and tests if the backend would accept the transaction to the mempool, the transaction is not sent
+func (w *Worker) DecodeAndTest(rawTx string) (*TestTxResult, error) {
+	b, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, NewApiError("Invalid hex string", true)
+	}
+	tx, err := w.chainParser.ParseTx(b)
+	if err != nil {
+		return nil, NewApiError(fmt.Sprintf("Cannot decode transaction, %v", err), true)
+	}
+	r := &TestTxResult{Txid: tx.Txid}
+	if w.chainParser.IsUTXOChain() {
+		r.Vin = make([]TestTxInput, len(tx.Vin))
+		for i := range tx.Vin {
+			if err = w.setTestTxInput(&r.Vin[i], tx.Txid, &tx.Vin[i], i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ma, err := w.chain.TestMempoolAccept(rawTx)
+	if err != nil {
+		if err == bchain.ErrNotSupported {
+			return r, nil
+		}
+		if e, ok := err.(*bchain.RPCError); ok {
+			if e.Code == rpcErrMethodNotFound {
+				return r, nil
+			}
+			// the backend refused to process the transaction, for example it could not decode it
+			r.Tested = true
+			r.RejectReason = e.Message
+			return r, nil
+		}
+		return nil, errors.Annotatef(err, "TestMempoolAccept %v", tx.Txid)
+	}
+	r.Tested = true
+	r.Allowed = ma.Allowed
+	r.RejectReason = ma.RejectReason
+	return r, nil
+}
+
+func (w *Worker) setTestTxInput(ti *TestTxInput, txid string, vin *bchain.Vin, n int) error {
+	ti.N = n
+	ti.Txid = vin.Txid
+	ti.Vout = vin.Vout
+	addrDesc, value, status, err := w.getSpentOutput(txid, vin)
+	if err != nil {
+		return err
+	}
+	ti.Status = status
+	if status == TestTxInputUnknown {
+		return nil
+	}
+	if addrDesc != nil {
+		ti.Addresses, _, _ = w.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	}
+	ti.Value = w.formatAmount(value)
+	return nil
+}
+
+// getSpentOutput finds the output spent by the input of the transaction txid in the index or in the mempool,
+// returns its addrDesc, value and the status of the output (the constants of TestTxInput), the output is spent
+// in the mempool if another mempool transaction of its address spends it
+func (w *Worker) getSpentOutput(txid string, vin *bchain.Vin) (bchain.AddressDescriptor, *big.Int, string, error) {
+	if vin.Txid == "" {
+		return nil, nil, TestTxInputUnknown, nil
+	}
+	var addrDesc bchain.AddressDescriptor
+	var value *big.Int
+	var status string
+	ta, err := w.db.GetTxAddresses(vin.Txid)
+	if err != nil {
+		return nil, nil, "", errors.Annotatef(err, "GetTxAddresses %v", vin.Txid)
+	}
+	if ta != nil {
+		if int(vin.Vout) >= len(ta.Outputs) {
+			return nil, nil, TestTxInputUnknown, nil
+		}
+		o := &ta.Outputs[vin.Vout]
+		if o.Spent {
+			return o.AddrDesc, &o.ValueSat, TestTxInputSpent, nil
+		}
+		addrDesc, value, status = o.AddrDesc, &o.ValueSat, TestTxInputUnspent
+	} else {
+		// the spent transaction is not in the index, it can be in the mempool
+		mtx, err := w.chain.GetTransactionForMempool(vin.Txid)
+		if err != nil || int(vin.Vout) >= len(mtx.Vout) {
+			return nil, nil, TestTxInputUnknown, nil
+		}
+		vout := &mtx.Vout[vin.Vout]
+		if addrDesc, err = w.chainParser.GetAddrDescFromVout(vout); err != nil {
+			addrDesc = nil
+		}
+		value, status = &vout.ValueSat, TestTxInputMempool
+	}
+	if len(addrDesc) > 0 {
+		spent, err := w.isSpentInMempool(addrDesc, txid, vin)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if spent {
+			status = TestTxInputSpentInMempool
+		}
+	}
+	return addrDesc, value, status, nil
+}
+
+// isSpentInMempool returns true if a mempool transaction other than txid spends the output of the input,
+// the spending transaction is searched among the mempool transactions of the address of the output
+func (w *Worker) isSpentInMempool(addrDesc bchain.AddressDescriptor, txid string, vin *bchain.Vin) (bool, error) {
+	txids, err := w.chain.GetMempoolTransactionsForAddrDesc(addrDesc)
+	if err != nil {
+		return false, errors.Annotatef(err, "GetMempoolTransactionsForAddrDesc")
+	}
+	for _, t := range txids {
+		if t == txid || t == vin.Txid {
+			continue
+		}
+		mtx, err := w.chain.GetTransactionForMempool(t)
+		if err != nil {
+			// the transaction was removed from the mempool in the meantime
+			continue
+		}
+		for i := range mtx.Vin {
+			if mtx.Vin[i].Txid == vin.Txid && mtx.Vin[i].Vout == vin.Vout {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -1,6 +1,7 @@
 package bchain
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"math/big"
@@ -21,6 +22,30 @@ func (p *BaseParser) ParseBlock(b []byte) (*Block, error) {
 	return nil, errors.New("ParseBlock: not implemented")
 }
 
+// PackBlockExtra packs the chain specific fields of the block as json, the parsers knowing the fields of their chain
+// should override it by a more compact format
+func (p *BaseParser) PackBlockExtra(extra BlockExtra) ([]byte, error) {
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(extra)
+}
+
+// UnpackBlockExtra unpacks the chain specific fields of the block packed as json by PackBlockExtra,
+// the numbers are returned as json.Number so that they are not rounded
+func (p *BaseParser) UnpackBlockExtra(buf []byte) (BlockExtra, error) {
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	var extra BlockExtra
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	if err := d.Decode(&extra); err != nil {
+		return nil, err
+	}
+	return extra, nil
+}
+
 // ParseTx parses byte array containing transaction and returns Tx struct - currently not implemented
 func (p *BaseParser) ParseTx(b []byte) (*Tx, error) {
 	return nil, errors.New("ParseTx: not implemented")
@@ -52,16 +77,22 @@ func (p *BaseParser) AmountToBigInt(n json.Number) (big.Int, error) {
 
 // AmountToDecimalString converts amount in big.Int to string with decimal point in the correct place
 func (p *BaseParser) AmountToDecimalString(a *big.Int) string {
+	return AmountToDecimalString(a, p.AmountDecimalPoint)
+}
+
+// AmountToDecimalString converts amount in big.Int to string with decimal point given number of places from the right,
+// it is used also for the amounts of tokens, which have their own number of decimals
+func AmountToDecimalString(a *big.Int, d int) string {
 	n := a.String()
 	var s string
 	if n[0] == '-' {
 		n = n[1:]
 		s = "-"
 	}
-	if len(n) <= p.AmountDecimalPoint {
-		n = zeros[:p.AmountDecimalPoint-len(n)+1] + n
+	if len(n) <= d {
+		n = strings.Repeat("0", d-len(n)+1) + n
 	}
-	i := len(n) - p.AmountDecimalPoint
+	i := len(n) - d
 	ad := strings.TrimRight(n[i:], "0")
 	if len(ad) > 0 {
 		n = n[:i] + "." + ad
@@ -71,6 +102,11 @@ func (p *BaseParser) AmountToDecimalString(a *big.Int) string {
 	return s + n
 }
 
+// AmountDecimals returns the number of decimal places of the coin unit
+func (p *BaseParser) AmountDecimals() int {
+	return p.AmountDecimalPoint
+}
+
 // ParseTxFromJson parses JSON message containing transaction and returns Tx struct
 func (p *BaseParser) ParseTxFromJson(msg json.RawMessage) (*Tx, error) {
 	var tx Tx
@@ -130,6 +166,116 @@ func (p *BaseParser) IsUTXOChain() bool {
 	return true
 }
 
+// GetTxNonce is not supported by UTXO chains
+func (p *BaseParser) GetTxNonce(tx *Tx) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+// GetTxFeeData is not supported by UTXO chains
+func (p *BaseParser) GetTxFeeData(tx *Tx) (*TxFeeData, error) {
+	return nil, ErrNotSupported
+}
+
+// GetPaymentURIScheme returns empty scheme by default, the payment request URIs are coin specific
+func (p *BaseParser) GetPaymentURIScheme() string {
+	return ""
+}
+
+// GetDustThreshold returns nil by default, the dust threshold is not known
+func (p *BaseParser) GetDustThreshold() *big.Int {
+	return nil
+}
+
+// VerifyMessage is not supported by default, the message signing scheme is coin specific
+func (p *BaseParser) VerifyMessage(addrDesc AddressDescriptor, signature, message string) (bool, error) {
+	return false, ErrNotSupported
+}
+
+// GetErc20Transfers is not supported by UTXO chains
+func (p *BaseParser) GetErc20Transfers(tx *Tx) ([]Erc20Transfer, error) {
+	return nil, ErrNotSupported
+}
+
+// GetMethodSelector is not supported by UTXO chains
+func (p *BaseParser) GetMethodSelector(signature string) (string, error) {
+	return "", ErrNotSupported
+}
+
+// GetContractCallSelector is not supported by UTXO chains
+func (p *BaseParser) GetContractCallSelector(tx *Tx) (string, error) {
+	return "", ErrNotSupported
+}
+
+// DecodeContractCall is not supported by UTXO chains
+func (p *BaseParser) DecodeContractCall(tx *Tx, signature string) (*ContractCall, error) {
+	return nil, ErrNotSupported
+}
+
+// ScanSilentPayments is not supported by default, the silent payments are defined only for bitcoin-like coins with taproot
+func (p *BaseParser) ScanSilentPayments(tx *Tx, prevouts []AddressDescriptor, scanKey []byte, spendPubKey []byte) ([]SilentPaymentMatch, error) {
+	return nil, ErrNotSupported
+}
+
+// DeriveMultisigAddrDescs is not supported by default, the output descriptors are defined only for bitcoin-like coins
+func (p *BaseParser) DeriveMultisigAddrDescs(descriptor string, from, to uint32) ([]AddressDescriptor, error) {
+	return nil, ErrNotSupported
+}
+
+// DeriveAddrDescs is not supported by default, the output descriptors are defined only for bitcoin-like coins
+func (p *BaseParser) DeriveAddrDescs(descriptor string, from, to uint32) ([]AddressDescriptor, error) {
+	return nil, ErrNotSupported
+}
+
+// GetNameOperation is not supported by default, only the coins with names (Namecoin) implement it
+func (p *BaseParser) GetNameOperation(addrDesc AddressDescriptor) (*NameOperation, error) {
+	return nil, ErrNotSupported
+}
+
+// GetNameExpirationDepth returns 0, the names do not expire by default
+func (p *BaseParser) GetNameExpirationDepth(height uint32) uint32 {
+	return 0
+}
+
+// GetOutputMemo is not supported by default, only the coins with data carrying outputs implement it
+func (p *BaseParser) GetOutputMemo(addrDesc AddressDescriptor) (*OutputMemo, error) {
+	return nil, ErrNotSupported
+}
+
+// PaymentIDsSupported returns false, by default the coins have no payment id format
+func (p *BaseParser) PaymentIDsSupported() bool {
+	return false
+}
+
+// GetInscriptions is not supported by default, only bitcoin-like coins with taproot implement it
+func (p *BaseParser) GetInscriptions(tx *Tx) ([]InscriptionEnvelope, error) {
+	return nil, ErrNotSupported
+}
+
+// IsAddrDescUnspendable returns false, by default the unspendable outputs are not recognized
+func (p *BaseParser) IsAddrDescUnspendable(addrDesc AddressDescriptor) bool {
+	return false
+}
+
+// GetDuplicateTxids returns nil, by default the chains do not contain duplicate txids
+func (p *BaseParser) GetDuplicateTxids() map[string]uint32 {
+	return nil
+}
+
+// GetTxRewardTypes is not supported by default, only the coins paying masternodes from the coinbase (Dash) implement it
+func (p *BaseParser) GetTxRewardTypes(tx *Tx, height uint32) ([]RewardType, error) {
+	return nil, ErrNotSupported
+}
+
+// GetBlockSubsidy is not supported by default, the emission schedule is coin specific
+func (p *BaseParser) GetBlockSubsidy(height uint32) (*big.Int, error) {
+	return nil, ErrNotSupported
+}
+
+// GetEmissionSchedule is not supported by default, the emission schedule is coin specific
+func (p *BaseParser) GetEmissionSchedule() ([]EmissionEra, error) {
+	return nil, ErrNotSupported
+}
+
 // PackTx packs transaction to byte array using protobuf
 func (p *BaseParser) PackTx(tx *Tx, height uint32, blockTime int64) ([]byte, error) {
 	var err error
@@ -67,7 +67,10 @@ func NewBCashParser(params *chaincfg.Params, c *btc.Configuration) (*BCashParser
 				BlockAddressesToKeep: c.BlockAddressesToKeep,
 				AmountDecimalPoint:   8,
 			},
-			Params: params,
+			Params:             params,
+			SignedMessageMagic: btc.BitcoinSignedMessageMagic,
+			PaymentURIScheme:   "bitcoincash",
+			DustThresholdSat:   btc.DefaultDustThresholdSat,
 		},
 		AddressFormat: format,
 	}
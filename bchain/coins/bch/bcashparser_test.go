@@ -271,6 +271,10 @@ func init() {
 				Txid:     "c13e32a4428e31f85d7aee4ec7344504b12e72aaffcbde0160200d2ac7f0649d",
 				Vout:     0,
 				Sequence: 4294967295,
+				Witness: []string{
+					"3044022076aba4ad559616905fa51d4ddd357fc1fdb428d40cb388e042cdd1da4a1b7357022011916f90c712ead9a66d5f058252efd280439ad8956a967e95d437d246710bc901",
+					"02a80a5964c5612bb769ef73147b2cf3c149bc0fd4ecb02f8097629c94ab013ffd",
+				},
 			},
 		},
 		Vout: []bchain.Vout{
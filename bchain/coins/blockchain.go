@@ -36,6 +36,8 @@ var BlockChainFactories = make(map[string]blockChainFactory)
 func init() {
 	BlockChainFactories["Bitcoin"] = btc.NewBitcoinRPC
 	BlockChainFactories["Testnet"] = btc.NewBitcoinRPC
+	BlockChainFactories["Testnet4"] = btc.NewBitcoinRPC
+	BlockChainFactories["Signet"] = btc.NewBitcoinRPC
 	BlockChainFactories["Zcash"] = zec.NewZCashRPC
 	BlockChainFactories["Zcash Testnet"] = zec.NewZCashRPC
 	BlockChainFactories["Ethereum"] = eth.NewEthereumRPC
@@ -212,6 +214,21 @@ func (c *blockChainWithMetrics) SendRawTransaction(tx string) (v string, err err
 	return c.b.SendRawTransaction(tx)
 }
 
+func (c *blockChainWithMetrics) TestMempoolAccept(tx string) (v *bchain.MempoolAcceptResult, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("TestMempoolAccept", s, err) }(time.Now())
+	return c.b.TestMempoolAccept(tx)
+}
+
+func (c *blockChainWithMetrics) GetErc20ContractInfo(contractDesc bchain.AddressDescriptor) (v *bchain.Erc20Contract, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetErc20ContractInfo", s, err) }(time.Now())
+	return c.b.GetErc20ContractInfo(contractDesc)
+}
+
+func (c *blockChainWithMetrics) IsContract(addrDesc bchain.AddressDescriptor) (v bool, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("IsContract", s, err) }(time.Now())
+	return c.b.IsContract(addrDesc)
+}
+
 func (c *blockChainWithMetrics) ResyncMempool(onNewTxAddr bchain.OnNewTxAddrFunc) (count int, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("ResyncMempool", s, err) }(time.Now())
 	count, err = c.b.ResyncMempool(onNewTxAddr)
@@ -236,6 +253,20 @@ func (c *blockChainWithMetrics) GetMempoolEntry(txid string) (v *bchain.MempoolE
 	return c.b.GetMempoolEntry(txid)
 }
 
+func (c *blockChainWithMetrics) TrackMempoolEvictions(isConfirmed bchain.IsTxConfirmedFunc, isSpent bchain.IsOutpointSpentFunc, onEviction bchain.OnMempoolEvictionFunc) {
+	c.b.TrackMempoolEvictions(isConfirmed, isSpent, onEviction)
+}
+
+func (c *blockChainWithMetrics) GetMempoolEviction(txid string) (v *bchain.MempoolEviction, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetMempoolEviction", s, err) }(time.Now())
+	return c.b.GetMempoolEviction(txid)
+}
+
+func (c *blockChainWithMetrics) GetMempoolPackage(txid string) (v *bchain.MempoolPackage, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetMempoolPackage", s, err) }(time.Now())
+	return c.b.GetMempoolPackage(txid)
+}
+
 func (c *blockChainWithMetrics) GetChainParser() bchain.BlockChainParser {
 	return c.b.GetChainParser()
 }
@@ -6,15 +6,64 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	vlq "github.com/bsm/go-vlq"
 	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/jakm/btcutil"
 	"github.com/jakm/btcutil/chaincfg"
 	"github.com/jakm/btcutil/txscript"
 )
 
+// BitcoinSignedMessageMagic is the prefix of the messages signed by the signmessage RPC of Bitcoin Core
+const BitcoinSignedMessageMagic = "Bitcoin Signed Message:\n"
+
+// DefaultDustThresholdSat is the dust threshold of P2PKH output at the default dust relay fee of bitcoind (3000 sat/kB)
+const DefaultDustThresholdSat = 546
+
+const (
+	// SigNetMagic is the network magic of the default signet (BIP325)
+	SigNetMagic wire.BitcoinNet = 0x40cf030a
+	// TestNet4Magic is the network magic of testnet4 (BIP94)
+	TestNet4Magic wire.BitcoinNet = 0x283f161c
+)
+
+var (
+	// SigNetParams are the parameters of the default signet, the addresses have the same format as in testnet3
+	SigNetParams chaincfg.Params
+	// TestNet4Params are the parameters of testnet4, the addresses have the same format as in testnet3
+	TestNet4Params chaincfg.Params
+)
+
+func init() {
+	// the genesis blocks are not used by the parser, only their hashes are checked against the backend
+	SigNetParams = chaincfg.TestNet3Params
+	SigNetParams.Name = "signet"
+	SigNetParams.Net = SigNetMagic
+	SigNetParams.DefaultPort = "38333"
+	SigNetParams.GenesisBlock = nil
+	SigNetParams.GenesisHash = newHashFromStr("00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6")
+
+	TestNet4Params = chaincfg.TestNet3Params
+	TestNet4Params.Name = "testnet4"
+	TestNet4Params.Net = TestNet4Magic
+	TestNet4Params.DefaultPort = "48333"
+	TestNet4Params.GenesisBlock = nil
+	TestNet4Params.GenesisHash = newHashFromStr("00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043")
+}
+
+func newHashFromStr(s string) *chainhash.Hash {
+	h, err := chainhash.NewHashFromStr(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
 // OutputScriptToAddressesFunc converts ScriptPubKey to bitcoin addresses
 type OutputScriptToAddressesFunc func(script []byte) ([]string, bool, error)
 
@@ -23,6 +72,17 @@ type BitcoinParser struct {
 	*bchain.BaseParser
 	Params                      *chaincfg.Params
 	OutputScriptToAddressesFunc OutputScriptToAddressesFunc
+	// InitialSubsidy (in satoshi) is halved every SubsidyHalvingInterval blocks, zero values mean unknown emission schedule
+	InitialSubsidy         int64
+	SubsidyHalvingInterval uint32
+	// SignedMessageMagic prefixes the signed messages, empty value means that the message verification is not supported
+	SignedMessageMagic string
+	// PaymentURIScheme is the scheme of the BIP21 payment request URIs, empty value means that the URIs are not supported
+	PaymentURIScheme string
+	// DustThresholdSat is the value of the smallest output relayed by the backend
+	DustThresholdSat int64
+	// PaymentIDPrefix is the prefix of the OP_RETURN data carrying the payment id, empty value means that the coin has no payment id format
+	PaymentIDPrefix []byte
 }
 
 // NewBitcoinParser returns new BitcoinParser instance
@@ -33,27 +93,99 @@ func NewBitcoinParser(params *chaincfg.Params, c *Configuration) *BitcoinParser
 			AmountDecimalPoint:   8,
 		},
 		Params: params,
+		// the dust of P2PKH output at the default dust relay fee of bitcoind, inherited by most of the forks
+		DustThresholdSat: DefaultDustThresholdSat,
 	}
 	p.OutputScriptToAddressesFunc = p.outputScriptToAddresses
+	// the prefix is validated by NewBitcoinRPC
+	p.PaymentIDPrefix, _ = hex.DecodeString(c.PaymentIDPrefix)
+	// the forks of Bitcoin use their own copies of the parameters and must set their emission schedule
+	// and the magic of the signed messages explicitly
+	switch params {
+	case &chaincfg.MainNetParams, &chaincfg.TestNet3Params, &TestNet4Params, &SigNetParams:
+		p.InitialSubsidy, p.SubsidyHalvingInterval = 50*1e8, 210000
+		p.SignedMessageMagic = BitcoinSignedMessageMagic
+		p.PaymentURIScheme = "bitcoin"
+	case &chaincfg.RegressionNetParams:
+		p.InitialSubsidy, p.SubsidyHalvingInterval = 50*1e8, 150
+		p.SignedMessageMagic = BitcoinSignedMessageMagic
+		p.PaymentURIScheme = "bitcoin"
+	}
 	return p
 }
 
-// GetChainParams contains network parameters for the main Bitcoin network,
-// the regression test Bitcoin network, the test Bitcoin network and
-// the simulation test Bitcoin network, in this order
+// GetChainParams returns the network parameters for the chain name reported by getblockchaininfo of the backend -
+// main, test (testnet3), testnet4, signet or regtest, unknown names get the main network parameters
 func GetChainParams(chain string) *chaincfg.Params {
 	if !chaincfg.IsRegistered(&chaincfg.MainNetParams) {
 		chaincfg.RegisterBitcoinParams()
 	}
+	if !chaincfg.IsRegistered(&SigNetParams) {
+		err := chaincfg.Register(&SigNetParams)
+		if err == nil {
+			err = chaincfg.Register(&TestNet4Params)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
 	switch chain {
 	case "test":
 		return &chaincfg.TestNet3Params
+	case "testnet4":
+		return &TestNet4Params
+	case "signet":
+		return &SigNetParams
 	case "regtest":
 		return &chaincfg.RegressionNetParams
 	}
 	return &chaincfg.MainNetParams
 }
 
+// bip30Duplicates maps the coinbase transactions of the Bitcoin main chain, which duplicate txids of earlier coinbase transactions,
+// to the height of the block containing the duplicate (the earlier transactions are in blocks 91812 and 91722)
+var bip30Duplicates = map[string]uint32{
+	"d5d27987d2a3dfc724e359870c6644b40e497bdc0589a033220fe15429d88599": 91842,
+	"e3bf3d07d4b0375638d5f1db5255fe07ba2c4cb067cd81b84ee974b6585fb468": 91880,
+}
+
+// GetDuplicateTxids returns the duplicate coinbase transactions of the Bitcoin main chain and of the chains forked from it
+func (p *BitcoinParser) GetDuplicateTxids() map[string]uint32 {
+	if p.Params.GenesisHash != nil && p.Params.GenesisHash.IsEqual(chaincfg.MainNetParams.GenesisHash) {
+		return bip30Duplicates
+	}
+	return nil
+}
+
+// GetBlockSubsidy returns the subsidy of the block of given height, the initial subsidy is halved every SubsidyHalvingInterval blocks
+func (p *BitcoinParser) GetBlockSubsidy(height uint32) (*big.Int, error) {
+	if p.InitialSubsidy == 0 || p.SubsidyHalvingInterval == 0 {
+		return nil, bchain.ErrNotSupported
+	}
+	halvings := height / p.SubsidyHalvingInterval
+	if halvings >= 64 {
+		return big.NewInt(0), nil
+	}
+	return big.NewInt(p.InitialSubsidy >> halvings), nil
+}
+
+// GetEmissionSchedule returns the halving eras until the subsidy drops to zero
+func (p *BitcoinParser) GetEmissionSchedule() ([]bchain.EmissionEra, error) {
+	if p.InitialSubsidy == 0 || p.SubsidyHalvingInterval == 0 {
+		return nil, bchain.ErrNotSupported
+	}
+	var eras []bchain.EmissionEra
+	for i := uint32(0); i < 64 && p.InitialSubsidy>>i > 0; i++ {
+		e := bchain.EmissionEra{
+			FromHeight: i * p.SubsidyHalvingInterval,
+			ToHeight:   (i+1)*p.SubsidyHalvingInterval - 1,
+		}
+		e.Subsidy.SetInt64(p.InitialSubsidy >> i)
+		eras = append(eras, e)
+	}
+	return eras, nil
+}
+
 // GetAddrDescFromVout returns internal address representation (descriptor) of given transaction output
 func (p *BitcoinParser) GetAddrDescFromVout(output *bchain.Vout) (bchain.AddressDescriptor, error) {
 	ad, err := hex.DecodeString(output.ScriptPubKey.Hex)
@@ -93,6 +225,11 @@ func (p *BitcoinParser) addressToOutputScript(address string) ([]byte, error) {
 	return script, nil
 }
 
+// IsAddrDescUnspendable returns true for OP_RETURN outputs, which are provably unspendable
+func (p *BitcoinParser) IsAddrDescUnspendable(addrDesc bchain.AddressDescriptor) bool {
+	return len(addrDesc) > 0 && addrDesc[0] == txscript.OP_RETURN
+}
+
 // TryParseOPReturn tries to process OP_RETURN script and return its string representation
 func TryParseOPReturn(script []byte) string {
 	if len(script) > 1 && script[0] == txscript.OP_RETURN {
@@ -132,6 +269,50 @@ func TryParseOPReturn(script []byte) string {
 	return ""
 }
 
+// maxPaymentIDLen is the maximal length of the payment id following PaymentIDPrefix in the OP_RETURN data
+const maxPaymentIDLen = 32
+
+// PaymentIDsSupported returns true if the payment id format is given by PaymentIDPrefix
+func (p *BitcoinParser) PaymentIDsSupported() bool {
+	return len(p.PaymentIDPrefix) > 0
+}
+
+// GetOutputMemo returns the data of the OP_RETURN output with a single data push, the data is the memo if it is printable text,
+// the data starting by PaymentIDPrefix carries the payment id of at most maxPaymentIDLen bytes following the prefix
+func (p *BitcoinParser) GetOutputMemo(addrDesc bchain.AddressDescriptor) (*bchain.OutputMemo, error) {
+	if !p.IsAddrDescUnspendable(addrDesc) {
+		return nil, nil
+	}
+	tokens := tokenizeScript(addrDesc[1:])
+	if len(tokens) != 1 || tokens[0].op > txscript.OP_PUSHDATA4 || len(tokens[0].data) == 0 {
+		return nil, nil
+	}
+	data := tokens[0].data
+	// the push must be the rest of the script, tokenizeScript stops before a malformed push
+	header := 1
+	switch tokens[0].op {
+	case txscript.OP_PUSHDATA1:
+		header = 2
+	case txscript.OP_PUSHDATA2:
+		header = 3
+	case txscript.OP_PUSHDATA4:
+		header = 5
+	}
+	if 1+header+len(data) != len(addrDesc) {
+		return nil, nil
+	}
+	m := &bchain.OutputMemo{}
+	if utf8.Valid(data) && strings.IndexFunc(string(data), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		m.Memo = string(data)
+	}
+	if p.PaymentIDsSupported() && bytes.HasPrefix(data, p.PaymentIDPrefix) {
+		if id := data[len(p.PaymentIDPrefix):]; len(id) > 0 && len(id) <= maxPaymentIDLen {
+			m.PaymentID = id
+		}
+	}
+	return m, nil
+}
+
 // outputScriptToAddresses converts ScriptPubKey to addresses with a flag that the addresses are searchable
 func (p *BitcoinParser) outputScriptToAddresses(script []byte) ([]string, bool, error) {
 	sc, addresses, _, err := txscript.ExtractPkScriptAddrs(script, p.Params)
@@ -174,6 +355,12 @@ func (p *BitcoinParser) TxFromMsgTx(t *wire.MsgTx, parseAddresses bool) bchain.T
 			Sequence:  in.Sequence,
 			ScriptSig: s,
 		}
+		if len(in.Witness) > 0 {
+			vin[i].Witness = make([]string, len(in.Witness))
+			for j, w := range in.Witness {
+				vin[i].Witness[j] = hex.EncodeToString(w)
+			}
+		}
 	}
 	vout := make([]bchain.Vout, len(t.TxOut))
 	for i, out := range t.TxOut {
@@ -231,8 +418,12 @@ func (p *BitcoinParser) ParseBlock(b []byte) (*bchain.Block, error) {
 	}
 
 	txs := make([]bchain.Tx, len(w.Transactions))
+	sigOps := 0
 	for ti, t := range w.Transactions {
 		txs[ti] = p.TxFromMsgTx(t, false)
+		// virtual size as defined in BIP141, for non segwit transactions equal to the size
+		txs[ti].VSize = int64((t.SerializeSizeStripped()*3 + t.SerializeSize() + 3) / 4)
+		sigOps += legacySigOps(t)
 	}
 
 	return &bchain.Block{
@@ -240,10 +431,26 @@ func (p *BitcoinParser) ParseBlock(b []byte) (*bchain.Block, error) {
 			Size: len(b),
 			Time: w.Header.Timestamp.Unix(),
 		},
-		Txs: txs,
+		Txs:    txs,
+		Extra:  newBlockExtra(w.Header.Version, w.Header.Bits),
+		Weight: int64(w.SerializeSizeStripped()*3 + len(b)),
+		SigOps: int64(sigOps),
 	}, nil
 }
 
+// legacySigOps counts the signature operations in the scripts of the inputs and outputs of the transaction
+// the same way as GetLegacySigOpCount of bitcoind
+func legacySigOps(t *wire.MsgTx) int {
+	n := 0
+	for _, in := range t.TxIn {
+		n += txscript.GetSigOpCount(in.SignatureScript)
+	}
+	for _, out := range t.TxOut {
+		n += txscript.GetSigOpCount(out.PkScript)
+	}
+	return n
+}
+
 // PackTx packs transaction to byte array
 func (p *BitcoinParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) ([]byte, error) {
 	buf := make([]byte, 4+vlq.MaxLen64+len(tx.Hex)/2)
@@ -265,3 +472,16 @@ func (p *BitcoinParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
 
 	return tx, height, nil
 }
+
+// GetPaymentURIScheme returns the scheme of the BIP21 payment request URIs of the coin
+func (p *BitcoinParser) GetPaymentURIScheme() string {
+	return p.PaymentURIScheme
+}
+
+// GetDustThreshold returns the value of the smallest output relayed by the backend
+func (p *BitcoinParser) GetDustThreshold() *big.Int {
+	if p.DustThresholdSat <= 0 {
+		return nil
+	}
+	return big.NewInt(p.DustThresholdSat)
+}
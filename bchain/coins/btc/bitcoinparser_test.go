@@ -4,13 +4,18 @@ package btc
 
 import (
 	"blockbook/bchain"
+	"crypto/sha256"
 	"encoding/hex"
 	"math/big"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/jakm/btcutil"
 	"github.com/jakm/btcutil/chaincfg"
+	"github.com/jakm/btcutil/txscript"
 )
 
 func TestMain(m *testing.M) {
@@ -289,6 +294,10 @@ func init() {
 				Txid:     "c13e32a4428e31f85d7aee4ec7344504b12e72aaffcbde0160200d2ac7f0649d",
 				Vout:     0,
 				Sequence: 4294967295,
+				Witness: []string{
+					"3044022076aba4ad559616905fa51d4ddd357fc1fdb428d40cb388e042cdd1da4a1b7357022011916f90c712ead9a66d5f058252efd280439ad8956a967e95d437d246710bc901",
+					"02a80a5964c5612bb769ef73147b2cf3c149bc0fd4ecb02f8097629c94ab013ffd",
+				},
 			},
 		},
 		Vout: []bchain.Vout{
@@ -417,3 +426,658 @@ func Test_UnpackTx(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetDuplicateTxids(t *testing.T) {
+	mainnet := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	testnet := NewBitcoinParser(GetChainParams("test"), &Configuration{})
+	tests := []struct {
+		name   string
+		parser *BitcoinParser
+		txid   string
+		height uint32
+		want   bool
+	}{
+		{
+			name:   "duplicate in block 91842",
+			parser: mainnet,
+			txid:   "d5d27987d2a3dfc724e359870c6644b40e497bdc0589a033220fe15429d88599",
+			height: 91842,
+			want:   true,
+		},
+		{
+			name:   "original in block 91812",
+			parser: mainnet,
+			txid:   "d5d27987d2a3dfc724e359870c6644b40e497bdc0589a033220fe15429d88599",
+			height: 91812,
+			want:   false,
+		},
+		{
+			name:   "duplicate in block 91880",
+			parser: mainnet,
+			txid:   "e3bf3d07d4b0375638d5f1db5255fe07ba2c4cb067cd81b84ee974b6585fb468",
+			height: 91880,
+			want:   true,
+		},
+		{
+			name:   "testnet",
+			parser: testnet,
+			txid:   "e3bf3d07d4b0375638d5f1db5255fe07ba2c4cb067cd81b84ee974b6585fb468",
+			height: 91880,
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, found := tt.parser.GetDuplicateTxids()[tt.txid]
+			if got := found && h == tt.height; got != tt.want {
+				t.Errorf("GetDuplicateTxids()[%v] = %v, %v, want height %v %v", tt.txid, h, found, tt.height, tt.want)
+			}
+		})
+	}
+}
+
+func Test_IsAddrDescUnspendable(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	tests := []struct {
+		name   string
+		script string
+		want   bool
+	}{
+		{
+			name:   "OP_RETURN",
+			script: "6a072020f1686f6a20",
+			want:   true,
+		},
+		{
+			name:   "P2PKH",
+			script: "76a914be027bf3eac907bd4ac8cb9c5293b6f37662722088ac",
+			want:   false,
+		},
+		{
+			name: "empty",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.script)
+			if got := parser.IsAddrDescUnspendable(b); got != tt.want {
+				t.Errorf("IsAddrDescUnspendable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GetBlockSubsidy(t *testing.T) {
+	mainnet := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	regtest := NewBitcoinParser(GetChainParams("regtest"), &Configuration{})
+	tests := []struct {
+		name   string
+		parser *BitcoinParser
+		height uint32
+		want   int64
+	}{
+		{name: "genesis", parser: mainnet, height: 0, want: 5000000000},
+		{name: "last block of first era", parser: mainnet, height: 209999, want: 5000000000},
+		{name: "first halving", parser: mainnet, height: 210000, want: 2500000000},
+		{name: "fourth halving", parser: mainnet, height: 840000, want: 312500000},
+		{name: "last satoshi", parser: mainnet, height: 6929999, want: 1},
+		{name: "no subsidy", parser: mainnet, height: 6930000, want: 0},
+		{name: "regtest halving", parser: regtest, height: 150, want: 2500000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parser.GetBlockSubsidy(tt.height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Int64() != tt.want {
+				t.Errorf("GetBlockSubsidy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	eras, err := mainnet.GetEmissionSchedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eras) != 33 || eras[32].FromHeight != 6720000 || eras[32].ToHeight != 6929999 || eras[32].Subsidy.Int64() != 1 {
+		t.Errorf("GetEmissionSchedule() = %d eras, last %+v", len(eras), eras[len(eras)-1])
+	}
+	unknown := NewBitcoinParser(&chaincfg.Params{}, &Configuration{})
+	if _, err := unknown.GetBlockSubsidy(0); err != bchain.ErrNotSupported {
+		t.Errorf("GetBlockSubsidy() of unknown coin error = %v, want ErrNotSupported", err)
+	}
+}
+
+func Test_GetChainParams_TestNetworks(t *testing.T) {
+	tests := []struct {
+		chain   string
+		name    string
+		genesis string
+	}{
+		{chain: "signet", name: "signet", genesis: "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6"},
+		{chain: "testnet4", name: "testnet4", genesis: "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.chain, func(t *testing.T) {
+			params := GetChainParams(tt.chain)
+			if params.Name != tt.name || params.GenesisHash.String() != tt.genesis {
+				t.Errorf("GetChainParams(%v) = %v %v, want %v %v", tt.chain, params.Name, params.GenesisHash, tt.name, tt.genesis)
+			}
+			parser := NewBitcoinParser(params, &Configuration{})
+			got, err := parser.GetAddrDescFromAddress("tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := hex.EncodeToString(got); h != "0014751e76e8199196d454941c45d1b3a323f1433bd6" {
+				t.Errorf("GetAddrDescFromAddress() = %v", h)
+			}
+			subsidy, err := parser.GetBlockSubsidy(210000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subsidy.Int64() != 2500000000 {
+				t.Errorf("GetBlockSubsidy() = %v, want 2500000000", subsidy)
+			}
+		})
+	}
+}
+
+func Test_VerifyMessage(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	message := "This is an example of a signed message."
+	tests := []struct {
+		name      string
+		address   string
+		signature string
+		message   string
+		want      bool
+		wantErr   bool
+	}{
+		{
+			name:      "P2PKH compressed",
+			address:   "1Cat4aMgXiSobKFpxgvwjLZgKQcuct46PK",
+			signature: "Hyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message,
+			want:      true,
+		},
+		{
+			name:      "P2PKH uncompressed",
+			address:   "1EACHU4cbSaYY3NY1oMTJG7i5PP2VXbR6U",
+			signature: "Gyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message,
+			want:      true,
+		},
+		{
+			name:      "P2WPKH BIP137 header",
+			address:   "bc1q0ugmcpjt2zfre6ger5wr0lj4me4una57qtznxp",
+			signature: "Jyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message,
+			want:      true,
+		},
+		{
+			name:      "P2SH-P2WPKH BIP137 header",
+			address:   "33tadsAQtr8cgU7cCiuHzoNhhz8xFzmrX2",
+			signature: "Iyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message,
+			want:      true,
+		},
+		{
+			name:      "P2WPKH compressed key header",
+			address:   "bc1q0ugmcpjt2zfre6ger5wr0lj4me4una57qtznxp",
+			signature: "Hyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message,
+			want:      true,
+		},
+		{
+			name:      "uncompressed key of compressed address",
+			address:   "1Cat4aMgXiSobKFpxgvwjLZgKQcuct46PK",
+			signature: "Gyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message,
+			want:      false,
+		},
+		{
+			name:      "other address",
+			address:   "17RQ9ik2oSH8t4a8bYw9EztjWFxo2ZtoFK",
+			signature: "Hyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message,
+			want:      false,
+		},
+		{
+			name:      "other message",
+			address:   "1Cat4aMgXiSobKFpxgvwjLZgKQcuct46PK",
+			signature: "Hyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=",
+			message:   message + "!",
+			want:      false,
+		},
+		{
+			name:      "invalid signature",
+			address:   "1Cat4aMgXiSobKFpxgvwjLZgKQcuct46PK",
+			signature: "Hyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw",
+			message:   message,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrDesc, err := parser.GetAddrDescFromAddress(tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parser.VerifyMessage(addrDesc, tt.signature, tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	unknown := NewBitcoinParser(&chaincfg.Params{}, &Configuration{})
+	if _, err := unknown.VerifyMessage(nil, "", message); err != bchain.ErrNotSupported {
+		t.Errorf("VerifyMessage() of unknown coin error = %v, want ErrNotSupported", err)
+	}
+}
+
+func Test_ScanSilentPayments(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	curve := btcec.S256()
+	n := curve.Params().N
+	key := func(seed string) (*big.Int, []byte) {
+		h := sha256.Sum256([]byte(seed))
+		k := new(big.Int).SetBytes(h[:])
+		x, y := curve.ScalarBaseMult(k.Bytes())
+		return k, serializePoint(x, y)
+	}
+	senderKey, senderPubKey := key("sender")
+	scanKey, scanPubKey := key("scan")
+	_, spendPubKey := key("spend")
+	prevout := append([]byte{txscript.OP_0, txscript.OP_DATA_20}, btcutil.Hash160(senderPubKey)...)
+	inputTxid := "c13e32a4428e31f85d7aee4ec7344504b12e72aaffcbde0160200d2ac7f0649d"
+
+	// the outputs are created as by the sender, using the sender private key and the scan public key
+	txid, _ := hex.DecodeString(inputTxid)
+	outpoint := make([]byte, 36)
+	for i := range txid {
+		outpoint[31-i] = txid[i]
+	}
+	inputHash := new(big.Int).SetBytes(taggedHash("BIP0352/Inputs", outpoint, senderPubKey))
+	k := new(big.Int).Mul(inputHash, senderKey)
+	k.Mod(k, n)
+	bx, by := curve.ScalarMult(parseCompressedKey(scanPubKey).X, parseCompressedKey(scanPubKey).Y, k.Bytes())
+	sharedSecret := serializePoint(bx, by)
+	spend := parseCompressedKey(spendPubKey)
+	tweaks := make([][]byte, 2)
+	outputs := make([]string, 2)
+	for i := range tweaks {
+		tweaks[i] = taggedHash("BIP0352/SharedSecret", sharedSecret, []byte{0, 0, 0, byte(i)})
+		tx, ty := curve.ScalarBaseMult(tweaks[i])
+		px, _ := curve.Add(spend.X, spend.Y, tx, ty)
+		outputs[i] = "5120" + hex.EncodeToString(pad32(px))
+	}
+	tx := &bchain.Tx{
+		Vin: []bchain.Vin{
+			{
+				Txid:    inputTxid,
+				Vout:    0,
+				Witness: []string{"3044022076aba4ad559616905fa51d4ddd357fc1fdb428d40cb388e042cdd1da4a1b7357022011916f90c712ead9a66d5f058252efd280439ad8956a967e95d437d246710bc901", hex.EncodeToString(senderPubKey)},
+			},
+		},
+		Vout: []bchain.Vout{
+			{N: 0, ScriptPubKey: bchain.ScriptPubKey{Hex: outputs[1]}},
+			{N: 1, ScriptPubKey: bchain.ScriptPubKey{Hex: "51200000000000000000000000000000000000000000000000000000000000000001"}},
+			{N: 2, ScriptPubKey: bchain.ScriptPubKey{Hex: outputs[0]}},
+		},
+	}
+	prevouts := []bchain.AddressDescriptor{prevout}
+
+	got, err := parser.ScanSilentPayments(tx, prevouts, pad32(scanKey), spendPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bchain.SilentPaymentMatch{{Vout: 2, K: 0, Tweak: tweaks[0]}, {Vout: 0, K: 1, Tweak: tweaks[1]}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanSilentPayments() = %+v, want %+v", got, want)
+	}
+
+	otherScanKey, _ := key("other")
+	got, err = parser.ScanSilentPayments(tx, prevouts, pad32(otherScanKey), spendPubKey)
+	if err != nil || len(got) != 0 {
+		t.Errorf("ScanSilentPayments() with other scan key = %+v, %v, want no outputs", got, err)
+	}
+
+	// the uncompressed keys of the inputs are not used
+	tx.Vin[0].Witness[1] = "04" + tx.Vin[0].Witness[1][2:] + hex.EncodeToString(pad32(parseCompressedKey(senderPubKey).Y))
+	got, err = parser.ScanSilentPayments(tx, prevouts, pad32(scanKey), spendPubKey)
+	if err != nil || len(got) != 0 {
+		t.Errorf("ScanSilentPayments() with uncompressed input key = %+v, %v, want no outputs", got, err)
+	}
+
+	if _, err = parser.ScanSilentPayments(tx, nil, pad32(scanKey), spendPubKey); err == nil {
+		t.Error("ScanSilentPayments() without prevouts, want error")
+	}
+}
+
+func Test_DeriveMultisigAddrDescs(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	xpub := "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	tests := []struct {
+		name       string
+		descriptor string
+		from, to   uint32
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "sh multi with checksum",
+			descriptor: "sh(multi(2,022f01e5e15cca351daff3843fb70f3c2f0a1bdd05e5af888a67784ef3e10a2a01,03acd484e2f0c7f65309ad178a9f559abde09796974c57e714c35f110dfc27ccbe))#y9zthqta",
+			to:         10,
+			want:       []string{"a914a6a8b030a38762f4c1f5cbe387b61a3c5da5cd2687"},
+		},
+		{
+			name:       "wsh multi",
+			descriptor: "wsh(multi(2,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7,03774ae7f858a9411e5ef4246b70c65aac5649980be5c17891bbec17895da008cb,03d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a))",
+			want:       []string{"0020773d709598b76c4e3b575c08aad40658963f9322affc0f8c28d1d9a68d0c944a"},
+		},
+		{
+			name:       "sh wsh sortedmulti",
+			descriptor: "sh(wsh(sortedmulti(2,03d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7,03774ae7f858a9411e5ef4246b70c65aac5649980be5c17891bbec17895da008cb)))",
+			want:       []string{"a9143d3084f553409ebf90d10c2e73c71776dcb6d8c087"},
+		},
+		{
+			name:       "wildcard",
+			descriptor: "wsh(multi(1," + xpub + "/*))#g8522yev",
+			from:       1,
+			to:         2,
+			want:       []string{"002024ee6bf592cde435c8eb1150feb3559c333c6a8f043343e11015ffee712f0555"},
+		},
+		{
+			name:       "key origin and derivation path",
+			descriptor: "wsh(sortedmulti(1,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7,[d34db33f/48'/0'/0'/2']" + xpub + "/1))#3r4d753t",
+			want:       []string{"00203e288c80009e44d5a5be5fef7c019f83cf35ec78617b05573a5d599136bc6825"},
+		},
+		{
+			name:       "invalid checksum",
+			descriptor: "wsh(multi(1," + xpub + "/*))#g8522yew",
+			wantErr:    true,
+		},
+		{
+			name:       "hardened derivation",
+			descriptor: "wsh(multi(1," + xpub + "/1'/*))",
+			wantErr:    true,
+		},
+		{
+			name:       "too many required signatures",
+			descriptor: "wsh(multi(2,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7))",
+			wantErr:    true,
+		},
+		{
+			name:       "not multisig",
+			descriptor: "wpkh(03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7)",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.DeriveMultisigAddrDescs(tt.descriptor, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeriveMultisigAddrDescs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var h []string
+			for _, d := range got {
+				h = append(h, hex.EncodeToString(d))
+			}
+			if !reflect.DeepEqual(h, tt.want) {
+				t.Errorf("DeriveMultisigAddrDescs() = %v, want %v", h, tt.want)
+			}
+		})
+	}
+}
+
+func Test_DeriveAddrDescs(t *testing.T) {
+	parser := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	// the account keys of the test vectors of BIP44, BIP49, BIP84 and BIP86
+	xpub44 := "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	ypub49 := "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP"
+	zpub84 := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	xpub86 := "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+	tests := []struct {
+		name       string
+		descriptor string
+		from, to   uint32
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "pkh fixed derivation",
+			descriptor: "pkh(" + xpub44 + "/0/1)",
+			to:         10,
+			want:       []string{"76a9146ae1301cf44ca525751d1763ac4fef12d115398688ac"},
+		},
+		{
+			name:       "sh wpkh",
+			descriptor: "sh(wpkh(" + ypub49 + "/0/*))",
+			from:       1,
+			to:         2,
+			want:       []string{"a914d28f8c8309322c085021f00861f27c973bff03b787"},
+		},
+		{
+			name:       "wpkh with key origin",
+			descriptor: "wpkh([73c5da0a/84'/0'/0']" + zpub84 + "/0/*)",
+			to:         2,
+			want:       []string{"0014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e2", "00149c90f934ea51fa0f6504177043e0908da6929983"},
+		},
+		{
+			name:       "tr change",
+			descriptor: "tr(" + xpub86 + "/1/*)",
+			to:         1,
+			want:       []string{"5120882d74e5d0572d5a816cef0041a96b6c1de832f6f9676d9605c44d5e9a97d3dc"},
+		},
+		{
+			name:       "tr x-only key",
+			descriptor: "tr(cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115)",
+			want:       []string{"5120a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c"},
+		},
+		{
+			name:       "multisig",
+			descriptor: "wsh(multi(2,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7,03774ae7f858a9411e5ef4246b70c65aac5649980be5c17891bbec17895da008cb,03d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a))",
+			want:       []string{"0020773d709598b76c4e3b575c08aad40658963f9322affc0f8c28d1d9a68d0c944a"},
+		},
+		{
+			name:       "tr script tree",
+			descriptor: "tr(cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115,pk(03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7))",
+			wantErr:    true,
+		},
+		{
+			name:       "uncompressed key in segwit",
+			descriptor: "wpkh(0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8)",
+			wantErr:    true,
+		},
+		{
+			name:       "unsupported",
+			descriptor: "raw(6a)",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.DeriveAddrDescs(tt.descriptor, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeriveAddrDescs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var h []string
+			for _, d := range got {
+				h = append(h, hex.EncodeToString(d))
+			}
+			if !reflect.DeepEqual(h, tt.want) {
+				t.Errorf("DeriveAddrDescs() = %v, want %v", h, tt.want)
+			}
+		})
+	}
+}
+
+func TestBitcoinParser_BlockExtra(t *testing.T) {
+	p := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	tests := []struct {
+		name    string
+		version int32
+		bits    uint32
+		want    bchain.BlockExtra
+	}{
+		{
+			name:    "version bits",
+			version: 0x20000002,
+			bits:    0x1d00ffff,
+			want:    bchain.BlockExtra{"version": int32(0x20000002), "versionHex": "20000002", "bits": "1d00ffff", "difficulty": float64(1), "signalledBits": []int{1}},
+		},
+		{
+			name:    "no version bits",
+			version: 4,
+			bits:    0x1b0404cb,
+			want:    bchain.BlockExtra{"version": int32(4), "versionHex": "00000004", "bits": "1b0404cb", "difficulty": 16307.420938523983},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extra := newBlockExtra(tt.version, tt.bits)
+			if !reflect.DeepEqual(extra, tt.want) {
+				t.Errorf("newBlockExtra() = %+v, want %+v", extra, tt.want)
+			}
+			b, err := p.PackBlockExtra(extra)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != 8 {
+				t.Errorf("PackBlockExtra() = %x, want 8 bytes", b)
+			}
+			got, err := p.UnpackBlockExtra(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnpackBlockExtra() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if b, err := p.PackBlockExtra(nil); err != nil || b != nil {
+		t.Errorf("PackBlockExtra(nil) = %x, %v", b, err)
+	}
+	if _, err := p.PackBlockExtra(bchain.BlockExtra{"version": "x"}); err == nil {
+		t.Error("PackBlockExtra() expected error")
+	}
+}
+
+func Test_GetInscriptions(t *testing.T) {
+	p := NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	script := "20" + strings.Repeat("11", 32) + "ac" +
+		// text inscription with the content type tag pushed as data
+		"0063036f7264" + "0101" + "18746578742f706c61696e3b636861727365743d7574662d38" + "00" + "0d48656c6c6f2c20776f726c6421" + "68" +
+		// image inscription with the content type tag OP_1, pointer 1000 and the body in two pushes
+		"0063036f7264" + "51" + "09696d6167652f706e67" + "0102" + "02e803" + "00" + "0401020304" + "4c050506070809" + "68" +
+		// unterminated envelope
+		"0063036f7264" + "0101" + "0a746578742f68746d6c"
+	tx := &bchain.Tx{
+		Vin: []bchain.Vin{
+			{Witness: []string{strings.Repeat("22", 64), script, "c0" + strings.Repeat("33", 32)}},
+			// P2WPKH input
+			{Witness: []string{strings.Repeat("22", 71), "02" + strings.Repeat("44", 32)}},
+			// empty inscription in the script path spend with annex
+			{Witness: []string{"0063036f72640068", "c1" + strings.Repeat("55", 64), "50aa"}},
+			{},
+			// the body separated by the empty OP_PUSHDATA1
+			{Witness: []string{"0063036f7264" + "4c00" + "4c0401020304" + "68", "c0" + strings.Repeat("66", 32)}},
+		},
+	}
+	pointer := uint64(1000)
+	want := []bchain.InscriptionEnvelope{
+		{Index: 0, Input: 0, ContentType: "text/plain;charset=utf-8", ContentLength: 13},
+		{Index: 1, Input: 0, ContentType: "image/png", ContentLength: 9, Pointer: &pointer},
+		{Index: 2, Input: 2},
+		{Index: 3, Input: 4, ContentLength: 4},
+	}
+	got, err := p.GetInscriptions(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetInscriptions() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_GetOutputMemo(t *testing.T) {
+	// the payment id follows the prefix "pid:"
+	p := NewBitcoinParser(GetChainParams("main"), &Configuration{PaymentIDPrefix: "7069643a"})
+	tests := []struct {
+		name   string
+		script string
+		want   *bchain.OutputMemo
+	}{
+		{
+			name:   "text",
+			script: "6a0b696e766f6963652d343231",
+			want:   &bchain.OutputMemo{Memo: "invoice-421"},
+		},
+		{
+			name:   "text payment id",
+			script: "6a0f7069643a696e766f6963652d343231",
+			want:   &bchain.OutputMemo{Memo: "pid:invoice-421", PaymentID: []byte("invoice-421")},
+		},
+		{
+			name:   "binary payment id",
+			script: "6a0c7069643a0102030405060708",
+			want:   &bchain.OutputMemo{PaymentID: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		},
+		{
+			name:   "binary data without prefix",
+			script: "6a080102030405060708",
+			want:   &bchain.OutputMemo{},
+		},
+		{
+			name:   "prefix only",
+			script: "6a047069643a",
+			want:   &bchain.OutputMemo{Memo: "pid:"},
+		},
+		{
+			name:   "long text in OP_PUSHDATA1",
+			script: "6a4c28" + hex.EncodeToString([]byte("thanks for the coffee, see you next week")),
+			want:   &bchain.OutputMemo{Memo: "thanks for the coffee, see you next week"},
+		},
+		{
+			name:   "two pushes",
+			script: "6a01610162",
+		},
+		{
+			name:   "truncated push",
+			script: "6a0561626364",
+		},
+		{
+			name:   "empty OP_RETURN",
+			script: "6a",
+		},
+		{
+			name:   "P2PKH",
+			script: "76a914010d39800f86122416e28f485029acf77507169288ac",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.script)
+			got, err := p.GetOutputMemo(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetOutputMemo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	// without the prefix the coin has no payment id format
+	p = NewBitcoinParser(GetChainParams("main"), &Configuration{})
+	if p.PaymentIDsSupported() {
+		t.Error("PaymentIDsSupported() = true without payment_id_prefix")
+	}
+	b, _ := hex.DecodeString("6a080102030405060708")
+	if got, err := p.GetOutputMemo(b); err != nil || !reflect.DeepEqual(got, &bchain.OutputMemo{}) {
+		t.Errorf("GetOutputMemo() without prefix = %+v, %v", got, err)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/btcsuite/btcd/wire"
 
 	"github.com/golang/glog"
+	"github.com/jakm/btcutil/chaincfg"
 	"github.com/juju/errors"
 )
 
@@ -52,6 +53,12 @@ type Configuration struct {
 	AddressFormat            string `json:"address_format"`
 	SupportsEstimateFee      bool   `json:"supports_estimate_fee"`
 	SupportsEstimateSmartFee bool   `json:"supports_estimate_smart_fee"`
+	// Network is the expected chain of the backend as reported by getblockchaininfo (main, test, testnet4, signet or regtest),
+	// blockbook does not start connected to a backend of another chain, empty value accepts any chain
+	Network string `json:"network"`
+	// PaymentIDPrefix is the hex encoded prefix of the OP_RETURN data carrying the payment id, the payment id is the data following it,
+	// empty value means that the coin has no payment id format
+	PaymentIDPrefix string `json:"payment_id_prefix,omitempty"`
 }
 
 // NewBitcoinRPC returns new BitcoinRPC instance.
@@ -73,6 +80,9 @@ func NewBitcoinRPC(config json.RawMessage, pushHandler func(bchain.NotificationT
 	if c.MempoolSubWorkers < 1 {
 		c.MempoolSubWorkers = 1
 	}
+	if _, err = hex.DecodeString(c.PaymentIDPrefix); err != nil {
+		return nil, errors.Annotatef(err, "Invalid payment_id_prefix")
+	}
 	// btc supports both calls, other coins overriding BitcoinRPC can change this
 	c.SupportsEstimateFee = true
 	c.SupportsEstimateSmartFee = true
@@ -129,11 +139,19 @@ func (b *BitcoinRPC) Initialize() error {
 		return err
 	}
 
+	if b.ChainConfig.Network != "" && b.ChainConfig.Network != chainName {
+		return errors.Errorf("The backend is connected to chain %v, expected %v", chainName, b.ChainConfig.Network)
+	}
+
 	params := GetChainParams(chainName)
 
 	// always create parser
 	b.Parser = NewBitcoinParser(params, b.ChainConfig)
 
+	if err = CheckGenesisHash(b, params); err != nil {
+		return err
+	}
+
 	// parameters for getInfo request
 	if params.Net == wire.MainNet {
 		b.Testnet = false
@@ -148,6 +166,22 @@ func (b *BitcoinRPC) Initialize() error {
 	return nil
 }
 
+// CheckGenesisHash checks that the first block of the backend is the genesis block of the network parameters,
+// so that the index is not built with the parameters of another network
+func CheckGenesisHash(bc bchain.BlockChain, params *chaincfg.Params) error {
+	if params.GenesisHash == nil {
+		return nil
+	}
+	hash, err := bc.GetBlockHash(0)
+	if err != nil {
+		return errors.Annotatef(err, "GetBlockHash 0")
+	}
+	if hash != params.GenesisHash.String() {
+		return errors.Errorf("The genesis block of the backend %v does not match the genesis block %v of the network %v", hash, params.GenesisHash, params.Name)
+	}
+	return nil
+}
+
 func (b *BitcoinRPC) Shutdown(ctx context.Context) error {
 	if b.mq != nil {
 		if err := b.mq.Shutdown(ctx); err != nil {
@@ -371,6 +405,18 @@ type ResSendRawTransaction struct {
 	Result string           `json:"result"`
 }
 
+// testmempoolaccept
+
+type CmdTestMempoolAccept struct {
+	Method string     `json:"method"`
+	Params [][]string `json:"params"`
+}
+
+type ResTestMempoolAccept struct {
+	Error  *bchain.RPCError             `json:"error"`
+	Result []bchain.MempoolAcceptResult `json:"result"`
+}
+
 // getmempoolentry
 
 type CmdGetMempoolEntry struct {
@@ -717,6 +763,21 @@ func (b *BitcoinRPC) GetMempoolTransactionsForAddrDesc(addrDesc bchain.AddressDe
 	return b.Mempool.GetAddrDescTransactions(addrDesc)
 }
 
+// TrackMempoolEvictions enables the tracking of the transactions removed from the mempool without being confirmed
+func (b *BitcoinRPC) TrackMempoolEvictions(isConfirmed bchain.IsTxConfirmedFunc, isSpent bchain.IsOutpointSpentFunc, onEviction bchain.OnMempoolEvictionFunc) {
+	b.Mempool.TrackEvictions(isConfirmed, isSpent, onEviction)
+}
+
+// GetMempoolEviction returns the record of the transaction removed from the mempool without being confirmed
+func (b *BitcoinRPC) GetMempoolEviction(txid string) (*bchain.MempoolEviction, error) {
+	return b.Mempool.GetEviction(txid), nil
+}
+
+// GetMempoolPackage returns the package of the unconfirmed ancestors and descendants of the mempool transaction
+func (b *BitcoinRPC) GetMempoolPackage(txid string) (*bchain.MempoolPackage, error) {
+	return b.Mempool.GetPackage(txid), nil
+}
+
 // EstimateSmartFee returns fee estimation
 func (b *BitcoinRPC) EstimateSmartFee(blocks int, conservative bool) (big.Int, error) {
 	// use EstimateFee if EstimateSmartFee is not supported
@@ -796,6 +857,37 @@ func (b *BitcoinRPC) SendRawTransaction(tx string) (string, error) {
 	return res.Result, nil
 }
 
+// GetErc20ContractInfo is not supported by UTXO chains
+func (b *BitcoinRPC) GetErc20ContractInfo(contractDesc bchain.AddressDescriptor) (*bchain.Erc20Contract, error) {
+	return nil, bchain.ErrNotSupported
+}
+
+// IsContract is not supported by UTXO chains
+func (b *BitcoinRPC) IsContract(addrDesc bchain.AddressDescriptor) (bool, error) {
+	return false, bchain.ErrNotSupported
+}
+
+// TestMempoolAccept checks if the raw transaction would be accepted to the mempool, the backend must support testmempoolaccept
+func (b *BitcoinRPC) TestMempoolAccept(tx string) (*bchain.MempoolAcceptResult, error) {
+	glog.V(1).Info("rpc: testmempoolaccept")
+
+	res := ResTestMempoolAccept{}
+	req := CmdTestMempoolAccept{Method: "testmempoolaccept"}
+	req.Params = [][]string{{tx}}
+	err := b.Call(&req, &res)
+
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(res.Result) != 1 {
+		return nil, errors.Errorf("testmempoolaccept: unexpected number of results %d", len(res.Result))
+	}
+	return &res.Result[0], nil
+}
+
 // GetMempoolEntry returns mempool data for given transaction
 func (b *BitcoinRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error) {
 	glog.V(1).Info("rpc: getmempoolentry")
@@ -0,0 +1,99 @@
+package btc
+
+import (
+	"blockbook/bchain"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"github.com/juju/errors"
+)
+
+// the chain specific fields of the blocks of bitcoin-like coins taken from the block header
+const (
+	blockExtraVersion = "version"
+	blockExtraBits    = "bits"
+)
+
+// versionBitsTopMask and versionBitsTopBits identify the block versions signalling the soft forks by version bits (BIP9)
+const (
+	versionBitsTopMask = 0xe0000000
+	versionBitsTopBits = 0x20000000
+)
+
+// difficultyFromBits computes the difficulty from the compact target the same way as bitcoind
+func difficultyFromBits(bits uint32) float64 {
+	mantissa := bits & 0x00ffffff
+	if mantissa == 0 {
+		return 0
+	}
+	shift := (bits >> 24) & 0xff
+	diff := float64(0x0000ffff) / float64(mantissa)
+	for ; shift < 29; shift++ {
+		diff *= 256
+	}
+	for ; shift > 29; shift-- {
+		diff /= 256
+	}
+	return diff
+}
+
+// signalledBits returns the version bits (BIP9) signalled by the block version
+func signalledBits(version int32) []int {
+	v := uint32(version)
+	if v&versionBitsTopMask != versionBitsTopBits {
+		return nil
+	}
+	var bits []int
+	for i := 0; i < 29; i++ {
+		if v&(1<<uint(i)) != 0 {
+			bits = append(bits, i)
+		}
+	}
+	return bits
+}
+
+// newBlockExtra returns the version of the block with the signalled version bits, the bits and the difficulty
+func newBlockExtra(version int32, bits uint32) bchain.BlockExtra {
+	extra := bchain.BlockExtra{
+		blockExtraVersion: version,
+		"versionHex":      fmt.Sprintf("%08x", uint32(version)),
+		blockExtraBits:    fmt.Sprintf("%08x", bits),
+		"difficulty":      difficultyFromBits(bits),
+	}
+	if sb := signalledBits(version); len(sb) > 0 {
+		extra["signalledBits"] = sb
+	}
+	return extra
+}
+
+// PackBlockExtra packs the version and the bits of the block header, the other fields are derived from them
+func (p *BitcoinParser) PackBlockExtra(extra bchain.BlockExtra) ([]byte, error) {
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	version, ok := extra[blockExtraVersion].(int32)
+	if !ok {
+		return nil, errors.Errorf("Invalid block extra field %v: %v", blockExtraVersion, extra[blockExtraVersion])
+	}
+	b, _ := extra[blockExtraBits].(string)
+	bits, err := strconv.ParseUint(b, 16, 32)
+	if err != nil {
+		return nil, errors.Errorf("Invalid block extra field %v: %v", blockExtraBits, extra[blockExtraBits])
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint32(buf, uint32(version))
+	binary.BigEndian.PutUint32(buf[4:], uint32(bits))
+	return buf, nil
+}
+
+// UnpackBlockExtra returns the version of the block with the signalled version bits, the bits and the difficulty
+func (p *BitcoinParser) UnpackBlockExtra(buf []byte) (bchain.BlockExtra, error) {
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if len(buf) < 8 {
+		return nil, errors.New("Invalid block extra fields")
+	}
+	return newBlockExtra(int32(binary.BigEndian.Uint32(buf)), binary.BigEndian.Uint32(buf[4:])), nil
+}
@@ -0,0 +1,146 @@
+package btc
+
+import (
+	"blockbook/bchain"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/jakm/btcutil"
+	"github.com/jakm/btcutil/txscript"
+	"github.com/juju/errors"
+)
+
+type singleKeyType int
+
+const (
+	singleKeyPkh singleKeyType = iota
+	singleKeyWpkh
+	singleKeyShWpkh
+	singleKeyTr
+)
+
+// singleKeyDescriptor is the output descriptor of the outputs paying to one key
+type singleKeyDescriptor struct {
+	typ singleKeyType
+	key descriptorKey
+}
+
+// parseSingleKeyDescriptor parses the descriptor pkh(), wpkh(), sh(wpkh()) or tr() with the key only (no script tree),
+// the checksum is verified if present; it returns nil without error if the descriptor is not of these types
+func parseSingleKeyDescriptor(descriptor string) (*singleKeyDescriptor, error) {
+	d, err := stripDescriptorChecksum(descriptor)
+	if err != nil {
+		return nil, err
+	}
+	sd := &singleKeyDescriptor{}
+	switch {
+	case strings.HasPrefix(d, "pkh(") && strings.HasSuffix(d, ")"):
+		sd.typ, d = singleKeyPkh, d[4:len(d)-1]
+	case strings.HasPrefix(d, "wpkh(") && strings.HasSuffix(d, ")"):
+		sd.typ, d = singleKeyWpkh, d[5:len(d)-1]
+	case strings.HasPrefix(d, "sh(wpkh(") && strings.HasSuffix(d, "))"):
+		sd.typ, d = singleKeyShWpkh, d[8:len(d)-2]
+	case strings.HasPrefix(d, "tr(") && strings.HasSuffix(d, ")"):
+		sd.typ, d = singleKeyTr, d[3:len(d)-1]
+		if strings.IndexByte(d, ',') >= 0 {
+			return nil, errors.New("Taproot descriptors with script tree are not supported")
+		}
+		// the x-only key is the key with the even y coordinate
+		if len(d) == 64 && !strings.ContainsAny(d, "/[]") {
+			d = "02" + d
+		}
+	default:
+		return nil, nil
+	}
+	k, err := parseDescriptorKey(d)
+	if err != nil {
+		return nil, err
+	}
+	if sd.typ != singleKeyPkh && len(k.pubKey) == 65 {
+		return nil, errors.New("Uncompressed keys are not allowed in segwit descriptors")
+	}
+	sd.key = *k
+	return sd, nil
+}
+
+// taprootOutputKey returns the x coordinate of the taproot output key tweaked by the hash of the internal key
+// without the script tree, as defined by BIP86
+func taprootOutputKey(internalKey []byte) ([]byte, error) {
+	pk, err := btcec.ParsePubKey(internalKey, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	curve := btcec.S256()
+	x, y := pk.X, pk.Y
+	// the internal key is used with the even y coordinate
+	if y.Bit(0) == 1 {
+		y = new(big.Int).Sub(curve.P, y)
+	}
+	t := taggedHash("TapTweak", pad32(x))
+	if new(big.Int).SetBytes(t).Cmp(curve.N) >= 0 {
+		return nil, errors.New("Invalid taproot tweak")
+	}
+	tx, ty := curve.ScalarBaseMult(t)
+	qx, _ := curve.Add(x, y, tx, ty)
+	return pad32(qx), nil
+}
+
+// outputScript returns the output script paying to the key derived by the index
+func (sd *singleKeyDescriptor) outputScript(index uint32) ([]byte, error) {
+	key, err := sd.key.derive(index)
+	if err != nil {
+		return nil, err
+	}
+	switch sd.typ {
+	case singleKeyPkh:
+		script := append([]byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}, btcutil.Hash160(key)...)
+		return append(script, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG), nil
+	case singleKeyWpkh:
+		return append([]byte{txscript.OP_0, txscript.OP_DATA_20}, btcutil.Hash160(key)...), nil
+	case singleKeyShWpkh:
+		redeem := append([]byte{txscript.OP_0, txscript.OP_DATA_20}, btcutil.Hash160(key)...)
+		return append(append([]byte{txscript.OP_HASH160, txscript.OP_DATA_20}, btcutil.Hash160(redeem)...), txscript.OP_EQUAL), nil
+	default:
+		q, err := taprootOutputKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{txscript.OP_1, txscript.OP_DATA_32}, q...), nil
+	}
+}
+
+// DeriveAddrDescs returns the address descriptors (output scripts) of the output descriptor for the indexes in the range [from, to),
+// the descriptors pkh(), wpkh(), sh(wpkh()), tr() with the key only and the multisig descriptors are supported;
+// the descriptor without the wildcard describes a single output regardless of the range
+func (p *BitcoinParser) DeriveAddrDescs(descriptor string, from, to uint32) ([]bchain.AddressDescriptor, error) {
+	sd, err := parseSingleKeyDescriptor(descriptor)
+	if err != nil {
+		return nil, err
+	}
+	if sd == nil {
+		if !strings.Contains(descriptor, "multi(") {
+			return nil, errors.New("Unsupported descriptor, expecting pkh(), wpkh(), sh(wpkh()), tr() or a multisig descriptor")
+		}
+		return p.DeriveMultisigAddrDescs(descriptor, from, to)
+	}
+	if !sd.key.wildcard {
+		s, err := sd.outputScript(0)
+		if err != nil {
+			return nil, err
+		}
+		return []bchain.AddressDescriptor{s}, nil
+	}
+	if to < from {
+		return nil, errors.New("Invalid derivation range")
+	}
+	r := make([]bchain.AddressDescriptor, 0, to-from)
+	for i := from; i < to; i++ {
+		s, err := sd.outputScript(i)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, s)
+	}
+	return r, nil
+}
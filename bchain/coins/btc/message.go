@@ -0,0 +1,71 @@
+package btc
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"encoding/base64"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/jakm/btcutil"
+	"github.com/jakm/btcutil/txscript"
+	"github.com/juju/errors"
+)
+
+// compactSignatureLen is the length of the signature of message, 1 byte header followed by 32 bytes R and 32 bytes S
+const compactSignatureLen = 65
+
+// signedMessageHash returns the double sha256 hash of the message prefixed by the magic of the coin
+func (p *BitcoinParser) signedMessageHash(message string) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, p.SignedMessageMagic)
+	wire.WriteVarString(&buf, 0, message)
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// VerifyMessage verifies the base64 encoded signature of the message created by the signmessage RPC of the backend
+// or by the wallets, which use BIP137 headers for the segwit addresses. The key recovered from the signature is compared
+// with P2PKH address, compressed keys also with P2WPKH and P2SH-P2WPKH addresses regardless of the header
+func (p *BitcoinParser) VerifyMessage(addrDesc bchain.AddressDescriptor, signature, message string) (bool, error) {
+	if p.SignedMessageMagic == "" {
+		return false, bchain.ErrNotSupported
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != compactSignatureLen {
+		return false, errors.New("Invalid signature, expecting base64 encoded 65 bytes")
+	}
+	h := sig[0]
+	switch {
+	case h >= 27 && h <= 34:
+	case h >= 35 && h <= 42:
+		// BIP137 headers of segwit addresses are converted to the headers of compressed keys
+		sig[0] = 31 + (h-35)%4
+	default:
+		return false, errors.Errorf("Invalid signature header %d", h)
+	}
+	pub, compressed, err := btcec.RecoverCompact(btcec.S256(), sig, p.signedMessageHash(message))
+	if err != nil {
+		return false, nil
+	}
+	var pk []byte
+	if compressed {
+		pk = pub.SerializeCompressed()
+	} else {
+		pk = pub.SerializeUncompressed()
+	}
+	keyHash := btcutil.Hash160(pk)
+	scripts := [][]byte{
+		append(append([]byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}, keyHash...), txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG),
+	}
+	if compressed {
+		wpkh := append([]byte{txscript.OP_0, txscript.OP_DATA_20}, keyHash...)
+		scripts = append(scripts, wpkh, append(append([]byte{txscript.OP_HASH160, txscript.OP_DATA_20}, btcutil.Hash160(wpkh)...), txscript.OP_EQUAL))
+	}
+	for _, s := range scripts {
+		if bytes.Equal(addrDesc, s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
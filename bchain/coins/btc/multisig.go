@@ -0,0 +1,302 @@
+package btc
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jakm/btcutil"
+	"github.com/jakm/btcutil/hdkeychain"
+	"github.com/jakm/btcutil/txscript"
+	"github.com/juju/errors"
+)
+
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	// maxShMultisigKeys and maxWshMultisigKeys are the limits of the number of keys of the multisig script enforced by Bitcoin Core
+	maxShMultisigKeys  = 15
+	maxWshMultisigKeys = 20
+	maxRedeemScriptLen = 520
+)
+
+var descriptorGenerator = [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+
+func descriptorPolymod(c uint64, v int) uint64 {
+	c0 := c >> 35
+	c = ((c & 0x7ffffffff) << 5) ^ uint64(v)
+	for i := uint(0); i < 5; i++ {
+		if (c0>>i)&1 != 0 {
+			c ^= descriptorGenerator[i]
+		}
+	}
+	return c
+}
+
+// descriptorChecksum computes the checksum of the output descriptor as defined by BIP380
+func descriptorChecksum(desc string) (string, error) {
+	c := uint64(1)
+	cls, clsCount := 0, 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(descriptorInputCharset, ch)
+		if pos < 0 {
+			return "", errors.Errorf("Invalid character %q in descriptor", ch)
+		}
+		c = descriptorPolymod(c, pos&31)
+		cls = cls*3 + pos>>5
+		if clsCount++; clsCount == 3 {
+			c = descriptorPolymod(c, cls)
+			cls, clsCount = 0, 0
+		}
+	}
+	if clsCount > 0 {
+		c = descriptorPolymod(c, cls)
+	}
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+	r := make([]byte, 8)
+	for i := range r {
+		r[i] = descriptorChecksumCharset[(c>>(5*(7-uint(i))))&31]
+	}
+	return string(r), nil
+}
+
+type multisigWrapper int
+
+const (
+	multisigSh multisigWrapper = iota
+	multisigWsh
+	multisigShWsh
+)
+
+// descriptorKey is a fixed public key or an extended public key, from which the keys are derived by the path
+// (already applied to parent) and optionally by the wildcard index
+type descriptorKey struct {
+	pubKey   []byte
+	parent   *hdkeychain.ExtendedKey
+	wildcard bool
+}
+
+type multisigDescriptor struct {
+	wrapper  multisigWrapper
+	sorted   bool
+	required int
+	keys     []descriptorKey
+}
+
+func parseDescriptorKey(s string) (*descriptorKey, error) {
+	if strings.HasPrefix(s, "[") {
+		// the key origin is informative only
+		i := strings.IndexByte(s, ']')
+		if i < 0 {
+			return nil, errors.Errorf("Invalid key origin in %v", s)
+		}
+		s = s[i+1:]
+	}
+	parts := strings.Split(s, "/")
+	if b, err := hex.DecodeString(parts[0]); err == nil {
+		if len(parts) > 1 {
+			return nil, errors.Errorf("Derivation path of a fixed key %v", s)
+		}
+		if (len(b) != 33 || (b[0] != 2 && b[0] != 3)) && (len(b) != 65 || b[0] != 4) {
+			return nil, errors.Errorf("Invalid public key %v", parts[0])
+		}
+		return &descriptorKey{pubKey: b}, nil
+	}
+	k, err := hdkeychain.NewKeyFromString(parts[0])
+	if err != nil {
+		return nil, errors.Annotatef(err, "key %v", parts[0])
+	}
+	if k.IsPrivate() {
+		return nil, errors.New("Private keys are not accepted")
+	}
+	dk := &descriptorKey{}
+	for i, p := range parts[1:] {
+		if p == "*" && i == len(parts)-2 {
+			dk.wildcard = true
+			break
+		}
+		if strings.HasSuffix(p, "'") || strings.HasSuffix(p, "h") {
+			return nil, errors.Errorf("Hardened derivation %v is not possible from extended public key", p)
+		}
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil || n >= hdkeychain.HardenedKeyStart {
+			return nil, errors.Errorf("Invalid derivation path element %v", p)
+		}
+		if k, err = k.Child(uint32(n)); err != nil {
+			return nil, errors.Annotatef(err, "derivation path element %v", p)
+		}
+	}
+	dk.parent = k
+	return dk, nil
+}
+
+// derive returns the public key derived by the index, the index is used only by the key with the wildcard
+func (k *descriptorKey) derive(index uint32) ([]byte, error) {
+	if k.parent == nil {
+		return k.pubKey, nil
+	}
+	ek := k.parent
+	if k.wildcard {
+		var err error
+		if ek, err = ek.Child(index); err != nil {
+			return nil, errors.Annotatef(err, "index %v", index)
+		}
+	}
+	pk, err := ek.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return pk.SerializeCompressed(), nil
+}
+
+// stripDescriptorChecksum verifies the checksum of the descriptor if present and returns the descriptor without it
+func stripDescriptorChecksum(descriptor string) (string, error) {
+	d := strings.TrimSpace(descriptor)
+	if i := strings.IndexByte(d, '#'); i >= 0 {
+		sum, err := descriptorChecksum(d[:i])
+		if err != nil {
+			return "", err
+		}
+		if d[i+1:] != sum {
+			return "", errors.Errorf("Invalid descriptor checksum %v, expected %v", d[i+1:], sum)
+		}
+		return d[:i], nil
+	}
+	if _, err := descriptorChecksum(d); err != nil {
+		return "", err
+	}
+	return d, nil
+}
+
+// parseMultisigDescriptor parses the descriptor sh(multi()), wsh(multi()) or sh(wsh(multi())) or their sortedmulti variants,
+// the checksum is verified if present
+func parseMultisigDescriptor(descriptor string) (*multisigDescriptor, error) {
+	d, err := stripDescriptorChecksum(descriptor)
+	if err != nil {
+		return nil, err
+	}
+	m := &multisigDescriptor{}
+	switch {
+	case strings.HasPrefix(d, "sh(wsh(") && strings.HasSuffix(d, "))"):
+		m.wrapper, d = multisigShWsh, d[7:len(d)-2]
+	case strings.HasPrefix(d, "wsh(") && strings.HasSuffix(d, ")"):
+		m.wrapper, d = multisigWsh, d[4:len(d)-1]
+	case strings.HasPrefix(d, "sh(") && strings.HasSuffix(d, ")"):
+		m.wrapper, d = multisigSh, d[3:len(d)-1]
+	default:
+		return nil, errors.New("Unsupported descriptor, expecting sh(multi()), wsh(multi()), sh(wsh(multi())) or their sortedmulti variants")
+	}
+	switch {
+	case strings.HasPrefix(d, "multi(") && strings.HasSuffix(d, ")"):
+		d = d[6 : len(d)-1]
+	case strings.HasPrefix(d, "sortedmulti(") && strings.HasSuffix(d, ")"):
+		m.sorted, d = true, d[12:len(d)-1]
+	default:
+		return nil, errors.New("Unsupported descriptor, expecting multi() or sortedmulti()")
+	}
+	args := strings.Split(d, ",")
+	keys := args[1:]
+	maxKeys := maxWshMultisigKeys
+	if m.wrapper == multisigSh {
+		maxKeys = maxShMultisigKeys
+	}
+	if len(keys) == 0 || len(keys) > maxKeys {
+		return nil, errors.Errorf("Invalid number of keys %d, expecting 1-%d", len(keys), maxKeys)
+	}
+	if m.required, err = strconv.Atoi(args[0]); err != nil || m.required < 1 || m.required > len(keys) {
+		return nil, errors.Errorf("Invalid number of required signatures %v", args[0])
+	}
+	m.keys = make([]descriptorKey, len(keys))
+	for i, s := range keys {
+		k, err := parseDescriptorKey(s)
+		if err != nil {
+			return nil, err
+		}
+		if m.wrapper != multisigSh && len(k.pubKey) == 65 {
+			return nil, errors.New("Uncompressed keys are not allowed in segwit descriptors")
+		}
+		m.keys[i] = *k
+	}
+	return m, nil
+}
+
+// isRange returns true if any key of the descriptor contains the wildcard
+func (m *multisigDescriptor) isRange() bool {
+	for i := range m.keys {
+		if m.keys[i].wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+func appendScriptInt(s []byte, n int) []byte {
+	if n <= 16 {
+		return append(s, byte(txscript.OP_1-1+n))
+	}
+	return append(s, txscript.OP_DATA_1, byte(n))
+}
+
+// outputScript returns the output script of the multisig with the keys derived by the index
+func (m *multisigDescriptor) outputScript(index uint32) ([]byte, error) {
+	keys := make([][]byte, len(m.keys))
+	for i := range m.keys {
+		var err error
+		if keys[i], err = m.keys[i].derive(index); err != nil {
+			return nil, err
+		}
+	}
+	if m.sorted {
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	}
+	script := appendScriptInt(nil, m.required)
+	for _, k := range keys {
+		script = append(append(script, byte(len(k))), k...)
+	}
+	script = append(appendScriptInt(script, len(keys)), txscript.OP_CHECKMULTISIG)
+	if m.wrapper != multisigSh {
+		h := sha256.Sum256(script)
+		script = append([]byte{txscript.OP_0, txscript.OP_DATA_32}, h[:]...)
+		if m.wrapper == multisigWsh {
+			return script, nil
+		}
+	} else if len(script) > maxRedeemScriptLen {
+		return nil, errors.New("Redeem script exceeds 520 bytes")
+	}
+	return append(append([]byte{txscript.OP_HASH160, txscript.OP_DATA_20}, btcutil.Hash160(script)...), txscript.OP_EQUAL), nil
+}
+
+// DeriveMultisigAddrDescs returns the address descriptors (output scripts) of the multisig descriptor
+// for the indexes in the range [from, to), only unhardened derivation from the extended public keys is possible
+func (p *BitcoinParser) DeriveMultisigAddrDescs(descriptor string, from, to uint32) ([]bchain.AddressDescriptor, error) {
+	m, err := parseMultisigDescriptor(descriptor)
+	if err != nil {
+		return nil, err
+	}
+	if !m.isRange() {
+		s, err := m.outputScript(0)
+		if err != nil {
+			return nil, err
+		}
+		return []bchain.AddressDescriptor{s}, nil
+	}
+	if to < from {
+		return nil, errors.New("Invalid derivation range")
+	}
+	r := make([]bchain.AddressDescriptor, 0, to-from)
+	for i := from; i < to; i++ {
+		s, err := m.outputScript(i)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, s)
+	}
+	return r, nil
+}
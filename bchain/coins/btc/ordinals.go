@@ -0,0 +1,182 @@
+package btc
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/jakm/btcutil/txscript"
+)
+
+// the tags of the fields of the inscription envelope, the body follows the empty tag
+const (
+	inscriptionTagContentType = 1
+	inscriptionTagPointer     = 2
+)
+
+// taprootAnnexTag is the first byte of the optional annex, the last element of the witness of taproot input
+const taprootAnnexTag = 0x50
+
+var inscriptionProtocolID = []byte("ord")
+
+// scriptToken is an opcode of a script, push is true for the opcodes pushing data (including OP_0 and OP_1-OP_16)
+type scriptToken struct {
+	op   byte
+	push bool
+	data []byte
+}
+
+// tokenizeScript splits the script to opcodes, the tokens until the first malformed push are returned
+func tokenizeScript(script []byte) []scriptToken {
+	var tokens []scriptToken
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+		t := scriptToken{op: op}
+		var l int
+		switch {
+		case op == txscript.OP_0:
+			t.push = true
+		case op < txscript.OP_PUSHDATA1:
+			l = int(op)
+		case op == txscript.OP_PUSHDATA1 || op == txscript.OP_PUSHDATA2 || op == txscript.OP_PUSHDATA4:
+			ll := 1 << (op - txscript.OP_PUSHDATA1)
+			if i+ll > len(script) {
+				return tokens
+			}
+			// the push of zero length is a push of empty data like OP_0
+			t.push = true
+			switch ll {
+			case 1:
+				l = int(script[i])
+			case 2:
+				l = int(binary.LittleEndian.Uint16(script[i:]))
+			case 4:
+				l = int(binary.LittleEndian.Uint32(script[i:]))
+			}
+			i += ll
+		case op >= txscript.OP_1 && op <= txscript.OP_16:
+			t.push = true
+			t.data = []byte{op - txscript.OP_1 + 1}
+		}
+		if l != 0 {
+			if l < 0 || i+l > len(script) {
+				return tokens
+			}
+			t.push = true
+			t.data = script[i : i+l]
+			i += l
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// tapscript returns the leaf script of the taproot script path spend given by the witness, or nil for other witnesses
+func tapscript(witness [][]byte) []byte {
+	if len(witness) >= 2 && len(witness[len(witness)-1]) > 0 && witness[len(witness)-1][0] == taprootAnnexTag {
+		witness = witness[:len(witness)-1]
+	}
+	if len(witness) < 2 {
+		return nil
+	}
+	cb := witness[len(witness)-1]
+	if len(cb) < 33 || (len(cb)-33)%32 != 0 || cb[0]&0xfe != 0xc0 {
+		return nil
+	}
+	return witness[len(witness)-2]
+}
+
+// parseInscriptionEnvelopes returns the inscriptions in the envelopes OP_FALSE OP_IF "ord" <tag> <value> ... OP_0 <body> ... OP_ENDIF
+// contained in the script, the envelopes not terminated by OP_ENDIF are ignored
+func parseInscriptionEnvelopes(script []byte) []bchain.InscriptionEnvelope {
+	var r []bchain.InscriptionEnvelope
+	tokens := tokenizeScript(script)
+	for i := 0; i+2 < len(tokens); i++ {
+		if !tokens[i].push || len(tokens[i].data) != 0 || tokens[i+1].op != txscript.OP_IF ||
+			!tokens[i+2].push || !bytes.Equal(tokens[i+2].data, inscriptionProtocolID) {
+			continue
+		}
+		var ins bchain.InscriptionEnvelope
+		var contentType, pointer []byte
+		body := false
+		valid := false
+		j := i + 3
+		for ; j < len(tokens); j++ {
+			t := &tokens[j]
+			if !t.push {
+				valid = t.op == txscript.OP_ENDIF
+				break
+			}
+			if body {
+				ins.ContentLength += len(t.data)
+				continue
+			}
+			if len(t.data) == 0 {
+				body = true
+				continue
+			}
+			if j+1 >= len(tokens) || !tokens[j+1].push {
+				// a tag without a value, the envelope is checked by the next token
+				continue
+			}
+			if len(t.data) == 1 {
+				switch t.data[0] {
+				case inscriptionTagContentType:
+					if contentType == nil {
+						contentType = tokens[j+1].data
+					}
+				case inscriptionTagPointer:
+					if pointer == nil {
+						pointer = tokens[j+1].data
+					}
+				}
+			}
+			j++
+		}
+		if !valid {
+			continue
+		}
+		ins.ContentType = string(contentType)
+		if len(pointer) > 0 && len(pointer) <= 8 {
+			var b [8]byte
+			copy(b[:], pointer)
+			p := binary.LittleEndian.Uint64(b[:])
+			ins.Pointer = &p
+		}
+		r = append(r, ins)
+		i = j
+	}
+	return r
+}
+
+// GetInscriptions returns the ordinals inscriptions revealed in the tapscripts of the inputs of the transaction
+func (p *BitcoinParser) GetInscriptions(tx *bchain.Tx) ([]bchain.InscriptionEnvelope, error) {
+	var r []bchain.InscriptionEnvelope
+	for i := range tx.Vin {
+		if len(tx.Vin[i].Witness) < 2 {
+			continue
+		}
+		witness := make([][]byte, len(tx.Vin[i].Witness))
+		var err error
+		for j, w := range tx.Vin[i].Witness {
+			if witness[j], err = hex.DecodeString(w); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		script := tapscript(witness)
+		if script == nil {
+			continue
+		}
+		for _, ins := range parseInscriptionEnvelopes(script) {
+			ins.Index = len(r)
+			ins.Input = i
+			r = append(r, ins)
+		}
+	}
+	return r, nil
+}
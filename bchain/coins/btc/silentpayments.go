@@ -0,0 +1,222 @@
+package btc
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/jakm/btcutil"
+	"github.com/jakm/btcutil/txscript"
+	"github.com/juju/errors"
+)
+
+// silentPaymentsNUMSKey is the x coordinate of the point H of BIP341 without known discrete logarithm,
+// the taproot inputs spent by the script path with this internal key are not used by silent payments
+var silentPaymentsNUMSKey, _ = hex.DecodeString("50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0")
+
+// taggedHash computes the BIP340 tagged hash sha256(sha256(tag) || sha256(tag) || msg...)
+func taggedHash(tag string, msg ...[]byte) []byte {
+	th := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(th[:])
+	h.Write(th[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
+
+// pad32 returns the big endian representation of v padded to 32 bytes
+func pad32(v *big.Int) []byte {
+	b := v.Bytes()
+	if len(b) >= 32 {
+		return b
+	}
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// serializePoint returns the compressed serialization of the point
+func serializePoint(x, y *big.Int) []byte {
+	prefix := byte(0x02)
+	if y.Bit(0) == 1 {
+		prefix = 0x03
+	}
+	return append([]byte{prefix}, pad32(x)...)
+}
+
+func isP2TRScript(s []byte) bool {
+	return len(s) == 34 && s[0] == txscript.OP_1 && s[1] == txscript.OP_DATA_32
+}
+
+func isP2WPKHScript(s []byte) bool {
+	return len(s) == 22 && s[0] == txscript.OP_0 && s[1] == txscript.OP_DATA_20
+}
+
+func isP2SHScript(s []byte) bool {
+	return len(s) == 23 && s[0] == txscript.OP_HASH160 && s[1] == txscript.OP_DATA_20 && s[22] == txscript.OP_EQUAL
+}
+
+func isP2PKHScript(s []byte) bool {
+	return len(s) == 25 && s[0] == txscript.OP_DUP && s[1] == txscript.OP_HASH160 && s[2] == txscript.OP_DATA_20 &&
+		s[23] == txscript.OP_EQUALVERIFY && s[24] == txscript.OP_CHECKSIG
+}
+
+// isFutureWitnessScript returns true for the witness programs of versions higher than 1
+func isFutureWitnessScript(s []byte) bool {
+	return len(s) >= 4 && len(s) <= 42 && s[0] >= txscript.OP_2 && s[0] <= txscript.OP_16 && int(s[1]) == len(s)-2
+}
+
+func parseCompressedKey(b []byte) *btcec.PublicKey {
+	if len(b) != 33 || (b[0] != 0x02 && b[0] != 0x03) {
+		return nil
+	}
+	pk, err := btcec.ParsePubKey(b, btcec.S256())
+	if err != nil {
+		return nil
+	}
+	return pk
+}
+
+// silentPaymentInputKey returns the public key of the input used by silent payments or nil if the input is not eligible,
+// the eligible inputs spend P2TR (not by script path with NUMS internal key), P2WPKH, P2SH-P2WPKH and P2PKH outputs with compressed key
+func silentPaymentInputKey(prevout []byte, scriptSig []byte, witness [][]byte) *btcec.PublicKey {
+	switch {
+	case isP2TRScript(prevout):
+		w := witness
+		if len(w) > 1 && len(w[len(w)-1]) > 0 && w[len(w)-1][0] == 0x50 {
+			// annex
+			w = w[:len(w)-1]
+		}
+		if len(w) > 1 {
+			control := w[len(w)-1]
+			if len(control) >= 33 && bytes.Equal(control[1:33], silentPaymentsNUMSKey) {
+				return nil
+			}
+		}
+		return parseCompressedKey(append([]byte{0x02}, prevout[2:]...))
+	case isP2WPKHScript(prevout):
+		if len(witness) == 2 {
+			return parseCompressedKey(witness[1])
+		}
+	case isP2SHScript(prevout):
+		if len(scriptSig) == 23 && scriptSig[0] == txscript.OP_DATA_22 && isP2WPKHScript(scriptSig[1:]) && len(witness) == 2 {
+			return parseCompressedKey(witness[1])
+		}
+	case isP2PKHScript(prevout):
+		pushes, err := txscript.PushedData(scriptSig)
+		if err != nil {
+			return nil
+		}
+		for i := len(pushes) - 1; i >= 0; i-- {
+			if len(pushes[i]) == 33 && bytes.Equal(btcutil.Hash160(pushes[i]), prevout[3:23]) {
+				return parseCompressedKey(pushes[i])
+			}
+		}
+	}
+	return nil
+}
+
+// ScanSilentPayments returns the outputs of the transaction paying to the silent payments (BIP352 version 0) wallet
+// given by its 32 bytes scan private key and 33 bytes compressed spend public key, the labels are not supported
+// prevouts are the output scripts spent by the inputs of the transaction, the transaction must contain the witness data
+func (p *BitcoinParser) ScanSilentPayments(tx *bchain.Tx, prevouts []bchain.AddressDescriptor, scanKey []byte, spendPubKey []byte) ([]bchain.SilentPaymentMatch, error) {
+	if len(tx.Vin) == 0 || tx.Vin[0].Coinbase != "" {
+		return nil, nil
+	}
+	outputs := make(map[string]uint32)
+	for i := range tx.Vout {
+		s, err := hex.DecodeString(tx.Vout[i].ScriptPubKey.Hex)
+		if err == nil && isP2TRScript(s) {
+			outputs[string(s[2:])] = tx.Vout[i].N
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, nil
+	}
+	if len(prevouts) != len(tx.Vin) {
+		return nil, errors.Errorf("Expecting %d prevouts, got %d", len(tx.Vin), len(prevouts))
+	}
+	curve := btcec.S256()
+	n := curve.Params().N
+	var ax, ay *big.Int
+	var smallestOutpoint []byte
+	for i := range tx.Vin {
+		vin := &tx.Vin[i]
+		if len(prevouts[i]) == 0 {
+			return nil, errors.Errorf("Missing prevout of input %d", i)
+		}
+		if isFutureWitnessScript(prevouts[i]) {
+			return nil, nil
+		}
+		txid, err := hex.DecodeString(vin.Txid)
+		if err != nil || len(txid) != 32 {
+			return nil, errors.Errorf("Invalid txid of input %d", i)
+		}
+		// the outpoint is serialized with the txid in the internal (reversed) byte order and little endian vout
+		outpoint := make([]byte, 36)
+		for j := range txid {
+			outpoint[31-j] = txid[j]
+		}
+		binary.LittleEndian.PutUint32(outpoint[32:], vin.Vout)
+		if smallestOutpoint == nil || bytes.Compare(outpoint, smallestOutpoint) < 0 {
+			smallestOutpoint = outpoint
+		}
+		scriptSig, err := hex.DecodeString(vin.ScriptSig.Hex)
+		if err != nil {
+			return nil, errors.Errorf("Invalid scriptSig of input %d", i)
+		}
+		witness := make([][]byte, len(vin.Witness))
+		for j := range vin.Witness {
+			if witness[j], err = hex.DecodeString(vin.Witness[j]); err != nil {
+				return nil, errors.Errorf("Invalid witness of input %d", i)
+			}
+		}
+		pk := silentPaymentInputKey(prevouts[i], scriptSig, witness)
+		if pk == nil {
+			continue
+		}
+		if ax == nil {
+			ax, ay = pk.X, pk.Y
+		} else {
+			ax, ay = curve.Add(ax, ay, pk.X, pk.Y)
+		}
+	}
+	// no eligible input or the sum of the keys is the point at infinity
+	if ax == nil || (ax.Sign() == 0 && ay.Sign() == 0) {
+		return nil, nil
+	}
+	spendKey := parseCompressedKey(spendPubKey)
+	if len(scanKey) != 32 || spendKey == nil {
+		return nil, errors.New("Invalid silent payments wallet keys")
+	}
+	inputHash := new(big.Int).SetBytes(taggedHash("BIP0352/Inputs", smallestOutpoint, serializePoint(ax, ay)))
+	if inputHash.Cmp(n) >= 0 {
+		return nil, nil
+	}
+	k := new(big.Int).Mul(inputHash, new(big.Int).SetBytes(scanKey))
+	k.Mod(k, n)
+	sx, sy := curve.ScalarMult(ax, ay, k.Bytes())
+	sharedSecret := serializePoint(sx, sy)
+	var r []bchain.SilentPaymentMatch
+	ser32 := make([]byte, 4)
+	for i := uint32(0); len(outputs) > 0; i++ {
+		binary.BigEndian.PutUint32(ser32, i)
+		t := taggedHash("BIP0352/SharedSecret", sharedSecret, ser32)
+		if new(big.Int).SetBytes(t).Cmp(n) >= 0 {
+			break
+		}
+		tweakX, tweakY := curve.ScalarBaseMult(t)
+		px, _ := curve.Add(spendKey.X, spendKey.Y, tweakX, tweakY)
+		vout, found := outputs[string(pad32(px))]
+		if !found {
+			break
+		}
+		r = append(r, bchain.SilentPaymentMatch{Vout: vout, K: i, Tweak: t})
+		delete(outputs, string(pad32(px)))
+	}
+	return r, nil
+}
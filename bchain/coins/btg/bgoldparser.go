@@ -48,7 +48,10 @@ type BGoldParser struct {
 
 // NewBGoldParser returns new BGoldParser instance
 func NewBGoldParser(params *chaincfg.Params, c *btc.Configuration) *BGoldParser {
-	return &BGoldParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &BGoldParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p.SignedMessageMagic = "Bitcoin Gold Signed Message:\n"
+	p.PaymentURIScheme = "bitcoingold"
+	return p
 }
 
 // GetChainParams contains network parameters for the main Bitcoin Cash network,
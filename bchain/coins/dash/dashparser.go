@@ -1,7 +1,9 @@
 package dash
 
 import (
+	"blockbook/bchain"
 	"blockbook/bchain/coins/btc"
+	"math/big"
 
 	"github.com/btcsuite/btcd/wire"
 	"github.com/jakm/btcutil/chaincfg"
@@ -42,14 +44,92 @@ func init() {
 	RegtestParams.ScriptHashAddrID = []byte{19}  // base58 prefix: 8 or 9
 }
 
+// superblock parameters of the networks, superblocks pay the budget proposals
+const (
+	mainnetSuperblockStart = 614820
+	mainnetSuperblockCycle = 16616
+	testnetSuperblockStart = 4200
+	testnetSuperblockCycle = 24
+	regtestSuperblockStart = 1500
+	regtestSuperblockCycle = 10
+)
+
 // DashParser handle
 type DashParser struct {
 	*btc.BitcoinParser
+	superblockStart uint32
+	superblockCycle uint32
 }
 
 // NewDashParser returns new DashParser instance
 func NewDashParser(params *chaincfg.Params, c *btc.Configuration) *DashParser {
-	return &DashParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &DashParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	// Dash keeps the message magic of its original name
+	p.SignedMessageMagic = "DarkCoin Signed Message:\n"
+	p.PaymentURIScheme = "dash"
+	switch params.Net {
+	case TestnetMagic:
+		p.superblockStart, p.superblockCycle = testnetSuperblockStart, testnetSuperblockCycle
+	case RegtestMagic:
+		p.superblockStart, p.superblockCycle = regtestSuperblockStart, regtestSuperblockCycle
+	default:
+		p.superblockStart, p.superblockCycle = mainnetSuperblockStart, mainnetSuperblockCycle
+	}
+	return p
+}
+
+// IsSuperblock returns true if the block of given height is a superblock
+func (p *DashParser) IsSuperblock(height uint32) bool {
+	return height >= p.superblockStart && height%p.superblockCycle == 0
+}
+
+// GetTxRewardTypes classifies the outputs of coinbase transaction
+// the first output is paid to the miner, the masternode payment follows it, since DIP3 the payment
+// can be split to the owner and the operator of the masternode, and in superblocks
+// the payments to the budget proposals are appended after the masternode payment
+// outputs with zero value (e.g. OP_RETURN) are not rewards
+func (p *DashParser) GetTxRewardTypes(tx *bchain.Tx, height uint32) ([]bchain.RewardType, error) {
+	if len(tx.Vin) != 1 || tx.Vin[0].Coinbase == "" || len(tx.Vout) == 0 {
+		return nil, nil
+	}
+	superblock := p.IsSuperblock(height)
+	operator := hasOperatorPayment(tx, superblock)
+	r := make([]bchain.RewardType, len(tx.Vout))
+	for i := range tx.Vout {
+		if tx.Vout[i].ValueSat.Sign() == 0 {
+			continue
+		}
+		switch {
+		case i == 0:
+			r[i] = bchain.RewardMining
+		case i == 1:
+			r[i] = bchain.RewardMasternode
+		case i == 2 && operator:
+			r[i] = bchain.RewardOperator
+		case superblock:
+			r[i] = bchain.RewardSuperblock
+		default:
+			r[i] = bchain.RewardMasternode
+		}
+	}
+	return r, nil
+}
+
+// hasOperatorPayment returns true if the third output of the coinbase transaction is the operator share
+// of the masternode payment paid together with the owner's payment; in regular blocks the masternode payment is the only payment after
+// the miner's reward, in superblocks the operator share is recognized by its value - since DIP3
+// the masternode payment is at least the half of the block reward without the superblock payments,
+// the owner's payment smaller than the miner's reward is therefore completed by the following output
+func hasOperatorPayment(tx *bchain.Tx, superblock bool) bool {
+	if len(tx.Vout) < 3 || tx.Vout[1].ValueSat.Sign() == 0 || tx.Vout[2].ValueSat.Sign() == 0 {
+		return false
+	}
+	if !superblock {
+		return true
+	}
+	var mn big.Int
+	mn.Add(&tx.Vout[1].ValueSat, &tx.Vout[2].ValueSat)
+	return tx.Vout[1].ValueSat.Cmp(&tx.Vout[0].ValueSat) < 0 && mn.Cmp(&tx.Vout[0].ValueSat) >= 0
 }
 
 // GetChainParams contains network parameters for the main Dash network,
@@ -0,0 +1,85 @@
+// +build unittest
+
+package dash
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins/btc"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jakm/btcutil/chaincfg"
+)
+
+func TestMain(m *testing.M) {
+	c := m.Run()
+	chaincfg.ResetParams()
+	os.Exit(c)
+}
+
+func TestDashParser_GetTxRewardTypes(t *testing.T) {
+	parser := NewDashParser(GetChainParams("main"), &btc.Configuration{})
+	coinbase := func(values ...int64) *bchain.Tx {
+		tx := &bchain.Tx{Vin: []bchain.Vin{{Coinbase: "03a0bb0d"}}}
+		for i, v := range values {
+			tx.Vout = append(tx.Vout, bchain.Vout{N: uint32(i), ValueSat: *big.NewInt(v)})
+		}
+		return tx
+	}
+	tests := []struct {
+		name   string
+		tx     *bchain.Tx
+		height uint32
+		want   []bchain.RewardType
+	}{
+		{
+			name:   "regular block",
+			tx:     coinbase(155000000, 0, 155000000),
+			height: 900001,
+			want:   []bchain.RewardType{bchain.RewardMining, bchain.RewardNone, bchain.RewardMasternode},
+		},
+		{
+			name:   "regular block with operator payment",
+			tx:     coinbase(124000000, 167400000, 18600000),
+			height: 1500001,
+			want:   []bchain.RewardType{bchain.RewardMining, bchain.RewardMasternode, bchain.RewardOperator},
+		},
+		{
+			name:   "superblock",
+			tx:     coinbase(155000000, 155000000, 10000000000, 2500000000),
+			height: mainnetSuperblockStart + 10*mainnetSuperblockCycle,
+			want:   []bchain.RewardType{bchain.RewardMining, bchain.RewardMasternode, bchain.RewardSuperblock, bchain.RewardSuperblock},
+		},
+		{
+			name:   "superblock with operator payment",
+			tx:     coinbase(124000000, 93000000, 93000000, 10000000000, 2500000000),
+			height: mainnetSuperblockStart + 10*mainnetSuperblockCycle,
+			want:   []bchain.RewardType{bchain.RewardMining, bchain.RewardMasternode, bchain.RewardOperator, bchain.RewardSuperblock, bchain.RewardSuperblock},
+		},
+		{
+			name:   "superblock with small first proposal",
+			tx:     coinbase(124000000, 186000000, 1000000, 10000000000),
+			height: mainnetSuperblockStart + 10*mainnetSuperblockCycle,
+			want:   []bchain.RewardType{bchain.RewardMining, bchain.RewardMasternode, bchain.RewardSuperblock, bchain.RewardSuperblock},
+		},
+		{
+			name:   "not coinbase",
+			tx:     &bchain.Tx{Vin: []bchain.Vin{{Txid: "c5b1f0ab"}}, Vout: []bchain.Vout{{ValueSat: *big.NewInt(1)}}},
+			height: 900001,
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.GetTxRewardTypes(tt.tx, tt.height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTxRewardTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -30,7 +30,10 @@ type DigiByteParser struct {
 
 // NewDigiByteParser returns new VertcoinParser instance
 func NewDigiByteParser(params *chaincfg.Params, c *btc.Configuration) *DigiByteParser {
-	return &DigiByteParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &DigiByteParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p.SignedMessageMagic = "DigiByte Signed Message:\n"
+	p.PaymentURIScheme = "digibyte"
+	return p
 }
 
 // GetChainParams contains network parameters for the main DigiByte network
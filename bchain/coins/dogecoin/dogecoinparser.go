@@ -32,7 +32,12 @@ type DogecoinParser struct {
 
 // NewDogecoinParser returns new DogecoinParser instance
 func NewDogecoinParser(params *chaincfg.Params, c *btc.Configuration) *DogecoinParser {
-	return &DogecoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &DogecoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p.SignedMessageMagic = "Dogecoin Signed Message:\n"
+	p.PaymentURIScheme = "dogecoin"
+	// the soft dust limit of Dogecoin Core, 0.01 DOGE
+	p.DustThresholdSat = 1000000
+	return p
 }
 
 // GetChainParams contains network parameters for the main Dogecoin network,
@@ -0,0 +1,469 @@
+package eth
+
+import (
+	"blockbook/bchain"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/juju/errors"
+)
+
+// abiWordLen is the length of the word of the abi encoding in bytes
+const abiWordLen = 32
+
+// maxABIValues limits the number of the decoded values, the offsets of the nested arrays may point to the same data
+// and the decoded values could grow exponentially with the length of the data
+const maxABIValues = 10000
+
+type abiKind int
+
+const (
+	abiUint abiKind = iota
+	abiInt
+	abiAddress
+	abiBool
+	abiFixedBytes
+	abiBytes
+	abiString
+	abiArray
+	abiTuple
+)
+
+// abiType is a type of the parameter of a contract method, name is the canonical name used in the signature
+type abiType struct {
+	kind abiKind
+	// size is the number of bits of uint and int and the number of bytes of the fixed bytes
+	size int
+	// length is the length of the fixed array, -1 for the dynamic array
+	length     int
+	elem       *abiType
+	components []*abiType
+	name       string
+}
+
+// splitABITypes splits the comma separated list of types, the commas in the tuples are skipped
+func splitABITypes(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var r []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.Errorf("Unbalanced parentheses in '%v'", s)
+			}
+		case ',':
+			if depth == 0 {
+				r = append(r, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.Errorf("Unbalanced parentheses in '%v'", s)
+	}
+	r = append(r, s[start:])
+	for _, t := range r {
+		if t == "" {
+			return nil, errors.Errorf("Empty type in '%v'", s)
+		}
+	}
+	return r, nil
+}
+
+func parseABITypes(s string) ([]*abiType, error) {
+	parts, err := splitABITypes(s)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]*abiType, len(parts))
+	for i, p := range parts {
+		if types[i], err = parseABIType(p); err != nil {
+			return nil, err
+		}
+	}
+	return types, nil
+}
+
+func abiTypeNames(types []*abiType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.name
+	}
+	return strings.Join(names, ",")
+}
+
+// parseABIType parses the type of the parameter, uint and int are the aliases of uint256 and int256
+func parseABIType(s string) (*abiType, error) {
+	if strings.HasSuffix(s, "]") {
+		i := strings.LastIndexByte(s, '[')
+		if i <= 0 {
+			return nil, errors.Errorf("Invalid type '%v'", s)
+		}
+		elem, err := parseABIType(s[:i])
+		if err != nil {
+			return nil, err
+		}
+		t := &abiType{kind: abiArray, elem: elem, length: -1}
+		if l := s[i+1 : len(s)-1]; l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 || n > maxABIValues {
+				return nil, errors.Errorf("Invalid array length in '%v'", s)
+			}
+			t.length = n
+			t.name = elem.name + "[" + l + "]"
+		} else {
+			t.name = elem.name + "[]"
+		}
+		return t, nil
+	}
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		components, err := parseABITypes(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		return &abiType{kind: abiTuple, components: components, name: "(" + abiTypeNames(components) + ")"}, nil
+	}
+	switch s {
+	case "address":
+		return &abiType{kind: abiAddress, name: s}, nil
+	case "bool":
+		return &abiType{kind: abiBool, name: s}, nil
+	case "bytes":
+		return &abiType{kind: abiBytes, name: s}, nil
+	case "string":
+		return &abiType{kind: abiString, name: s}, nil
+	case "uint", "int":
+		s += "256"
+	}
+	var prefix string
+	var kind abiKind
+	switch {
+	case strings.HasPrefix(s, "uint"):
+		prefix, kind = "uint", abiUint
+	case strings.HasPrefix(s, "int"):
+		prefix, kind = "int", abiInt
+	case strings.HasPrefix(s, "bytes"):
+		prefix, kind = "bytes", abiFixedBytes
+	default:
+		return nil, errors.Errorf("Unsupported type '%v'", s)
+	}
+	n, err := strconv.Atoi(s[len(prefix):])
+	if err != nil || strconv.Itoa(n) != s[len(prefix):] {
+		return nil, errors.Errorf("Invalid type '%v'", s)
+	}
+	if kind == abiFixedBytes {
+		if n < 1 || n > abiWordLen {
+			return nil, errors.Errorf("Invalid type '%v'", s)
+		}
+	} else if n < 8 || n > 256 || n%8 != 0 {
+		return nil, errors.Errorf("Invalid type '%v'", s)
+	}
+	return &abiType{kind: kind, size: n, name: s}, nil
+}
+
+// dynamic returns true if the value of the type is encoded in the tail and referenced by the offset in the head
+func (t *abiType) dynamic() bool {
+	switch t.kind {
+	case abiBytes, abiString:
+		return true
+	case abiArray:
+		return t.length < 0 || t.elem.dynamic()
+	case abiTuple:
+		for _, c := range t.components {
+			if c.dynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize returns the size of the type in the head of the encoding
+func (t *abiType) headSize() int {
+	if t.dynamic() {
+		return abiWordLen
+	}
+	switch t.kind {
+	case abiArray:
+		return t.length * t.elem.headSize()
+	case abiTuple:
+		s := 0
+		for _, c := range t.components {
+			s += c.headSize()
+		}
+		return s
+	}
+	return abiWordLen
+}
+
+// parseMethodSignature returns the name, the types of the parameters and the canonical form of the method signature
+func parseMethodSignature(signature string) (string, []*abiType, string, error) {
+	i := strings.IndexByte(signature, '(')
+	if i <= 0 || !strings.HasSuffix(signature, ")") {
+		return "", nil, "", errors.Errorf("Invalid method signature '%v', expecting name(type,...)", signature)
+	}
+	name := signature[:i]
+	for j, c := range name {
+		if !(c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > 0 && c >= '0' && c <= '9') {
+			return "", nil, "", errors.Errorf("Invalid method name '%v'", name)
+		}
+	}
+	types, err := parseABITypes(signature[i+1 : len(signature)-1])
+	if err != nil {
+		return "", nil, "", errors.Annotatef(err, "method signature '%v'", signature)
+	}
+	return name, types, name + "(" + abiTypeNames(types) + ")", nil
+}
+
+func methodSelector(canonical string) string {
+	return "0x" + hex.EncodeToString(crypto.Keccak256([]byte(canonical))[:4])
+}
+
+// GetMethodSelector returns the first 4 bytes of keccak256 of the canonical form of the method signature as hex string prefixed by 0x
+func (p *EthereumParser) GetMethodSelector(signature string) (string, error) {
+	_, _, canonical, err := parseMethodSignature(signature)
+	if err != nil {
+		return "", err
+	}
+	return methodSelector(canonical), nil
+}
+
+// contractCallData returns the input data of the transaction calling a contract, nil if the transaction is not a contract call
+func contractCallData(tx *bchain.Tx) ([]byte, error) {
+	r, err := getRpcTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	if r.To == "" {
+		return nil, nil
+	}
+	data, err := hexDecode(r.Payload)
+	if err != nil {
+		return nil, errors.Annotatef(err, "Payload %v", r.Payload)
+	}
+	if len(data) < 4 {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// GetContractCallSelector returns the selector of the method called by the transaction, empty for the plain transfers
+// and the contract creations
+func (p *EthereumParser) GetContractCallSelector(tx *bchain.Tx) (string, error) {
+	data, err := contractCallData(tx)
+	if err != nil || data == nil {
+		return "", err
+	}
+	return "0x" + hex.EncodeToString(data[:4]), nil
+}
+
+// DecodeContractCall decodes the parameters of the method called by the transaction by the abi encoding of the method signature,
+// the signature must match the selector of the call; nil is returned if the transaction is not a contract call
+func (p *EthereumParser) DecodeContractCall(tx *bchain.Tx, signature string) (*bchain.ContractCall, error) {
+	name, types, canonical, err := parseMethodSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	data, err := contractCallData(tx)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	selector := "0x" + hex.EncodeToString(data[:4])
+	if methodSelector(canonical) != selector {
+		return nil, errors.Errorf("Method signature '%v' does not match the selector %v", signature, selector)
+	}
+	budget := maxABIValues
+	values, err := decodeABITuple(types, data[4:], &budget)
+	if err != nil {
+		return nil, errors.Annotatef(err, "method %v", signature)
+	}
+	cc := &bchain.ContractCall{
+		Selector:  selector,
+		Signature: signature,
+		Name:      name,
+		Params:    make([]bchain.ContractCallParam, len(types)),
+	}
+	for i, t := range types {
+		cc.Params[i].Type = t.name
+		if t.kind == abiArray {
+			cc.Params[i].Values = values[i]
+		} else {
+			cc.Params[i].Value = values[i][0]
+		}
+	}
+	return cc, nil
+}
+
+// abiOffset returns the non negative integer in the word of the data at pos, which is not greater than limit
+func abiOffset(data []byte, pos int, limit int) (int, error) {
+	if pos < 0 || pos+abiWordLen > len(data) {
+		return 0, errors.New("Data too short")
+	}
+	w := data[pos : pos+abiWordLen]
+	for _, b := range w[:abiWordLen-8] {
+		if b != 0 {
+			return 0, errors.New("Invalid offset or length")
+		}
+	}
+	var n uint64
+	for _, b := range w[abiWordLen-8:] {
+		n = n<<8 | uint64(b)
+	}
+	if n > uint64(limit) {
+		return 0, errors.New("Invalid offset or length")
+	}
+	return int(n), nil
+}
+
+// decodeABITuple decodes the values of the types encoded as a tuple at the beginning of data, the offsets of the dynamic values
+// are relative to the beginning of data; the value of an array are its elements, of the other types a single string
+func decodeABITuple(types []*abiType, data []byte, budget *int) ([][]string, error) {
+	r := make([][]string, len(types))
+	pos := 0
+	for i, t := range types {
+		var err error
+		if t.dynamic() {
+			off, err := abiOffset(data, pos, len(data))
+			if err != nil {
+				return nil, err
+			}
+			r[i], err = decodeABIValue(t, data[off:], budget)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if pos > len(data) {
+				return nil, errors.New("Data too short")
+			}
+			if r[i], err = decodeABIValue(t, data[pos:], budget); err != nil {
+				return nil, err
+			}
+		}
+		pos += t.headSize()
+	}
+	return r, nil
+}
+
+// formatABIValue formats the decoded value as a string, the arrays are enclosed in brackets
+func formatABIValue(t *abiType, v []string) string {
+	if t.kind == abiArray {
+		return "[" + strings.Join(v, ",") + "]"
+	}
+	return v[0]
+}
+
+func decodeABIValue(t *abiType, data []byte, budget *int) ([]string, error) {
+	if *budget--; *budget < 0 {
+		return nil, errors.New("Too many values")
+	}
+	switch t.kind {
+	case abiArray:
+		n := t.length
+		if n < 0 {
+			var err error
+			if n, err = abiOffset(data, 0, len(data)); err != nil {
+				return nil, err
+			}
+			data = data[abiWordLen:]
+		}
+		// the head of each element takes at least one word
+		if n*abiWordLen > len(data) {
+			return nil, errors.New("Data too short")
+		}
+		elems := make([]*abiType, n)
+		for i := range elems {
+			elems[i] = t.elem
+		}
+		values, err := decodeABITuple(elems, data, budget)
+		if err != nil {
+			return nil, err
+		}
+		r := make([]string, n)
+		for i := range values {
+			r[i] = formatABIValue(t.elem, values[i])
+		}
+		return r, nil
+	case abiTuple:
+		values, err := decodeABITuple(t.components, data, budget)
+		if err != nil {
+			return nil, err
+		}
+		r := make([]string, len(values))
+		for i := range values {
+			r[i] = formatABIValue(t.components[i], values[i])
+		}
+		return []string{"(" + strings.Join(r, ",") + ")"}, nil
+	case abiBytes, abiString:
+		l, err := abiOffset(data, 0, len(data)-abiWordLen)
+		if err != nil {
+			return nil, err
+		}
+		b := data[abiWordLen : abiWordLen+l]
+		if t.kind == abiBytes {
+			return []string{"0x" + hex.EncodeToString(b)}, nil
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("Invalid string")
+		}
+		return []string{string(b)}, nil
+	}
+	if len(data) < abiWordLen {
+		return nil, errors.New("Data too short")
+	}
+	w := data[:abiWordLen]
+	switch t.kind {
+	case abiUint:
+		v := new(big.Int).SetBytes(w)
+		if v.BitLen() > t.size {
+			return nil, errors.Errorf("Invalid %v", t.name)
+		}
+		return []string{v.String()}, nil
+	case abiInt:
+		v := new(big.Int).SetBytes(w)
+		if w[0]&0x80 != 0 {
+			v.Sub(v, new(big.Int).Lsh(big.NewInt(1), 8*abiWordLen))
+		}
+		m := v
+		if v.Sign() < 0 {
+			m = new(big.Int).Not(v)
+		}
+		if m.BitLen() > t.size-1 {
+			return nil, errors.Errorf("Invalid %v", t.name)
+		}
+		return []string{v.String()}, nil
+	case abiAddress:
+		if !isZero(w[:abiWordLen-20]) {
+			return nil, errors.New("Invalid address")
+		}
+		return []string{eip55Address("0x" + hex.EncodeToString(w[abiWordLen-20:]))}, nil
+	case abiBool:
+		if !isZero(w[:abiWordLen-1]) || w[abiWordLen-1] > 1 {
+			return nil, errors.New("Invalid bool")
+		}
+		return []string{strconv.FormatBool(w[abiWordLen-1] == 1)}, nil
+	default:
+		if !isZero(w[t.size:]) {
+			return nil, errors.Errorf("Invalid %v", t.name)
+		}
+		return []string{"0x" + hex.EncodeToString(w[:t.size])}, nil
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
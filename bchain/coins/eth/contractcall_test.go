@@ -0,0 +1,185 @@
+// +build unittest
+
+package eth
+
+import (
+	"blockbook/bchain"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEthereumParser_GetMethodSelector(t *testing.T) {
+	p := NewEthereumParser()
+	tests := []struct {
+		signature string
+		want      string
+		wantErr   bool
+	}{
+		{signature: "transfer(address,uint256)", want: "0xa9059cbb"},
+		{signature: "transfer(address,uint)", want: "0xa9059cbb"},
+		{signature: "approve(address,uint256)", want: "0x095ea7b3"},
+		{signature: "transferFrom(address,address,uint256)", want: "0x23b872dd"},
+		{signature: "transfer(address, uint256)", wantErr: true},
+		{signature: "transfer(address,uint7)", wantErr: true},
+		{signature: "transfer(address,bytes33)", wantErr: true},
+		{signature: "transfer(address,(uint256)", wantErr: true},
+		{signature: "transfer", wantErr: true},
+		{signature: "(address)", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signature, func(t *testing.T) {
+			got, err := p.GetMethodSelector(tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMethodSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetMethodSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEthereumParser_DecodeContractCall(t *testing.T) {
+	p := NewEthereumParser()
+	r := testRpcTx3
+	r.To = "0x682B7903a11098cf770c7aef4aa02a85b3f3601a"
+	r.Payload = "0xa9059cbb000000000000000000000000555EE11FBDDC0E49A9BAB358A8941AD95FFDB48F00000000000000000000000000000000000000000000000000000000000f4240"
+	tx, err := p.ethTxToTx(&r, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector, err := p.GetContractCallSelector(tx)
+	if err != nil || selector != "0xa9059cbb" {
+		t.Errorf("GetContractCallSelector() = %v, %v, want 0xa9059cbb", selector, err)
+	}
+	got, err := p.DecodeContractCall(tx, "transfer(address,uint256)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &bchain.ContractCall{
+		Selector:  "0xa9059cbb",
+		Signature: "transfer(address,uint256)",
+		Name:      "transfer",
+		Params: []bchain.ContractCallParam{
+			{Type: "address", Value: "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f"},
+			{Type: "uint256", Value: "1000000"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeContractCall() = %+v, want %+v", got, want)
+	}
+	if _, err := p.DecodeContractCall(tx, "approve(address,uint256)"); err == nil {
+		t.Error("DecodeContractCall() with signature of other selector expected error")
+	}
+
+	// contract creation and plain transfer are not contract calls
+	for _, c := range []struct{ to, payload string }{{"", r.Payload}, {r.To, "0x"}} {
+		o := testRpcTx3
+		o.To = c.to
+		o.Payload = c.payload
+		tx, err := p.ethTxToTx(&o, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, err := p.GetContractCallSelector(tx); err != nil || s != "" {
+			t.Errorf("GetContractCallSelector(to %q, payload %q) = %v, %v, want empty", c.to, c.payload, s, err)
+		}
+		if cc, err := p.DecodeContractCall(tx, "transfer(address,uint256)"); err != nil || cc != nil {
+			t.Errorf("DecodeContractCall(to %q, payload %q) = %+v, %v, want nil", c.to, c.payload, cc, err)
+		}
+	}
+}
+
+func Test_decodeABITuple(t *testing.T) {
+	word := func(s string) string {
+		return strings.Repeat("0", 64-len(s)) + s
+	}
+	tests := []struct {
+		name    string
+		types   string
+		data    string
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name:  "static",
+			types: "bool,int8,bytes4,uint16[2]",
+			data:  word("1") + strings.Repeat("f", 64) + "deadbeef" + strings.Repeat("0", 56) + word("2") + word("3"),
+			want:  [][]string{{"true"}, {"-1"}, {"0xdeadbeef"}, {"2", "3"}},
+		},
+		{
+			name:  "dynamic",
+			types: "string,uint256[],bytes",
+			data: word("60") + word("a0") + word("100") +
+				word("5") + hex.EncodeToString([]byte("hello")) + strings.Repeat("0", 54) +
+				word("2") + word("a") + word("b") +
+				word("2") + "abcd" + strings.Repeat("0", 60),
+			want: [][]string{{"hello"}, {"10", "11"}, {"0xabcd"}},
+		},
+		{
+			name:  "tuple and nested array",
+			types: "(address,bool),uint8[][]",
+			data: word("555ee11fbddc0e49a9bab358a8941ad95ffdb48f") + word("0") + word("60") +
+				word("1") + word("20") + word("2") + word("1") + word("2"),
+			want: [][]string{{"(0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f,false)"}, {"[1,2]"}},
+		},
+		{
+			name:    "uint8 overflow",
+			types:   "uint8",
+			data:    word("100"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid bool",
+			types:   "bool",
+			data:    word("2"),
+			wantErr: true,
+		},
+		{
+			name:    "short data",
+			types:   "uint256,uint256",
+			data:    word("1"),
+			wantErr: true,
+		},
+		{
+			name:    "offset out of data",
+			types:   "string",
+			data:    word("40") + word("1"),
+			wantErr: true,
+		},
+		{
+			name:    "array length out of data",
+			types:   "uint256[]",
+			data:    word("20") + word("ffff"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid string",
+			types:   "string",
+			data:    word("20") + word("1") + "ff" + strings.Repeat("0", 62),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types, err := parseABITypes(tt.types)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			budget := maxABIValues
+			got, err := decodeABITuple(types, data, &budget)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeABITuple() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeABITuple() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package eth
+
+import (
+	"blockbook/bchain"
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/juju/errors"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+)
+
+// selectors of the ERC-20 functions, the first 4 bytes of keccak256 of the function signature
+const (
+	erc20TransferMethod     = "0xa9059cbb"
+	erc20TransferFromMethod = "0x23b872dd"
+	erc20NameMethod         = "0x06fdde03"
+	erc20SymbolMethod       = "0x95d89b41"
+	erc20DecimalsMethod     = "0x313ce567"
+)
+
+// erc20WordLen is the length of abi encoded argument in hex characters
+const erc20WordLen = 64
+
+func erc20Address(word string) string {
+	return eip55Address("0x" + word[erc20WordLen-40:])
+}
+
+// isErc20TransferCall checks if the transaction calls the function transfer or transferFrom of a contract
+func isErc20TransferCall(r *rpcTransaction) bool {
+	if r.To == "" || len(r.Payload) < len(erc20TransferMethod) {
+		return false
+	}
+	method := strings.ToLower(r.Payload[:len(erc20TransferMethod)])
+	return method == erc20TransferMethod || method == erc20TransferFromMethod
+}
+
+// GetErc20Transfers decodes the ERC-20 transfers from the input data of the transaction
+// only the direct calls of transfer and transferFrom of the token contract are recognized,
+// the transfers made by other contracts are not visible in the input data;
+// the failed transactions did not transfer the tokens, their transfers are not returned
+func (p *EthereumParser) GetErc20Transfers(tx *bchain.Tx) ([]bchain.Erc20Transfer, error) {
+	r, err := getRpcTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !isErc20TransferCall(r) || r.Status == txStatusFailed {
+		return nil, nil
+	}
+	method, args := strings.ToLower(r.Payload[:len(erc20TransferMethod)]), r.Payload[len(erc20TransferMethod):]
+	t := bchain.Erc20Transfer{Contract: eip55Address(r.To)}
+	var value string
+	switch method {
+	case erc20TransferMethod:
+		if len(args) < 2*erc20WordLen {
+			return nil, nil
+		}
+		t.From, t.To, value = eip55Address(r.From), erc20Address(args[:erc20WordLen]), args[erc20WordLen:2*erc20WordLen]
+	case erc20TransferFromMethod:
+		if len(args) < 3*erc20WordLen {
+			return nil, nil
+		}
+		t.From, t.To, value = erc20Address(args[:erc20WordLen]), erc20Address(args[erc20WordLen:2*erc20WordLen]), args[2*erc20WordLen:3*erc20WordLen]
+	default:
+		return nil, nil
+	}
+	if _, ok := t.Tokens.SetString(value, 16); !ok {
+		return nil, errors.Errorf("Invalid transfer value %v", value)
+	}
+	return []bchain.Erc20Transfer{t}, nil
+}
+
+// parseErc20String decodes the abi encoded string returned by the contract,
+// some early tokens return bytes32 instead of string
+func parseErc20String(data string) string {
+	b, err := hexDecode(data)
+	if err != nil {
+		return ""
+	}
+	if len(b) == 32 {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	if len(b) < 64 {
+		return ""
+	}
+	o := new(big.Int).SetBytes(b[:32])
+	if !o.IsUint64() || o.Uint64() > uint64(len(b)-32) {
+		return ""
+	}
+	i := int(o.Uint64()) + 32
+	l := new(big.Int).SetBytes(b[i-32 : i])
+	if !l.IsUint64() || l.Uint64() > uint64(len(b)-i) {
+		return ""
+	}
+	return string(b[i : i+int(l.Uint64())])
+}
+
+// parseErc20Decimals decodes the uint8 returned by the function decimals, the invalid values are returned as 0
+func parseErc20Decimals(data string) int {
+	b, err := hexDecode(data)
+	if err != nil || len(b) != 32 {
+		return 0
+	}
+	d := new(big.Int).SetBytes(b)
+	if !d.IsUint64() || d.Uint64() > 255 {
+		return 0
+	}
+	return int(d.Uint64())
+}
+
+// setErc20Status sets the status of the mined ERC-20 transfer calls, which is read from their receipts in one batch
+func (b *EthereumRPC) setErc20Status(ctx context.Context, txs []*rpcTransaction) error {
+	var batch []rpc.BatchElem
+	var calls []*rpcTransaction
+	for _, tx := range txs {
+		if isErc20TransferCall(tx) {
+			batch = append(batch, rpc.BatchElem{
+				Method: "eth_getTransactionReceipt",
+				Args:   []interface{}{tx.Hash},
+				Result: &rpcStatusReceipt{},
+			})
+			calls = append(calls, tx)
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := b.rpc.BatchCallContext(ctx, batch); err != nil {
+		return errors.Annotatef(err, "eth_getTransactionReceipt")
+	}
+	for i := range batch {
+		if batch[i].Error != nil {
+			return errors.Annotatef(batch[i].Error, "eth_getTransactionReceipt %v", calls[i].Hash.Hex())
+		}
+		calls[i].Status = batch[i].Result.(*rpcStatusReceipt).Status
+	}
+	return nil
+}
+
+// GetErc20ContractInfo reads the name, symbol and decimals of ERC-20 token contract in one batch of calls,
+// the call reverted by the contract returns empty data
+func (b *EthereumRPC) GetErc20ContractInfo(contractDesc bchain.AddressDescriptor) (*bchain.Erc20Contract, error) {
+	contract := ethcommon.BytesToAddress(contractDesc).Hex()
+	methods := []string{erc20NameMethod, erc20SymbolMethod, erc20DecimalsMethod}
+	results := make([]string, len(methods))
+	batch := make([]rpc.BatchElem, len(methods))
+	for i, m := range methods {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args:   []interface{}{map[string]interface{}{"to": contract, "data": m}, "latest"},
+			Result: &results[i],
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	if err := b.rpc.BatchCallContext(ctx, batch); err != nil {
+		return nil, errors.Annotatef(err, "contract %v", contract)
+	}
+	for i := range batch {
+		if batch[i].Error != nil {
+			if _, ok := batch[i].Error.(rpc.Error); !ok {
+				return nil, errors.Annotatef(batch[i].Error, "contract %v, method %v", contract, methods[i])
+			}
+			results[i] = ""
+		}
+	}
+	return &bchain.Erc20Contract{
+		Contract: contract,
+		Name:     parseErc20String(results[0]),
+		Symbol:   parseErc20String(results[1]),
+		Decimals: parseErc20Decimals(results[2]),
+	}, nil
+}
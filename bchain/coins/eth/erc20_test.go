@@ -0,0 +1,127 @@
+// +build unittest
+
+package eth
+
+import (
+	"blockbook/bchain"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestEthereumParser_GetErc20Transfers(t *testing.T) {
+	p := NewEthereumParser()
+	tests := []struct {
+		name    string
+		payload string
+		status  string
+		want    []bchain.Erc20Transfer
+	}{
+		{
+			name:    "transfer",
+			payload: "0xa9059cbb000000000000000000000000555EE11FBDDC0E49A9BAB358A8941AD95FFDB48F00000000000000000000000000000000000000000000000000000000000f4240",
+			want: []bchain.Erc20Transfer{{
+				Contract: "0x682b7903a11098CF770C7aEF4Aa02A85b3f3601a",
+				From:     "0x3E3a3D69dc66bA10737F531ed088954a9EC89d97",
+				To:       "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f",
+				Tokens:   *big.NewInt(1000000),
+			}},
+		},
+		{
+			name: "transferFrom",
+			payload: "0x23b872dd000000000000000000000000dacc9c61754a0c4616fc5323dc946e89eb272302" +
+				"000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f0000000000000000000000000000000000000000000000000de0b6b3a7640000",
+			want: []bchain.Erc20Transfer{{
+				Contract: "0x682b7903a11098CF770C7aEF4Aa02A85b3f3601a",
+				From:     "0xDacC9C61754a0C4616FC5323dC946e89Eb272302",
+				To:       "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f",
+				Tokens:   *big.NewInt(1000000000000000000),
+			}},
+		},
+		{
+			name:    "reverted transfer",
+			payload: "0xa9059cbb000000000000000000000000555EE11FBDDC0E49A9BAB358A8941AD95FFDB48F00000000000000000000000000000000000000000000000000000000000f4240",
+			status:  "0x0",
+		},
+		{
+			name:    "other method",
+			payload: "0x095ea7b3000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f00000000000000000000000000000000000000000000000000000000000f4240",
+		},
+		{
+			name:    "short input",
+			payload: "0xa9059cbb000000000000000000000000555ee11fbddc0e49a9bab358a8941ad95ffdb48f",
+		},
+		{
+			name:    "no input",
+			payload: "0x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRpcTx3
+			r.To = "0x682B7903a11098cf770c7aef4aa02a85b3f3601a"
+			r.Payload = tt.payload
+			r.Status = tt.status
+			tx, err := p.ethTxToTx(&r, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the status of the failed transaction is kept in the packed transaction
+			packed, err := p.PackTx(tx, 4321000, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx, _, err = p.UnpackTx(packed); err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.GetErc20Transfers(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EthereumParser.GetErc20Transfers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseErc20String(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "string",
+			data: "0x0000000000000000000000000000000000000000000000000000000000000020" +
+				"000000000000000000000000000000000000000000000000000000000000000a" +
+				"5465746865722055534400000000000000000000000000000000000000000000",
+			want: "Tether USD",
+		},
+		{
+			name: "bytes32",
+			data: "0x4d4b520000000000000000000000000000000000000000000000000000000000",
+			want: "MKR",
+		},
+		{
+			name: "length out of data",
+			data: "0x0000000000000000000000000000000000000000000000000000000000000020" +
+				"00000000000000000000000000000000000000000000000000000000000000ff" +
+				"5465746865722055534400000000000000000000000000000000000000000000",
+		},
+		{
+			name: "empty",
+			data: "0x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseErc20String(tt.data); got != tt.want {
+				t.Errorf("parseErc20String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := parseErc20Decimals("0x0000000000000000000000000000000000000000000000000000000000000006"); got != 6 {
+		t.Errorf("parseErc20Decimals() = %v, want 6", got)
+	}
+}
@@ -44,14 +44,72 @@ type rpcTransaction struct {
 	V string `json:"v" gencodec:"required"`
 	R string `json:"r" gencodec:"required"`
 	S string `json:"s" gencodec:"required"`
+	// EIP-2718 transaction type and EIP-1559 fee parameters, not present in the legacy transactions
+	Type                 string `json:"type,omitempty"`
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+	// EffectiveGasPrice is not returned by the backend in the transaction, it is computed from the base fee of the block
+	EffectiveGasPrice string `json:"effectiveGasPrice,omitempty"`
+	// EIP-4844 blob parameters, present only in the blob transactions
+	MaxFeePerBlobGas    string   `json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes []string `json:"blobVersionedHashes,omitempty"`
+	// BlobGasUsed and BlobGasPrice are not returned by the backend in the transaction, they are read from the receipt
+	BlobGasUsed  string `json:"blobGasUsed,omitempty"`
+	BlobGasPrice string `json:"blobGasPrice,omitempty"`
+	// Status is not returned by the backend in the transaction, it is read from the receipt of the mined ERC-20 transfer calls,
+	// only the failed status "0x0" is kept in the packed transaction
+	Status string `json:"status,omitempty"`
 }
 
 type rpcBlock struct {
 	Hash         ethcommon.Hash   `json:"hash"`
 	Transactions []rpcTransaction `json:"transactions"`
 	UncleHashes  []ethcommon.Hash `json:"uncles"`
+	BaseFee      string           `json:"baseFeePerGas,omitempty"`
+	Withdrawals  []rpcWithdrawal  `json:"withdrawals,omitempty"`
 }
 
+// rpcWithdrawal is the withdrawal from the beacon chain as returned by the backend, the amount is in gwei
+type rpcWithdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
+}
+
+// rpcBlockTxids is the block as returned by the backend without the transaction details
+type rpcBlockTxids struct {
+	Hash          ethcommon.Hash `json:"hash"`
+	Time          string         `json:"timestamp"`
+	Transactions  []string       `json:"transactions"`
+	BaseFee       string         `json:"baseFeePerGas,omitempty"`
+	BlobGasUsed   string         `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas string         `json:"excessBlobGas,omitempty"`
+}
+
+// rpcBlobReceipt contains the blob gas fields of the receipt of the blob transaction
+type rpcBlobReceipt struct {
+	BlobGasUsed  string `json:"blobGasUsed"`
+	BlobGasPrice string `json:"blobGasPrice"`
+}
+
+// rpcStatusReceipt contains the status of the receipt of the transaction, "0x1" if the transaction succeeded, "0x0" if it failed
+type rpcStatusReceipt struct {
+	Status string `json:"status"`
+}
+
+// txStatusFailed is the status of the receipt of the failed transaction
+const txStatusFailed = "0x0"
+
+const (
+	// eip1559TxType is the type of transactions with dynamic fee
+	eip1559TxType = 2
+	// eip4844TxType is the type of transactions carrying blobs
+	eip4844TxType = 3
+	// gasPerBlob is the blob gas consumed by one blob
+	gasPerBlob = 1 << 17
+)
+
 func ethHashToHash(h ethcommon.Hash) string {
 	return h.Hex()
 }
@@ -63,6 +121,33 @@ func ethNumber(n string) (int64, error) {
 	return 0, errors.Errorf("Not a number: '%v'", n)
 }
 
+// setEffectiveGasPrice sets the gas price paid by the mined transaction in the block with given base fee
+// the price of EIP-1559 transactions is min(maxFeePerGas, baseFee+maxPriorityFeePerGas), otherwise it is gasPrice
+func setEffectiveGasPrice(tx *rpcTransaction, baseFee string) error {
+	if tx.MaxFeePerGas == "" || baseFee == "" {
+		tx.EffectiveGasPrice = tx.Price
+		return nil
+	}
+	maxFee, err := hexutil.DecodeBig(tx.MaxFeePerGas)
+	if err != nil {
+		return errors.Annotatef(err, "MaxFeePerGas %v", tx.MaxFeePerGas)
+	}
+	tip, err := hexutil.DecodeBig(tx.MaxPriorityFeePerGas)
+	if err != nil {
+		return errors.Annotatef(err, "MaxPriorityFeePerGas %v", tx.MaxPriorityFeePerGas)
+	}
+	bf, err := hexutil.DecodeBig(baseFee)
+	if err != nil {
+		return errors.Annotatef(err, "BaseFee %v", baseFee)
+	}
+	price := tip.Add(tip, bf)
+	if price.Cmp(maxFee) > 0 {
+		price = maxFee
+	}
+	tx.EffectiveGasPrice = hexutil.EncodeBig(price)
+	return nil
+}
+
 func (p *EthereumParser) ethTxToTx(tx *rpcTransaction, blocktime int64, confirmations uint32) (*bchain.Tx, error) {
 	txid := ethHashToHash(tx.Hash)
 	var (
@@ -70,10 +155,10 @@ func (p *EthereumParser) ethTxToTx(tx *rpcTransaction, blocktime int64, confirma
 		err    error
 	)
 	if len(tx.From) > 2 {
-		fa = []string{tx.From}
+		fa = []string{eip55Address(tx.From)}
 	}
 	if len(tx.To) > 2 {
-		ta = []string{tx.To}
+		ta = []string{eip55Address(tx.To)}
 	}
 	// temporarily, the complete rpcTransaction without BlockHash is marshalled and hex encoded to bchain.Tx.Hex
 	bh := tx.BlockHash
@@ -118,6 +203,46 @@ func (p *EthereumParser) ethTxToTx(tx *rpcTransaction, blocktime int64, confirma
 	}, nil
 }
 
+// weiPerGwei converts the amounts of the withdrawals to wei
+var weiPerGwei = big.NewInt(1000000000)
+
+// ethWithdrawalsToWithdrawals converts the withdrawals of the block, their amounts from gwei to wei
+func ethWithdrawalsToWithdrawals(ws []rpcWithdrawal) ([]bchain.Withdrawal, error) {
+	if len(ws) == 0 {
+		return nil, nil
+	}
+	r := make([]bchain.Withdrawal, len(ws))
+	for i := range ws {
+		w := &ws[i]
+		var err error
+		if r[i].Index, err = hexutil.DecodeUint64(w.Index); err != nil {
+			return nil, errors.Annotatef(err, "Withdrawal index %v", w.Index)
+		}
+		if r[i].ValidatorIndex, err = hexutil.DecodeUint64(w.ValidatorIndex); err != nil {
+			return nil, errors.Annotatef(err, "Withdrawal %v validatorIndex %v", w.Index, w.ValidatorIndex)
+		}
+		amount, err := hexutil.DecodeBig(w.Amount)
+		if err != nil {
+			return nil, errors.Annotatef(err, "Withdrawal %v amount %v", w.Index, w.Amount)
+		}
+		r[i].AmountSat.Mul(amount, weiPerGwei)
+		r[i].Address = eip55Address(w.Address)
+	}
+	return r, nil
+}
+
+// blobCount returns the number of blobs of the block with given blob gas used (hex encoded)
+func blobCount(blobGasUsed string) (int, error) {
+	if blobGasUsed == "" {
+		return 0, nil
+	}
+	n, err := hexutil.DecodeUint64(blobGasUsed)
+	if err != nil {
+		return 0, errors.Annotatef(err, "BlobGasUsed %v", blobGasUsed)
+	}
+	return int(n / gasPerBlob), nil
+}
+
 // GetAddrDescFromVout returns internal address representation of given transaction output
 func (p *EthereumParser) GetAddrDescFromVout(output *bchain.Vout) (bchain.AddressDescriptor, error) {
 	if len(output.ScriptPubKey.Addresses) != 1 {
@@ -145,9 +270,22 @@ func (p *EthereumParser) GetAddrDescFromAddress(address string) (bchain.AddressD
 	return hex.DecodeString(address)
 }
 
-// GetAddressesFromAddrDesc returns addresses for given address descriptor with flag if the addresses are searchable
+// GetAddressesFromAddrDesc returns addresses for given address descriptor with flag if the addresses are searchable,
+// the addresses are in the EIP-55 mixed case checksum format
 func (p *EthereumParser) GetAddressesFromAddrDesc(addrDesc bchain.AddressDescriptor) ([]string, bool, error) {
-	return []string{hexutil.Encode(addrDesc)}, true, nil
+	if len(addrDesc) != ethcommon.AddressLength {
+		return []string{hexutil.Encode(addrDesc)}, true, nil
+	}
+	return []string{ethcommon.BytesToAddress(addrDesc).Hex()}, true, nil
+}
+
+// eip55Address returns the hex address in the EIP-55 mixed case checksum format,
+// the strings which are not valid addresses are returned unchanged
+func eip55Address(address string) string {
+	if !ethcommon.IsHexAddress(address) {
+		return address
+	}
+	return ethcommon.HexToAddress(address).Hex()
 }
 
 // GetScriptFromAddrDesc returns output script for given address descriptor
@@ -230,6 +368,51 @@ func (p *EthereumParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) (
 	if pt.Value, err = hexDecodeBig(r.Value); err != nil {
 		return nil, errors.Annotatef(err, "Value %v", r.Value)
 	}
+	if r.Type != "" {
+		if n, err = hexutil.DecodeUint64(r.Type); err != nil {
+			return nil, errors.Annotatef(err, "Type %v", r.Type)
+		}
+		pt.Type = uint32(n)
+	}
+	if r.MaxFeePerGas != "" {
+		if pt.MaxFeePerGas, err = hexDecodeBig(r.MaxFeePerGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxFeePerGas %v", r.MaxFeePerGas)
+		}
+	}
+	if r.MaxPriorityFeePerGas != "" {
+		if pt.MaxPriorityFeePerGas, err = hexDecodeBig(r.MaxPriorityFeePerGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxPriorityFeePerGas %v", r.MaxPriorityFeePerGas)
+		}
+	}
+	if r.EffectiveGasPrice != "" {
+		if pt.EffectiveGasPrice, err = hexDecodeBig(r.EffectiveGasPrice); err != nil {
+			return nil, errors.Annotatef(err, "EffectiveGasPrice %v", r.EffectiveGasPrice)
+		}
+	}
+	if r.MaxFeePerBlobGas != "" {
+		if pt.MaxFeePerBlobGas, err = hexDecodeBig(r.MaxFeePerBlobGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxFeePerBlobGas %v", r.MaxFeePerBlobGas)
+		}
+	}
+	if len(r.BlobVersionedHashes) > 0 {
+		pt.BlobVersionedHashes = make([][]byte, len(r.BlobVersionedHashes))
+		for i, h := range r.BlobVersionedHashes {
+			if pt.BlobVersionedHashes[i], err = hexDecode(h); err != nil {
+				return nil, errors.Annotatef(err, "BlobVersionedHashes %v", h)
+			}
+		}
+	}
+	if r.BlobGasUsed != "" {
+		if pt.BlobGasUsed, err = hexutil.DecodeUint64(r.BlobGasUsed); err != nil {
+			return nil, errors.Annotatef(err, "BlobGasUsed %v", r.BlobGasUsed)
+		}
+	}
+	if r.BlobGasPrice != "" {
+		if pt.BlobGasPrice, err = hexDecodeBig(r.BlobGasPrice); err != nil {
+			return nil, errors.Annotatef(err, "BlobGasPrice %v", r.BlobGasPrice)
+		}
+	}
+	pt.Failed = r.Status == txStatusFailed
 	return proto.Marshal(pt)
 }
 
@@ -255,6 +438,32 @@ func (p *EthereumParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
 		TransactionIndex: hexutil.EncodeUint64(uint64(pt.TransactionIndex)),
 		Value:            hexEncodeBig(pt.Value),
 	}
+	if pt.Type != 0 {
+		r.Type = hexutil.EncodeUint64(uint64(pt.Type))
+	}
+	// zero priority fee is packed as empty bytes, the fee parameters are always present in the EIP-1559 and blob transactions
+	if pt.Type == eip1559TxType || pt.Type == eip4844TxType || len(pt.MaxFeePerGas) > 0 {
+		r.MaxFeePerGas = hexEncodeBig(pt.MaxFeePerGas)
+		r.MaxPriorityFeePerGas = hexEncodeBig(pt.MaxPriorityFeePerGas)
+	}
+	if len(pt.EffectiveGasPrice) > 0 {
+		r.EffectiveGasPrice = hexEncodeBig(pt.EffectiveGasPrice)
+	}
+	if pt.Type == eip4844TxType {
+		r.MaxFeePerBlobGas = hexEncodeBig(pt.MaxFeePerBlobGas)
+		r.BlobVersionedHashes = make([]string, len(pt.BlobVersionedHashes))
+		for i, h := range pt.BlobVersionedHashes {
+			r.BlobVersionedHashes[i] = hexutil.Encode(h)
+		}
+		// the blob gas used and price are known only for the mined transactions
+		if pt.BlobGasUsed != 0 {
+			r.BlobGasUsed = hexutil.EncodeUint64(pt.BlobGasUsed)
+			r.BlobGasPrice = hexEncodeBig(pt.BlobGasPrice)
+		}
+	}
+	if pt.Failed {
+		r.Status = txStatusFailed
+	}
 	tx, err := p.ethTxToTx(&r, int64(pt.BlockTime), 0)
 	if err != nil {
 		return nil, 0, err
@@ -297,3 +506,83 @@ func (p *EthereumParser) UnpackBlockHash(buf []byte) (string, error) {
 func (p *EthereumParser) IsUTXOChain() bool {
 	return false
 }
+
+// getRpcTransaction returns the rpcTransaction stored hex encoded in the Hex field of the transaction
+func getRpcTransaction(tx *bchain.Tx) (*rpcTransaction, error) {
+	b, err := hex.DecodeString(tx.Hex)
+	if err != nil {
+		return nil, err
+	}
+	var r rpcTransaction
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetTxNonce returns nonce of the account sending the transaction
+func (p *EthereumParser) GetTxNonce(tx *bchain.Tx) (uint64, error) {
+	r, err := getRpcTransaction(tx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := hexutil.DecodeUint64(r.AccountNonce)
+	if err != nil {
+		return 0, errors.Annotatef(err, "AccountNonce %v", r.AccountNonce)
+	}
+	return n, nil
+}
+
+// GetTxFeeData returns the gas parameters of the transaction
+func (p *EthereumParser) GetTxFeeData(tx *bchain.Tx) (*bchain.TxFeeData, error) {
+	r, err := getRpcTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	fd := &bchain.TxFeeData{}
+	if r.Type != "" {
+		n, err := hexutil.DecodeUint64(r.Type)
+		if err != nil {
+			return nil, errors.Annotatef(err, "Type %v", r.Type)
+		}
+		fd.Type = uint32(n)
+	}
+	if fd.GasLimit, err = hexutil.DecodeUint64(r.GasLimit); err != nil {
+		return nil, errors.Annotatef(err, "GasLimit %v", r.GasLimit)
+	}
+	if fd.GasPrice, err = hexutil.DecodeBig(r.Price); err != nil {
+		return nil, errors.Annotatef(err, "Price %v", r.Price)
+	}
+	if r.MaxFeePerGas != "" {
+		if fd.MaxFeePerGas, err = hexutil.DecodeBig(r.MaxFeePerGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxFeePerGas %v", r.MaxFeePerGas)
+		}
+	}
+	if r.MaxPriorityFeePerGas != "" {
+		if fd.MaxPriorityFeePerGas, err = hexutil.DecodeBig(r.MaxPriorityFeePerGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxPriorityFeePerGas %v", r.MaxPriorityFeePerGas)
+		}
+	}
+	if r.EffectiveGasPrice != "" {
+		if fd.EffectiveGasPrice, err = hexutil.DecodeBig(r.EffectiveGasPrice); err != nil {
+			return nil, errors.Annotatef(err, "EffectiveGasPrice %v", r.EffectiveGasPrice)
+		}
+	}
+	if r.MaxFeePerBlobGas != "" {
+		if fd.MaxFeePerBlobGas, err = hexutil.DecodeBig(r.MaxFeePerBlobGas); err != nil {
+			return nil, errors.Annotatef(err, "MaxFeePerBlobGas %v", r.MaxFeePerBlobGas)
+		}
+	}
+	if r.BlobGasUsed != "" {
+		if fd.BlobGasUsed, err = hexutil.DecodeUint64(r.BlobGasUsed); err != nil {
+			return nil, errors.Annotatef(err, "BlobGasUsed %v", r.BlobGasUsed)
+		}
+	}
+	if r.BlobGasPrice != "" {
+		if fd.BlobGasPrice, err = hexutil.DecodeBig(r.BlobGasPrice); err != nil {
+			return nil, errors.Annotatef(err, "BlobGasPrice %v", r.BlobGasPrice)
+		}
+	}
+	fd.BlobVersionedHashes = r.BlobVersionedHashes
+	return fd, nil
+}
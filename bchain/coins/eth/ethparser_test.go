@@ -64,6 +64,30 @@ func TestEthParser_GetAddrDescFromAddress(t *testing.T) {
 	}
 }
 
+func TestEthParser_GetAddressesFromAddrDesc(t *testing.T) {
+	// test vectors of EIP-55
+	tests := []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	}
+	p := NewEthereumParser()
+	for _, want := range tests {
+		addrDesc, err := p.GetAddrDescFromAddress(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, searchable, err := p.GetAddressesFromAddrDesc(addrDesc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != want || !searchable {
+			t.Errorf("EthParser.GetAddressesFromAddrDesc() = %v, %v, want %v", got, searchable, want)
+		}
+	}
+}
+
 var (
 	testTx1, testTx2 bchain.Tx
 	testTxPacked1    = "08aebf0a1205012a05f20018a0f73622081234567890abcdef2a24f025caaf00000000000000000000000000000000000000000000000000000000000002253220e6b168d6bb3d8ed78e03dbf828b6bfd1fb613f6e129cba624964984553724c5d38f095af014092f4c1d5054a14682b7903a11098cf770c7aef4aa02a85b3f3601a5214dacc9c61754a0c4616fc5323dc946e89eb272302580162011b6a201bd40a31122c03918df6d166d740a6a3a22f08a25934ceb1688c62977661c80c7220607fbc15c1f7995a4258f5a9bccc63b040362d1991d5efe1361c56222e4ca89f"
@@ -79,14 +103,14 @@ func init() {
 		Txid:      "0xe6b168d6bb3d8ed78e03dbf828b6bfd1fb613f6e129cba624964984553724c5d",
 		Vin: []bchain.Vin{
 			{
-				Addresses: []string{"0xdacc9c61754a0c4616fc5323dc946e89eb272302"},
+				Addresses: []string{"0xDacC9C61754a0C4616FC5323dC946e89Eb272302"},
 			},
 		},
 		Vout: []bchain.Vout{
 			{
 				ValueSat: *big.NewInt(1311768467294899695),
 				ScriptPubKey: bchain.ScriptPubKey{
-					Addresses: []string{"0x682b7903a11098cf770c7aef4aa02a85b3f3601a"},
+					Addresses: []string{"0x682b7903a11098CF770C7aEF4Aa02A85b3f3601a"},
 				},
 			},
 		},
@@ -99,14 +123,14 @@ func init() {
 		Txid:      "0xcd647151552b5132b2aef7c9be00dc6f73afc5901dde157aab131335baaa853b",
 		Vin: []bchain.Vin{
 			{
-				Addresses: []string{"0x3e3a3d69dc66ba10737f531ed088954a9ec89d97"},
+				Addresses: []string{"0x3E3a3D69dc66bA10737F531ed088954a9EC89d97"},
 			},
 		},
 		Vout: []bchain.Vout{
 			{
 				ValueSat: *big.NewInt(33),
 				ScriptPubKey: bchain.ScriptPubKey{
-					Addresses: []string{"0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f"},
+					Addresses: []string{"0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f"},
 				},
 			},
 		},
@@ -207,3 +231,276 @@ func TestEthereumParser_UnpackTx(t *testing.T) {
 		})
 	}
 }
+
+func TestEthereumParser_GetTxNonce(t *testing.T) {
+	tests := []struct {
+		name    string
+		tx      *bchain.Tx
+		want    uint64
+		wantErr bool
+	}{
+		{
+			name: "1",
+			tx:   &testTx1,
+			want: 171950,
+		},
+		{
+			name: "2",
+			tx:   &testTx2,
+			want: 45676,
+		},
+		{
+			name:    "invalid hex",
+			tx:      &bchain.Tx{Hex: "xyz"},
+			wantErr: true,
+		},
+	}
+	p := NewEthereumParser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.GetTxNonce(tt.tx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EthereumParser.GetTxNonce() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("EthereumParser.GetTxNonce() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+var testRpcTx3 = rpcTransaction{
+	AccountNonce:         "0x1f",
+	Price:                "0x7e498f300",
+	GasLimit:             "0x5208",
+	To:                   "0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f",
+	Value:                "0x2386f26fc10000",
+	Payload:              "0x",
+	BlockNumber:          "0xc5d487",
+	From:                 "0x3e3a3d69dc66ba10737f531ed088954a9ec89d97",
+	TransactionIndex:     "0x3",
+	V:                    "0x1",
+	R:                    "0xf7161c170d43573ad9c8d701cdaf714ff2a548a562b0dc639230d17889fcd405",
+	S:                    "0x3c4977fc90385a27efa0032e17b49fd575b2826cb56e3d1ecf21524f2a94f915",
+	Type:                 "0x2",
+	MaxFeePerGas:         "0xba43b7400",
+	MaxPriorityFeePerGas: "0x0",
+}
+
+func TestEthereumParser_PackUnpackEIP1559Tx(t *testing.T) {
+	p := NewEthereumParser()
+	r := testRpcTx3
+	if err := setEffectiveGasPrice(&r, "0x7e498f300"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := p.ethTxToTx(&r, 1628166822, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.PackTx(tx, 12964999, 1628166822)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, height, err := p.UnpackTx(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 12964999 {
+		t.Errorf("EthereumParser.UnpackTx() height = %v, want %v", height, 12964999)
+	}
+	if !reflect.DeepEqual(got, tx) {
+		t.Errorf("EthereumParser.UnpackTx() got = %+v, want %+v", got, tx)
+	}
+}
+
+var testRpcTx4 = rpcTransaction{
+	AccountNonce:         "0x2b7",
+	Price:                "0x0",
+	GasLimit:             "0x5208",
+	To:                   "0xff00000000000000000000000000000000000000",
+	Value:                "0x0",
+	Payload:              "0x",
+	BlockNumber:          "0x12884e1",
+	From:                 "0x5050f69a9786f081509234f1a7f4684b5e5b76c9",
+	TransactionIndex:     "0x7",
+	V:                    "0x0",
+	R:                    "0x5a2b6e9d2b7d6e1c9cb0a3ab7bd8f6e12a4b3f0f1e8f0c6d2f7a9e3b1c4d5e6f",
+	S:                    "0x2f6c3e8a1b5d7f9e0c2a4b6d8f0e1c3a5b7d9f1e3c5a7b9d1f3e5c7a9b1d3f5e",
+	Type:                 "0x3",
+	MaxFeePerGas:         "0xba43b7400",
+	MaxPriorityFeePerGas: "0x3b9aca00",
+	MaxFeePerBlobGas:     "0x3b9aca00",
+	BlobVersionedHashes: []string{
+		"0x01b0761f87b081d5cf10757ccc89f12be355c70e2e29df288b65b30710dcbcd1",
+		"0x0136a45e6b57c7e2e9f2a0c7e3f1b6a0b8d2c4e6f8a0b2c4d6e8f0a2b4c6d8e0",
+	},
+	BlobGasUsed:  "0x40000",
+	BlobGasPrice: "0x1",
+}
+
+func TestEthereumParser_PackUnpackBlobTx(t *testing.T) {
+	p := NewEthereumParser()
+	r := testRpcTx4
+	if err := setEffectiveGasPrice(&r, "0x7e498f300"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := p.ethTxToTx(&r, 1710338135, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.PackTx(tx, 19432673, 1710338135)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, height, err := p.UnpackTx(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 19432673 {
+		t.Errorf("EthereumParser.UnpackTx() height = %v, want %v", height, 19432673)
+	}
+	if !reflect.DeepEqual(got, tx) {
+		t.Errorf("EthereumParser.UnpackTx() got = %+v, want %+v", got, tx)
+	}
+}
+
+func Test_blobCount(t *testing.T) {
+	tests := []struct {
+		blobGasUsed string
+		want        int
+		wantErr     bool
+	}{
+		{blobGasUsed: "", want: 0},
+		{blobGasUsed: "0x0", want: 0},
+		{blobGasUsed: "0xc0000", want: 6},
+		{blobGasUsed: "xyz", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := blobCount(tt.blobGasUsed)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("blobCount(%v) error = %v, wantErr %v", tt.blobGasUsed, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("blobCount(%v) = %v, want %v", tt.blobGasUsed, got, tt.want)
+		}
+	}
+}
+
+func Test_ethWithdrawalsToWithdrawals(t *testing.T) {
+	got, err := ethWithdrawalsToWithdrawals([]rpcWithdrawal{
+		{Index: "0x1a2b3c", ValidatorIndex: "0x6f4f2", Address: "0x555ee11fbddc0e49a9bab358a8941ad95ffdb48f", Amount: "0xf3d6d7"},
+		{Index: "0x1a2b3d", ValidatorIndex: "0x0", Address: "0x3e3a3d69dc66ba10737f531ed088954a9ec89d97", Amount: "0x0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		index, validatorIndex uint64
+		address, amount       string
+	}{
+		{1715004, 455922, "0x555Ee11FBDDc0E49A9bAB358A8941AD95fFDB48f", "15980247000000000"},
+		{1715005, 0, "0x3E3a3D69dc66bA10737F531ed088954a9EC89d97", "0"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ethWithdrawalsToWithdrawals() returned %d withdrawals, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := &got[i]
+		if g.Index != w.index || g.ValidatorIndex != w.validatorIndex || g.Address != w.address || g.AmountSat.String() != w.amount {
+			t.Errorf("ethWithdrawalsToWithdrawals()[%d] = %+v, want %+v", i, g, w)
+		}
+	}
+	if got, err = ethWithdrawalsToWithdrawals(nil); err != nil || got != nil {
+		t.Errorf("ethWithdrawalsToWithdrawals(nil) = %v, %v", got, err)
+	}
+	if _, err = ethWithdrawalsToWithdrawals([]rpcWithdrawal{{Index: "0x1", ValidatorIndex: "0x2", Amount: "xyz"}}); err == nil {
+		t.Error("ethWithdrawalsToWithdrawals() with invalid amount: expected error")
+	}
+}
+
+func TestEthereumParser_GetTxFeeData(t *testing.T) {
+	p := NewEthereumParser()
+	tests := []struct {
+		name    string
+		rpcTx   rpcTransaction
+		baseFee string
+		want    bchain.TxFeeData
+	}{
+		{
+			name:    "legacy",
+			rpcTx:   rpcTransaction{Price: "0x12a05f200", GasLimit: "0xdbba0", Value: "0x0"},
+			baseFee: "0x7e498f300",
+			want: bchain.TxFeeData{
+				GasLimit:          900000,
+				GasPrice:          big.NewInt(5000000000),
+				EffectiveGasPrice: big.NewInt(5000000000),
+			},
+		},
+		{
+			name:    "EIP-1559 priority fee",
+			rpcTx:   rpcTransaction{Price: "0x0", GasLimit: "0x5208", Value: "0x0", Type: "0x2", MaxFeePerGas: "0xba43b7400", MaxPriorityFeePerGas: "0x3b9aca00"},
+			baseFee: "0x7e498f300",
+			want: bchain.TxFeeData{
+				Type:                 2,
+				GasLimit:             21000,
+				GasPrice:             big.NewInt(0),
+				MaxFeePerGas:         big.NewInt(50000000000),
+				MaxPriorityFeePerGas: big.NewInt(1000000000),
+				EffectiveGasPrice:    big.NewInt(34900000000),
+			},
+		},
+		{
+			name:    "EIP-1559 capped by max fee",
+			rpcTx:   rpcTransaction{Price: "0x0", GasLimit: "0x5208", Value: "0x0", Type: "0x2", MaxFeePerGas: "0x7e498f300", MaxPriorityFeePerGas: "0x3b9aca00"},
+			baseFee: "0x7e498f300",
+			want: bchain.TxFeeData{
+				Type:                 2,
+				GasLimit:             21000,
+				GasPrice:             big.NewInt(0),
+				MaxFeePerGas:         big.NewInt(33900000000),
+				MaxPriorityFeePerGas: big.NewInt(1000000000),
+				EffectiveGasPrice:    big.NewInt(33900000000),
+			},
+		},
+		{
+			name:    "EIP-4844 blob",
+			rpcTx:   testRpcTx4,
+			baseFee: "0x7e498f300",
+			want: bchain.TxFeeData{
+				Type:                 3,
+				GasLimit:             21000,
+				GasPrice:             big.NewInt(0),
+				MaxFeePerGas:         big.NewInt(50000000000),
+				MaxPriorityFeePerGas: big.NewInt(1000000000),
+				EffectiveGasPrice:    big.NewInt(34900000000),
+				MaxFeePerBlobGas:     big.NewInt(1000000000),
+				BlobVersionedHashes: []string{
+					"0x01b0761f87b081d5cf10757ccc89f12be355c70e2e29df288b65b30710dcbcd1",
+					"0x0136a45e6b57c7e2e9f2a0c7e3f1b6a0b8d2c4e6f8a0b2c4d6e8f0a2b4c6d8e0",
+				},
+				BlobGasUsed:  262144,
+				BlobGasPrice: big.NewInt(1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := setEffectiveGasPrice(&tt.rpcTx, tt.baseFee); err != nil {
+				t.Fatal(err)
+			}
+			tx, err := p.ethTxToTx(&tt.rpcTx, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.GetTxFeeData(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("EthereumParser.GetTxFeeData() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -421,25 +421,99 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 	}
 	// TODO - this is probably not the correct size
 	bbh.Size = len(raw)
+	txs := make([]*rpcTransaction, len(body.Transactions))
+	for i := range body.Transactions {
+		txs[i] = &body.Transactions[i]
+	}
+	if err := b.setErc20Status(ctx, txs); err != nil {
+		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
+	}
 	btxs := make([]bchain.Tx, len(body.Transactions))
 	for i, tx := range body.Transactions {
+		if err := setEffectiveGasPrice(&tx, body.BaseFee); err != nil {
+			return nil, errors.Annotatef(err, "hash %v, height %v, txid %v", hash, height, tx.Hash.String())
+		}
+		if err := b.setBlobGas(ctx, &tx); err != nil {
+			return nil, errors.Annotatef(err, "hash %v, height %v, txid %v", hash, height, tx.Hash.String())
+		}
 		btx, err := b.Parser.ethTxToTx(&tx, int64(head.Time.Uint64()), uint32(bbh.Confirmations))
 		if err != nil {
 			return nil, errors.Annotatef(err, "hash %v, height %v, txid %v", hash, height, tx.Hash.String())
 		}
 		btxs[i] = *btx
 	}
+	withdrawals, err := ethWithdrawalsToWithdrawals(body.Withdrawals)
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
+	}
 	bbk := bchain.Block{
 		BlockHeader: *bbh,
 		Txs:         btxs,
+		Withdrawals: withdrawals,
 	}
 	return &bbk, nil
 }
 
+// setBlobGas sets the blob gas used and the blob gas price of the mined blob transaction, which are read from its receipt
+// because the blob gas price depends on the fork rules of the backend
+func (b *EthereumRPC) setBlobGas(ctx context.Context, tx *rpcTransaction) error {
+	if len(tx.BlobVersionedHashes) == 0 {
+		return nil
+	}
+	var r *rpcBlobReceipt
+	if err := b.rpc.CallContext(ctx, &r, "eth_getTransactionReceipt", tx.Hash); err != nil {
+		return errors.Annotatef(err, "eth_getTransactionReceipt")
+	}
+	if r == nil {
+		return errors.New("Receipt not found")
+	}
+	tx.BlobGasUsed = r.BlobGasUsed
+	tx.BlobGasPrice = r.BlobGasPrice
+	return nil
+}
+
 // GetBlockInfo returns extended header (more info than in bchain.BlockHeader) with a list of txids
 func (b *EthereumRPC) GetBlockInfo(hash string) (*bchain.BlockInfo, error) {
-	// TODO - implement
-	return nil, errors.New("Not implemented yet")
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var raw json.RawMessage
+	err := b.rpc.CallContext(ctx, &raw, "eth_getBlockByHash", ethcommon.HexToHash(hash), false)
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	} else if len(raw) == 0 {
+		return nil, bchain.ErrBlockNotFound
+	}
+	var head *ethtypes.Header
+	var body rpcBlockTxids
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	if head == nil {
+		return nil, bchain.ErrBlockNotFound
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	bbh, err := b.ethHeaderToBlockHeader(head)
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	bbh.Prev = ethHashToHash(head.ParentHash)
+	bbh.Size = len(raw)
+	blobs, err := blobCount(body.BlobGasUsed)
+	if err != nil {
+		return nil, errors.Annotatef(err, "hash %v", hash)
+	}
+	return &bchain.BlockInfo{
+		BlockHeader:   *bbh,
+		Nonce:         json.Number(strconv.FormatUint(head.Nonce.Uint64(), 10)),
+		Difficulty:    json.Number(head.Difficulty.String()),
+		Txids:         body.Transactions,
+		BaseFee:       body.BaseFee,
+		BlobGasUsed:   body.BlobGasUsed,
+		ExcessBlobGas: body.ExcessBlobGas,
+		BlobCount:     blobs,
+	}, nil
 }
 
 // GetTransactionForMempool returns a transaction by the transaction ID.
@@ -473,20 +547,36 @@ func (b *EthereumRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
 	} else {
-		// non mempool tx - we must read the block header to get the block time
+		// non mempool tx - we must read the block header to get the block time and the base fee
 		n, err := ethNumber(tx.BlockNumber)
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
-		h, err := b.client.HeaderByHash(ctx, *tx.BlockHash)
+		var h *rpcBlockTxids
+		err = b.rpc.CallContext(ctx, &h, "eth_getBlockByHash", *tx.BlockHash, false)
+		if err != nil {
+			return nil, errors.Annotatef(err, "txid %v", txid)
+		} else if h == nil {
+			return nil, errors.Annotatef(bchain.ErrBlockNotFound, "txid %v", txid)
+		}
+		bt, err := ethNumber(h.Time)
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
+		if err = setEffectiveGasPrice(tx, h.BaseFee); err != nil {
+			return nil, errors.Annotatef(err, "txid %v", txid)
+		}
+		if err = b.setBlobGas(ctx, tx); err != nil {
+			return nil, errors.Annotatef(err, "txid %v", txid)
+		}
+		if err = b.setErc20Status(ctx, []*rpcTransaction{tx}); err != nil {
+			return nil, errors.Annotatef(err, "txid %v", txid)
+		}
 		confirmations, err := b.computeConfirmations(uint64(n))
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
-		btx, err = b.Parser.ethTxToTx(tx, h.Time.Int64(), confirmations)
+		btx, err = b.Parser.ethTxToTx(tx, bt, confirmations)
 		if err != nil {
 			return nil, errors.Annotatef(err, "txid %v", txid)
 		}
@@ -553,6 +643,18 @@ func (b *EthereumRPC) EstimateSmartFee(blocks int, conservative bool) (big.Int,
 	return r, nil
 }
 
+// IsContract checks if there is a contract code at the address in the latest block
+func (b *EthereumRPC) IsContract(addrDesc bchain.AddressDescriptor) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	address := ethcommon.BytesToAddress(addrDesc)
+	code, err := b.client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, errors.Annotatef(err, "address %v", address.Hex())
+	}
+	return len(code) > 0, nil
+}
+
 // SendRawTransaction sends raw transaction.
 func (b *EthereumRPC) SendRawTransaction(hex string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
@@ -574,6 +676,11 @@ func (b *EthereumRPC) SendRawTransaction(hex string) (string, error) {
 	return result, nil
 }
 
+// TestMempoolAccept is not supported by the ethereum backends
+func (b *EthereumRPC) TestMempoolAccept(hex string) (*bchain.MempoolAcceptResult, error) {
+	return nil, bchain.ErrNotSupported
+}
+
 func (b *EthereumRPC) ResyncMempool(onNewTxAddr bchain.OnNewTxAddrFunc) (int, error) {
 	return b.Mempool.Resync(onNewTxAddr)
 }
@@ -588,6 +695,21 @@ func (b *EthereumRPC) GetMempoolTransactionsForAddrDesc(addrDesc bchain.AddressD
 	return b.Mempool.GetAddrDescTransactions(addrDesc)
 }
 
+// TrackMempoolEvictions enables the tracking of the transactions removed from the mempool without being confirmed
+func (b *EthereumRPC) TrackMempoolEvictions(isConfirmed bchain.IsTxConfirmedFunc, isSpent bchain.IsOutpointSpentFunc, onEviction bchain.OnMempoolEvictionFunc) {
+	b.Mempool.TrackEvictions(isConfirmed, isSpent, onEviction)
+}
+
+// GetMempoolEviction returns the record of the transaction removed from the mempool without being confirmed
+func (b *EthereumRPC) GetMempoolEviction(txid string) (*bchain.MempoolEviction, error) {
+	return b.Mempool.GetEviction(txid), nil
+}
+
+// GetMempoolPackage is not supported, ethereum transactions do not spend outputs of other transactions
+func (b *EthereumRPC) GetMempoolPackage(txid string) (*bchain.MempoolPackage, error) {
+	return nil, bchain.ErrNotSupported
+}
+
 func (b *EthereumRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error) {
 	return nil, errors.New("GetMempoolEntry: not implemented")
 }
@@ -0,0 +1,42 @@
+package eth
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/juju/errors"
+)
+
+// signatureLen is the length of the signature of message, 32 bytes R, 32 bytes S and 1 byte V
+const signatureLen = 65
+
+// signedMessageHash returns the hash of the message as signed by personal_sign (EIP-191 version 0x45)
+func signedMessageHash(message string) []byte {
+	return crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+}
+
+// VerifyMessage verifies the hex encoded signature of the message created by personal_sign or eth_sign of the address
+func (p *EthereumParser) VerifyMessage(addrDesc bchain.AddressDescriptor, signature, message string) (bool, error) {
+	if has0xPrefix(signature) {
+		signature = signature[2:]
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != signatureLen {
+		return false, errors.New("Invalid signature, expecting hex encoded 65 bytes")
+	}
+	// the wallets use V 27 or 28, the recovery expects 0 or 1
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	if sig[64] > 1 {
+		return false, errors.Errorf("Invalid signature recovery id %d", sig[64])
+	}
+	pub, err := crypto.SigToPub(signedMessageHash(message), sig)
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(addrDesc, crypto.PubkeyToAddress(*pub).Bytes()), nil
+}
@@ -0,0 +1,52 @@
+// +build unittest
+
+package eth
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestEthereumParser_VerifyMessage(t *testing.T) {
+	p := NewEthereumParser()
+	key, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrDesc := crypto.PubkeyToAddress(key.PublicKey).Bytes()
+	message := "This is an example of a signed message."
+	sig, err := crypto.Sign(signedMessageHash(message), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the wallets return V 27 or 28
+	sig[64] += 27
+	signature := "0x" + hex.EncodeToString(sig)
+	tests := []struct {
+		name      string
+		addrDesc  []byte
+		signature string
+		message   string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "valid", addrDesc: addrDesc, signature: signature, message: message, want: true},
+		{name: "valid without prefix", addrDesc: addrDesc, signature: signature[2:], message: message, want: true},
+		{name: "other message", addrDesc: addrDesc, signature: signature, message: message + "!"},
+		{name: "other address", addrDesc: make([]byte, 20), signature: signature, message: message},
+		{name: "invalid signature", addrDesc: addrDesc, signature: signature[:20], message: message, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.VerifyMessage(tt.addrDesc, tt.signature, tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EthereumParser.VerifyMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("EthereumParser.VerifyMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
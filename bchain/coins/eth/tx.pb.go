@@ -5,9 +5,11 @@
 Package eth is a generated protocol buffer package.
 
 It is generated from these files:
+
 	tx.proto
 
 It has these top-level messages:
+
 	ProtoTransaction
 */
 package eth
@@ -28,20 +30,29 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type ProtoTransaction struct {
-	AccountNonce     uint64 `protobuf:"varint,1,opt,name=AccountNonce" json:"AccountNonce,omitempty"`
-	Price            []byte `protobuf:"bytes,2,opt,name=Price,proto3" json:"Price,omitempty"`
-	GasLimit         uint64 `protobuf:"varint,3,opt,name=GasLimit" json:"GasLimit,omitempty"`
-	Value            []byte `protobuf:"bytes,4,opt,name=Value,proto3" json:"Value,omitempty"`
-	Payload          []byte `protobuf:"bytes,5,opt,name=Payload,proto3" json:"Payload,omitempty"`
-	Hash             []byte `protobuf:"bytes,6,opt,name=Hash,proto3" json:"Hash,omitempty"`
-	BlockNumber      uint32 `protobuf:"varint,7,opt,name=BlockNumber" json:"BlockNumber,omitempty"`
-	BlockTime        uint64 `protobuf:"varint,8,opt,name=BlockTime" json:"BlockTime,omitempty"`
-	To               []byte `protobuf:"bytes,9,opt,name=To,proto3" json:"To,omitempty"`
-	From             []byte `protobuf:"bytes,10,opt,name=From,proto3" json:"From,omitempty"`
-	TransactionIndex uint32 `protobuf:"varint,11,opt,name=TransactionIndex" json:"TransactionIndex,omitempty"`
-	V                []byte `protobuf:"bytes,12,opt,name=V,proto3" json:"V,omitempty"`
-	R                []byte `protobuf:"bytes,13,opt,name=R,proto3" json:"R,omitempty"`
-	S                []byte `protobuf:"bytes,14,opt,name=S,proto3" json:"S,omitempty"`
+	AccountNonce         uint64   `protobuf:"varint,1,opt,name=AccountNonce" json:"AccountNonce,omitempty"`
+	Price                []byte   `protobuf:"bytes,2,opt,name=Price,proto3" json:"Price,omitempty"`
+	GasLimit             uint64   `protobuf:"varint,3,opt,name=GasLimit" json:"GasLimit,omitempty"`
+	Value                []byte   `protobuf:"bytes,4,opt,name=Value,proto3" json:"Value,omitempty"`
+	Payload              []byte   `protobuf:"bytes,5,opt,name=Payload,proto3" json:"Payload,omitempty"`
+	Hash                 []byte   `protobuf:"bytes,6,opt,name=Hash,proto3" json:"Hash,omitempty"`
+	BlockNumber          uint32   `protobuf:"varint,7,opt,name=BlockNumber" json:"BlockNumber,omitempty"`
+	BlockTime            uint64   `protobuf:"varint,8,opt,name=BlockTime" json:"BlockTime,omitempty"`
+	To                   []byte   `protobuf:"bytes,9,opt,name=To,proto3" json:"To,omitempty"`
+	From                 []byte   `protobuf:"bytes,10,opt,name=From,proto3" json:"From,omitempty"`
+	TransactionIndex     uint32   `protobuf:"varint,11,opt,name=TransactionIndex" json:"TransactionIndex,omitempty"`
+	V                    []byte   `protobuf:"bytes,12,opt,name=V,proto3" json:"V,omitempty"`
+	R                    []byte   `protobuf:"bytes,13,opt,name=R,proto3" json:"R,omitempty"`
+	S                    []byte   `protobuf:"bytes,14,opt,name=S,proto3" json:"S,omitempty"`
+	Type                 uint32   `protobuf:"varint,15,opt,name=Type" json:"Type,omitempty"`
+	MaxFeePerGas         []byte   `protobuf:"bytes,16,opt,name=MaxFeePerGas,proto3" json:"MaxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas []byte   `protobuf:"bytes,17,opt,name=MaxPriorityFeePerGas,proto3" json:"MaxPriorityFeePerGas,omitempty"`
+	EffectiveGasPrice    []byte   `protobuf:"bytes,18,opt,name=EffectiveGasPrice,proto3" json:"EffectiveGasPrice,omitempty"`
+	MaxFeePerBlobGas     []byte   `protobuf:"bytes,19,opt,name=MaxFeePerBlobGas,proto3" json:"MaxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes  [][]byte `protobuf:"bytes,20,rep,name=BlobVersionedHashes,proto3" json:"BlobVersionedHashes,omitempty"`
+	BlobGasUsed          uint64   `protobuf:"varint,21,opt,name=BlobGasUsed" json:"BlobGasUsed,omitempty"`
+	BlobGasPrice         []byte   `protobuf:"bytes,22,opt,name=BlobGasPrice,proto3" json:"BlobGasPrice,omitempty"`
+	Failed               bool     `protobuf:"varint,23,opt,name=Failed" json:"Failed,omitempty"`
 }
 
 func (m *ProtoTransaction) Reset()                    { *m = ProtoTransaction{} }
@@ -147,6 +158,69 @@ func (m *ProtoTransaction) GetS() []byte {
 	return nil
 }
 
+func (m *ProtoTransaction) GetType() uint32 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *ProtoTransaction) GetMaxFeePerGas() []byte {
+	if m != nil {
+		return m.MaxFeePerGas
+	}
+	return nil
+}
+
+func (m *ProtoTransaction) GetMaxPriorityFeePerGas() []byte {
+	if m != nil {
+		return m.MaxPriorityFeePerGas
+	}
+	return nil
+}
+
+func (m *ProtoTransaction) GetEffectiveGasPrice() []byte {
+	if m != nil {
+		return m.EffectiveGasPrice
+	}
+	return nil
+}
+
+func (m *ProtoTransaction) GetMaxFeePerBlobGas() []byte {
+	if m != nil {
+		return m.MaxFeePerBlobGas
+	}
+	return nil
+}
+
+func (m *ProtoTransaction) GetBlobVersionedHashes() [][]byte {
+	if m != nil {
+		return m.BlobVersionedHashes
+	}
+	return nil
+}
+
+func (m *ProtoTransaction) GetBlobGasUsed() uint64 {
+	if m != nil {
+		return m.BlobGasUsed
+	}
+	return 0
+}
+
+func (m *ProtoTransaction) GetBlobGasPrice() []byte {
+	if m != nil {
+		return m.BlobGasPrice
+	}
+	return nil
+}
+
+func (m *ProtoTransaction) GetFailed() bool {
+	if m != nil {
+		return m.Failed
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*ProtoTransaction)(nil), "eth.ProtoTransaction")
 }
@@ -154,22 +228,30 @@ func init() {
 func init() { proto.RegisterFile("tx.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 262 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x90, 0xbd, 0x6a, 0xeb, 0x40,
-	0x10, 0x85, 0x59, 0x59, 0xb6, 0xe5, 0xb1, 0x6c, 0xcc, 0x70, 0x8b, 0xe1, 0x92, 0x42, 0xb8, 0x12,
-	0x29, 0xd2, 0xe4, 0x09, 0x92, 0x22, 0x3f, 0x10, 0x8c, 0x90, 0x85, 0xfa, 0xf5, 0x7a, 0xc1, 0x22,
-	0x92, 0x26, 0x48, 0x2b, 0x70, 0x5e, 0x38, 0xcf, 0x11, 0x76, 0x44, 0x12, 0x87, 0x74, 0xf3, 0x7d,
-	0x70, 0xf6, 0x2c, 0x07, 0x22, 0x77, 0xbe, 0x79, 0xeb, 0xd8, 0x31, 0x4e, 0xac, 0x3b, 0x6d, 0x3f,
-	0x02, 0xd8, 0x64, 0x1e, 0x8b, 0x4e, 0xb7, 0xbd, 0x36, 0xae, 0xe2, 0x16, 0xb7, 0x10, 0xdf, 0x19,
-	0xc3, 0x43, 0xeb, 0x76, 0xdc, 0x1a, 0x4b, 0x2a, 0x51, 0x69, 0x98, 0xff, 0x72, 0xf8, 0x0f, 0xa6,
-	0x59, 0x57, 0x19, 0x4b, 0x41, 0xa2, 0xd2, 0x38, 0x1f, 0x01, 0xff, 0x43, 0xf4, 0xa8, 0xfb, 0x97,
-	0xaa, 0xa9, 0x1c, 0x4d, 0x24, 0xf5, 0xcd, 0x3e, 0x51, 0xea, 0x7a, 0xb0, 0x14, 0x8e, 0x09, 0x01,
-	0x24, 0x98, 0x67, 0xfa, 0xbd, 0x66, 0x7d, 0xa4, 0xa9, 0xf8, 0x2f, 0x44, 0x84, 0xf0, 0x49, 0xf7,
-	0x27, 0x9a, 0x89, 0x96, 0x1b, 0x13, 0x58, 0xde, 0xd7, 0x6c, 0x5e, 0x77, 0x43, 0x73, 0xb0, 0x1d,
-	0xcd, 0x13, 0x95, 0xae, 0xf2, 0x4b, 0x85, 0x57, 0xb0, 0x10, 0x2c, 0xaa, 0xc6, 0x52, 0x24, 0x5f,
-	0xf8, 0x11, 0xb8, 0x86, 0xa0, 0x60, 0x5a, 0xc8, 0x8b, 0x41, 0xc1, 0xbe, 0xe3, 0xa1, 0xe3, 0x86,
-	0x60, 0xec, 0xf0, 0x37, 0x5e, 0xc3, 0xe6, 0x62, 0x8c, 0xe7, 0xf6, 0x68, 0xcf, 0xb4, 0x94, 0xa2,
-	0x3f, 0x1e, 0x63, 0x50, 0x25, 0xc5, 0x12, 0x56, 0xa5, 0xa7, 0x9c, 0x56, 0x23, 0xe5, 0x9e, 0xf6,
-	0xb4, 0x1e, 0x69, 0x7f, 0x98, 0xc9, 0xe8, 0xb7, 0x9f, 0x01, 0x00, 0x00, 0xff, 0xff, 0x15, 0xc8,
-	0xe4, 0x30, 0x80, 0x01, 0x00, 0x00,
+	// 385 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6d, 0x92, 0xdb, 0x4e, 0xc2, 0x40,
+	0x10, 0x86, 0xc3, 0xb9, 0x0c, 0x05, 0x61, 0x40, 0x9c, 0x18, 0x2f, 0x08, 0x57, 0xc6, 0x18, 0x63,
+	0xf4, 0x09, 0x34, 0x11, 0x35, 0x51, 0x42, 0x4a, 0xe5, 0x7e, 0x29, 0x4b, 0x68, 0x84, 0x2e, 0x69,
+	0x8b, 0x81, 0x77, 0xf3, 0xe1, 0xdc, 0x9d, 0x22, 0x94, 0xc0, 0xdd, 0x7c, 0xff, 0x9c, 0xb6, 0xff,
+	0x14, 0xac, 0x78, 0x7d, 0xb7, 0x0c, 0x55, 0xac, 0x30, 0x27, 0xe3, 0x59, 0xf7, 0xb7, 0x00, 0xf5,
+	0x81, 0x41, 0x37, 0x14, 0x41, 0x24, 0xbc, 0xd8, 0x57, 0x01, 0x76, 0xc1, 0x7e, 0xf2, 0x3c, 0xb5,
+	0x0a, 0xe2, 0xbe, 0x0a, 0x3c, 0x49, 0x99, 0x4e, 0xe6, 0x3a, 0xef, 0x1c, 0x68, 0xd8, 0x82, 0xc2,
+	0x20, 0xf4, 0x75, 0x32, 0xab, 0x93, 0xb6, 0x93, 0x00, 0x5e, 0x82, 0xf5, 0x2a, 0xa2, 0x0f, 0x7f,
+	0xe1, 0xc7, 0x94, 0xe3, 0xae, 0x1d, 0x9b, 0x8e, 0x91, 0x98, 0xaf, 0x24, 0xe5, 0x93, 0x0e, 0x06,
+	0x24, 0x28, 0x0d, 0xc4, 0x66, 0xae, 0xc4, 0x84, 0x0a, 0xac, 0xff, 0x23, 0x22, 0xe4, 0xdf, 0x44,
+	0x34, 0xa3, 0x22, 0xcb, 0x1c, 0x63, 0x07, 0x2a, 0xcf, 0x73, 0xe5, 0x7d, 0xf7, 0x57, 0x8b, 0xb1,
+	0x0c, 0xa9, 0xa4, 0x53, 0x55, 0x27, 0x2d, 0xe1, 0x15, 0x94, 0x19, 0x5d, 0x7f, 0x21, 0xc9, 0xe2,
+	0x27, 0xec, 0x05, 0xac, 0x41, 0xd6, 0x55, 0x54, 0xe6, 0x89, 0x3a, 0x32, 0x3b, 0x7a, 0xa1, 0x5a,
+	0x10, 0x24, 0x3b, 0x4c, 0x8c, 0x37, 0x50, 0x4f, 0x99, 0xf1, 0x1e, 0x4c, 0xe4, 0x9a, 0x2a, 0xbc,
+	0xe8, 0x48, 0x47, 0x1b, 0x32, 0x23, 0xb2, 0xb9, 0x39, 0x33, 0x32, 0xe4, 0x50, 0x35, 0x21, 0xc7,
+	0xd0, 0x90, 0x6a, 0x09, 0x0d, 0xcd, 0x26, 0x77, 0xb3, 0x94, 0x74, 0xc6, 0x93, 0x38, 0x36, 0x3e,
+	0x7f, 0x8a, 0x75, 0x4f, 0xca, 0x81, 0x0c, 0xb5, 0x4d, 0x54, 0xe7, 0xe2, 0x03, 0x0d, 0x1f, 0xa0,
+	0xa5, 0x59, 0xbb, 0xab, 0x42, 0x3f, 0xde, 0xec, 0x6b, 0x1b, 0x5c, 0x7b, 0x32, 0x87, 0xb7, 0xd0,
+	0x78, 0x99, 0x4e, 0xa5, 0x7e, 0xe7, 0x8f, 0xd4, 0x9c, 0xdc, 0x09, 0xb9, 0xe1, 0x38, 0x61, 0xbe,
+	0x77, 0xb7, 0x51, 0x3b, 0x35, 0x36, 0xd3, 0x9b, 0x5c, 0x7c, 0xa4, 0xe3, 0x3d, 0x34, 0x4d, 0x38,
+	0x92, 0x61, 0xa4, 0x3d, 0x90, 0x13, 0x73, 0x14, 0x19, 0x51, 0xab, 0x93, 0xd3, 0xe5, 0xa7, 0x52,
+	0xdb, 0x8b, 0x99, 0xe6, 0xaf, 0x48, 0x4e, 0xe8, 0x9c, 0x2f, 0x92, 0x96, 0x8c, 0x0b, 0x5b, 0x4c,
+	0x1e, 0xda, 0x4e, 0x5c, 0x48, 0x6b, 0xd8, 0x86, 0x62, 0x4f, 0xf8, 0x73, 0x3d, 0xe0, 0x42, 0x67,
+	0x2d, 0x67, 0x4b, 0xe3, 0x22, 0xff, 0xca, 0x8f, 0x7f, 0xfc, 0x96, 0xe7, 0x58, 0xd6, 0x02, 0x00,
+	0x00,
 }
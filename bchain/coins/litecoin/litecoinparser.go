@@ -16,6 +16,7 @@ const (
 var (
 	MainNetParams chaincfg.Params
 	TestNetParams chaincfg.Params
+	RegtestParams chaincfg.Params
 )
 
 func init() {
@@ -30,6 +31,12 @@ func init() {
 	TestNetParams.PubKeyHashAddrID = []byte{111}
 	TestNetParams.ScriptHashAddrID = []byte{58}
 	TestNetParams.Bech32HRPSegwit = "tltc"
+
+	RegtestParams = chaincfg.RegressionNetParams
+	RegtestParams.Net = RegtestMagic
+	RegtestParams.PubKeyHashAddrID = []byte{111}
+	RegtestParams.ScriptHashAddrID = []byte{58}
+	RegtestParams.Bech32HRPSegwit = "rltc"
 }
 
 // LitecoinParser handle
@@ -39,11 +46,21 @@ type LitecoinParser struct {
 
 // NewLitecoinParser returns new LitecoinParser instance
 func NewLitecoinParser(params *chaincfg.Params, c *btc.Configuration) *LitecoinParser {
-	return &LitecoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &LitecoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	// the subsidy of regtest is halved every 150 blocks, as in Bitcoin regtest
+	switch params {
+	case &RegtestParams:
+		p.InitialSubsidy, p.SubsidyHalvingInterval = 50*1e8, 150
+	default:
+		p.InitialSubsidy, p.SubsidyHalvingInterval = 50*1e8, 840000
+	}
+	p.SignedMessageMagic = "Litecoin Signed Message:\n"
+	p.PaymentURIScheme = "litecoin"
+	return p
 }
 
 // GetChainParams contains network parameters for the main Litecoin network,
-// and the test Litecoin network
+// the test Litecoin network and the regtest Litecoin network
 func GetChainParams(chain string) *chaincfg.Params {
 	// register bitcoin parameters in addition to litecoin parameters
 	// litecoin has dual standard of addresses and we want to be able to
@@ -56,6 +73,9 @@ func GetChainParams(chain string) *chaincfg.Params {
 		if err == nil {
 			err = chaincfg.Register(&TestNetParams)
 		}
+		if err == nil {
+			err = chaincfg.Register(&RegtestParams)
+		}
 		if err != nil {
 			panic(err)
 		}
@@ -63,6 +83,8 @@ func GetChainParams(chain string) *chaincfg.Params {
 	switch chain {
 	case "test":
 		return &TestNetParams
+	case "regtest":
+		return &RegtestParams
 	default:
 		return &MainNetParams
 	}
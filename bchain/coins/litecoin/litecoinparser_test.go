@@ -286,3 +286,32 @@ func Test_UnpackTx(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetBlockSubsidy(t *testing.T) {
+	tests := []struct {
+		name   string
+		chain  string
+		height uint32
+		want   int64
+	}{
+		{"main genesis", "main", 0, 5000000000},
+		{"main before halving", "main", 839999, 5000000000},
+		{"main first halving", "main", 840000, 2500000000},
+		{"test first halving", "test", 840000, 2500000000},
+		{"regtest before halving", "regtest", 149, 5000000000},
+		{"regtest first halving", "regtest", 150, 2500000000},
+		{"regtest second halving", "regtest", 300, 1250000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewLitecoinParser(GetChainParams(tt.chain), &btc.Configuration{})
+			got, err := parser.GetBlockSubsidy(tt.height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Int64() != tt.want {
+				t.Errorf("GetBlockSubsidy(%v) = %v, want %v", tt.height, got, tt.want)
+			}
+		})
+	}
+}
@@ -38,7 +38,10 @@ type MonacoinParser struct {
 
 // NewMonacoinParser returns new MonacoinParser instance
 func NewMonacoinParser(params *chaincfg.Params, c *btc.Configuration) *MonacoinParser {
-	return &MonacoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &MonacoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p.SignedMessageMagic = "Monacoin Signed Message:\n"
+	p.PaymentURIScheme = "monacoin"
+	return p
 }
 
 // GetChainParams contains network parameters for the main Monacoin network,
@@ -32,7 +32,10 @@ type NamecoinParser struct {
 
 // NewNamecoinParser returns new NamecoinParser instance
 func NewNamecoinParser(params *chaincfg.Params, c *btc.Configuration) *NamecoinParser {
-	return &NamecoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &NamecoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p.SignedMessageMagic = "Namecoin Signed Message:\n"
+	p.PaymentURIScheme = "namecoin"
+	return p
 }
 
 // GetChainParams contains network parameters for the main Namecoin network,
@@ -3,6 +3,7 @@
 package namecoin
 
 import (
+	"blockbook/bchain"
 	"blockbook/bchain/coins/btc"
 	"bytes"
 	"encoding/hex"
@@ -130,3 +131,83 @@ func TestParseBlock(t *testing.T) {
 		}
 	}
 }
+
+func Test_GetNameOperation(t *testing.T) {
+	owner := "76a91480ad90d403581fa3bf46086a91b2d9d4125db6c188ac"
+	tests := []struct {
+		name   string
+		script string
+		want   *bchain.NameOperation
+	}{
+		{
+			name:   "name_new",
+			script: "5114a08eae93007f22668ab5e4a9c83c8cd1c325e3e06d" + owner,
+			want:   &bchain.NameOperation{Op: bchain.NameOpNew, Hash: hexToBytes("a08eae93007f22668ab5e4a9c83c8cd1c325e3e0")},
+		},
+		{
+			name:   "name_firstupdate",
+			script: "5209642f6578616d706c6502abcd107b226970223a22312e322e332e34227d6d6d" + owner,
+			want:   &bchain.NameOperation{Op: bchain.NameOpFirstUpdate, Name: []byte("d/example"), Value: []byte(`{"ip":"1.2.3.4"}`)},
+		},
+		{
+			name:   "name_update empty value",
+			script: "5309642f6578616d706c65006d75" + owner,
+			want:   &bchain.NameOperation{Op: bchain.NameOpUpdate, Name: []byte("d/example"), Value: []byte{}},
+		},
+		{
+			name:   "P2PKH",
+			script: owner,
+		},
+		{
+			name:   "truncated",
+			script: "5309642f65",
+		},
+		{
+			name:   "missing drop",
+			script: "5309642f6578616d706c65006d" + owner,
+		},
+	}
+	parser := NewNamecoinParser(GetChainParams("main"), &btc.Configuration{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.GetNameOperation(hexToBytes(tt.script))
+			if err != nil {
+				t.Fatalf("GetNameOperation() error = %v", err)
+			}
+			if tt.want != nil {
+				tt.want.Owner = hexToBytes(owner)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetNameOperation() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GetNameExpirationDepth(t *testing.T) {
+	p := NewNamecoinParser(GetChainParams("main"), &btc.Configuration{})
+	for _, tt := range []struct {
+		height uint32
+		want   uint32
+	}{
+		{0, 12000},
+		{23999, 12000},
+		{24000, 12000},
+		{30000, 18000},
+		{47999, 35999},
+		{48000, 36000},
+		{500000, 36000},
+	} {
+		if got := p.GetNameExpirationDepth(tt.height); got != tt.want {
+			t.Errorf("GetNameExpirationDepth(%v) = %v, want %v", tt.height, got, tt.want)
+		}
+	}
+}
+
+func hexToBytes(h string) []byte {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
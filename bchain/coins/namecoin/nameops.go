@@ -0,0 +1,118 @@
+package namecoin
+
+import (
+	"blockbook/bchain"
+	"encoding/binary"
+
+	"github.com/jakm/btcutil/txscript"
+)
+
+// the name operations are the prefixes of the output scripts:
+// name_new:         OP_1 <hash> OP_2DROP <owner script>
+// name_firstupdate: OP_2 <name> <rand> <value> OP_2DROP OP_2DROP <owner script>
+// name_update:      OP_3 <name> <value> OP_2DROP OP_DROP <owner script>
+const (
+	opNameNew         = txscript.OP_1
+	opNameFirstUpdate = txscript.OP_2
+	opNameUpdate      = txscript.OP_3
+)
+
+// readPush reads the data pushed by the opcode at the beginning of the script,
+// returns the data and the rest of the script or false if the script does not start with a data push
+func readPush(s []byte) ([]byte, []byte, bool) {
+	if len(s) == 0 {
+		return nil, nil, false
+	}
+	op := s[0]
+	s = s[1:]
+	var l int
+	switch {
+	case op == txscript.OP_0:
+		return []byte{}, s, true
+	case op <= txscript.OP_DATA_75:
+		l = int(op)
+	case op == txscript.OP_PUSHDATA1:
+		if len(s) < 1 {
+			return nil, nil, false
+		}
+		l = int(s[0])
+		s = s[1:]
+	case op == txscript.OP_PUSHDATA2:
+		if len(s) < 2 {
+			return nil, nil, false
+		}
+		l = int(binary.LittleEndian.Uint16(s))
+		s = s[2:]
+	case op == txscript.OP_PUSHDATA4:
+		if len(s) < 4 {
+			return nil, nil, false
+		}
+		l = int(binary.LittleEndian.Uint32(s))
+		s = s[4:]
+	default:
+		return nil, nil, false
+	}
+	if l < 0 || l > len(s) {
+		return nil, nil, false
+	}
+	return s[:l], s[l:], true
+}
+
+// readPushes reads n data pushes followed by the drop opcodes
+func readPushes(s []byte, n int, drops ...byte) ([][]byte, []byte, bool) {
+	pushes := make([][]byte, n)
+	var ok bool
+	for i := range pushes {
+		if pushes[i], s, ok = readPush(s); !ok {
+			return nil, nil, false
+		}
+	}
+	for _, d := range drops {
+		if len(s) == 0 || s[0] != d {
+			return nil, nil, false
+		}
+		s = s[1:]
+	}
+	return pushes, s, true
+}
+
+// GetNameOperation returns the Namecoin name operation contained in the output script or nil if the script does not contain any
+func (p *NamecoinParser) GetNameOperation(addrDesc bchain.AddressDescriptor) (*bchain.NameOperation, error) {
+	if len(addrDesc) == 0 {
+		return nil, nil
+	}
+	s := []byte(addrDesc[1:])
+	switch addrDesc[0] {
+	case opNameNew:
+		pushes, owner, ok := readPushes(s, 1, txscript.OP_2DROP)
+		if !ok {
+			return nil, nil
+		}
+		return &bchain.NameOperation{Op: bchain.NameOpNew, Hash: pushes[0], Owner: owner}, nil
+	case opNameFirstUpdate:
+		pushes, owner, ok := readPushes(s, 3, txscript.OP_2DROP, txscript.OP_2DROP)
+		if !ok {
+			return nil, nil
+		}
+		return &bchain.NameOperation{Op: bchain.NameOpFirstUpdate, Name: pushes[0], Value: pushes[2], Owner: owner}, nil
+	case opNameUpdate:
+		pushes, owner, ok := readPushes(s, 2, txscript.OP_2DROP, txscript.OP_DROP)
+		if !ok {
+			return nil, nil
+		}
+		return &bchain.NameOperation{Op: bchain.NameOpUpdate, Name: pushes[0], Value: pushes[1], Owner: owner}, nil
+	}
+	return nil, nil
+}
+
+// GetNameExpirationDepth returns the name expiration depth of Namecoin at the height, the depth was 12000 blocks
+// before the height 24000, then it was increasing by one block per block up to 36000 blocks at the height 48000
+func (p *NamecoinParser) GetNameExpirationDepth(height uint32) uint32 {
+	if height < 24000 {
+		return 12000
+	}
+	if height < 48000 {
+		return height - 12000
+	}
+	return 36000
+}
@@ -39,7 +39,10 @@ type VertcoinParser struct {
 
 // NewVertcoinParser returns new VertcoinParser instance
 func NewVertcoinParser(params *chaincfg.Params, c *btc.Configuration) *VertcoinParser {
-	return &VertcoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p := &VertcoinParser{BitcoinParser: btc.NewBitcoinParser(params, c)}
+	p.SignedMessageMagic = "Vertcoin Signed Message:\n"
+	p.PaymentURIScheme = "vertcoin"
+	return p
 }
 
 // GetChainParams contains network parameters for the main Vertcoin network,
@@ -49,10 +49,13 @@ type ZCashParser struct {
 
 // NewZCashParser returns new ZCashParser instance
 func NewZCashParser(params *chaincfg.Params, c *btc.Configuration) *ZCashParser {
-	return &ZCashParser{
+	p := &ZCashParser{
 		BitcoinParser: btc.NewBitcoinParser(params, c),
 		baseparser:    &bchain.BaseParser{},
 	}
+	p.SignedMessageMagic = "Zcash Signed Message:\n"
+	p.PaymentURIScheme = "zcash"
+	return p
 }
 
 // GetChainParams contains network parameters for the main ZCash network,
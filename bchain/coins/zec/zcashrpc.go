@@ -120,6 +120,11 @@ func (z *ZCashRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error) {
 	return nil, errors.New("GetMempoolEntry: not implemented")
 }
 
+// TestMempoolAccept is not supported by zcashd
+func (z *ZCashRPC) TestMempoolAccept(tx string) (*bchain.MempoolAcceptResult, error) {
+	return nil, bchain.ErrNotSupported
+}
+
 func isErrBlockNotFound(err *bchain.RPCError) bool {
 	return err.Message == "Block not found" ||
 		err.Message == "Block height out of range"
@@ -0,0 +1,150 @@
+package bchain
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// mempoolEvictionGrace is the time after which a transaction removed from the mempool is classified,
+	// the block containing the transaction is expected to be indexed by then
+	mempoolEvictionGrace = time.Minute
+	// mempoolEvictionRetention is the time for which the records of the evicted transactions are kept
+	mempoolEvictionRetention = 24 * time.Hour
+	// mempoolExpiry is the default mempool expiry of bitcoind (parameter -mempoolexpiry)
+	mempoolExpiry = 336 * time.Hour
+)
+
+// mempoolEvictions tracks the transactions disappearing from the mempool, the tracking is disabled until isConfirmed is set
+// FirstSeen is the time when the transaction was first seen in the mempool by this process
+type mempoolEvictions struct {
+	mux         sync.Mutex
+	isConfirmed IsTxConfirmedFunc
+	isSpent     IsOutpointSpentFunc
+	onEviction  OnMempoolEvictionFunc
+	firstSeen   map[string]int64
+	// removed are the transactions waiting for the classification, removedInputs are their inputs
+	removed       map[string]*MempoolEviction
+	removedInputs map[string][]outpoint
+	records       map[string]*MempoolEviction
+}
+
+func (e *mempoolEvictions) track(isConfirmed IsTxConfirmedFunc, isSpent IsOutpointSpentFunc, onEviction OnMempoolEvictionFunc) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	e.isConfirmed = isConfirmed
+	e.isSpent = isSpent
+	e.onEviction = onEviction
+	if e.firstSeen == nil {
+		e.firstSeen = make(map[string]int64)
+		e.removed = make(map[string]*MempoolEviction)
+		e.removedInputs = make(map[string][]outpoint)
+		e.records = make(map[string]*MempoolEviction)
+	}
+}
+
+func (e *mempoolEvictions) tracking() bool {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return e.isConfirmed != nil
+}
+
+func (e *mempoolEvictions) get(txid string) *MempoolEviction {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if r, found := e.records[txid]; found {
+		ev := *r
+		return &ev
+	}
+	return nil
+}
+
+// update records the transactions which appeared in or disappeared from the mempool during the resync
+// and classifies the transactions removed at least mempoolEvictionGrace ago,
+// oldTxInputs are the inputs of the transactions in the previous mempool, oldTxInputs and replacedBy can be nil
+func (e *mempoolEvictions) update(now time.Time, oldTxs, newTxs map[string][]addrIndex, oldTxInputs map[string][]outpoint, replacedBy func(txid string) string) {
+	e.mux.Lock()
+	if e.isConfirmed == nil {
+		e.mux.Unlock()
+		return
+	}
+	t := now.Unix()
+	for txid := range newTxs {
+		if _, found := e.firstSeen[txid]; !found {
+			e.firstSeen[txid] = t
+		}
+		// the transaction returned to the mempool
+		delete(e.removed, txid)
+		delete(e.removedInputs, txid)
+	}
+	for txid, io := range oldTxs {
+		if _, found := newTxs[txid]; found {
+			continue
+		}
+		ev := &MempoolEviction{Txid: txid, FirstSeen: e.firstSeen[txid], Removed: t}
+		if replacedBy != nil {
+			ev.ReplacedBy = replacedBy(txid)
+		}
+		for _, ai := range io {
+			ev.AddrDescs = append(ev.AddrDescs, AddressDescriptor(ai.addrDesc))
+		}
+		e.removed[txid] = ev
+		if inputs := oldTxInputs[txid]; len(inputs) > 0 {
+			e.removedInputs[txid] = inputs
+		}
+		delete(e.firstSeen, txid)
+	}
+	var evictions []MempoolEviction
+	for txid, ev := range e.removed {
+		if t-ev.Removed < int64(mempoolEvictionGrace/time.Second) {
+			continue
+		}
+		inputs := e.removedInputs[txid]
+		delete(e.removed, txid)
+		delete(e.removedInputs, txid)
+		if e.isConfirmed(txid) {
+			continue
+		}
+		switch {
+		case ev.ReplacedBy != "", e.spentInBlock(inputs):
+			ev.Reason = MempoolEvictionReplaced
+		case ev.FirstSeen > 0 && ev.Removed-ev.FirstSeen >= int64(mempoolExpiry/time.Second):
+			ev.Reason = MempoolEvictionExpired
+		default:
+			ev.Reason = MempoolEvictionEvicted
+		}
+		e.records[txid] = ev
+		evictions = append(evictions, *ev)
+	}
+	for txid, ev := range e.records {
+		if t-ev.Removed > int64(mempoolEvictionRetention/time.Second) {
+			delete(e.records, txid)
+		}
+	}
+	onEviction := e.onEviction
+	e.mux.Unlock()
+	if len(evictions) > 0 {
+		sort.Slice(evictions, func(i, j int) bool { return evictions[i].Txid < evictions[j].Txid })
+		glog.Info("mempool: ", len(evictions), " transactions removed without confirmation")
+		if onEviction != nil {
+			onEviction(evictions)
+		}
+	}
+}
+
+// spentInBlock checks if any of the inputs of the removed transaction was spent by a confirmed transaction,
+// the transaction was replaced by a transaction which was mined before it was seen in the mempool
+func (e *mempoolEvictions) spentInBlock(inputs []outpoint) bool {
+	if e.isSpent == nil {
+		return false
+	}
+	for _, o := range inputs {
+		if e.isSpent(o.txid, o.vout) {
+			return true
+		}
+	}
+	return false
+}
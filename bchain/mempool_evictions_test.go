@@ -0,0 +1,116 @@
+package bchain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_mempoolEvictions(t *testing.T) {
+	var e mempoolEvictions
+	confirmed := map[string]bool{"c": true}
+	var notified []MempoolEviction
+	e.track(func(txid string) bool { return confirmed[txid] }, nil, func(evictions []MempoolEviction) {
+		notified = append(notified, evictions...)
+	})
+	replaced := map[string]string{"r": "r2"}
+	replacedBy := func(txid string) string { return replaced[txid] }
+	io := func(addrDesc string) []addrIndex { return []addrIndex{{addrDesc, 0}} }
+
+	start := time.Unix(1500000000, 0)
+	e.update(start, nil, map[string][]addrIndex{"c": io("a1"), "r": io("a2"), "old": io("a4"), "back": io("a5")}, nil, replacedBy)
+	// the transaction old is removed after the mempool expiry, back is removed and returns to the mempool before it is classified
+	now := start.Add(mempoolExpiry)
+	e.update(now, map[string][]addrIndex{"c": io("a1"), "r": io("a2"), "old": io("a4"), "back": io("a5")}, map[string][]addrIndex{"x": io("a3"), "back": io("a5"), "r2": io("a2")}, nil, replacedBy)
+	e.update(now.Add(time.Second), map[string][]addrIndex{"x": io("a3"), "back": io("a5"), "r2": io("a2")}, map[string][]addrIndex{"r2": io("a2")}, nil, replacedBy)
+	e.update(now.Add(2*time.Second), map[string][]addrIndex{"r2": io("a2")}, map[string][]addrIndex{"back": io("a5"), "r2": io("a2")}, nil, replacedBy)
+	if len(notified) > 0 {
+		t.Fatalf("Notified before the grace period: %+v", notified)
+	}
+	now = now.Add(mempoolEvictionGrace)
+	e.update(now, map[string][]addrIndex{"back": io("a5"), "r2": io("a2")}, map[string][]addrIndex{"back": io("a5"), "r2": io("a2")}, nil, replacedBy)
+	want := []MempoolEviction{
+		{Txid: "old", Reason: MempoolEvictionExpired, FirstSeen: start.Unix(), Removed: start.Add(mempoolExpiry).Unix(), AddrDescs: []AddressDescriptor{AddressDescriptor("a4")}},
+		{Txid: "r", Reason: MempoolEvictionReplaced, ReplacedBy: "r2", FirstSeen: start.Unix(), Removed: start.Add(mempoolExpiry).Unix(), AddrDescs: []AddressDescriptor{AddressDescriptor("a2")}},
+	}
+	if !reflect.DeepEqual(notified, want) {
+		t.Errorf("Notified %+v, want %+v", notified, want)
+	}
+	now = now.Add(time.Second)
+	e.update(now, map[string][]addrIndex{"back": io("a5"), "r2": io("a2")}, map[string][]addrIndex{"back": io("a5"), "r2": io("a2")}, nil, replacedBy)
+	want = append(want, MempoolEviction{Txid: "x", Reason: MempoolEvictionEvicted, FirstSeen: start.Add(mempoolExpiry).Unix(), Removed: start.Add(mempoolExpiry + time.Second).Unix(), AddrDescs: []AddressDescriptor{AddressDescriptor("a3")}})
+	if !reflect.DeepEqual(notified, want) {
+		t.Errorf("Notified %+v, want %+v", notified, want)
+	}
+	if r := e.get("x"); r == nil || r.Reason != MempoolEvictionEvicted {
+		t.Errorf("get(x) = %+v, want evicted", r)
+	}
+	for _, txid := range []string{"c", "back", "r2"} {
+		if r := e.get(txid); r != nil {
+			t.Errorf("get(%v) = %+v, want nil", txid, r)
+		}
+	}
+	// the records are removed after the retention time
+	e.update(now.Add(mempoolEvictionRetention+time.Second), nil, nil, nil, nil)
+	if r := e.get("x"); r != nil {
+		t.Errorf("get(x) after retention = %+v, want nil", r)
+	}
+}
+
+// the transaction replaced by a transaction mined before it was seen in the mempool is not reported as evicted
+func Test_mempoolEvictions_replacementConfirmed(t *testing.T) {
+	var e mempoolEvictions
+	spent := map[outpoint]bool{{"p", 1}: true}
+	var notified []MempoolEviction
+	e.track(func(txid string) bool { return false }, func(txid string, vout int32) bool {
+		return spent[outpoint{txid, vout}]
+	}, func(evictions []MempoolEviction) {
+		notified = append(notified, evictions...)
+	})
+	io := func(addrDesc string) []addrIndex { return []addrIndex{{addrDesc, 0}} }
+	inputs := map[string][]outpoint{"r": {{"p", 0}, {"p", 1}}, "x": {{"p", 2}}}
+
+	start := time.Unix(1500000000, 0)
+	e.update(start, nil, map[string][]addrIndex{"r": io("a1"), "x": io("a2")}, nil, nil)
+	e.update(start.Add(time.Second), map[string][]addrIndex{"r": io("a1"), "x": io("a2")}, nil, inputs, nil)
+	e.update(start.Add(time.Second+mempoolEvictionGrace), nil, nil, nil, nil)
+	want := []MempoolEviction{
+		{Txid: "r", Reason: MempoolEvictionReplaced, FirstSeen: start.Unix(), Removed: start.Unix() + 1, AddrDescs: []AddressDescriptor{AddressDescriptor("a1")}},
+		{Txid: "x", Reason: MempoolEvictionEvicted, FirstSeen: start.Unix(), Removed: start.Unix() + 1, AddrDescs: []AddressDescriptor{AddressDescriptor("a2")}},
+	}
+	if !reflect.DeepEqual(notified, want) {
+		t.Errorf("Notified %+v, want %+v", notified, want)
+	}
+}
+
+// testMempoolChain returns the transactions of the mempool, the other methods of the interface are not used
+type testMempoolChain struct {
+	BlockChain
+	txs map[string]*Tx
+}
+
+func (c *testMempoolChain) GetTransactionForMempool(txid string) (*Tx, error) {
+	if tx, found := c.txs[txid]; found {
+		return tx, nil
+	}
+	return nil, errors.New("Transaction not found")
+}
+
+func TestUTXOMempool_TrackEvictions(t *testing.T) {
+	m := &UTXOMempool{
+		chain: &testMempoolChain{txs: map[string]*Tx{
+			"a": {Txid: "a", Vin: []Vin{{Txid: "p", Vout: 1}, {Txid: "q", Vout: 0}}},
+		}},
+		// the transaction b left the mempool before the tracking started
+		txToInputOutput: map[string][]addrIndex{"a": {{"a1", 0}}, "b": {{"a2", 0}}},
+	}
+	m.TrackEvictions(func(txid string) bool { return false }, nil, nil)
+	want := map[string][]outpoint{"a": {{"p", 1}, {"q", 0}}}
+	if !reflect.DeepEqual(m.txToInputs, want) {
+		t.Errorf("txToInputs %+v, want %+v", m.txToInputs, want)
+	}
+	if !m.evictions.tracking() {
+		t.Error("tracking() = false, want true")
+	}
+}
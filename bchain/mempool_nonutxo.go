@@ -13,6 +13,7 @@ type NonUTXOMempool struct {
 	mux             sync.Mutex
 	txToInputOutput map[string][]addrIndex
 	addrDescToTx    map[string][]outpoint
+	evictions       mempoolEvictions
 }
 
 // NewNonUTXOMempool creates new mempool handler.
@@ -108,7 +109,19 @@ func (m *NonUTXOMempool) Resync(onNewTxAddr OnNewTxAddrFunc) (int, error) {
 			newAddrDescToTx[si.addrDesc] = append(newAddrDescToTx[si.addrDesc], outpoint{txid, si.n})
 		}
 	}
+	// the replacement of the transactions is not detected in non UTXO chains
+	m.evictions.update(start, m.txToInputOutput, newTxToInputOutput, nil, nil)
 	m.updateMappings(newTxToInputOutput, newAddrDescToTx)
 	glog.Info("Mempool: resync finished in ", time.Since(start), ", ", len(m.txToInputOutput), " transactions in mempool")
 	return len(m.txToInputOutput), nil
 }
+
+// TrackEvictions enables the tracking of the transactions removed from the mempool without being confirmed
+func (m *NonUTXOMempool) TrackEvictions(isConfirmed IsTxConfirmedFunc, isSpent IsOutpointSpentFunc, onEviction OnMempoolEvictionFunc) {
+	m.evictions.track(isConfirmed, isSpent, onEviction)
+}
+
+// GetEviction returns the record of the transaction removed from the mempool without being confirmed or nil
+func (m *NonUTXOMempool) GetEviction(txid string) *MempoolEviction {
+	return m.evictions.get(txid)
+}
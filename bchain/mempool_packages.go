@@ -0,0 +1,173 @@
+package bchain
+
+import (
+	"math"
+	"sort"
+)
+
+// maxMempoolPackageTxs limits the number of the ancestors and of the descendants of a transaction in its package,
+// the backend limits the chains of unconfirmed transactions to 25 transactions by default
+const maxMempoolPackageTxs = 100
+
+// mempoolTx are the data of a mempool transaction needed to compute its package, feeSat is negative if the fee is not known,
+// parents are the txids of the outputs spent by the transaction, after the resync only those in the mempool are kept
+type mempoolTx struct {
+	feeSat  int64
+	vsize   int64
+	parents []string
+}
+
+// newMempoolTx returns the mempool transaction with the negative value of the outputs as the fee,
+// the value of the inputs must be added to it
+func newMempoolTx(tx *Tx) *mempoolTx {
+	t := &mempoolTx{vsize: tx.VSize}
+	if t.vsize <= 0 {
+		t.vsize = txVSize(tx)
+	}
+	seen := make(map[string]struct{}, len(tx.Vin))
+	for i := range tx.Vin {
+		txid := tx.Vin[i].Txid
+		if txid == "" {
+			continue
+		}
+		if _, found := seen[txid]; !found {
+			seen[txid] = struct{}{}
+			t.parents = append(t.parents, txid)
+		}
+	}
+	for i := range tx.Vout {
+		t.feeSat -= tx.Vout[i].ValueSat.Int64()
+	}
+	return t
+}
+
+func varIntSize(n int) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	}
+	return 5
+}
+
+// txVSize computes the virtual size of the transaction as defined in BIP141 from the size of its hex
+// and the size of the witness data of its inputs
+func txVSize(tx *Tx) int64 {
+	size := len(tx.Hex) / 2
+	witness := 0
+	for i := range tx.Vin {
+		witness += varIntSize(len(tx.Vin[i].Witness))
+		for _, w := range tx.Vin[i].Witness {
+			l := len(w) / 2
+			witness += varIntSize(l) + l
+		}
+	}
+	if witness == len(tx.Vin) {
+		// no input has witness data, the transaction is not serialized in the witness format
+		return int64(size)
+	}
+	// the marker and the flag of the witness serialization
+	witness += 2
+	return int64(((size-witness)*3 + size + 3) / 4)
+}
+
+// linkMempoolTxs removes the confirmed parents of the transactions added to the mempool and returns the children of the transactions;
+// the parents of a transaction are in the mempool before the transaction, therefore the parents are filtered only once
+func linkMempoolTxs(txs map[string]*mempoolTx, added []string) map[string][]string {
+	for _, txid := range added {
+		t, found := txs[txid]
+		if !found {
+			continue
+		}
+		parents := t.parents[:0]
+		for _, p := range t.parents {
+			if _, found := txs[p]; found {
+				parents = append(parents, p)
+			}
+		}
+		t.parents = parents
+	}
+	children := make(map[string][]string)
+	for txid, t := range txs {
+		for _, p := range t.parents {
+			children[p] = append(children[p], txid)
+		}
+	}
+	return children
+}
+
+// mempoolRelatives returns the sorted transactions in the mempool reachable from txid by links, txid excluded
+func mempoolRelatives(txid string, txs map[string]*mempoolTx, links func(txid string) []string) []string {
+	var r []string
+	seen := map[string]struct{}{txid: {}}
+	queue := []string{txid}
+	for len(queue) > 0 && len(r) < maxMempoolPackageTxs {
+		for _, l := range links(queue[0]) {
+			if _, found := seen[l]; found {
+				continue
+			}
+			if _, found := txs[l]; !found {
+				// the parent was confirmed or the transaction was removed from the mempool
+				continue
+			}
+			seen[l] = struct{}{}
+			r = append(r, l)
+			queue = append(queue, l)
+		}
+		queue = queue[1:]
+	}
+	sort.Strings(r)
+	return r
+}
+
+// mempoolFeeRate returns the fee rate in satoshi per virtual byte rounded to 3 decimal places
+func mempoolFeeRate(feeSat, vsize int64) float64 {
+	return math.Round(float64(feeSat)/float64(vsize)*1000) / 1000
+}
+
+// ancestorFee returns the fee and the virtual size of the transaction together with its ancestors,
+// ok is false if the fee of any of the transactions is not known
+func ancestorFee(txid string, txs map[string]*mempoolTx) (feeSat int64, vsize int64, ancestors []string, ok bool) {
+	ancestors = mempoolRelatives(txid, txs, func(txid string) []string { return txs[txid].parents })
+	for _, a := range append(ancestors, txid) {
+		t := txs[a]
+		if t.feeSat < 0 || t.vsize <= 0 {
+			return 0, 0, nil, false
+		}
+		feeSat += t.feeSat
+		vsize += t.vsize
+	}
+	return feeSat, vsize, ancestors, true
+}
+
+// getMempoolPackage computes the package of the transaction, the transaction is mined at the highest fee rate
+// of the packages containing it - its own ancestor package or the ancestor package of any of its descendants
+func getMempoolPackage(txid string, txs map[string]*mempoolTx, children map[string][]string) *MempoolPackage {
+	t, found := txs[txid]
+	if !found {
+		return nil
+	}
+	feeSat, vsize, ancestors, ok := ancestorFee(txid, txs)
+	if !ok {
+		return nil
+	}
+	p := &MempoolPackage{
+		Txid:            txid,
+		VSize:           t.vsize,
+		FeeRate:         mempoolFeeRate(t.feeSat, t.vsize),
+		Ancestors:       ancestors,
+		AncestorFeeRate: mempoolFeeRate(feeSat, vsize),
+		Descendants:     mempoolRelatives(txid, txs, func(txid string) []string { return children[txid] }),
+	}
+	p.EffectiveFeeRate = p.AncestorFeeRate
+	for _, d := range p.Descendants {
+		if feeSat, vsize, _, ok = ancestorFee(d, txs); ok {
+			if r := mempoolFeeRate(feeSat, vsize); r > p.EffectiveFeeRate {
+				p.EffectiveFeeRate = r
+				p.EffectiveBy = d
+			}
+		}
+	}
+	return p
+}
@@ -0,0 +1,88 @@
+package bchain
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_newMempoolTx(t *testing.T) {
+	tx := &Tx{
+		Hex: strings.Repeat("00", 100),
+		Vin: []Vin{{Txid: "a", Vout: 0}, {Txid: "b", Vout: 1}, {Txid: "a", Vout: 1}},
+		Vout: []Vout{
+			{ValueSat: *big.NewInt(1000)},
+			{ValueSat: *big.NewInt(234)},
+		},
+	}
+	got := newMempoolTx(tx)
+	want := &mempoolTx{feeSat: -1234, vsize: 100, parents: []string{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newMempoolTx() = %+v, want %+v", got, want)
+	}
+	tx.VSize = 80
+	if got = newMempoolTx(tx); got.vsize != 80 {
+		t.Errorf("newMempoolTx() vsize = %v, want 80", got.vsize)
+	}
+}
+
+func Test_txVSize(t *testing.T) {
+	// one input with signature and public key in the witness, 111 bytes of the witness data including the marker and the flag
+	tx := &Tx{
+		Hex: strings.Repeat("00", 222),
+		Vin: []Vin{{Txid: "a", Witness: []string{strings.Repeat("30", 72), strings.Repeat("02", 33)}}, {Txid: "b"}},
+	}
+	if got := txVSize(tx); got != 139 {
+		t.Errorf("txVSize() = %v, want 139", got)
+	}
+	tx.Vin[0].Witness = nil
+	if got := txVSize(tx); got != 222 {
+		t.Errorf("txVSize() = %v, want 222", got)
+	}
+}
+
+func Test_getMempoolPackage(t *testing.T) {
+	// the low fee parent p is paid for by its child ch, the grandchild gc and the sibling x (unknown fee) do not increase its fee rate
+	txs := map[string]*mempoolTx{
+		"p":  {feeSat: 200, vsize: 200, parents: []string{"c"}},
+		"ch": {feeSat: 2000, vsize: 200, parents: []string{"p", "c"}},
+		"gc": {feeSat: 100, vsize: 100, parents: []string{"ch"}},
+		"x":  {feeSat: -1, vsize: 100, parents: []string{"p"}},
+		"u":  {feeSat: 300, vsize: 150, parents: []string{"c2"}},
+	}
+	children := linkMempoolTxs(txs, []string{"p", "ch", "gc", "x", "u"})
+	if !reflect.DeepEqual(txs["ch"].parents, []string{"p"}) {
+		t.Errorf("linkMempoolTxs() parents %v, want [p]", txs["ch"].parents)
+	}
+	tests := []struct {
+		txid string
+		want *MempoolPackage
+	}{
+		{
+			txid: "p",
+			want: &MempoolPackage{Txid: "p", VSize: 200, FeeRate: 1, AncestorFeeRate: 1, EffectiveFeeRate: 5.5, EffectiveBy: "ch", Descendants: []string{"ch", "gc", "x"}},
+		},
+		{
+			txid: "ch",
+			want: &MempoolPackage{Txid: "ch", VSize: 200, FeeRate: 10, AncestorFeeRate: 5.5, EffectiveFeeRate: 5.5, Ancestors: []string{"p"}, Descendants: []string{"gc"}},
+		},
+		{
+			txid: "gc",
+			want: &MempoolPackage{Txid: "gc", VSize: 100, FeeRate: 1, AncestorFeeRate: 4.6, EffectiveFeeRate: 4.6, Ancestors: []string{"ch", "p"}},
+		},
+		{
+			txid: "u",
+			want: &MempoolPackage{Txid: "u", VSize: 150, FeeRate: 2, AncestorFeeRate: 2, EffectiveFeeRate: 2},
+		},
+		{txid: "x"},
+		{txid: "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.txid, func(t *testing.T) {
+			if got := getMempoolPackage(tt.txid, txs, children); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getMempoolPackage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
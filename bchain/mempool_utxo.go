@@ -19,8 +19,17 @@ type outpoint struct {
 }
 
 type txidio struct {
-	txid string
-	io   []addrIndex
+	txid   string
+	io     []addrIndex
+	inputs []outpoint
+	pkg    *mempoolTx
+}
+
+// inputValue is the address and the value of the output spent by a mempool transaction, ok is false if the output was not found
+type inputValue struct {
+	ai       *addrIndex
+	valueSat int64
+	ok       bool
 }
 
 // UTXOMempool is mempool handle.
@@ -32,6 +41,12 @@ type UTXOMempool struct {
 	chanTxid        chan string
 	chanAddrIndex   chan txidio
 	onNewTxAddr     OnNewTxAddrFunc
+	// txToInputs are the outpoints spent by the mempool transactions, kept only if the evictions are tracked
+	txToInputs map[string][]outpoint
+	evictions  mempoolEvictions
+	// txToPackage and txToChildren are the fees, sizes and the unconfirmed parents and children of the mempool transactions
+	txToPackage  map[string]*mempoolTx
+	txToChildren map[string][]string
 }
 
 // NewUTXOMempool creates new mempool handler.
@@ -45,21 +60,20 @@ func NewUTXOMempool(chain BlockChain, workers int, subworkers int) *UTXOMempool
 	for i := 0; i < workers; i++ {
 		go func(i int) {
 			chanInput := make(chan outpoint, 1)
-			chanResult := make(chan *addrIndex, 1)
+			chanResult := make(chan inputValue, 1)
 			for j := 0; j < subworkers; j++ {
 				go func(j int) {
 					for input := range chanInput {
-						ai := m.getInputAddress(input)
-						chanResult <- ai
+						chanResult <- m.getInputAddress(input)
 					}
 				}(j)
 			}
 			for txid := range m.chanTxid {
-				io, ok := m.getTxAddrs(txid, chanInput, chanResult)
+				io, inputs, pkg, ok := m.getTxAddrs(txid, chanInput, chanResult)
 				if !ok {
 					io = []addrIndex{}
 				}
-				m.chanAddrIndex <- txidio{txid, io}
+				m.chanAddrIndex <- txidio{txid, io, inputs, pkg}
 			}
 		}(i)
 	}
@@ -89,40 +103,53 @@ func (m *UTXOMempool) GetAddrDescTransactions(addrDesc AddressDescriptor) ([]str
 	return txs, nil
 }
 
-func (m *UTXOMempool) updateMappings(newTxToInputOutput map[string][]addrIndex, newAddrDescToTx map[string][]outpoint) {
+func (m *UTXOMempool) updateMappings(newTxToInputOutput map[string][]addrIndex, newAddrDescToTx map[string][]outpoint, newTxToPackage map[string]*mempoolTx, newTxToChildren map[string][]string) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 	m.txToInputOutput = newTxToInputOutput
 	m.addrDescToTx = newAddrDescToTx
+	m.txToPackage = newTxToPackage
+	m.txToChildren = newTxToChildren
 }
 
-func (m *UTXOMempool) getInputAddress(input outpoint) *addrIndex {
+func (m *UTXOMempool) getInputAddress(input outpoint) inputValue {
 	itx, err := m.chain.GetTransactionForMempool(input.txid)
 	if err != nil {
 		glog.Error("cannot get transaction ", input.txid, ": ", err)
-		return nil
+		return inputValue{}
 	}
 	if int(input.vout) >= len(itx.Vout) {
 		glog.Error("Vout len in transaction ", input.txid, " ", len(itx.Vout), " input.Vout=", input.vout)
-		return nil
+		return inputValue{}
 	}
+	iv := inputValue{valueSat: itx.Vout[input.vout].ValueSat.Int64(), ok: true}
 	addrDesc, err := m.chain.GetChainParser().GetAddrDescFromVout(&itx.Vout[input.vout])
 	if err != nil {
 		glog.Error("error in addrDesc in ", input.txid, " ", input.vout, ": ", err)
-		return nil
+		return iv
 	}
-	return &addrIndex{string(addrDesc), ^input.vout}
-
+	iv.ai = &addrIndex{string(addrDesc), ^input.vout}
+	return iv
 }
 
-func (m *UTXOMempool) getTxAddrs(txid string, chanInput chan outpoint, chanResult chan *addrIndex) ([]addrIndex, bool) {
+func (m *UTXOMempool) getTxAddrs(txid string, chanInput chan outpoint, chanResult chan inputValue) ([]addrIndex, []outpoint, *mempoolTx, bool) {
 	tx, err := m.chain.GetTransactionForMempool(txid)
 	if err != nil {
 		glog.Error("cannot get transaction ", txid, ": ", err)
-		return nil, false
+		return nil, nil, nil, false
 	}
 	glog.V(2).Info("mempool: gettxaddrs ", txid, ", ", len(tx.Vin), " inputs")
 	io := make([]addrIndex, 0, len(tx.Vout)+len(tx.Vin))
+	// the fee is the value of the inputs less the value of the outputs, it is unknown if the value of any input is unknown
+	var valueInSat int64
+	valueInKnown := true
+	onInput := func(iv inputValue) {
+		if iv.ai != nil {
+			io = append(io, *iv.ai)
+		}
+		valueInSat += iv.valueSat
+		valueInKnown = valueInKnown && iv.ok
+	}
 	for _, output := range tx.Vout {
 		addrDesc, err := m.chain.GetChainParser().GetAddrDescFromVout(&output)
 		if err != nil {
@@ -137,19 +164,14 @@ func (m *UTXOMempool) getTxAddrs(txid string, chanInput chan outpoint, chanResul
 		}
 	}
 	dispatched := 0
-	for _, input := range tx.Vin {
-		if input.Coinbase != "" {
-			continue
-		}
-		o := outpoint{input.Txid, int32(input.Vout)}
+	inputs := txInputs(tx)
+	for _, o := range inputs {
 	loop:
 		for {
 			select {
 			// store as many processed results as possible
-			case ai := <-chanResult:
-				if ai != nil {
-					io = append(io, *ai)
-				}
+			case iv := <-chanResult:
+				onInput(iv)
 				dispatched--
 			// send input to be processed
 			case chanInput <- o:
@@ -159,12 +181,34 @@ func (m *UTXOMempool) getTxAddrs(txid string, chanInput chan outpoint, chanResul
 		}
 	}
 	for i := 0; i < dispatched; i++ {
-		ai := <-chanResult
-		if ai != nil {
-			io = append(io, *ai)
+		onInput(<-chanResult)
+	}
+	if m.onNewTxAddr != nil {
+		for _, ai := range io {
+			if ai.n < 0 {
+				m.onNewTxAddr(tx.Txid, AddressDescriptor(ai.addrDesc), false)
+			}
 		}
 	}
-	return io, true
+	pkg := newMempoolTx(tx)
+	if valueInKnown {
+		pkg.feeSat += valueInSat
+	} else {
+		pkg.feeSat = -1
+	}
+	return io, inputs, pkg, true
+}
+
+// txInputs returns the outpoints spent by the transaction
+func txInputs(tx *Tx) []outpoint {
+	inputs := make([]outpoint, 0, len(tx.Vin))
+	for _, input := range tx.Vin {
+		if input.Coinbase != "" {
+			continue
+		}
+		inputs = append(inputs, outpoint{input.Txid, int32(input.Vout)})
+	}
+	return inputs
 }
 
 // Resync gets mempool transactions and maps outputs to transactions.
@@ -182,14 +226,27 @@ func (m *UTXOMempool) Resync(onNewTxAddr OnNewTxAddrFunc) (int, error) {
 	// allocate slightly larger capacity of the maps
 	newTxToInputOutput := make(map[string][]addrIndex, len(m.txToInputOutput)+5)
 	newAddrDescToTx := make(map[string][]outpoint, len(m.addrDescToTx)+5)
+	var newTxToInputs map[string][]outpoint
+	trackEvictions := m.evictions.tracking()
+	if trackEvictions {
+		newTxToInputs = make(map[string][]outpoint, len(m.txToInputs)+5)
+	}
+	newTxToPackage := make(map[string]*mempoolTx, len(m.txToPackage)+5)
+	var added []string
 	dispatched := 0
-	onNewData := func(txid string, io []addrIndex) {
+	onNewData := func(txid string, io []addrIndex, inputs []outpoint, pkg *mempoolTx) {
 		if len(io) > 0 {
 			newTxToInputOutput[txid] = io
 			for _, si := range io {
 				newAddrDescToTx[si.addrDesc] = append(newAddrDescToTx[si.addrDesc], outpoint{txid, si.n})
 			}
 		}
+		if trackEvictions && len(inputs) > 0 {
+			newTxToInputs[txid] = inputs
+		}
+		if pkg != nil {
+			newTxToPackage[txid] = pkg
+		}
 	}
 	// get transaction in parallel using goroutines created in NewUTXOMempool
 	for _, txid := range txs {
@@ -200,7 +257,8 @@ func (m *UTXOMempool) Resync(onNewTxAddr OnNewTxAddrFunc) (int, error) {
 				select {
 				// store as many processed transactions as possible
 				case tio := <-m.chanAddrIndex:
-					onNewData(tio.txid, tio.io)
+					onNewData(tio.txid, tio.io, tio.inputs, tio.pkg)
+					added = append(added, tio.txid)
 					dispatched--
 				// send transaction to be processed
 				case m.chanTxid <- txid:
@@ -209,15 +267,89 @@ func (m *UTXOMempool) Resync(onNewTxAddr OnNewTxAddrFunc) (int, error) {
 				}
 			}
 		} else {
-			onNewData(txid, io)
+			onNewData(txid, io, m.txToInputs[txid], m.txToPackage[txid])
 		}
 	}
 	for i := 0; i < dispatched; i++ {
 		tio := <-m.chanAddrIndex
-		onNewData(tio.txid, tio.io)
+		onNewData(tio.txid, tio.io, tio.inputs, tio.pkg)
+		added = append(added, tio.txid)
+	}
+	newTxToChildren := linkMempoolTxs(newTxToPackage, added)
+	if trackEvictions {
+		m.evictions.update(start, m.txToInputOutput, newTxToInputOutput, m.txToInputs, m.replacedBy(newTxToInputs))
+		m.txToInputs = newTxToInputs
 	}
-	m.updateMappings(newTxToInputOutput, newAddrDescToTx)
+	m.updateMappings(newTxToInputOutput, newAddrDescToTx, newTxToPackage, newTxToChildren)
 	m.onNewTxAddr = nil
 	glog.Info("mempool: resync finished in ", time.Since(start), ", ", len(m.txToInputOutput), " transactions in mempool")
 	return len(m.txToInputOutput), nil
 }
+
+// replacedBy returns function finding the transaction in the new mempool, which spends an output spent by the removed transaction
+func (m *UTXOMempool) replacedBy(newTxToInputs map[string][]outpoint) func(txid string) string {
+	var spentBy map[outpoint]string
+	return func(txid string) string {
+		inputs := m.txToInputs[txid]
+		if len(inputs) == 0 {
+			return ""
+		}
+		if spentBy == nil {
+			spentBy = make(map[outpoint]string)
+			for t, ins := range newTxToInputs {
+				for _, o := range ins {
+					spentBy[o] = t
+				}
+			}
+		}
+		for _, o := range inputs {
+			if t, found := spentBy[o]; found && t != txid {
+				return t
+			}
+		}
+		return ""
+	}
+}
+
+// TrackEvictions enables the tracking of the transactions removed from the mempool without being confirmed.
+// The inputs of the transactions already in the mempool are loaded so that their replacement can be detected,
+// TrackEvictions must not be called concurrently with Resync.
+func (m *UTXOMempool) TrackEvictions(isConfirmed IsTxConfirmedFunc, isSpent IsOutpointSpentFunc, onEviction OnMempoolEvictionFunc) {
+	m.mux.Lock()
+	txids := make([]string, 0, len(m.txToInputOutput))
+	for txid := range m.txToInputOutput {
+		txids = append(txids, txid)
+	}
+	m.mux.Unlock()
+	txToInputs := make(map[string][]outpoint, len(txids))
+	for _, txid := range txids {
+		if _, found := m.txToInputs[txid]; found {
+			txToInputs[txid] = m.txToInputs[txid]
+			continue
+		}
+		tx, err := m.chain.GetTransactionForMempool(txid)
+		if err != nil {
+			// the transaction may have already left the mempool
+			glog.V(1).Info("mempool: cannot get transaction ", txid, ": ", err)
+			continue
+		}
+		if inputs := txInputs(tx); len(inputs) > 0 {
+			txToInputs[txid] = inputs
+		}
+	}
+	m.txToInputs = txToInputs
+	m.evictions.track(isConfirmed, isSpent, onEviction)
+}
+
+// GetPackage returns the package of the unconfirmed ancestors and descendants of the mempool transaction,
+// nil if the transaction is not in the mempool or its fee is not known
+func (m *UTXOMempool) GetPackage(txid string) *MempoolPackage {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return getMempoolPackage(txid, m.txToPackage, m.txToChildren)
+}
+
+// GetEviction returns the record of the transaction removed from the mempool without being confirmed or nil
+func (m *UTXOMempool) GetEviction(txid string) *MempoolEviction {
+	return m.evictions.get(txid)
+}
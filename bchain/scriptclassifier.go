@@ -0,0 +1,65 @@
+package bchain
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// ScriptAnnotation is the classification of an output script by a ScriptClassifier
+type ScriptAnnotation struct {
+	Classifier string            `json:"classifier"`
+	Type       string            `json:"type"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// ScriptClassifier recognizes custom kinds of output scripts (for example vaults or covenants),
+// which are not known to the coin parser. The classifiers are invoked for each output of each connected block,
+// the returned annotations are stored in the db and returned by the API together with the transaction.
+type ScriptClassifier interface {
+	// Name returns unique name of the classifier, it is stored with the annotations
+	Name() string
+	// ClassifyScript returns the type label and the extracted fields of the output n of the transaction
+	// or nil if the script is not recognized by the classifier
+	ClassifyScript(tx *Tx, n int, addrDesc AddressDescriptor) *ScriptAnnotation
+}
+
+var scriptClassifiers struct {
+	mux         sync.RWMutex
+	classifiers []ScriptClassifier
+}
+
+// RegisterScriptClassifier registers a custom script classifier, it is intended to be called from init function
+// of a package linked to the deployment build
+func RegisterScriptClassifier(c ScriptClassifier) {
+	scriptClassifiers.mux.Lock()
+	defer scriptClassifiers.mux.Unlock()
+	for _, o := range scriptClassifiers.classifiers {
+		if o.Name() == c.Name() {
+			glog.Warning("Script classifier ", c.Name(), " is already registered")
+			return
+		}
+	}
+	scriptClassifiers.classifiers = append(scriptClassifiers.classifiers, c)
+}
+
+// HasScriptClassifiers returns true if any script classifier is registered
+func HasScriptClassifiers() bool {
+	scriptClassifiers.mux.RLock()
+	defer scriptClassifiers.mux.RUnlock()
+	return len(scriptClassifiers.classifiers) > 0
+}
+
+// ClassifyScript returns the annotations of the output n of the transaction by all registered classifiers
+func ClassifyScript(tx *Tx, n int, addrDesc AddressDescriptor) []ScriptAnnotation {
+	scriptClassifiers.mux.RLock()
+	defer scriptClassifiers.mux.RUnlock()
+	var r []ScriptAnnotation
+	for _, c := range scriptClassifiers.classifiers {
+		if a := c.ClassifyScript(tx, n, addrDesc); a != nil {
+			a.Classifier = c.Name()
+			r = append(r, *a)
+		}
+	}
+	return r
+}
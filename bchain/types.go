@@ -21,6 +21,9 @@ var (
 	// ErrTxidMissing is returned if txid is not specified
 	// for example coinbase transactions in Bitcoin
 	ErrTxidMissing = errors.New("Txid missing")
+	// ErrNotSupported is returned if the operation is not supported by the coin
+	// for example account nonce in UTXO chains
+	ErrNotSupported = errors.New("Not supported")
 )
 
 type ScriptSig struct {
@@ -35,6 +38,8 @@ type Vin struct {
 	ScriptSig ScriptSig `json:"scriptSig"`
 	Sequence  uint32    `json:"sequence"`
 	Addresses []string  `json:"addresses"`
+	// Witness is the hex encoded witness stack of the input, it is not stored in the packed transactions of non bitcoin-like coins
+	Witness []string `json:"txinwitness,omitempty"`
 }
 
 type ScriptPubKey struct {
@@ -64,13 +69,35 @@ type Tx struct {
 	Confirmations uint32 `json:"confirmations,omitempty"`
 	Time          int64  `json:"time,omitempty"`
 	Blocktime     int64  `json:"blocktime,omitempty"`
+	// VSize is virtual size of the transaction, set only by parsers that are able to compute it
+	VSize int64 `json:"-"`
 }
 
 type Block struct {
 	BlockHeader
 	Txs []Tx `json:"tx"`
+	// Extra are the chain specific fields of the block set by the parser or by the backend, stored by PackBlockExtra
+	Extra BlockExtra `json:"-"`
+	// Weight is the weight of the block as defined in BIP141, set by the parsers that are able to compute it or by the backend,
+	// SigOps is the number of the legacy signature operations in the scripts of the block, set only by the parsers
+	Weight int64 `json:"weight,omitempty"`
+	SigOps int64 `json:"-"`
+	// Withdrawals are the withdrawals from the beacon chain credited to the addresses by the block (post-Shanghai Ethereum)
+	Withdrawals []Withdrawal `json:"-"`
 }
 
+// Withdrawal is the withdrawal from the beacon chain to an address, Index is the global sequence number of the withdrawal
+type Withdrawal struct {
+	Index          uint64
+	ValidatorIndex uint64
+	Address        string
+	AmountSat      big.Int
+}
+
+// BlockExtra are the chain specific fields of a block (e.g. version bits signalling, chainwork, difficulty, stake modifier),
+// which are not indexed but are stored with the block info and returned by the block api
+type BlockExtra map[string]interface{}
+
 // BlockHeader contains limited data (as needed for indexing) from backend block header
 type BlockHeader struct {
 	Hash          string `json:"hash"`
@@ -91,6 +118,13 @@ type BlockInfo struct {
 	Bits       string      `json:"bits"`
 	Difficulty json.Number `json:"difficulty"`
 	Txids      []string    `json:"tx,omitempty"`
+	// BaseFee is the base fee per gas of the block in wei (ethereum type chains after EIP-1559), hex encoded
+	BaseFee string `json:"baseFeePerGas,omitempty"`
+	// BlobGasUsed and ExcessBlobGas are the blob gas fields of the block (ethereum type chains after EIP-4844), hex encoded,
+	// BlobCount is the number of blobs carried by the transactions of the block
+	BlobGasUsed   string `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas string `json:"excessBlobGas,omitempty"`
+	BlobCount     int    `json:"blobCount,omitempty"`
 }
 
 type MempoolEntry struct {
@@ -110,6 +144,53 @@ type MempoolEntry struct {
 	Depends         []string    `json:"depends"`
 }
 
+// MempoolAcceptResult is the result of the test of the acceptance of a transaction to the mempool of the backend
+type MempoolAcceptResult struct {
+	Txid         string `json:"txid"`
+	Allowed      bool   `json:"allowed"`
+	RejectReason string `json:"reject-reason,omitempty"`
+}
+
+// MempoolEvictionReason is the reason why a transaction disappeared from the mempool without being confirmed
+type MempoolEvictionReason string
+
+const (
+	// MempoolEvictionReplaced means that another transaction spending the same outputs was accepted to the mempool
+	// or confirmed in a block
+	MempoolEvictionReplaced MempoolEvictionReason = "replaced"
+	// MempoolEvictionExpired means that the transaction was in the mempool longer than the mempool expiry of the backend
+	MempoolEvictionExpired MempoolEvictionReason = "expired"
+	// MempoolEvictionEvicted means that the backend removed the transaction for other reason, usually for low fee when the mempool is full
+	MempoolEvictionEvicted MempoolEvictionReason = "evicted"
+)
+
+// MempoolEviction is the record of a transaction removed from the mempool without being confirmed,
+// ReplacedBy is empty if the replacing transaction was confirmed before it was seen in the mempool
+type MempoolEviction struct {
+	Txid       string                `json:"txid"`
+	Reason     MempoolEvictionReason `json:"reason"`
+	ReplacedBy string                `json:"replacedBy,omitempty"`
+	FirstSeen  int64                 `json:"firstSeen"`
+	Removed    int64                 `json:"removed"`
+	// AddrDescs are the addresses of the inputs and outputs of the transaction
+	AddrDescs []AddressDescriptor `json:"-"`
+}
+
+// MempoolPackage describes the unconfirmed ancestors and descendants of a mempool transaction, which are mined together with it
+// (child pays for parent); the fee rates are in satoshi per virtual byte, AncestorFeeRate is the fee rate of the transaction
+// together with its ancestors, EffectiveFeeRate is the highest fee rate of a package containing the transaction and EffectiveBy
+// is the descendant, whose ancestor package has this fee rate, empty if it is the package of the transaction itself
+type MempoolPackage struct {
+	Txid             string   `json:"txid"`
+	VSize            int64    `json:"vsize"`
+	FeeRate          float64  `json:"feeRate"`
+	AncestorFeeRate  float64  `json:"ancestorFeeRate"`
+	EffectiveFeeRate float64  `json:"effectiveFeeRate"`
+	EffectiveBy      string   `json:"effectiveBy,omitempty"`
+	Ancestors        []string `json:"ancestors,omitempty"`
+	Descendants      []string `json:"descendants,omitempty"`
+}
+
 type ChainInfo struct {
 	Chain           string  `json:"chain"`
 	Blocks          int     `json:"blocks"`
@@ -146,6 +227,15 @@ type OnNewBlockFunc func(hash string, height uint32)
 // OnNewTxAddrFunc is used to send notification about a new transaction/address
 type OnNewTxAddrFunc func(txid string, desc AddressDescriptor, isOutput bool)
 
+// OnMempoolEvictionFunc is used to send notification about transactions removed from the mempool without being confirmed
+type OnMempoolEvictionFunc func(evictions []MempoolEviction)
+
+// IsTxConfirmedFunc checks if the transaction was confirmed in a block
+type IsTxConfirmedFunc func(txid string) bool
+
+// IsOutpointSpentFunc checks if the output of the transaction was spent by a transaction confirmed in a block
+type IsOutpointSpentFunc func(txid string, vout int32) bool
+
 // BlockChain defines common interface to block chain daemon
 type BlockChain interface {
 	// life-cycle methods
@@ -171,11 +261,23 @@ type BlockChain interface {
 	EstimateSmartFee(blocks int, conservative bool) (big.Int, error)
 	EstimateFee(blocks int) (big.Int, error)
 	SendRawTransaction(tx string) (string, error)
+	// TestMempoolAccept checks if the transaction would be accepted to the mempool without sending it
+	TestMempoolAccept(tx string) (*MempoolAcceptResult, error)
+	// GetErc20ContractInfo reads the metadata of ERC-20 token contract from the contract
+	GetErc20ContractInfo(contractDesc AddressDescriptor) (*Erc20Contract, error)
+	// IsContract checks if there is a contract code at the address of account based chain
+	IsContract(addrDesc AddressDescriptor) (bool, error)
 	// mempool
 	ResyncMempool(onNewTxAddr OnNewTxAddrFunc) (int, error)
 	GetMempoolTransactions(address string) ([]string, error)
 	GetMempoolTransactionsForAddrDesc(addrDesc AddressDescriptor) ([]string, error)
 	GetMempoolEntry(txid string) (*MempoolEntry, error)
+	// TrackMempoolEvictions enables the tracking of the transactions removed from the mempool without being confirmed
+	TrackMempoolEvictions(isConfirmed IsTxConfirmedFunc, isSpent IsOutpointSpentFunc, onEviction OnMempoolEvictionFunc)
+	// GetMempoolEviction returns the record of the transaction removed from the mempool or nil if there is none
+	GetMempoolEviction(txid string) (*MempoolEviction, error)
+	// GetMempoolPackage returns the package of the unconfirmed ancestors and descendants of the mempool transaction or nil if it is not known
+	GetMempoolPackage(txid string) (*MempoolPackage, error)
 	// parser
 	GetChainParser() BlockChainParser
 }
@@ -192,6 +294,8 @@ type BlockChainParser interface {
 	KeepBlockAddresses() int
 	// AmountToDecimalString converts amount in big.Int to string with decimal point in the correct place
 	AmountToDecimalString(a *big.Int) string
+	// AmountDecimals returns the number of decimal places of the coin unit
+	AmountDecimals() int
 	// AmountToBigInt converts amount in json.Number (string) to big.Int
 	// it uses string operations to avoid problems with rounding
 	AmountToBigInt(n json.Number) (big.Int, error)
@@ -200,6 +304,36 @@ type BlockChainParser interface {
 	GetAddrDescFromAddress(address string) (AddressDescriptor, error)
 	GetAddressesFromAddrDesc(addrDesc AddressDescriptor) ([]string, bool, error)
 	GetScriptFromAddrDesc(addrDesc AddressDescriptor) ([]byte, error)
+	// IsAddrDescUnspendable returns true if the output with the address descriptor can never be spent and its value is burned
+	IsAddrDescUnspendable(addrDesc AddressDescriptor) bool
+	// ScanSilentPayments returns the outputs of the transaction paying to the silent payments (BIP352) wallet
+	// given by its scan private key and spend public key, prevouts are the output scripts spent by the inputs of the transaction
+	ScanSilentPayments(tx *Tx, prevouts []AddressDescriptor, scanKey []byte, spendPubKey []byte) ([]SilentPaymentMatch, error)
+	// DeriveMultisigAddrDescs returns the address descriptors of the multisig outputs given by the output descriptor
+	// (e.g. wsh(sortedmulti(2,xpub.../0/*,xpub.../0/*))) for the derivation indexes in the range [from, to)
+	// the descriptor without the wildcard describes a single output regardless of the range
+	DeriveMultisigAddrDescs(descriptor string, from, to uint32) ([]AddressDescriptor, error)
+	// DeriveAddrDescs returns the address descriptors of the outputs given by the single key (e.g. wpkh(xpub.../0/*))
+	// or multisig output descriptor for the derivation indexes in the range [from, to)
+	DeriveAddrDescs(descriptor string, from, to uint32) ([]AddressDescriptor, error)
+	// GetNameOperation returns the name operation (e.g. Namecoin name_update) contained in the output script
+	// or nil if the script does not contain any
+	GetNameOperation(addrDesc AddressDescriptor) (*NameOperation, error)
+	// GetNameExpirationDepth returns the number of blocks after the last operation of a name, after which the name expires
+	// at the height, 0 if the names do not expire
+	GetNameExpirationDepth(height uint32) uint32
+	// GetInscriptions returns the ordinals inscriptions revealed by the envelopes in the witnesses of the inputs of the transaction
+	GetInscriptions(tx *Tx) ([]InscriptionEnvelope, error)
+	// GetOutputMemo returns the memo and the payment id attached to the output script or nil if the script does not carry any
+	GetOutputMemo(addrDesc AddressDescriptor) (*OutputMemo, error)
+	// PaymentIDsSupported returns true if the coin has a format of the payment id attached to the outputs
+	PaymentIDsSupported() bool
+	// GetPaymentURIScheme returns the scheme of the payment request URIs (BIP21) of the coin, empty if the coin has none
+	GetPaymentURIScheme() string
+	// GetDustThreshold returns the output value, below which the backend does not relay the transaction, nil if unknown
+	GetDustThreshold() *big.Int
+	// VerifyMessage verifies the signature of the message by the key of the address using the message signing scheme of the coin
+	VerifyMessage(addrDesc AddressDescriptor, signature, message string) (bool, error)
 	// transactions
 	PackedTxidLen() int
 	PackTxid(txid string) ([]byte, error)
@@ -212,4 +346,175 @@ type BlockChainParser interface {
 	PackBlockHash(hash string) ([]byte, error)
 	UnpackBlockHash(buf []byte) (string, error)
 	ParseBlock(b []byte) (*Block, error)
+	// PackBlockExtra packs the chain specific fields of the block stored with the block info, nil means no fields
+	PackBlockExtra(extra BlockExtra) ([]byte, error)
+	// UnpackBlockExtra unpacks the data packed by PackBlockExtra
+	UnpackBlockExtra(buf []byte) (BlockExtra, error)
+	// account based chains
+	// GetTxNonce returns nonce of the account sending the transaction
+	GetTxNonce(tx *Tx) (uint64, error)
+	// GetTxFeeData returns the gas parameters of the transaction
+	GetTxFeeData(tx *Tx) (*TxFeeData, error)
+	// GetErc20Transfers returns the ERC-20 token transfers made by the transaction
+	GetErc20Transfers(tx *Tx) ([]Erc20Transfer, error)
+	// GetMethodSelector returns the selector (0x followed by 8 hex characters) of the contract method signature, e.g. transfer(address,uint256)
+	GetMethodSelector(signature string) (string, error)
+	// GetContractCallSelector returns the selector of the contract method called by the transaction, empty if it is not a contract call
+	GetContractCallSelector(tx *Tx) (string, error)
+	// DecodeContractCall decodes the parameters of the contract call of the transaction by the method signature
+	DecodeContractCall(tx *Tx, signature string) (*ContractCall, error)
+	// chain quirks
+	// GetDuplicateTxids returns the transactions having the same txid as an earlier transaction mapped to the heights of their blocks
+	// (historical duplicate coinbase transactions, which were possible before BIP30), nil if there are none
+	GetDuplicateTxids() map[string]uint32
+	// rewards
+	// GetTxRewardTypes classifies the outputs of coinbase transaction in block of given height
+	// returns nil if the transaction is not classified, ErrNotSupported if the coin does not classify the rewards
+	GetTxRewardTypes(tx *Tx, height uint32) ([]RewardType, error)
+	// GetBlockSubsidy returns the amount of new coins created by the block of given height
+	// returns ErrNotSupported if the emission schedule of the coin is not known
+	GetBlockSubsidy(height uint32) (*big.Int, error)
+	// GetEmissionSchedule returns the ranges of blocks with the same subsidy, the blocks after the last range have no subsidy
+	GetEmissionSchedule() ([]EmissionEra, error)
+}
+
+// SilentPaymentMatch is an output of a transaction paying to a silent payments wallet, K is the index of the output
+// in the order of the BIP352 derivation and Tweak is the tweak of the spend key of the wallet needed to spend the output
+type SilentPaymentMatch struct {
+	Vout  uint32
+	K     uint32
+	Tweak []byte
+}
+
+// NameOpType is the type of the name operation, the values are the opcodes of the Namecoin name operations
+type NameOpType uint8
+
+const (
+	// NameOpNew registers the commitment to a name, the name itself is not revealed
+	NameOpNew NameOpType = 1
+	// NameOpFirstUpdate reveals the name registered by NameOpNew and sets its first value
+	NameOpFirstUpdate NameOpType = 2
+	// NameOpUpdate changes the value or the owner of the name
+	NameOpUpdate NameOpType = 3
+)
+
+func (t NameOpType) String() string {
+	switch t {
+	case NameOpNew:
+		return "name_new"
+	case NameOpFirstUpdate:
+		return "name_firstupdate"
+	case NameOpUpdate:
+		return "name_update"
+	}
+	return "unknown"
+}
+
+// NameOperation is a name operation in an output script, Owner is the address descriptor of the script following
+// the name operation, which controls the name; Name and Value are empty for NameOpNew, whose commitment is in Hash
+type NameOperation struct {
+	Op    NameOpType
+	Name  []byte
+	Value []byte
+	Hash  []byte
+	Owner AddressDescriptor
+}
+
+// InscriptionEnvelope is an ordinals inscription revealed by the envelope in the tapscript of the input of a transaction,
+// Index is the order of the inscription in the transaction, the inscription is made on the first sat of its input
+// unless Pointer (the offset of the sat in the outputs of the transaction) is set
+type InscriptionEnvelope struct {
+	Index         int
+	Input         int
+	ContentType   string
+	ContentLength int
+	Pointer       *uint64
+}
+
+// OutputMemo is the data attached to an output, Memo is the data readable as text, PaymentID identifies the payment
+// (e.g. an invoice) and the outputs carrying it can be looked up in the index; either of them can be empty
+type OutputMemo struct {
+	Memo      string
+	PaymentID []byte
+}
+
+// EmissionEra is a range of blocks with the same block subsidy, both heights are inclusive
+type EmissionEra struct {
+	FromHeight uint32
+	ToHeight   uint32
+	Subsidy    big.Int
+}
+
+// TxFeeData contains the gas parameters of transaction of account based chain, the prices are in the base units of the coin
+// MaxFeePerGas and MaxPriorityFeePerGas are set only for EIP-1559 transactions, EffectiveGasPrice only for mined transactions,
+// MaxFeePerBlobGas and BlobVersionedHashes only for EIP-4844 blob transactions, BlobGasUsed and BlobGasPrice only for mined blob transactions
+type TxFeeData struct {
+	Type                 uint32
+	GasLimit             uint64
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	EffectiveGasPrice    *big.Int
+	MaxFeePerBlobGas     *big.Int
+	BlobVersionedHashes  []string
+	BlobGasUsed          uint64
+	BlobGasPrice         *big.Int
+}
+
+// Erc20Contract is the metadata of ERC-20 token contract, the fields of the optional functions
+// which the contract does not implement are left empty
+type Erc20Contract struct {
+	Contract string `json:"contract"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// ContractCall is the call of a method of a contract decoded from the input data of the transaction, Signature and Name are empty
+// if the selector is not in the dictionary of the method signatures, Params are empty if the parameters could not be decoded
+type ContractCall struct {
+	Selector  string              `json:"selector"`
+	Signature string              `json:"signature,omitempty"`
+	Name      string              `json:"name,omitempty"`
+	Params    []ContractCallParam `json:"params,omitempty"`
+}
+
+// ContractCallParam is a decoded parameter of the contract call, Values are the elements of the arrays
+type ContractCallParam struct {
+	Type   string   `json:"type"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// Erc20Transfer is a transfer of ERC-20 tokens, Tokens is the amount in the base units of the token
+type Erc20Transfer struct {
+	Contract string
+	From     string
+	To       string
+	Tokens   big.Int
+}
+
+// RewardType describes the kind of block reward paid by an output of coinbase transaction
+type RewardType uint8
+
+const (
+	// RewardNone is an output which is not a reward
+	RewardNone RewardType = iota
+	// RewardMining is paid to the miner of the block
+	RewardMining
+	// RewardMasternode is paid to a masternode (its owner)
+	RewardMasternode
+	// RewardSuperblock is paid by a superblock to the budget proposals
+	RewardSuperblock
+	// RewardOperator is the share of the masternode reward paid to the operator of the masternode (Dash DIP3)
+	RewardOperator
+)
+
+var rewardTypeNames = []string{"", "mining", "masternode", "superblock", "operator"}
+
+func (r RewardType) String() string {
+	if int(r) < len(rewardTypeNames) {
+		return rewardTypeNames[r]
+	}
+	return ""
 }
@@ -7,15 +7,24 @@ import (
 	"blockbook/common"
 	"blockbook/db"
 	"blockbook/server"
+	"bufio"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
 	_ "net/http/pprof"
+	"net/url"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -33,16 +42,28 @@ const debounceResyncMempoolMs = 1009
 // store internal state about once every minute
 const storeInternalStatePeriodMs = 59699
 
+// store snapshot of mempool for fee history every 10 minutes
+const storeMempoolSnapshotPeriod = 10 * time.Minute
+
+// confirmation targets of fee estimates stored in mempool snapshot
+var mempoolSnapshotFeeTargets = []int{2, 6, 25}
+
 var (
 	blockchain = flag.String("blockchaincfg", "", "path to blockchain RPC service configuration json file")
 
 	dbPath         = flag.String("datadir", "./data", "path to database directory")
 	dbCache        = flag.Int("dbcache", 1<<29, "size of the rocksdb cache")
 	dbMaxOpenFiles = flag.Int("dbmaxopenfiles", 1<<14, "max open files by rocksdb")
+	dbCacheParts   = flag.String("dbcachepartitions", "", "own parts of the rocksdb cache for the columns as a comma separated list of <column>=<ratio of dbcache> (e.g. txAddresses=0.4,addressBalance=0.2), the rest of the cache is shared by the other columns")
+	txAddrCache    = flag.Int("txaddressescache", 50000, "number of unpacked txAddresses cached between the block connects, 0 disables the cache")
+	warmupBlocks   = flag.Int("warmup", 0, "number of recent blocks, the data of which are read to the db cache after the start and after the reopen of the db, 0 disables the warmup")
+	lowMemory      = flag.Bool("lowmem", false, "low memory profile for hosts with 2-4GB RAM indexing small chains, reduces rocksdb buffers, cache and bulk sync batches (explicitly set parameters are not changed)")
 
 	blockFrom      = flag.Int("blockheight", -1, "height of the starting block")
 	blockUntil     = flag.Int("blockuntil", -1, "height of the final block")
 	rollbackHeight = flag.Int("rollback", -1, "rollback to the given height and quit")
+	checkGaps      = flag.Bool("checkgaps", false, "report blocks missing in the index between the starting block (blockheight or the first block of the index) and the best block and quit")
+	healGaps       = flag.Bool("healgaps", false, "restore the blocks missing in the index, if their transactions are indexed, otherwise reconnect the index from the first missing block, and quit")
 
 	queryAddress = flag.String("address", "", "query contents of this address")
 
@@ -51,8 +72,24 @@ var (
 	prof        = flag.String("prof", "", "http server binding [address]:port of the interface to profiling data /debug/pprof/ (default no profiling)")
 
 	syncChunk   = flag.Int("chunk", 100, "block chunk size for processing in bulk mode")
-	syncWorkers = flag.Int("workers", 8, "number of workers to process blocks in bulk mode")
+	syncWorkers = flag.Int("workers", 16, "maximum number of concurrent block fetches in bulk mode, the number is tuned by the latency of the backend, see docs/build.md")
 	dryRun      = flag.Bool("dryrun", false, "do not index blocks, only download")
+	syncShards  = flag.Int("syncshards", 0, "experimental: number of block ranges processed in parallel into temporary dbs during the bulk sync of UTXO chains, see docs/build.md (default 0 - disabled)")
+
+	repairTxAddresses = flag.Bool("repairtxaddresses", false, "fetch the transactions spent by the connected blocks, which are missing in the txAddresses column, from the backend and store their txAddresses, see docs/build.md")
+
+	indexDelta       = flag.Uint("indexdelta", 0, "number of the last connected blocks, for which the writes to the db are kept and served to the mirrors by the index-delta endpoint of the internal server, see docs/build.md (default 0 - disabled)")
+	indexDeltaSource = flag.String("indexdeltasource", "", "url of the index-delta endpoint of the internal server of the source Blockbook, the db is kept synchronized as its mirror by the index deltas instead of -sync, see docs/build.md")
+	indexDeltaPeriod = flag.Duration("indexdeltaperiod", 10*time.Second, "period of the requests of the index delta by the mirror")
+	indexHash        = flag.Bool("indexhash", false, "keep the rolling hashes of the writes of the connected blocks to the db, served by the index-hash endpoint of the internal server to compare the index with other instances, see docs/build.md")
+
+	methodSignatures = flag.String("methodsignatures", "", "file with the signatures of the contract methods, one per line optionally preceded by the selector, used to decode the contract calls of ethereum type chains, see docs/build.md")
+
+	syncMaxBlockRate     = flag.Float64("syncmaxblockrate", 0, "maximum number of blocks connected per second by the sync (default 0 - unlimited)")
+	syncMaxPendingWrites = flag.Uint64("syncmaxpendingwrites", 0, "pause the sync while the size of the immutable memtables and of the pending compaction of the db exceeds the given number of bytes (default 0 - unlimited)")
+	syncMaxAPILatency    = flag.Duration("syncmaxapilatency", 0, "pause the sync while the 95th percentile of the duration of the public API requests (except the address stream, export and feed) exceeds the given duration (default 0 - unlimited)")
+
+	additionalNetworks = flag.String("networks", "", "comma separated list of additional networks indexed by the same process <prefix>:<blockchaincfg>:<datadir>, their public interface is served under /<prefix>/ of the public server, see docs/build.md (default none)")
 
 	debugMode = flag.Bool("debug", false, "debug mode, return more verbose errors, reload templates on each request")
 
@@ -60,13 +97,75 @@ var (
 
 	publicBinding = flag.String("public", "", "public http server binding [address]:port[/path] (default no public server)")
 
+	internalListeners = flag.String("internallisteners", "", "comma separated list of additional listeners of the internal server tcp:<[address]:port>, unix:<path> or onion:<tor controller [address]:port>, optionally followed by ;option=value, see docs/build.md (default none)")
+
+	publicListeners = flag.String("publiclisteners", "", "comma separated list of additional listeners of the public server, same format as internallisteners (default none)")
+
+	internalHTTPOptions = flag.String("internalhttpoptions", "", "http options of the internal server binding cors=<origin>, compress=gzip or http2=<bool>, separated by ;, see docs/build.md (default none)")
+
+	publicHTTPOptions = flag.String("publichttpoptions", "", "http options of the public server binding, same format as internalhttpoptions (default none)")
+
+	auditLog = flag.String("auditlog", "", "directory of the audit log of the public API queries, optionally followed by ;option=value, see docs/build.md (default none)")
+
+	quotas = flag.String("quotas", "", "json file with the configuration of the quotas of the clients of the public API and socket.io interface, changeable at runtime by the admin/quotas endpoint of the internal server, see docs/build.md (default none)")
+
+	denylists = flag.String("denylists", "", "comma separated list of denylists (files or http(s) urls) of the addresses annotated or redacted in the public API responses and notifications, each optionally followed by ;option=value, see docs/build.md (default none)")
+
 	certFiles = flag.String("certfile", "", "to enable SSL specify path to certificate files without extension, expecting <certfile>.crt and <certfile>.key (default no SSL)")
 
 	explorerURL = flag.String("explorer", "", "address of blockchain explorer")
 
-	noTxCache = flag.Bool("notxcache", false, "disable tx cache")
+	largeAddressTxs = flag.Uint("largeaddresstxs", 0, "number of transactions above which the history of an address is returned only in the summary-only mode paged by cursor and the requests of its whole history are refused (default 0 - no limit)")
+
+	noTxCache    = flag.Bool("notxcache", false, "disable tx cache")
+	txCacheStore = flag.String("txcachestore", "", "shared store of the tx cache, redis://[:password@]host:port[/db] or memcached://host:port, see docs/build.md (default the tx cache is in the db)")
+	txCacheTTL   = flag.Duration("txcachettl", 24*time.Hour, "time after which the transactions expire from the shared tx cache store, used by txcachestore")
+
+	dustFilterOutputs   = flag.Int("dustfilteroutputs", 0, "tag transactions with at least this number of dust outputs to distinct addresses as dust attack (default 0 - disabled)")
+	dustFilterThreshold = flag.Int64("dustfilterthreshold", 1000, "maximal value of a dust output in satoshi, used by dustfilteroutputs")
+
+	coinjoinOutputs = flag.Int("coinjoinoutputs", 0, "tag transactions with at least this number of equal outputs to distinct addresses and at least as many inputs as coinjoin (default 0 - disabled)")
+
+	scriptTemplates = flag.String("scripttemplates", "", "comma separated list of hex encoded script skeletons (scripts without pushed data), outputs matching them are indexed (default none)")
+
+	indexFilter = flag.String("indexfilter", "", "comma separated list of rules of the outputs not indexed by address - opreturn, below=<satoshi>, address=<address>, script=<hex script skeleton>, see docs/build.md (default all outputs are indexed)")
+
+	silentPaymentsFile = flag.String("silentpayments", "", "file with silent payments (BIP352) wallets, one <name>,<hex scan private key>,<hex spend public key> per line, outputs paying to them are detected during block connect, see docs/build.md (default none)")
+
+	ordinals = flag.Bool("ordinals", false, "track ordinals inscriptions revealed in the witnesses and their transfers, must be enabled before the initial sync, see docs/build.md")
+
+	paymentIDs = flag.Bool("paymentids", false, "index the payment ids attached to the outputs (OP_RETURN data of at most 32 bytes for Bitcoin type coins), see docs/build.md")
+
+	largestTxs = flag.Bool("largesttxs", false, "keep the largest transactions of the last blocks returned by api/largest-txs, counted from the block connected after enabled, see docs/build.md")
+
+	feeStats = flag.Bool("feestats", false, "store the fee stats of the connected blocks and the snapshots of the mempool for the fee history returned by api/feehistory, see docs/build.md")
+
+	blockSupply = flag.Bool("blocksupply", false, "record the supply changes of the blocks of UTXO chains for the audit of the coin supply by api/coin-supply, summed from the block connected after enabled, see docs/build.md")
+
+	holdingStats = flag.Bool("holdingstats", false, "compute the coin days destroyed and the average holding time of the spent outputs of the addresses of UTXO chains, counted from the block connected after enabled, see docs/build.md")
+
+	counterparties = flag.Bool("counterparties", false, "keep the sketches estimating the number of the distinct counterparties of the addresses of UTXO chains, counted from the block connected after enabled, see docs/build.md")
+
+	connectStatsWindow = flag.Int("connectstatswindow", db.DefaultConnectBlockStatsWindow, "number of the connected blocks in a window of the connect block stats kept in the internal state, see docs/build.md")
+
+	burns         = flag.Bool("burns", false, "index the burned outputs of UTXO chains, the provably unspendable outputs and the outputs to the burn addresses, counted from the block connected after enabled, see docs/build.md")
+	burnAddresses = flag.String("burnaddresses", "", "comma separated list of known burn addresses, the outputs paying to them are counted as burned together with the unspendable outputs, see docs/build.md (default none)")
+
+	ipfsAPI     = flag.String("ipfsapi", "", "http api of IPFS node (e.g. http://127.0.0.1:5001), connected blocks are published to IPFS and their CIDs stored in db (default no archiving)")
+	archiveFrom = flag.Int("archivefrom", -1, "height of the first archived block, used if nothing is archived yet (default the best block)")
+
+	staticExport      = flag.String("staticexport", "", "directory or http(s) url (e.g. of a CDN bucket) to which the static json of the confirmed blocks and transactions is exported, requires public server, see docs/build.md (default no export)")
+	staticExportDepth = flag.Int("staticexportdepth", server.DefaultStaticExportDepth, "number of the confirmations, after which the block is exported by staticexport")
+	staticExportFrom  = flag.Int("staticexportfrom", -1, "height of the first block exported by staticexport, used if nothing is exported yet (default the first block with staticexportdepth confirmations)")
+	sitemapURL        = flag.String("sitemapurl", "", "public url of the explorer, if set, staticexport writes the sitemaps of the block pages (default no sitemaps)")
+
+	walArchive     = flag.String("walarchive", "", "directory to which the rocksdb WAL is archived for point in time recovery of the db, see docs/build.md (default no archiving)")
+	walRetention   = flag.Duration("walretention", 24*time.Hour, "time for which rocksdb keeps the WAL files after they are obsolete, used by walarchive")
+	walRestore     = flag.String("walrestore", "", "create the db in datadir from the checkpoint and the WAL in the given archive directory and exit")
+	walRestoreTime = flag.String("walrestoretime", "", "RFC3339 time, walrestore replays only the WAL archived until this time (default all)")
 
 	computeColumnStats = flag.Bool("computedbstats", false, "compute column stats and exit")
+	printDBSchema      = flag.Bool("dbschema", false, "print the json description of the column families, key formats and value encodings of the db and exit")
 
 	// resync index at least each resyncIndexPeriodMs (could be more often if invoked by message from ZeroMQ)
 	resyncIndexPeriodMs = flag.Int("resyncindexperiod", 935093, "resync index period in milliseconds")
@@ -90,10 +189,19 @@ var (
 	internalState              *common.InternalState
 	callbacksOnNewBlock        []bchain.OnNewBlockFunc
 	callbacksOnNewTxAddr       []bchain.OnNewTxAddrFunc
+	callbacksOnMempoolEviction []bchain.OnMempoolEvictionFunc
+	networks                   []*network
 	chanOsSignal               chan os.Signal
 	inShutdown                 int32
+	// dbPause is held by the loops accessing the db while they run, the migration of the db acquires it to pause them
+	dbPause = make(chan struct{}, 1)
+	// computingColumnStats is not zero while the column stats are computed in background
+	computingColumnStats int32
 )
 
+// migrateDbPauseTimeout is the time for which the migration of the db waits for the loops and the requests in progress
+const migrateDbPauseTimeout = time.Minute
+
 func init() {
 	glog.MaxSize = 1024 * 1024 * 8
 	glog.CopyStandardLogTo("INFO")
@@ -134,12 +242,39 @@ func main() {
 
 	glog.Infof("Blockbook: %+v, debug mode %v", common.GetVersionInfo(), *debugMode)
 
+	if *lowMemory {
+		setLowMemoryProfile()
+	}
+
 	if *prof != "" {
 		go func() {
 			log.Println(http.ListenAndServe(*prof, nil))
 		}()
 	}
 
+	if *printDBSchema {
+		buf, err := json.MarshalIndent(db.GetSchema(), "", "  ")
+		if err != nil {
+			glog.Fatal("dbschema: ", err)
+		}
+		fmt.Println(string(buf))
+		return
+	}
+
+	if *walRestore != "" {
+		var until time.Time
+		if *walRestoreTime != "" {
+			var err error
+			if until, err = time.Parse(time.RFC3339, *walRestoreTime); err != nil {
+				glog.Fatal("walrestoretime: ", err)
+			}
+		}
+		if err := db.RestoreWalArchive(*walRestore, *dbPath, *dbCache, *dbMaxOpenFiles, until); err != nil {
+			glog.Fatal("walrestore: ", err)
+		}
+		return
+	}
+
 	if *repair {
 		if err := db.RepairRocksDB(*dbPath); err != nil {
 			glog.Fatalf("RepairRocksDB %s: %v", *dbPath, err)
@@ -167,12 +302,181 @@ func main() {
 		glog.Fatal("rpc: ", err)
 	}
 
+	if *walArchive != "" {
+		db.SetWalRetention(*walRetention)
+	}
+
+	if *dbCacheParts != "" {
+		p, err := db.ParseCachePartitions(*dbCacheParts)
+		if err != nil {
+			glog.Fatal("dbcachepartitions: ", err)
+		}
+		db.SetCachePartitions(p)
+	}
+
 	index, err = db.NewRocksDB(*dbPath, *dbCache, *dbMaxOpenFiles, chain.GetChainParser(), metrics)
 	if err != nil {
 		glog.Fatal("rocksDB: ", err)
 	}
 	defer index.Close()
 
+	if *scriptTemplates != "" {
+		var skeletons [][]byte
+		for _, t := range strings.Split(*scriptTemplates, ",") {
+			b, err := hex.DecodeString(strings.TrimSpace(t))
+			if err != nil {
+				glog.Fatal("scripttemplates: ", t, ": ", err)
+			}
+			skeletons = append(skeletons, b)
+		}
+		index.SetScriptTemplates(skeletons)
+		glog.Info("Indexing ", len(skeletons), " script templates")
+	}
+
+	var filter *db.IndexFilter
+	if *indexFilter != "" {
+		if filter, err = db.ParseIndexFilter(*indexFilter, chain.GetChainParser()); err != nil {
+			glog.Fatal("indexfilter: ", err)
+		}
+		index.SetIndexFilter(filter)
+		glog.Info("Index filter enabled, skipping ", filter)
+	}
+
+	index.SetTxAddressesCacheSize(*txAddrCache)
+
+	if *dustFilterOutputs > 0 {
+		f := &db.DustFilter{MinOutputs: *dustFilterOutputs}
+		f.ThresholdSat.SetInt64(*dustFilterThreshold)
+		index.SetDustFilter(f)
+		glog.Info("Dust filter enabled, min outputs ", f.MinOutputs, ", threshold ", *dustFilterThreshold)
+	}
+	if *coinjoinOutputs > 0 {
+		if *coinjoinOutputs < 2 {
+			glog.Fatal("coinjoinoutputs: at least 2 equal outputs are required")
+		}
+		index.SetCoinjoinFilter(&db.CoinjoinFilter{MinEqualOutputs: *coinjoinOutputs})
+		glog.Info("Coinjoin detection enabled, min equal outputs ", *coinjoinOutputs)
+	}
+
+	if *silentPaymentsFile != "" {
+		wallets, err := loadSilentPaymentsWallets(*silentPaymentsFile)
+		if err != nil {
+			glog.Fatal("silentpayments: ", err)
+		}
+		if _, err = chain.GetChainParser().ScanSilentPayments(&bchain.Tx{}, nil, nil, nil); err == bchain.ErrNotSupported {
+			glog.Fatal("silentpayments: not supported by coin ", coin)
+		}
+		index.SetSilentPaymentsWallets(wallets)
+		glog.Info("Silent payments detection enabled for ", len(wallets), " wallets")
+	}
+
+	if *paymentIDs {
+		if !chain.GetChainParser().PaymentIDsSupported() {
+			glog.Fatal("paymentids: coin ", coin, " has no payment id format, for Bitcoin type coins set payment_id_prefix in the blockchain configuration")
+		}
+		if filter != nil {
+			glog.Fatal("paymentids: cannot be combined with indexfilter, the payment ids of the filtered outputs of disconnected blocks could not be removed")
+		}
+		index.SetPaymentIDs(true)
+		glog.Info("Payment ids index enabled")
+	}
+
+	if *burns {
+		if !chain.GetChainParser().IsUTXOChain() {
+			glog.Fatal("burns: not supported by coin ", coin)
+		}
+		index.SetBurns(true)
+		glog.Info("Burned outputs index enabled")
+	}
+
+	if *burnAddresses != "" {
+		if !*burns {
+			glog.Fatal("burnaddresses: the burns are not indexed, enable them by the -burns parameter")
+		}
+		var addrDescs []bchain.AddressDescriptor
+		for _, a := range strings.Split(*burnAddresses, ",") {
+			addrDesc, err := chain.GetChainParser().GetAddrDescFromAddress(strings.TrimSpace(a))
+			if err != nil {
+				glog.Fatal("burnaddresses: ", a, ": ", err)
+			}
+			addrDescs = append(addrDescs, addrDesc)
+		}
+		index.SetBurnAddresses(addrDescs)
+		glog.Info("Counting outputs to ", len(addrDescs), " burn addresses as burned")
+	}
+
+	index.SetConnectBlockStatsWindow(*connectStatsWindow)
+
+	if *largestTxs {
+		index.SetLargestTxs(true)
+		glog.Info("Largest transactions enabled")
+	}
+
+	if *feeStats {
+		index.SetFeeStats(true)
+		glog.Info("Fee stats enabled")
+	}
+
+	if *blockSupply {
+		if !chain.GetChainParser().IsUTXOChain() {
+			glog.Fatal("blocksupply: not supported by coin ", coin)
+		}
+		index.SetBlockSupply(true)
+		glog.Info("Block supply changes enabled")
+	}
+
+	if *holdingStats {
+		if !chain.GetChainParser().IsUTXOChain() {
+			glog.Fatal("holdingstats: not supported by coin ", coin)
+		}
+		index.SetHoldingStats(true)
+		glog.Info("Address holding stats enabled")
+	}
+
+	if *counterparties {
+		if !chain.GetChainParser().IsUTXOChain() {
+			glog.Fatal("counterparties: not supported by coin ", coin)
+		}
+		index.SetCounterparties(true)
+		glog.Info("Address counterparty sketches enabled")
+	}
+
+	if *ordinals {
+		if _, err = chain.GetChainParser().GetInscriptions(&bchain.Tx{}); err == bchain.ErrNotSupported {
+			glog.Fatal("ordinals: not supported by coin ", coin)
+		}
+		index.SetOrdinals(true)
+		glog.Info("Ordinals inscriptions tracking enabled")
+	}
+
+	if *indexDeltaSource != "" {
+		if *synchronize {
+			glog.Fatal("indexdeltasource: the mirror cannot be combined with sync")
+		}
+		if *indexDeltaPeriod <= 0 {
+			glog.Fatal("indexdeltaperiod: must be positive")
+		}
+	}
+
+	if *indexDelta > 0 {
+		index.SetIndexDeltaBlocks(uint32(*indexDelta))
+		glog.Info("Index delta of the last ", *indexDelta, " blocks enabled")
+	}
+
+	if *indexHash {
+		index.SetIndexHash(true)
+		glog.Info("Index hash enabled")
+	}
+
+	if *methodSignatures != "" {
+		n, err := index.LoadMethodSignatures(*methodSignatures)
+		if err != nil {
+			glog.Error("methodSignatures: ", err)
+			return
+		}
+		glog.Info("Loaded ", n, " method signatures from ", *methodSignatures)
+	}
+
 	internalState, err = newInternalState(coin, coinShortcut, coinLabel, index)
 	if err != nil {
 		glog.Error("internalState: ", err)
@@ -201,6 +505,10 @@ func main() {
 	if err != nil {
 		glog.Fatalf("NewSyncWorker %v", err)
 	}
+	if err = syncWorker.SetShards(*syncShards); err != nil {
+		glog.Fatal("syncshards: ", err)
+	}
+	syncWorker.SetTxAddressesRepair(*repairTxAddresses)
 
 	// set the DbState to open at this moment, after all important workers are initialized
 	internalState.DbState = common.DbStateOpen
@@ -236,6 +544,28 @@ func main() {
 		return
 	}
 
+	if *checkGaps || *healGaps {
+		if err = checkHeightGaps(index, syncWorker, *healGaps); err != nil {
+			glog.Error("checkHeightGaps: ", err)
+		}
+		return
+	}
+
+	if *warmupBlocks > 0 {
+		index.SetCacheWarmup(*warmupBlocks)
+	}
+
+	if *txCacheStore != "" && !*noTxCache {
+		store, err := db.NewTxCacheStore(*txCacheStore, "blockbook:"+coinShortcut+":", *txCacheTTL)
+		if err != nil {
+			glog.Error("txcachestore: ", err)
+			return
+		}
+		defer store.Close()
+		index.SetTxCacheStore(store)
+		glog.Info("txcache: shared store enabled, ttl ", *txCacheTTL)
+	}
+
 	if txCache, err = db.NewTxCache(index, chain, metrics, internalState, !*noTxCache); err != nil {
 		glog.Error("txCache ", err)
 		return
@@ -246,6 +576,37 @@ func main() {
 		glog.Error("blockbookAppInfoMetric ", err)
 	}
 
+	if *additionalNetworks != "" {
+		if networks, err = parseNetworks(*additionalNetworks); err != nil {
+			glog.Error("networks: ", err)
+			return
+		}
+		for _, n := range networks {
+			if err = n.open(); err != nil {
+				glog.Error("network ", n.prefix, ": ", err)
+				n.close()
+				return
+			}
+			defer n.close()
+		}
+		if *publicBinding == "" {
+			glog.Warning("networks: the public server is not running, the networks are only synchronized")
+		}
+	}
+
+	var apiQuotas *server.Quotas
+	if *quotas != "" {
+		var c *server.QuotaConfig
+		if c, err = server.LoadQuotaConfig(*quotas); err != nil {
+			glog.Error("quotas: ", err)
+			return
+		}
+		if apiQuotas, err = server.NewQuotas(c, metrics); err != nil {
+			glog.Error("quotas: ", err)
+			return
+		}
+	}
+
 	var internalServer *server.InternalServer
 	if *internalBinding != "" {
 		internalServer, err = server.NewInternalServer(*internalBinding, *certFiles, index, chain, txCache, internalState)
@@ -253,6 +614,21 @@ func main() {
 			glog.Error("https: ", err)
 			return
 		}
+		var listeners []*server.ListenerConfig
+		if listeners, err = server.ParseListeners(*internalListeners); err != nil {
+			glog.Error("internallisteners: ", err)
+			return
+		}
+		if apiQuotas != nil {
+			internalServer.SetQuotas(apiQuotas)
+		}
+		internalServer.SetListeners(listeners)
+		var httpOptions *server.HTTPOptions
+		if httpOptions, err = server.ParseHTTPOptions(*internalHTTPOptions); err != nil {
+			glog.Error("internalhttpoptions: ", err)
+			return
+		}
+		internalServer.SetHTTPOptions(httpOptions)
 		go func() {
 			err = internalServer.Run()
 			if err != nil {
@@ -274,6 +650,56 @@ func main() {
 			glog.Error("socketio: ", err)
 			return
 		}
+		if apiQuotas != nil {
+			publicServer.SetQuotas(apiQuotas)
+		}
+		if *auditLog != "" {
+			var c *server.AuditLogConfig
+			if c, err = server.ParseAuditLogConfig(*auditLog); err != nil {
+				glog.Error("auditlog: ", err)
+				return
+			}
+			var a *server.AuditLog
+			if a, err = server.NewAuditLog(c); err != nil {
+				glog.Error("auditlog: ", err)
+				return
+			}
+			defer a.Close()
+			publicServer.SetAuditLog(a)
+		}
+		if *denylists != "" {
+			var sources []*server.DenylistSource
+			if sources, err = server.ParseDenylistSources(*denylists); err != nil {
+				glog.Error("denylists: ", err)
+				return
+			}
+			var d *server.Denylist
+			if d, err = server.NewDenylist(sources, chain.GetChainParser()); err != nil {
+				glog.Error("denylists: ", err)
+				return
+			}
+			defer d.Close()
+			publicServer.SetAddressScreener(d)
+		}
+		var listeners []*server.ListenerConfig
+		if listeners, err = server.ParseListeners(*publicListeners); err != nil {
+			glog.Error("publiclisteners: ", err)
+			return
+		}
+		publicServer.SetListeners(listeners)
+		var httpOptions *server.HTTPOptions
+		if httpOptions, err = server.ParseHTTPOptions(*publicHTTPOptions); err != nil {
+			glog.Error("publichttpoptions: ", err)
+			return
+		}
+		publicServer.SetHTTPOptions(httpOptions)
+		publicServer.SetLargeAddressTxs(uint32(*largeAddressTxs))
+		for _, n := range networks {
+			if err = n.mount(publicServer); err != nil {
+				glog.Error("network ", n.prefix, ": socketio: ", err)
+				return
+			}
+		}
 		go func() {
 			err = publicServer.Run()
 			if err != nil {
@@ -287,10 +713,80 @@ func main() {
 		}()
 		callbacksOnNewBlock = append(callbacksOnNewBlock, publicServer.OnNewBlock)
 		callbacksOnNewTxAddr = append(callbacksOnNewTxAddr, publicServer.OnNewTxAddr)
+		callbacksOnMempoolEviction = append(callbacksOnMempoolEviction, publicServer.OnMempoolEviction)
+	}
+
+	throttle := &db.SyncThrottle{
+		MaxBlocksPerSecond:   *syncMaxBlockRate,
+		MaxPendingWriteBytes: *syncMaxPendingWrites,
+		MaxAPILatency:        *syncMaxAPILatency,
+	}
+	if publicServer != nil {
+		throttle.APILatency = publicServer.APILatency
+	} else if *syncMaxAPILatency > 0 {
+		glog.Warning("syncmaxapilatency: ignored, the public server is not running")
+	}
+	syncWorker.SetThrottle(throttle)
+
+	webhookNotifier := server.NewWebhookNotifier(chain.GetChainParser())
+	index.SetOnWatchedOutpointSpent(func(spent []db.WatchedOutpointSpent) {
+		webhookNotifier.OnWatchedOutpointSpent(spent)
+		if publicServer != nil {
+			publicServer.OnWatchedOutpointSpent(spent)
+		}
+	})
+	index.SetOnWatchedAddressActivity(webhookNotifier.OnWatchedAddressActivity)
+	index.SetOnMultisigEvents(func(events []db.MultisigEvent) {
+		webhookNotifier.OnMultisigEvents(events)
+		if publicServer != nil {
+			publicServer.OnMultisigEvents(events)
+		}
+	})
+	callbacksOnNewTxAddr = append(callbacksOnNewTxAddr, index.OnNewTxAddr)
+
+	var archiver *db.Archiver
+	if *ipfsAPI != "" {
+		archiver = db.NewArchiver(index, chain, *ipfsAPI, *archiveFrom)
+		go archiver.Run()
+		defer archiver.Close()
+		callbacksOnNewBlock = append(callbacksOnNewBlock, archiver.OnNewBlock)
+	}
+
+	if *staticExport != "" {
+		if publicServer == nil {
+			glog.Fatal("staticexport: the public server is not running")
+		}
+		if *staticExportDepth <= 0 {
+			glog.Fatal("staticexport: staticexportdepth must be positive")
+		}
+		store, err := server.NewStaticStore(*staticExport)
+		if err != nil {
+			glog.Fatal("staticexport: ", err)
+		}
+		staticExporter, err := server.NewStaticExporter(publicServer, store, uint32(*staticExportDepth), *staticExportFrom, *sitemapURL)
+		if err != nil {
+			glog.Fatal("staticexport: ", err)
+		}
+		go staticExporter.Run()
+		defer staticExporter.Close()
+		callbacksOnNewBlock = append(callbacksOnNewBlock, staticExporter.OnNewBlock)
+	}
+
+	if *walArchive != "" {
+		walArchiver, err := db.NewWalArchiver(index, *walArchive)
+		if err != nil {
+			glog.Fatal("walarchive: ", err)
+		}
+		go walArchiver.Run()
+		defer walArchiver.Close()
+		callbacksOnNewBlock = append(callbacksOnNewBlock, walArchiver.OnNewBlock)
+	}
+
+	for _, n := range networks {
+		go n.run()
 	}
 
 	if *synchronize {
-		internalState.SyncMode = true
 		internalState.InitialSync = true
 		if err := syncWorker.ResyncIndex(nil, true); err != nil {
 			glog.Error("resyncIndex ", err)
@@ -302,9 +798,15 @@ func main() {
 			return
 		}
 		internalState.FinishedMempoolSync(mempoolCount)
+		chain.TrackMempoolEvictions(isTxConfirmed, isOutpointSpent, onMempoolEviction)
 		go syncIndexLoop()
 		go syncMempoolLoop()
 		internalState.InitialSync = false
+		if archiver != nil {
+			archiver.Archive()
+		}
+	} else if *indexDeltaSource != "" {
+		go indexDeltaLoop()
 	}
 	go storeInternalStateLoop()
 
@@ -334,17 +836,20 @@ func main() {
 		}
 	}
 
-	if internalServer != nil || publicServer != nil || chain != nil {
-		waitForSignalAndShutdown(internalServer, publicServer, chain, 10*time.Second)
+	if internalServer != nil {
+		internalServer.SetDbMigration(func(path string) error {
+			return migrateDb(path, internalServer, publicServer)
+		})
 	}
 
-	if *synchronize {
-		close(chanSyncIndex)
-		close(chanSyncMempool)
-		close(chanStoreInternalState)
-		<-chanSyncIndexDone
-		<-chanSyncMempoolDone
-		<-chanStoreInternalStateDone
+	if internalServer != nil || publicServer != nil || chain != nil {
+		if err := waitForSignalAndShutdown(internalServer, publicServer, chain, 10*time.Second); err != nil {
+			// the requests still in progress use the db, it must not be closed under them,
+			// the db is left open and is recovered from the WAL on the next start
+			glog.Error("shutdown: ", err, ", exiting without closing the db")
+			glog.Flush()
+			os.Exit(1)
+		}
 	}
 }
 
@@ -390,6 +895,130 @@ func newInternalState(coin, coinShortcut, coinLabel string, d *db.RocksDB) (*com
 	return is, nil
 }
 
+// setLowMemoryProfile switches db to the low memory profile and lowers the defaults of the parameters, which were not set explicitly
+func setLowMemoryProfile() {
+	if err := db.SetMemoryProfile(db.LowMemoryProfile); err != nil {
+		glog.Fatal("setLowMemoryProfile: ", err)
+	}
+	set := make(map[string]struct{})
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = struct{}{}
+	})
+	defaults := []struct {
+		name  string
+		value *int
+		low   int
+	}{
+		{"dbcache", dbCache, 1 << 27},
+		{"dbmaxopenfiles", dbMaxOpenFiles, 1 << 10},
+		{"txaddressescache", txAddrCache, 10000},
+		{"chunk", syncChunk, 20},
+		{"workers", syncWorkers, 2},
+	}
+	for _, d := range defaults {
+		if _, found := set[d.name]; !found {
+			*d.value = d.low
+		}
+	}
+	// collect garbage more often, at the cost of cpu time
+	debug.SetGCPercent(50)
+	glog.Info("Low memory profile: dbcache ", *dbCache, ", dbmaxopenfiles ", *dbMaxOpenFiles, ", txaddressescache ", *txAddrCache, ", chunk ", *syncChunk, ", workers ", *syncWorkers)
+}
+
+// checkHeightGaps reports the blocks missing in the index (caused for example by a crash during the sync)
+// and optionally restores those of them, transactions of which are already indexed
+func checkHeightGaps(index *db.RocksDB, syncWorker *db.SyncWorker, heal bool) error {
+	var lower uint32
+	if *blockFrom > 0 {
+		lower = uint32(*blockFrom)
+	}
+	gaps, err := index.FindHeightGaps(lower)
+	if err != nil {
+		return err
+	}
+	if len(gaps) == 0 {
+		glog.Info("checkHeightGaps: no missing blocks from height ", lower)
+		return nil
+	}
+	missing := 0
+	for _, g := range gaps {
+		glog.Infof("checkHeightGaps: missing blocks %d-%d", g.Lower, g.Higher)
+		missing += int(g.Higher-g.Lower) + 1
+	}
+	glog.Infof("checkHeightGaps: %d missing blocks in %d gaps", missing, len(gaps))
+	if !heal {
+		return nil
+	}
+	unindexed, err := syncWorker.HealHeightGaps(gaps)
+	if err != nil {
+		return err
+	}
+	if len(unindexed) > 0 {
+		glog.Infof("checkHeightGaps: %d blocks were not indexed, the index was reconnected from height %d", len(unindexed), unindexed[0])
+	} else {
+		glog.Info("checkHeightGaps: all missing blocks restored")
+	}
+	return nil
+}
+
+// withDbPause returns the function running f while holding dbPause, so that the db is not switched by the migration during f
+func withDbPause(f func()) func() {
+	return func() {
+		dbPause <- struct{}{}
+		defer func() { <-dbPause }()
+		f()
+	}
+}
+
+// migrateDb moves the db to the directory path, the loops accessing the db and the servers are paused during the switch of the db
+func migrateDb(path string, internalServer *server.InternalServer, publicServer *server.PublicServer) error {
+	if *walArchive != "" || *ipfsAPI != "" {
+		return errors.New("Migration of the db is not supported with walarchive or ipfsapi")
+	}
+	if internalState.InitialSync {
+		return errors.New("Migration of the db is not possible during the initial synchronization")
+	}
+	return index.MigrateTo(path, func() (func(), error) {
+		timer := time.NewTimer(migrateDbPauseTimeout)
+		defer timer.Stop()
+		select {
+		case dbPause <- struct{}{}:
+		case <-timer.C:
+			return nil, errors.New("Timeout waiting for the synchronization")
+		}
+		resume := func() { <-dbPause }
+		if atomic.LoadInt32(&computingColumnStats) != 0 {
+			resume()
+			return nil, errors.New("Computation of the column stats is running")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), migrateDbPauseTimeout)
+		defer cancel()
+		if publicServer != nil {
+			if err := publicServer.Pause(ctx); err != nil {
+				resume()
+				return nil, errors.Annotatef(err, "public server")
+			}
+			r := resume
+			resume = func() {
+				publicServer.Resume()
+				r()
+			}
+		}
+		if internalServer != nil {
+			if err := internalServer.Pause(ctx); err != nil {
+				resume()
+				return nil, errors.Annotatef(err, "internal server")
+			}
+			r := resume
+			resume = func() {
+				internalServer.Resume()
+				r()
+			}
+		}
+		return resume, nil
+	})
+}
+
 func tickAndDebounce(tickTime time.Duration, debounceTime time.Duration, input chan struct{}, f func()) {
 	timer := time.NewTimer(tickTime)
 	var firstDebounce time.Time
@@ -429,14 +1058,60 @@ func syncIndexLoop() {
 	defer close(chanSyncIndexDone)
 	glog.Info("syncIndexLoop starting")
 	// resync index about every 15 minutes if there are no chanSyncIndex requests, with debounce 1 second
-	tickAndDebounce(time.Duration(*resyncIndexPeriodMs)*time.Millisecond, debounceResyncIndexMs*time.Millisecond, chanSyncIndex, func() {
+	tickAndDebounce(time.Duration(*resyncIndexPeriodMs)*time.Millisecond, debounceResyncIndexMs*time.Millisecond, chanSyncIndex, withDbPause(func() {
 		if err := syncWorker.ResyncIndex(onNewBlockHash, false); err != nil {
 			glog.Error("syncIndexLoop ", errors.ErrorStack(err))
 		}
-	})
+	}))
 	glog.Info("syncIndexLoop stopped")
 }
 
+// indexDeltaLoop keeps the db synchronized as the mirror of the source Blockbook by its index deltas
+func indexDeltaLoop() {
+	defer close(chanSyncIndexDone)
+	glog.Info("indexDeltaLoop starting")
+	client := &http.Client{Timeout: time.Minute}
+	fetch := func(since uint32) ([]byte, error) {
+		u, err := url.Parse(*indexDeltaSource)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("since", strconv.FormatUint(uint64(since), 10))
+		u.RawQuery = q.Encode()
+		resp, err := client.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("status %v: %v", resp.StatusCode, strings.TrimSpace(string(b)))
+		}
+		return b, nil
+	}
+	// the new block notifications of the backend (if any) request the delta immediately
+	tickAndDebounce(*indexDeltaPeriod, debounceResyncIndexMs*time.Millisecond, chanSyncIndex, withDbPause(func() {
+		connected, err := index.SyncIndexDelta(fetch)
+		if err != nil {
+			glog.Error("indexDeltaLoop ", errors.ErrorStack(err))
+		}
+		if connected > 0 {
+			height, hash, err := index.GetBestBlock()
+			if err != nil {
+				glog.Error("indexDeltaLoop ", err)
+				return
+			}
+			glog.Info("indexDeltaLoop: connected ", connected, " blocks, best block ", height, " ", hash)
+			onNewBlockHash(hash, height)
+		}
+	}))
+	glog.Info("indexDeltaLoop stopped")
+}
+
 func onNewBlockHash(hash string, height uint32) {
 	for _, c := range callbacksOnNewBlock {
 		c(hash, height)
@@ -446,23 +1121,54 @@ func onNewBlockHash(hash string, height uint32) {
 func syncMempoolLoop() {
 	defer close(chanSyncMempoolDone)
 	glog.Info("syncMempoolLoop starting")
+	var lastSnapshot time.Time
 	// resync mempool about every minute if there are no chanSyncMempool requests, with debounce 1 second
-	tickAndDebounce(time.Duration(*resyncMempoolPeriodMs)*time.Millisecond, debounceResyncMempoolMs*time.Millisecond, chanSyncMempool, func() {
+	tickAndDebounce(time.Duration(*resyncMempoolPeriodMs)*time.Millisecond, debounceResyncMempoolMs*time.Millisecond, chanSyncMempool, withDbPause(func() {
 		internalState.StartedMempoolSync()
 		if count, err := chain.ResyncMempool(onNewTxAddr); err != nil {
 			glog.Error("syncMempoolLoop ", errors.ErrorStack(err))
 		} else {
 			internalState.FinishedMempoolSync(count)
-
+			if *feeStats && lastSnapshot.Add(storeMempoolSnapshotPeriod).Before(time.Now()) {
+				storeMempoolSnapshot(count)
+				lastSnapshot = time.Now()
+			}
 		}
-	})
+	}))
 	glog.Info("syncMempoolLoop stopped")
 }
 
+func storeMempoolSnapshot(count int) {
+	ms := db.MempoolSnapshot{
+		Time: time.Now().Unix(),
+		Txs:  uint32(count),
+	}
+	for _, blocks := range mempoolSnapshotFeeTargets {
+		fee, err := chain.EstimateSmartFee(blocks, true)
+		if err != nil {
+			fee, err = chain.EstimateFee(blocks)
+			if err != nil {
+				glog.V(1).Info("storeMempoolSnapshot: estimate fee ", blocks, " error ", err)
+				continue
+			}
+		}
+		ms.FeeEstimates = append(ms.FeeEstimates, db.MempoolFeeEstimate{Blocks: uint32(blocks), FeeSat: fee})
+	}
+	if err := index.StoreMempoolSnapshot(&ms); err != nil {
+		glog.Error("storeMempoolSnapshot ", err)
+	}
+	if err := index.CleanupMempoolSnapshots(); err != nil {
+		glog.Error("storeMempoolSnapshot cleanup ", err)
+	}
+}
+
 func storeInternalStateLoop() {
 	stopCompute := make(chan os.Signal)
+	var computeWg sync.WaitGroup
 	defer func() {
+		// wait for the interrupted computation, its iterators must be closed before the db
 		close(stopCompute)
+		computeWg.Wait()
 		close(chanStoreInternalStateDone)
 	}()
 	var computeRunning bool
@@ -472,16 +1178,20 @@ func storeInternalStateLoop() {
 	lastAppInfo := time.Now()
 	logAppInfoPeriod := 15 * time.Minute
 	glog.Info("storeInternalStateLoop starting with db stats recompute period ", computePeriod)
-	tickAndDebounce(storeInternalStatePeriodMs*time.Millisecond, (storeInternalStatePeriodMs-1)*time.Millisecond, chanStoreInternalState, func() {
+	tickAndDebounce(storeInternalStatePeriodMs*time.Millisecond, (storeInternalStatePeriodMs-1)*time.Millisecond, chanStoreInternalState, withDbPause(func() {
 		if !computeRunning && lastCompute.Add(computePeriod).Before(time.Now()) {
 			computeRunning = true
+			atomic.StoreInt32(&computingColumnStats, 1)
+			computeWg.Add(1)
 			go func() {
+				defer computeWg.Done()
 				err := index.ComputeInternalStateColumnStats(stopCompute)
 				if err != nil {
 					glog.Error("computeInternalStateColumnStats error: ", err)
 				}
 				lastCompute = time.Now()
 				computeRunning = false
+				atomic.StoreInt32(&computingColumnStats, 0)
 			}()
 		}
 		if err := index.StoreInternalState(internalState); err != nil {
@@ -494,16 +1204,80 @@ func storeInternalStateLoop() {
 			}
 			lastAppInfo = time.Now()
 		}
-	})
+	}))
 	glog.Info("storeInternalStateLoop stopped")
 }
 
+// loadSilentPaymentsWallets reads the silent payments wallets from the file, empty lines and lines starting with # are ignored
+func loadSilentPaymentsWallets(path string) ([]*db.SilentPaymentsWallet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var wallets []*db.SilentPaymentsWallet
+	names := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		fields := strings.Split(l, ",")
+		if len(fields) != 3 {
+			return nil, errors.Errorf("line %d: expecting <name>,<scan key>,<spend public key>", line)
+		}
+		w, err := db.NewSilentPaymentsWallet(strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1]), strings.TrimSpace(fields[2]))
+		if err != nil {
+			return nil, errors.Annotatef(err, "line %d", line)
+		}
+		if _, found := names[w.Name]; found {
+			return nil, errors.Errorf("line %d: duplicate wallet %v", line, w.Name)
+		}
+		names[w.Name] = struct{}{}
+		wallets = append(wallets, w)
+	}
+	return wallets, scanner.Err()
+}
+
 func onNewTxAddr(txid string, desc bchain.AddressDescriptor, isOutput bool) {
 	for _, c := range callbacksOnNewTxAddr {
 		c(txid, desc, isOutput)
 	}
 }
 
+// isTxConfirmed checks if the transaction removed from the mempool was confirmed, UTXO chains use the index
+// in case of an error the transaction is considered confirmed so that no false eviction is reported
+func isTxConfirmed(txid string) bool {
+	if chain.GetChainParser().IsUTXOChain() {
+		ta, err := index.GetTxAddresses(txid)
+		if err != nil {
+			glog.Error("isTxConfirmed ", txid, ": ", err)
+			return true
+		}
+		return ta != nil
+	}
+	tx, err := chain.GetTransaction(txid)
+	return err == nil && tx.Confirmations > 0
+}
+
+// isOutpointSpent checks in the index if the output spent by the transaction removed from the mempool
+// was spent by a confirmed transaction, the outputs of the transactions not in the index are unspent
+func isOutpointSpent(txid string, vout int32) bool {
+	ta, err := index.GetTxAddresses(txid)
+	if err != nil {
+		glog.Error("isOutpointSpent ", txid, ": ", err)
+		return false
+	}
+	return ta != nil && vout >= 0 && int(vout) < len(ta.Outputs) && ta.Outputs[vout].Spent
+}
+
+func onMempoolEviction(evictions []bchain.MempoolEviction) {
+	for _, c := range callbacksOnMempoolEviction {
+		c(evictions)
+	}
+}
+
 func pushSynchronizationHandler(nt bchain.NotificationType) {
 	if atomic.LoadInt32(&inShutdown) != 0 {
 		return
@@ -518,31 +1292,64 @@ func pushSynchronizationHandler(nt bchain.NotificationType) {
 	}
 }
 
-func waitForSignalAndShutdown(internal *server.InternalServer, public *server.PublicServer, chain bchain.BlockChain, timeout time.Duration) {
+// waitForSignalAndShutdown waits for the OS signal and shuts down the app in the order which keeps the db consistent:
+// the running sync is interrupted after the block being connected, the servers stop accepting requests and wait
+// for the requests in progress, the sync loops are stopped and finally the backend is disconnected;
+// the db is closed afterwards by main, which stores the internal state with the db state closed;
+// returns error if the requests of a server did not finish in time, the db must not be closed then
+func waitForSignalAndShutdown(internal *server.InternalServer, public *server.PublicServer, chain bchain.BlockChain, timeout time.Duration) error {
 	sig := <-chanOsSignal
 	atomic.StoreInt32(&inShutdown, 1)
 	glog.Infof("shutdown: %v", sig)
 
+	if syncWorker != nil {
+		syncWorker.Stop()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	var shutdownErr error
 	if internal != nil {
 		if err := internal.Shutdown(ctx); err != nil {
 			glog.Error("internal server: shutdown error: ", err)
+			shutdownErr = errors.Annotatef(err, "internal server")
 		}
 	}
 
 	if public != nil {
 		if err := public.Shutdown(ctx); err != nil {
 			glog.Error("public server: shutdown error: ", err)
+			shutdownErr = errors.Annotatef(err, "public server")
 		}
 	}
 
+	for _, n := range networks {
+		if err := n.shutdown(ctx); err != nil {
+			shutdownErr = errors.Annotatef(err, "network %v", n.prefix)
+		}
+	}
+
+	if *synchronize {
+		close(chanSyncIndex)
+		close(chanSyncMempool)
+		close(chanStoreInternalState)
+		<-chanSyncIndexDone
+		<-chanSyncMempoolDone
+		<-chanStoreInternalStateDone
+		glog.Info("shutdown: sync stopped")
+	} else if *indexDeltaSource != "" {
+		close(chanSyncIndex)
+		<-chanSyncIndexDone
+		glog.Info("shutdown: index delta stopped")
+	}
+
 	if chain != nil {
 		if err := chain.Shutdown(ctx); err != nil {
 			glog.Error("rpc: shutdown error: ", err)
 		}
 	}
+	return shutdownErr
 }
 
 func printResult(txid string, vout uint32, isOutput bool) error {
@@ -61,6 +61,7 @@ type Config struct {
 		ServiceAdditionalParamsTemplate string      `json:"service_additional_params_template"`
 		ProtectMemory                   bool        `json:"protect_memory"`
 		Mainnet                         bool        `json:"mainnet"`
+		Network                         string      `json:"network"`
 		ServerConfigFile                string      `json:"server_config_file"`
 		ClientConfigFile                string      `json:"client_config_file"`
 		AdditionalParams                interface{} `json:"additional_params"`
@@ -168,6 +169,7 @@ func LoadConfig(configsDir, coin string) (*Config, error) {
 		case "gpg":
 		case "sha256":
 		case "gpg-sha256":
+		case "gpg-sha256-detached":
 		default:
 			return nil, fmt.Errorf("Invalid verification type: %s", config.Backend.VerificationType)
 		}
@@ -0,0 +1,147 @@
+// Command bbdiff compares the blockbook db with another blockbook db or with the back-end over a range of block heights
+// and prints the differences, one json object per line. It is meant for validating the db migrations, the changes
+// of the packing format and for detecting the drift of replicas. The dbs are opened in read only mode,
+// the command can run while blockbook is using them.
+//
+// Usage:
+//
+//	bbdiff -datadir=./data -blockchaincfg=build/blockchaincfg.json [-datadir2=./data2] [-from=N] [-to=M] [-balances]
+//
+// If datadir2 is set, the db in datadir (a) is compared with the db in datadir2 (b) by the block infos, the history
+// of the addresses touched by the blocks, the transactions of the blocks and optionally by the current balances
+// of the addresses; the dbs can be of different versions, each db is read in the format of its version (the versions,
+// which can be migrated to the current version, are supported). Otherwise the db (a) is compared with the back-end (b) by the block hashes, the numbers
+// of transactions and the outputs of the transactions.
+// The exit code is 0 if no difference is found, 3 if there are differences.
+package main
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins"
+	"blockbook/common"
+	"blockbook/db"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+var (
+	blockchain   = flag.String("blockchaincfg", "", "path to blockchain RPC service configuration json file, the back-end is used to create the coin parser and is compared with the db if datadir2 is not set")
+	dbPath       = flag.String("datadir", "./data", "path to database directory")
+	dbPath2      = flag.String("datadir2", "", "path to the compared database directory (default compare with the back-end)")
+	dbCache      = flag.Int("dbcache", 1<<26, "size of the rocksdb cache")
+	maxOpenFiles = flag.Int("maxopenfiles", 1<<10, "max number of open rocksdb files")
+	from         = flag.Int("from", 0, "height of the first compared block")
+	to           = flag.Int("to", -1, "height of the last compared block (default the lower of the best blocks)")
+	balances     = flag.Bool("balances", false, "compare also the current balances of the addresses touched by the blocks, only if datadir2 is set")
+	limit        = flag.Int("limit", 1000, "stop after the given number of differences, 0 means no limit")
+)
+
+func main() {
+	flag.Parse()
+	defer glog.Flush()
+	count, err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, count, "differences found")
+	if count > 0 {
+		os.Exit(3)
+	}
+}
+
+func newBlockChain() (bchain.BlockChain, error) {
+	if *blockchain == "" {
+		return nil, errors.New("Missing blockchaincfg configuration parameter")
+	}
+	coin, _, _, err := coins.GetCoinNameFromConfig(*blockchain)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := common.GetMetrics(coin)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := coins.NewBlockChain(coin, *blockchain, func(bchain.NotificationType) {}, metrics)
+	if err != nil {
+		return nil, errors.Annotatef(err, "NewBlockChain")
+	}
+	return chain, nil
+}
+
+func run() (int, error) {
+	if *from < 0 {
+		return 0, errors.New("Invalid parameter from")
+	}
+	chain, err := newBlockChain()
+	if err != nil {
+		return 0, err
+	}
+	parser := chain.GetChainParser()
+	a, err := db.NewRocksDBReadOnly(*dbPath, *dbCache, *maxOpenFiles, parser)
+	if err != nil {
+		return 0, errors.Annotatef(err, "datadir")
+	}
+	defer a.Close()
+	var b *db.RocksDB
+	if *dbPath2 != "" {
+		if b, err = db.NewRocksDBReadOnly(*dbPath2, *dbCache, *maxOpenFiles, parser); err != nil {
+			return 0, errors.Annotatef(err, "datadir2")
+		}
+		defer b.Close()
+	}
+	higher, err := a.GetBestHeight()
+	if err != nil {
+		return 0, err
+	}
+	if b != nil {
+		hb, err := b.GetBestHeight()
+		if err != nil {
+			return 0, err
+		}
+		if hb < higher {
+			higher = hb
+		}
+	} else {
+		hb, err := chain.GetBestBlockHeight()
+		if err != nil {
+			return 0, err
+		}
+		if hb < higher {
+			higher = hb
+		}
+	}
+	if *to >= 0 && uint32(*to) < higher {
+		higher = uint32(*to)
+	}
+	lower := uint32(*from)
+	if b != nil {
+		glog.Info("comparing blocks ", lower, "-", higher, ", data versions ", a.DataVersion(), " and ", b.DataVersion())
+	} else {
+		glog.Info("comparing blocks ", lower, "-", higher)
+	}
+	count := 0
+	enc := json.NewEncoder(os.Stdout)
+	fn := func(diff *db.IndexDiff) error {
+		count++
+		if err := enc.Encode(diff); err != nil {
+			return err
+		}
+		if *limit > 0 && count >= *limit {
+			glog.Warning("limit of ", *limit, " differences reached, stopping at height ", diff.Height)
+			return &db.StopIteration{}
+		}
+		return nil
+	}
+	if b != nil {
+		err = a.DiffIndex(b, lower, higher, *balances, fn)
+	} else {
+		err = a.DiffBackend(chain, lower, higher, fn)
+	}
+	return count, err
+}
@@ -0,0 +1,279 @@
+// Command bbdump opens the blockbook db in read only mode and dumps decoded or raw content of it.
+// It is meant for operators debugging data issues, it can run while blockbook is using the db.
+//
+// Usage:
+//
+//	bbdump -datadir=./data -blockchaincfg=build/blockchaincfg.json <command> [arguments]
+//
+// Commands:
+//
+//	state                       internal state of the db
+//	columns                     names of the column families
+//	schema                      description of the key and value formats of the column families
+//	height <height>             block info stored for the height
+//	tx <txid>                   inputs and outputs of the transaction (txAddresses column)
+//	balance <address>           balance of the address (addressBalance column)
+//	address <address> [from to] transactions of the address in the range of block heights (addresses column)
+//	raw <column> [hex prefix]   raw keys and values of the column starting with the prefix
+package main
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins"
+	"blockbook/common"
+	"blockbook/db"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+var (
+	blockchain   = flag.String("blockchaincfg", "", "path to blockchain RPC service configuration json file, the back-end is used to create the coin parser")
+	dbPath       = flag.String("datadir", "./data", "path to database directory")
+	dbCache      = flag.Int("dbcache", 1<<26, "size of the rocksdb cache")
+	maxOpenFiles = flag.Int("maxopenfiles", 1<<10, "max number of open rocksdb files")
+	limit        = flag.Int("limit", 100, "max number of rows returned by the raw and address commands")
+)
+
+type txInput struct {
+	Addresses []string `json:"addresses"`
+	AddrDesc  string   `json:"addrDesc"`
+	ValueSat  string   `json:"valueSat"`
+}
+
+type txOutput struct {
+	Addresses []string `json:"addresses"`
+	AddrDesc  string   `json:"addrDesc"`
+	ValueSat  string   `json:"valueSat"`
+	Spent     bool     `json:"spent"`
+}
+
+type txAddresses struct {
+	Height  uint32     `json:"height"`
+	Inputs  []txInput  `json:"inputs"`
+	Outputs []txOutput `json:"outputs"`
+}
+
+type balance struct {
+	AddrDesc   string `json:"addrDesc"`
+	Txs        uint32 `json:"txs"`
+	SentSat    string `json:"sentSat"`
+	BalanceSat string `json:"balanceSat"`
+	Nonce      uint64 `json:"nonce,omitempty"`
+}
+
+type addressTx struct {
+	Txid     string `json:"txid"`
+	Index    uint32 `json:"index"`
+	IsOutput bool   `json:"isOutput"`
+}
+
+type rawRow struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func main() {
+	flag.Parse()
+	defer glog.Flush()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Missing command, use one of state, columns, schema, height, tx, balance, address, raw")
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func newParser() (bchain.BlockChainParser, error) {
+	if *blockchain == "" {
+		return nil, errors.New("Missing blockchaincfg configuration parameter")
+	}
+	coin, _, _, err := coins.GetCoinNameFromConfig(*blockchain)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := common.GetMetrics(coin)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := coins.NewBlockChain(coin, *blockchain, func(bchain.NotificationType) {}, metrics)
+	if err != nil {
+		return nil, errors.Annotatef(err, "NewBlockChain")
+	}
+	return chain.GetChainParser(), nil
+}
+
+func run(command string, args []string) error {
+	if command == "columns" {
+		return output(db.ColumnNames())
+	}
+	if command == "schema" {
+		return output(db.GetSchema())
+	}
+	var parser bchain.BlockChainParser
+	// the raw and state commands do not decode the data, they can work without the back-end
+	if command != "raw" && command != "state" {
+		var err error
+		if parser, err = newParser(); err != nil {
+			return err
+		}
+	}
+	d, err := db.NewRocksDBReadOnly(*dbPath, *dbCache, *maxOpenFiles, parser)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	switch command {
+	case "state":
+		is, err := d.ReadInternalState()
+		if err != nil {
+			return err
+		}
+		return output(is)
+	case "height":
+		if len(args) != 1 {
+			return errors.New("Usage: height <height>")
+		}
+		h, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return errors.Annotatef(err, "height")
+		}
+		bi, err := d.GetBlockInfo(uint32(h))
+		if err != nil {
+			return err
+		}
+		if bi != nil {
+			bi.Height = uint32(h)
+		}
+		return output(bi)
+	case "tx":
+		if len(args) != 1 {
+			return errors.New("Usage: tx <txid>")
+		}
+		ta, err := d.GetTxAddresses(args[0])
+		if err != nil || ta == nil {
+			return err
+		}
+		return output(decodeTxAddresses(ta, parser))
+	case "balance":
+		if len(args) != 1 {
+			return errors.New("Usage: balance <address>")
+		}
+		addrDesc, err := parser.GetAddrDescFromAddress(args[0])
+		if err != nil {
+			return err
+		}
+		ab, err := d.GetAddrDescBalance(addrDesc)
+		if err != nil || ab == nil {
+			return err
+		}
+		return output(balance{
+			AddrDesc:   hex.EncodeToString(addrDesc),
+			Txs:        ab.Txs,
+			SentSat:    ab.SentSat.String(),
+			BalanceSat: ab.BalanceSat.String(),
+			Nonce:      ab.Nonce,
+		})
+	case "address":
+		return dumpAddress(d, parser, args)
+	case "raw":
+		return dumpRaw(d, args)
+	}
+	return errors.Errorf("Unknown command '%v'", command)
+}
+
+func decodeTxAddresses(ta *db.TxAddresses, parser bchain.BlockChainParser) *txAddresses {
+	r := &txAddresses{
+		Height:  ta.Height,
+		Inputs:  make([]txInput, len(ta.Inputs)),
+		Outputs: make([]txOutput, len(ta.Outputs)),
+	}
+	for i := range ta.Inputs {
+		ti := &ta.Inputs[i]
+		a, _, err := ti.Addresses(parser)
+		if err != nil {
+			glog.Warning("input ", i, ": ", err)
+		}
+		r.Inputs[i] = txInput{Addresses: a, AddrDesc: hex.EncodeToString(ti.AddrDesc), ValueSat: ti.ValueSat.String()}
+	}
+	for i := range ta.Outputs {
+		to := &ta.Outputs[i]
+		a, _, err := to.Addresses(parser)
+		if err != nil {
+			glog.Warning("output ", i, ": ", err)
+		}
+		r.Outputs[i] = txOutput{Addresses: a, AddrDesc: hex.EncodeToString(to.AddrDesc), ValueSat: to.ValueSat.String(), Spent: to.Spent}
+	}
+	return r
+}
+
+func dumpAddress(d *db.RocksDB, parser bchain.BlockChainParser, args []string) error {
+	if len(args) != 1 && len(args) != 3 {
+		return errors.New("Usage: address <address> [from to]")
+	}
+	addrDesc, err := parser.GetAddrDescFromAddress(args[0])
+	if err != nil {
+		return err
+	}
+	var lower, higher uint64 = 0, math.MaxUint32
+	if len(args) == 3 {
+		if lower, err = strconv.ParseUint(args[1], 10, 32); err != nil {
+			return errors.Annotatef(err, "from")
+		}
+		if higher, err = strconv.ParseUint(args[2], 10, 32); err != nil {
+			return errors.Annotatef(err, "to")
+		}
+	}
+	txs := []addressTx{}
+	err = d.GetAddrDescTransactions(addrDesc, uint32(lower), uint32(higher), func(txid string, vout uint32, isOutput bool) error {
+		if len(txs) >= *limit {
+			return &db.StopIteration{}
+		}
+		txs = append(txs, addressTx{Txid: txid, Index: vout, IsOutput: isOutput})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return output(txs)
+}
+
+func dumpRaw(d *db.RocksDB, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("Usage: raw <column> [hex prefix]")
+	}
+	var prefix []byte
+	if len(args) == 2 {
+		var err error
+		if prefix, err = hex.DecodeString(args[1]); err != nil {
+			return errors.Annotatef(err, "prefix")
+		}
+	}
+	rows := []rawRow{}
+	err := d.DumpColumn(args[0], prefix, func(key, value []byte) bool {
+		rows = append(rows, rawRow{Key: hex.EncodeToString(key), Value: hex.EncodeToString(value)})
+		return len(rows) < *limit
+	})
+	if err != nil {
+		return err
+	}
+	return output(rows)
+}
+
+func output(v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(buf))
+	return nil
+}
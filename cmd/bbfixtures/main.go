@@ -0,0 +1,541 @@
+// Command bbfixtures extracts a small set of representative blocks and transactions of a coin from the back-end
+// and generates the test fixtures of the coin integration. It is meant for the authors of new coins, the fixtures
+// prove that the parser and the synchronization work with the real data of the coin.
+//
+// Usage:
+//
+//	bbfixtures -blockchaincfg=build/blockchaincfg.json -blocks=1414976-1414977 -package=btc \
+//		-parser='NewBitcoinParser(GetChainParams("test"), &Configuration{})' \
+//		-out=bchain/coins/btc/fixtures_test.go -syncdata=tests/sync/testdata/bitcoin_testnet.json
+//
+// From each block, the coinbase and the transactions with a kind of inputs or outputs not seen before are selected.
+// The generated unit test (build tag unittest) checks for each selected transaction the output of PackTx, the
+// transaction unpacked by UnpackTx and the address descriptors and addresses of the outputs, all of them as returned
+// by the parser at the time of the generation. The connectBlocks section of the sync integration test data is written
+// for the block range, the other sections of an existing file are kept, so that the UTXO connect path is checked
+// by the ConnectBlocks and ConnectBlocksParallel integration tests. The output depends only on the blocks and the
+// parameters, the fixtures are regenerated byte-exactly by the same command.
+package main
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins"
+	"blockbook/common"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+var (
+	blockchain  = flag.String("blockchaincfg", "", "path to blockchain RPC service configuration json file, the back-end is the source of the fixtures")
+	blocks      = flag.String("blocks", "", "comma separated list of heights or ranges of heights (lower-upper) of the blocks")
+	maxTxs      = flag.Int("txs", 5, "max number of transactions selected from one block")
+	pkg         = flag.String("package", "", "package of the generated unit test, the package of the coin parser")
+	parserExpr  = flag.String("parser", "", "Go expression creating the parser in the package of the generated unit test")
+	name        = flag.String("name", "", "name of the fixtures used in the identifiers of the generated unit test (default derived from the coin name)")
+	outFile     = flag.String("out", "", "generated unit test file (default stdout)")
+	syncOutFile = flag.String("syncdata", "", "sync integration test data file, the connectBlocks section of which is written (default not written)")
+)
+
+func main() {
+	flag.Parse()
+	defer glog.Flush()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func newBlockChain() (bchain.BlockChain, string, error) {
+	if *blockchain == "" {
+		return nil, "", errors.New("Missing blockchaincfg configuration parameter")
+	}
+	coin, _, _, err := coins.GetCoinNameFromConfig(*blockchain)
+	if err != nil {
+		return nil, "", err
+	}
+	metrics, err := common.GetMetrics(coin)
+	if err != nil {
+		return nil, "", err
+	}
+	chain, err := coins.NewBlockChain(coin, *blockchain, func(bchain.NotificationType) {}, metrics)
+	if err != nil {
+		return nil, "", errors.Annotatef(err, "NewBlockChain")
+	}
+	return chain, coin, nil
+}
+
+// parseHeights parses the list of heights and ranges of heights, the result is sorted and without duplicates
+func parseHeights(s string) ([]uint32, error) {
+	m := make(map[uint32]struct{})
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		r := strings.SplitN(p, "-", 2)
+		lower, err := strconv.ParseUint(r[0], 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("Invalid height %v", p)
+		}
+		upper := lower
+		if len(r) == 2 {
+			if upper, err = strconv.ParseUint(r[1], 10, 32); err != nil || upper < lower {
+				return nil, errors.Errorf("Invalid range of heights %v", p)
+			}
+		}
+		if upper-lower >= 1000 {
+			return nil, errors.Errorf("Range of heights %v is too large, the fixtures should be small", p)
+		}
+		for h := lower; h <= upper; h++ {
+			m[uint32(h)] = struct{}{}
+		}
+	}
+	if len(m) == 0 {
+		return nil, errors.New("Missing blocks parameter")
+	}
+	heights := make([]uint32, 0, len(m))
+	for h := range m {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights, nil
+}
+
+// fixtureName derives the name of the fixtures from the coin name, e.g. "Bitcoin Testnet" -> "bitcoinTestnet"
+func fixtureName(coin string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range coin {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() > 0
+			continue
+		}
+		if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		} else if upper {
+			r = unicode.ToUpper(r)
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// scriptKind classifies the output script by the address descriptor, the descriptors of the standard scripts
+// differ in the first bytes and in the length, the descriptors of the data outputs only in the first byte
+func scriptKind(parser bchain.BlockChainParser, vout *bchain.Vout) string {
+	ad, err := parser.GetAddrDescFromVout(vout)
+	if err != nil {
+		return "error"
+	}
+	if len(ad) == 0 {
+		return "empty"
+	}
+	_, searchable, err := parser.GetAddressesFromAddrDesc(ad)
+	if err != nil || !searchable {
+		return "data-" + hex.EncodeToString(ad[:1])
+	}
+	p := 2
+	if len(ad) < p {
+		p = len(ad)
+	}
+	return hex.EncodeToString(ad[:p]) + "-" + strconv.Itoa(len(ad))
+}
+
+// txClass classifies the transaction by the kinds of its inputs and outputs
+func txClass(parser bchain.BlockChainParser, tx *bchain.Tx) string {
+	kinds := make(map[string]struct{})
+	for i := range tx.Vin {
+		if tx.Vin[i].Coinbase != "" {
+			kinds["coinbase"] = struct{}{}
+		}
+		if len(tx.Vin[i].Witness) > 0 {
+			kinds["witness"] = struct{}{}
+		}
+	}
+	if len(tx.Vin) > 1 {
+		kinds["inputs"] = struct{}{}
+	}
+	for i := range tx.Vout {
+		kinds[scriptKind(parser, &tx.Vout[i])] = struct{}{}
+	}
+	r := make([]string, 0, len(kinds))
+	for k := range kinds {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return strings.Join(r, ",")
+}
+
+type fixtureVout struct {
+	AddrDesc   string
+	Addresses  []string
+	Searchable bool
+}
+
+type fixtureTx struct {
+	Txid      string
+	Class     string
+	Height    uint32
+	BlockTime int64
+	Tx        string
+	Packed    string
+	Unpacked  string
+	Vouts     []fixtureVout
+}
+
+type fixtureBlock struct {
+	Height uint32
+	Hash   string
+	Txs    int
+	TxList []*bchain.Tx
+}
+
+// normalizeTx clears the fields of the transaction which change over time or are not set consistently by the back-end,
+// the output values are kept only in ValueSat
+func normalizeTx(tx *bchain.Tx) {
+	tx.Confirmations = 0
+	for i := range tx.Vout {
+		tx.Vout[i].JsonValue = ""
+	}
+}
+
+// selectTxs returns the coinbase and the transactions of new classes of the block, up to maxTxs, in the order of the block
+func selectTxs(parser bchain.BlockChainParser, block *bchain.Block, classes map[string]struct{}, max int) []*bchain.Tx {
+	var r []*bchain.Tx
+	for i := range block.Txs {
+		if len(r) >= max {
+			break
+		}
+		tx := &block.Txs[i]
+		c := txClass(parser, tx)
+		if _, found := classes[c]; found {
+			continue
+		}
+		classes[c] = struct{}{}
+		r = append(r, tx)
+	}
+	return r
+}
+
+func makeFixtureTx(parser bchain.BlockChainParser, tx *bchain.Tx, class string, height uint32, blockTime int64) (*fixtureTx, error) {
+	normalizeTx(tx)
+	f := &fixtureTx{Txid: tx.Txid, Class: class, Height: height, BlockTime: blockTime}
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	f.Tx = string(b)
+	packed, err := parser.PackTx(tx, height, blockTime)
+	if err != nil {
+		return nil, errors.Annotatef(err, "PackTx %v", tx.Txid)
+	}
+	f.Packed = hex.EncodeToString(packed)
+	unpacked, _, err := parser.UnpackTx(packed)
+	if err != nil {
+		return nil, errors.Annotatef(err, "UnpackTx %v", tx.Txid)
+	}
+	if b, err = json.Marshal(unpacked); err != nil {
+		return nil, err
+	}
+	f.Unpacked = string(b)
+	for i := range tx.Vout {
+		var v fixtureVout
+		ad, err := parser.GetAddrDescFromVout(&tx.Vout[i])
+		if err == nil {
+			v.AddrDesc = hex.EncodeToString(ad)
+			v.Addresses, v.Searchable, _ = parser.GetAddressesFromAddrDesc(ad)
+		}
+		f.Vouts = append(f.Vouts, v)
+	}
+	return f, nil
+}
+
+func run() error {
+	if *pkg == "" || *parserExpr == "" {
+		return errors.New("Missing package or parser parameter")
+	}
+	heights, err := parseHeights(*blocks)
+	if err != nil {
+		return err
+	}
+	chain, coin, err := newBlockChain()
+	if err != nil {
+		return err
+	}
+	parser := chain.GetChainParser()
+	if *name == "" {
+		*name = fixtureName(coin)
+	}
+	var txs []*fixtureTx
+	var fblocks []fixtureBlock
+	classes := make(map[string]struct{})
+	for _, height := range heights {
+		hash, err := chain.GetBlockHash(height)
+		if err != nil {
+			return errors.Annotatef(err, "GetBlockHash %v", height)
+		}
+		block, err := chain.GetBlock(hash, height)
+		if err != nil {
+			return errors.Annotatef(err, "GetBlock %v", hash)
+		}
+		fb := fixtureBlock{Height: height, Hash: hash, Txs: len(block.Txs)}
+		for _, btx := range selectTxs(parser, block, classes, *maxTxs) {
+			class := txClass(parser, btx)
+			// the transactions of the block may miss the fields returned only by the transaction rpc, e.g. the hex
+			tx, err := chain.GetTransaction(btx.Txid)
+			if err != nil {
+				return errors.Annotatef(err, "GetTransaction %v", btx.Txid)
+			}
+			blockTime := tx.Blocktime
+			if blockTime == 0 {
+				blockTime = block.Time
+			}
+			fb.TxList = append(fb.TxList, tx)
+			f, err := makeFixtureTx(parser, tx, class, height, blockTime)
+			if err != nil {
+				return err
+			}
+			txs = append(txs, f)
+		}
+		fblocks = append(fblocks, fb)
+		glog.Info("block ", height, ": ", len(fb.TxList), " of ", fb.Txs, " transactions selected")
+	}
+	if err = writeUnitTest(txs); err != nil {
+		return err
+	}
+	if *syncOutFile != "" {
+		return writeSyncData(parser, heights, fblocks)
+	}
+	return nil
+}
+
+var unitTestTemplate = template.Must(template.New("fixtures").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"title": func(s string) string { return strings.ToUpper(s[:1]) + s[1:] },
+}).Parse(`// Code generated by bbfixtures -blocks={{.Blocks}}; DO NOT EDIT.
+
+// +build unittest
+
+package {{.Package}}
+
+import (
+	"blockbook/bchain"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// {{.Name}}Fixtures are the representative transactions of the blocks {{.Blocks}} and the results of the parser
+var {{.Name}}Fixtures = []struct {
+	txid      string
+	class     string
+	height    uint32
+	blockTime int64
+	tx        string
+	packed    string
+	unpacked  string
+	vouts     []struct {
+		addrDesc   string
+		addresses  []string
+		searchable bool
+	}
+}{
+{{- range .Txs}}
+	{
+		txid:      {{quote .Txid}},
+		class:     {{quote .Class}},
+		height:    {{.Height}},
+		blockTime: {{.BlockTime}},
+		tx:        {{quote .Tx}},
+		packed:    {{quote .Packed}},
+		unpacked:  {{quote .Unpacked}},
+		vouts: []struct {
+			addrDesc   string
+			addresses  []string
+			searchable bool
+		}{
+		{{- range .Vouts}}
+			{addrDesc: {{quote .AddrDesc}}, addresses: {{if .Addresses}}[]string{ {{- range $i, $a := .Addresses}}{{if $i}}, {{end}}{{quote $a}}{{end -}} }{{else}}nil{{end}}, searchable: {{.Searchable}}},
+		{{- end}}
+		},
+	},
+{{- end}}
+}
+
+func Test{{title .Name}}Fixtures(t *testing.T) {
+	parser := {{.Parser}}
+	for _, f := range {{.Name}}Fixtures {
+		t.Run(f.txid, func(t *testing.T) {
+			var tx bchain.Tx
+			if err := json.Unmarshal([]byte(f.tx), &tx); err != nil {
+				t.Fatal(err)
+			}
+			packed, err := parser.PackTx(&tx, f.height, f.blockTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := hex.EncodeToString(packed); h != f.packed {
+				t.Errorf("PackTx() = %v, want %v", h, f.packed)
+			}
+			unpacked, height, err := parser.UnpackTx(packed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if height != f.height {
+				t.Errorf("UnpackTx() height = %v, want %v", height, f.height)
+			}
+			b, err := json.Marshal(unpacked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != f.unpacked {
+				t.Errorf("UnpackTx() = %s, want %s", b, f.unpacked)
+			}
+			if len(tx.Vout) != len(f.vouts) {
+				t.Fatalf("%d outputs, want %d", len(tx.Vout), len(f.vouts))
+			}
+			for i, v := range f.vouts {
+				ad, err := parser.GetAddrDescFromVout(&tx.Vout[i])
+				if err != nil {
+					if v.addrDesc != "" {
+						t.Errorf("vout %d: GetAddrDescFromVout() error %v", i, err)
+					}
+					continue
+				}
+				if h := hex.EncodeToString(ad); h != v.addrDesc {
+					t.Errorf("vout %d: GetAddrDescFromVout() = %v, want %v", i, h, v.addrDesc)
+					continue
+				}
+				addresses, searchable, err := parser.GetAddressesFromAddrDesc(ad)
+				if err != nil {
+					addresses = nil
+				}
+				if !reflect.DeepEqual(addresses, v.addresses) || searchable != v.searchable {
+					t.Errorf("vout %d: GetAddressesFromAddrDesc() = %v, %v, want %v, %v", i, addresses, searchable, v.addresses, v.searchable)
+				}
+			}
+		})
+	}
+}
+`))
+
+func writeUnitTest(txs []*fixtureTx) error {
+	var buf bytes.Buffer
+	err := unitTestTemplate.Execute(&buf, struct {
+		Blocks  string
+		Package string
+		Name    string
+		Parser  string
+		Txs     []*fixtureTx
+	}{
+		Blocks:  *blocks,
+		Package: *pkg,
+		Name:    *name,
+		Parser:  *parserExpr,
+		Txs:     txs,
+	})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.Annotatef(err, "generated unit test")
+	}
+	if *outFile == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*outFile, src, 0644)
+}
+
+// syncVout and syncTx are the transactions in the format of the sync integration test data, the values are decimal amounts
+type syncVout struct {
+	Value        json.Number         `json:"value"`
+	N            uint32              `json:"n"`
+	ScriptPubKey bchain.ScriptPubKey `json:"scriptPubKey"`
+}
+
+type syncTx struct {
+	Hex       string       `json:"hex"`
+	Txid      string       `json:"txid"`
+	Time      int64        `json:"time,omitempty"`
+	Blocktime int64        `json:"blocktime,omitempty"`
+	Version   int32        `json:"version"`
+	LockTime  uint32       `json:"locktime"`
+	Vin       []bchain.Vin `json:"vin"`
+	Vout      []syncVout   `json:"vout"`
+}
+
+type syncBlock struct {
+	Height    uint32   `json:"height"`
+	Hash      string   `json:"hash"`
+	NoTxs     int      `json:"noTxs"`
+	TxDetails []syncTx `json:"txDetails"`
+}
+
+type syncRange struct {
+	Lower uint32 `json:"lower"`
+	Upper uint32 `json:"upper"`
+}
+
+// writeSyncData writes the connectBlocks section of the sync integration test data, the other sections of the file are kept
+func writeSyncData(parser bchain.BlockChainParser, heights []uint32, fblocks []fixtureBlock) error {
+	var connect struct {
+		SyncRanges []syncRange           `json:"syncRanges"`
+		Blocks     map[string]*syncBlock `json:"blocks"`
+	}
+	connect.Blocks = make(map[string]*syncBlock)
+	for _, h := range heights {
+		if n := len(connect.SyncRanges); n > 0 && connect.SyncRanges[n-1].Upper+1 == h {
+			connect.SyncRanges[n-1].Upper = h
+		} else {
+			connect.SyncRanges = append(connect.SyncRanges, syncRange{Lower: h, Upper: h})
+		}
+	}
+	for _, fb := range fblocks {
+		sb := &syncBlock{Height: fb.Height, Hash: fb.Hash, NoTxs: fb.Txs, TxDetails: []syncTx{}}
+		for _, tx := range fb.TxList {
+			st := syncTx{Hex: tx.Hex, Txid: tx.Txid, Time: tx.Time, Blocktime: tx.Blocktime, Version: tx.Version, LockTime: tx.LockTime, Vin: tx.Vin}
+			for i := range tx.Vout {
+				v := &tx.Vout[i]
+				st.Vout = append(st.Vout, syncVout{Value: json.Number(parser.AmountToDecimalString(&v.ValueSat)), N: v.N, ScriptPubKey: v.ScriptPubKey})
+			}
+			sb.TxDetails = append(sb.TxDetails, st)
+		}
+		connect.Blocks[strconv.FormatUint(uint64(fb.Height), 10)] = sb
+	}
+	data := make(map[string]json.RawMessage)
+	if b, err := ioutil.ReadFile(*syncOutFile); err == nil {
+		if err = json.Unmarshal(b, &data); err != nil {
+			return errors.Annotatef(err, "%v", *syncOutFile)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	b, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	data["connectBlocks"] = b
+	// the keys of the maps are sorted by json.Marshal
+	if b, err = json.MarshalIndent(data, "", "    "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*syncOutFile, append(b, '\n'), 0644)
+}
@@ -0,0 +1,251 @@
+// +build unittest
+
+package main
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins/btc"
+	"encoding/hex"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	// testnet p2pkh mfcWp7DB6NuaZsExybTTXpVgWz559Np4Ti and p2sh 2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1
+	testP2PKH = "76a914010d39800f86122416e28f485029acf77507169288ac"
+	testP2SH  = "a914e921fc4912a315078f370d959f2c4f7b6d2a683c87"
+	testData  = "6a0461626364"
+)
+
+// testParser packs the transactions without hex, which the test transactions do not have
+type testParser struct {
+	*btc.BitcoinParser
+}
+
+func (p *testParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) ([]byte, error) {
+	return p.BaseParser.PackTx(tx, height, blockTime)
+}
+
+func (p *testParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
+	return p.BaseParser.UnpackTx(buf)
+}
+
+func newTestParser() *testParser {
+	return &testParser{BitcoinParser: btc.NewBitcoinParser(btc.GetChainParams("test"), &btc.Configuration{})}
+}
+
+func testTx(txid string, vin []bchain.Vin, scripts ...string) bchain.Tx {
+	tx := bchain.Tx{Txid: txid, Vin: vin, Confirmations: 10}
+	for i, s := range scripts {
+		tx.Vout = append(tx.Vout, bchain.Vout{N: uint32(i), ValueSat: *big.NewInt(int64(1000 * (i + 1))), JsonValue: "0.00001", ScriptPubKey: bchain.ScriptPubKey{Hex: s}})
+	}
+	return tx
+}
+
+func Test_parseHeights(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []uint32
+		wantErr string
+	}{
+		{s: "100", want: []uint32{100}},
+		{s: "102-104, 100,103 ,", want: []uint32{100, 102, 103, 104}},
+		{s: "5-5", want: []uint32{5}},
+		{s: "", wantErr: "Missing blocks"},
+		{s: " , ", wantErr: "Missing blocks"},
+		{s: "abc", wantErr: "Invalid height"},
+		{s: "-5", wantErr: "Invalid height"},
+		{s: "10-5", wantErr: "Invalid range"},
+		{s: "10-x", wantErr: "Invalid range"},
+		{s: "0-1000", wantErr: "too large"},
+		{s: "4294967296", wantErr: "Invalid height"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseHeights(tt.s)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseHeights() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHeights() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// the largest range
+	if got, err := parseHeights("0-999"); err != nil || len(got) != 1000 || got[0] != 0 || got[999] != 999 {
+		t.Errorf("parseHeights(0-999) = %d heights, %v", len(got), err)
+	}
+}
+
+func Test_fixtureName(t *testing.T) {
+	for coin, want := range map[string]string{
+		"Bitcoin":          "bitcoin",
+		"Bitcoin Testnet":  "bitcoinTestnet",
+		"Bitcoin Cash SV":  "bitcoinCashSV",
+		"Ethereum Classic": "ethereumClassic",
+		"Zcash-Testnet 2":  "zcashTestnet2",
+		" DigiByte":        "digiByte",
+	} {
+		if got := fixtureName(coin); got != want {
+			t.Errorf("fixtureName(%q) = %q, want %q", coin, got, want)
+		}
+	}
+}
+
+func Test_txClass(t *testing.T) {
+	p := newTestParser()
+	coinbase := []bchain.Vin{{Coinbase: "03a0bb0d"}}
+	in := []bchain.Vin{{Txid: "aa", Vout: 0}}
+	ins := []bchain.Vin{{Txid: "aa", Vout: 0}, {Txid: "bb", Vout: 1, Witness: []string{"3044", "02"}}}
+	tests := []struct {
+		name string
+		tx   bchain.Tx
+		want string
+	}{
+		{name: "coinbase", tx: testTx("1", coinbase, testP2PKH, testData), want: "76a9-25,coinbase,data-6a"},
+		{name: "p2pkh", tx: testTx("2", in, testP2PKH, testP2PKH), want: "76a9-25"},
+		{name: "p2sh", tx: testTx("3", in, testP2SH), want: "a914-23"},
+		{name: "inputs and witness", tx: testTx("4", ins, testP2SH, testP2PKH), want: "76a9-25,a914-23,inputs,witness"},
+		{name: "empty", tx: testTx("5", in, ""), want: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := txClass(p, &tt.tx); got != tt.want {
+				t.Errorf("txClass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectTxs(t *testing.T) {
+	p := newTestParser()
+	in := []bchain.Vin{{Txid: "aa", Vout: 0}}
+	block := &bchain.Block{Txs: []bchain.Tx{
+		testTx("cb", []bchain.Vin{{Coinbase: "03"}}, testP2PKH),
+		testTx("t1", in, testP2PKH),
+		testTx("t2", in, testP2PKH),
+		testTx("t3", in, testP2SH),
+		testTx("t4", in, testP2SH, testData),
+	}}
+	ids := func(txs []*bchain.Tx) []string {
+		var r []string
+		for _, tx := range txs {
+			r = append(r, tx.Txid)
+		}
+		return r
+	}
+	classes := make(map[string]struct{})
+	if got := ids(selectTxs(p, block, classes, 3)); !reflect.DeepEqual(got, []string{"cb", "t1", "t3"}) {
+		t.Errorf("selectTxs() = %v, want [cb t1 t3]", got)
+	}
+	// the classes seen in the previous blocks are not selected again
+	if got := ids(selectTxs(p, block, classes, 3)); !reflect.DeepEqual(got, []string{"t4"}) {
+		t.Errorf("selectTxs() of the next block = %v, want [t4]", got)
+	}
+}
+
+func Test_makeFixtureTx(t *testing.T) {
+	p := newTestParser()
+	tx := testTx("c0ffee", []bchain.Vin{{Txid: "aa", Vout: 0}}, testP2PKH, testData)
+	f, err := makeFixtureTx(p, &tx, "class", 100, 1500000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fields changing over time are not in the fixture
+	if tx.Confirmations != 0 || tx.Vout[0].JsonValue != "" || strings.Contains(f.Tx, "confirmations") {
+		t.Errorf("normalized tx %+v, fixture %v", tx, f.Tx)
+	}
+	packed, err := p.PackTx(&tx, 100, 1500000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fixtureVout{
+		{AddrDesc: testP2PKH, Addresses: []string{"mfcWp7DB6NuaZsExybTTXpVgWz559Np4Ti"}, Searchable: true},
+		{AddrDesc: testData, Addresses: []string{"OP_RETURN (abcd)"}},
+	}
+	if f.Txid != "c0ffee" || f.Class != "class" || f.Height != 100 || f.BlockTime != 1500000000 || f.Packed != hex.EncodeToString(packed) || !reflect.DeepEqual(f.Vouts, want) {
+		t.Errorf("makeFixtureTx() = %+v, vouts want %+v", f, want)
+	}
+	if f.Unpacked == "" || !strings.Contains(f.Unpacked, `"txid":"c0ffee"`) {
+		t.Errorf("makeFixtureTx() unpacked %v", f.Unpacked)
+	}
+}
+
+func Test_writeUnitTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bbfixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	*blocks, *pkg, *name, *parserExpr = "100-101", "btc", "bitcoinTestnet", `NewBitcoinParser(GetChainParams("test"), &Configuration{})`
+	defer func() { *blocks, *pkg, *name, *parserExpr, *outFile = "", "", "", "", "" }()
+	txs := []*fixtureTx{
+		{Txid: "c0ffee", Class: "76a9-25,coinbase", Height: 100, BlockTime: 1500000000, Tx: `{"txid":"c0ffee"}`, Packed: "0a0b", Unpacked: `{"txid":"c0ffee"}`,
+			Vouts: []fixtureVout{{AddrDesc: testP2PKH, Addresses: []string{"a1", "a2"}, Searchable: true}, {AddrDesc: testData}}},
+		{Txid: "beef", Class: "empty", Height: 101, BlockTime: 1500000600, Tx: "{\"txid\":\"beef\",\"hex\":\"\\\"\"}", Packed: "0c", Unpacked: `{"txid":"beef"}`},
+	}
+	generate := func(file string) []byte {
+		*outFile = filepath.Join(dir, file)
+		if err := writeUnitTest(txs); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(*outFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	src := generate("fixtures_test.go")
+	// the fixtures are regenerated byte-exactly
+	if again := generate("again_test.go"); string(again) != string(src) {
+		t.Error("writeUnitTest() output differs for the same input")
+	}
+	if !strings.HasPrefix(string(src), "// Code generated by bbfixtures -blocks=100-101; DO NOT EDIT.\n\n// +build unittest\n\npackage btc\n") {
+		t.Errorf("writeUnitTest() header:\n%s", src[:200])
+	}
+	for _, s := range []string{
+		`parser := NewBitcoinParser(GetChainParams("test"), &Configuration{})`,
+		`addresses: []string{"a1", "a2"}, searchable: true}`,
+		`{addrDesc: "6a0461626364", addresses: nil, searchable: false}`,
+		`tx:        "{\"txid\":\"beef\",\"hex\":\"\\\"\"}",`,
+	} {
+		if !strings.Contains(string(src), s) {
+			t.Errorf("writeUnitTest() output does not contain %s", s)
+		}
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "fixtures_test.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var funcs []string
+	var fixtures int
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			funcs = append(funcs, d.Name.Name)
+		case *ast.GenDecl:
+			for _, s := range d.Specs {
+				if v, ok := s.(*ast.ValueSpec); ok && v.Names[0].Name == "bitcoinTestnetFixtures" {
+					fixtures = len(v.Values[0].(*ast.CompositeLit).Elts)
+				}
+			}
+		}
+	}
+	if !reflect.DeepEqual(funcs, []string{"TestBitcoinTestnetFixtures"}) || fixtures != 2 {
+		t.Errorf("generated functions %v, fixtures %d, want [TestBitcoinTestnetFixtures], 2", funcs, fixtures)
+	}
+}
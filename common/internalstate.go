@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/juju/errors"
 )
 
 const (
@@ -15,6 +17,35 @@ const (
 	DbStateInconsistent
 )
 
+// SyncPhase is the phase of the synchronization of the index
+type SyncPhase string
+
+const (
+	// SyncPhaseIdle means the index is not synchronized (application is not run with flag --sync)
+	SyncPhaseIdle = SyncPhase("idle")
+	// SyncPhaseHeaders means the index is compared with the chain of the backend to find the blocks to connect or disconnect
+	SyncPhaseHeaders = SyncPhase("headers")
+	// SyncPhaseBodies means a large range of blocks is downloaded and connected in bulk
+	SyncPhaseBodies = SyncPhase("bodies")
+	// SyncPhaseCatchUp means the blocks are connected one by one up to the best block of the backend
+	SyncPhaseCatchUp = SyncPhase("catchUp")
+	// SyncPhaseSteady means the index is synchronized with the backend and follows the new blocks
+	SyncPhaseSteady = SyncPhase("steady")
+	// SyncPhaseRollback means the forked blocks are disconnected from the index
+	SyncPhaseRollback = SyncPhase("rollback")
+)
+
+// syncPhaseTransitions are the allowed transitions between the phases, each synchronization starts
+// by the comparison of headers, which is allowed from any phase (a failed synchronization is retried)
+var syncPhaseTransitions = map[SyncPhase][]SyncPhase{
+	SyncPhaseIdle:     {SyncPhaseHeaders},
+	SyncPhaseHeaders:  {SyncPhaseBodies, SyncPhaseCatchUp, SyncPhaseSteady, SyncPhaseRollback},
+	SyncPhaseBodies:   {SyncPhaseHeaders},
+	SyncPhaseCatchUp:  {SyncPhaseSteady, SyncPhaseHeaders},
+	SyncPhaseSteady:   {SyncPhaseHeaders},
+	SyncPhaseRollback: {SyncPhaseHeaders},
+}
+
 // InternalStateColumn contains the data of a db column
 type InternalStateColumn struct {
 	Name       string    `json:"name"`
@@ -23,6 +54,26 @@ type InternalStateColumn struct {
 	KeyBytes   int64     `json:"keyBytes"`
 	ValueBytes int64     `json:"valueBytes"`
 	Updated    time.Time `json:"updated"`
+	// FromHeight is the first block indexed in a column added to an existing db, 0 if the column contains all blocks
+	FromHeight uint32 `json:"fromHeight,omitempty"`
+}
+
+// MaxConnectBlockStats is the number of the windows of the connect block stats kept in the internal state
+const MaxConnectBlockStats = 200
+
+// ConnectBlockStats contains the hits and misses of the txAddresses and balances lookups
+// and the duration of the connect of a window of blocks
+type ConnectBlockStats struct {
+	FromHeight          uint32    `json:"fromHeight"`
+	ToHeight            uint32    `json:"toHeight"`
+	Blocks              int       `json:"blocks"`
+	Finished            time.Time `json:"finished"`
+	DurationMs          int64     `json:"durationMs"`
+	TxAddressesHit      int       `json:"txAddressesHit"`
+	TxAddressesCacheHit int       `json:"txAddressesCacheHit"`
+	TxAddressesMiss     int       `json:"txAddressesMiss"`
+	BalancesHit         int       `json:"balancesHit"`
+	BalancesMiss        int       `json:"balancesMiss"`
 }
 
 // InternalState contains the data of the internal state
@@ -38,35 +89,119 @@ type InternalState struct {
 
 	LastStore time.Time `json:"lastStore"`
 
-	// true if application is with flag --sync
-	SyncMode bool `json:"syncMode"`
+	// SyncPhase is the current phase of the synchronization, it is idle if application is not run with flag --sync
+	SyncPhase      SyncPhase `json:"syncPhase"`
+	SyncPhaseSince time.Time `json:"syncPhaseSince"`
+	// InterruptedSyncPhase is the phase in which the synchronization of the previous run was interrupted
+	InterruptedSyncPhase SyncPhase `json:"interruptedSyncPhase,omitempty"`
+	// VerifiedHeight and VerifiedHash identify the last block connected to the index as a part of the chain of the backend
+	VerifiedHeight uint32 `json:"verifiedHeight"`
+	VerifiedHash   string `json:"verifiedHash"`
 
-	InitialSync    bool      `json:"initialSync"`
-	IsSynchronized bool      `json:"isSynchronized"`
-	BestHeight     uint32    `json:"bestHeight"`
-	LastSync       time.Time `json:"lastSync"`
+	InitialSync bool      `json:"initialSync"`
+	BestHeight  uint32    `json:"bestHeight"`
+	LastSync    time.Time `json:"lastSync"`
 
 	IsMempoolSynchronized bool      `json:"isMempoolSynchronized"`
 	MempoolSize           int       `json:"mempoolSize"`
 	LastMempoolSync       time.Time `json:"lastMempoolSync"`
 
 	DbColumns []InternalStateColumn `json:"dbColumns"`
+
+	// IndexFilter are the rules of the outputs not indexed by their address, the db must be always used with the same filter
+	IndexFilter string `json:"indexFilter,omitempty"`
+
+	// compactions of the ranges of keys deleted by the disconnect of blocks or by pruning
+	PendingCompactions int       `json:"pendingCompactions"`
+	LastCompaction     time.Time `json:"lastCompaction"`
+
+	// ConnectBlockStats are the stats of the last windows of the connected blocks, the oldest first
+	ConnectBlockStats []ConnectBlockStats `json:"connectBlockStats,omitempty"`
 }
 
-// StartedSync signals start of synchronization
-func (is *InternalState) StartedSync() {
+// SetDbState sets the state of the db, the state is stored with the internal state
+func (is *InternalState) SetDbState(state uint32) {
 	is.mux.Lock()
 	defer is.mux.Unlock()
-	is.IsSynchronized = false
+	is.DbState = state
+}
+
+// GetDbState returns the state of the db
+func (is *InternalState) GetDbState() uint32 {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	return is.DbState
+}
+
+// SetSyncPhase moves the synchronization to the phase, returns error if the transition from the current phase is not allowed
+func (is *InternalState) SetSyncPhase(phase SyncPhase) error {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	return is.setSyncPhase(phase)
+}
+
+func (is *InternalState) setSyncPhase(phase SyncPhase) error {
+	if is.SyncPhase == phase {
+		return nil
+	}
+	current := is.SyncPhase
+	if current == "" {
+		current = SyncPhaseIdle
+	}
+	for _, p := range syncPhaseTransitions[current] {
+		if p == phase {
+			is.SyncPhase = phase
+			is.SyncPhaseSince = time.Now()
+			return nil
+		}
+	}
+	if phase == SyncPhaseHeaders {
+		is.SyncPhase = phase
+		is.SyncPhaseSince = time.Now()
+		return nil
+	}
+	return errors.Errorf("Invalid transition of sync phase from %v to %v", current, phase)
+}
+
+// GetSyncPhase returns the current phase of the synchronization, the time when it started and the last verified block
+func (is *InternalState) GetSyncPhase() (SyncPhase, time.Time, uint32, string) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	phase := is.SyncPhase
+	if phase == "" {
+		phase = SyncPhaseIdle
+	}
+	return phase, is.SyncPhaseSince, is.VerifiedHeight, is.VerifiedHash
+}
+
+// SetVerifiedBlock records the last block connected to the index as a part of the chain of the backend
+func (is *InternalState) SetVerifiedBlock(height uint32, hash string) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.VerifiedHeight = height
+	is.VerifiedHash = hash
+}
+
+// ResetSyncPhase sets the idle phase after the internal state was loaded, the phase of the synchronization
+// interrupted by the end of the previous run is kept as InterruptedSyncPhase
+func (is *InternalState) ResetSyncPhase() {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.InterruptedSyncPhase = ""
+	if is.SyncPhase != "" && is.SyncPhase != SyncPhaseIdle && is.SyncPhase != SyncPhaseSteady {
+		is.InterruptedSyncPhase = is.SyncPhase
+	}
+	is.SyncPhase = SyncPhaseIdle
+	is.SyncPhaseSince = time.Now()
 }
 
 // FinishedSync marks end of synchronization, bestHeight specifies new best block height
-func (is *InternalState) FinishedSync(bestHeight uint32) {
+func (is *InternalState) FinishedSync(bestHeight uint32) error {
 	is.mux.Lock()
 	defer is.mux.Unlock()
-	is.IsSynchronized = true
 	is.BestHeight = bestHeight
 	is.LastSync = time.Now()
+	return is.setSyncPhase(SyncPhaseSteady)
 }
 
 // UpdateBestHeight sets new best height, without changing IsSynchronized flag
@@ -78,17 +213,17 @@ func (is *InternalState) UpdateBestHeight(bestHeight uint32) {
 }
 
 // FinishedSyncNoChange marks end of synchronization in case no index update was necessary, it does not update lastSync time
-func (is *InternalState) FinishedSyncNoChange() {
+func (is *InternalState) FinishedSyncNoChange() error {
 	is.mux.Lock()
 	defer is.mux.Unlock()
-	is.IsSynchronized = true
+	return is.setSyncPhase(SyncPhaseSteady)
 }
 
-// GetSyncState gets the state of synchronization
+// GetSyncState gets the state of synchronization, the index is synchronized in the steady phase
 func (is *InternalState) GetSyncState() (bool, uint32, time.Time) {
 	is.mux.Lock()
 	defer is.mux.Unlock()
-	return is.IsSynchronized, is.BestHeight, is.LastSync
+	return is.SyncPhase == SyncPhaseSteady, is.BestHeight, is.LastSync
 }
 
 // StartedMempoolSync signals start of mempool synchronization
@@ -114,6 +249,50 @@ func (is *InternalState) GetMempoolSyncState() (bool, time.Time, int) {
 	return is.IsMempoolSynchronized, is.LastMempoolSync, is.MempoolSize
 }
 
+// ScheduledCompactions adds the number of the ranges scheduled for compaction
+func (is *InternalState) ScheduledCompactions(ranges int) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.PendingCompactions += ranges
+}
+
+// FinishedCompaction marks the end of the compaction of one range
+func (is *InternalState) FinishedCompaction() {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	if is.PendingCompactions > 0 {
+		is.PendingCompactions--
+	}
+	is.LastCompaction = time.Now()
+}
+
+// GetCompactionState gets the number of the ranges waiting for compaction and the time of the last finished compaction
+func (is *InternalState) GetCompactionState() (int, time.Time) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	return is.PendingCompactions, is.LastCompaction
+}
+
+// AddConnectBlockStats appends the stats of a finished window of the connected blocks,
+// only the last MaxConnectBlockStats windows are kept
+func (is *InternalState) AddConnectBlockStats(cbs ConnectBlockStats) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.ConnectBlockStats = append(is.ConnectBlockStats, cbs)
+	if l := len(is.ConnectBlockStats); l > MaxConnectBlockStats {
+		is.ConnectBlockStats = append([]ConnectBlockStats(nil), is.ConnectBlockStats[l-MaxConnectBlockStats:]...)
+	}
+}
+
+// GetConnectBlockStats returns the stats of the last windows of the connected blocks, the oldest first
+func (is *InternalState) GetConnectBlockStats() []ConnectBlockStats {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	rv := make([]ConnectBlockStats, len(is.ConnectBlockStats))
+	copy(rv, is.ConnectBlockStats)
+	return rv
+}
+
 // AddDBColumnStats adds differences in column statistics to column stats
 func (is *InternalState) AddDBColumnStats(c int, rowsDiff int64, keyBytesDiff int64, valueBytesDiff int64) {
 	is.mux.Lock()
@@ -155,6 +334,19 @@ func (is *InternalState) GetAllDBColumnStats() []InternalStateColumn {
 	return rv
 }
 
+// GetDBColumnFromHeight returns the first block indexed in the column with given name,
+// it is nonzero for the columns added to an existing db, which do not contain the data of the older blocks
+func (is *InternalState) GetDBColumnFromHeight(name string) uint32 {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	for i := range is.DbColumns {
+		if is.DbColumns[i].Name == name {
+			return is.DbColumns[i].FromHeight
+		}
+	}
+	return 0
+}
+
 // DBSizeTotal sums the computed sizes of all columns
 func (is *InternalState) DBSizeTotal() int64 {
 	is.mux.Lock()
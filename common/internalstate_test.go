@@ -0,0 +1,127 @@
+// +build unittest
+
+package common
+
+import (
+	"testing"
+)
+
+func TestInternalState_SetSyncPhase(t *testing.T) {
+	all := []SyncPhase{SyncPhaseIdle, SyncPhaseHeaders, SyncPhaseBodies, SyncPhaseCatchUp, SyncPhaseSteady, SyncPhaseRollback}
+	allowed := map[SyncPhase]map[SyncPhase]bool{
+		SyncPhaseIdle:     {SyncPhaseHeaders: true},
+		SyncPhaseHeaders:  {SyncPhaseBodies: true, SyncPhaseCatchUp: true, SyncPhaseSteady: true, SyncPhaseRollback: true},
+		SyncPhaseBodies:   {SyncPhaseHeaders: true},
+		SyncPhaseCatchUp:  {SyncPhaseSteady: true, SyncPhaseHeaders: true},
+		SyncPhaseSteady:   {SyncPhaseHeaders: true},
+		SyncPhaseRollback: {SyncPhaseHeaders: true},
+	}
+	for _, from := range all {
+		for _, to := range all {
+			is := &InternalState{SyncPhase: from}
+			err := is.SetSyncPhase(to)
+			// the transition to the same phase is a no-op
+			want := from == to || allowed[from][to]
+			if (err == nil) != want {
+				t.Errorf("SetSyncPhase(%v -> %v) error = %v, want allowed %v", from, to, err, want)
+				continue
+			}
+			phase, since, _, _ := is.GetSyncPhase()
+			if want && phase != to {
+				t.Errorf("SetSyncPhase(%v -> %v) phase = %v", from, to, phase)
+			}
+			if !want && phase != from {
+				t.Errorf("SetSyncPhase(%v -> %v) refused transition changed the phase to %v", from, to, phase)
+			}
+			if from != to && want && since.IsZero() {
+				t.Errorf("SetSyncPhase(%v -> %v) did not set the start of the phase", from, to)
+			}
+		}
+	}
+}
+
+func TestInternalState_SyncPhaseCycle(t *testing.T) {
+	is := &InternalState{}
+	// the state of a new db has no phase, it is reported as idle
+	if phase, _, _, _ := is.GetSyncPhase(); phase != SyncPhaseIdle {
+		t.Fatalf("GetSyncPhase() = %v, want %v", phase, SyncPhaseIdle)
+	}
+	if err := is.SetSyncPhase(SyncPhaseCatchUp); err == nil {
+		t.Error("SetSyncPhase(catchUp) from idle expected error")
+	}
+	// the initial sync, bulk connect, catch up and the steady state
+	for _, p := range []SyncPhase{SyncPhaseHeaders, SyncPhaseBodies, SyncPhaseHeaders, SyncPhaseCatchUp} {
+		if err := is.SetSyncPhase(p); err != nil {
+			t.Fatal(err)
+		}
+		if synced, _, _ := is.GetSyncState(); synced {
+			t.Errorf("GetSyncState() in phase %v = synchronized", p)
+		}
+	}
+	if err := is.FinishedSync(100); err != nil {
+		t.Fatal(err)
+	}
+	synced, best, lastSync := is.GetSyncState()
+	if !synced || best != 100 || lastSync.IsZero() {
+		t.Errorf("GetSyncState() after FinishedSync = %v, %v, %v", synced, best, lastSync)
+	}
+	// a fork is handled by the rollback followed by the next synchronization
+	for _, p := range []SyncPhase{SyncPhaseHeaders, SyncPhaseRollback, SyncPhaseHeaders} {
+		if err := is.SetSyncPhase(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := is.FinishedSyncNoChange(); err != nil {
+		t.Fatal(err)
+	}
+	if synced, best, _ := is.GetSyncState(); !synced || best != 100 {
+		t.Errorf("GetSyncState() after FinishedSyncNoChange = %v, %v", synced, best)
+	}
+	// the synchronization cannot be finished in the middle of the bulk connect
+	if err := is.SetSyncPhase(SyncPhaseHeaders); err != nil {
+		t.Fatal(err)
+	}
+	if err := is.SetSyncPhase(SyncPhaseBodies); err != nil {
+		t.Fatal(err)
+	}
+	if err := is.FinishedSync(200); err == nil {
+		t.Error("FinishedSync() in phase bodies expected error")
+	}
+}
+
+func TestInternalState_ResetSyncPhase(t *testing.T) {
+	tests := []struct {
+		phase       SyncPhase
+		interrupted SyncPhase
+	}{
+		{"", ""},
+		{SyncPhaseIdle, ""},
+		{SyncPhaseSteady, ""},
+		{SyncPhaseHeaders, SyncPhaseHeaders},
+		{SyncPhaseBodies, SyncPhaseBodies},
+		{SyncPhaseCatchUp, SyncPhaseCatchUp},
+		{SyncPhaseRollback, SyncPhaseRollback},
+	}
+	for _, tt := range tests {
+		// the phase survives the store and load of the internal state
+		buf, err := (&InternalState{SyncPhase: tt.phase, InterruptedSyncPhase: SyncPhaseBodies}).Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		is, err := UnpackInternalState(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		is.ResetSyncPhase()
+		phase, since, _, _ := is.GetSyncPhase()
+		if phase != SyncPhaseIdle || since.IsZero() {
+			t.Errorf("ResetSyncPhase() of %v: phase %v since %v, want idle", tt.phase, phase, since)
+		}
+		if is.InterruptedSyncPhase != tt.interrupted {
+			t.Errorf("ResetSyncPhase() of %v: interrupted phase %v, want %v", tt.phase, is.InterruptedSyncPhase, tt.interrupted)
+		}
+		if synced, _, _ := is.GetSyncState(); synced {
+			t.Errorf("GetSyncState() after ResetSyncPhase() of %v = synchronized", tt.phase)
+		}
+	}
+}
@@ -22,6 +22,18 @@ type Metrics struct {
 	DbColumnRows          *prometheus.GaugeVec
 	DbColumnSize          *prometheus.GaugeVec
 	BlockbookAppInfo      *prometheus.GaugeVec
+	APIRequests           *prometheus.CounterVec
+	APIReqDuration        *prometheus.HistogramVec
+	DbRequests            *prometheus.CounterVec
+	DbReqDuration         *prometheus.HistogramVec
+	ConnectBlockStats     *prometheus.CounterVec
+	ConnectBlockWindow    *prometheus.GaugeVec
+	ReorgDepth            prometheus.Histogram
+	AmountAnomalies       *prometheus.CounterVec
+	TxAddressesRepairs    *prometheus.CounterVec
+	IndexSyncConcurrency  prometheus.Gauge
+	APIQuotaRejections    *prometheus.CounterVec
+	StaticExportHeight    prometheus.Gauge
 }
 
 type Labels = prometheus.Labels
@@ -148,6 +160,102 @@ func GetMetrics(coin string) (*Metrics, error) {
 		},
 		[]string{"blockbook_version", "blockbook_commit", "blockbook_buildtime", "backend_version", "backend_subversion", "backend_protocol_version"},
 	)
+	metrics.APIRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_api_requests",
+			Help:        "Total number of api and explorer requests by method and status",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"method", "status"},
+	)
+	metrics.APIReqDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:        "blockbook_api_req_duration",
+			Help:        "Api and explorer request duration by method and status (in milliseconds)",
+			Buckets:     []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"method", "status"},
+	)
+	metrics.DbRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_db_requests",
+			Help:        "Total number of db operations by method and status",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"method", "status"},
+	)
+	metrics.DbReqDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:        "blockbook_db_req_duration",
+			Help:        "Duration of db operations by method and status (in milliseconds)",
+			Buckets:     []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 50, 100, 500, 1000},
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"method", "status"},
+	)
+	metrics.ConnectBlockStats = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_connect_block_stats",
+			Help:        "Number of hits and misses of txAddresses and balances lookups during connect of blocks",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"stat"},
+	)
+	metrics.ConnectBlockWindow = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_connect_block_window",
+			Help:        "Stats of the last finished window of connected blocks (duration per block in milliseconds, hit ratios of lookups)",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"stat"},
+	)
+	metrics.ReorgDepth = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:        "blockbook_reorg_depth",
+			Help:        "Depth of the handled chain reorganizations (number of disconnected blocks)",
+			Buckets:     []float64{1, 2, 3, 4, 5, 6, 10, 20, 50, 100},
+			ConstLabels: Labels{"coin": coin},
+		},
+	)
+	metrics.AmountAnomalies = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_amount_anomalies",
+			Help:        "Number of negative balances reset to zero and amounts truncated when stored by kind",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"kind"},
+	)
+	metrics.TxAddressesRepairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_txaddresses_repairs",
+			Help:        "Number of read-repairs of the transactions missing in txAddresses by result",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"result"},
+	)
+	metrics.IndexSyncConcurrency = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_index_sync_concurrency",
+			Help:        "Number of concurrent block fetches of the parallel sync, tuned by the latency of the backend",
+			ConstLabels: Labels{"coin": coin},
+		},
+	)
+	metrics.StaticExportHeight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_static_export_height",
+			Help:        "Height of the last block exported as static files",
+			ConstLabels: Labels{"coin": coin},
+		},
+	)
+	metrics.APIQuotaRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "blockbook_api_quota_rejections",
+			Help:        "Number of api and socket.io requests rejected by the quotas by tier",
+			ConstLabels: Labels{"coin": coin},
+		},
+		[]string{"tier"},
+	)
 
 	v := reflect.ValueOf(metrics)
 	for i := 0; i < v.NumField(); i++ {
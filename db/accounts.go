@@ -0,0 +1,171 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tecbot/gorocksdb"
+)
+
+// accountChange is the change of the address balance record of account based chain caused by a block
+// or by the disconnected range of blocks
+type accountChange struct {
+	txs       uint32
+	sentTxs   uint64
+	nextNonce uint64
+	// undos are the nonces before the disconnected blocks
+	undos []nonceUndo
+}
+
+// nonceUndo is the next nonce of the address before the block at height, it is stored in the value of the heightAddresses column
+// if the block changed the nonce; the blocks connected by older versions of Blockbook do not have it stored
+type nonceUndo struct {
+	height  uint32
+	sentTxs uint64
+	nonce   uint64
+	stored  bool
+}
+
+// countAccountTxs counts distinct transactions and distinct sent transactions (inputs are stored as ^index) of the outpoints
+func countAccountTxs(outpoints []outpoint) (uint32, uint64) {
+	txs := make(map[string]struct{}, len(outpoints))
+	sent := make(map[string]struct{})
+	for _, o := range outpoints {
+		txs[string(o.btxID)] = struct{}{}
+		if o.index < 0 {
+			sent[string(o.btxID)] = struct{}{}
+		}
+	}
+	return uint32(len(txs)), uint64(len(sent))
+}
+
+// getAccountChanges counts distinct transactions and distinct sent transactions of the addresses
+func getAccountChanges(addresses map[string][]outpoint) map[string]*accountChange {
+	changes := make(map[string]*accountChange, len(addresses))
+	for addrDesc, outpoints := range addresses {
+		c := &accountChange{}
+		c.txs, c.sentTxs = countAccountTxs(outpoints)
+		changes[addrDesc] = c
+	}
+	return changes
+}
+
+func packNonceUndo(nonce uint64) []byte {
+	buf := make([]byte, maxPackedBigintBytes)
+	return buf[:packVaruint(uint(nonce), buf)]
+}
+
+func unpackNonceUndo(height uint32, sentTxs uint64, buf []byte) nonceUndo {
+	u := nonceUndo{height: height, sentTxs: sentTxs}
+	if len(buf) > 0 {
+		if n, l := unpackVaruint(buf); l > 0 {
+			u.nonce = uint64(n)
+			u.stored = true
+		}
+	}
+	return u
+}
+
+// restoreNonce returns the next nonce of the address before the disconnected blocks, the blocks are undone from the highest,
+// the stored nonce before the block is used if available, otherwise the number of the sent transactions is subtracted
+func restoreNonce(nonce uint64, undos []nonceUndo) uint64 {
+	sort.Slice(undos, func(i, j int) bool { return undos[i].height > undos[j].height })
+	for _, u := range undos {
+		if u.stored {
+			nonce = u.nonce
+		} else if nonce > u.sentTxs {
+			nonce -= u.sentTxs
+		} else {
+			nonce = 0
+		}
+	}
+	return nonce
+}
+
+// updateAccountBalances maintains number of transactions and the next nonce of the addresses of account based chains
+// the next nonce is equal to the number of transactions sent by the address, if the parser knows the nonce of the transaction,
+// it is used to correct the value (for example if the index does not start from the genesis block)
+func (d *RocksDB) updateAccountBalances(wb *gorocksdb.WriteBatch, block *bchain.Block, addresses map[string][]outpoint, op int) error {
+	changes := getAccountChanges(addresses)
+	if op == opInsert {
+		for i := range block.Txs {
+			tx := &block.Txs[i]
+			if len(tx.Vin) == 0 || len(tx.Vin[0].Addresses) == 0 {
+				continue
+			}
+			nonce, err := d.chainParser.GetTxNonce(tx)
+			if err != nil {
+				if err != bchain.ErrNotSupported {
+					glog.Warningf("rocksdb: GetTxNonce: %v - height %d, tx %v", err, block.Height, tx.Txid)
+				}
+				continue
+			}
+			addrDesc, err := d.chainParser.GetAddrDescFromAddress(tx.Vin[0].Addresses[0])
+			if err != nil {
+				continue
+			}
+			if c, found := changes[string(addrDesc)]; found && nonce+1 > c.nextNonce {
+				c.nextNonce = nonce + 1
+			}
+		}
+	}
+	return d.storeAccountChanges(wb, block.Height, changes, op)
+}
+
+// storeAccountChanges applies the changes to the balances of the addresses, on insert the nonce before the block at height
+// is stored to the heightAddresses column if the block changes it, so that the disconnect restores it exactly
+// including the correction by the nonces of the transactions
+func (d *RocksDB) storeAccountChanges(wb *gorocksdb.WriteBatch, height uint32, changes map[string]*accountChange, op int) error {
+	balances := make(map[string]*AddrBalance, len(changes))
+	for addrDesc, c := range changes {
+		ab, err := d.GetAddrDescBalance(bchain.AddressDescriptor(addrDesc))
+		if err != nil {
+			return err
+		}
+		if ab == nil {
+			ab = &AddrBalance{}
+		}
+		if op == opInsert {
+			nonce := ab.Nonce
+			ab.Txs += c.txs
+			ab.Nonce += c.sentTxs
+			if c.nextNonce > ab.Nonce {
+				ab.Nonce = c.nextNonce
+			}
+			if ab.Nonce != nonce {
+				wb.PutCF(d.cfh[cfHeightAddresses], packHeightAddressKey(height, bchain.AddressDescriptor(addrDesc)), packNonceUndo(nonce))
+			}
+		} else {
+			if ab.Txs > c.txs {
+				ab.Txs -= c.txs
+			} else {
+				ab.Txs = 0
+			}
+			if len(c.undos) > 0 {
+				ab.Nonce = restoreNonce(ab.Nonce, c.undos)
+			} else if ab.Nonce > c.sentTxs {
+				ab.Nonce -= c.sentTxs
+			} else {
+				ab.Nonce = 0
+			}
+		}
+		balances[addrDesc] = ab
+	}
+	return d.storeBalances(wb, balances)
+}
+
+// GetAddrDescNonce returns the next nonce of the address of account based chain from the confirmed transactions
+func (d *RocksDB) GetAddrDescNonce(addrDesc bchain.AddressDescriptor) (nonce uint64, err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescNonce", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	ab, err := d.GetAddrDescBalance(addrDesc)
+	if err != nil || ab == nil {
+		return 0, err
+	}
+	return ab.Nonce, nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"container/heap"
+	"time"
+
+	"github.com/tecbot/gorocksdb"
+)
+
+// AddressGroupTx is a transaction of a group of address descriptors, Inputs (Outputs) is set
+// if any address of the group is in the inputs (outputs) of the transaction
+type AddressGroupTx struct {
+	Txid    string
+	Inputs  bool
+	Outputs bool
+}
+
+// addressGroupCursor is the reverse iterator over the records of one address descriptor of the group
+type addressGroupCursor struct {
+	it     *gorocksdb.Iterator
+	kstart []byte
+	klen   int
+	order  int
+	height uint32
+}
+
+// valid skips the records of other address descriptors (with the same prefix), sets the height of the current record
+// and returns false if the cursor is past the first record of the address descriptor
+func (c *addressGroupCursor) valid() bool {
+	for ; c.it.Valid(); c.it.Prev() {
+		key := c.it.Key().Data()
+		if bytes.Compare(key, c.kstart) < 0 {
+			return false
+		}
+		if len(key) != c.klen {
+			continue
+		}
+		_, c.height, _ = unpackAddressKey(key)
+		return true
+	}
+	return false
+}
+
+// addressGroupHeap orders the cursors by the height of the current record from the highest,
+// the cursors of the same height in the order of the address descriptors
+type addressGroupHeap []*addressGroupCursor
+
+func (h addressGroupHeap) Len() int { return len(h) }
+func (h addressGroupHeap) Less(i, j int) bool {
+	if h[i].height != h[j].height {
+		return h[i].height > h[j].height
+	}
+	return h[i].order < h[j].order
+}
+func (h addressGroupHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *addressGroupHeap) Push(x interface{}) { *h = append(*h, x.(*addressGroupCursor)) }
+func (h *addressGroupHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// GetAddrDescsHeightTransactionsReverse merges the histories of the address descriptors in the blocks from higher to lower
+// by a k-way merge of the iterators of the addresses, the unique transactions of each block are passed to callback function
+// at once in descending order of the heights, in the order of the first occurrence in the records of the address descriptors;
+// only the current records of the iterators are held in memory, not the whole histories
+func (d *RocksDB) GetAddrDescsHeightTransactionsReverse(addrDescs []bchain.AddressDescriptor, lower uint32, higher uint32, fn func(height uint32, txs []AddressGroupTx) error) (err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescsHeightTransactionsReverse", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	h := make(addressGroupHeap, 0, len(addrDescs))
+	for i, addrDesc := range addrDescs {
+		kstop := packAddressKey(addrDesc, higher)
+		c := &addressGroupCursor{
+			it:     d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses]),
+			kstart: packAddressKey(addrDesc, lower),
+			klen:   len(kstop),
+			order:  i,
+		}
+		defer c.it.Close()
+		seekLastNotGreater(c.it, kstop)
+		if c.valid() {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		height := h[0].height
+		var txs []AddressGroupTx
+		index := make(map[string]int)
+		for h.Len() > 0 && h[0].height == height {
+			c := heap.Pop(&h).(*addressGroupCursor)
+			outpoints, err := d.unpackAddressOutpoints(c.it.Value().Data())
+			if err != nil {
+				return err
+			}
+			for _, o := range outpoints {
+				i, found := index[string(o.btxID)]
+				if !found {
+					txid, err := d.chainParser.UnpackTxid(o.btxID)
+					if err != nil {
+						return err
+					}
+					i = len(txs)
+					index[string(o.btxID)] = i
+					txs = append(txs, AddressGroupTx{Txid: txid})
+				}
+				if o.index < 0 {
+					txs[i].Inputs = true
+				} else {
+					txs[i].Outputs = true
+				}
+			}
+			// the next record of the address is in a lower block, it is not popped again for this height
+			c.it.Prev()
+			if c.valid() {
+				heap.Push(&h, c)
+			}
+		}
+		if err := fn(height, txs); err != nil {
+			if _, ok := err.(*StopIteration); ok {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
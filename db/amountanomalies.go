@@ -0,0 +1,331 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/common"
+	"bytes"
+	"math/big"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// AmountAnomalyKind is the kind of the guard of the amount math, which was triggered during the sync
+type AmountAnomalyKind uint8
+
+const (
+	// AmountAnomalyNegativeBalance is the balance of the address, which would become negative and was reset to zero
+	AmountAnomalyNegativeBalance AmountAnomalyKind = iota
+	// AmountAnomalyNegativeSent is the sent amount of the address, which would become negative by a disconnect and was reset to zero
+	AmountAnomalyNegativeSent
+	// AmountAnomalyTruncatedBalance is the balance or the sent amount of the address longer than maxPackedBigintBytes, which is truncated when stored
+	AmountAnomalyTruncatedBalance
+	// AmountAnomalyTruncatedValue is the value of the output longer than maxPackedBigintBytes, which is truncated when stored
+	AmountAnomalyTruncatedValue
+)
+
+var amountAnomalyKindNames = []string{"negative-balance", "negative-sent", "truncated-balance", "truncated-value"}
+
+func (k AmountAnomalyKind) String() string {
+	if int(k) < len(amountAnomalyKindNames) {
+		return amountAnomalyKindNames[k]
+	}
+	return "unknown"
+}
+
+// negative returns true for the kinds, which record the negative value reset to zero
+func (k AmountAnomalyKind) negative() bool {
+	return k == AmountAnomalyNegativeBalance || k == AmountAnomalyNegativeSent
+}
+
+// AmountAnomaly records the triggering of a guard of the amount math for the address, Count is the number of the triggers
+// between the blocks FirstHeight and LastHeight and ValueSat is the value of the last trigger (truncated if too long)
+type AmountAnomaly struct {
+	AddrDesc    bchain.AddressDescriptor
+	Kind        AmountAnomalyKind
+	Count       uint32
+	FirstHeight uint32
+	LastHeight  uint32
+	ValueSat    big.Int
+}
+
+// amountAnomalies are the anomalies found in the blocks, which are not yet written, keyed by the column key
+type amountAnomalies struct {
+	mux     sync.Mutex
+	pending map[string]*AmountAnomaly
+	// balancesMux serializes the recompute of a balance with the block connect and disconnect, which write the balances
+	balancesMux sync.Mutex
+}
+
+// bigintTruncated returns true if packBigint truncates the big int
+func bigintTruncated(bi *big.Int) bool {
+	return len(bi.Bits()) > maxPackedBigintWords
+}
+
+func packAmountAnomalyKey(addrDesc bchain.AddressDescriptor, kind AmountAnomalyKind) []byte {
+	key := make([]byte, 0, len(addrDesc)+1)
+	key = append(key, addrDesc...)
+	return append(key, byte(kind))
+}
+
+func unpackAmountAnomalyKey(key []byte) (bchain.AddressDescriptor, AmountAnomalyKind, error) {
+	if len(key) == 0 {
+		return nil, 0, errors.New("Invalid amount anomaly key")
+	}
+	return bchain.AddressDescriptor(append([]byte(nil), key[:len(key)-1]...)), AmountAnomalyKind(key[len(key)-1]), nil
+}
+
+// packAmountAnomaly packs the anomaly without the address descriptor and the kind, which are in the key,
+// the negative values are stored as their absolute values
+func packAmountAnomaly(a *AmountAnomaly) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(a.Count), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	buf = append(buf, packUint(a.FirstHeight)...)
+	buf = append(buf, packUint(a.LastHeight)...)
+	l = packBigint(&a.ValueSat, varBuf)
+	return append(buf, varBuf[:l]...)
+}
+
+func unpackAmountAnomaly(kind AmountAnomalyKind, buf []byte) (*AmountAnomaly, error) {
+	c, l := unpackVaruint(buf)
+	if l <= 0 || l+9 > len(buf) || l+9+int(buf[l+8]) != len(buf) {
+		return nil, errors.New("Invalid packed amount anomaly")
+	}
+	a := &AmountAnomaly{
+		Kind:        kind,
+		Count:       uint32(c),
+		FirstHeight: unpackUint(buf[l:]),
+		LastHeight:  unpackUint(buf[l+4:]),
+	}
+	a.ValueSat, _ = unpackBigint(buf[l+8:])
+	if kind.negative() {
+		a.ValueSat.Neg(&a.ValueSat)
+	}
+	return a, nil
+}
+
+// recordAmountAnomaly adds the anomaly found in the block at height to the pending anomalies, which are written with the block,
+// it is called also from the parallel processing of the blocks by the sharded sync
+func (d *RocksDB) recordAmountAnomaly(addrDesc bchain.AddressDescriptor, kind AmountAnomalyKind, height uint32, valueSat *big.Int) {
+	if d.metrics != nil {
+		d.metrics.AmountAnomalies.With(common.Labels{"kind": kind.String()}).Inc()
+	}
+	key := string(packAmountAnomalyKey(addrDesc, kind))
+	d.anomalies.mux.Lock()
+	defer d.anomalies.mux.Unlock()
+	if d.anomalies.pending == nil {
+		d.anomalies.pending = make(map[string]*AmountAnomaly)
+	}
+	a := d.anomalies.pending[key]
+	if a == nil {
+		a = &AmountAnomaly{AddrDesc: addrDesc, Kind: kind, FirstHeight: height}
+		d.anomalies.pending[key] = a
+	}
+	a.Count++
+	if height < a.FirstHeight {
+		a.FirstHeight = height
+	}
+	if height >= a.LastHeight {
+		a.LastHeight = height
+		a.ValueSat.Set(valueSat)
+	}
+}
+
+// checkTruncatedBalance records the balance or the sent amount of the address, which does not fit to the packed size
+func (d *RocksDB) checkTruncatedBalance(ab *AddrBalance, addrDesc bchain.AddressDescriptor, height uint32) {
+	for _, v := range []*big.Int{&ab.BalanceSat, &ab.SentSat} {
+		if bigintTruncated(v) {
+			glog.Warningf("rocksdb: height %d, address hex '%v' has balance or sent amount longer than %d bytes, it is truncated", height, addrDesc, maxPackedBigintBytes-1)
+			d.recordAmountAnomaly(addrDesc, AmountAnomalyTruncatedBalance, height, v)
+		}
+	}
+}
+
+// clearAmountAnomalies discards the pending anomalies of the blocks, which were not written
+func (d *RocksDB) clearAmountAnomalies() {
+	d.anomalies.mux.Lock()
+	d.anomalies.pending = nil
+	d.anomalies.mux.Unlock()
+}
+
+// storeAmountAnomalies merges the pending anomalies with the stored ones and writes them to the write batch
+func (d *RocksDB) storeAmountAnomalies(wb *gorocksdb.WriteBatch) error {
+	d.anomalies.mux.Lock()
+	pending := d.anomalies.pending
+	d.anomalies.pending = nil
+	d.anomalies.mux.Unlock()
+	for key, a := range pending {
+		val, err := d.db.GetCF(d.ro, d.cfh[cfAmountAnomalies], []byte(key))
+		if err != nil {
+			return err
+		}
+		if len(val.Data()) > 0 {
+			s, err := unpackAmountAnomaly(a.Kind, val.Data())
+			if err != nil {
+				val.Free()
+				return err
+			}
+			a.Count += s.Count
+			if s.FirstHeight < a.FirstHeight {
+				a.FirstHeight = s.FirstHeight
+			}
+			if s.LastHeight > a.LastHeight {
+				a.LastHeight = s.LastHeight
+				a.ValueSat = s.ValueSat
+			}
+		}
+		val.Free()
+		wb.PutCF(d.cfh[cfAmountAnomalies], []byte(key), packAmountAnomaly(a))
+	}
+	return nil
+}
+
+// GetAmountAnomalies returns the stored anomalies of the amount math of the address descriptor, or of all addresses if addrDesc is nil
+func (d *RocksDB) GetAmountAnomalies(addrDesc bchain.AddressDescriptor) (r []AmountAnomaly, err error) {
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAmountAnomalies])
+	defer it.Close()
+	if addrDesc == nil {
+		it.SeekToFirst()
+	} else {
+		it.Seek(addrDesc)
+	}
+	for ; it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if addrDesc != nil && !bytes.HasPrefix(key, addrDesc) {
+			break
+		}
+		ad, kind, err := unpackAmountAnomalyKey(key)
+		if err != nil {
+			return nil, err
+		}
+		// the key of an address descriptor prefixed by addrDesc
+		if addrDesc != nil && !bytes.Equal(ad, addrDesc) {
+			continue
+		}
+		a, err := unpackAmountAnomaly(kind, it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		a.AddrDesc = ad
+		r = append(r, *a)
+	}
+	return r, nil
+}
+
+// BalanceRecompute is the balance of the address recomputed from the indexed transactions of the address, Old is the stored balance
+type BalanceRecompute struct {
+	AddrDesc bchain.AddressDescriptor
+	Old      *AddrBalance
+	New      AddrBalance
+	// Changed is set if the recomputed balance differs from the stored one and was stored
+	Changed bool
+	// Unresolved is set if the recomputed balance is negative or too long to be stored, the stored balance is kept then
+	Unresolved bool
+}
+
+// RecomputeAddrDescBalance recomputes the balance of the address descriptor from the inputs and outputs of its indexed transactions,
+// stores it if it is valid and removes the anomalies of the address; it is not available during the initial sync,
+// as the bulk connect keeps the balances in memory
+func (d *RocksDB) RecomputeAddrDescBalance(addrDesc bchain.AddressDescriptor) (r *BalanceRecompute, err error) {
+	if !d.chainParser.IsUTXOChain() {
+		return nil, errors.New("The recompute of the balance is available only for UTXO chains")
+	}
+	if d.is != nil && d.is.InitialSync {
+		return nil, errors.New("The recompute of the balance is not available during the initial sync")
+	}
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	d.anomalies.balancesMux.Lock()
+	defer d.anomalies.balancesMux.Unlock()
+	r = &BalanceRecompute{AddrDesc: addrDesc}
+	if r.Old, err = d.GetAddrDescBalance(addrDesc); err != nil {
+		return nil, err
+	}
+	var received big.Int
+	seen := make(map[string]struct{})
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+	for it.Seek(addrDesc); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, addrDesc) {
+			break
+		}
+		// the key of an address descriptor prefixed by addrDesc
+		if len(key) != len(addrDesc)+packedHeightBytes {
+			continue
+		}
+		_, height, err := unpackAddressKey(key)
+		if err != nil {
+			return nil, err
+		}
+		outpoints, err := d.unpackAddressOutpoints(it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range outpoints {
+			txid, err := d.chainParser.UnpackTxid(o.btxID)
+			if err != nil {
+				return nil, err
+			}
+			taKey := d.txAddressesKey(o.btxID, txid, height)
+			if _, found := seen[string(taKey)]; found {
+				continue
+			}
+			seen[string(taKey)] = struct{}{}
+			ta, err := d.getTxAddresses(taKey)
+			if err != nil {
+				return nil, err
+			}
+			if ta == nil {
+				return nil, errors.Errorf("Transaction %v of the address not found in txAddresses", txid)
+			}
+			r.New.Txs++
+			for i := range ta.Inputs {
+				if bytes.Equal(ta.Inputs[i].AddrDesc, addrDesc) {
+					r.New.SentSat.Add(&r.New.SentSat, &ta.Inputs[i].ValueSat)
+				}
+			}
+			for i := range ta.Outputs {
+				if bytes.Equal(ta.Outputs[i].AddrDesc, addrDesc) {
+					received.Add(&received, &ta.Outputs[i].ValueSat)
+				}
+			}
+		}
+	}
+	r.New.BalanceSat.Sub(&received, &r.New.SentSat)
+	if r.Old != nil {
+		r.New.Nonce = r.Old.Nonce
+		r.New.Counterparties = r.Old.Counterparties
+	}
+	if r.New.BalanceSat.Sign() < 0 || bigintTruncated(&r.New.BalanceSat) || bigintTruncated(&r.New.SentSat) {
+		r.Unresolved = true
+		return r, nil
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	r.Changed = r.Old == nil || r.Old.Txs != r.New.Txs || r.Old.BalanceSat.Cmp(&r.New.BalanceSat) != 0 || r.Old.SentSat.Cmp(&r.New.SentSat) != 0
+	if r.Changed {
+		if err = d.storeBalances(wb, map[string]*AddrBalance{string(addrDesc): &r.New}); err != nil {
+			return nil, err
+		}
+	}
+	for k := range amountAnomalyKindNames {
+		wb.DeleteCF(d.cfh[cfAmountAnomalies], packAmountAnomalyKey(addrDesc, AmountAnomalyKind(k)))
+	}
+	if err = d.db.Write(d.wo, wb); err != nil {
+		return nil, err
+	}
+	if r.Changed {
+		glog.Infof("rocksdb: address hex '%v' balance recomputed, txs %d, balance %v, sent %v", addrDesc, r.New.Txs, r.New.BalanceSat.String(), r.New.SentSat.String())
+	}
+	return r, nil
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// ArchivedBlock is the record of a block published to the IPFS archive
+type ArchivedBlock struct {
+	Height uint32
+	Hash   string
+	CID    string
+}
+
+// archiveDocument is the content published to IPFS for each block
+// the documents are linked by PrevCID, so that the whole archived chain can be verified from the CID of the last block
+type archiveDocument struct {
+	Coin    string   `json:"coin"`
+	Height  uint32   `json:"height"`
+	Hash    string   `json:"hash"`
+	Prev    string   `json:"previousblockhash,omitempty"`
+	Time    int64    `json:"time"`
+	Txids   []string `json:"txids"`
+	PrevCID string   `json:"previouscid,omitempty"`
+}
+
+func (d *RocksDB) packArchivedBlock(ab *ArchivedBlock) ([]byte, error) {
+	b, err := d.chainParser.PackBlockHash(ab.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return packString(ab.CID, b), nil
+}
+
+func (d *RocksDB) unpackArchivedBlock(height uint32, buf []byte) (*ArchivedBlock, error) {
+	pl := d.chainParser.PackedTxidLen()
+	if len(buf) <= pl {
+		return nil, errors.New("Invalid archived block")
+	}
+	hash, err := d.chainParser.UnpackBlockHash(buf[:pl])
+	if err != nil {
+		return nil, err
+	}
+	cid, _, err := unpackString(buf[pl:])
+	if err != nil {
+		return nil, err
+	}
+	return &ArchivedBlock{Height: height, Hash: hash, CID: cid}, nil
+}
+
+// GetArchivedBlock returns the archive record of the block at given height or nil if the block was not archived
+func (d *RocksDB) GetArchivedBlock(height uint32) (ab *ArchivedBlock, err error) {
+	defer func(s time.Time) { d.observeMethod("GetArchivedBlock", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	val, err := d.db.GetCF(d.ro, d.cfh[cfArchive], packUint(height))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	return d.unpackArchivedBlock(height, val.Data())
+}
+
+// getLastArchivedBlock returns the archive record with the highest height or nil if nothing was archived
+func (d *RocksDB) getLastArchivedBlock() (*ArchivedBlock, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfArchive])
+	defer it.Close()
+	if it.SeekToLast(); it.Valid() {
+		return d.unpackArchivedBlock(unpackUint(it.Key().Data()), it.Value().Data())
+	}
+	return nil, nil
+}
+
+func (d *RocksDB) storeArchivedBlock(ab *ArchivedBlock) error {
+	buf, err := d.packArchivedBlock(ab)
+	if err != nil {
+		return err
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	wb.PutCF(d.cfh[cfArchive], packUint(ab.Height), buf)
+	return d.db.Write(d.wo, wb)
+}
+
+// Archiver publishes the connected blocks (header and list of txids) to IPFS and records their CIDs in the db
+type Archiver struct {
+	d       *RocksDB
+	chain   bchain.BlockChain
+	apiURL  string
+	from    int
+	client  *http.Client
+	chanRun chan struct{}
+	done    chan struct{}
+	closing int32
+	once    sync.Once
+}
+
+// NewArchiver creates an archiver publishing to the IPFS node with the http api at apiURL (e.g. http://127.0.0.1:5001)
+// if nothing was archived yet, the archiving starts at the height from, or at the best block if from is negative
+func NewArchiver(d *RocksDB, chain bchain.BlockChain, apiURL string, from int) *Archiver {
+	return &Archiver{
+		d:       d,
+		chain:   chain,
+		apiURL:  strings.TrimRight(apiURL, "/"),
+		from:    from,
+		client:  &http.Client{Timeout: 60 * time.Second},
+		chanRun: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run archives the blocks each time it is notified by Archive, until Close is called
+func (a *Archiver) Run() {
+	defer close(a.done)
+	glog.Info("archiver: starting, ipfs ", a.apiURL)
+	for range a.chanRun {
+		if err := a.archive(); err != nil {
+			glog.Error("archiver: ", err)
+		}
+	}
+	glog.Info("archiver: stopped")
+}
+
+// Archive notifies the archiver that new blocks were connected, it does not block
+func (a *Archiver) Archive() {
+	select {
+	case a.chanRun <- struct{}{}:
+	default:
+	}
+}
+
+// OnNewBlock is the callback invoked after a new block is connected
+func (a *Archiver) OnNewBlock(hash string, height uint32) {
+	a.Archive()
+}
+
+// Close stops the archiver and waits for the finish of the running archiving
+func (a *Archiver) Close() {
+	a.once.Do(func() {
+		atomic.StoreInt32(&a.closing, 1)
+		close(a.chanRun)
+		<-a.done
+	})
+}
+
+func (a *Archiver) archive() error {
+	bestHeight, err := a.d.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	last, err := a.d.getLastArchivedBlock()
+	if err != nil {
+		return err
+	}
+	var height uint32
+	var prevCID string
+	if last != nil {
+		// the archive records of disconnected blocks are removed by the disconnect,
+		// however a block can be disconnected while it is being published
+		bi, err := a.d.GetBlockInfo(last.Height)
+		if err != nil {
+			return err
+		}
+		if bi != nil && bi.Hash == last.Hash {
+			height = last.Height + 1
+			prevCID = last.CID
+		} else {
+			height = last.Height
+			if height > 0 {
+				prev, err := a.d.GetArchivedBlock(height - 1)
+				if err != nil {
+					return err
+				}
+				if prev != nil {
+					prevCID = prev.CID
+				}
+			}
+		}
+	} else if a.from >= 0 {
+		height = uint32(a.from)
+	} else {
+		height = bestHeight
+	}
+	for ; height <= bestHeight; height++ {
+		if atomic.LoadInt32(&a.closing) != 0 {
+			return nil
+		}
+		bi, err := a.d.GetBlockInfo(height)
+		if err != nil {
+			return err
+		}
+		if bi == nil {
+			// the block was disconnected meanwhile
+			return nil
+		}
+		ab := &ArchivedBlock{Height: height, Hash: bi.Hash}
+		if ab.CID, err = a.publish(bi.Hash, height, prevCID); err != nil {
+			return errors.Annotatef(err, "block %v %v", height, bi.Hash)
+		}
+		if err = a.d.storeArchivedBlock(ab); err != nil {
+			return err
+		}
+		glog.V(1).Info("archiver: block ", height, " ", bi.Hash, " archived as ", ab.CID)
+		prevCID = ab.CID
+	}
+	return nil
+}
+
+// publish gets the block from the backend and adds its archive document to IPFS, returns CID of the document
+func (a *Archiver) publish(hash string, height uint32, prevCID string) (string, error) {
+	block, err := a.chain.GetBlock(hash, height)
+	if err != nil {
+		return "", err
+	}
+	doc := archiveDocument{
+		Coin:    a.chain.GetCoinName(),
+		Height:  height,
+		Hash:    block.Hash,
+		Prev:    block.Prev,
+		Time:    block.Time,
+		Txids:   make([]string, len(block.Txs)),
+		PrevCID: prevCID,
+	}
+	for i := range block.Txs {
+		doc.Txids[i] = block.Txs[i].Txid
+	}
+	content, err := json.Marshal(&doc)
+	if err != nil {
+		return "", err
+	}
+	return a.ipfsAdd(content)
+}
+
+// ipfsAdd adds and pins the content using the api of the IPFS node
+func (a *Archiver) ipfsAdd(content []byte) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "block.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err = fw.Write(content); err != nil {
+		return "", err
+	}
+	if err = mw.Close(); err != nil {
+		return "", err
+	}
+	res, err := a.client.Post(a.apiURL+"/api/v0/add?pin=true&cid-version=1", mw.FormDataContentType(), &body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("IPFS add: status %v, %v", res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	var r struct {
+		Hash string
+	}
+	if err = json.Unmarshal(b, &r); err != nil {
+		return "", errors.Annotatef(err, "IPFS add")
+	}
+	if r.Hash == "" {
+		return "", errors.New("IPFS add: missing Hash in response")
+	}
+	return r.Hash, nil
+}
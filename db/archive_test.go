@@ -0,0 +1,190 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/tests/dbtestdata"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testArchiveChain serves the test blocks to the archiver, the other methods of the interface are not used
+type testArchiveChain struct {
+	bchain.BlockChain
+	blocks map[string]*bchain.Block
+}
+
+func (c *testArchiveChain) GetBlock(hash string, height uint32) (*bchain.Block, error) {
+	if b, found := c.blocks[hash]; found {
+		return b, nil
+	}
+	return nil, bchain.ErrBlockNotFound
+}
+
+func (c *testArchiveChain) GetCoinName() string {
+	return "Testnet"
+}
+
+// testIPFS is the add endpoint of the IPFS http api storing the added documents
+type testIPFS struct {
+	mux  sync.Mutex
+	docs []archiveDocument
+	fail bool
+}
+
+func (f *testIPFS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if r.URL.Path != "/api/v0/add" || r.URL.Query().Get("pin") != "true" {
+		http.NotFound(w, r)
+		return
+	}
+	if f.fail {
+		http.Error(w, "node is offline", http.StatusInternalServerError)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, _ := ioutil.ReadAll(file)
+	var doc archiveDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.docs = append(f.docs, doc)
+	fmt.Fprintf(w, `{"Name":"block.json","Hash":"cid%d","Size":"%d"}`, len(f.docs), len(b))
+}
+
+func (f *testIPFS) published() []archiveDocument {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]archiveDocument(nil), f.docs...)
+}
+
+func TestArchiver(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	block1 := dbtestdata.GetTestUTXOBlock1(d.chainParser)
+	block2 := dbtestdata.GetTestUTXOBlock2(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	ipfs := &testIPFS{}
+	ts := httptest.NewServer(ipfs)
+	defer ts.Close()
+	chain := &testArchiveChain{blocks: map[string]*bchain.Block{block1.Hash: block1, block2.Hash: block2}}
+	a := NewArchiver(d, chain, ts.URL+"/", int(block1.Height))
+
+	if err := a.archive(); err != nil {
+		t.Fatal(err)
+	}
+	txids := func(b *bchain.Block) []string {
+		r := make([]string, len(b.Txs))
+		for i := range b.Txs {
+			r[i] = b.Txs[i].Txid
+		}
+		return r
+	}
+	want := []archiveDocument{
+		{Coin: "Testnet", Height: block1.Height, Hash: block1.Hash, Prev: block1.Prev, Time: block1.Time, Txids: txids(block1)},
+		{Coin: "Testnet", Height: block2.Height, Hash: block2.Hash, Prev: block2.Prev, Time: block2.Time, Txids: txids(block2), PrevCID: "cid1"},
+	}
+	if got := ipfs.published(); !reflect.DeepEqual(got, want) {
+		t.Errorf("published documents %+v, want %+v", got, want)
+	}
+	for i, h := range []uint32{block1.Height, block2.Height} {
+		ab, err := d.GetArchivedBlock(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantAB := &ArchivedBlock{Height: h, Hash: want[i].Hash, CID: fmt.Sprintf("cid%d", i+1)}
+		if !reflect.DeepEqual(ab, wantAB) {
+			t.Errorf("GetArchivedBlock(%v) = %+v, want %+v", h, ab, wantAB)
+		}
+	}
+
+	// the archived blocks are not published again
+	if err := a.archive(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(ipfs.published()); got != 2 {
+		t.Errorf("published %v documents after the repeated archive, want 2", got)
+	}
+
+	// the disconnected block loses its archive record, the reconnected block is linked to the archived previous block
+	if err := d.DisconnectBlockRangeUTXO(block2.Height, block2.Height); err != nil {
+		t.Fatal(err)
+	}
+	if ab, err := d.GetArchivedBlock(block2.Height); err != nil || ab != nil {
+		t.Errorf("GetArchivedBlock() of the disconnected block = %+v, %v, want nil", ab, err)
+	}
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	ipfs.mux.Lock()
+	ipfs.fail = true
+	ipfs.mux.Unlock()
+	if err := a.archive(); err == nil {
+		t.Error("archive() with failing IPFS node expected error")
+	}
+	if ab, err := d.GetArchivedBlock(block2.Height); err != nil || ab != nil {
+		t.Errorf("GetArchivedBlock() of the block not published = %+v, %v, want nil", ab, err)
+	}
+	ipfs.mux.Lock()
+	ipfs.fail = false
+	ipfs.mux.Unlock()
+	if err := a.archive(); err != nil {
+		t.Fatal(err)
+	}
+	docs := ipfs.published()
+	if len(docs) != 3 || docs[2].Height != block2.Height || docs[2].PrevCID != "cid1" {
+		t.Errorf("published documents after the reconnect %+v, want block %v linked to cid1", docs, block2.Height)
+	}
+	ab, err := d.GetArchivedBlock(block2.Height)
+	if err != nil || ab == nil || ab.CID != "cid3" {
+		t.Errorf("GetArchivedBlock() of the reconnected block = %+v, %v, want cid3", ab, err)
+	}
+}
+
+func TestArchiver_RunClose(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	block1 := dbtestdata.GetTestUTXOBlock1(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	ipfs := &testIPFS{}
+	ts := httptest.NewServer(ipfs)
+	defer ts.Close()
+	// from is negative, the archiving starts at the best block
+	a := NewArchiver(d, &testArchiveChain{blocks: map[string]*bchain.Block{block1.Hash: block1}}, ts.URL, -1)
+	go a.Run()
+	a.OnNewBlock(block1.Hash, block1.Height)
+	for i := 0; i < 100 && len(ipfs.published()) == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	// Close stops the archiver and can be called repeatedly
+	a.Close()
+	a.Close()
+	if docs := ipfs.published(); len(docs) != 1 || docs[0].Height != block1.Height || docs[0].PrevCID != "" {
+		t.Errorf("published documents %+v, want block %v", docs, block1.Height)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/juju/errors"
 	"github.com/tecbot/gorocksdb"
 )
 
@@ -17,6 +18,18 @@ import (
 type bulkAddresses struct {
 	bi        BlockInfo
 	addresses map[string][]outpoint
+	fees      *BlockFeeStats
+	supply    *BlockSupply
+	burns     []BurnStats
+	largest   []LargestTx
+	silent    []silentPaymentOutput
+	names     []nameOpOutput
+	payIDs    []paymentIDOutputs
+	dustTxs   map[string]uint
+	coinjoins map[string]*CoinjoinTx
+	templates map[string][]outpoint
+	rewards   map[string][]byte
+	scripts   map[string][]byte
 }
 
 // BulkConnect is used to connect blocks in bulk, faster but if interrupted inconsistent way
@@ -27,28 +40,53 @@ type BulkConnect struct {
 	bulkAddressesCount int
 	txAddressesMap     map[string]*TxAddresses
 	balances           map[string]*AddrBalance
+	ordinals           *ordinalsUpdate
+	burnTotals         burnsUpdate
+	holding            holdingUpdate
+	supply             *BlockSupply
 	height             uint32
+	// limits of the data kept in memory, given by the memory profile
+	maxBulkAddresses      int
+	maxBulkTxAddresses    int
+	partialStoreAddresses int
+	maxBulkBalances       int
+	partialStoreBalances  int
 }
 
-const (
-	maxBulkAddresses      = 200000
-	maxBulkTxAddresses    = 500000
-	partialStoreAddresses = maxBulkTxAddresses / 10
-	maxBulkBalances       = 800000
-	partialStoreBalances  = maxBulkBalances / 10
-)
+// ErrBulkConnectIndexDelta is returned by InitBulkConnect if the index delta is enabled,
+// the bulk connect writes the data of many blocks together and cannot record the write sets of the blocks
+var ErrBulkConnectIndexDelta = errors.New("Bulk connect is not possible with the index delta enabled")
 
 // InitBulkConnect initializes bulk connect and switches DB to inconsistent state
 func (d *RocksDB) InitBulkConnect() (*BulkConnect, error) {
+	if d.indexDeltaBlocks > 0 {
+		return nil, ErrBulkConnectIndexDelta
+	}
 	bc := &BulkConnect{
-		d:              d,
-		isUTXO:         d.chainParser.IsUTXOChain(),
-		txAddressesMap: make(map[string]*TxAddresses),
-		balances:       make(map[string]*AddrBalance),
+		d:                     d,
+		isUTXO:                d.chainParser.IsUTXOChain(),
+		txAddressesMap:        make(map[string]*TxAddresses),
+		balances:              make(map[string]*AddrBalance),
+		ordinals:              newOrdinalsUpdate(),
+		burnTotals:            make(burnsUpdate),
+		holding:               make(holdingUpdate),
+		maxBulkAddresses:      memoryProfile.MaxBulkAddresses,
+		maxBulkTxAddresses:    memoryProfile.MaxBulkTxAddresses,
+		partialStoreAddresses: memoryProfile.MaxBulkTxAddresses / 10,
+		maxBulkBalances:       memoryProfile.MaxBulkBalances,
+		partialStoreBalances:  memoryProfile.MaxBulkBalances / 10,
 	}
 	if err := d.SetInconsistentState(true); err != nil {
 		return nil, err
 	}
+	// bulk connect keeps its own map of txAddresses and writes them to db in batches, the cache would get stale
+	d.txAddressesCache.purge()
+	// the supply changes of the blocks of the bulk continue from the last block in the db, b.supply is kept in memory
+	// in place of d.lastSupply, which is set by Close
+	d.lastSupply = nil
+	// the spent watched outpoints and the activity of watched addresses are collected over the blocks of the bulk until they are written
+	d.clearWatchedOutpointsSpent()
+	d.clearWatchedAddressActivity()
 	glog.Info("rocksdb: bulk connect init, db set to inconsistent state")
 	return bc, nil
 }
@@ -77,11 +115,11 @@ func (b *BulkConnect) storeTxAddresses(wb *gorocksdb.WriteBatch, all bool) (int,
 		}
 		sp = len(txm)
 		// store some other random transactions if necessary
-		if len(txm) < partialStoreAddresses {
+		if len(txm) < b.partialStoreAddresses {
 			for k, a := range b.txAddressesMap {
 				txm[k] = a
 				delete(b.txAddressesMap, k)
-				if len(txm) >= partialStoreAddresses {
+				if len(txm) >= b.partialStoreAddresses {
 					break
 				}
 			}
@@ -122,7 +160,7 @@ func (b *BulkConnect) storeBalances(wb *gorocksdb.WriteBatch, all bool) (int, er
 		for k, a := range b.balances {
 			bal[k] = a
 			delete(b.balances, k)
-			if len(bal) >= partialStoreBalances {
+			if len(bal) >= b.partialStoreBalances {
 				break
 			}
 		}
@@ -159,53 +197,158 @@ func (b *BulkConnect) storeBulkAddresses(wb *gorocksdb.WriteBatch) error {
 		if err := b.d.writeHeight(wb, ba.bi.Height, &ba.bi, opInsert); err != nil {
 			return err
 		}
+		if err := b.d.storeBlockFeeStats(wb, ba.fees); err != nil {
+			return err
+		}
+		b.d.storeBlockSupply(wb, ba.supply)
+		b.d.storeBlockBurns(wb, ba.bi.Height, ba.burns)
+		if err := b.d.storeLargestTxs(wb, ba.bi.Height, ba.largest); err != nil {
+			return err
+		}
+		b.d.storeSilentPayments(wb, ba.silent)
+		b.d.storeNameOps(wb, ba.names)
+		b.d.storePaymentIDs(wb, ba.payIDs)
+		if err := b.d.storeDustTxs(wb, ba.dustTxs); err != nil {
+			return err
+		}
+		b.d.storeCoinjoinTxs(wb, ba.coinjoins)
+		if err := b.d.storeScriptTemplateOutpoints(wb, ba.bi.Height, ba.templates); err != nil {
+			return err
+		}
+		if err := b.d.storeRewards(wb, ba.rewards); err != nil {
+			return err
+		}
+		if err := b.d.storeScriptAnnotations(wb, ba.scripts); err != nil {
+			return err
+		}
+	}
+	// the inscriptions, the burn totals and the holding stats are modified across the blocks, they are kept in one update stored together with the addresses
+	if err := b.d.storeOrdinals(wb, b.ordinals); err != nil {
+		return err
+	}
+	b.ordinals = newOrdinalsUpdate()
+	b.d.storeBurnTotals(wb, b.burnTotals)
+	b.burnTotals = make(burnsUpdate)
+	b.d.storeHoldingStats(wb, b.holding)
+	b.holding = make(holdingUpdate)
+	if err := b.d.storeAmountAnomalies(wb); err != nil {
+		return err
 	}
 	b.bulkAddressesCount = 0
 	b.bulkAddresses = b.bulkAddresses[:0]
 	return nil
 }
 
+// blockTime returns the time of the block from the bulk not yet stored or from the db
+func (b *BulkConnect) blockTime(height uint32) (int64, bool, error) {
+	if n := len(b.bulkAddresses); n > 0 {
+		first := b.bulkAddresses[0].bi.Height
+		if height >= first && height-first < uint32(n) {
+			return b.bulkAddresses[height-first].bi.Time, true, nil
+		}
+	}
+	return b.d.dbBlockTime(height)
+}
+
+// computeBlockSupply computes the supply change of the block with the totals continuing from the previous block of the bulk,
+// the supply changes of the blocks of the bulk may not be written yet; nil if the supply changes are not recorded
+func (b *BulkConnect) computeBlockSupply(block *bchain.Block) (*BlockSupply, error) {
+	if !b.d.blockSupply {
+		return nil, nil
+	}
+	prev := b.supply
+	if prev == nil || prev.Height >= block.Height {
+		var err error
+		if prev, err = b.d.prevBlockSupply(block.Height); err != nil {
+			return nil, err
+		}
+	}
+	b.supply = b.d.computeBlockSupply(block, b.txAddressesMap, prev)
+	return b.supply, nil
+}
+
 // ConnectBlock connects block in bulk mode
-func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) error {
+func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) (err error) {
 	b.height = block.Height
 	if !b.isUTXO {
 		return b.d.ConnectBlock(block)
 	}
+	defer func(start time.Time) {
+		if err == nil {
+			b.d.observeConnectBlockStats(block.Height, time.Since(start))
+		}
+	}(time.Now())
 	addresses := make(map[string][]outpoint)
 	if err := b.d.processAddressesUTXO(block, addresses, b.txAddressesMap, b.balances); err != nil {
 		return err
 	}
+	b.d.checkWatchedAddresses(block.Height, addresses)
+	b.d.checkMultisigWallets(block, addresses)
+	// compute the fees, supply, silent payments, inscriptions, dust and coinjoin txs and script templates before txAddressesMap is modified by the parallel store
+	fees := b.d.computeBlockFeeStats(block, b.txAddressesMap)
+	supply, err := b.computeBlockSupply(block)
+	if err != nil {
+		return err
+	}
+	silent := b.d.computeSilentPayments(block, b.txAddressesMap)
+	if err := b.d.computeOrdinals(block, b.txAddressesMap, b.ordinals); err != nil {
+		return err
+	}
+	burns := b.d.computeBlockBurns(block, b.txAddressesMap)
+	if err := b.d.updateBurnTotals(b.burnTotals, burns, false); err != nil {
+		return err
+	}
+	if err := b.d.computeHoldingTimes(b.holding, block, b.txAddressesMap, cachedBlockTimes(b.blockTime)); err != nil {
+		return err
+	}
+	dustTxs := b.d.computeDustTxs(block, b.txAddressesMap)
+	coinjoins := b.d.computeCoinjoinTxs(block, b.txAddressesMap)
+	templates := b.d.computeScriptTemplateOutpoints(block, b.txAddressesMap)
+	return b.connectBulkAddresses(bulkAddresses{
+		bi:        *blockInfoFromBlock(block),
+		addresses: addresses,
+		fees:      fees,
+		supply:    supply,
+		burns:     burns,
+		largest:   b.d.computeLargestTxs(block),
+		silent:    silent,
+		names:     b.d.computeNameOps(block),
+		payIDs:    b.d.computePaymentIDs(block),
+		dustTxs:   dustTxs,
+		coinjoins: coinjoins,
+		templates: templates,
+		rewards:   b.d.computeRewards(block),
+		scripts:   b.d.computeScriptAnnotations(block),
+	}, block, storeBlockTxs)
+}
+
+// connectBulkAddresses adds the processed block to the bulk and stores the bulk data to db if the limits are exceeded
+// the data of the last blocks are always stored, the block is then needed only for its txids and inputs
+func (b *BulkConnect) connectBulkAddresses(ba bulkAddresses, block *bchain.Block, storeBlockTxs bool) error {
 	var storeAddressesChan, storeBalancesChan chan error
 	var sa bool
-	if len(b.txAddressesMap) > maxBulkTxAddresses || len(b.balances) > maxBulkBalances {
+	if len(b.txAddressesMap) > b.maxBulkTxAddresses || len(b.balances) > b.maxBulkBalances {
 		sa = true
-		if len(b.txAddressesMap)+partialStoreAddresses > maxBulkTxAddresses {
+		if len(b.txAddressesMap)+b.partialStoreAddresses > b.maxBulkTxAddresses {
 			storeAddressesChan = make(chan error)
 			go b.parallelStoreTxAddresses(storeAddressesChan, false)
 		}
-		if len(b.balances)+partialStoreBalances > maxBulkBalances {
+		if len(b.balances)+b.partialStoreBalances > b.maxBulkBalances {
 			storeBalancesChan = make(chan error)
 			go b.parallelStoreBalances(storeBalancesChan, false)
 		}
 	}
-	b.bulkAddresses = append(b.bulkAddresses, bulkAddresses{
-		bi: BlockInfo{
-			Hash:   block.Hash,
-			Time:   block.Time,
-			Txs:    uint32(len(block.Txs)),
-			Size:   uint32(block.Size),
-			Height: block.Height,
-		},
-		addresses: addresses,
-	})
-	b.bulkAddressesCount += len(addresses)
+	b.bulkAddresses = append(b.bulkAddresses, ba)
+	b.bulkAddressesCount += len(ba.addresses)
+	// the blocks are written to the db together with the bulk of addresses
+	storeBlocks := sa || b.bulkAddressesCount > b.maxBulkAddresses
 	// open WriteBatch only if going to write
-	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
+	if storeBlocks || storeBlockTxs {
 		start := time.Now()
 		wb := gorocksdb.NewWriteBatch()
 		defer wb.Destroy()
 		bac := b.bulkAddressesCount
-		if sa || b.bulkAddressesCount > maxBulkAddresses {
+		if storeBlocks {
 			if err := b.storeBulkAddresses(wb); err != nil {
 				return err
 			}
@@ -215,7 +358,9 @@ func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) erro
 				return err
 			}
 		}
-		if err := b.d.db.Write(b.d.wo, wb); err != nil {
+		err := b.d.db.Write(b.d.wo, wb)
+		b.d.invalidateBestBlock()
+		if err != nil {
 			return err
 		}
 		if bac > b.bulkAddressesCount {
@@ -232,6 +377,17 @@ func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) erro
 			return err
 		}
 	}
+	if sa || storeBlockTxs {
+		// the stored data were released
+		freeOSMemory()
+	}
+	if storeBlocks {
+		// the spent watched outpoints, the activity of watched addresses and the events of the multisig wallets
+		// of all blocks of the bulk are notified after the blocks are written
+		b.d.notifyWatchedOutpointsSpent()
+		b.d.notifyWatchedAddressActivity()
+		b.d.notifyMultisigEvents()
+	}
 	return nil
 }
 
@@ -250,9 +406,12 @@ func (b *BulkConnect) Close() error {
 	if err := b.storeBulkAddresses(wb); err != nil {
 		return err
 	}
-	if err := b.d.db.Write(b.d.wo, wb); err != nil {
+	err := b.d.db.Write(b.d.wo, wb)
+	b.d.invalidateBestBlock()
+	if err != nil {
 		return err
 	}
+	b.d.lastSupply = b.supply
 	glog.Info("rocksdb: height ", b.height, ", stored ", bac, " addresses, done in ", time.Since(start))
 	if err := <-storeAddressesChan; err != nil {
 		return err
@@ -263,6 +422,9 @@ func (b *BulkConnect) Close() error {
 	if err := b.d.SetInconsistentState(false); err != nil {
 		return err
 	}
+	b.d.notifyWatchedOutpointsSpent()
+	b.d.notifyWatchedAddressActivity()
+	b.d.notifyMultisigEvents()
 	glog.Info("rocksdb: bulk connect closed, db set to open state")
 	b.d = nil
 	return nil
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// BurnStats is the aggregate of the burned outputs paying to the burn address AddrDesc,
+// the empty AddrDesc stands for the provably unspendable outputs (OP_RETURN etc.)
+type BurnStats struct {
+	AddrDesc  bchain.AddressDescriptor
+	Outputs   uint64
+	BurnedSat big.Int
+}
+
+// BurnTotals is the cumulative burned supply of the indexed blocks, Unspendable are the provably unspendable outputs,
+// Addresses are the outputs to the known burn addresses ordered by the address descriptor
+type BurnTotals struct {
+	Outputs     uint64
+	BurnedSat   big.Int
+	Unspendable BurnStats
+	Addresses   []BurnStats
+}
+
+// burnsUpdate contains the modified burn totals keyed by the address descriptor before they are stored,
+// the totals with zero outputs are deleted
+type burnsUpdate map[string]*BurnStats
+
+// SetBurns enables the indexing of the burned outputs during block connect, the unspendable outputs and the outputs
+// to the burn addresses set by SetBurnAddresses are counted from the block connected after it was enabled
+func (d *RocksDB) SetBurns(enabled bool) {
+	d.burns = enabled
+}
+
+// BurnsEnabled returns true if the burned outputs are indexed
+func (d *RocksDB) BurnsEnabled() bool {
+	return d.burns
+}
+
+// SetBurnAddresses sets the known burn addresses, the outputs to them are counted as burned in addition to the unspendable outputs
+// the burns are computed during block connect, the change of the addresses does not affect the already indexed blocks
+func (d *RocksDB) SetBurnAddresses(addrDescs []bchain.AddressDescriptor) {
+	d.burnAddresses = make(map[string]struct{}, len(addrDescs))
+	for _, ad := range addrDescs {
+		d.burnAddresses[string(ad)] = struct{}{}
+	}
+}
+
+// computeBlockBurns returns the burned outputs of the block aggregated by the burn address ordered by the address descriptor,
+// nil if the burns are not indexed; it must be called after processAddressesUTXO, the addrDescs of the outputs are taken from
+// the txAddressesMap, which keeps also the outputs not indexed by the index filter, only the outputs without the stored addrDesc
+// are parsed again from the block transactions
+func (d *RocksDB) computeBlockBurns(block *bchain.Block, txAddressesMap map[string]*TxAddresses) []BurnStats {
+	if !d.burns {
+		return nil
+	}
+	burns := make(map[string]*BurnStats)
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		var ta *TxAddresses
+		if btxID, err := d.chainParser.PackTxid(tx.Txid); err == nil {
+			ta = txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))]
+		}
+		for j := range tx.Vout {
+			vout := &tx.Vout[j]
+			var addrDesc bchain.AddressDescriptor
+			if ta != nil && j < len(ta.Outputs) {
+				addrDesc = ta.Outputs[j].AddrDesc
+			}
+			if len(addrDesc) == 0 {
+				var err error
+				if addrDesc, err = d.chainParser.GetAddrDescFromVout(vout); err != nil || len(addrDesc) == 0 {
+					continue
+				}
+			}
+			var key string
+			if !d.chainParser.IsAddrDescUnspendable(addrDesc) {
+				if _, found := d.burnAddresses[string(addrDesc)]; !found {
+					continue
+				}
+				key = string(addrDesc)
+			}
+			bs := burns[key]
+			if bs == nil {
+				bs = &BurnStats{AddrDesc: bchain.AddressDescriptor(key)}
+				burns[key] = bs
+			}
+			bs.Outputs++
+			bs.BurnedSat.Add(&bs.BurnedSat, &vout.ValueSat)
+		}
+	}
+	r := make([]BurnStats, 0, len(burns))
+	for _, bs := range burns {
+		r = append(r, *bs)
+	}
+	sort.Slice(r, func(i, j int) bool { return string(r[i].AddrDesc) < string(r[j].AddrDesc) })
+	return r
+}
+
+func appendBurnStats(buf []byte, bs *BurnStats) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(bs.Outputs), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packBigint(&bs.BurnedSat, varBuf)
+	return append(buf, varBuf[:l]...)
+}
+
+func unpackBurnStats(buf []byte, bs *BurnStats) (int, error) {
+	o, l := unpackVaruint(buf)
+	if l <= 0 || l >= len(buf) || l+1+int(buf[l]) > len(buf) {
+		return 0, errors.New("Invalid packed burn stats")
+	}
+	bs.Outputs = uint64(o)
+	var ll int
+	bs.BurnedSat, ll = unpackBigint(buf[l:])
+	return l + ll, nil
+}
+
+func packBlockBurns(burns []BurnStats) []byte {
+	varBuf := make([]byte, vlq.MaxLen32)
+	l := packVaruint(uint(len(burns)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	for i := range burns {
+		buf = packString(string(burns[i].AddrDesc), buf)
+		buf = appendBurnStats(buf, &burns[i])
+	}
+	return buf
+}
+
+func unpackBlockBurns(buf []byte) ([]BurnStats, error) {
+	n, l := unpackVaruint(buf)
+	if l <= 0 || int(n) > len(buf) {
+		return nil, errors.New("Invalid packed block burns")
+	}
+	burns := make([]BurnStats, n)
+	for i := range burns {
+		ad, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, err
+		}
+		burns[i].AddrDesc = bchain.AddressDescriptor(ad)
+		l += ll
+		if ll, err = unpackBurnStats(buf[l:], &burns[i]); err != nil {
+			return nil, err
+		}
+		l += ll
+	}
+	if l != len(buf) {
+		return nil, errors.New("Invalid packed block burns")
+	}
+	return burns, nil
+}
+
+func (d *RocksDB) storeBlockBurns(wb *gorocksdb.WriteBatch, height uint32, burns []BurnStats) {
+	if len(burns) > 0 {
+		wb.PutCF(d.cfh[cfBlockBurns], packUint(height), packBlockBurns(burns))
+	}
+}
+
+// getBlockBurns returns the burned outputs of the block stored in the db
+func (d *RocksDB) getBlockBurns(height uint32) ([]BurnStats, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfBlockBurns], packUint(height))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	return unpackBlockBurns(val.Data())
+}
+
+// getBurnStatsForUpdate returns the burn totals of the address descriptor key from the pending update,
+// the totals not yet in the update are read from the db and added to it
+func (d *RocksDB) getBurnStatsForUpdate(u burnsUpdate, key string) (*BurnStats, error) {
+	if bs, found := u[key]; found {
+		return bs, nil
+	}
+	bs := &BurnStats{AddrDesc: bchain.AddressDescriptor(key)}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfBurnTotals], []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) > 0 {
+		if _, err := unpackBurnStats(val.Data(), bs); err != nil {
+			return nil, err
+		}
+	}
+	u[key] = bs
+	return bs, nil
+}
+
+// updateBurnTotals adds the burns of a connected block to the totals or subtracts the burns of a disconnected block
+func (d *RocksDB) updateBurnTotals(u burnsUpdate, burns []BurnStats, disconnect bool) error {
+	for i := range burns {
+		b := &burns[i]
+		bs, err := d.getBurnStatsForUpdate(u, string(b.AddrDesc))
+		if err != nil {
+			return err
+		}
+		if disconnect {
+			if bs.Outputs < b.Outputs || bs.BurnedSat.Cmp(&b.BurnedSat) < 0 {
+				return errors.Errorf("Burn totals of %s lower than the disconnected burns", b.AddrDesc)
+			}
+			bs.Outputs -= b.Outputs
+			bs.BurnedSat.Sub(&bs.BurnedSat, &b.BurnedSat)
+		} else {
+			bs.Outputs += b.Outputs
+			bs.BurnedSat.Add(&bs.BurnedSat, &b.BurnedSat)
+		}
+	}
+	return nil
+}
+
+// storeBurnTotals writes the pending update of the burn totals to the write batch
+func (d *RocksDB) storeBurnTotals(wb *gorocksdb.WriteBatch, u burnsUpdate) {
+	for key, bs := range u {
+		if bs.Outputs == 0 {
+			wb.DeleteCF(d.cfh[cfBurnTotals], []byte(key))
+		} else {
+			wb.PutCF(d.cfh[cfBurnTotals], []byte(key), appendBurnStats(nil, bs))
+		}
+	}
+}
+
+// disconnectBlockBurns subtracts the burns of the blocks lower..higher from the totals and deletes them
+func (d *RocksDB) disconnectBlockBurns(wb *gorocksdb.WriteBatch, lower uint32, higher uint32) error {
+	u := make(burnsUpdate)
+	for height := lower; height <= higher; height++ {
+		burns, err := d.getBlockBurns(height)
+		if err != nil {
+			return errors.Annotatef(err, "height %v", height)
+		}
+		if err := d.updateBurnTotals(u, burns, true); err != nil {
+			return errors.Annotatef(err, "height %v", height)
+		}
+	}
+	d.storeBurnTotals(wb, u)
+	d.deleteHeightRange(wb, cfBlockBurns, nil, lower, higher)
+	return nil
+}
+
+// GetBurnTotals returns the cumulative burned supply of the indexed blocks
+func (d *RocksDB) GetBurnTotals() (r *BurnTotals, err error) {
+	defer func(s time.Time) { d.observeMethod("GetBurnTotals", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	r = &BurnTotals{}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBurnTotals])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		bs := BurnStats{AddrDesc: append(bchain.AddressDescriptor(nil), it.Key().Data()...)}
+		if _, err = unpackBurnStats(it.Value().Data(), &bs); err != nil {
+			return nil, errors.Annotatef(err, "burn totals %x", bs.AddrDesc)
+		}
+		r.Outputs += bs.Outputs
+		r.BurnedSat.Add(&r.BurnedSat, &bs.BurnedSat)
+		if len(bs.AddrDesc) == 0 {
+			r.Unspendable = bs
+		} else {
+			r.Addresses = append(r.Addresses, bs)
+		}
+	}
+	return r, nil
+}
+
+// GetAddrDescBurns returns the cumulative burned outputs to the burn address, nil if nothing was burned to it
+func (d *RocksDB) GetAddrDescBurns(addrDesc bchain.AddressDescriptor) (r *BurnStats, err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescBurns", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	if len(addrDesc) == 0 {
+		return nil, nil
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfBurnTotals], addrDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	r = &BurnStats{AddrDesc: addrDesc}
+	if _, err = unpackBurnStats(val.Data(), r); err != nil {
+		return nil, errors.Annotatef(err, "burn totals %x", addrDesc)
+	}
+	return r, nil
+}
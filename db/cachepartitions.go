@@ -0,0 +1,109 @@
+package db
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// cachePartitions are the ratios of the rocksdb cache given to the own LRU caches of the columns,
+// the rest of the cache is shared by the other columns
+var cachePartitions map[string]float64
+
+// ParseCachePartitions parses the comma separated list of <column>=<ratio of the cache>, the sum of the ratios must be lower than 1
+func ParseCachePartitions(s string) (map[string]float64, error) {
+	columns := make(map[string]bool, len(cfNames))
+	for _, n := range cfNames {
+		columns[n] = true
+	}
+	p := make(map[string]float64)
+	var sum float64
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("Invalid cache partition '%v', expecting <column>=<ratio>", e)
+		}
+		name := strings.TrimSpace(kv[0])
+		if !columns[name] {
+			return nil, errors.Errorf("Unknown column '%v'", name)
+		}
+		if _, found := p[name]; found {
+			return nil, errors.Errorf("Duplicate column '%v'", name)
+		}
+		r, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || r <= 0 || r >= 1 {
+			return nil, errors.Errorf("Invalid ratio '%v' of column '%v'", kv[1], name)
+		}
+		p[name] = r
+		sum += r
+	}
+	if len(p) == 0 {
+		return nil, errors.New("Missing cache partition")
+	}
+	if sum >= 1 {
+		return nil, errors.Errorf("The sum of the ratios %v must be lower than 1, the rest of the cache is shared by the other columns", sum)
+	}
+	return p, nil
+}
+
+// SetCachePartitions sets the own caches of the columns, it must be called before the db is opened
+func SetCachePartitions(p map[string]float64) {
+	cachePartitions = p
+	names := make([]string, 0, len(p))
+	for n := range p {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		glog.Infof("rocksdb: column %v uses own cache, %v of the cache size", n, p[n])
+	}
+}
+
+// blockCaches are the LRU block caches of the db, the columns without own cache (nil in columns) use the shared cache
+type blockCaches struct {
+	shared  *gorocksdb.Cache
+	columns []*gorocksdb.Cache
+}
+
+// newBlockCaches splits cacheSize to the own caches of the columns given by cachePartitions and to the shared cache
+func newBlockCaches(cacheSize int) *blockCaches {
+	c := &blockCaches{columns: make([]*gorocksdb.Cache, len(cfNames))}
+	shared := cacheSize
+	for i, n := range cfNames {
+		if r := cachePartitions[n]; r > 0 {
+			size := int(float64(cacheSize) * r)
+			c.columns[i] = gorocksdb.NewLRUCache(size)
+			shared -= size
+		}
+	}
+	c.shared = gorocksdb.NewLRUCache(shared)
+	return c
+}
+
+// column returns the cache used by the column
+func (c *blockCaches) column(cf int) *gorocksdb.Cache {
+	if c.columns[cf] != nil {
+		return c.columns[cf]
+	}
+	return c.shared
+}
+
+// usage returns the total usage and the pinned usage of all caches
+func (c *blockCaches) usage() (usage int, pinned int) {
+	usage, pinned = c.shared.GetUsage(), c.shared.GetPinnedUsage()
+	for _, cc := range c.columns {
+		if cc != nil {
+			usage += cc.GetUsage()
+			pinned += cc.GetPinnedUsage()
+		}
+	}
+	return usage, pinned
+}
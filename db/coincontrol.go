@@ -0,0 +1,121 @@
+package db
+
+import (
+	"bytes"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// CoinControl is the label and the freeze flag of an unspent output set by the user of a wallet,
+// the frozen outputs are meant to be excluded from the coin selection of the wallet
+type CoinControl struct {
+	Txid   string `json:"txid"`
+	Vout   uint32 `json:"vout"`
+	Label  string `json:"label,omitempty"`
+	Frozen bool   `json:"frozen"`
+}
+
+const coinControlFrozen = byte(1)
+
+func (d *RocksDB) packCoinControlKey(wallet string, txid string, vout uint32) ([]byte, error) {
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	key := append(packString(wallet, nil), btxID...)
+	varBuf := make([]byte, vlq.MaxLen32)
+	l := packVaruint(uint(vout), varBuf)
+	return append(key, varBuf[:l]...), nil
+}
+
+func (d *RocksDB) unpackCoinControlKey(key []byte, cc *CoinControl) error {
+	_, l, err := unpackString(key)
+	if err != nil {
+		return err
+	}
+	pl := d.chainParser.PackedTxidLen()
+	if len(key) < l+pl+1 {
+		return errors.New("Invalid coin control key")
+	}
+	if cc.Txid, err = d.chainParser.UnpackTxid(key[l : l+pl]); err != nil {
+		return err
+	}
+	vout, ll := unpackVaruint(key[l+pl:])
+	if ll <= 0 {
+		return errors.New("Invalid coin control key")
+	}
+	cc.Vout = uint32(vout)
+	return nil
+}
+
+func packCoinControl(cc *CoinControl) []byte {
+	var flags byte
+	if cc.Frozen {
+		flags |= coinControlFrozen
+	}
+	return packString(cc.Label, []byte{flags})
+}
+
+func unpackCoinControl(buf []byte) (*CoinControl, error) {
+	if len(buf) < 2 {
+		return nil, errors.New("Invalid packed coin control")
+	}
+	cc := &CoinControl{Frozen: buf[0]&coinControlFrozen != 0}
+	var err error
+	if cc.Label, _, err = unpackString(buf[1:]); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// SetCoinControl stores the coin control data of the outputs of the wallet in one write,
+// the data of an output without a label which is not frozen are removed
+func (d *RocksDB) SetCoinControl(wallet string, ccs []CoinControl) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for i := range ccs {
+		key, err := d.packCoinControlKey(wallet, ccs[i].Txid, ccs[i].Vout)
+		if err != nil {
+			return errors.Annotatef(err, "txid %v", ccs[i].Txid)
+		}
+		if ccs[i].Label == "" && !ccs[i].Frozen {
+			wb.DeleteCF(d.cfh[cfCoinControl], key)
+		} else {
+			wb.PutCF(d.cfh[cfCoinControl], key, packCoinControl(&ccs[i]))
+		}
+	}
+	return d.db.Write(d.wo, wb)
+}
+
+// GetCoinControl returns the coin control data of all outputs of the wallet
+func (d *RocksDB) GetCoinControl(wallet string) ([]CoinControl, error) {
+	if err := d.enterHandle(); err != nil {
+		return nil, err
+	}
+	defer d.releaseHandle()
+	r := []CoinControl{}
+	prefix := packString(wallet, nil)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfCoinControl])
+	defer it.Close()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		cc, err := unpackCoinControl(it.Value().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "coin control %x", key)
+		}
+		if err = d.unpackCoinControlKey(key, cc); err != nil {
+			return nil, errors.Annotatef(err, "coin control %x", key)
+		}
+		r = append(r, *cc)
+	}
+	return r, nil
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"math/big"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// CoinjoinType is the pattern of the coinjoin transaction
+type CoinjoinType byte
+
+const (
+	// CoinjoinGeneric is a transaction with equal outputs to distinct addresses funded by at least as many inputs
+	CoinjoinGeneric = CoinjoinType(1)
+	// CoinjoinWhirlpool is a mix of the Whirlpool coordinator, 5 inputs and 5 equal outputs of a pool denomination
+	CoinjoinWhirlpool = CoinjoinType(2)
+	// CoinjoinWasabi is a large coinjoin with at least coinjoinWasabiMinOutputs equal outputs, typical of the Wasabi coordinator
+	CoinjoinWasabi = CoinjoinType(3)
+)
+
+func (t CoinjoinType) String() string {
+	switch t {
+	case CoinjoinWhirlpool:
+		return "whirlpool"
+	case CoinjoinWasabi:
+		return "wasabi"
+	}
+	return "coinjoin"
+}
+
+const (
+	coinjoinWhirlpoolOutputs = 5
+	coinjoinWasabiMinOutputs = 10
+)
+
+// coinjoinWhirlpoolPools are the denominations of the Whirlpool pools in satoshi
+var coinjoinWhirlpoolPools = []int64{100000, 1000000, 5000000, 50000000}
+
+// CoinjoinFilter describes the heuristic used to detect the coinjoin transactions: transaction with at least MinEqualOutputs
+// outputs of the same value, each paying to a distinct address, and with at least as many inputs, is tagged as a coinjoin
+type CoinjoinFilter struct {
+	MinEqualOutputs int
+}
+
+// CoinjoinTx is the tag of the coinjoin transaction, Denomination is the value of the equal outputs
+type CoinjoinTx struct {
+	Type            CoinjoinType
+	EqualOutputs    uint
+	DenominationSat big.Int
+}
+
+// SetCoinjoinFilter enables tagging of coinjoin transactions during block connect, nil disables it
+func (d *RocksDB) SetCoinjoinFilter(f *CoinjoinFilter) {
+	d.coinjoin = f
+}
+
+// CoinjoinEnabled returns true if the coinjoin transactions are tagged, otherwise the column is not read
+// by the apis, because it is not filled and a lookup of each transaction of the history would be wasted
+func (d *RocksDB) CoinjoinEnabled() bool {
+	return d.coinjoin != nil
+}
+
+// classifyCoinjoin returns the tag of the transaction with the number of inputs and the outputs or nil if it is not a coinjoin
+func classifyCoinjoin(inputs int, outputs []TxOutput, minEqualOutputs int) *CoinjoinTx {
+	if len(outputs) < minEqualOutputs || inputs < minEqualOutputs {
+		return nil
+	}
+	// the distinct addresses of the outputs grouped by value
+	values := make(map[string]map[string]struct{})
+	var best string
+	var bestCount int
+	var bestValue big.Int
+	for i := range outputs {
+		o := &outputs[i]
+		if len(o.AddrDesc) == 0 || o.ValueSat.Sign() <= 0 {
+			continue
+		}
+		v := o.ValueSat.String()
+		addrs, found := values[v]
+		if !found {
+			addrs = make(map[string]struct{})
+			values[v] = addrs
+		}
+		addrs[string(o.AddrDesc)] = struct{}{}
+		// on tie, the larger value is the denomination, smaller equal outputs are more likely the change
+		if n := len(addrs); n > bestCount || (n == bestCount && o.ValueSat.Cmp(&bestValue) > 0) {
+			best, bestCount = v, n
+			bestValue.Set(&o.ValueSat)
+		}
+	}
+	if best == "" || bestCount < minEqualOutputs || bestCount < 2 || inputs < bestCount {
+		return nil
+	}
+	c := &CoinjoinTx{Type: CoinjoinGeneric, EqualOutputs: uint(bestCount)}
+	c.DenominationSat.Set(&bestValue)
+	if bestCount >= coinjoinWasabiMinOutputs {
+		c.Type = CoinjoinWasabi
+	} else if bestCount == coinjoinWhirlpoolOutputs && inputs == coinjoinWhirlpoolOutputs && len(outputs) == coinjoinWhirlpoolOutputs {
+		for _, p := range coinjoinWhirlpoolPools {
+			if bestValue.IsInt64() && bestValue.Int64() == p {
+				c.Type = CoinjoinWhirlpool
+				break
+			}
+		}
+	}
+	return c
+}
+
+// computeCoinjoinTxs returns map of packed txids of the coinjoin transactions in block to their tags
+// it must be called after processAddressesUTXO, the txAddressesMap must contain the outputs of the block transactions
+func (d *RocksDB) computeCoinjoinTxs(block *bchain.Block, txAddressesMap map[string]*TxAddresses) map[string]*CoinjoinTx {
+	if d.coinjoin == nil || d.coinjoin.MinEqualOutputs <= 0 {
+		return nil
+	}
+	var r map[string]*CoinjoinTx
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		// quick checks before the transaction is looked up
+		if len(tx.Vout) < d.coinjoin.MinEqualOutputs || len(tx.Vin) < d.coinjoin.MinEqualOutputs {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		ta := txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))]
+		if ta == nil {
+			continue
+		}
+		if c := classifyCoinjoin(len(tx.Vin), ta.Outputs, d.coinjoin.MinEqualOutputs); c != nil {
+			if r == nil {
+				r = make(map[string]*CoinjoinTx)
+			}
+			r[string(btxID)] = c
+		}
+	}
+	return r
+}
+
+func packCoinjoinTx(c *CoinjoinTx) []byte {
+	buf := make([]byte, 1+vlq.MaxLen64+maxPackedBigintBytes)
+	buf[0] = byte(c.Type)
+	l := 1 + packVaruint(c.EqualOutputs, buf[1:])
+	l += packBigint(&c.DenominationSat, buf[l:])
+	return buf[:l]
+}
+
+func unpackCoinjoinTx(buf []byte) (*CoinjoinTx, error) {
+	if len(buf) < 3 {
+		return nil, errors.New("Invalid packed coinjoin tx")
+	}
+	c := &CoinjoinTx{Type: CoinjoinType(buf[0])}
+	n, l := unpackVaruint(buf[1:])
+	if l <= 0 || 1+l >= len(buf) {
+		return nil, errors.New("Invalid packed coinjoin tx")
+	}
+	c.EqualOutputs = n
+	c.DenominationSat, _ = unpackBigint(buf[1+l:])
+	return c, nil
+}
+
+func (d *RocksDB) storeCoinjoinTxs(wb *gorocksdb.WriteBatch, coinjoinTxs map[string]*CoinjoinTx) {
+	for btxID, c := range coinjoinTxs {
+		wb.PutCF(d.cfh[cfCoinjoinTxs], []byte(btxID), packCoinjoinTx(c))
+	}
+}
+
+// GetCoinjoinTx returns the tag of the transaction tagged as coinjoin or nil if the transaction is not tagged
+func (d *RocksDB) GetCoinjoinTx(txid string) (c *CoinjoinTx, err error) {
+	defer func(s time.Time) { d.observeMethod("GetCoinjoinTx", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfCoinjoinTxs], btxID)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	if c, err = unpackCoinjoinTx(val.Data()); err != nil {
+		return nil, errors.Annotatef(err, "coinjoin tx %v", txid)
+	}
+	return c, nil
+}
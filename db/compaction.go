@@ -0,0 +1,161 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	// compactionMinDeletes is the number of keys deleted by a disconnect of blocks, from which the affected ranges are compacted
+	compactionMinDeletes = 10000
+	// compactionPrunedBlocks is the number of blocks pruned from the blockTxs column, after which the pruned range is compacted
+	compactionPrunedBlocks = 1000
+)
+
+// compactionRange is a range of keys of a column, the limit is exclusive
+type compactionRange struct {
+	cf    int
+	start []byte
+	limit []byte
+}
+
+// the deleted keys stay in the db as tombstones until they are compacted, the iteration over a range with many tombstones
+// is slow, therefore the ranges affected by large deletes are compacted in background without waiting for rocksdb;
+// only the height keyed ranges are compacted, the keys deleted from the columns keyed by txid or address are spread
+// over the whole column and their compaction would rewrite the whole column
+type compactor struct {
+	mux     sync.Mutex
+	queue   []compactionRange
+	running bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	// pruned is the number of blocks pruned from the blockTxs column since its last compaction
+	pruned int
+}
+
+// heightCompactionRange returns the range of keys prefix+(height uint32) for heights lower..higher
+func heightCompactionRange(cf int, prefix []byte, lower uint32, higher uint32) compactionRange {
+	start, limit := heightRangeKeys(prefix, lower, higher)
+	return compactionRange{cf: cf, start: start, limit: limit}
+}
+
+// scheduleCompaction queues the ranges for compaction and starts the background compaction if it is not running
+func (d *RocksDB) scheduleCompaction(ranges ...compactionRange) {
+	if len(ranges) == 0 {
+		return
+	}
+	c := &d.compaction
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.queue = append(c.queue, ranges...)
+	if d.is != nil {
+		d.is.ScheduledCompactions(len(ranges))
+	}
+	d.startCompactionLocked()
+}
+
+// startCompaction resumes the compaction of the queued ranges after the db was reopened
+func (d *RocksDB) startCompaction() {
+	d.compaction.mux.Lock()
+	defer d.compaction.mux.Unlock()
+	d.startCompactionLocked()
+}
+
+func (d *RocksDB) startCompactionLocked() {
+	c := &d.compaction
+	if c.running || len(c.queue) == 0 || d.db == nil {
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	c.running = true
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		d.compactQueue(stop)
+	}()
+}
+
+// stopCompaction stops the background compaction after the range being compacted and waits for its end,
+// the remaining ranges stay queued, it must be called before the db is closed
+func (d *RocksDB) stopCompaction() {
+	c := &d.compaction
+	c.mux.Lock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	c.mux.Unlock()
+	c.wg.Wait()
+}
+
+// waitForCompaction waits until all queued ranges are compacted
+func (d *RocksDB) waitForCompaction() {
+	d.compaction.wg.Wait()
+}
+
+func (d *RocksDB) compactQueue(stop chan struct{}) {
+	c := &d.compaction
+	for {
+		c.mux.Lock()
+		select {
+		case <-stop:
+			c.running = false
+			c.mux.Unlock()
+			return
+		default:
+		}
+		if len(c.queue) == 0 {
+			c.running = false
+			c.mux.Unlock()
+			return
+		}
+		r := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mux.Unlock()
+		start := time.Now()
+		d.db.CompactRangeCF(d.cfh[r.cf], gorocksdb.Range{Start: r.start, Limit: r.limit})
+		glog.Infof("rocksdb: compacted range %x-%x of column %v in %v", r.start, r.limit, cfNames[r.cf], time.Since(start))
+		if d.is != nil {
+			d.is.FinishedCompaction()
+		}
+	}
+}
+
+// prunedBlockTxs counts the blocks pruned from the blockTxs column and compacts the pruned range of the column
+// when compactionPrunedBlocks blocks were pruned, higher is the highest pruned height
+func (d *RocksDB) prunedBlockTxs(blocks int, higher uint32) {
+	c := &d.compaction
+	c.mux.Lock()
+	c.pruned += blocks
+	compact := c.pruned >= compactionPrunedBlocks
+	if compact {
+		c.pruned = 0
+	}
+	c.mux.Unlock()
+	if compact {
+		d.scheduleCompaction(heightCompactionRange(cfBlockTxs, nil, 0, higher))
+	}
+}
+
+// disconnectedHeightRanges returns the ranges of the height keyed columns deleted by the disconnect of blocks lower..higher
+func (d *RocksDB) disconnectedHeightRanges(lower uint32, higher uint32) []compactionRange {
+	ranges := []compactionRange{
+		heightCompactionRange(cfHeight, nil, lower, higher),
+		heightCompactionRange(cfHeightAddresses, nil, lower, higher),
+		heightCompactionRange(cfArchive, nil, lower, higher),
+		heightCompactionRange(cfIndexDelta, nil, lower, higher),
+		heightCompactionRange(cfIndexHash, nil, lower, higher),
+		heightCompactionRange(cfLargestTxs, nil, lower, higher),
+	}
+	if d.chainParser.IsUTXOChain() {
+		ranges = append(ranges,
+			heightCompactionRange(cfBlockTxs, nil, lower, higher),
+			heightCompactionRange(cfFees, []byte{feesBlockKeyPrefix}, lower, higher),
+			heightCompactionRange(cfBlockSupply, nil, lower, higher))
+	}
+	return ranges
+}
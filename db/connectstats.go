@@ -0,0 +1,89 @@
+package db
+
+import (
+	"blockbook/common"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultConnectBlockStatsWindow is the default number of the blocks in a window of the connect block stats
+const DefaultConnectBlockStatsWindow = 1000
+
+// connectBlockStatsWindow is the open window of the connect block stats, the stats of the window
+// are the difference of the cumulative stats cbs and the stats at the start of the window,
+// duration is the sum of the connect durations of the blocks of the window
+type connectBlockStatsWindow struct {
+	fromHeight uint32
+	toHeight   uint32
+	blocks     int
+	duration   time.Duration
+	startStats connectBlockStats
+}
+
+// SetConnectBlockStatsWindow sets the number of the connected blocks in a window of the connect block stats,
+// 0 sets the default
+func (d *RocksDB) SetConnectBlockStatsWindow(blocks int) {
+	if blocks <= 0 {
+		blocks = DefaultConnectBlockStatsWindow
+	}
+	d.cbsWindowSize = blocks
+}
+
+// addConnectBlockStatsWindow counts the block at height connected in duration to the open window
+// of the connect block stats and finishes the window when it contains the configured number of blocks
+func (d *RocksDB) addConnectBlockStatsWindow(height uint32, duration time.Duration) {
+	w := &d.cbsWindow
+	if w.blocks == 0 {
+		w.fromHeight = height
+	}
+	w.toHeight = height
+	w.blocks++
+	w.duration += duration
+	size := d.cbsWindowSize
+	if size <= 0 {
+		size = DefaultConnectBlockStatsWindow
+	}
+	if w.blocks >= size {
+		d.finishConnectBlockStatsWindow()
+	}
+}
+
+// finishConnectBlockStatsWindow stores the stats of the open window to the internal state and to the metrics
+// and starts a new window
+func (d *RocksDB) finishConnectBlockStatsWindow() {
+	w := &d.cbsWindow
+	if w.blocks == 0 {
+		return
+	}
+	now := time.Now()
+	cbs := common.ConnectBlockStats{
+		FromHeight:          w.fromHeight,
+		ToHeight:            w.toHeight,
+		Blocks:              w.blocks,
+		Finished:            now,
+		DurationMs:          int64(w.duration / time.Millisecond),
+		TxAddressesHit:      d.cbs.txAddressesHit - w.startStats.txAddressesHit,
+		TxAddressesCacheHit: d.cbs.txAddressesCacheHit - w.startStats.txAddressesCacheHit,
+		TxAddressesMiss:     d.cbs.txAddressesMiss - w.startStats.txAddressesMiss,
+		BalancesHit:         d.cbs.balancesHit - w.startStats.balancesHit,
+		BalancesMiss:        d.cbs.balancesMiss - w.startStats.balancesMiss,
+	}
+	glog.Infof("rocksdb: connected blocks %d-%d in %v, txAddresses hit %d, cache hit %d, miss %d, balances hit %d, miss %d",
+		cbs.FromHeight, cbs.ToHeight, w.duration, cbs.TxAddressesHit, cbs.TxAddressesCacheHit, cbs.TxAddressesMiss, cbs.BalancesHit, cbs.BalancesMiss)
+	if d.is != nil {
+		d.is.AddConnectBlockStats(cbs)
+	}
+	if d.metrics != nil {
+		ratio := func(hit, miss int) float64 {
+			if hit+miss == 0 {
+				return 0
+			}
+			return float64(hit) / float64(hit+miss)
+		}
+		d.metrics.ConnectBlockWindow.With(common.Labels{"stat": "msPerBlock"}).Set(float64(cbs.DurationMs) / float64(cbs.Blocks))
+		d.metrics.ConnectBlockWindow.With(common.Labels{"stat": "txAddressesHitRatio"}).Set(ratio(cbs.TxAddressesHit+cbs.TxAddressesCacheHit, cbs.TxAddressesMiss))
+		d.metrics.ConnectBlockWindow.With(common.Labels{"stat": "balancesHitRatio"}).Set(ratio(cbs.BalancesHit, cbs.BalancesMiss))
+	}
+	d.cbsWindow = connectBlockStatsWindow{startStats: d.cbs}
+}
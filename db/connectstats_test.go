@@ -0,0 +1,46 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/common"
+	"testing"
+	"time"
+)
+
+func TestConnectBlockStatsWindow(t *testing.T) {
+	d := &RocksDB{is: &common.InternalState{}}
+	d.SetConnectBlockStatsWindow(2)
+	for h := uint32(10); h < 15; h++ {
+		d.cbs.txAddressesHit += int(h)
+		d.cbs.balancesMiss++
+		d.observeConnectBlockStats(h, time.Duration(h)*time.Millisecond)
+	}
+	got := d.is.GetConnectBlockStats()
+	if len(got) != 2 {
+		t.Fatalf("windows %d, want 2", len(got))
+	}
+	want := []common.ConnectBlockStats{
+		{FromHeight: 10, ToHeight: 11, Blocks: 2, DurationMs: 21, TxAddressesHit: 21, BalancesMiss: 2},
+		{FromHeight: 12, ToHeight: 13, Blocks: 2, DurationMs: 25, TxAddressesHit: 25, BalancesMiss: 2},
+	}
+	for i := range want {
+		g := got[i]
+		g.Finished = want[i].Finished
+		if g != want[i] {
+			t.Errorf("window %d = %+v, want %+v", i, g, want[i])
+		}
+	}
+	// the duration of a window is the sum of the connect durations of its blocks, not the time between the blocks
+	if d.cbsWindow.blocks != 1 || d.cbsWindow.fromHeight != 14 || d.cbsWindow.duration != 14*time.Millisecond {
+		t.Errorf("open window %+v, want block 14", d.cbsWindow)
+	}
+	// only the last windows are kept
+	for i := 0; i < common.MaxConnectBlockStats; i++ {
+		d.is.AddConnectBlockStats(common.ConnectBlockStats{FromHeight: uint32(i)})
+	}
+	got = d.is.GetConnectBlockStats()
+	if len(got) != common.MaxConnectBlockStats || got[0].FromHeight != 0 || got[len(got)-1].FromHeight != common.MaxConnectBlockStats-1 {
+		t.Errorf("kept windows %d, first %d", len(got), got[0].FromHeight)
+	}
+}
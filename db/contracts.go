@@ -0,0 +1,70 @@
+package db
+
+import (
+	"blockbook/bchain"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+)
+
+// AddressContract is the cached flag if the address of account based chain is a contract,
+// Checked is the unix time when the code at the address was read from the backend
+type AddressContract struct {
+	Contract bool
+	Checked  int64
+}
+
+const addressContractFlag = 1
+
+func packAddressContract(c *AddressContract) []byte {
+	buf := make([]byte, 1+vlq.MaxLen64)
+	if c.Contract {
+		buf[0] = addressContractFlag
+	}
+	l := packVaruint(uint(c.Checked), buf[1:])
+	return buf[:1+l]
+}
+
+func unpackAddressContract(buf []byte) (*AddressContract, error) {
+	if len(buf) < 2 {
+		return nil, errors.New("Invalid packed address contract")
+	}
+	checked, l := unpackVaruint(buf[1:])
+	if l <= 0 {
+		return nil, errors.New("Invalid packed address contract")
+	}
+	return &AddressContract{
+		Contract: buf[0]&addressContractFlag != 0,
+		Checked:  int64(checked),
+	}, nil
+}
+
+// GetAddressContract returns the cached contract flag of the address or nil if the address was not checked yet
+func (d *RocksDB) GetAddressContract(addrDesc bchain.AddressDescriptor) (*AddressContract, error) {
+	if err := d.enterHandle(); err != nil {
+		return nil, err
+	}
+	defer d.releaseHandle()
+	val, err := d.db.GetCF(d.ro, d.cfh[cfAddressContracts], addrDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	c, err := unpackAddressContract(val.Data())
+	if err != nil {
+		return nil, errors.Annotatef(err, "address contract %x", []byte(addrDesc))
+	}
+	return c, nil
+}
+
+// StoreAddressContract stores the contract flag of the address to the cache
+func (d *RocksDB) StoreAddressContract(addrDesc bchain.AddressDescriptor, c *AddressContract) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	return d.db.PutCF(d.wo, d.cfh[cfAddressContracts], addrDesc, packAddressContract(c))
+}
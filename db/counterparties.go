@@ -0,0 +1,171 @@
+package db
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// counterpartySketchPrecision is the number of the bits of the hash selecting the register of the sketch
+	counterpartySketchPrecision = 6
+	// CounterpartySketchRegisters is the number of the registers of the sketch, the standard error of the estimate is 1.04/sqrt(registers), about 13%
+	CounterpartySketchRegisters = 1 << counterpartySketchPrecision
+)
+
+// CounterpartySketch is the HyperLogLog sketch of the distinct counterparties of an address - the senders of the transactions,
+// in which the address receives, and the recipients of the transactions, in which the address sends; the register is the maximum
+// of the positions of the first set bit of the hashes of the counterparties falling into the register
+type CounterpartySketch [CounterpartySketchRegisters]byte
+
+// SetCounterparties enables the sketches of the counterparties of the addresses during the block connect, they are stored
+// with the balances of the addresses and contain only the counterparties of the blocks connected after it was enabled
+func (d *RocksDB) SetCounterparties(enabled bool) {
+	d.counterparties = enabled
+}
+
+// CounterpartiesEnabled returns true if the sketches of the counterparties of the addresses are updated
+func (d *RocksDB) CounterpartiesEnabled() bool {
+	return d.counterparties
+}
+
+// counterpartyHash returns the 64 bit hash of the address descriptor, the fnv hash is mixed by the finalizer of splitmix64,
+// because the sketch needs the bits of the hash uniformly distributed
+func counterpartyHash(addrDesc string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(addrDesc))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// add adds the hash of a counterparty to the sketch
+func (s *CounterpartySketch) add(hash uint64) {
+	i := hash >> (64 - counterpartySketchPrecision)
+	// the guard bit limits the rank if the remaining bits are zero
+	rank := byte(bits.LeadingZeros64(hash<<counterpartySketchPrecision|1<<(counterpartySketchPrecision-1)) + 1)
+	if rank > s[i] {
+		s[i] = rank
+	}
+}
+
+// Estimate returns the estimated number of the distinct counterparties, small numbers are estimated by the linear counting
+func (s *CounterpartySketch) Estimate() uint64 {
+	const m = float64(CounterpartySketchRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, r := range s {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.709 * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(e))
+}
+
+// packCounterpartySketch appends the sketch to buf - the number of the set registers followed by the pairs (index, rank)
+// of the set registers if they are shorter than all registers, otherwise all registers
+func packCounterpartySketch(s *CounterpartySketch, buf []byte) []byte {
+	n := 0
+	for _, r := range s {
+		if r != 0 {
+			n++
+		}
+	}
+	buf = append(buf, byte(n))
+	if 2*n < CounterpartySketchRegisters {
+		for i, r := range s {
+			if r != 0 {
+				buf = append(buf, byte(i), r)
+			}
+		}
+		return buf
+	}
+	return append(buf, s[:]...)
+}
+
+func unpackCounterpartySketch(buf []byte) (*CounterpartySketch, int, error) {
+	invalid := errors.New("Invalid packed counterparty sketch")
+	if len(buf) == 0 || buf[0] > CounterpartySketchRegisters {
+		return nil, 0, invalid
+	}
+	n := int(buf[0])
+	s := &CounterpartySketch{}
+	if 2*n < CounterpartySketchRegisters {
+		if 1+2*n > len(buf) {
+			return nil, 0, invalid
+		}
+		for i := 0; i < n; i++ {
+			idx := buf[1+2*i]
+			if int(idx) >= CounterpartySketchRegisters {
+				return nil, 0, invalid
+			}
+			s[idx] = buf[2+2*i]
+		}
+		return s, 1 + 2*n, nil
+	}
+	if 1+CounterpartySketchRegisters > len(buf) {
+		return nil, 0, invalid
+	}
+	copy(s[:], buf[1:])
+	return s, 1 + CounterpartySketchRegisters, nil
+}
+
+// addCounterparties adds the counterparties of the block transactions to the sketches of the addresses in balances,
+// the counterparties of the sending address are the recipients, of the receiving address the senders, the address itself is skipped;
+// it must be called after the inputs of the transactions are resolved by processTxAddressesUTXO
+func (d *RocksDB) addCounterparties(blockTxAddresses []*TxAddresses, balances map[string]*AddrBalance) {
+	if !d.counterparties {
+		return
+	}
+	distinct := func(addrDescs map[string]uint64, ad []byte) {
+		if len(ad) > 0 {
+			if _, found := addrDescs[string(ad)]; !found {
+				addrDescs[string(ad)] = counterpartyHash(string(ad))
+			}
+		}
+	}
+	for _, ta := range blockTxAddresses {
+		senders := make(map[string]uint64, len(ta.Inputs))
+		for i := range ta.Inputs {
+			distinct(senders, ta.Inputs[i].AddrDesc)
+		}
+		recipients := make(map[string]uint64, len(ta.Outputs))
+		for i := range ta.Outputs {
+			distinct(recipients, ta.Outputs[i].AddrDesc)
+		}
+		update := func(ad string, counterparties map[string]uint64) {
+			ab := balances[ad]
+			if ab == nil {
+				return
+			}
+			for cp, h := range counterparties {
+				if cp == ad {
+					continue
+				}
+				if ab.Counterparties == nil {
+					ab.Counterparties = &CounterpartySketch{}
+				}
+				ab.Counterparties.add(h)
+			}
+		}
+		for ad := range senders {
+			update(ad, recipients)
+		}
+		for ad := range recipients {
+			if _, sending := senders[ad]; !sending {
+				update(ad, senders)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCounterpartySketch(t *testing.T) {
+	var s CounterpartySketch
+	if e := s.Estimate(); e != 0 {
+		t.Errorf("Estimate() of empty sketch = %d, want 0", e)
+	}
+	for _, n := range []int{10, 1000, 100000} {
+		s = CounterpartySketch{}
+		for i := 0; i < n; i++ {
+			h := counterpartyHash(strconv.Itoa(i))
+			s.add(h)
+			// the same counterparty does not change the sketch
+			s.add(h)
+		}
+		e := float64(s.Estimate())
+		if e < 0.7*float64(n) || e > 1.3*float64(n) {
+			t.Errorf("Estimate() of %d counterparties = %v", n, e)
+		}
+		// the dense and the sparse forms are packed
+		packed := packCounterpartySketch(&s, nil)
+		got, l, err := unpackCounterpartySketch(packed)
+		if err != nil || l != len(packed) || !reflect.DeepEqual(*got, s) {
+			t.Errorf("unpackCounterpartySketch() of %d counterparties = %v, %d, %v", n, got, l, err)
+		}
+	}
+	for _, b := range [][]byte{{}, {65}, {2, 1, 1}, {2, 64, 1, 1, 1}, {40, 1}} {
+		if _, _, err := unpackCounterpartySketch(b); err == nil {
+			t.Errorf("unpackCounterpartySketch(%x) expected error", b)
+		}
+	}
+}
+
+func TestRocksDB_Counterparties(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetCounterparties(true)
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		addr string
+		want uint64
+	}{
+		// the outputs of the coinbase like transactions of the first block have no senders
+		{dbtestdata.Addr1, 0},
+		// the address sends to itself
+		{dbtestdata.Addr5, 0},
+		// sends to Addr6 and Addr7
+		{dbtestdata.Addr3, 2},
+		// receives from Addr2 and Addr3, sends to Addr8 and Addr9
+		{dbtestdata.Addr6, 4},
+		// receives from Addr4 and Addr6
+		{dbtestdata.Addr8, 2},
+	} {
+		ab, err := d.GetAddrDescBalance(addressToAddrDesc(tt.addr, d.chainParser))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ab == nil {
+			t.Fatalf("%v: balance not found", tt.addr)
+		}
+		if tt.want == 0 {
+			if ab.Counterparties != nil {
+				t.Errorf("%v: sketch %v, want none", tt.addr, ab.Counterparties)
+			}
+			continue
+		}
+		if ab.Counterparties == nil {
+			t.Errorf("%v: missing sketch", tt.addr)
+		} else if e := ab.Counterparties.Estimate(); e != tt.want {
+			t.Errorf("%v: Estimate() = %d, want %d", tt.addr, e, tt.want)
+		}
+	}
+}
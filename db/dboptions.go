@@ -62,12 +62,17 @@ func createAndSetDBOptions(bloomBits int, c *gorocksdb.Cache, maxOpenFiles int)
 	opts.SetBlockBasedTableFactory(blockOpts)
 	opts.SetCreateIfMissing(true)
 	opts.SetCreateIfMissingColumnFamilies(true)
-	opts.SetMaxBackgroundCompactions(6)
-	opts.SetMaxBackgroundFlushes(6)
-	opts.SetBytesPerSync(8 << 20)         // 8MB
-	opts.SetWriteBufferSize(1 << 27)      // 128MB
-	opts.SetMaxBytesForLevelBase(1 << 27) // 128MB
+	opts.SetMaxBackgroundCompactions(memoryProfile.MaxBackgroundJobs)
+	opts.SetMaxBackgroundFlushes(memoryProfile.MaxBackgroundJobs)
+	opts.SetBytesPerSync(8 << 20) // 8MB
+	opts.SetWriteBufferSize(memoryProfile.WriteBufferSize)
+	// the memtables of all columns share the limit, the number of columns times the column size would be too much
+	opts.SetDbWriteBufferSize(memoryProfile.MaxTotalWriteBufferSize)
+	opts.SetMaxBytesForLevelBase(memoryProfile.MaxBytesForLevelBase)
 	opts.SetMaxOpenFiles(maxOpenFiles)
 	opts.SetCompression(gorocksdb.LZ4HCCompression)
+	if walTTLSeconds > 0 {
+		opts.SetWALTtlSeconds(walTTLSeconds)
+	}
 	return opts
 }
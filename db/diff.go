@@ -0,0 +1,394 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// kinds of the differences found by DiffIndex and DiffBackend
+const (
+	DiffBlock   = "block"
+	DiffTx      = "tx"
+	DiffHistory = "history"
+	DiffBalance = "balance"
+)
+
+// IndexDiff is a difference of the data of the block height between two dbs (A and B) or between the db (A) and the backend (B),
+// Key is the block hash, txid or the address (hex address descriptor if it cannot be converted to address),
+// A and B are the descriptions of the differing data, empty if the data are missing
+type IndexDiff struct {
+	Height uint32 `json:"height"`
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	A      string `json:"a"`
+	B      string `json:"b"`
+}
+
+func describeBlockInfo(bi *BlockInfo) string {
+	if bi == nil {
+		return ""
+	}
+	return fmt.Sprintf("hash %v, txs %d, size %d, time %d", bi.Hash, bi.Txs, bi.Size, bi.Time)
+}
+
+func describeTxAddresses(ta *TxAddresses) string {
+	if ta == nil {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "height %d, inputs [", ta.Height)
+	for i := range ta.Inputs {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%s:%s", hex.EncodeToString(ta.Inputs[i].AddrDesc), ta.Inputs[i].ValueSat.String())
+	}
+	b.WriteString("], outputs [")
+	for i := range ta.Outputs {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%s:%s", hex.EncodeToString(ta.Outputs[i].AddrDesc), ta.Outputs[i].ValueSat.String())
+		if ta.Outputs[i].Spent {
+			b.WriteString(":spent")
+		}
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func describeAddrBalance(ab *AddrBalance) string {
+	if ab == nil {
+		return ""
+	}
+	return fmt.Sprintf("txs %d, sent %v, balance %v, nonce %d", ab.Txs, ab.SentSat.String(), ab.BalanceSat.String(), ab.Nonce)
+}
+
+// addressHistory returns the description of the transactions of the address in the block height and their txids
+func (d *RocksDB) addressHistory(addrDesc bchain.AddressDescriptor, height uint32) (string, []string, error) {
+	var entries, txids []string
+	err := d.GetAddrDescTransactions(addrDesc, height, height, func(txid string, vout uint32, isOutput bool) error {
+		dir := "in"
+		if isOutput {
+			dir = "out"
+		}
+		entries = append(entries, fmt.Sprintf("%s:%s%d", txid, dir, vout))
+		txids = append(txids, txid)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.Join(entries, " "), txids, nil
+}
+
+func (d *RocksDB) diffAddressKey(addrDesc bchain.AddressDescriptor) string {
+	if a, _, err := d.chainParser.GetAddressesFromAddrDesc(addrDesc); err == nil && len(a) == 1 {
+		return a[0]
+	}
+	return hex.EncodeToString(addrDesc)
+}
+
+// blockAddresses returns the sorted addresses touched by the block, the db without the heightAddresses column
+// (version 3) finds them from the transactions of the block kept in the blockTxs column
+func (d *RocksDB) blockAddresses(height uint32) ([]bchain.AddressDescriptor, error) {
+	if d.dataVersion == 0 || d.dataVersion > dbVersionV3 {
+		return d.GetBlockAffectedAddresses(height)
+	}
+	bt, err := d.getBlockTxs(height)
+	if err != nil {
+		return nil, err
+	}
+	if len(bt) == 0 {
+		return nil, errors.Errorf("The addresses of block %d are not known, the db of version %d has no heightAddresses column and the block is not in the blockTxs column", height, d.dataVersion)
+	}
+	set := make(map[string]struct{})
+	for i := range bt {
+		txid, err := d.chainParser.UnpackTxid(bt[i].btxID)
+		if err != nil {
+			return nil, err
+		}
+		ta, err := d.GetTxAddresses(txid)
+		if err != nil {
+			return nil, err
+		}
+		if ta == nil {
+			continue
+		}
+		for j := range ta.Inputs {
+			set[string(ta.Inputs[j].AddrDesc)] = struct{}{}
+		}
+		for j := range ta.Outputs {
+			set[string(ta.Outputs[j].AddrDesc)] = struct{}{}
+		}
+	}
+	delete(set, "")
+	r := make([]bchain.AddressDescriptor, 0, len(set))
+	for ad := range set {
+		r = append(r, bchain.AddressDescriptor(ad))
+	}
+	sort.Slice(r, func(i, j int) bool { return bytes.Compare(r[i], r[j]) < 0 })
+	return r, nil
+}
+
+// mergeAddrDescs returns the sorted union of two sorted lists of address descriptors
+func mergeAddrDescs(a, b []bchain.AddressDescriptor) []bchain.AddressDescriptor {
+	r := make([]bchain.AddressDescriptor, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var c int
+		if i == len(a) {
+			c = 1
+		} else if j == len(b) {
+			c = -1
+		} else {
+			c = bytes.Compare(a[i], b[j])
+		}
+		if c <= 0 {
+			r = append(r, a[i])
+			i++
+			if c == 0 {
+				j++
+			}
+		} else {
+			r = append(r, b[j])
+			j++
+		}
+	}
+	return r
+}
+
+// DiffIndex compares the blocks in the range of heights lower..higher of the db (A) with the db o (B) and calls fn for each difference,
+// the blocks with different hashes (forks) are reported only by the block difference; the addresses touched by the block
+// are compared by their history in the block and, if balances is set, by their current balance (once per address),
+// the transactions of the block are compared by their inputs and outputs; each db is read in the format of its version,
+// so that the dbs of different versions can be compared
+// the iteration stops if fn returns an error, StopIteration error is not returned
+func (d *RocksDB) DiffIndex(o *RocksDB, lower uint32, higher uint32, balances bool, fn func(diff *IndexDiff) error) error {
+	err := d.diffIndex(o, lower, higher, balances, fn)
+	if _, ok := err.(*StopIteration); ok {
+		return nil
+	}
+	return err
+}
+
+func (d *RocksDB) diffIndex(o *RocksDB, lower uint32, higher uint32, balances bool, fn func(diff *IndexDiff) error) error {
+	seen := make(map[string]struct{})
+	for height := lower; height <= higher; height++ {
+		ba, err := d.GetBlockInfo(height)
+		if err != nil {
+			return errors.Annotatef(err, "A GetBlockInfo %v", height)
+		}
+		bb, err := o.GetBlockInfo(height)
+		if err != nil {
+			return errors.Annotatef(err, "B GetBlockInfo %v", height)
+		}
+		if ba == nil && bb == nil {
+			continue
+		}
+		if da, dB := describeBlockInfo(ba), describeBlockInfo(bb); da != dB {
+			key := ""
+			if ba != nil {
+				key = ba.Hash
+			} else {
+				key = bb.Hash
+			}
+			if err = fn(&IndexDiff{Height: height, Kind: DiffBlock, Key: key, A: da, B: dB}); err != nil {
+				return err
+			}
+			if ba == nil || bb == nil || ba.Hash != bb.Hash {
+				continue
+			}
+		}
+		aa, err := d.blockAddresses(height)
+		if err != nil {
+			return errors.Annotatef(err, "A blockAddresses %v", height)
+		}
+		ab, err := o.blockAddresses(height)
+		if err != nil {
+			return errors.Annotatef(err, "B blockAddresses %v", height)
+		}
+		txids := make(map[string]struct{})
+		for _, addrDesc := range mergeAddrDescs(aa, ab) {
+			ha, ta, err := d.addressHistory(addrDesc, height)
+			if err != nil {
+				return errors.Annotatef(err, "A history %v", height)
+			}
+			hb, tb, err := o.addressHistory(addrDesc, height)
+			if err != nil {
+				return errors.Annotatef(err, "B history %v", height)
+			}
+			for _, txid := range append(ta, tb...) {
+				txids[txid] = struct{}{}
+			}
+			if ha != hb {
+				if err = fn(&IndexDiff{Height: height, Kind: DiffHistory, Key: d.diffAddressKey(addrDesc), A: ha, B: hb}); err != nil {
+					return err
+				}
+			}
+			if !balances {
+				continue
+			}
+			if _, found := seen[string(addrDesc)]; found {
+				continue
+			}
+			seen[string(addrDesc)] = struct{}{}
+			bala, err := d.GetAddrDescBalance(addrDesc)
+			if err != nil {
+				return errors.Annotatef(err, "A GetAddrDescBalance %v", height)
+			}
+			balb, err := o.GetAddrDescBalance(addrDesc)
+			if err != nil {
+				return errors.Annotatef(err, "B GetAddrDescBalance %v", height)
+			}
+			if da, dB := describeAddrBalance(bala), describeAddrBalance(balb); da != dB {
+				if err = fn(&IndexDiff{Height: height, Kind: DiffBalance, Key: d.diffAddressKey(addrDesc), A: da, B: dB}); err != nil {
+					return err
+				}
+			}
+		}
+		sorted := make([]string, 0, len(txids))
+		for txid := range txids {
+			sorted = append(sorted, txid)
+		}
+		sort.Strings(sorted)
+		for _, txid := range sorted {
+			ta, err := d.GetTxAddresses(txid)
+			if err != nil {
+				return errors.Annotatef(err, "A GetTxAddresses %v", txid)
+			}
+			tb, err := o.GetTxAddresses(txid)
+			if err != nil {
+				return errors.Annotatef(err, "B GetTxAddresses %v", txid)
+			}
+			if da, dB := describeTxAddresses(ta), describeTxAddresses(tb); da != dB {
+				if err = fn(&IndexDiff{Height: height, Kind: DiffTx, Key: txid, A: da, B: dB}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// DiffBackend compares the blocks in the range of heights lower..higher of the db (A) with the blocks of the backend (B)
+// and calls fn for each difference; the hashes and the numbers of transactions of the blocks, the outputs of the transactions
+// of UTXO chains and the presence of the transactions in the history of the addresses of the outputs are compared
+// the iteration stops if fn returns an error, StopIteration error is not returned
+func (d *RocksDB) DiffBackend(chain bchain.BlockChain, lower uint32, higher uint32, fn func(diff *IndexDiff) error) error {
+	err := d.diffBackend(chain, lower, higher, fn)
+	if _, ok := err.(*StopIteration); ok {
+		return nil
+	}
+	return err
+}
+
+func (d *RocksDB) diffBackend(chain bchain.BlockChain, lower uint32, higher uint32, fn func(diff *IndexDiff) error) error {
+	for height := lower; height <= higher; height++ {
+		bi, err := d.GetBlockInfo(height)
+		if err != nil {
+			return errors.Annotatef(err, "GetBlockInfo %v", height)
+		}
+		hash, err := chain.GetBlockHash(height)
+		if err != nil && err != bchain.ErrBlockNotFound {
+			return errors.Annotatef(err, "GetBlockHash %v", height)
+		}
+		if bi == nil && hash == "" {
+			continue
+		}
+		if bi == nil || bi.Hash != hash {
+			key := hash
+			var dB string
+			if hash != "" {
+				dB = "hash " + hash
+			}
+			if bi != nil {
+				key = bi.Hash
+			}
+			if err = fn(&IndexDiff{Height: height, Kind: DiffBlock, Key: key, A: describeBlockInfo(bi), B: dB}); err != nil {
+				return err
+			}
+			continue
+		}
+		block, err := chain.GetBlock(hash, height)
+		if err != nil {
+			return errors.Annotatef(err, "GetBlock %v", height)
+		}
+		if int(bi.Txs) != len(block.Txs) {
+			if err = fn(&IndexDiff{Height: height, Kind: DiffBlock, Key: hash, A: fmt.Sprintf("txs %d", bi.Txs), B: fmt.Sprintf("txs %d", len(block.Txs))}); err != nil {
+				return err
+			}
+		}
+		if !d.chainParser.IsUTXOChain() {
+			continue
+		}
+		for i := range block.Txs {
+			if err = d.diffBackendTx(&block.Txs[i], height, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *RocksDB) diffBackendTx(tx *bchain.Tx, height uint32, fn func(diff *IndexDiff) error) error {
+	ta, err := d.GetTxAddresses(tx.Txid)
+	if err != nil {
+		return errors.Annotatef(err, "GetTxAddresses %v", tx.Txid)
+	}
+	var outputs []string
+	var history []bchain.AddressDescriptor
+	inHistory := make(map[string]struct{})
+	for i := range tx.Vout {
+		addrDesc, err := d.chainParser.GetAddrDescFromVout(&tx.Vout[i])
+		if err != nil || len(addrDesc) > maxAddrDescLen {
+			// the outputs without address or with too long address descriptor are not indexed, as in processOutputsUTXO
+			addrDesc = nil
+		} else if _, found := inHistory[string(addrDesc)]; !found && len(addrDesc) > 0 && !d.isOutputFiltered(addrDesc, &tx.Vout[i].ValueSat) {
+			// the filtered outputs are in txAddresses with the address, but not in the history of the address
+			inHistory[string(addrDesc)] = struct{}{}
+			history = append(history, addrDesc)
+		}
+		outputs = append(outputs, fmt.Sprintf("%s:%s", hex.EncodeToString(addrDesc), tx.Vout[i].ValueSat.String()))
+	}
+	b := "outputs [" + strings.Join(outputs, " ") + "]"
+	a := ""
+	if ta != nil {
+		outputs = outputs[:0]
+		for i := range ta.Outputs {
+			outputs = append(outputs, fmt.Sprintf("%s:%s", hex.EncodeToString(ta.Outputs[i].AddrDesc), ta.Outputs[i].ValueSat.String()))
+		}
+		a = "outputs [" + strings.Join(outputs, " ") + "]"
+		if ta.Height != height {
+			a = fmt.Sprintf("height %d, %s", ta.Height, a)
+		}
+	}
+	if a != b {
+		return fn(&IndexDiff{Height: height, Kind: DiffTx, Key: tx.Txid, A: a, B: b})
+	}
+	for _, addrDesc := range history {
+		found := false
+		err := d.GetAddrDescTransactions(addrDesc, height, height, func(txid string, vout uint32, isOutput bool) error {
+			if txid == tx.Txid && isOutput {
+				found = true
+				return &StopIteration{}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Annotatef(err, "GetAddrDescTransactions %v", height)
+		}
+		if !found {
+			if err = fn(&IndexDiff{Height: height, Kind: DiffHistory, Key: d.diffAddressKey(addrDesc), B: tx.Txid}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
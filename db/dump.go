@@ -0,0 +1,64 @@
+package db
+
+import (
+	"blockbook/common"
+	"bytes"
+
+	"github.com/juju/errors"
+)
+
+// ColumnNames returns the names of the column families of the db
+func ColumnNames() []string {
+	return append([]string(nil), cfNames...)
+}
+
+func columnIndex(column string) (int, error) {
+	for i, n := range cfNames {
+		if n == column {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("Unknown column '%v'", column)
+}
+
+// ReadInternalState returns the internal state stored in the db without checking or modifying it
+func (d *RocksDB) ReadInternalState() (*common.InternalState, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfDefault], []byte(internalStateKey))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	data := val.Data()
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return common.UnpackInternalState(data)
+}
+
+// DumpColumn calls fn for the raw keys and values of the column starting with prefix, in the order of keys
+// the iteration stops if fn returns false
+func (d *RocksDB) DumpColumn(column string, prefix []byte, fn func(key, value []byte) bool) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	c, err := columnIndex(column)
+	if err != nil {
+		return err
+	}
+	if d.cfh[c] == nil {
+		return errors.Errorf("Column '%v' does not exist in the db", column)
+	}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[c])
+	defer it.Close()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		if !fn(append([]byte(nil), key...), append([]byte(nil), it.Value().Data()...)) {
+			break
+		}
+	}
+	return nil
+}
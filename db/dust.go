@@ -0,0 +1,88 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"math/big"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/tecbot/gorocksdb"
+)
+
+// DustFilter describes the heuristic used to detect dust attack transactions:
+// transaction with at least MinOutputs outputs of value not greater than ThresholdSat,
+// each paying to a distinct address, is tagged as a dust attack
+type DustFilter struct {
+	ThresholdSat big.Int
+	MinOutputs   int
+}
+
+// SetDustFilter enables tagging of dust attack transactions during block connect, nil disables it
+func (d *RocksDB) SetDustFilter(f *DustFilter) {
+	d.dust = f
+}
+
+// computeDustTxs returns map of packed txids of the dust attack transactions in block to the number of their dust outputs
+// it must be called after processAddressesUTXO, the txAddressesMap must contain the block transactions
+func (d *RocksDB) computeDustTxs(block *bchain.Block, txAddressesMap map[string]*TxAddresses) map[string]uint {
+	if d.dust == nil || d.dust.MinOutputs <= 0 {
+		return nil
+	}
+	var r map[string]uint
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		if len(tx.Vout) < d.dust.MinOutputs {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		ta := txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))]
+		if ta == nil {
+			continue
+		}
+		addrs := make(map[string]struct{})
+		for j := range ta.Outputs {
+			o := &ta.Outputs[j]
+			if len(o.AddrDesc) > 0 && o.ValueSat.Cmp(&d.dust.ThresholdSat) <= 0 {
+				addrs[string(o.AddrDesc)] = struct{}{}
+			}
+		}
+		if len(addrs) >= d.dust.MinOutputs {
+			if r == nil {
+				r = make(map[string]uint)
+			}
+			r[string(btxID)] = uint(len(addrs))
+		}
+	}
+	return r
+}
+
+func (d *RocksDB) storeDustTxs(wb *gorocksdb.WriteBatch, dustTxs map[string]uint) error {
+	varBuf := make([]byte, vlq.MaxLen64)
+	for btxID, n := range dustTxs {
+		l := packVaruint(n, varBuf)
+		wb.PutCF(d.cfh[cfDustTxs], []byte(btxID), append([]byte(nil), varBuf[:l]...))
+	}
+	return nil
+}
+
+// IsDustTx returns true if the transaction was tagged as a dust attack
+func (d *RocksDB) IsDustTx(txid string) (dust bool, err error) {
+	defer func(s time.Time) { d.observeMethod("IsDustTx", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return false, err
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfDustTxs], btxID)
+	if err != nil {
+		return false, err
+	}
+	defer val.Free()
+	return val.Size() > 0, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"blockbook/bchain"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+)
+
+// Erc20Contract is the metadata of ERC-20 token contract cached in the db,
+// Fetched is the unix time when the metadata were read from the contract
+type Erc20Contract struct {
+	bchain.Erc20Contract
+	Fetched int64 `json:"fetched"`
+}
+
+func packErc20Contract(c *Erc20Contract) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := make([]byte, 0, 64)
+	l := packVaruint(uint(c.Fetched), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(c.Decimals), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	return packString(c.Symbol, packString(c.Name, packString(c.Contract, buf)))
+}
+
+func unpackErc20Contract(buf []byte) (*Erc20Contract, error) {
+	c := &Erc20Contract{}
+	fetched, l := unpackVaruint(buf)
+	if l <= 0 {
+		return nil, errors.New("Invalid packed erc20 contract")
+	}
+	c.Fetched = int64(fetched)
+	decimals, ll := unpackVaruint(buf[l:])
+	if ll <= 0 {
+		return nil, errors.New("Invalid packed erc20 contract")
+	}
+	c.Decimals = int(decimals)
+	l += ll
+	var err error
+	if c.Contract, ll, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	l += ll
+	if c.Name, ll, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	l += ll
+	if c.Symbol, _, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetErc20Contract returns the cached metadata of ERC-20 token contract or nil if the contract is not cached
+func (d *RocksDB) GetErc20Contract(contractDesc bchain.AddressDescriptor) (*Erc20Contract, error) {
+	if err := d.enterHandle(); err != nil {
+		return nil, err
+	}
+	defer d.releaseHandle()
+	val, err := d.db.GetCF(d.ro, d.cfh[cfErc20Contracts], contractDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	c, err := unpackErc20Contract(val.Data())
+	if err != nil {
+		return nil, errors.Annotatef(err, "erc20 contract %x", []byte(contractDesc))
+	}
+	return c, nil
+}
+
+// StoreErc20Contract stores the metadata of ERC-20 token contract to the cache
+func (d *RocksDB) StoreErc20Contract(contractDesc bchain.AddressDescriptor, c *Erc20Contract) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	return d.db.PutCF(d.wo, d.cfh[cfErc20Contracts], contractDesc, packErc20Contract(c))
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"math/big"
+	"sort"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// FeeRatePercentiles are the percentiles of fee rates stored for each block
+var FeeRatePercentiles = []int{10, 25, 50, 75, 90}
+
+// number of fee estimates stored in the mempool snapshot
+const maxMempoolFeeEstimates = 8
+
+const (
+	feesBlockKeyPrefix   = 'b'
+	feesMempoolKeyPrefix = 'm'
+)
+
+// BlockFeeStats contains aggregated fees of transactions in a block
+// fee rates are in satoshi per 1000 virtual bytes, only transactions with known size are taken into account
+type BlockFeeStats struct {
+	Height       uint32
+	Txs          uint32
+	TotalFeesSat big.Int
+	FeeRates     []uint64
+}
+
+// MempoolSnapshot contains summary of the mempool at given time
+type MempoolSnapshot struct {
+	Time         int64
+	Txs          uint32
+	FeeEstimates []MempoolFeeEstimate
+}
+
+// MempoolFeeEstimate is estimated fee per kilobyte for given confirmation target in blocks
+type MempoolFeeEstimate struct {
+	Blocks uint32
+	FeeSat big.Int
+}
+
+// SetFeeStats enables the computation of the fee stats of the blocks during block connect and the storing of the mempool snapshots,
+// the fee history contains only the blocks connected after it was enabled
+func (d *RocksDB) SetFeeStats(enabled bool) {
+	d.feeStats = enabled
+}
+
+// FeeStatsEnabled returns true if the fee stats of the blocks are computed
+func (d *RocksDB) FeeStatsEnabled() bool {
+	return d.feeStats
+}
+
+// computeBlockFeeStats computes fees of transactions in block from the already processed txAddresses
+// it must be called after processAddressesUTXO, the txAddressesMap must contain the block transactions
+// returns nil if the fee stats are not enabled
+func (d *RocksDB) computeBlockFeeStats(block *bchain.Block, txAddressesMap map[string]*TxAddresses) *BlockFeeStats {
+	if !d.feeStats {
+		return nil
+	}
+	bf := &BlockFeeStats{Height: block.Height}
+	rates := make([]uint64, 0, len(block.Txs))
+	var in, out, fee, rate big.Int
+	vs := new(big.Int)
+	kilo := big.NewInt(1000)
+TxLoop:
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		// skip coinbase transactions
+		if len(tx.Vin) == 0 || tx.Vin[0].Txid == "" {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		ta := txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))]
+		if ta == nil {
+			continue
+		}
+		in.SetInt64(0)
+		for j := range ta.Inputs {
+			tai := &ta.Inputs[j]
+			// input which was not found in the index, the fee cannot be computed
+			if tai.ValueSat.Sign() == 0 && len(tai.AddrDesc) == 0 {
+				continue TxLoop
+			}
+			in.Add(&in, &tai.ValueSat)
+		}
+		out.SetInt64(0)
+		for j := range ta.Outputs {
+			out.Add(&out, &ta.Outputs[j].ValueSat)
+		}
+		fee.Sub(&in, &out)
+		if fee.Sign() < 0 {
+			continue
+		}
+		bf.TotalFeesSat.Add(&bf.TotalFeesSat, &fee)
+		if tx.VSize > 0 {
+			rate.Mul(&fee, kilo)
+			rate.Div(&rate, vs.SetInt64(tx.VSize))
+			if rate.IsUint64() {
+				rates = append(rates, rate.Uint64())
+			}
+		}
+	}
+	bf.Txs = uint32(len(rates))
+	if len(rates) > 0 {
+		sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+		bf.FeeRates = make([]uint64, len(FeeRatePercentiles))
+		for i, p := range FeeRatePercentiles {
+			bf.FeeRates[i] = rates[(len(rates)-1)*p/100]
+		}
+	}
+	return bf
+}
+
+func packBlockFeeStatsKey(height uint32) []byte {
+	return append([]byte{feesBlockKeyPrefix}, packUint(height)...)
+}
+
+func packBlockFeeStats(bf *BlockFeeStats) []byte {
+	buf := make([]byte, 0, 32)
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(bf.Txs), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packBigint(&bf.TotalFeesSat, varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for _, r := range bf.FeeRates {
+		l = vlq.PutUint(varBuf, r)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf
+}
+
+func unpackBlockFeeStats(height uint32, buf []byte) (*BlockFeeStats, error) {
+	// minimum length is 1 byte txs, 1 byte fees
+	if len(buf) < 2 {
+		return nil, errors.New("Invalid block fee stats")
+	}
+	bf := &BlockFeeStats{Height: height}
+	txs, l := unpackVaruint(buf)
+	bf.Txs = uint32(txs)
+	var ll int
+	bf.TotalFeesSat, ll = unpackBigint(buf[l:])
+	l += ll
+	for l < len(buf) {
+		r, ll := vlq.Uint(buf[l:])
+		if ll <= 0 {
+			return nil, errors.New("Invalid block fee stats")
+		}
+		bf.FeeRates = append(bf.FeeRates, r)
+		l += ll
+	}
+	return bf, nil
+}
+
+func (d *RocksDB) storeBlockFeeStats(wb *gorocksdb.WriteBatch, bf *BlockFeeStats) error {
+	if bf == nil {
+		return nil
+	}
+	wb.PutCF(d.cfh[cfFees], packBlockFeeStatsKey(bf.Height), packBlockFeeStats(bf))
+	return nil
+}
+
+// GetBlockFeeStats returns fee stats of blocks in the range of heights lower-higher
+func (d *RocksDB) GetBlockFeeStats(lower uint32, higher uint32) (stats []BlockFeeStats, err error) {
+	defer func(s time.Time) { d.observeMethod("GetBlockFeeStats", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	kstart := packBlockFeeStatsKey(lower)
+	kstop := packBlockFeeStatsKey(higher)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFees])
+	defer it.Close()
+	r := make([]BlockFeeStats, 0)
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		bf, err := unpackBlockFeeStats(unpackUint(key[1:]), it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, *bf)
+	}
+	return r, nil
+}
+
+func packMempoolSnapshotKey(t int64) []byte {
+	return append([]byte{feesMempoolKeyPrefix}, packUint(uint32(t))...)
+}
+
+// StoreMempoolSnapshot stores summary of the mempool
+func (d *RocksDB) StoreMempoolSnapshot(ms *MempoolSnapshot) (err error) {
+	defer func(s time.Time) { d.observeMethod("StoreMempoolSnapshot", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	if len(ms.FeeEstimates) > maxMempoolFeeEstimates {
+		return errors.Errorf("Too many fee estimates %v", len(ms.FeeEstimates))
+	}
+	buf := make([]byte, 0, 64)
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(ms.Txs), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for i := range ms.FeeEstimates {
+		l = packVaruint(uint(ms.FeeEstimates[i].Blocks), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packBigint(&ms.FeeEstimates[i].FeeSat, varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfFees], packMempoolSnapshotKey(ms.Time), buf)
+}
+
+// GetMempoolSnapshots returns mempool snapshots stored in the time range from-to (unix time)
+func (d *RocksDB) GetMempoolSnapshots(from int64, to int64) (snapshots []MempoolSnapshot, err error) {
+	defer func(s time.Time) { d.observeMethod("GetMempoolSnapshots", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	kstart := packMempoolSnapshotKey(from)
+	kstop := packMempoolSnapshotKey(to)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFees])
+	defer it.Close()
+	r := make([]MempoolSnapshot, 0)
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		buf := it.Value().Data()
+		ms := MempoolSnapshot{Time: int64(unpackUint(key[1:]))}
+		txs, l := unpackVaruint(buf)
+		ms.Txs = uint32(txs)
+		for l < len(buf) {
+			var fe MempoolFeeEstimate
+			b, ll := unpackVaruint(buf[l:])
+			l += ll
+			if l >= len(buf) {
+				glog.Error("rocksdb: Inconsistent data in mempool snapshot at ", ms.Time)
+				return nil, errors.New("Inconsistent data in mempool snapshot")
+			}
+			fe.Blocks = uint32(b)
+			fe.FeeSat, ll = unpackBigint(buf[l:])
+			l += ll
+			ms.FeeEstimates = append(ms.FeeEstimates, fe)
+		}
+		r = append(r, ms)
+	}
+	return r, nil
+}
+
+// mempool snapshots older than this are removed
+const mempoolSnapshotsMaxAge = 365 * 24 * time.Hour
+
+// CleanupMempoolSnapshots removes mempool snapshots older than one year
+func (d *RocksDB) CleanupMempoolSnapshots() error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	kstart := packMempoolSnapshotKey(0)
+	kstop := packMempoolSnapshotKey(time.Now().Add(-mempoolSnapshotsMaxAge).Unix())
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfFees])
+	defer it.Close()
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		wb.DeleteCF(d.cfh[cfFees], append([]byte(nil), key...))
+	}
+	return d.db.Write(d.wo, wb)
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// fetchStartConcurrency is the number of the concurrent block fetches at the start of the parallel sync
+	fetchStartConcurrency = 2
+	// fetchLatencyIncrease is the ratio of the latency to the base latency, below which the concurrency is increased
+	fetchLatencyIncrease = 1.5
+	// fetchLatencyDecrease is the ratio of the latency to the base latency, above which the concurrency is decreased
+	fetchLatencyDecrease = 2
+	// fetchBaseLatencyDrift is the part of the difference by which the base latency follows a higher latency in each round,
+	// so that the base adapts to the growing blocks
+	fetchBaseLatencyDrift = 0.125
+)
+
+// fetchConcurrency limits the number of the concurrent fetches of the blocks from the backend and tunes the limit
+// between 1 and max after each round of fetches (as many fetches as the limit): the limit is increased by one while
+// the average latency of the round stays close to the lowest latency seen (the base), it is decreased by a quarter
+// when the latency grows, the backend is saturated, and by one when the fetched blocks wait for the writer,
+// more fetches would only use memory. A failed fetch halves the limit.
+type fetchConcurrency struct {
+	mux      sync.Mutex
+	cond     *sync.Cond
+	max      int
+	limit    int
+	inflight int
+	closed   bool
+	// the measures of the current round
+	samples int
+	latency time.Duration
+	backlog int
+	base    time.Duration
+	// onChange is called with the new limit, under the lock
+	onChange func(limit int)
+}
+
+func newFetchConcurrency(max int, onChange func(limit int)) *fetchConcurrency {
+	if max < 1 {
+		max = 1
+	}
+	limit := fetchStartConcurrency
+	if limit > max {
+		limit = max
+	}
+	c := &fetchConcurrency{max: max, limit: limit, onChange: onChange}
+	c.cond = sync.NewCond(&c.mux)
+	if onChange != nil {
+		onChange(limit)
+	}
+	return c
+}
+
+// acquire waits until a fetch can be started, it returns false if the limiter was closed
+func (c *fetchConcurrency) acquire() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for c.inflight >= c.limit && !c.closed {
+		c.cond.Wait()
+	}
+	if c.closed {
+		return false
+	}
+	c.inflight++
+	return true
+}
+
+// release ends the fetch without its measure
+func (c *fetchConcurrency) release() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.inflight--
+	c.cond.Broadcast()
+}
+
+// done ends the successful fetch which took latency, backlog is the number of the fetched blocks waiting for the writer
+func (c *fetchConcurrency) done(latency time.Duration, backlog int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.inflight--
+	c.samples++
+	c.latency += latency
+	c.backlog += backlog
+	if c.samples >= c.limit {
+		c.tune()
+	}
+	c.cond.Broadcast()
+}
+
+// failed ends the failed fetch
+func (c *fetchConcurrency) failed() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.inflight--
+	c.setLimit(c.limit / 2)
+	c.resetRound()
+	c.cond.Broadcast()
+}
+
+// close makes all waiting and following acquires fail
+func (c *fetchConcurrency) close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.closed = true
+	c.cond.Broadcast()
+}
+
+// tune changes the limit according to the measures of the finished round
+func (c *fetchConcurrency) tune() {
+	latency := c.latency / time.Duration(c.samples)
+	backlog := c.backlog / c.samples
+	if c.base == 0 || latency < c.base {
+		c.base = latency
+	} else {
+		c.base += time.Duration(float64(latency-c.base) * fetchBaseLatencyDrift)
+	}
+	switch {
+	case backlog >= c.limit:
+		c.setLimit(c.limit - 1)
+	case float64(latency) > float64(c.base)*fetchLatencyDecrease:
+		c.setLimit(c.limit * 3 / 4)
+	case float64(latency) <= float64(c.base)*fetchLatencyIncrease:
+		c.setLimit(c.limit + 1)
+	}
+	c.resetRound()
+}
+
+func (c *fetchConcurrency) setLimit(limit int) {
+	if limit < 1 {
+		limit = 1
+	} else if limit > c.max {
+		limit = c.max
+	}
+	if limit != c.limit {
+		c.limit = limit
+		if c.onChange != nil {
+			c.onChange(limit)
+		}
+	}
+}
+
+func (c *fetchConcurrency) resetRound() {
+	c.samples = 0
+	c.latency = 0
+	c.backlog = 0
+}
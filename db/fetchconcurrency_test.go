@@ -0,0 +1,82 @@
+// +build unittest
+
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// round runs one round of the fetches with the given latency and backlog
+func (c *fetchConcurrency) round(t *testing.T, latency time.Duration, backlog int) {
+	n := c.limit
+	for i := 0; i < n; i++ {
+		if !c.acquire() {
+			t.Fatal("acquire failed")
+		}
+	}
+	for i := 0; i < n; i++ {
+		c.done(latency, backlog)
+	}
+}
+
+func TestFetchConcurrency(t *testing.T) {
+	var changes []int
+	c := newFetchConcurrency(8, func(limit int) { changes = append(changes, limit) })
+	if c.limit != 2 {
+		t.Fatalf("start limit %d, want 2", c.limit)
+	}
+	// stable latency, the limit grows up to the max
+	for i := 0; i < 10; i++ {
+		c.round(t, 10*time.Millisecond, 0)
+	}
+	if c.limit != 8 {
+		t.Errorf("limit with stable latency %d, want 8", c.limit)
+	}
+	// the backend is saturated
+	c.round(t, 30*time.Millisecond, 0)
+	if c.limit != 6 {
+		t.Errorf("limit with growing latency %d, want 6", c.limit)
+	}
+	// the writer is the bottleneck
+	c.round(t, 10*time.Millisecond, 6)
+	if c.limit != 5 {
+		t.Errorf("limit with writer backlog %d, want 5", c.limit)
+	}
+	// failed fetch
+	if !c.acquire() {
+		t.Fatal("acquire failed")
+	}
+	c.failed()
+	if c.limit != 2 {
+		t.Errorf("limit after failure %d, want 2", c.limit)
+	}
+	want := []int{2, 3, 4, 5, 6, 7, 8, 6, 5, 2}
+	if len(changes) != len(want) {
+		t.Fatalf("changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes %v, want %v", changes, want)
+		}
+	}
+	// acquire waits for the release and fails after close
+	for i := 0; i < c.limit; i++ {
+		c.acquire()
+	}
+	acquired := make(chan bool)
+	go func() { acquired <- c.acquire() }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire above the limit did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.release()
+	if !<-acquired {
+		t.Error("acquire after release failed")
+	}
+	c.close()
+	if c.acquire() {
+		t.Error("acquire after close succeeded")
+	}
+}
@@ -0,0 +1,207 @@
+// +build gofuzz
+
+package db
+
+// The fuzzers are built and run by go-fuzz (github.com/dvyukov/go-fuzz), for example
+//   go-fuzz-build -func FuzzTxAddresses -o fuzz-txaddresses.zip blockbook/db
+//   go-fuzz -bin fuzz-txaddresses.zip -workdir fuzz/txaddresses
+// Each fuzzer derives a value from the input, packs it, unpacks it back and packs it again.
+// It panics if the packed forms differ or if the unpacked value does not match the original.
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins/btc"
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// fuzzReader reads the values from the fuzzer input, returns zero values when the input is exhausted
+type fuzzReader struct {
+	buf []byte
+}
+
+func (r *fuzzReader) byte() byte {
+	if len(r.buf) == 0 {
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *fuzzReader) bytes(n int) []byte {
+	if n > len(r.buf) {
+		n = len(r.buf)
+	}
+	b := make([]byte, n)
+	copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *fuzzReader) uint32() uint32 {
+	return uint32(r.byte())<<24 | uint32(r.byte())<<16 | uint32(r.byte())<<8 | uint32(r.byte())
+}
+
+// bigint returns a non-negative big int of at most maxBytes bytes
+func (r *fuzzReader) bigint(maxBytes int) big.Int {
+	var b big.Int
+	b.SetBytes(r.bytes(int(r.byte()) % (maxBytes + 1)))
+	return b
+}
+
+func fuzzCheck(name string, packed, repacked []byte) {
+	if !bytes.Equal(packed, repacked) {
+		panic(fmt.Sprintf("%s: repacked %x, packed %x", name, repacked, packed))
+	}
+}
+
+func fuzzCheckBigint(name string, got, want *big.Int) {
+	if got.Cmp(want) != 0 {
+		panic(fmt.Sprintf("%s: unpacked %v, want %v", name, got, want))
+	}
+}
+
+// FuzzBigint checks packing of big ints up to the maximum packed size
+func FuzzBigint(data []byte) int {
+	var bi big.Int
+	bi.SetBytes(data)
+	if len(bi.Bytes()) > maxPackedBigintBytes-1 {
+		return -1
+	}
+	buf := make([]byte, maxPackedBigintBytes)
+	l := packBigint(&bi, buf)
+	got, ll := unpackBigint(buf[:l])
+	if ll != l {
+		panic(fmt.Sprintf("bigint: unpacked %d bytes, packed %d", ll, l))
+	}
+	fuzzCheckBigint("bigint", &got, &bi)
+	return 1
+}
+
+// FuzzTxAddresses checks packing of the values of the txAddresses column
+func FuzzTxAddresses(data []byte) int {
+	r := &fuzzReader{buf: data}
+	ta := &TxAddresses{Height: r.uint32()}
+	ta.Inputs = make([]TxInput, r.byte()%8)
+	for i := range ta.Inputs {
+		ta.Inputs[i].AddrDesc = r.bytes(int(r.byte()) % (maxAddrDescLen + 1))
+		ta.Inputs[i].ValueSat = r.bigint(32)
+	}
+	ta.Outputs = make([]TxOutput, r.byte()%8)
+	for i := range ta.Outputs {
+		ta.Outputs[i].Spent = r.byte()&1 == 1
+		ta.Outputs[i].AddrDesc = r.bytes(int(r.byte()) % (maxAddrDescLen + 1))
+		ta.Outputs[i].ValueSat = r.bigint(32)
+	}
+	varBuf := make([]byte, maxPackedBigintBytes)
+	packed := packTxAddresses(ta, nil, varBuf)
+	got, err := unpackTxAddresses(packed)
+	if err != nil {
+		panic(err)
+	}
+	if got.Height != ta.Height || len(got.Inputs) != len(ta.Inputs) || len(got.Outputs) != len(ta.Outputs) {
+		panic(fmt.Sprintf("txAddresses: unpacked %+v, want %+v", got, ta))
+	}
+	for i := range ta.Inputs {
+		fuzzCheckBigint("txAddresses input", &got.Inputs[i].ValueSat, &ta.Inputs[i].ValueSat)
+	}
+	for i := range ta.Outputs {
+		if got.Outputs[i].Spent != ta.Outputs[i].Spent {
+			panic(fmt.Sprintf("txAddresses: output %d spent %v, want %v", i, got.Outputs[i].Spent, ta.Outputs[i].Spent))
+		}
+		fuzzCheckBigint("txAddresses output", &got.Outputs[i].ValueSat, &ta.Outputs[i].ValueSat)
+	}
+	fuzzCheck("txAddresses", packed, packTxAddresses(got, nil, varBuf))
+	return 1
+}
+
+// FuzzAddressOutpoints checks packing of the values of the addresses column
+func FuzzAddressOutpoints(data []byte) int {
+	d := &RocksDB{chainParser: btc.NewBitcoinParser(btc.GetChainParams("test"), &btc.Configuration{})}
+	r := &fuzzReader{buf: data}
+	txids := make([][]byte, r.byte()%4+1)
+	for i := range txids {
+		txids[i] = r.bytes(d.chainParser.PackedTxidLen())
+		if len(txids[i]) < d.chainParser.PackedTxidLen() {
+			return -1
+		}
+	}
+	outpoints := make([]outpoint, r.byte()%16+1)
+	for i := range outpoints {
+		// the indexes of inputs are stored negated, the packed index must fit to int32 after the shift
+		index := int32(r.uint32() >> 2)
+		if r.byte()&1 == 1 {
+			index = ^index
+		}
+		outpoints[i] = outpoint{btxID: txids[int(r.byte())%len(txids)], index: index}
+	}
+	packed := d.packAddressOutpoints(outpoints)
+	got, err := d.unpackAddressOutpoints(packed)
+	if err != nil {
+		panic(err)
+	}
+	if len(got) != len(outpoints) {
+		panic(fmt.Sprintf("addressOutpoints: unpacked %d outpoints, want %d", len(got), len(outpoints)))
+	}
+	fuzzCheck("addressOutpoints", packed, d.packAddressOutpoints(got))
+	return 1
+}
+
+// FuzzAddrBalance checks packing of the values of the addressBalance column
+func FuzzAddrBalance(data []byte) int {
+	r := &fuzzReader{buf: data}
+	ab := &AddrBalance{Txs: r.uint32() | 1, SentSat: r.bigint(32), BalanceSat: r.bigint(32), Nonce: uint64(r.uint32())}
+	if n := int(r.byte()); n&1 == 1 {
+		ab.Counterparties = &CounterpartySketch{}
+		for i := 0; i < n>>1; i++ {
+			ab.Counterparties[r.byte()%CounterpartySketchRegisters] = r.byte()
+		}
+	}
+	buf := make([]byte, 2*maxPackedBigintBytes+32+1+CounterpartySketchRegisters)
+	packed := buf[:packAddrBalance(ab, buf)]
+	got := unpackAddrBalance(packed)
+	if got == nil || got.Txs != ab.Txs || got.Nonce != ab.Nonce || !reflect.DeepEqual(got.Counterparties, ab.Counterparties) {
+		panic(fmt.Sprintf("addrBalance: unpacked %+v, want %+v", got, ab))
+	}
+	fuzzCheckBigint("addrBalance sent", &got.SentSat, &ab.SentSat)
+	fuzzCheckBigint("addrBalance balance", &got.BalanceSat, &ab.BalanceSat)
+	rebuf := make([]byte, len(buf))
+	fuzzCheck("addrBalance", packed, rebuf[:packAddrBalance(got, rebuf)])
+	return 1
+}
+
+// FuzzScriptAnnotations checks packing of the values of the scriptAnnotations column
+// and that unpacking of arbitrary data does not panic
+func FuzzScriptAnnotations(data []byte) int {
+	unpackScriptAnnotations(data)
+	r := &fuzzReader{buf: data}
+	sa := make(map[int][]bchain.ScriptAnnotation)
+	for n := int(r.byte() % 4); n > 0; n-- {
+		as := make([]bchain.ScriptAnnotation, r.byte()%3+1)
+		for i := range as {
+			as[i].Classifier = string(r.bytes(int(r.byte() % 16)))
+			as[i].Type = string(r.bytes(int(r.byte() % 16)))
+			for f := int(r.byte() % 4); f > 0; f-- {
+				if as[i].Fields == nil {
+					as[i].Fields = make(map[string]string)
+				}
+				as[i].Fields[strconv.Itoa(f)] = string(r.bytes(int(r.byte() % 32)))
+			}
+		}
+		sa[int(r.byte())] = as
+	}
+	packed := packScriptAnnotations(sa)
+	got, err := unpackScriptAnnotations(packed)
+	if err != nil {
+		panic(err)
+	}
+	if len(got) != len(sa) {
+		panic(fmt.Sprintf("scriptAnnotations: unpacked %+v, want %+v", got, sa))
+	}
+	fuzzCheck("scriptAnnotations", packed, packScriptAnnotations(got))
+	return 1
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"blockbook/bchain"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// HeightGap is a range of block heights missing in the height column, Lower and Higher are inclusive
+type HeightGap struct {
+	Lower  uint32
+	Higher uint32
+}
+
+// FindHeightGaps scans the height column and returns the ranges of missing heights between lower and the best block,
+// lower 0 means the first block of the index, the index does not have to start at the genesis block
+func (d *RocksDB) FindHeightGaps(lower uint32) ([]HeightGap, error) {
+	if err := d.enterHandle(); err != nil {
+		return nil, err
+	}
+	defer d.releaseHandle()
+	var gaps []HeightGap
+	expected := lower
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeight])
+	defer it.Close()
+	for it.Seek(packUint(lower)); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if len(key) != packedHeightBytes {
+			return nil, errors.Errorf("Invalid height key %x", key)
+		}
+		height := unpackUint(key)
+		if lower == 0 && expected == 0 {
+			expected = height
+		}
+		if height > expected {
+			gaps = append(gaps, HeightGap{Lower: expected, Higher: height - 1})
+		}
+		expected = height + 1
+	}
+	return gaps, nil
+}
+
+// isBlockIndexed checks if the transactions of the block were indexed although the block is missing in the height column
+func (d *RocksDB) isBlockIndexed(block *bchain.Block) (bool, error) {
+	if d.chainParser.IsUTXOChain() {
+		for i := range block.Txs {
+			ta, err := d.GetTxAddresses(block.Txs[i].Txid)
+			if err != nil {
+				return false, err
+			}
+			if ta == nil || ta.Height != block.Height {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	if len(block.Txs) == 0 && len(block.Withdrawals) == 0 {
+		return true, nil
+	}
+	start, end := heightRangeKeys(nil, block.Height, block.Height)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeightAddresses])
+	defer it.Close()
+	it.Seek(start)
+	return it.Valid() && string(it.Key().Data()) < string(end), nil
+}
+
+// restoreBlockInfo writes the missing record of the block to the height column, it does not change the best block
+func (d *RocksDB) restoreBlockInfo(block *bchain.Block) error {
+	val, err := d.packBlockInfo(blockInfoFromBlock(block))
+	if err != nil {
+		return err
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	wb.PutCF(d.cfh[cfHeight], packUint(block.Height), val)
+	return d.db.Write(d.wo, wb)
+}
+
+// HealHeightGaps fetches the blocks missing in the height column from the backend and restores their records,
+// if their transactions are indexed. Blocks which are not indexed cannot be connected out of order,
+// the index is rolled back below the first of them and synchronized again. The blocks, which were not indexed, are returned.
+func (w *SyncWorker) HealHeightGaps(gaps []HeightGap) ([]uint32, error) {
+	unindexed, err := w.restoreHeightGaps(gaps)
+	if err != nil || len(unindexed) == 0 {
+		return unindexed, err
+	}
+	return unindexed, w.reconnectFrom(unindexed[0])
+}
+
+func (w *SyncWorker) restoreHeightGaps(gaps []HeightGap) ([]uint32, error) {
+	var unindexed []uint32
+	for _, g := range gaps {
+		for height := g.Lower; height <= g.Higher; height++ {
+			hash, err := w.chain.GetBlockHash(height)
+			if err != nil {
+				return unindexed, errors.Annotatef(err, "GetBlockHash %v", height)
+			}
+			block, err := w.chain.GetBlock(hash, height)
+			if err != nil {
+				return unindexed, errors.Annotatef(err, "GetBlock %v %v", height, hash)
+			}
+			indexed, err := w.db.isBlockIndexed(block)
+			if err != nil {
+				return unindexed, err
+			}
+			if !indexed {
+				glog.Warning("gaps: block ", height, " ", hash, " is not indexed")
+				unindexed = append(unindexed, height)
+				continue
+			}
+			if err = w.db.restoreBlockInfo(block); err != nil {
+				return unindexed, err
+			}
+			glog.Info("gaps: restored block ", height, " ", hash)
+		}
+	}
+	return unindexed, nil
+}
+
+// reconnectFrom disconnects the blocks from the height to the best block and synchronizes them again from the backend,
+// so that the blocks missing in the index are connected in order; the missing blocks do not have any data to disconnect,
+// the runs of the blocks between them are disconnected from the highest
+func (w *SyncWorker) reconnectFrom(height uint32) error {
+	best, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	glog.Info("gaps: reconnecting blocks from ", height, " to ", best)
+	var hashes []string
+	higher := best
+	for h := int64(best); h >= int64(height); h-- {
+		hash, err := w.db.GetBlockHash(uint32(h))
+		if err != nil {
+			return err
+		}
+		if hash != "" {
+			if len(hashes) == 0 {
+				higher = uint32(h)
+			}
+			hashes = append(hashes, hash)
+		}
+		if len(hashes) > 0 && (hash == "" || h == int64(height)) {
+			if err = w.DisconnectBlocks(higher-uint32(len(hashes))+1, higher, hashes); err != nil {
+				return errors.Annotatef(err, "DisconnectBlocks %v-%v", higher-uint32(len(hashes))+1, higher)
+			}
+			hashes = nil
+		}
+	}
+	return w.ResyncIndex(nil, false)
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+var errHandleClosed = errors.New("The db is closed or being switched to another directory")
+
+// handleGate guards the rocksdb handle (d.db and d.cfh) against the switch by Reopen and MigrateTo and against Close.
+// The methods accessing the handle enter the gate and leave it when they stop using the handle. When the gate is closed,
+// the methods entering it fail instead of waiting, so that a method entering the gate again from a nested call
+// cannot deadlock the switch, which waits until all methods leave the gate.
+type handleGate struct {
+	mux    sync.Mutex
+	left   *sync.Cond
+	inside int
+	closed bool
+}
+
+func newHandleGate() *handleGate {
+	g := &handleGate{}
+	g.left = sync.NewCond(&g.mux)
+	return g
+}
+
+// enterHandle must be called before the handle is used, releaseHandle must be called after the use if it succeeds
+// the db created without the gate (in the tests of the packing) is not guarded
+func (d *RocksDB) enterHandle() error {
+	g := d.handle
+	if g == nil {
+		return nil
+	}
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.closed {
+		return errHandleClosed
+	}
+	g.inside++
+	return nil
+}
+
+func (d *RocksDB) releaseHandle() {
+	g := d.handle
+	if g == nil {
+		return
+	}
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.inside--
+	if g.inside == 0 {
+		g.left.Broadcast()
+	}
+}
+
+// closeHandle makes the new calls fail and waits until the calls in progress release the handle
+func (d *RocksDB) closeHandle() {
+	g := d.handle
+	if g == nil {
+		return
+	}
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.closed = true
+	for g.inside > 0 {
+		g.left.Wait()
+	}
+}
+
+// openHandle lets the calls use the handle again
+func (d *RocksDB) openHandle() {
+	g := d.handle
+	if g == nil {
+		return
+	}
+	g.mux.Lock()
+	g.closed = false
+	g.mux.Unlock()
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"math"
+	"time"
+
+	"github.com/tecbot/gorocksdb"
+)
+
+// the column heightAddresses partitions the keys of the addresses column by block height,
+// the addresses touched by a range of blocks are then found by a range scan instead of the full scan of the addresses column
+// and the index itself is removed by a single range delete
+
+func packHeightAddressKey(height uint32, addrDesc bchain.AddressDescriptor) []byte {
+	buf := make([]byte, packedHeightBytes+len(addrDesc))
+	copy(buf, packUint(height))
+	copy(buf[packedHeightBytes:], addrDesc)
+	return buf
+}
+
+func unpackHeightAddressKey(key []byte) (uint32, bchain.AddressDescriptor) {
+	return unpackUint(key[:packedHeightBytes]), bchain.AddressDescriptor(key[packedHeightBytes:])
+}
+
+// heightRangeKeys returns the bounds of keys prefix+(height uint32) for heights lower..higher, the end bound is exclusive
+func heightRangeKeys(prefix []byte, lower uint32, higher uint32) ([]byte, []byte) {
+	start := append(append([]byte(nil), prefix...), packUint(lower)...)
+	var end []byte
+	if higher == math.MaxUint32 {
+		end = append(append([]byte(nil), prefix...), 0xff, 0xff, 0xff, 0xff, 0xff)
+	} else {
+		end = append(append([]byte(nil), prefix...), packUint(higher+1)...)
+	}
+	return start, end
+}
+
+// deleteHeightRange deletes all keys prefix+(height uint32)[+anything] for heights lower..higher using a single range tombstone
+func (d *RocksDB) deleteHeightRange(wb *gorocksdb.WriteBatch, cf int, prefix []byte, lower uint32, higher uint32) {
+	start, end := heightRangeKeys(prefix, lower, higher)
+	wb.DeleteRangeCF(d.cfh[cf], start, end)
+}
+
+// heightAddressesScan returns the keys and values of the addresses column in the range of block heights
+// and the values of the heightAddresses column (the nonces before the blocks of account based chains)
+func (d *RocksDB) heightAddressesScan(lower uint32, higher uint32) ([][]byte, [][]byte, [][]byte, error) {
+	addrKeys := [][]byte{}
+	addrValues := [][]byte{}
+	heightValues := [][]byte{}
+	start, end := heightRangeKeys(nil, lower, higher)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeightAddresses])
+	defer it.Close()
+	for it.Seek(start); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if string(key) >= string(end) {
+			break
+		}
+		if len(key) <= packedHeightBytes {
+			continue
+		}
+		height, addrDesc := unpackHeightAddressKey(key)
+		addrKey := packAddressKey(addrDesc, height)
+		val, err := d.db.GetCF(d.ro, d.cfh[cfAddresses], addrKey)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		addrValue := append([]byte(nil), val.Data()...)
+		val.Free()
+		addrKeys = append(addrKeys, addrKey)
+		addrValues = append(addrValues, addrValue)
+		heightValues = append(heightValues, append([]byte(nil), it.Value().Data()...))
+	}
+	return addrKeys, addrValues, heightValues, nil
+}
+
+// GetBlockAffectedAddresses returns the address descriptors touched by the transactions of the block at the height,
+// in the order of the address descriptors; the list of a block which is not indexed is empty
+func (d *RocksDB) GetBlockAffectedAddresses(height uint32) (addrDescs []bchain.AddressDescriptor, err error) {
+	defer func(s time.Time) { d.observeMethod("GetBlockAffectedAddresses", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	start, end := heightRangeKeys(nil, height, height)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeightAddresses])
+	defer it.Close()
+	for it.Seek(start); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if string(key) >= string(end) {
+			break
+		}
+		if len(key) <= packedHeightBytes {
+			continue
+		}
+		_, addrDesc := unpackHeightAddressKey(key)
+		addrDescs = append(addrDescs, append(bchain.AddressDescriptor(nil), addrDesc...))
+	}
+	return addrDescs, nil
+}
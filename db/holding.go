@@ -0,0 +1,242 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// HoldingStats are the aggregates of the outputs of the address spent in the indexed blocks, for which the time
+// of the block of the output is known: the number and the value of the outputs, the sum of the times (in seconds)
+// for which they were held and the sum of the values multiplied by the times (coin-seconds destroyed, in satoshi*seconds)
+type HoldingStats struct {
+	Outputs     uint64
+	ValueSat    big.Int
+	HeldSeconds uint64
+	CoinSeconds big.Int
+}
+
+// holdingUpdate contains the modified holding stats keyed by the address descriptor before they are stored,
+// the stats with zero outputs are deleted
+type holdingUpdate map[string]*HoldingStats
+
+// blockTimeFunc returns the time of the block at height, false if the block is not known
+type blockTimeFunc func(height uint32) (int64, bool, error)
+
+// SetHoldingStats enables the computation of the holding stats of the addresses during the block connect,
+// the stats contain only the outputs spent by the blocks connected after it was enabled
+func (d *RocksDB) SetHoldingStats(enabled bool) {
+	d.holdingStats = enabled
+}
+
+// HoldingStatsEnabled returns true if the holding stats of the addresses are computed
+func (d *RocksDB) HoldingStatsEnabled() bool {
+	return d.holdingStats
+}
+
+func packHoldingStats(hs *HoldingStats) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(hs.Outputs), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	l = packBigint(&hs.ValueSat, varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(hs.HeldSeconds), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packBigint(&hs.CoinSeconds, varBuf)
+	return append(buf, varBuf[:l]...)
+}
+
+func unpackHoldingStats(buf []byte) (*HoldingStats, error) {
+	hs := &HoldingStats{}
+	o, l := unpackVaruint(buf)
+	if l <= 0 || l >= len(buf) || l+1+int(buf[l]) > len(buf) {
+		return nil, errors.New("Invalid packed holding stats")
+	}
+	hs.Outputs = uint64(o)
+	var ll int
+	hs.ValueSat, ll = unpackBigint(buf[l:])
+	l += ll
+	s, ll := unpackVaruint(buf[l:])
+	if ll <= 0 || l+ll >= len(buf) || l+ll+1+int(buf[l+ll]) != len(buf) {
+		return nil, errors.New("Invalid packed holding stats")
+	}
+	hs.HeldSeconds = uint64(s)
+	l += ll
+	hs.CoinSeconds, _ = unpackBigint(buf[l:])
+	return hs, nil
+}
+
+// dbBlockTime returns the time of the block at height stored in the db
+func (d *RocksDB) dbBlockTime(height uint32) (int64, bool, error) {
+	bi, err := d.GetBlockInfo(height)
+	if err != nil || bi == nil {
+		return 0, false, err
+	}
+	return bi.Time, true, nil
+}
+
+// cachedBlockTimes returns blockTimeFunc, which caches the times read by the given function
+func cachedBlockTimes(f blockTimeFunc) blockTimeFunc {
+	times := make(map[uint32]int64)
+	return func(height uint32) (int64, bool, error) {
+		if t, found := times[height]; found {
+			return t, true, nil
+		}
+		t, found, err := f(height)
+		if err == nil && found {
+			times[height] = t
+		}
+		return t, found, err
+	}
+}
+
+// addHoldingTime adds to the stats in u the output of addrDesc with the value valueSat created in the block spentHeight
+// and spent in the block at height with the time spendTime, or subtracts it if disconnect is true;
+// the output is skipped if the time of its block is not known
+func (d *RocksDB) addHoldingTime(u holdingUpdate, addrDesc bchain.AddressDescriptor, valueSat *big.Int, spentHeight, height uint32,
+	spendTime int64, blockTime blockTimeFunc, disconnect bool) error {
+	held := int64(0)
+	if spentHeight != height {
+		t, found, err := blockTime(spentHeight)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
+		}
+		// the times of the blocks do not strictly grow
+		if spendTime > t {
+			held = spendTime - t
+		}
+	}
+	hs, err := d.getHoldingStatsForUpdate(u, string(addrDesc))
+	if err != nil {
+		return err
+	}
+	var coinSeconds big.Int
+	coinSeconds.Mul(valueSat, big.NewInt(held))
+	if disconnect {
+		if hs.Outputs == 0 || hs.HeldSeconds < uint64(held) || hs.ValueSat.Cmp(valueSat) < 0 || hs.CoinSeconds.Cmp(&coinSeconds) < 0 {
+			// the output was spent before the holding stats were enabled
+			glog.Warningf("rocksdb: height %d, holding stats of %v lower than the disconnected output", height, addrDesc)
+			return nil
+		}
+		hs.Outputs--
+		hs.ValueSat.Sub(&hs.ValueSat, valueSat)
+		hs.HeldSeconds -= uint64(held)
+		hs.CoinSeconds.Sub(&hs.CoinSeconds, &coinSeconds)
+	} else {
+		hs.Outputs++
+		hs.ValueSat.Add(&hs.ValueSat, valueSat)
+		hs.HeldSeconds += uint64(held)
+		hs.CoinSeconds.Add(&hs.CoinSeconds, &coinSeconds)
+	}
+	return nil
+}
+
+// computeHoldingTimes adds the outputs spent by the block to the holding stats in u,
+// the spent outputs are taken from txAddressesMap filled by processAddressesUTXO
+func (d *RocksDB) computeHoldingTimes(u holdingUpdate, block *bchain.Block, txAddressesMap map[string]*TxAddresses, blockTime blockTimeFunc) error {
+	if !d.holdingStats {
+		return nil
+	}
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		for j := range tx.Vin {
+			input := &tx.Vin[j]
+			btxID, err := d.chainParser.PackTxid(input.Txid)
+			if err != nil {
+				continue
+			}
+			ita := txAddressesMap[string(btxID)]
+			if ita == nil || len(ita.Outputs) <= int(input.Vout) {
+				continue
+			}
+			ot := &ita.Outputs[input.Vout]
+			if len(ot.AddrDesc) == 0 || d.isTxOutputFiltered(ot) {
+				continue
+			}
+			if err := d.addHoldingTime(u, ot.AddrDesc, &ot.ValueSat, ita.Height, block.Height, block.Time, blockTime, false); err != nil {
+				return errors.Annotatef(err, "height %d, tx %v", block.Height, tx.Txid)
+			}
+		}
+	}
+	return nil
+}
+
+// disconnectHoldingTimes subtracts the outputs spent by the disconnected transaction txa from the holding stats in u,
+// the txAddresses of the spent transactions are in txAddressesToUpdate filled by disconnectTxAddresses
+func (d *RocksDB) disconnectHoldingTimes(u holdingUpdate, height uint32, spendTime int64, inputs []outpoint, txa *TxAddresses,
+	txAddressesToUpdate map[string]*TxAddresses, blockTime blockTimeFunc) error {
+	if !d.holdingStats {
+		return nil
+	}
+	for i := range txa.Inputs {
+		t := &txa.Inputs[i]
+		if len(t.AddrDesc) == 0 || i >= len(inputs) || d.isOutputFiltered(t.AddrDesc, &t.ValueSat) {
+			continue
+		}
+		sa := txAddressesToUpdate[string(inputs[i].btxID)]
+		if sa == nil {
+			continue
+		}
+		if err := d.addHoldingTime(u, t.AddrDesc, &t.ValueSat, sa.Height, height, spendTime, blockTime, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getHoldingStatsForUpdate returns the holding stats of the address descriptor key from the pending update,
+// the stats not yet in the update are read from the db and added to it
+func (d *RocksDB) getHoldingStatsForUpdate(u holdingUpdate, key string) (*HoldingStats, error) {
+	if hs, found := u[key]; found {
+		return hs, nil
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfHoldingStats], []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	hs := &HoldingStats{}
+	if len(val.Data()) > 0 {
+		if hs, err = unpackHoldingStats(val.Data()); err != nil {
+			return nil, err
+		}
+	}
+	u[key] = hs
+	return hs, nil
+}
+
+// storeHoldingStats writes the pending update of the holding stats to the write batch
+func (d *RocksDB) storeHoldingStats(wb *gorocksdb.WriteBatch, u holdingUpdate) {
+	for key, hs := range u {
+		if hs.Outputs == 0 {
+			wb.DeleteCF(d.cfh[cfHoldingStats], []byte(key))
+		} else {
+			wb.PutCF(d.cfh[cfHoldingStats], []byte(key), packHoldingStats(hs))
+		}
+	}
+}
+
+// GetAddrDescHoldingStats returns the holding stats of the address descriptor, nil if no spent output of the address is counted
+func (d *RocksDB) GetAddrDescHoldingStats(addrDesc bchain.AddressDescriptor) (hs *HoldingStats, err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescHoldingStats", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	val, err := d.db.GetCF(d.ro, d.cfh[cfHoldingStats], addrDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	return unpackHoldingStats(val.Data())
+}
@@ -0,0 +1,428 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// the column indexDelta keeps for the last connected blocks the writes of the block to the index (the write set),
+// a downstream blockbook (a mirror) applies them to its copy of the db without the access to the backend of the coin
+
+const (
+	indexDeltaPut    = 0
+	indexDeltaDelete = 1
+)
+
+// MaxIndexDeltaBlocks is the maximum number of blocks returned by one call of GetIndexDelta
+const MaxIndexDeltaBlocks = 100
+
+// IndexDeltaForkError is returned by ApplyIndexDelta if the delta does not continue the best block of the db,
+// the blocks from Height up are not in the source db, they must be disconnected and the delta requested again
+type IndexDeltaForkError struct {
+	Height uint32
+}
+
+func (e *IndexDeltaForkError) Error() string {
+	return fmt.Sprintf("Index delta does not continue the db, block %d is not in the source db", e.Height)
+}
+
+// indexDeltaRecord is one write of the write set of the block, the column is the index in cfNames
+type indexDeltaRecord struct {
+	op     byte
+	column int
+	key    []byte
+	value  []byte
+}
+
+// indexDeltaBlock is the write set of the block
+type indexDeltaBlock struct {
+	height  uint32
+	hash    string
+	prev    string
+	records []indexDeltaRecord
+}
+
+// SetIndexDeltaBlocks sets the number of the last connected blocks, for which the write sets are kept, 0 disables the delta
+func (d *RocksDB) SetIndexDeltaBlocks(blocks uint32) {
+	d.indexDeltaBlocks = blocks
+}
+
+// columnIDs returns the map of the rocksdb ids of the column families to the indexes of the columns in cfNames,
+// the ids depend on the order in which the columns were created in the db and therefore can differ between the dbs
+func (d *RocksDB) columnIDs() (map[int]int, error) {
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for i := range d.cfh {
+		wb.PutCF(d.cfh[i], []byte{}, []byte{})
+	}
+	r := make(map[int]int, len(d.cfh))
+	it := wb.NewIterator()
+	for i := 0; it.Next(); i++ {
+		r[it.Record().CF] = i
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if len(r) != len(d.cfh) {
+		return nil, errors.New("Cannot map the column family ids")
+	}
+	return r, nil
+}
+
+// writeSet converts the writes in the batch to the records of the write set,
+// the writes to the default column (the internal state), to the indexDelta column itself and to the indexHash column are skipped
+func (d *RocksDB) writeSet(wb *gorocksdb.WriteBatch) ([]indexDeltaRecord, error) {
+	ids, err := d.columnIDs()
+	if err != nil {
+		return nil, err
+	}
+	var records []indexDeltaRecord
+	it := wb.NewIterator()
+	for it.Next() {
+		r := it.Record()
+		var op byte
+		switch r.Type {
+		case gorocksdb.WriteBatchValueRecord, gorocksdb.WriteBatchCFValueRecord:
+			op = indexDeltaPut
+		case gorocksdb.WriteBatchDeletionRecord, gorocksdb.WriteBatchCFDeletionRecord:
+			op = indexDeltaDelete
+		default:
+			return nil, errors.Errorf("Unsupported write batch record type %v", r.Type)
+		}
+		column, found := ids[r.CF]
+		if !found {
+			return nil, errors.Errorf("Unknown column family id %v", r.CF)
+		}
+		if column == cfDefault || column == cfIndexDelta || column == cfIndexHash {
+			continue
+		}
+		records = append(records, indexDeltaRecord{
+			op:     op,
+			column: column,
+			key:    append([]byte(nil), r.Key...),
+			value:  append([]byte(nil), r.Value...),
+		})
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func packIndexDeltaBlock(b *indexDeltaBlock) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := packUint(b.height)
+	buf = packString(b.hash, buf)
+	buf = packString(b.prev, buf)
+	l := packVaruint(uint(len(b.records)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for i := range b.records {
+		r := &b.records[i]
+		buf = append(buf, r.op)
+		l = packVaruint(uint(r.column), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		buf = packString(string(r.key), buf)
+		if r.op == indexDeltaPut {
+			buf = packString(string(r.value), buf)
+		}
+	}
+	return buf
+}
+
+func unpackIndexDeltaBlock(buf []byte) (*indexDeltaBlock, error) {
+	if len(buf) < packedHeightBytes {
+		return nil, errors.New("Invalid packed index delta block")
+	}
+	b := &indexDeltaBlock{height: unpackUint(buf)}
+	l := packedHeightBytes
+	var ll int
+	var err error
+	if b.hash, ll, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	l += ll
+	if b.prev, ll, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	l += ll
+	n, ll := unpackVaruint(buf[l:])
+	if ll <= 0 || int(n) > len(buf) {
+		return nil, errors.New("Invalid packed index delta block")
+	}
+	l += ll
+	b.records = make([]indexDeltaRecord, n)
+	for i := range b.records {
+		r := &b.records[i]
+		if l >= len(buf) {
+			return nil, errors.New("Invalid packed index delta block")
+		}
+		r.op = buf[l]
+		l++
+		column, ll := unpackVaruint(buf[l:])
+		if ll <= 0 || (r.op != indexDeltaPut && r.op != indexDeltaDelete) {
+			return nil, errors.New("Invalid packed index delta block")
+		}
+		r.column = int(column)
+		l += ll
+		key, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, err
+		}
+		r.key = []byte(key)
+		l += ll
+		if r.op == indexDeltaPut {
+			value, ll, err := unpackString(buf[l:])
+			if err != nil {
+				return nil, err
+			}
+			r.value = []byte(value)
+			l += ll
+		}
+	}
+	if l != len(buf) {
+		return nil, errors.New("Invalid packed index delta block")
+	}
+	return b, nil
+}
+
+// storeIndexDelta stores the write set of the connected block and removes the write set of the block,
+// which is no longer kept; it must be called after all other writes of the block are in the batch
+func (d *RocksDB) storeIndexDelta(wb *gorocksdb.WriteBatch, height uint32, hash, prev string) error {
+	if d.indexDeltaBlocks == 0 {
+		return nil
+	}
+	records, err := d.writeSet(wb)
+	if err != nil {
+		return errors.Annotatef(err, "index delta of block %d", height)
+	}
+	b := indexDeltaBlock{height: height, hash: hash, prev: prev, records: records}
+	wb.PutCF(d.cfh[cfIndexDelta], packUint(height), packIndexDeltaBlock(&b))
+	if height >= d.indexDeltaBlocks {
+		wb.DeleteCF(d.cfh[cfIndexDelta], packUint(height-d.indexDeltaBlocks))
+	}
+	return nil
+}
+
+// GetIndexDelta returns the packed write sets of the blocks connected after the block sinceHeight, at most MaxIndexDeltaBlocks blocks,
+// the delta is (nr_columns vuint)+[](column name varBytes)+(nr_blocks vuint)+[](block varBytes), the block is packed
+// as the value of the indexDelta column. The error is returned if the write sets are not kept from the block sinceHeight+1,
+// the mirror must then be recreated from a copy of the db.
+func (d *RocksDB) GetIndexDelta(sinceHeight uint32) (buf []byte, err error) {
+	defer func(s time.Time) { d.observeMethod("GetIndexDelta", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	if d.indexDeltaBlocks == 0 {
+		return nil, errors.New("Index delta is not enabled")
+	}
+	best, _, err := d.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+	if sinceHeight > best {
+		return nil, errors.Errorf("Height %d is above the best block %d", sinceHeight, best)
+	}
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(len(cfNames)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for _, n := range cfNames {
+		buf = packString(n, buf)
+	}
+	var blocks [][]byte
+	next := sinceHeight + 1
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfIndexDelta])
+	defer it.Close()
+	for it.Seek(packUint(next)); it.Valid() && next <= best && len(blocks) < MaxIndexDeltaBlocks; it.Next() {
+		key := it.Key().Data()
+		if len(key) != packedHeightBytes || unpackUint(key) != next {
+			break
+		}
+		blocks = append(blocks, append([]byte(nil), it.Value().Data()...))
+		next++
+	}
+	if len(blocks) == 0 && sinceHeight < best {
+		return nil, errors.Errorf("Index delta of block %d is not available", sinceHeight+1)
+	}
+	l = packVaruint(uint(len(blocks)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for _, b := range blocks {
+		buf = packString(string(b), buf)
+	}
+	return buf, nil
+}
+
+// unpackIndexDelta returns the column names and the write sets of the blocks in the delta
+func unpackIndexDelta(buf []byte) ([]string, []*indexDeltaBlock, error) {
+	n, l := unpackVaruint(buf)
+	if l <= 0 || int(n) > len(buf) {
+		return nil, nil, errors.New("Invalid packed index delta")
+	}
+	columns := make([]string, n)
+	for i := range columns {
+		c, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, nil, err
+		}
+		columns[i] = c
+		l += ll
+	}
+	n, ll := unpackVaruint(buf[l:])
+	if ll <= 0 || int(n) > len(buf) {
+		return nil, nil, errors.New("Invalid packed index delta")
+	}
+	l += ll
+	blocks := make([]*indexDeltaBlock, n)
+	for i := range blocks {
+		s, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, nil, err
+		}
+		l += ll
+		if blocks[i], err = unpackIndexDeltaBlock([]byte(s)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if l != len(buf) {
+		return nil, nil, errors.New("Invalid packed index delta")
+	}
+	return columns, blocks, nil
+}
+
+// ApplyIndexDelta writes the write sets of the blocks in the delta returned by GetIndexDelta of another db to the db
+// and returns the number of connected blocks. The blocks, which are already in the db, are skipped.
+// IndexDeltaForkError is returned if the delta does not continue the best block of the db.
+// If the index delta is enabled in the db, the write sets are kept, so that the db can serve as the source for other mirrors.
+func (d *RocksDB) ApplyIndexDelta(delta []byte) (connected int, err error) {
+	defer func(s time.Time) { d.observeMethod("ApplyIndexDelta", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	columns, blocks, err := unpackIndexDelta(delta)
+	if err != nil {
+		return 0, err
+	}
+	// map the columns of the source db to the columns of this db
+	index := make(map[string]int, len(cfNames))
+	for i, n := range cfNames {
+		index[n] = i
+	}
+	cfMap := make([]int, len(columns))
+	for i, n := range columns {
+		c, found := index[n]
+		if !found {
+			return 0, errors.Errorf("Index delta contains unknown column %v", n)
+		}
+		cfMap[i] = c
+	}
+	d.anomalies.balancesMux.Lock()
+	defer d.anomalies.balancesMux.Unlock()
+	// the cached txAddresses could be changed by the writes
+	defer d.txAddressesCache.purge()
+	for _, b := range blocks {
+		best, hash, err := d.GetBestBlock()
+		if err != nil {
+			return connected, err
+		}
+		if b.height <= best {
+			h, err := d.GetBlockHash(b.height)
+			if err != nil {
+				return connected, err
+			}
+			if h == b.hash {
+				continue
+			}
+			return connected, &IndexDeltaForkError{Height: b.height}
+		}
+		if b.height != best+1 {
+			return connected, errors.Errorf("Index delta starts at block %d, the best block of the db is %d", b.height, best)
+		}
+		if b.prev != hash {
+			return connected, &IndexDeltaForkError{Height: best}
+		}
+		wb := gorocksdb.NewWriteBatch()
+		for i := range b.records {
+			r := &b.records[i]
+			if r.column >= len(cfMap) {
+				wb.Destroy()
+				return connected, errors.Errorf("Index delta block %d contains invalid column %d", b.height, r.column)
+			}
+			cf := d.cfh[cfMap[r.column]]
+			if r.op == indexDeltaPut {
+				wb.PutCF(cf, r.key, r.value)
+			} else {
+				wb.DeleteCF(cf, r.key)
+			}
+		}
+		// keep the write set in the terms of the columns of this db
+		for i := range b.records {
+			b.records[i].column = cfMap[b.records[i].column]
+		}
+		if err = d.storeIndexHash(wb, b.height, b.records); err != nil {
+			wb.Destroy()
+			return connected, err
+		}
+		if d.indexDeltaBlocks > 0 {
+			wb.PutCF(d.cfh[cfIndexDelta], packUint(b.height), packIndexDeltaBlock(b))
+			if b.height >= d.indexDeltaBlocks {
+				wb.DeleteCF(d.cfh[cfIndexDelta], packUint(b.height-d.indexDeltaBlocks))
+			}
+		}
+		err = d.db.Write(d.wo, wb)
+		wb.Destroy()
+		if err != nil {
+			return connected, errors.Annotatef(err, "index delta block %d", b.height)
+		}
+		d.setBestBlock(b.height, b.hash)
+		connected++
+		glog.V(1).Info("rocksdb: applied index delta of block ", b.height, " ", b.hash, ", ", len(b.records), " writes")
+	}
+	return connected, nil
+}
+
+// SyncIndexDelta brings the db of a mirror up to the best block of the source db by the deltas returned by fetch,
+// which gets the delta following the given height (e.g. from the index-delta endpoint of the source); the delta is requested
+// including the best block of the mirror, so that the mirror on another branch is detected also at the same height as the source.
+// On IndexDeltaForkError the blocks of the mirror from the reported height up are disconnected and the delta is fetched again.
+// Returns the number of connected blocks.
+func (d *RocksDB) SyncIndexDelta(fetch func(since uint32) ([]byte, error)) (connected int, err error) {
+	for {
+		best, _, err := d.GetBestBlock()
+		if err != nil {
+			return connected, err
+		}
+		since := best
+		if since > 0 {
+			since--
+		}
+		delta, err := fetch(since)
+		if err != nil {
+			return connected, errors.Annotatef(err, "index delta since %d", since)
+		}
+		n, err := d.ApplyIndexDelta(delta)
+		connected += n
+		if fe, ok := err.(*IndexDeltaForkError); ok {
+			if best, _, err = d.GetBestBlock(); err != nil {
+				return connected, err
+			}
+			glog.Info("rocksdb: index delta forked at block ", fe.Height, ", disconnecting blocks ", fe.Height, "-", best)
+			if d.chainParser.IsUTXOChain() {
+				err = d.DisconnectBlockRangeUTXO(fe.Height, best)
+			} else {
+				err = d.DisconnectBlockRangeNonUTXO(fe.Height, best)
+			}
+			if err != nil {
+				return connected, err
+			}
+			continue
+		}
+		if err != nil || n == 0 {
+			return connected, err
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"encoding/hex"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// IndexFilter describes the outputs which are not indexed by their address descriptor,
+// the filtered outputs are kept in txAddresses with their address descriptors, but they are not in the addresses
+// and addressBalance columns and their addresses do not have the transactions in the history;
+// the filter is stored in the internal state, the db cannot be used with another filter
+type IndexFilter struct {
+	// Unspendable skips the provably unspendable outputs (OP_RETURN)
+	Unspendable bool
+	// BelowSat skips the outputs with value lower than BelowSat, zero disables the rule
+	BelowSat big.Int
+	// AddrDescs are the address descriptors of the skipped addresses
+	AddrDescs map[string]struct{}
+	// ScriptTemplates are the hashes of the script skeletons of the skipped outputs
+	ScriptTemplates map[string]struct{}
+}
+
+// ParseIndexFilter parses the comma separated list of the rules of the index filter
+// the rules are opreturn, below=<satoshi>, address=<address> and script=<hex encoded script skeleton>
+func ParseIndexFilter(s string, parser bchain.BlockChainParser) (*IndexFilter, error) {
+	f := &IndexFilter{}
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		var v string
+		if i := strings.IndexByte(r, '='); i >= 0 {
+			r, v = r[:i], r[i+1:]
+		}
+		switch r {
+		case "opreturn":
+			f.Unspendable = true
+		case "below":
+			if _, ok := f.BelowSat.SetString(v, 10); !ok || f.BelowSat.Sign() < 0 {
+				return nil, errors.Errorf("Invalid index filter rule below=%v", v)
+			}
+		case "address":
+			addrDesc, err := parser.GetAddrDescFromAddress(v)
+			if err != nil || len(addrDesc) == 0 {
+				return nil, errors.Errorf("Invalid index filter rule address=%v", v)
+			}
+			if f.AddrDescs == nil {
+				f.AddrDescs = make(map[string]struct{})
+			}
+			f.AddrDescs[string(addrDesc)] = struct{}{}
+		case "script":
+			skeleton, err := hex.DecodeString(v)
+			if err != nil || len(skeleton) == 0 {
+				return nil, errors.Errorf("Invalid index filter rule script=%v", v)
+			}
+			if f.ScriptTemplates == nil {
+				f.ScriptTemplates = make(map[string]struct{})
+			}
+			f.ScriptTemplates[string(ScriptTemplateHash(skeleton))] = struct{}{}
+		default:
+			return nil, errors.Errorf("Unknown index filter rule %v", r)
+		}
+	}
+	return f, nil
+}
+
+// String returns the description of the rules of the filter
+func (f *IndexFilter) String() string {
+	var rules []string
+	if f.Unspendable {
+		rules = append(rules, "opreturn")
+	}
+	if f.BelowSat.Sign() > 0 {
+		rules = append(rules, "below="+f.BelowSat.String())
+	}
+	if len(f.AddrDescs) > 0 {
+		rules = append(rules, "addresses "+strconv.Itoa(len(f.AddrDescs)))
+	}
+	if len(f.ScriptTemplates) > 0 {
+		rules = append(rules, "scripts "+strconv.Itoa(len(f.ScriptTemplates)))
+	}
+	return strings.Join(rules, ", ")
+}
+
+// Rules returns the canonical form of the rules of the filter, which is stored in the internal state,
+// the addresses are given by the hex address descriptors and the scripts by the hashes of the skeletons
+func (f *IndexFilter) Rules() string {
+	if f == nil {
+		return ""
+	}
+	var rules []string
+	if f.Unspendable {
+		rules = append(rules, "opreturn")
+	}
+	if f.BelowSat.Sign() > 0 {
+		rules = append(rules, "below="+f.BelowSat.String())
+	}
+	sorted := func(prefix string, m map[string]struct{}) {
+		r := make([]string, 0, len(m))
+		for k := range m {
+			r = append(r, prefix+hex.EncodeToString([]byte(k)))
+		}
+		sort.Strings(r)
+		rules = append(rules, r...)
+	}
+	sorted("addrdesc=", f.AddrDescs)
+	sorted("scripthash=", f.ScriptTemplates)
+	return strings.Join(rules, ",")
+}
+
+// SetIndexFilter sets the filter of the indexed outputs, nil disables it
+// the filter must be set before the internal state is loaded, the db, in which blocks were connected with another filter,
+// is refused by LoadInternalState
+func (d *RocksDB) SetIndexFilter(f *IndexFilter) {
+	d.indexFilter = f
+}
+
+// isOutputFiltered returns true if the output with the address descriptor and the value must not be indexed
+func (d *RocksDB) isOutputFiltered(addrDesc bchain.AddressDescriptor, valueSat *big.Int) bool {
+	f := d.indexFilter
+	if f == nil {
+		return false
+	}
+	if f.Unspendable && d.chainParser.IsAddrDescUnspendable(addrDesc) {
+		return true
+	}
+	if f.BelowSat.Sign() > 0 && valueSat.Cmp(&f.BelowSat) < 0 {
+		return true
+	}
+	if _, found := f.AddrDescs[string(addrDesc)]; found {
+		return true
+	}
+	if len(f.ScriptTemplates) > 0 {
+		if s, err := ScriptSkeleton(addrDesc); err == nil {
+			if _, found := f.ScriptTemplates[string(ScriptTemplateHash(s))]; found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTxOutputFiltered returns true if the output stored in txAddresses has the address descriptor, which is not indexed
+func (d *RocksDB) isTxOutputFiltered(o *TxOutput) bool {
+	return len(o.AddrDesc) > 0 && d.isOutputFiltered(o.AddrDesc, &o.ValueSat)
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// the column indexHash keeps the rolling hashes of the writes of the connected blocks to the other columns,
+// the operators of independent blockbooks compare them to verify that their indexes agree
+
+// IndexHashWindow is the number of blocks, after which the rolling hashes start again from the empty hash,
+// so that the dbs synchronized from different heights (e.g. by the bulk import) agree from the next window;
+// the hashes of the last block of each window (the checkpoints) are kept
+const IndexHashWindow = 1000
+
+// IndexHash contains the rolling hashes of the writes of the blocks FromHeight..Height to the columns of the db,
+// Complete is true if FromHeight is the first block of the window, only then the hashes of different dbs can be compared
+type IndexHash struct {
+	Height     uint32            `json:"height"`
+	FromHeight uint32            `json:"fromHeight"`
+	Complete   bool              `json:"complete"`
+	Hash       string            `json:"hash"`
+	Columns    map[string]string `json:"columns"`
+}
+
+// indexHashEntry is the value of the indexHash column, the hashes are keyed by the name of the column
+type indexHashEntry struct {
+	from    uint32
+	columns map[string][]byte
+}
+
+// SetIndexHash enables the computation of the rolling hashes of the writes of the connected blocks
+func (d *RocksDB) SetIndexHash(enabled bool) {
+	d.indexHash = enabled
+}
+
+func indexHashWindowStart(height uint32) uint32 {
+	return height - height%IndexHashWindow
+}
+
+func sortedIndexHashColumns(columns map[string][]byte) []string {
+	names := make([]string, 0, len(columns))
+	for n := range columns {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func packIndexHashEntry(e *indexHashEntry) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := packUint(e.from)
+	l := packVaruint(uint(len(e.columns)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for _, n := range sortedIndexHashColumns(e.columns) {
+		buf = packString(n, buf)
+		buf = append(buf, e.columns[n]...)
+	}
+	return buf
+}
+
+func unpackIndexHashEntry(buf []byte) (*indexHashEntry, error) {
+	if len(buf) < packedHeightBytes {
+		return nil, errors.New("Invalid packed index hash")
+	}
+	e := &indexHashEntry{from: unpackUint(buf)}
+	l := packedHeightBytes
+	n, ll := unpackVaruint(buf[l:])
+	if ll <= 0 || int(n) > len(buf) {
+		return nil, errors.New("Invalid packed index hash")
+	}
+	l += ll
+	e.columns = make(map[string][]byte, n)
+	for i := uint(0); i < n; i++ {
+		name, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, err
+		}
+		l += ll
+		if l+sha256.Size > len(buf) {
+			return nil, errors.New("Invalid packed index hash")
+		}
+		e.columns[name] = append([]byte(nil), buf[l:l+sha256.Size]...)
+		l += sha256.Size
+	}
+	if l != len(buf) {
+		return nil, errors.New("Invalid packed index hash")
+	}
+	return e, nil
+}
+
+// indexHashDigests returns the digests of the writes of the write set to the columns, keyed by the index of the column;
+// only the last write of each key counts and the writes are ordered by the key, so that the digests do not depend
+// on the order, in which the block was written to the batch
+func indexHashDigests(records []indexDeltaRecord) map[int][]byte {
+	last := make(map[int]map[string]*indexDeltaRecord)
+	for i := range records {
+		r := &records[i]
+		m := last[r.column]
+		if m == nil {
+			m = make(map[string]*indexDeltaRecord)
+			last[r.column] = m
+		}
+		m[string(r.key)] = r
+	}
+	digests := make(map[int][]byte, len(last))
+	for column, m := range last {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var buf []byte
+		for _, k := range keys {
+			r := m[k]
+			buf = append(buf, r.op)
+			buf = packString(k, buf)
+			if r.op == indexDeltaPut {
+				buf = packString(string(r.value), buf)
+			}
+		}
+		h := sha256.Sum256(buf)
+		digests[column] = h[:]
+	}
+	return digests
+}
+
+// getIndexHashEntry returns the rolling hashes stored for the height, nil if there are none
+func (d *RocksDB) getIndexHashEntry(height uint32) (*indexHashEntry, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfIndexHash], packUint(height))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	return unpackIndexHashEntry(val.Data())
+}
+
+// storeIndexHash extends the rolling hashes of the previous block by the write set of the connected block
+// and removes the hashes of the block, which is no longer kept for the disconnect, unless it is a checkpoint.
+// If the hashes of the previous block are missing (the block was connected by the bulk import or the hashes were not enabled),
+// the hashes start from the block and are not complete until the next window.
+func (d *RocksDB) storeIndexHash(wb *gorocksdb.WriteBatch, height uint32, records []indexDeltaRecord) error {
+	if !d.indexHash {
+		return nil
+	}
+	e := &indexHashEntry{from: height, columns: make(map[string][]byte)}
+	if height != indexHashWindowStart(height) {
+		p, err := d.getIndexHashEntry(height - 1)
+		if err != nil {
+			return errors.Annotatef(err, "index hash of block %d", height-1)
+		}
+		if p != nil {
+			e = p
+		}
+	}
+	for column, digest := range indexHashDigests(records) {
+		name := cfNames[column]
+		h := sha256.New()
+		h.Write(e.columns[name])
+		h.Write(digest)
+		e.columns[name] = h.Sum(nil)
+	}
+	wb.PutCF(d.cfh[cfIndexHash], packUint(height), packIndexHashEntry(e))
+	if height >= IndexHashWindow {
+		old := height - IndexHashWindow
+		if old+1 != indexHashWindowStart(old+1) {
+			wb.DeleteCF(d.cfh[cfIndexHash], packUint(old))
+		}
+	}
+	return nil
+}
+
+// storeIndexHashOfBatch computes the rolling hashes of the connected block from the writes in the batch,
+// it must be called after all other writes of the block are in the batch
+func (d *RocksDB) storeIndexHashOfBatch(wb *gorocksdb.WriteBatch, height uint32) error {
+	if !d.indexHash {
+		return nil
+	}
+	records, err := d.writeSet(wb)
+	if err != nil {
+		return errors.Annotatef(err, "index hash of block %d", height)
+	}
+	return d.storeIndexHash(wb, height, records)
+}
+
+// GetIndexHash returns the rolling hashes of the columns of the db at the block height, nil if they are not available.
+// The hashes are kept for the last IndexHashWindow blocks and for the last blocks of the windows.
+// The Hash combines the hashes of all columns, the columns with the data specific to the configuration of the blockbook
+// (optional indexes, registered wallets) differ between the dbs and must be compared one by one.
+func (d *RocksDB) GetIndexHash(height uint32) (ih *IndexHash, err error) {
+	defer func(s time.Time) { d.observeMethod("GetIndexHash", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	e, err := d.getIndexHashEntry(height)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	ih = &IndexHash{
+		Height:     height,
+		FromHeight: e.from,
+		Complete:   e.from == indexHashWindowStart(height),
+		Columns:    make(map[string]string, len(e.columns)),
+	}
+	var buf []byte
+	for _, n := range sortedIndexHashColumns(e.columns) {
+		ih.Columns[n] = hex.EncodeToString(e.columns[n])
+		buf = packString(n, buf)
+		buf = append(buf, e.columns[n]...)
+	}
+	h := sha256.Sum256(buf)
+	ih.Hash = hex.EncodeToString(h[:])
+	return ih, nil
+}
@@ -0,0 +1,106 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"reflect"
+	"testing"
+)
+
+func TestIndexHashDigests(t *testing.T) {
+	records := []indexDeltaRecord{
+		{op: indexDeltaPut, column: cfHeight, key: []byte{1}, value: []byte{1}},
+		{op: indexDeltaPut, column: cfAddresses, key: []byte{2}, value: []byte{2}},
+		{op: indexDeltaPut, column: cfAddresses, key: []byte{1}, value: []byte{3}},
+	}
+	// the order of the writes does not matter, only the last write of the key counts
+	reordered := []indexDeltaRecord{
+		{op: indexDeltaPut, column: cfAddresses, key: []byte{1}, value: []byte{9}},
+		records[2],
+		records[1],
+		records[0],
+	}
+	got := indexHashDigests(records)
+	if len(got) != 2 {
+		t.Fatalf("indexHashDigests() returned %d columns, want 2", len(got))
+	}
+	if want := indexHashDigests(reordered); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexHashDigests() = %x, reordered %x", got, want)
+	}
+	changed := append([]indexDeltaRecord(nil), records...)
+	changed[1] = indexDeltaRecord{op: indexDeltaDelete, column: cfAddresses, key: []byte{2}}
+	c := indexHashDigests(changed)
+	if reflect.DeepEqual(c[cfAddresses], got[cfAddresses]) || !reflect.DeepEqual(c[cfHeight], got[cfHeight]) {
+		t.Errorf("indexHashDigests() of changed write set = %x, original %x", c, got)
+	}
+}
+
+func TestRocksDB_IndexHash(t *testing.T) {
+	var dbs []*RocksDB
+	for i := 0; i < 2; i++ {
+		d := setupRocksDB(t, &testBitcoinParser{
+			BitcoinParser: bitcoinTestnetParser(),
+		})
+		defer closeAndDestroyRocksDB(t, d)
+		d.SetIndexHash(true)
+		if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+		dbs = append(dbs, d)
+	}
+	d := dbs[0]
+	h1, err := d.GetIndexHash(225493)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := d.GetIndexHash(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 == nil || h2 == nil {
+		t.Fatalf("GetIndexHash() = %+v, %+v", h1, h2)
+	}
+	// the hashes start at the first connected block, which is not the start of the window
+	if h2.FromHeight != 225493 || h2.Complete {
+		t.Errorf("GetIndexHash(225494) from %d complete %v, want from 225493 not complete", h2.FromHeight, h2.Complete)
+	}
+	for _, c := range []string{"height", "addresses", "txAddresses", "addressBalance", "blockTxs"} {
+		if h1.Columns[c] == "" || h1.Columns[c] == h2.Columns[c] {
+			t.Errorf("column %v: hash %v at block 1, %v at block 2", c, h1.Columns[c], h2.Columns[c])
+		}
+	}
+	for _, c := range []string{"default", "indexDelta", "indexHash"} {
+		if _, found := h2.Columns[c]; found {
+			t.Errorf("column %v is hashed", c)
+		}
+	}
+	// the other db with the same blocks has the same hashes
+	o, err := dbs[1].GetIndexHash(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o, h2) {
+		t.Errorf("GetIndexHash(225494) of the other db = %+v, want %+v", o, h2)
+	}
+	if ih, err := d.GetIndexHash(225495); err != nil || ih != nil {
+		t.Errorf("GetIndexHash(225495) = %+v, %v, want nil", ih, err)
+	}
+
+	// the hashes of the disconnected block are removed and computed again when it is connected
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if ih, err := d.GetIndexHash(225494); err != nil || ih != nil {
+		t.Errorf("GetIndexHash(225494) after disconnect = %+v, %v, want nil", ih, err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if ih, err := d.GetIndexHash(225494); err != nil || !reflect.DeepEqual(ih, h2) {
+		t.Errorf("GetIndexHash(225494) after reconnect = %+v, %v, want %+v", ih, err, h2)
+	}
+}
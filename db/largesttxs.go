@@ -0,0 +1,213 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	// MaxLargestTxs is the number of the largest transactions kept for each block
+	MaxLargestTxs = 100
+	// MaxLargestTxsWindow is the number of the last blocks, for which the largest transactions are kept
+	MaxLargestTxsWindow = 2016
+)
+
+// LargestTx is the transaction of the block with the total value of its outputs
+type LargestTx struct {
+	Txid     string
+	Height   uint32
+	ValueSat big.Int
+}
+
+// SetLargestTxs enables keeping the largest transactions of the last MaxLargestTxsWindow blocks during block connect,
+// the blocks connected before it was enabled have no largest transactions
+func (d *RocksDB) SetLargestTxs(enabled bool) {
+	d.largestTxs = enabled
+}
+
+// LargestTxsEnabled returns true if the largest transactions of the blocks are kept
+func (d *RocksDB) LargestTxsEnabled() bool {
+	return d.largestTxs
+}
+
+// computeLargestTxs returns at most MaxLargestTxs transactions of the block with the highest total value of the outputs,
+// ordered from the largest; the coinbase transactions are skipped; nil if the largest transactions are not kept
+func (d *RocksDB) computeLargestTxs(block *bchain.Block) []LargestTx {
+	if !d.largestTxs {
+		return nil
+	}
+	txs := make([]LargestTx, 0, len(block.Txs))
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		if len(tx.Vin) > 0 && tx.Vin[0].Coinbase != "" {
+			continue
+		}
+		lt := LargestTx{Txid: tx.Txid, Height: block.Height}
+		for j := range tx.Vout {
+			lt.ValueSat.Add(&lt.ValueSat, &tx.Vout[j].ValueSat)
+		}
+		if lt.ValueSat.Sign() > 0 {
+			txs = append(txs, lt)
+		}
+	}
+	return limitLargestTxs(txs)
+}
+
+// computeShardLargestTxs is computeLargestTxs of the block unpacked from the shard db by the sharded sync,
+// the block contains only the inputs of the transactions, the values of the outputs are taken from blockTxAddresses
+// and the coinbase transaction is recognized by the missing txid of its input
+func (d *RocksDB) computeShardLargestTxs(block *bchain.Block, blockTxAddresses []*TxAddresses) []LargestTx {
+	if !d.largestTxs {
+		return nil
+	}
+	txs := make([]LargestTx, 0, len(block.Txs))
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		if len(tx.Vin) > 0 && tx.Vin[0].Txid == "" {
+			continue
+		}
+		lt := LargestTx{Txid: tx.Txid, Height: block.Height}
+		for j := range blockTxAddresses[i].Outputs {
+			lt.ValueSat.Add(&lt.ValueSat, &blockTxAddresses[i].Outputs[j].ValueSat)
+		}
+		if lt.ValueSat.Sign() > 0 {
+			txs = append(txs, lt)
+		}
+	}
+	return limitLargestTxs(txs)
+}
+
+// limitLargestTxs orders the transactions from the largest and keeps at most MaxLargestTxs of them
+func limitLargestTxs(txs []LargestTx) []LargestTx {
+	sortLargestTxs(txs)
+	if len(txs) > MaxLargestTxs {
+		txs = txs[:MaxLargestTxs]
+	}
+	return txs
+}
+
+// sortLargestTxs orders the transactions by the value from the largest, the equal values by the height from the newest
+func sortLargestTxs(txs []LargestTx) {
+	sort.SliceStable(txs, func(i, j int) bool {
+		if c := txs[i].ValueSat.Cmp(&txs[j].ValueSat); c != 0 {
+			return c > 0
+		}
+		return txs[i].Height > txs[j].Height
+	})
+}
+
+func (d *RocksDB) packLargestTxs(txs []LargestTx) ([]byte, error) {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(len(txs)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	for i := range txs {
+		btxID, err := d.chainParser.PackTxid(txs[i].Txid)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, btxID...)
+		l = packBigint(&txs[i].ValueSat, varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf, nil
+}
+
+func (d *RocksDB) unpackLargestTxs(height uint32, buf []byte) ([]LargestTx, error) {
+	txidLen := d.chainParser.PackedTxidLen()
+	n, l := unpackVaruint(buf)
+	if l <= 0 {
+		return nil, errors.New("Invalid packed largest txs")
+	}
+	txs := make([]LargestTx, n)
+	for i := range txs {
+		if l+txidLen >= len(buf) || l+txidLen+1+int(buf[l+txidLen]) > len(buf) {
+			return nil, errors.New("Invalid packed largest txs")
+		}
+		txid, err := d.chainParser.UnpackTxid(buf[l : l+txidLen])
+		if err != nil {
+			return nil, err
+		}
+		l += txidLen
+		txs[i].Txid = txid
+		txs[i].Height = height
+		var ll int
+		txs[i].ValueSat, ll = unpackBigint(buf[l:])
+		l += ll
+	}
+	if l != len(buf) {
+		return nil, errors.New("Invalid packed largest txs")
+	}
+	return txs, nil
+}
+
+// storeLargestTxs stores the largest transactions of the connected block and removes those of the block,
+// which fell out of the window; nothing is written if the largest transactions are not kept
+func (d *RocksDB) storeLargestTxs(wb *gorocksdb.WriteBatch, height uint32, txs []LargestTx) error {
+	if !d.largestTxs {
+		return nil
+	}
+	if len(txs) > 0 {
+		buf, err := d.packLargestTxs(txs)
+		if err != nil {
+			return err
+		}
+		wb.PutCF(d.cfh[cfLargestTxs], packUint(height), buf)
+	}
+	if height >= MaxLargestTxsWindow {
+		wb.DeleteCF(d.cfh[cfLargestTxs], packUint(height-MaxLargestTxsWindow))
+	}
+	return nil
+}
+
+// GetLargestTxs returns at most n transactions with the highest total value of the outputs in the last window blocks
+// up to the best block, ordered from the largest; window and n are limited by MaxLargestTxsWindow and MaxLargestTxs
+func (d *RocksDB) GetLargestTxs(window uint32, n int) (txs []LargestTx, err error) {
+	defer func(s time.Time) { d.observeMethod("GetLargestTxs", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	if window > MaxLargestTxsWindow {
+		window = MaxLargestTxsWindow
+	}
+	if n > MaxLargestTxs {
+		n = MaxLargestTxs
+	}
+	best, _, err := d.GetBestBlock()
+	if err != nil || window == 0 || n <= 0 {
+		return nil, err
+	}
+	var lower uint32
+	if best >= window {
+		lower = best - window + 1
+	}
+	kstop := packUint(best)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfLargestTxs])
+	defer it.Close()
+	for it.Seek(packUint(lower)); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		bt, err := d.unpackLargestTxs(unpackUint(key), it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		// the transactions of the block are ordered, only the first n can get to the result
+		if len(bt) > n {
+			bt = bt[:n]
+		}
+		txs = append(txs, bt...)
+	}
+	sortLargestTxs(txs)
+	if len(txs) > n {
+		txs = txs[:n]
+	}
+	return txs, nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"runtime/debug"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// MemoryProfile sets the sizes of the rocksdb buffers and of the data kept in memory by the bulk connect
+type MemoryProfile struct {
+	Name string
+	// WriteBufferSize is the size of the rocksdb memtable of each column
+	WriteBufferSize int
+	// MaxTotalWriteBufferSize is the limit of the memtables of all columns together, when it is reached,
+	// rocksdb flushes the memtables, so that the sum of the budgets of the columns does not exceed it
+	MaxTotalWriteBufferSize int
+	// MaxBytesForLevelBase is the maximum total size of the rocksdb level 1
+	MaxBytesForLevelBase uint64
+	// MaxBackgroundJobs is the maximum number of background compactions and the maximum number of background flushes
+	MaxBackgroundJobs int
+	// MaxBulkAddresses is the number of addresses, after which the bulk connect stores the addresses to db
+	MaxBulkAddresses int
+	// MaxBulkTxAddresses is the number of txAddresses, after which the bulk connect stores part of them to db
+	MaxBulkTxAddresses int
+	// MaxBulkBalances is the number of balances, after which the bulk connect stores part of them to db
+	MaxBulkBalances int
+	// FreeOSMemory forces garbage collection and return of the freed memory to the OS after each store of the bulk connect
+	FreeOSMemory bool
+}
+
+// DefaultMemoryProfile is suitable for servers indexing large chains
+var DefaultMemoryProfile = MemoryProfile{
+	Name:                    "default",
+	WriteBufferSize:         1 << 27, // 128MB
+	MaxTotalWriteBufferSize: 1 << 30, // 1GB
+	MaxBytesForLevelBase:    1 << 27, // 128MB
+	MaxBackgroundJobs:       6,
+	MaxBulkAddresses:        200000,
+	MaxBulkTxAddresses:      500000,
+	MaxBulkBalances:         800000,
+}
+
+// LowMemoryProfile is intended for hosts with 2-4GB RAM (ARM boards, small VPS) indexing small chains
+var LowMemoryProfile = MemoryProfile{
+	Name:                    "lowmem",
+	WriteBufferSize:         1 << 24, // 16MB
+	MaxTotalWriteBufferSize: 1 << 28, // 256MB
+	MaxBytesForLevelBase:    1 << 26, // 64MB
+	MaxBackgroundJobs:       2,
+	MaxBulkAddresses:        20000,
+	MaxBulkTxAddresses:      50000,
+	MaxBulkBalances:         80000,
+	FreeOSMemory:            true,
+}
+
+var memoryProfile = DefaultMemoryProfile
+
+// validate checks that the limits of the profile are set and consistent
+func (p *MemoryProfile) validate() error {
+	if p.WriteBufferSize <= 0 || p.MaxBackgroundJobs <= 0 || p.MaxBulkAddresses <= 0 || p.MaxBulkTxAddresses <= 0 || p.MaxBulkBalances <= 0 {
+		return errors.Errorf("Memory profile %v: the limits must be positive", p.Name)
+	}
+	if p.MaxTotalWriteBufferSize < p.WriteBufferSize {
+		return errors.Errorf("Memory profile %v: the total write buffer size %v is lower than the write buffer size of a column %v", p.Name, p.MaxTotalWriteBufferSize, p.WriteBufferSize)
+	}
+	return nil
+}
+
+// SetMemoryProfile sets the memory profile, it must be called before the db is opened
+func SetMemoryProfile(p MemoryProfile) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	memoryProfile = p
+	glog.Info("rocksdb: using memory profile ", p.Name, ", write buffers ", p.WriteBufferSize, " per column, ", p.MaxTotalWriteBufferSize, " total")
+	return nil
+}
+
+// freeOSMemory returns the freed memory to the OS if the memory profile requires it
+func freeOSMemory() {
+	if memoryProfile.FreeOSMemory {
+		debug.FreeOSMemory()
+	}
+}
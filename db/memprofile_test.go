@@ -0,0 +1,111 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"testing"
+)
+
+func TestMemoryProfile_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile MemoryProfile
+		wantErr bool
+	}{
+		{
+			name:    "default",
+			profile: DefaultMemoryProfile,
+		},
+		{
+			name:    "lowmem",
+			profile: LowMemoryProfile,
+		},
+		{
+			name:    "total lower than column",
+			profile: MemoryProfile{Name: "x", WriteBufferSize: 1 << 24, MaxTotalWriteBufferSize: 1 << 23, MaxBackgroundJobs: 1, MaxBulkAddresses: 1, MaxBulkTxAddresses: 1, MaxBulkBalances: 1},
+			wantErr: true,
+		},
+		{
+			name:    "missing total",
+			profile: MemoryProfile{Name: "x", WriteBufferSize: 1 << 24, MaxBackgroundJobs: 1, MaxBulkAddresses: 1, MaxBulkTxAddresses: 1, MaxBulkBalances: 1},
+			wantErr: true,
+		},
+		{
+			name:    "zero bulk limit",
+			profile: MemoryProfile{Name: "x", WriteBufferSize: 1 << 24, MaxTotalWriteBufferSize: 1 << 28, MaxBackgroundJobs: 1, MaxBulkAddresses: 1, MaxBulkTxAddresses: 0, MaxBulkBalances: 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetMemoryProfile(t *testing.T) {
+	defer SetMemoryProfile(DefaultMemoryProfile)
+	if err := SetMemoryProfile(LowMemoryProfile); err != nil {
+		t.Fatal(err)
+	}
+	invalid := LowMemoryProfile
+	invalid.Name = "invalid"
+	invalid.MaxTotalWriteBufferSize = invalid.WriteBufferSize - 1
+	if err := SetMemoryProfile(invalid); err == nil {
+		t.Error("SetMemoryProfile() of invalid profile expected error")
+	}
+	if memoryProfile.Name != LowMemoryProfile.Name {
+		t.Errorf("memory profile %v, want %v", memoryProfile.Name, LowMemoryProfile.Name)
+	}
+}
+
+// the bulk connect storing the data in the smallest batches produces the same db as the connect of the blocks
+func Test_BulkConnect_UTXO_SmallBatches(t *testing.T) {
+	small := LowMemoryProfile
+	small.Name = "small"
+	small.MaxBulkAddresses = 2
+	small.MaxBulkTxAddresses = 10
+	small.MaxBulkBalances = 10
+	if err := SetMemoryProfile(small); err != nil {
+		t.Fatal(err)
+	}
+	defer SetMemoryProfile(DefaultMemoryProfile)
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetBlockSupply(true)
+
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.maxBulkAddresses != 2 || bc.partialStoreAddresses != 1 || bc.partialStoreBalances != 1 {
+		t.Errorf("InitBulkConnect() limits %v %v %v, want 2 1 1", bc.maxBulkAddresses, bc.partialStoreAddresses, bc.partialStoreBalances)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterUTXOBlock2(t, d)
+	// the totals of the supply continue over the blocks of the bulk
+	is, err := d.GetIndexedSupply(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is == nil || is.FromHeight != 225493 || is.Blocks != 2 || is.OutputsSat.Int64() != 2787879804798 || is.InputsSat.Int64() != 1551851863406 {
+		t.Errorf("GetIndexedSupply(225494) = %+v", is)
+	}
+	// the next connected block continues from the supply of the last block of the bulk kept in memory
+	if d.lastSupply == nil || d.lastSupply.Height != 225494 {
+		t.Errorf("lastSupply = %+v, want the supply of block 225494", d.lastSupply)
+	}
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"bufio"
+	"encoding/hex"
+	"os"
+	"strings"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// MaxMethodSignatures is the maximum number of the signatures of one selector, the selectors of different signatures may collide
+const MaxMethodSignatures = 16
+
+// the dictionary of the method signatures maps the 4 byte selectors of the contract methods to their signatures,
+// it is seeded from the file given by the parameter -methodsignatures and extended by the endpoint admin/method-signatures
+// of the internal server, the signatures added by the endpoint are stored in the methodSignatures column
+
+func packMethodSignatures(signatures []string) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	l := packVaruint(uint(len(signatures)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	for _, s := range signatures {
+		buf = packString(s, buf)
+	}
+	return buf
+}
+
+func unpackMethodSignatures(buf []byte) ([]string, error) {
+	invalid := errors.New("Invalid packed method signatures")
+	n, l := unpackVaruint(buf)
+	if l <= 0 || n > MaxMethodSignatures {
+		return nil, invalid
+	}
+	r := make([]string, n)
+	for i := range r {
+		s, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, err
+		}
+		r[i] = s
+		l += ll
+	}
+	if l != len(buf) {
+		return nil, invalid
+	}
+	return r, nil
+}
+
+// packSelector converts the selector in the form 0x12345678 to the key of the methodSignatures column
+func packSelector(selector string) ([]byte, error) {
+	if !strings.HasPrefix(selector, "0x") {
+		return nil, errors.Errorf("Invalid selector '%v', expecting 0x followed by 8 hex digits", selector)
+	}
+	b, err := hex.DecodeString(selector[2:])
+	if err != nil || len(b) != 4 {
+		return nil, errors.Errorf("Invalid selector '%v', expecting 0x followed by 8 hex digits", selector)
+	}
+	return b, nil
+}
+
+// LoadMethodSignatures seeds the dictionary of the method signatures from the file, which contains one signature per line,
+// optionally preceded by its selector (the format of the public dictionaries); empty lines and lines starting by # are skipped.
+// The signatures, which cannot be parsed by the chain parser or do not match the given selector, are skipped too.
+// It must be called before the dictionary is used and returns the number of the loaded signatures.
+func (d *RocksDB) LoadMethodSignatures(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	seeds := make(map[string][]string)
+	loaded, skipped := 0, 0
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		signature := fields[len(fields)-1]
+		selector, err := d.chainParser.GetMethodSelector(signature)
+		if err != nil || len(fields) > 2 || len(fields) == 2 && strings.ToLower(fields[0]) != selector {
+			skipped++
+			continue
+		}
+		if !containsString(seeds[selector], signature) && len(seeds[selector]) < MaxMethodSignatures {
+			seeds[selector] = append(seeds[selector], signature)
+			loaded++
+		}
+	}
+	if err = s.Err(); err != nil {
+		return 0, errors.Annotatef(err, "method signatures file %v", file)
+	}
+	if skipped > 0 {
+		glog.Warningf("method signatures file %v: skipped %d invalid lines", file, skipped)
+	}
+	d.methodSignatures = seeds
+	return loaded, nil
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *RocksDB) getStoredMethodSignatures(key []byte) ([]string, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfMethodSignatures], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if val.Size() == 0 {
+		return nil, nil
+	}
+	return unpackMethodSignatures(val.Data())
+}
+
+// AddMethodSignature stores the signature of a contract method in the dictionary and returns its selector,
+// the signatures already loaded from the file are not stored
+func (d *RocksDB) AddMethodSignature(signature string) (selector string, err error) {
+	defer func(s time.Time) { d.observeMethod("AddMethodSignature", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	if selector, err = d.chainParser.GetMethodSelector(signature); err != nil {
+		return "", err
+	}
+	if containsString(d.methodSignatures[selector], signature) {
+		return selector, nil
+	}
+	key, err := packSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	d.methodSignaturesMux.Lock()
+	defer d.methodSignaturesMux.Unlock()
+	signatures, err := d.getStoredMethodSignatures(key)
+	if err != nil {
+		return "", err
+	}
+	if containsString(signatures, signature) {
+		return selector, nil
+	}
+	if len(signatures) >= MaxMethodSignatures {
+		return "", errors.Errorf("Selector %v has already %d signatures", selector, MaxMethodSignatures)
+	}
+	signatures = append(signatures, signature)
+	return selector, d.db.PutCF(d.wo, d.cfh[cfMethodSignatures], key, packMethodSignatures(signatures))
+}
+
+// RemoveMethodSignature removes the signature added by AddMethodSignature, it returns false if the signature is not stored;
+// the signatures loaded from the file cannot be removed
+func (d *RocksDB) RemoveMethodSignature(signature string) (removed bool, err error) {
+	defer func(s time.Time) { d.observeMethod("RemoveMethodSignature", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	selector, err := d.chainParser.GetMethodSelector(signature)
+	if err != nil {
+		return false, err
+	}
+	key, err := packSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	d.methodSignaturesMux.Lock()
+	defer d.methodSignaturesMux.Unlock()
+	signatures, err := d.getStoredMethodSignatures(key)
+	if err != nil {
+		return false, err
+	}
+	r := make([]string, 0, len(signatures))
+	for _, s := range signatures {
+		if s != signature {
+			r = append(r, s)
+		}
+	}
+	if len(r) == len(signatures) {
+		return false, nil
+	}
+	if len(r) == 0 {
+		return true, d.db.DeleteCF(d.wo, d.cfh[cfMethodSignatures], key)
+	}
+	return true, d.db.PutCF(d.wo, d.cfh[cfMethodSignatures], key, packMethodSignatures(r))
+}
+
+// GetMethodSignatures returns the known signatures of the selector (in the form 0x12345678), the signatures loaded
+// from the file first, then the signatures added by AddMethodSignature in the order, in which they were added
+func (d *RocksDB) GetMethodSignatures(selector string) (r []string, err error) {
+	defer func(s time.Time) { d.observeMethod("GetMethodSignatures", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	key, err := packSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	selector = "0x" + hex.EncodeToString(key)
+	r = append(r, d.methodSignatures[selector]...)
+	signatures, err := d.getStoredMethodSignatures(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range signatures {
+		if !containsString(r, s) {
+			r = append(r, s)
+		}
+	}
+	return r, nil
+}
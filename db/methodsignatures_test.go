@@ -0,0 +1,83 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/bchain/coins/eth"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRocksDB_MethodSignatures(t *testing.T) {
+	d := setupRocksDB(t, eth.NewEthereumParser())
+	defer closeAndDestroyRocksDB(t, d)
+
+	f, err := ioutil.TempFile("", "methodsignatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	// the second transfer line is a duplicate, the approve line has a wrong selector and the last line an invalid signature
+	f.WriteString("# seed\n" +
+		"0xa9059cbb transfer(address,uint256)\n" +
+		"transfer(address,uint256)\n" +
+		"\n" +
+		"0x12345678 approve(address,uint256)\n" +
+		"0x23B872DD transferFrom(address,address,uint256)\n" +
+		"invalid(foo)\n")
+	f.Close()
+	n, err := d.LoadMethodSignatures(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("LoadMethodSignatures() = %d, want 2", n)
+	}
+
+	if _, err := d.AddMethodSignature("invalid(foo)"); err == nil {
+		t.Error("AddMethodSignature(invalid(foo)) expected error")
+	}
+	selector, err := d.AddMethodSignature("approve(address,uint256)")
+	if err != nil || selector != "0x095ea7b3" {
+		t.Errorf("AddMethodSignature(approve) = %v, %v, want 0x095ea7b3", selector, err)
+	}
+	// the seeded signature is not stored again
+	if _, err := d.AddMethodSignature("transfer(address,uint256)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		selector string
+		want     []string
+	}{
+		{"0xa9059cbb", []string{"transfer(address,uint256)"}},
+		{"0x23b872dd", []string{"transferFrom(address,address,uint256)"}},
+		{"0x095EA7B3", []string{"approve(address,uint256)"}},
+		{"0x00000000", nil},
+	} {
+		got, err := d.GetMethodSignatures(tt.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetMethodSignatures(%v) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+	if _, err := d.GetMethodSignatures("a9059cbb"); err == nil {
+		t.Error("GetMethodSignatures(a9059cbb) expected error")
+	}
+
+	removed, err := d.RemoveMethodSignature("approve(address,uint256)")
+	if err != nil || !removed {
+		t.Errorf("RemoveMethodSignature(approve) = %v, %v, want true", removed, err)
+	}
+	if got, err := d.GetMethodSignatures("0x095ea7b3"); err != nil || len(got) != 0 {
+		t.Errorf("GetMethodSignatures(0x095ea7b3) after remove = %v, %v, want empty", got, err)
+	}
+	// the seeded signatures cannot be removed
+	removed, err = d.RemoveMethodSignature("transferFrom(address,address,uint256)")
+	if err != nil || removed {
+		t.Errorf("RemoveMethodSignature(transferFrom) = %v, %v, want false", removed, err)
+	}
+}
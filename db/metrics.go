@@ -0,0 +1,38 @@
+package db
+
+import (
+	"blockbook/common"
+	"time"
+)
+
+// observeMethod records the duration and the outcome of the db method, the metrics are optional (nil in tests and tools)
+func (d *RocksDB) observeMethod(method string, start time.Time, err error) {
+	if d.metrics == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	d.metrics.DbRequests.With(common.Labels{"method": method, "status": status}).Inc()
+	d.metrics.DbReqDuration.With(common.Labels{"method": method, "status": status}).Observe(float64(time.Since(start)) / 1e6) // in milliseconds
+}
+
+// observeConnectBlockStats adds the connect block stats gathered since the last call to the metrics
+// and counts the block at height connected in duration to the window of the connect block stats
+func (d *RocksDB) observeConnectBlockStats(height uint32, duration time.Duration) {
+	if d.metrics != nil {
+		add := func(stat string, v, reported int) {
+			if v > reported {
+				d.metrics.ConnectBlockStats.With(common.Labels{"stat": stat}).Add(float64(v - reported))
+			}
+		}
+		add("txAddressesHit", d.cbs.txAddressesHit, d.cbsReported.txAddressesHit)
+		add("txAddressesCacheHit", d.cbs.txAddressesCacheHit, d.cbsReported.txAddressesCacheHit)
+		add("txAddressesMiss", d.cbs.txAddressesMiss, d.cbsReported.txAddressesMiss)
+		add("balancesHit", d.cbs.balancesHit, d.cbsReported.balancesHit)
+		add("balancesMiss", d.cbs.balancesMiss, d.cbsReported.balancesMiss)
+	}
+	d.cbsReported = d.cbs
+	d.addConnectBlockStatsWindow(height, duration)
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"blockbook/common"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/tecbot/gorocksdb"
+)
+
+// db version 3, the last version before the current format: the outpoints in the addresses column are stored
+// as the simple list of txid+index, the db has no heightAddresses column and the transactions duplicating
+// an earlier txid are stored under the txid, overwriting the earlier transaction in the txAddresses column;
+// the values of the txAddresses column are valid in the current format and are not converted
+const dbVersionV3 = 3
+
+// number of rows written in one batch during the migration
+const migrateBatchRows = 100000
+
+// canMigrate returns true if the db of given version can be migrated to the current version
+func canMigrate(version uint32) bool {
+	return version == dbVersionV3
+}
+
+// migrate converts the db from the given version to the current version
+// the db is marked inconsistent during the migration so that an interrupted migration is detected on the next start
+func (d *RocksDB) migrate(is *common.InternalState, from uint32) error {
+	glog.Info("rocksdb: migrating db from version ", from, " to version ", dbVersion)
+	state := is.GetDbState()
+	is.SetDbState(common.DbStateInconsistent)
+	if err := d.storeState(is); err != nil {
+		return err
+	}
+	// convert the outpoints in the addresses column to the format packed by packAddressOutpoints
+	if err := d.migrateColumnOutpoints(cfAddresses, d.unpackOutpoints); err != nil {
+		return err
+	}
+	if err := d.migrateHeightAddresses(); err != nil {
+		return err
+	}
+	// the column built by the migration contains the data from the start of the addresses column,
+	// not only the blocks connected after the column was created
+	is.DbColumns[cfHeightAddresses].FromHeight = is.DbColumns[cfAddresses].FromHeight
+	glog.Info("rocksdb: column heightAddresses contains data from height ", is.DbColumns[cfHeightAddresses].FromHeight)
+	if err := d.migrateDuplicateTxids(); err != nil {
+		return err
+	}
+	is.SetDbState(state)
+	if err := d.storeState(is); err != nil {
+		return err
+	}
+	glog.Info("rocksdb: migration to version ", dbVersion, " finished")
+	return nil
+}
+
+// migrateColumnOutpoints repacks the outpoints of the column unpacked by the function of the old version,
+// the sizes of the values before and after are logged
+func (d *RocksDB) migrateColumnOutpoints(col int, unpack func([]byte) ([]outpoint, error)) error {
+	start := time.Now()
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	it := d.db.NewIteratorCF(ro, d.cfh[col])
+	defer it.Close()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	var rows, oldBytes, newBytes int64
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		val := it.Value().Data()
+		outpoints, err := unpack(val)
+		if err != nil {
+			return err
+		}
+		packed := d.packAddressOutpoints(outpoints)
+		wb.PutCF(d.cfh[col], append([]byte(nil), it.Key().Data()...), packed)
+		rows++
+		oldBytes += int64(len(val))
+		newBytes += int64(len(packed))
+		if rows%migrateBatchRows == 0 {
+			if err := d.db.Write(d.wo, wb); err != nil {
+				return err
+			}
+			wb.Clear()
+			glog.Info("rocksdb: migrated ", rows, " rows of column ", cfNames[col])
+		}
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return err
+	}
+	glog.Info("rocksdb: column ", cfNames[col], " migrated, ", rows, " rows, values size ", oldBytes, " -> ", newBytes, " bytes, done in ", time.Since(start))
+	return nil
+}
+
+// migrateHeightAddresses builds the heightAddresses column from the addresses column
+func (d *RocksDB) migrateHeightAddresses() error {
+	start := time.Now()
+	ro := gorocksdb.NewDefaultReadOptions()
+	defer ro.Destroy()
+	ro.SetFillCache(false)
+	it := d.db.NewIteratorCF(ro, d.cfh[cfAddresses])
+	defer it.Close()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	var rows int64
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		addrDesc, height, err := unpackAddressKey(it.Key().Data())
+		if err != nil {
+			return err
+		}
+		wb.PutCF(d.cfh[cfHeightAddresses], packHeightAddressKey(height, addrDesc), []byte{})
+		rows++
+		if rows%migrateBatchRows == 0 {
+			if err := d.db.Write(d.wo, wb); err != nil {
+				return err
+			}
+			wb.Clear()
+			glog.Info("rocksdb: indexed ", rows, " rows of column addresses")
+		}
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return err
+	}
+	glog.Info("rocksdb: column heightAddresses built, ", rows, " rows, done in ", time.Since(start))
+	return nil
+}
+
+// migrateDuplicateTxids moves the duplicate transactions flagged by the parser to the key txid+height and restores
+// the earlier transactions overwritten by them; a duplicate has the same txid and therefore the same content as
+// the earlier transaction, only the height differs, the height is found in the addresses column of its first output
+func (d *RocksDB) migrateDuplicateTxids() error {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 1024)
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for txid, height := range d.chainParser.GetDuplicateTxids() {
+		btxID, err := d.chainParser.PackTxid(txid)
+		if err != nil {
+			return err
+		}
+		key := duplicateTxAddressesKey(btxID, height)
+		ta, err := d.getTxAddresses(key)
+		if err != nil {
+			return err
+		}
+		if ta != nil {
+			continue
+		}
+		if ta, err = d.getTxAddresses(btxID); err != nil {
+			return err
+		}
+		if ta == nil || ta.Height != height {
+			continue
+		}
+		wb.PutCF(d.cfh[cfTxAddresses], key, packTxAddresses(ta, buf, varBuf))
+		var earlier uint32
+		for i := range ta.Outputs {
+			if len(ta.Outputs[i].AddrDesc) == 0 || height == 0 {
+				continue
+			}
+			err = d.GetAddrDescHeightTransactionsReverse(ta.Outputs[i].AddrDesc, 0, height-1, func(h uint32, txids []string) error {
+				for _, t := range txids {
+					if t == txid {
+						earlier = h
+						return &StopIteration{}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if earlier == 0 {
+			// the earlier transaction is not in the index, the db was synchronized from a later height
+			wb.DeleteCF(d.cfh[cfTxAddresses], btxID)
+			glog.Info("rocksdb: duplicate tx ", txid, " moved from the key of the earlier transaction not in the index")
+			continue
+		}
+		ta.Height = earlier
+		for i := range ta.Outputs {
+			ta.Outputs[i].Spent = false
+		}
+		wb.PutCF(d.cfh[cfTxAddresses], btxID, packTxAddresses(ta, buf, varBuf))
+		glog.Info("rocksdb: duplicate tx ", txid, " in block ", height, " separated from the earlier transaction in block ", earlier)
+	}
+	return d.db.Write(d.wo, wb)
+}
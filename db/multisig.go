@@ -0,0 +1,854 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	// DefaultMultisigLookahead is the number of not yet used addresses derived from each ranged descriptor of a multisig wallet
+	DefaultMultisigLookahead = 100
+	// MaxMultisigLookahead is the maximum lookahead of a multisig wallet
+	MaxMultisigLookahead = 10000
+	// MaxMultisigDescriptors is the maximum number of descriptors of a multisig wallet
+	MaxMultisigDescriptors = 10
+	maxMultisigNameLen     = 64
+	minMultisigTokenLen    = 16
+	maxMultisigTokenLen    = 64
+)
+
+const (
+	// MultisigEventFunding is an output paying to an address of the multisig wallet
+	MultisigEventFunding = "funding"
+	// MultisigEventSpend is an input spending an output of the multisig wallet
+	MultisigEventSpend = "spend"
+)
+
+const (
+	multisigEventSpendFlag        = 1
+	multisigEventDisconnectedFlag = 2
+)
+
+const (
+	// the events found by the scan of the history have the sequence numbers height<<multisigHistorySeqBits + the order
+	// of the event in the block, the events of the connected blocks and of the mempool follow them from multisigLiveSeq,
+	// so that the feed is ordered by the height (the sequence numbers stay below 2^53, which is safe in javascript)
+	multisigHistorySeqBits = 20
+	multisigLiveSeq        = 1 << 52
+)
+
+// MultisigWallet is a multisig wallet given by output descriptors (typically the receive and the change descriptor),
+// the co-signers are notified when its addresses are funded and when its outputs are spent in the mempool and in the blocks.
+// If the Birthday height (or the BirthdayTime, which is converted to the height at registration) is set, the history
+// of the wallet from the birthday to the best block at registration is scanned in background, Scan is its progress.
+// The feed of the wallet is public only to the holders of the Token, which is generated at registration if not given.
+type MultisigWallet struct {
+	Name         string        `json:"name"`
+	Token        string        `json:"token,omitempty"`
+	Descriptors  []string      `json:"descriptors"`
+	Lookahead    uint32        `json:"lookahead,omitempty"`
+	Webhook      string        `json:"webhook,omitempty"`
+	Birthday     uint32        `json:"birthday,omitempty"`
+	BirthdayTime int64         `json:"birthdayTime,omitempty"`
+	Scan         *MultisigScan `json:"scan,omitempty"`
+}
+
+// MultisigEvent is a record of the activity feed of a multisig wallet, Height is 0 for transactions in the mempool,
+// Descriptor is the index of the descriptor of the wallet and Index is the derivation index of the address,
+// the events of the blocks disconnected by a reorg are kept in the feed marked as Disconnected
+type MultisigEvent struct {
+	Seq          uint64                   `json:"seq"`
+	Wallet       string                   `json:"wallet"`
+	Type         string                   `json:"type"`
+	Txid         string                   `json:"txid"`
+	Address      string                   `json:"address"`
+	Descriptor   int                      `json:"descriptor"`
+	Index        uint32                   `json:"index"`
+	Height       uint32                   `json:"height,omitempty"`
+	Time         int64                    `json:"time"`
+	Disconnected bool                     `json:"disconnected,omitempty"`
+	Webhook      string                   `json:"-"`
+	Token        string                   `json:"-"`
+	AddrDesc     bchain.AddressDescriptor `json:"-"`
+}
+
+// OnMultisigEventsFunc is used to send notification about the new events of the multisig wallets
+type OnMultisigEventsFunc func(events []MultisigEvent)
+
+type multisigWallet struct {
+	MultisigWallet
+	// used is the number of used addresses (the highest used index + 1) of each descriptor
+	used []uint32
+	// derived is the number of addresses derived from each descriptor
+	derived []uint32
+	nextSeq uint64
+	// scanned is the last scanned block of the history of the wallet, the history is scanned up to scanTo
+	scanned uint32
+	scanTo  uint32
+	// addrDescs are the keys of the wallet in multisigWallets.addrs
+	addrDescs []string
+}
+
+type multisigAddr struct {
+	wallet     *multisigWallet
+	descriptor int
+	index      uint32
+}
+
+type multisigWallets struct {
+	// count is checked without lock when a block is connected or a mempool transaction is found
+	count    int32
+	mux      sync.Mutex
+	wallets  map[string]*multisigWallet
+	addrs    map[string][]multisigAddr
+	onEvents OnMultisigEventsFunc
+	// pending are the events found in the block being connected
+	pending []MultisigEvent
+	// scanStop stops the scan of the history of the wallets, it is nil if the scan is not running
+	scanStop chan struct{}
+	scanWg   sync.WaitGroup
+}
+
+func validMultisigWalletName(name string) bool {
+	if len(name) == 0 || len(name) > maxMultisigNameLen {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func validMultisigToken(token string) bool {
+	if len(token) < minMultisigTokenLen || len(token) > maxMultisigTokenLen {
+		return false
+	}
+	for _, c := range token {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func newMultisigToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func packMultisigWallet(mw *multisigWallet) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := packString(mw.Name, nil)
+	l := packVaruint(uint(len(mw.Descriptors)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for i, desc := range mw.Descriptors {
+		buf = packString(desc, buf)
+		l = packVaruint(uint(mw.used[i]), varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	l = packVaruint(uint(mw.Lookahead), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = packString(mw.Webhook, buf)
+	l = packVaruint(uint(mw.nextSeq), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	// the scan of the history is stored only for the wallets with birthday or token, the token follows the scan
+	if mw.Birthday != 0 || mw.Token != "" {
+		for _, v := range []uint32{mw.Birthday, mw.scanned, mw.scanTo} {
+			l = packVaruint(uint(v), varBuf)
+			buf = append(buf, varBuf[:l]...)
+		}
+	}
+	if mw.Token != "" {
+		buf = packString(mw.Token, buf)
+	}
+	return buf
+}
+
+func unpackMultisigWallet(buf []byte) (*multisigWallet, error) {
+	invalid := errors.New("Invalid packed multisig wallet")
+	mw := &multisigWallet{}
+	var l, ll int
+	var err error
+	if mw.Name, l, err = unpackString(buf); err != nil {
+		return nil, err
+	}
+	n, ll := unpackVaruint(buf[l:])
+	if ll <= 0 || n > MaxMultisigDescriptors {
+		return nil, invalid
+	}
+	l += ll
+	mw.Descriptors = make([]string, n)
+	mw.used = make([]uint32, n)
+	mw.derived = make([]uint32, n)
+	for i := range mw.Descriptors {
+		if mw.Descriptors[i], ll, err = unpackString(buf[l:]); err != nil {
+			return nil, err
+		}
+		l += ll
+		var u uint
+		if u, ll = unpackVaruint(buf[l:]); ll <= 0 {
+			return nil, invalid
+		}
+		mw.used[i] = uint32(u)
+		l += ll
+	}
+	la, ll := unpackVaruint(buf[l:])
+	if ll <= 0 {
+		return nil, invalid
+	}
+	mw.Lookahead = uint32(la)
+	l += ll
+	if mw.Webhook, ll, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	l += ll
+	seq, ll := unpackVaruint(buf[l:])
+	if ll <= 0 {
+		return nil, invalid
+	}
+	mw.nextSeq = uint64(seq)
+	l += ll
+	// the wallet without birthday ends here
+	if l == len(buf) {
+		return mw, nil
+	}
+	var v [3]uint
+	for i := range v {
+		if v[i], ll = unpackVaruint(buf[l:]); ll <= 0 {
+			return nil, invalid
+		}
+		l += ll
+	}
+	mw.Birthday, mw.scanned, mw.scanTo = uint32(v[0]), uint32(v[1]), uint32(v[2])
+	// the wallet registered before the tokens ends here
+	if l == len(buf) {
+		return mw, nil
+	}
+	if mw.Token, _, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+func packMultisigEventKey(wallet string, seq uint64) []byte {
+	buf := packString(wallet, nil)
+	l := len(buf)
+	buf = append(buf, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(buf[l:], seq)
+	return buf
+}
+
+func (d *RocksDB) packMultisigEvent(e *MultisigEvent) ([]byte, error) {
+	btxID, err := d.chainParser.PackTxid(e.Txid)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, 1+len(btxID)+len(e.AddrDesc)+4*vlq.MaxLen64)
+	var flags byte
+	if e.Type == MultisigEventSpend {
+		flags |= multisigEventSpendFlag
+	}
+	if e.Disconnected {
+		flags |= multisigEventDisconnectedFlag
+	}
+	buf = append(buf, flags)
+	buf = append(buf, btxID...)
+	buf = packString(string(e.AddrDesc), buf)
+	varBuf := make([]byte, vlq.MaxLen64)
+	for _, v := range []uint{uint(e.Descriptor), uint(e.Index), uint(e.Height), uint(e.Time)} {
+		l := packVaruint(v, varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf, nil
+}
+
+func (d *RocksDB) unpackMultisigEvent(buf []byte) (*MultisigEvent, error) {
+	invalid := errors.New("Invalid packed multisig event")
+	pl := d.chainParser.PackedTxidLen()
+	if len(buf) < 1+pl {
+		return nil, invalid
+	}
+	e := &MultisigEvent{Type: MultisigEventFunding}
+	if buf[0]&multisigEventSpendFlag != 0 {
+		e.Type = MultisigEventSpend
+	}
+	e.Disconnected = buf[0]&multisigEventDisconnectedFlag != 0
+	var err error
+	if e.Txid, err = d.chainParser.UnpackTxid(buf[1 : 1+pl]); err != nil {
+		return nil, err
+	}
+	l := 1 + pl
+	ad, ll, err := unpackString(buf[l:])
+	if err != nil {
+		return nil, err
+	}
+	e.AddrDesc = bchain.AddressDescriptor(ad)
+	l += ll
+	var v [4]uint
+	for i := range v {
+		if v[i], ll = unpackVaruint(buf[l:]); ll <= 0 {
+			return nil, invalid
+		}
+		l += ll
+	}
+	e.Descriptor, e.Index, e.Height, e.Time = int(v[0]), uint32(v[1]), uint32(v[2]), int64(v[3])
+	if addrs, _, err := d.chainParser.GetAddressesFromAddrDesc(e.AddrDesc); err == nil && len(addrs) == 1 {
+		e.Address = addrs[0]
+	}
+	return e, nil
+}
+
+// deriveMultisigAddrs derives the addresses of the wallet up to the lookahead after the used addresses, it must be called with the lock
+func (d *RocksDB) deriveMultisigAddrs(mw *multisigWallet) error {
+	for i, desc := range mw.Descriptors {
+		to := mw.used[i] + mw.Lookahead
+		if mw.derived[i] >= to {
+			continue
+		}
+		descs, err := d.chainParser.DeriveMultisigAddrDescs(desc, mw.derived[i], to)
+		if err != nil {
+			return errors.Annotatef(err, "descriptor %d", i)
+		}
+	AddrLoop:
+		for j, ad := range descs {
+			// the descriptor without wildcard returns the same single address for any range, it is derived first with index 0
+			index := mw.derived[i] + uint32(j)
+			for _, a := range d.multisig.addrs[string(ad)] {
+				if a.wallet == mw && a.descriptor == i {
+					continue AddrLoop
+				}
+			}
+			d.multisig.addrs[string(ad)] = append(d.multisig.addrs[string(ad)], multisigAddr{wallet: mw, descriptor: i, index: index})
+			mw.addrDescs = append(mw.addrDescs, string(ad))
+		}
+		mw.derived[i] = to
+	}
+	return nil
+}
+
+// removeMultisigAddrs removes the addresses of the wallet from the map of the addresses, it must be called with the lock
+func (d *RocksDB) removeMultisigAddrs(mw *multisigWallet) {
+	for _, ad := range mw.addrDescs {
+		as := d.multisig.addrs[ad]
+		r := as[:0]
+		for _, a := range as {
+			if a.wallet != mw {
+				r = append(r, a)
+			}
+		}
+		if len(r) == 0 {
+			delete(d.multisig.addrs, ad)
+		} else {
+			d.multisig.addrs[ad] = r
+		}
+	}
+	mw.addrDescs = nil
+}
+
+// loadMultisigWallets loads the multisig wallets from the db and derives their addresses
+func (d *RocksDB) loadMultisigWallets() error {
+	d.multisig.mux.Lock()
+	defer d.multisig.mux.Unlock()
+	d.multisig.wallets = make(map[string]*multisigWallet)
+	d.multisig.addrs = make(map[string][]multisigAddr)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfMultisigWallets])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		mw, err := unpackMultisigWallet(it.Value().Data())
+		if err != nil {
+			return errors.Annotatef(err, "multisig wallet %v", string(it.Key().Data()))
+		}
+		// the wallet registered before the history was ordered by the height keeps its feed before the live events
+		if mw.nextSeq < multisigLiveSeq {
+			mw.nextSeq = multisigLiveSeq
+		}
+		if err = d.deriveMultisigAddrs(mw); err != nil {
+			glog.Error("rocksdb: multisig wallet ", mw.Name, ": ", err)
+		}
+		d.multisig.wallets[mw.Name] = mw
+	}
+	atomic.StoreInt32(&d.multisig.count, int32(len(d.multisig.wallets)))
+	if len(d.multisig.wallets) > 0 {
+		glog.Info("rocksdb: loaded ", len(d.multisig.wallets), " multisig wallets, ", len(d.multisig.addrs), " addresses")
+	}
+	return nil
+}
+
+// SetOnMultisigEvents sets the function called when there are new events of the multisig wallets
+func (d *RocksDB) SetOnMultisigEvents(fn OnMultisigEventsFunc) {
+	d.multisig.mux.Lock()
+	d.multisig.onEvents = fn
+	d.multisig.mux.Unlock()
+}
+
+// RegisterMultisigWallet registers the multisig wallet or updates the registered wallet of the same name,
+// the feed of the updated wallet is preserved
+func (d *RocksDB) RegisterMultisigWallet(w *MultisigWallet) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	if !validMultisigWalletName(w.Name) {
+		return errors.Errorf("Invalid wallet name '%v', expecting 1-%d characters a-z, A-Z, 0-9, '-', '_' or '.'", w.Name, maxMultisigNameLen)
+	}
+	if len(w.Descriptors) == 0 || len(w.Descriptors) > MaxMultisigDescriptors {
+		return errors.Errorf("Invalid number of descriptors %d, expecting 1-%d", len(w.Descriptors), MaxMultisigDescriptors)
+	}
+	if w.Lookahead == 0 {
+		w.Lookahead = DefaultMultisigLookahead
+	} else if w.Lookahead > MaxMultisigLookahead {
+		return errors.Errorf("Lookahead exceeds %d", MaxMultisigLookahead)
+	}
+	if w.Birthday != 0 && w.BirthdayTime != 0 {
+		return errors.New("Only one of birthday and birthdayTime can be set")
+	}
+	if w.Token != "" && !validMultisigToken(w.Token) {
+		return errors.Errorf("Invalid token, expecting %d-%d characters a-z, A-Z, 0-9, '-' or '_'", minMultisigTokenLen, maxMultisigTokenLen)
+	}
+	best, _, err := d.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	if w.BirthdayTime != 0 {
+		if w.Birthday, err = d.HeightAtTime(w.BirthdayTime-multisigBirthdayWindow, best); err != nil {
+			return err
+		}
+		// the height 0 means no birthday, the genesis block is not scanned
+		if w.Birthday == 0 {
+			w.Birthday = 1
+		}
+		w.BirthdayTime = 0
+	}
+	w.Scan = nil
+	mw := &multisigWallet{
+		MultisigWallet: *w,
+		used:           make([]uint32, len(w.Descriptors)),
+		derived:        make([]uint32, len(w.Descriptors)),
+		nextSeq:        multisigLiveSeq,
+	}
+	mw.Descriptors = append([]string(nil), w.Descriptors...)
+	if mw.Birthday != 0 {
+		// the blocks connected after the registration are checked by the connect, the history is scanned only up to the best block
+		mw.scanned = mw.Birthday - 1
+		mw.scanTo = best
+		if mw.scanned > mw.scanTo {
+			mw.scanTo = mw.scanned
+		}
+	}
+	d.multisig.mux.Lock()
+	defer d.multisig.mux.Unlock()
+	old := d.multisig.wallets[w.Name]
+	// the update without token keeps the token of the wallet, a new wallet gets a random token
+	if mw.Token == "" && old != nil {
+		mw.Token = old.Token
+	}
+	if mw.Token == "" {
+		if mw.Token, err = newMultisigToken(); err != nil {
+			return err
+		}
+	}
+	w.Token = mw.Token
+	if old != nil {
+		mw.nextSeq = old.nextSeq
+		sameDescriptors := len(old.Descriptors) == len(mw.Descriptors)
+		for i := range mw.Descriptors {
+			if i < len(old.Descriptors) && old.Descriptors[i] == mw.Descriptors[i] {
+				mw.used[i] = old.used[i]
+			} else {
+				sameDescriptors = false
+			}
+		}
+		// the update without birthday (e.g. of the webhook) continues the scan of the wallet
+		if mw.Birthday == 0 && sameDescriptors {
+			mw.Birthday, mw.scanned, mw.scanTo = old.Birthday, old.scanned, old.scanTo
+			w.Birthday = old.Birthday
+		}
+		d.removeMultisigAddrs(old)
+	}
+	err = d.deriveMultisigAddrs(mw)
+	if err == nil {
+		err = d.db.PutCF(d.wo, d.cfh[cfMultisigWallets], []byte(mw.Name), packMultisigWallet(mw))
+	}
+	if err != nil {
+		d.removeMultisigAddrs(mw)
+		if old != nil {
+			if e := d.deriveMultisigAddrs(old); e != nil {
+				glog.Error("rocksdb: multisig wallet ", old.Name, ": ", e)
+			}
+		}
+		return err
+	}
+	d.multisig.wallets[mw.Name] = mw
+	atomic.StoreInt32(&d.multisig.count, int32(len(d.multisig.wallets)))
+	d.startMultisigScanLocked()
+	return nil
+}
+
+// UnregisterMultisigWallet removes the multisig wallet together with its feed, returns false if the wallet was not registered
+func (d *RocksDB) UnregisterMultisigWallet(name string) (bool, error) {
+	if err := d.enterHandle(); err != nil {
+		return false, err
+	}
+	defer d.releaseHandle()
+	d.multisig.mux.Lock()
+	defer d.multisig.mux.Unlock()
+	mw := d.multisig.wallets[name]
+	if mw == nil {
+		return false, nil
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	wb.DeleteCF(d.cfh[cfMultisigWallets], []byte(name))
+	prefix := packString(name, nil)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfMultisigEvents])
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if len(key) != len(prefix)+8 || string(key[:len(prefix)]) != string(prefix) {
+			break
+		}
+		wb.DeleteCF(d.cfh[cfMultisigEvents], append([]byte(nil), key...))
+	}
+	it.Close()
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return false, err
+	}
+	d.removeMultisigAddrs(mw)
+	delete(d.multisig.wallets, name)
+	atomic.StoreInt32(&d.multisig.count, int32(len(d.multisig.wallets)))
+	return true, nil
+}
+
+// GetMultisigWallet returns the registered multisig wallet or nil if there is no wallet of the name
+func (d *RocksDB) GetMultisigWallet(name string) *MultisigWallet {
+	d.multisig.mux.Lock()
+	defer d.multisig.mux.Unlock()
+	if mw := d.multisig.wallets[name]; mw != nil {
+		w := mw.MultisigWallet
+		w.Scan = mw.scanProgress()
+		return &w
+	}
+	return nil
+}
+
+// ValidMultisigWalletToken returns true if the multisig wallet is registered and the token is its token
+func (d *RocksDB) ValidMultisigWalletToken(name, token string) bool {
+	d.multisig.mux.Lock()
+	defer d.multisig.mux.Unlock()
+	mw := d.multisig.wallets[name]
+	return mw != nil && mw.Token != "" && subtle.ConstantTimeCompare([]byte(mw.Token), []byte(token)) == 1
+}
+
+// GetMultisigWallets returns all registered multisig wallets sorted by name
+func (d *RocksDB) GetMultisigWallets() []MultisigWallet {
+	d.multisig.mux.Lock()
+	r := make([]MultisigWallet, 0, len(d.multisig.wallets))
+	for _, mw := range d.multisig.wallets {
+		w := mw.MultisigWallet
+		w.Scan = mw.scanProgress()
+		r = append(r, w)
+	}
+	d.multisig.mux.Unlock()
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r
+}
+
+// GetMultisigEvents returns at most limit events of the feed of the multisig wallet starting from the sequence number from
+func (d *RocksDB) GetMultisigEvents(name string, from uint64, limit int) (events []MultisigEvent, err error) {
+	defer func(s time.Time) { d.observeMethod("GetMultisigEvents", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	prefix := packString(name, nil)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfMultisigEvents])
+	defer it.Close()
+	for it.Seek(packMultisigEventKey(name, from)); it.Valid() && len(events) < limit; it.Next() {
+		key := it.Key().Data()
+		if len(key) != len(prefix)+8 || string(key[:len(prefix)]) != string(prefix) {
+			break
+		}
+		e, err := d.unpackMultisigEvent(it.Value().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "multisig event %x", key)
+		}
+		e.Seq = binary.BigEndian.Uint64(key[len(prefix):])
+		e.Wallet = name
+		events = append(events, *e)
+	}
+	return events, nil
+}
+
+// multisigEvents returns the events of the multisig wallets caused by the inputs and outputs of the transaction of the address,
+// it must be called with the lock
+func (d *RocksDB) multisigEvents(addrDesc string, txid string, funding, spend bool, height uint32, t int64) []MultisigEvent {
+	return d.multisigAddrEvents(d.multisig.addrs[addrDesc], addrDesc, txid, funding, spend, height, t)
+}
+
+// multisigAddrEvents returns the events of the wallet addresses as caused by the inputs and outputs of the transaction of the address
+func (d *RocksDB) multisigAddrEvents(as []multisigAddr, addrDesc string, txid string, funding, spend bool, height uint32, t int64) []MultisigEvent {
+	var r []MultisigEvent
+	var address string
+	if addrs, _, err := d.chainParser.GetAddressesFromAddrDesc(bchain.AddressDescriptor(addrDesc)); err == nil && len(addrs) == 1 {
+		address = addrs[0]
+	}
+	for _, a := range as {
+		e := MultisigEvent{
+			Wallet:     a.wallet.Name,
+			Txid:       txid,
+			Address:    address,
+			Descriptor: a.descriptor,
+			Index:      a.index,
+			Height:     height,
+			Time:       t,
+			Webhook:    a.wallet.Webhook,
+			Token:      a.wallet.Token,
+			AddrDesc:   bchain.AddressDescriptor(addrDesc),
+		}
+		if funding {
+			e.Type = MultisigEventFunding
+			r = append(r, e)
+		}
+		if spend {
+			e.Type = MultisigEventSpend
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+// checkMultisigWallets finds the transactions funding and spending the multisig wallets in the block being connected,
+// the events are stored and notified by notifyMultisigEvents after the block (or the bulk of blocks) is written
+func (d *RocksDB) checkMultisigWallets(block *bchain.Block, addresses map[string][]outpoint) {
+	if atomic.LoadInt32(&d.multisig.count) == 0 {
+		return
+	}
+	d.multisig.mux.Lock()
+	defer d.multisig.mux.Unlock()
+	start := len(d.multisig.pending)
+	for addrDesc, outpoints := range addresses {
+		if _, found := d.multisig.addrs[addrDesc]; !found {
+			continue
+		}
+		// the inputs and outputs of the transaction are reported once per address
+		type io struct{ funding, spend bool }
+		txs := make(map[string]*io)
+		var order []string
+		for _, o := range outpoints {
+			t := txs[string(o.btxID)]
+			if t == nil {
+				t = &io{}
+				txs[string(o.btxID)] = t
+				order = append(order, string(o.btxID))
+			}
+			if o.index < 0 {
+				t.spend = true
+			} else {
+				t.funding = true
+			}
+		}
+		for _, btxID := range order {
+			txid, err := d.chainParser.UnpackTxid([]byte(btxID))
+			if err != nil {
+				glog.Error("rocksdb: multisig wallets: ", err)
+				continue
+			}
+			t := txs[btxID]
+			d.multisig.pending = append(d.multisig.pending, d.multisigEvents(addrDesc, txid, t.funding, t.spend, block.Height, block.Time)...)
+		}
+	}
+	// the addresses are iterated in random order, the events of the block are ordered by the transactions in the block
+	if events := d.multisig.pending[start:]; len(events) > 1 {
+		index := make(map[string]int, len(block.Txs))
+		for i := range block.Txs {
+			index[block.Txs[i].Txid] = i
+		}
+		sort.SliceStable(events, func(i, j int) bool {
+			ti, tj := index[events[i].Txid], index[events[j].Txid]
+			if ti != tj {
+				return ti < tj
+			}
+			return events[i].Address < events[j].Address
+		})
+	}
+}
+
+// storeMultisigEvents assigns the sequence numbers to the events, stores them to the feeds of the wallets
+// and derives new addresses of the wallets if the used addresses approach the lookahead, it must be called with the lock
+func (d *RocksDB) storeMultisigEvents(events []MultisigEvent) error {
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	changed := make(map[*multisigWallet]struct{})
+	for i := range events {
+		e := &events[i]
+		mw := d.multisig.wallets[e.Wallet]
+		if mw == nil {
+			continue
+		}
+		val, err := d.packMultisigEvent(e)
+		if err != nil {
+			return err
+		}
+		e.Seq = mw.nextSeq
+		mw.nextSeq++
+		wb.PutCF(d.cfh[cfMultisigEvents], packMultisigEventKey(mw.Name, e.Seq), val)
+		if e.Index >= mw.used[e.Descriptor] {
+			mw.used[e.Descriptor] = e.Index + 1
+		}
+		changed[mw] = struct{}{}
+	}
+	for mw := range changed {
+		wb.PutCF(d.cfh[cfMultisigWallets], []byte(mw.Name), packMultisigWallet(mw))
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return err
+	}
+	for mw := range changed {
+		if err := d.deriveMultisigAddrs(mw); err != nil {
+			glog.Error("rocksdb: multisig wallet ", mw.Name, ": ", err)
+		}
+	}
+	return nil
+}
+
+// notifyMultisigEvents stores the events of the multisig wallets found in the connected blocks and sends notification about them,
+// it must be called after the blocks are written to the db
+func (d *RocksDB) notifyMultisigEvents() {
+	d.multisig.mux.Lock()
+	pending := d.multisig.pending
+	d.multisig.pending = nil
+	if len(pending) == 0 {
+		d.multisig.mux.Unlock()
+		return
+	}
+	err := d.storeMultisigEvents(pending)
+	fn := d.multisig.onEvents
+	d.multisig.mux.Unlock()
+	if err != nil {
+		glog.Error("rocksdb: multisig events in blocks ", pending[0].Height, "-", pending[len(pending)-1].Height, ": ", err)
+		return
+	}
+	glog.Info("rocksdb: ", len(pending), " events of multisig wallets in blocks ", pending[0].Height, "-", pending[len(pending)-1].Height)
+	if fn != nil {
+		fn(pending)
+	}
+}
+
+// disconnectMultisigEvents marks the events of the blocks lower-higher in the feeds of the wallets as disconnected and moves
+// the end of the scan of the history of the wallets before the disconnected blocks, the blocks connected instead of them
+// are checked by the connect. It takes the lock, which is released by the returned function, it must be called after
+// the write of the batch with the result of the write, the disconnected events are notified only if the write succeeded.
+func (d *RocksDB) disconnectMultisigEvents(wb *gorocksdb.WriteBatch, lower, higher uint32) (func(error), error) {
+	if atomic.LoadInt32(&d.multisig.count) == 0 {
+		return func(error) {}, nil
+	}
+	d.multisig.mux.Lock()
+	events, err := d.markDisconnectedMultisigEvents(wb, lower, higher)
+	if err != nil {
+		d.multisig.mux.Unlock()
+		return nil, err
+	}
+	for _, mw := range d.multisig.wallets {
+		if mw.Birthday == 0 || mw.scanTo < lower {
+			continue
+		}
+		mw.scanTo = lower - 1
+		if mw.scanTo < mw.Birthday-1 {
+			mw.scanTo = mw.Birthday - 1
+		}
+		if mw.scanned > mw.scanTo {
+			mw.scanned = mw.scanTo
+		}
+		wb.PutCF(d.cfh[cfMultisigWallets], []byte(mw.Name), packMultisigWallet(mw))
+	}
+	fn := d.multisig.onEvents
+	return func(err error) {
+		d.multisig.mux.Unlock()
+		if err != nil || len(events) == 0 {
+			return
+		}
+		glog.Info("rocksdb: ", len(events), " events of multisig wallets in disconnected blocks ", lower, "-", higher)
+		if fn != nil {
+			fn(events)
+		}
+	}, nil
+}
+
+// markDisconnectedMultisigEvents puts the events of the blocks lower-higher marked as disconnected to the batch
+// and returns them, it must be called with the lock
+func (d *RocksDB) markDisconnectedMultisigEvents(wb *gorocksdb.WriteBatch, lower, higher uint32) ([]MultisigEvent, error) {
+	var events []MultisigEvent
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfMultisigEvents])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		name, l, err := unpackString(key)
+		if err != nil || len(key) != l+8 {
+			return nil, errors.Errorf("Invalid multisig event key %x", key)
+		}
+		mw := d.multisig.wallets[name]
+		if mw == nil {
+			continue
+		}
+		e, err := d.unpackMultisigEvent(it.Value().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "multisig event %x", key)
+		}
+		// the mempool events have height 0
+		if e.Disconnected || e.Height < lower || e.Height > higher {
+			continue
+		}
+		e.Disconnected = true
+		val, err := d.packMultisigEvent(e)
+		if err != nil {
+			return nil, err
+		}
+		wb.PutCF(d.cfh[cfMultisigEvents], append([]byte(nil), key...), val)
+		e.Seq = binary.BigEndian.Uint64(key[l:])
+		e.Wallet = name
+		e.Webhook = mw.Webhook
+		e.Token = mw.Token
+		events = append(events, *e)
+	}
+	return events, nil
+}
+
+// OnNewTxAddr records the events of the multisig wallets caused by the mempool transaction, it is called by the mempool sync
+// for the input and output addresses of the new mempool transactions
+func (d *RocksDB) OnNewTxAddr(txid string, addrDesc bchain.AddressDescriptor, isOutput bool) {
+	if atomic.LoadInt32(&d.multisig.count) == 0 {
+		return
+	}
+	d.multisig.mux.Lock()
+	events := d.multisigEvents(string(addrDesc), txid, isOutput, !isOutput, 0, time.Now().Unix())
+	if len(events) == 0 {
+		d.multisig.mux.Unlock()
+		return
+	}
+	err := d.storeMultisigEvents(events)
+	fn := d.multisig.onEvents
+	d.multisig.mux.Unlock()
+	if err != nil {
+		glog.Error("rocksdb: multisig events of mempool tx ", txid, ": ", err)
+		return
+	}
+	if fn != nil {
+		fn(events)
+	}
+}
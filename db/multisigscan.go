@@ -0,0 +1,384 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	// multisigScanBlocks is the number of blocks scanned at once, the scan frontier of the wallet is stored after each range
+	multisigScanBlocks = 10000
+	// multisigBirthdayWindow is subtracted from the birthday time of the wallet, the time of a block can differ from the real time
+	multisigBirthdayWindow = 2 * 60 * 60
+)
+
+// MultisigScan is the progress of the scan of the history of a multisig wallet from its birthday,
+// the blocks FromHeight..ScannedHeight are scanned, the scan ends at ToHeight
+type MultisigScan struct {
+	FromHeight    uint32  `json:"fromHeight"`
+	ToHeight      uint32  `json:"toHeight"`
+	ScannedHeight uint32  `json:"scannedHeight"`
+	Done          bool    `json:"done"`
+	Progress      float64 `json:"progress"`
+}
+
+// scanProgress returns the progress of the scan of the history or nil if the wallet has no birthday, it must be called with the lock
+func (mw *multisigWallet) scanProgress() *MultisigScan {
+	if mw.Birthday == 0 {
+		return nil
+	}
+	s := &MultisigScan{
+		FromHeight:    mw.Birthday,
+		ToHeight:      mw.scanTo,
+		ScannedHeight: mw.scanned,
+		Done:          mw.scanned >= mw.scanTo,
+		Progress:      1,
+	}
+	if !s.Done {
+		s.Progress = float64(mw.scanned+1-mw.Birthday) / float64(mw.scanTo+1-mw.Birthday)
+	}
+	return s
+}
+
+// startMultisigScanLocked starts the scan of the history of the wallets in background if it is not running
+// and there is a wallet with unfinished scan, it must be called with the lock
+func (d *RocksDB) startMultisigScanLocked() {
+	if d.multisig.scanStop != nil || d.db == nil || d.nextMultisigScan() == nil {
+		return
+	}
+	stop := make(chan struct{})
+	d.multisig.scanStop = stop
+	d.multisig.scanWg.Add(1)
+	go func() {
+		defer d.multisig.scanWg.Done()
+		d.scanMultisigWallets(stop)
+	}()
+}
+
+// startMultisigScan resumes the scan of the history of the wallets after the db was opened or reopened
+func (d *RocksDB) startMultisigScan() {
+	d.multisig.mux.Lock()
+	d.startMultisigScanLocked()
+	d.multisig.mux.Unlock()
+}
+
+// stopMultisigScan stops the running scan and waits for its end, it must be called before the db is closed
+func (d *RocksDB) stopMultisigScan() {
+	d.multisig.mux.Lock()
+	stop := d.multisig.scanStop
+	d.multisig.scanStop = nil
+	d.multisig.mux.Unlock()
+	if stop != nil {
+		close(stop)
+	}
+	d.multisig.scanWg.Wait()
+}
+
+// nextMultisigScan returns the wallet with unfinished scan first by name or nil, it must be called with the lock
+func (d *RocksDB) nextMultisigScan() *multisigWallet {
+	var r *multisigWallet
+	for _, mw := range d.multisig.wallets {
+		if mw.scanned < mw.scanTo && (r == nil || mw.Name < r.Name) {
+			r = mw
+		}
+	}
+	return r
+}
+
+// scanMultisigWallets scans the history of the wallets one by one until all scans are finished or the scan is stopped
+func (d *RocksDB) scanMultisigWallets(stop chan struct{}) {
+	defer func() {
+		d.multisig.mux.Lock()
+		if d.multisig.scanStop == stop {
+			d.multisig.scanStop = nil
+		}
+		d.multisig.mux.Unlock()
+	}()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		d.multisig.mux.Lock()
+		mw := d.nextMultisigScan()
+		if mw == nil {
+			// the scan is marked as not running with the lock, so that the wallet registered meanwhile starts a new scan
+			if d.multisig.scanStop == stop {
+				d.multisig.scanStop = nil
+			}
+			d.multisig.mux.Unlock()
+			return
+		}
+		d.multisig.mux.Unlock()
+		if err := d.scanMultisigWallet(mw, stop); err != nil {
+			// the scan is resumed after the db is reopened
+			if err != errHandleClosed {
+				glog.Error("rocksdb: multisig wallet ", mw.Name, ": scan: ", err)
+			}
+			return
+		}
+	}
+}
+
+// scanMultisigWallet scans the history of the wallet by the ranges of multisigScanBlocks blocks and stores the found events
+// together with the scan frontier, so that the scan can be resumed. The addresses derived before the scan started are scanned
+// up to the frontier. The addresses derived during the scan (as the found events use the addresses) are checked by the connect
+// only from their derivation, they are scanned from the birthday up to the best block.
+func (d *RocksDB) scanMultisigWallet(mw *multisigWallet, stop chan struct{}) error {
+	// scanned is the last block scanned for the address
+	scanned := make(map[string]uint32)
+	d.multisig.mux.Lock()
+	for _, ad := range mw.addrDescs {
+		scanned[ad] = mw.scanned
+	}
+	d.multisig.mux.Unlock()
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		d.multisig.mux.Lock()
+		if d.multisig.wallets[mw.Name] != mw || mw.scanned >= mw.scanTo {
+			d.multisig.mux.Unlock()
+			return nil
+		}
+		lower := mw.scanned + 1
+		higher := mw.scanTo
+		if higher-lower >= multisigScanBlocks {
+			higher = lower + multisigScanBlocks - 1
+		}
+		d.multisig.mux.Unlock()
+		done, err := d.scanMultisigRange(mw, lower, higher, scanned, stop)
+		if err != nil {
+			return err
+		}
+		if done {
+			glog.Info("rocksdb: multisig wallet ", mw.Name, ": scan of the history from block ", mw.Birthday, " finished")
+		}
+	}
+}
+
+// scanMultisigRange finds the events of the wallet in the blocks lower..higher and stores them with the moved scan frontier,
+// returns true if the scan is finished
+func (d *RocksDB) scanMultisigRange(mw *multisigWallet, lower, higher uint32, scanned map[string]uint32, stop chan struct{}) (bool, error) {
+	if err := d.enterHandle(); err != nil {
+		return false, err
+	}
+	defer d.releaseHandle()
+	type scanAddr struct {
+		addrDesc string
+		as       []multisigAddr
+		from, to uint32
+	}
+	times := make(map[uint32]int64)
+	rangeScanned := make(map[string]uint32)
+	var events []MultisigEvent
+	for {
+		var addrs []scanAddr
+		d.multisig.mux.Lock()
+		if d.multisig.wallets[mw.Name] != mw {
+			d.multisig.mux.Unlock()
+			return false, nil
+		}
+		// the best block is read after the addresses were derived, the later blocks are checked by the connect
+		best, err := d.GetBestHeight()
+		if err != nil {
+			d.multisig.mux.Unlock()
+			return false, err
+		}
+		for _, ad := range mw.addrDescs {
+			if _, found := rangeScanned[ad]; found {
+				continue
+			}
+			from, to := mw.Birthday, best
+			if s, found := scanned[ad]; found {
+				if s >= higher {
+					continue
+				}
+				from, to = s+1, higher
+			}
+			if to < higher {
+				to = higher
+			}
+			var as []multisigAddr
+			for _, a := range d.multisig.addrs[ad] {
+				if a.wallet == mw {
+					as = append(as, a)
+				}
+			}
+			addrs = append(addrs, scanAddr{addrDesc: ad, as: as, from: from, to: to})
+		}
+		d.multisig.mux.Unlock()
+		var found []MultisigEvent
+		for _, a := range addrs {
+			select {
+			case <-stop:
+				return false, nil
+			default:
+			}
+			e, err := d.scanMultisigAddr(a.addrDesc, a.as, a.from, a.to, times)
+			if err != nil {
+				return false, err
+			}
+			found = append(found, e...)
+			rangeScanned[a.addrDesc] = a.to
+		}
+		if len(found) == 0 {
+			break
+		}
+		events = append(events, found...)
+		// the used addresses move the lookahead, the newly derived addresses are scanned in the next round
+		d.multisig.mux.Lock()
+		for _, e := range found {
+			if e.Index >= mw.used[e.Descriptor] {
+				mw.used[e.Descriptor] = e.Index + 1
+			}
+		}
+		if err := d.deriveMultisigAddrs(mw); err != nil {
+			glog.Error("rocksdb: multisig wallet ", mw.Name, ": ", err)
+		}
+		d.multisig.mux.Unlock()
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Height < events[j].Height })
+	d.multisig.mux.Lock()
+	defer d.multisig.mux.Unlock()
+	if d.multisig.wallets[mw.Name] != mw || mw.scanned != lower-1 {
+		return false, nil
+	}
+	mw.scanned = higher
+	if err := d.storeMultisigHistory(mw, events); err != nil {
+		mw.scanned = lower - 1
+		return false, err
+	}
+	for ad, to := range rangeScanned {
+		scanned[ad] = to
+	}
+	if len(events) > 0 {
+		glog.Info("rocksdb: multisig wallet ", mw.Name, ": ", len(events), " events in blocks ", lower, "-", higher)
+	}
+	return mw.scanned >= mw.scanTo, nil
+}
+
+// storeMultisigHistory stores the events found by the scan of the history sorted by the height together with the wallet,
+// the events are put to the feed by their height before the events of the connected blocks and of the mempool.
+// The events already in the feed are skipped, the addresses derived by an interrupted scan were scanned beyond its frontier.
+// It must be called with the lock.
+func (d *RocksDB) storeMultisigHistory(mw *multisigWallet, events []MultisigEvent) error {
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfMultisigEvents])
+	defer it.Close()
+	for i := 0; i < len(events); {
+		height := events[i].Height
+		base := uint64(height) << multisigHistorySeqBits
+		kstop := packMultisigEventKey(mw.Name, base+1<<multisigHistorySeqBits)
+		stored := make(map[string]struct{})
+		seq := base
+		for it.Seek(packMultisigEventKey(mw.Name, base)); it.Valid(); it.Next() {
+			key := it.Key().Data()
+			if bytes.Compare(key, kstop) >= 0 {
+				break
+			}
+			e, err := d.unpackMultisigEvent(it.Value().Data())
+			if err != nil {
+				return errors.Annotatef(err, "multisig event %x", key)
+			}
+			stored[e.Type+e.Txid+string(e.AddrDesc)] = struct{}{}
+			seq = binary.BigEndian.Uint64(key[len(key)-8:]) + 1
+		}
+		for ; i < len(events) && events[i].Height == height; i++ {
+			e := &events[i]
+			k := e.Type + e.Txid + string(e.AddrDesc)
+			if _, found := stored[k]; found {
+				continue
+			}
+			if seq >= base+1<<multisigHistorySeqBits {
+				return errors.Errorf("Too many multisig events in block %d", height)
+			}
+			stored[k] = struct{}{}
+			val, err := d.packMultisigEvent(e)
+			if err != nil {
+				return err
+			}
+			e.Seq = seq
+			seq++
+			wb.PutCF(d.cfh[cfMultisigEvents], packMultisigEventKey(mw.Name, e.Seq), val)
+			if e.Index >= mw.used[e.Descriptor] {
+				mw.used[e.Descriptor] = e.Index + 1
+			}
+		}
+	}
+	wb.PutCF(d.cfh[cfMultisigWallets], []byte(mw.Name), packMultisigWallet(mw))
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return err
+	}
+	return d.deriveMultisigAddrs(mw)
+}
+
+// scanMultisigAddr returns the events of the wallet addresses as caused by the transactions of the address in the blocks lower..higher,
+// times caches the times of the blocks
+func (d *RocksDB) scanMultisigAddr(addrDesc string, as []multisigAddr, lower, higher uint32, times map[uint32]int64) ([]MultisigEvent, error) {
+	var r []MultisigEvent
+	kstart := packAddressKey([]byte(addrDesc), lower)
+	kstop := packAddressKey([]byte(addrDesc), higher)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		_, height, err := unpackAddressKey(key)
+		if err != nil {
+			return nil, err
+		}
+		outpoints, err := d.unpackAddressOutpoints(it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		t, found := times[height]
+		if !found {
+			bi, err := d.GetBlockInfo(height)
+			if err != nil {
+				return nil, err
+			}
+			if bi != nil {
+				t = bi.Time
+			}
+			times[height] = t
+		}
+		// the inputs and outputs of the transaction are reported once
+		type io struct{ funding, spend bool }
+		txs := make(map[string]*io)
+		var order []string
+		for _, o := range outpoints {
+			tx := txs[string(o.btxID)]
+			if tx == nil {
+				tx = &io{}
+				txs[string(o.btxID)] = tx
+				order = append(order, string(o.btxID))
+			}
+			if o.index < 0 {
+				tx.spend = true
+			} else {
+				tx.funding = true
+			}
+		}
+		for _, btxID := range order {
+			txid, err := d.chainParser.UnpackTxid([]byte(btxID))
+			if err != nil {
+				return nil, err
+			}
+			tx := txs[btxID]
+			r = append(r, d.multisigAddrEvents(as, addrDesc, txid, tx.funding, tx.spend, height, t)...)
+		}
+	}
+	return r, nil
+}
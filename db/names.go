@@ -0,0 +1,167 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"time"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// NameRecord is an operation setting the value and the owner of a name (e.g. Namecoin name_firstupdate or name_update),
+// Owner is the address descriptor of the output script following the name operation
+type NameRecord struct {
+	Name   []byte
+	Height uint32
+	Txid   string
+	Vout   uint32
+	Op     bchain.NameOpType
+	Value  []byte
+	Owner  bchain.AddressDescriptor
+}
+
+// nameOpOutput is the name operation found in the block before it is stored, btxID is the packed txid
+type nameOpOutput struct {
+	height uint32
+	btxID  []byte
+	vout   uint32
+	op     *bchain.NameOperation
+}
+
+// computeNameOps returns the name operations of the outputs of the block transactions, the operations
+// registering only the commitment to a name (name_new) are skipped, they do not reveal the name
+func (d *RocksDB) computeNameOps(block *bchain.Block) []nameOpOutput {
+	var r []nameOpOutput
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		var btxID []byte
+		for j := range tx.Vout {
+			addrDesc, err := d.chainParser.GetAddrDescFromVout(&tx.Vout[j])
+			if err != nil || len(addrDesc) == 0 {
+				continue
+			}
+			op, err := d.chainParser.GetNameOperation(addrDesc)
+			if err == bchain.ErrNotSupported {
+				return nil
+			}
+			if err != nil || op == nil || op.Op == bchain.NameOpNew {
+				continue
+			}
+			if btxID == nil {
+				if btxID, err = d.chainParser.PackTxid(tx.Txid); err != nil {
+					break
+				}
+			}
+			r = append(r, nameOpOutput{height: block.Height, btxID: btxID, vout: tx.Vout[j].N, op: op})
+		}
+	}
+	return r
+}
+
+func packNameKey(name []byte, height uint32, btxID []byte) []byte {
+	key := append(packString(string(name), nil), packUint(height)...)
+	return append(key, btxID...)
+}
+
+func (d *RocksDB) unpackNameKey(key []byte, nr *NameRecord) error {
+	name, l, err := unpackString(key)
+	if err != nil {
+		return err
+	}
+	if len(key) != l+packedHeightBytes+d.chainParser.PackedTxidLen() {
+		return errors.New("Invalid name key")
+	}
+	nr.Name = []byte(name)
+	nr.Height = unpackUint(key[l:])
+	nr.Txid, err = d.chainParser.UnpackTxid(key[l+packedHeightBytes:])
+	return err
+}
+
+func packNameOp(vout uint32, op *bchain.NameOperation) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	l := packVaruint(uint(vout), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	buf = append(buf, byte(op.Op))
+	l = packVaruint(uint(len(op.Value)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = append(buf, op.Value...)
+	return append(buf, op.Owner...)
+}
+
+func unpackNameOp(buf []byte, nr *NameRecord) error {
+	vout, l := unpackVaruint(buf)
+	if l <= 0 || len(buf) < l+1 {
+		return errors.New("Invalid packed name operation")
+	}
+	nr.Vout = uint32(vout)
+	nr.Op = bchain.NameOpType(buf[l])
+	l++
+	vl, ll := unpackVaruint(buf[l:])
+	l += ll
+	if ll <= 0 || len(buf) < l+int(vl) {
+		return errors.New("Invalid packed name operation")
+	}
+	nr.Value = append([]byte{}, buf[l:l+int(vl)]...)
+	nr.Owner = append(bchain.AddressDescriptor{}, buf[l+int(vl):]...)
+	return nil
+}
+
+func (d *RocksDB) storeNameOps(wb *gorocksdb.WriteBatch, ops []nameOpOutput) {
+	for i := range ops {
+		o := &ops[i]
+		wb.PutCF(d.cfh[cfNameOps], packNameKey(o.op.Name, o.height, o.btxID), packNameOp(o.vout, o.op))
+	}
+}
+
+// disconnectedNames adds the names of the name operations in the outputs of the disconnected transaction to names
+func (d *RocksDB) disconnectedNames(ta *TxAddresses, names map[string]struct{}) {
+	for i := range ta.Outputs {
+		if len(ta.Outputs[i].AddrDesc) == 0 {
+			continue
+		}
+		op, err := d.chainParser.GetNameOperation(ta.Outputs[i].AddrDesc)
+		if err == bchain.ErrNotSupported {
+			return
+		}
+		if err == nil && op != nil && op.Op != bchain.NameOpNew {
+			names[string(op.Name)] = struct{}{}
+		}
+	}
+}
+
+// deleteNameOps deletes the operations of the names in the blocks lower..higher
+func (d *RocksDB) deleteNameOps(wb *gorocksdb.WriteBatch, names map[string]struct{}, lower uint32, higher uint32) {
+	for name := range names {
+		d.deleteHeightRange(wb, cfNameOps, packString(name, nil), lower, higher)
+	}
+}
+
+// GetNameHistory returns the operations of the name ordered by height, the last one determines the current value and owner
+func (d *RocksDB) GetNameHistory(name []byte) (r []NameRecord, err error) {
+	defer func(s time.Time) { d.observeMethod("GetNameHistory", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	r = []NameRecord{}
+	prefix := packString(string(name), nil)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfNameOps])
+	defer it.Close()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		var nr NameRecord
+		if err = d.unpackNameKey(key, &nr); err != nil {
+			return nil, errors.Annotatef(err, "name %x", key)
+		}
+		if err = unpackNameOp(it.Value().Data(), &nr); err != nil {
+			return nil, errors.Annotatef(err, "name %x", key)
+		}
+		r = append(r, nr)
+	}
+	return r, nil
+}
@@ -0,0 +1,749 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// InscriptionFeeVout is the vout of the location of the inscriptions whose sats were spent as the fee of the transaction
+// in a block without the coinbase transaction, or whose sats were not claimed by the outputs of the coinbase transaction
+const InscriptionFeeVout = ^uint32(0)
+
+// Inscription is an ordinals inscription revealed in a witness of a transaction input,
+// the ID is <genesis txid>i<index>, the location is the sat of the inscription given by Txid, Vout and Offset in the output
+type Inscription struct {
+	ID            string
+	Height        uint32
+	ContentType   string
+	ContentLength uint32
+	Txid          string
+	Vout          uint32
+	Offset        uint64
+}
+
+// inscriptionLocation is the inscription held by an output, id is the packed key of the inscription
+type inscriptionLocation struct {
+	id     []byte
+	offset uint64
+}
+
+// ordinalsUpdate contains the modified inscriptions and inscribed outputs before they are stored,
+// both maps are keyed by the packed keys, nil value means that the entry is deleted
+// addrDescs are the addrDescs of the modified outputs, the outputs are indexed by them in the inscriptionAddresses column
+type ordinalsUpdate struct {
+	outputs      map[string][]inscriptionLocation
+	addrDescs    map[string]bchain.AddressDescriptor
+	inscriptions map[string]*Inscription
+}
+
+func newOrdinalsUpdate() *ordinalsUpdate {
+	return &ordinalsUpdate{
+		outputs:      make(map[string][]inscriptionLocation),
+		addrDescs:    make(map[string]bchain.AddressDescriptor),
+		inscriptions: make(map[string]*Inscription),
+	}
+}
+
+// setOutput sets the inscriptions held by the output given by the packed key and its addrDesc, nil locations delete the entry
+func (u *ordinalsUpdate) setOutput(key []byte, addrDesc bchain.AddressDescriptor, locations []inscriptionLocation) {
+	u.outputs[string(key)] = locations
+	if len(addrDesc) > 0 {
+		u.addrDescs[string(key)] = addrDesc
+	}
+}
+
+// SetOrdinals enables the tracking of the ordinals inscriptions during block connect
+// the inscriptions are revealed in the witness data of the block transactions, the sharded sync is refused when it is enabled
+func (d *RocksDB) SetOrdinals(enabled bool) {
+	d.ordinals = enabled
+}
+
+// OrdinalsEnabled returns true if the inscriptions are tracked
+func (d *RocksDB) OrdinalsEnabled() bool {
+	return d.ordinals
+}
+
+func packInscriptionKey(btxID []byte, index uint32) []byte {
+	return packWatchedOutpointKey(btxID, index)
+}
+
+// packInscriptionAddressKey packs the key of the inscriptionAddresses column, the addrDesc is prefixed by its length
+// so that the outputs of the address can be iterated by the prefix
+func packInscriptionAddressKey(addrDesc bchain.AddressDescriptor, outputKey []byte) []byte {
+	buf := packString(string(addrDesc), nil)
+	return append(buf, outputKey...)
+}
+
+func (d *RocksDB) unpackInscriptionID(key []byte) (string, error) {
+	pl := d.chainParser.PackedTxidLen()
+	if len(key) <= pl {
+		return "", errors.New("Invalid inscription key")
+	}
+	txid, err := d.chainParser.UnpackTxid(key[:pl])
+	if err != nil {
+		return "", err
+	}
+	index, l := unpackVaruint(key[pl:])
+	if l != len(key)-pl {
+		return "", errors.New("Invalid inscription key")
+	}
+	return txid + "i" + strconv.FormatUint(uint64(index), 10), nil
+}
+
+// packInscriptionID packs the inscription id <txid>i<index> to the key of the inscription
+func (d *RocksDB) packInscriptionID(id string) ([]byte, error) {
+	i := strings.LastIndexByte(id, 'i')
+	if i < 0 {
+		return nil, errors.Errorf("Invalid inscription id %v", id)
+	}
+	index, err := strconv.ParseUint(id[i+1:], 10, 32)
+	if err != nil {
+		return nil, errors.Errorf("Invalid inscription id %v", id)
+	}
+	btxID, err := d.chainParser.PackTxid(id[:i])
+	if err != nil {
+		return nil, errors.Errorf("Invalid inscription id %v", id)
+	}
+	return packInscriptionKey(btxID, uint32(index)), nil
+}
+
+func (d *RocksDB) packInscription(ins *Inscription) ([]byte, error) {
+	btxID, err := d.chainParser.PackTxid(ins.Txid)
+	if err != nil {
+		return nil, err
+	}
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := packUint(ins.Height)
+	buf = packString(ins.ContentType, buf)
+	l := packVaruint(uint(ins.ContentLength), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	buf = append(buf, btxID...)
+	l = packVaruint(uint(ins.Vout), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(ins.Offset), varBuf)
+	return append(buf, varBuf[:l]...), nil
+}
+
+func (d *RocksDB) unpackInscription(buf []byte) (*Inscription, error) {
+	pl := d.chainParser.PackedTxidLen()
+	if len(buf) < packedHeightBytes {
+		return nil, errors.New("Invalid packed inscription")
+	}
+	ins := &Inscription{Height: unpackUint(buf)}
+	l := packedHeightBytes
+	var ll int
+	var err error
+	if ins.ContentType, ll, err = unpackString(buf[l:]); err != nil {
+		return nil, errors.New("Invalid packed inscription")
+	}
+	l += ll
+	cl, ll := unpackVaruint(buf[l:])
+	l += ll
+	if ll <= 0 || len(buf) < l+pl {
+		return nil, errors.New("Invalid packed inscription")
+	}
+	ins.ContentLength = uint32(cl)
+	if ins.Txid, err = d.chainParser.UnpackTxid(buf[l : l+pl]); err != nil {
+		return nil, err
+	}
+	l += pl
+	vout, ll := unpackVaruint(buf[l:])
+	l += ll
+	if ll <= 0 {
+		return nil, errors.New("Invalid packed inscription")
+	}
+	ins.Vout = uint32(vout)
+	offset, ll := unpackVaruint(buf[l:])
+	if ll <= 0 || l+ll != len(buf) {
+		return nil, errors.New("Invalid packed inscription")
+	}
+	ins.Offset = uint64(offset)
+	return ins, nil
+}
+
+// packInscriptionLocations packs the inscriptions held by an output ordered by their offset
+func packInscriptionLocations(locations []inscriptionLocation) []byte {
+	sort.SliceStable(locations, func(i, j int) bool { return locations[i].offset < locations[j].offset })
+	varBuf := make([]byte, vlq.MaxLen64)
+	l := packVaruint(uint(len(locations)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	for i := range locations {
+		buf = packString(string(locations[i].id), buf)
+		l = packVaruint(uint(locations[i].offset), varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf
+}
+
+func unpackInscriptionLocations(buf []byte) ([]inscriptionLocation, error) {
+	n, l := unpackVaruint(buf)
+	if l <= 0 || int(n) > len(buf) {
+		return nil, errors.New("Invalid packed inscription locations")
+	}
+	locations := make([]inscriptionLocation, n)
+	for i := range locations {
+		id, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, errors.New("Invalid packed inscription locations")
+		}
+		l += ll
+		offset, ll := unpackVaruint(buf[l:])
+		if ll <= 0 {
+			return nil, errors.New("Invalid packed inscription locations")
+		}
+		l += ll
+		locations[i] = inscriptionLocation{id: []byte(id), offset: uint64(offset)}
+	}
+	if l != len(buf) {
+		return nil, errors.New("Invalid packed inscription locations")
+	}
+	return locations, nil
+}
+
+// getInscriptionLocations returns the inscriptions held by the output given by the packed key, the pending update takes precedence over the db
+func (d *RocksDB) getInscriptionLocations(u *ordinalsUpdate, key []byte) ([]inscriptionLocation, error) {
+	if locations, found := u.outputs[string(key)]; found {
+		return locations, nil
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfInscriptionOutputs], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	return unpackInscriptionLocations(val.Data())
+}
+
+// getInscriptionForUpdate returns the inscription given by the packed key from the pending update,
+// the inscription not yet in the update is read from the db and added to it
+func (d *RocksDB) getInscriptionForUpdate(u *ordinalsUpdate, key []byte) (*Inscription, error) {
+	if ins, found := u.inscriptions[string(key)]; found {
+		return ins, nil
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfInscriptions], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	ins, err := d.unpackInscription(val.Data())
+	if err != nil {
+		return nil, err
+	}
+	if ins.ID, err = d.unpackInscriptionID(key); err != nil {
+		return nil, err
+	}
+	u.inscriptions[string(key)] = ins
+	return ins, nil
+}
+
+// movedInscription is an inscription transferred by a transaction, pos is the position of its sat in the inputs of the transaction
+type movedInscription struct {
+	id  []byte
+	pos uint64
+}
+
+// txAddressesFee returns the fee of the transaction, the difference of the values of its inputs and outputs
+func txAddressesFee(ta *TxAddresses) uint64 {
+	var in, out uint64
+	for i := range ta.Inputs {
+		in += ta.Inputs[i].ValueSat.Uint64()
+	}
+	for i := range ta.Outputs {
+		out += ta.Outputs[i].ValueSat.Uint64()
+	}
+	if in <= out {
+		return 0
+	}
+	return in - out
+}
+
+// coinbaseSubsidy returns the number of the sats of the outputs of the coinbase transaction which precede the sats of the fees
+func coinbaseSubsidy(ta *TxAddresses, fees uint64) uint64 {
+	var out uint64
+	for i := range ta.Outputs {
+		out += ta.Outputs[i].ValueSat.Uint64()
+	}
+	if out <= fees {
+		return 0
+	}
+	return out - fees
+}
+
+// computeOrdinals reveals the inscriptions of the block transactions and transfers the inscriptions held by the spent outputs
+// to the outputs of the transactions by the first in first out order of the sats, the changes are added to the update u
+// the inscriptions whose sats are spent as the fee are moved to the outputs of the coinbase transaction after its subsidy,
+// in the order of the transactions in the block
+// it must be called after processAddressesUTXO, the txAddressesMap must contain the block transactions and their input values
+func (d *RocksDB) computeOrdinals(block *bchain.Block, txAddressesMap map[string]*TxAddresses, u *ordinalsUpdate) error {
+	if !d.ordinals {
+		return nil
+	}
+	coinbase := -1
+	var coinbaseID []byte
+	var coinbaseTa *TxAddresses
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		if len(tx.Vin) == 0 || tx.Vin[0].Coinbase == "" {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			break
+		}
+		if coinbaseTa = txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))]; coinbaseTa != nil {
+			coinbase, coinbaseID = i, btxID
+		}
+		break
+	}
+	var fees []movedInscription
+	var feesBefore uint64
+	for i := range block.Txs {
+		if i == coinbase {
+			continue
+		}
+		tx := &block.Txs[i]
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		ta := txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))]
+		if ta == nil {
+			continue
+		}
+		fee := txAddressesFee(ta)
+		if len(ta.Inputs) != len(tx.Vin) {
+			feesBefore += fee
+			continue
+		}
+		var moved []movedInscription
+		inputsBefore := make([]uint64, len(tx.Vin))
+		var pos uint64
+		for j := range tx.Vin {
+			inputsBefore[j] = pos
+			pos += ta.Inputs[j].ValueSat.Uint64()
+			ibtxID, err := d.chainParser.PackTxid(tx.Vin[j].Txid)
+			if err != nil {
+				continue
+			}
+			key := packWatchedOutpointKey(ibtxID, tx.Vin[j].Vout)
+			locations, err := d.getInscriptionLocations(u, key)
+			if err != nil {
+				return err
+			}
+			if len(locations) == 0 {
+				continue
+			}
+			for _, l := range locations {
+				moved = append(moved, movedInscription{id: l.id, pos: inputsBefore[j] + l.offset})
+			}
+			u.setOutput(key, ta.Inputs[j].AddrDesc, nil)
+		}
+		var totalOut uint64
+		for j := range ta.Outputs {
+			totalOut += ta.Outputs[j].ValueSat.Uint64()
+		}
+		envelopes, err := d.chainParser.GetInscriptions(tx)
+		if err != nil {
+			if err == bchain.ErrNotSupported {
+				return nil
+			}
+			glog.Warningf("rocksdb: height %d, tx %v, inscriptions: %v", block.Height, tx.Txid, err)
+		}
+		for j := range envelopes {
+			e := &envelopes[j]
+			if e.Input < 0 || e.Input >= len(tx.Vin) {
+				continue
+			}
+			key := packInscriptionKey(btxID, uint32(e.Index))
+			u.inscriptions[string(key)] = &Inscription{
+				ID:            tx.Txid + "i" + strconv.Itoa(e.Index),
+				Height:        block.Height,
+				ContentType:   e.ContentType,
+				ContentLength: uint32(e.ContentLength),
+			}
+			p := inputsBefore[e.Input]
+			if e.Pointer != nil && *e.Pointer < totalOut {
+				p = *e.Pointer
+			}
+			moved = append(moved, movedInscription{id: key, pos: p})
+		}
+		if coinbase >= 0 {
+			// the sats of the fee follow the sats of the fees of the preceding transactions in the coinbase
+			kept := moved[:0]
+			for _, m := range moved {
+				if m.pos >= totalOut && m.pos-totalOut < fee {
+					fees = append(fees, movedInscription{id: m.id, pos: feesBefore + m.pos - totalOut})
+				} else {
+					kept = append(kept, m)
+				}
+			}
+			moved = kept
+		}
+		feesBefore += fee
+		if err := d.placeInscriptions(u, block.Height, tx.Txid, btxID, ta, moved); err != nil {
+			return err
+		}
+	}
+	if coinbase >= 0 && len(fees) > 0 {
+		subsidy := coinbaseSubsidy(coinbaseTa, feesBefore)
+		for i := range fees {
+			fees[i].pos += subsidy
+		}
+		return d.placeInscriptions(u, block.Height, block.Txs[coinbase].Txid, coinbaseID, coinbaseTa, fees)
+	}
+	return nil
+}
+
+// placeInscriptions stores the inscriptions moved by the transaction to its outputs by the positions of their sats,
+// the inscriptions after the sats of the outputs are placed to InscriptionFeeVout
+func (d *RocksDB) placeInscriptions(u *ordinalsUpdate, height uint32, txid string, btxID []byte, ta *TxAddresses, moved []movedInscription) error {
+	if len(moved) == 0 {
+		return nil
+	}
+	sort.SliceStable(moved, func(a, b int) bool { return moved[a].pos < moved[b].pos })
+	outputs := make(map[uint32][]inscriptionLocation)
+	var vout int
+	var outBefore uint64
+	for _, m := range moved {
+		for vout < len(ta.Outputs) && m.pos >= outBefore+ta.Outputs[vout].ValueSat.Uint64() {
+			outBefore += ta.Outputs[vout].ValueSat.Uint64()
+			vout++
+		}
+		v := InscriptionFeeVout
+		if vout < len(ta.Outputs) {
+			v = uint32(vout)
+		}
+		offset := m.pos - outBefore
+		outputs[v] = append(outputs[v], inscriptionLocation{id: m.id, offset: offset})
+		ins, err := d.getInscriptionForUpdate(u, m.id)
+		if err != nil {
+			return err
+		}
+		if ins == nil {
+			glog.Warningf("rocksdb: height %d, tx %v, inscription %x not found", height, txid, m.id)
+			continue
+		}
+		ins.Txid, ins.Vout, ins.Offset = txid, v, offset
+	}
+	for v, locations := range outputs {
+		key := packWatchedOutpointKey(btxID, v)
+		existing, err := d.getInscriptionLocations(u, key)
+		if err != nil {
+			return err
+		}
+		var addrDesc bchain.AddressDescriptor
+		if int(v) < len(ta.Outputs) {
+			addrDesc = ta.Outputs[v].AddrDesc
+		}
+		u.setOutput(key, addrDesc, append(existing, locations...))
+	}
+	return nil
+}
+
+// isCoinbaseInputs returns true if the inputs stored in the blockTxs column are the input of the coinbase transaction
+func isCoinbaseInputs(inputs []outpoint) bool {
+	if len(inputs) == 0 {
+		return false
+	}
+	for i := range inputs {
+		for _, b := range inputs[i].btxID {
+			if b != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// disconnectCoinbaseOrdinals returns the inscriptions moved with the fees to the outputs of the coinbase transaction of the disconnected block
+// to InscriptionFeeVout of the transactions which spent them as the fee, it must be called before the transactions of the block are disconnected
+func (d *RocksDB) disconnectCoinbaseOrdinals(u *ordinalsUpdate, height uint32, txs []blockTxs) error {
+	if !d.ordinals {
+		return nil
+	}
+	coinbase := -1
+	tas := make([]*TxAddresses, len(txs))
+	for i := range txs {
+		txid, err := d.chainParser.UnpackTxid(txs[i].btxID)
+		if err != nil {
+			return err
+		}
+		if tas[i], err = d.getTxAddresses(d.txAddressesKey(txs[i].btxID, txid, height)); err != nil {
+			return err
+		}
+		if coinbase < 0 && tas[i] != nil && isCoinbaseInputs(txs[i].inputs) {
+			coinbase = i
+		}
+	}
+	if coinbase < 0 {
+		return nil
+	}
+	cta := tas[coinbase]
+	var moved []movedInscription
+	var outBefore uint64
+	for vout := 0; vout <= len(cta.Outputs); vout++ {
+		v := InscriptionFeeVout
+		var addrDesc bchain.AddressDescriptor
+		if vout < len(cta.Outputs) {
+			v, addrDesc = uint32(vout), cta.Outputs[vout].AddrDesc
+		}
+		key := packWatchedOutpointKey(txs[coinbase].btxID, v)
+		locations, err := d.getInscriptionLocations(u, key)
+		if err != nil {
+			return err
+		}
+		for _, l := range locations {
+			moved = append(moved, movedInscription{id: l.id, pos: outBefore + l.offset})
+		}
+		if len(locations) > 0 {
+			u.setOutput(key, addrDesc, nil)
+		}
+		if vout < len(cta.Outputs) {
+			outBefore += cta.Outputs[vout].ValueSat.Uint64()
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	feesBefore := make([]uint64, len(txs))
+	var fees uint64
+	for i := range txs {
+		feesBefore[i] = fees
+		if i != coinbase && tas[i] != nil {
+			fees += txAddressesFee(tas[i])
+		}
+	}
+	subsidy := coinbaseSubsidy(cta, fees)
+	for _, m := range moved {
+		i := -1
+		if m.pos >= subsidy {
+			p := m.pos - subsidy
+			i = sort.Search(len(txs), func(k int) bool { return feesBefore[k] > p }) - 1
+			for i >= 0 && (i == coinbase || tas[i] == nil || p-feesBefore[i] >= txAddressesFee(tas[i])) {
+				i--
+			}
+		}
+		if i < 0 {
+			glog.Warningf("rocksdb: disconnect coinbase %x, inscription %x at position %d not found in fees", txs[coinbase].btxID, m.id, m.pos)
+			continue
+		}
+		offset := m.pos - subsidy - feesBefore[i]
+		key := packWatchedOutpointKey(txs[i].btxID, InscriptionFeeVout)
+		existing, err := d.getInscriptionLocations(u, key)
+		if err != nil {
+			return err
+		}
+		u.setOutput(key, nil, append(existing, inscriptionLocation{id: m.id, offset: offset}))
+		ins, err := d.getInscriptionForUpdate(u, m.id)
+		if err != nil {
+			return err
+		}
+		if ins == nil {
+			continue
+		}
+		if ins.Txid, err = d.chainParser.UnpackTxid(txs[i].btxID); err != nil {
+			return err
+		}
+		ins.Vout, ins.Offset = InscriptionFeeVout, offset
+	}
+	return nil
+}
+
+// disconnectOrdinals reverts the changes of the inscriptions made by the disconnected transaction, the inscriptions revealed by it are deleted
+// and the inscriptions transferred by it are returned to the spent outputs, the transactions must be disconnected in the reverse order
+func (d *RocksDB) disconnectOrdinals(u *ordinalsUpdate, btxID []byte, inputs []outpoint, ta *TxAddresses) error {
+	if !d.ordinals {
+		return nil
+	}
+	var moved []movedInscription
+	var outBefore uint64
+	for vout := 0; vout <= len(ta.Outputs); vout++ {
+		v := InscriptionFeeVout
+		var addrDesc bchain.AddressDescriptor
+		if vout < len(ta.Outputs) {
+			v, addrDesc = uint32(vout), ta.Outputs[vout].AddrDesc
+		}
+		key := packWatchedOutpointKey(btxID, v)
+		locations, err := d.getInscriptionLocations(u, key)
+		if err != nil {
+			return err
+		}
+		for _, l := range locations {
+			moved = append(moved, movedInscription{id: l.id, pos: outBefore + l.offset})
+		}
+		if len(locations) > 0 {
+			u.setOutput(key, addrDesc, nil)
+		}
+		if vout < len(ta.Outputs) {
+			outBefore += ta.Outputs[vout].ValueSat.Uint64()
+		}
+	}
+	pl := d.chainParser.PackedTxidLen()
+	for _, m := range moved {
+		if len(m.id) > pl && bytes.Equal(m.id[:pl], btxID) {
+			u.inscriptions[string(m.id)] = nil
+			continue
+		}
+		var inBefore uint64
+		j := 0
+		for ; j < len(ta.Inputs) && j < len(inputs); j++ {
+			value := ta.Inputs[j].ValueSat.Uint64()
+			if m.pos < inBefore+value {
+				break
+			}
+			inBefore += value
+		}
+		if j >= len(ta.Inputs) || j >= len(inputs) {
+			glog.Warningf("rocksdb: disconnect tx %x, inscription %x at position %d not found in inputs", btxID, m.id, m.pos)
+			continue
+		}
+		key := packWatchedOutpointKey(inputs[j].btxID, uint32(inputs[j].index))
+		existing, err := d.getInscriptionLocations(u, key)
+		if err != nil {
+			return err
+		}
+		offset := m.pos - inBefore
+		u.setOutput(key, ta.Inputs[j].AddrDesc, append(existing, inscriptionLocation{id: m.id, offset: offset}))
+		ins, err := d.getInscriptionForUpdate(u, m.id)
+		if err != nil {
+			return err
+		}
+		if ins == nil {
+			continue
+		}
+		if ins.Txid, err = d.chainParser.UnpackTxid(inputs[j].btxID); err != nil {
+			return err
+		}
+		ins.Vout, ins.Offset = uint32(inputs[j].index), offset
+	}
+	return nil
+}
+
+// storeOrdinals writes the pending update of the inscriptions and inscribed outputs to the write batch
+func (d *RocksDB) storeOrdinals(wb *gorocksdb.WriteBatch, u *ordinalsUpdate) error {
+	for key, locations := range u.outputs {
+		var addrKey []byte
+		if addrDesc := u.addrDescs[key]; len(addrDesc) > 0 {
+			addrKey = packInscriptionAddressKey(addrDesc, []byte(key))
+		}
+		if len(locations) == 0 {
+			wb.DeleteCF(d.cfh[cfInscriptionOutputs], []byte(key))
+			if addrKey != nil {
+				wb.DeleteCF(d.cfh[cfInscriptionAddresses], addrKey)
+			}
+		} else {
+			wb.PutCF(d.cfh[cfInscriptionOutputs], []byte(key), packInscriptionLocations(locations))
+			if addrKey != nil {
+				wb.PutCF(d.cfh[cfInscriptionAddresses], addrKey, []byte{})
+			}
+		}
+	}
+	for key, ins := range u.inscriptions {
+		if ins == nil {
+			wb.DeleteCF(d.cfh[cfInscriptions], []byte(key))
+			continue
+		}
+		buf, err := d.packInscription(ins)
+		if err != nil {
+			return errors.Annotatef(err, "inscription %v", ins.ID)
+		}
+		wb.PutCF(d.cfh[cfInscriptions], []byte(key), buf)
+	}
+	return nil
+}
+
+// GetInscription returns the inscription with the id <genesis txid>i<index> or nil if it is not found
+func (d *RocksDB) GetInscription(id string) (ins *Inscription, err error) {
+	defer func(s time.Time) { d.observeMethod("GetInscription", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	key, err := d.packInscriptionID(id)
+	if err != nil {
+		return nil, err
+	}
+	return d.getInscriptionForUpdate(newOrdinalsUpdate(), key)
+}
+
+// GetOutputInscriptions returns the inscriptions held by the unspent output ordered by their offset in the output
+func (d *RocksDB) GetOutputInscriptions(txid string, vout uint32) (r []Inscription, err error) {
+	defer func(s time.Time) { d.observeMethod("GetOutputInscriptions", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	return d.getOutputInscriptions(btxID, vout)
+}
+
+func (d *RocksDB) getOutputInscriptions(btxID []byte, vout uint32) ([]Inscription, error) {
+	u := newOrdinalsUpdate()
+	locations, err := d.getInscriptionLocations(u, packWatchedOutpointKey(btxID, vout))
+	if err != nil {
+		return nil, err
+	}
+	var r []Inscription
+	for _, l := range locations {
+		ins, err := d.getInscriptionForUpdate(u, l.id)
+		if err != nil {
+			return nil, err
+		}
+		if ins != nil {
+			r = append(r, *ins)
+		}
+	}
+	return r, nil
+}
+
+// GetAddrDescInscriptions returns the inscriptions held by the unspent outputs of the address,
+// the outputs are read from the inscriptionAddresses column ordered by their txid and vout
+func (d *RocksDB) GetAddrDescInscriptions(addrDesc bchain.AddressDescriptor) (r []Inscription, err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescInscriptions", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	r = []Inscription{}
+	prefix := packInscriptionAddressKey(addrDesc, nil)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfInscriptionAddresses])
+	defer it.Close()
+	u := newOrdinalsUpdate()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		locations, err := d.getInscriptionLocations(u, key[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range locations {
+			ins, err := d.getInscriptionForUpdate(u, l.id)
+			if err != nil {
+				return nil, err
+			}
+			if ins != nil {
+				r = append(r, *ins)
+			}
+		}
+	}
+	return r, nil
+}
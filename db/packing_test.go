@@ -0,0 +1,650 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/tests/dbtestdata"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden file of the packed db values and the generated docs/rocksdb-schema.md")
+
+const packingGoldenFile = "testdata/packing.golden"
+
+// packingGolden is the content of the golden file, the packed values are stored as hex
+// together with the db version, in which they were generated
+type packingGolden struct {
+	DbVersion uint32            `json:"dbVersion"`
+	Values    map[string]string `json:"values"`
+}
+
+// packingFixture is a value stored in the db, pack returns its packed form, unpack must return the value back
+type packingFixture struct {
+	name   string
+	value  interface{}
+	pack   func() ([]byte, error)
+	unpack func(b []byte) (interface{}, error)
+}
+
+func bigintFromString(s string) big.Int {
+	var r big.Int
+	if _, ok := r.SetString(s, 10); !ok {
+		panic("invalid big int " + s)
+	}
+	return r
+}
+
+func packingFixtures() []packingFixture {
+	parser := bitcoinTestnetParser()
+	d := &RocksDB{chainParser: parser}
+	b1, _ := hex.DecodeString(dbtestdata.TxidB1T1)
+	b2, _ := hex.DecodeString(dbtestdata.TxidB2T1)
+	ta := &TxAddresses{
+		Height: 500000,
+		Inputs: []TxInput{
+			{AddrDesc: addressToAddrDesc(dbtestdata.Addr1, parser), ValueSat: *big.NewInt(100000000)},
+			{AddrDesc: []byte{}, ValueSat: bigintFromString("123456789012345678901234567890")},
+		},
+		Outputs: []TxOutput{
+			{AddrDesc: addressToAddrDesc(dbtestdata.Addr2, parser), ValueSat: *big.NewInt(99990000), Spent: true},
+			{AddrDesc: addressToAddrDesc(dbtestdata.Addr4, parser), ValueSat: *big.NewInt(0)},
+		},
+	}
+	// consolidation transaction with repeated addrDesc
+	taRefs := &TxAddresses{
+		Height: 225494,
+		Inputs: []TxInput{
+			{AddrDesc: addressToAddrDesc(dbtestdata.Addr1, parser), ValueSat: *big.NewInt(100000000)},
+			{AddrDesc: addressToAddrDesc(dbtestdata.Addr1, parser), ValueSat: *big.NewInt(200000000)},
+		},
+		Outputs: []TxOutput{
+			{AddrDesc: addressToAddrDesc(dbtestdata.Addr1, parser), ValueSat: *big.NewInt(299990000), Spent: true},
+			{AddrDesc: addressToAddrDesc(dbtestdata.Addr2, parser), ValueSat: *big.NewInt(0)},
+		},
+	}
+	ab := &AddrBalance{Txs: 12, SentSat: *big.NewInt(123456789), BalanceSat: *big.NewInt(987654321)}
+	abNonce := &AddrBalance{Txs: 1, BalanceSat: bigintFromString("1000000000000000000"), Nonce: 300}
+	abCounterparties := &AddrBalance{Txs: 3, SentSat: *big.NewInt(5), BalanceSat: *big.NewInt(7), Counterparties: &CounterpartySketch{3: 2, 40: 1}}
+	bi := &BlockInfo{
+		Hash: "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997",
+		Time: 1534858022,
+		Txs:  2,
+		Size: 1234,
+	}
+	// block info followed by the extension with the version and the bits of the header of bitcoin-like coins
+	biExtra := &BlockInfo{
+		Hash: "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997",
+		Time: 1534858022,
+		Txs:  2,
+		Size: 1234,
+		Extra: bchain.BlockExtra{
+			"version":       int32(0x20000002),
+			"versionHex":    "20000002",
+			"bits":          "1d00ffff",
+			"difficulty":    float64(1),
+			"signalledBits": []int{1},
+		},
+	}
+	// block info followed by the extension with the weight and the sigops and the fields of the header
+	biStats := &BlockInfo{
+		Hash:   "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997",
+		Time:   1534858022,
+		Txs:    2,
+		Size:   1234,
+		Extra:  biExtra.Extra,
+		Weight: 3993,
+		SigOps: 80,
+	}
+	bf := &BlockFeeStats{
+		Txs:          1234,
+		TotalFeesSat: *big.NewInt(98765432),
+		FeeRates:     []uint64{1000, 2500, 10000, 50001, 1234567},
+	}
+	sa := map[int][]bchain.ScriptAnnotation{
+		3: {{Classifier: "vault", Type: "timelock", Fields: map[string]string{"key": "02ab", "delay": "144"}}},
+		0: {{Classifier: "vault", Type: "recovery"}},
+	}
+	wa := &WatchedAddress{Address: dbtestdata.Addr1, Label: "cold wallet", Webhook: "https://example.com/hook"}
+	ec := &Erc20Contract{
+		Erc20Contract: bchain.Erc20Contract{Contract: "0x682b7903a11098cf770c7aef4aa02a85b3f3601a", Name: "Tether USD", Symbol: "USDT", Decimals: 6},
+		Fetched:       1534858022,
+	}
+	re := &ReorgEvent{
+		OldTipHeight: 225494,
+		OldTipHash:   "00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6",
+		NewTipHeight: 225495,
+		NewTipHash:   bi.Hash,
+		ForkHeight:   225492,
+		Depth:        2,
+		Detected:     1534859200,
+		Resolved:     1534859260,
+	}
+	cc := &CoinControl{Label: "cold storage", Frozen: true}
+	bs := &BlockSupply{Height: 225494}
+	bs.OutputsSat.SetInt64(1553211892453)
+	bs.InputsSat.SetInt64(1551851863406)
+	bs.Total = IndexedSupply{FromHeight: 225493, ToHeight: 225494, Blocks: 2}
+	bs.Total.OutputsSat.SetInt64(2787879804798)
+	bs.Total.InputsSat.SetInt64(1551851863406)
+	tweak, _ := hex.DecodeString("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	sp := &SilentPayment{K: 1, Tweak: tweak}
+	sp.ValueSat.SetInt64(50000)
+	nr := &NameRecord{Vout: 1, Op: bchain.NameOpUpdate, Value: []byte(`{"ip":"1.2.3.4"}`), Owner: addressToAddrDesc(dbtestdata.Addr1, parser)}
+	acc := &AddressContract{Contract: true, Checked: 1546300800}
+	cj := &CoinjoinTx{Type: CoinjoinWhirlpool, EqualOutputs: 5, DenominationSat: *big.NewInt(5000000)}
+	msw := &multisigWallet{
+		MultisigWallet: MultisigWallet{
+			Name:        "vault",
+			Descriptors: []string{"wsh(multi(1,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7))"},
+			Lookahead:   100,
+			Webhook:     "http://localhost/hook",
+		},
+		used:    []uint32{7},
+		derived: []uint32{0},
+		nextSeq: 42,
+	}
+	mswScan := &multisigWallet{
+		MultisigWallet: MultisigWallet{
+			Name:        "cold",
+			Descriptors: []string{"wsh(multi(1,03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7))"},
+			Lookahead:   100,
+			Birthday:    225493,
+		},
+		used:    []uint32{0},
+		derived: []uint32{0},
+		scanned: 225493,
+		scanTo:  225494,
+	}
+	mswToken := &multisigWallet{
+		MultisigWallet: msw.MultisigWallet,
+		used:           []uint32{7},
+		derived:        []uint32{0},
+		nextSeq:        42,
+	}
+	mswToken.Token = "0123456789abcdef0123456789abcdef"
+	ins := &Inscription{Height: 225494, ContentType: "text/plain", ContentLength: 5, Txid: dbtestdata.TxidB1T1, Vout: 1}
+	burns := []BurnStats{{AddrDesc: bchain.AddressDescriptor{}, Outputs: 2}, {AddrDesc: addressToAddrDesc(dbtestdata.Addr1, parser), Outputs: 1}}
+	burns[0].BurnedSat.SetInt64(1000)
+	burns[1].BurnedSat.SetInt64(123456789)
+	burnTotals := &BurnStats{Outputs: 300}
+	burnTotals.BurnedSat.SetInt64(1000)
+	anomaly := &AmountAnomaly{Kind: AmountAnomalyNegativeBalance, Count: 3, FirstHeight: 225493, LastHeight: 225494}
+	anomaly.ValueSat.SetInt64(-1000)
+	withdrawals := []Withdrawal{
+		{Height: 225493, Index: 1715004, ValidatorIndex: 455922, AmountSat: *big.NewInt(15980247000000000)},
+		{Height: 225493, Index: 1715005, ValidatorIndex: 1, AmountSat: *big.NewInt(32000000000000000)},
+	}
+	idb := &indexDeltaBlock{
+		height: 225494,
+		hash:   "00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6",
+		prev:   "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997",
+		records: []indexDeltaRecord{
+			{op: indexDeltaPut, column: cfHeight, key: packUint(225494), value: []byte{1, 2, 3}},
+			{op: indexDeltaDelete, column: cfAddresses, key: []byte{0x76, 0xa9}},
+		},
+	}
+	ihe := &indexHashEntry{
+		from: 225000,
+		columns: map[string][]byte{
+			"addresses": bytes.Repeat([]byte{0x11}, 32),
+			"height":    bytes.Repeat([]byte{0x22}, 32),
+		},
+	}
+	holding := &HoldingStats{Outputs: 3, HeldSeconds: 172800}
+	holding.ValueSat.SetInt64(300000000)
+	holding.CoinSeconds.SetInt64(25920000000000)
+	wac := &WalletAccount{
+		Name:        "savings",
+		Descriptors: []string{"wpkh(03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7)", "pkh(03774ae7f858a9411e5ef4246b70c65aac5649980be5c17891bbec17895da008cb)"},
+		Gap:         20,
+	}
+	wacToken := &WalletAccount{Name: wac.Name, Token: "0123456789abcdef0123456789abcdef", Descriptors: wac.Descriptors, Gap: 5}
+	largest := []LargestTx{{Txid: dbtestdata.TxidB1T1, Height: 225493}, {Txid: dbtestdata.TxidB2T1, Height: 225493}}
+	largest[0].ValueSat.SetInt64(100012345)
+	largest[1].ValueSat.SetInt64(5)
+	insLocations := []inscriptionLocation{{id: packInscriptionKey(b2, 0)}, {id: packInscriptionKey(b1, 2), offset: 100}}
+	mse := &MultisigEvent{
+		Type:       MultisigEventSpend,
+		Txid:       dbtestdata.TxidB1T1,
+		Address:    dbtestdata.Addr3,
+		AddrDesc:   addressToAddrDesc(dbtestdata.Addr3, parser),
+		Descriptor: 1,
+		Index:      7,
+		Height:     225493,
+		Time:       1534858022,
+	}
+	mseDisconnected := *mse
+	mseDisconnected.Disconnected = true
+	arb := &ArchivedBlock{Hash: bi.Hash, CID: "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"}
+	bigints := []big.Int{*big.NewInt(0), *big.NewInt(1), *big.NewInt(2100000000000000), bigintFromString("115792089237316195423570985008687907853269984665640564039457584007913129639935")}
+	return []packingFixture{
+		{
+			name:  "txAddresses",
+			value: ta,
+			pack: func() ([]byte, error) {
+				return packTxAddresses(ta, make([]byte, 1024), make([]byte, maxPackedBigintBytes)), nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return unpackTxAddresses(b) },
+		},
+		{
+			name:  "txAddressesRefs",
+			value: taRefs,
+			pack: func() ([]byte, error) {
+				return packTxAddresses(taRefs, make([]byte, 1024), make([]byte, maxPackedBigintBytes)), nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return unpackTxAddresses(b) },
+		},
+		{
+			name:  "addressOutpoints",
+			value: []outpoint{{b1, 0}, {b1, ^0}, {b1, 10}, {b2, ^1}},
+			pack: func() ([]byte, error) {
+				return d.packAddressOutpoints([]outpoint{{b1, 0}, {b2, ^1}, {b1, ^0}, {b1, 10}}), nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return d.unpackAddressOutpoints(b) },
+		},
+		{
+			name:   "outpoints",
+			value:  []outpoint{{b1, 3}, {b2, ^0}},
+			pack:   func() ([]byte, error) { return d.packOutpoints([]outpoint{{b1, 3}, {b2, ^0}}), nil },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackOutpoints(b) },
+		},
+		{
+			name:  "bigints",
+			value: bigints,
+			pack: func() ([]byte, error) {
+				var r []byte
+				buf := make([]byte, maxPackedBigintBytes)
+				for i := range bigints {
+					l := packBigint(&bigints[i], buf)
+					r = append(r, buf[:l]...)
+				}
+				return r, nil
+			},
+			unpack: func(b []byte) (interface{}, error) {
+				var r []big.Int
+				for len(b) > 0 {
+					bi, l := unpackBigint(b)
+					r = append(r, bi)
+					b = b[l:]
+				}
+				return r, nil
+			},
+		},
+		{
+			name:  "addrBalance",
+			value: ab,
+			pack: func() ([]byte, error) {
+				buf := make([]byte, 64)
+				return buf[:packAddrBalance(ab, buf)], nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return unpackAddrBalance(b), nil },
+		},
+		{
+			name:  "addrBalanceNonce",
+			value: abNonce,
+			pack: func() ([]byte, error) {
+				buf := make([]byte, 64)
+				return buf[:packAddrBalance(abNonce, buf)], nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return unpackAddrBalance(b), nil },
+		},
+		{
+			name:  "addrBalanceCounterparties",
+			value: abCounterparties,
+			pack: func() ([]byte, error) {
+				buf := make([]byte, 128)
+				return buf[:packAddrBalance(abCounterparties, buf)], nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return unpackAddrBalance(b), nil },
+		},
+		{
+			name:   "nonceUndo",
+			value:  nonceUndo{height: 123456, sentTxs: 2, nonce: 300, stored: true},
+			pack:   func() ([]byte, error) { return packNonceUndo(300), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackNonceUndo(123456, 2, b), nil },
+		},
+		{
+			name:   "blockInfo",
+			value:  bi,
+			pack:   func() ([]byte, error) { return d.packBlockInfo(bi) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackBlockInfo(b) },
+		},
+		{
+			name:   "blockInfoExtra",
+			value:  biExtra,
+			pack:   func() ([]byte, error) { return d.packBlockInfo(biExtra) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackBlockInfo(b) },
+		},
+		{
+			name:   "blockInfoStats",
+			value:  biStats,
+			pack:   func() ([]byte, error) { return d.packBlockInfo(biStats) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackBlockInfo(b) },
+		},
+		{
+			name:   "blockFeeStats",
+			value:  bf,
+			pack:   func() ([]byte, error) { return packBlockFeeStats(bf), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackBlockFeeStats(0, b) },
+		},
+		{
+			name:   "scriptAnnotations",
+			value:  sa,
+			pack:   func() ([]byte, error) { return packScriptAnnotations(sa), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackScriptAnnotations(b) },
+		},
+		{
+			name:   "watchedAddress",
+			value:  wa,
+			pack:   func() ([]byte, error) { return packWatchedAddress(wa), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackWatchedAddress(b) },
+		},
+		{
+			name:   "archivedBlock",
+			value:  arb,
+			pack:   func() ([]byte, error) { return d.packArchivedBlock(arb) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackArchivedBlock(0, b) },
+		},
+		{
+			name:   "erc20Contract",
+			value:  ec,
+			pack:   func() ([]byte, error) { return packErc20Contract(ec), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackErc20Contract(b) },
+		},
+		{
+			name:   "reorgEvent",
+			value:  re,
+			pack:   func() ([]byte, error) { return d.packReorgEvent(re) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackReorgEvent(b) },
+		},
+		{
+			name:   "coinControl",
+			value:  cc,
+			pack:   func() ([]byte, error) { return packCoinControl(cc), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackCoinControl(b) },
+		},
+		{
+			name:   "blockSupply",
+			value:  bs,
+			pack:   func() ([]byte, error) { return packBlockSupply(bs), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackBlockSupply(225494, b) },
+		},
+		{
+			name:   "blockBurns",
+			value:  burns,
+			pack:   func() ([]byte, error) { return packBlockBurns(burns), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackBlockBurns(b) },
+		},
+		{
+			name:  "burnTotals",
+			value: burnTotals,
+			pack:  func() ([]byte, error) { return appendBurnStats(nil, burnTotals), nil },
+			unpack: func(b []byte) (interface{}, error) {
+				r := &BurnStats{}
+				_, err := unpackBurnStats(b, r)
+				return r, err
+			},
+		},
+		{
+			name:   "amountAnomaly",
+			value:  anomaly,
+			pack:   func() ([]byte, error) { return packAmountAnomaly(anomaly), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackAmountAnomaly(AmountAnomalyNegativeBalance, b) },
+		},
+		{
+			name:  "withdrawals",
+			value: withdrawals,
+			pack: func() ([]byte, error) {
+				ws := make([]bchain.Withdrawal, len(withdrawals))
+				for i, w := range withdrawals {
+					ws[i] = bchain.Withdrawal{Index: w.Index, ValidatorIndex: w.ValidatorIndex, AmountSat: w.AmountSat}
+				}
+				return packWithdrawals(ws), nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return unpackWithdrawals(225493, b) },
+		},
+		{
+			name:   "holdingStats",
+			value:  holding,
+			pack:   func() ([]byte, error) { return packHoldingStats(holding), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackHoldingStats(b) },
+		},
+		{
+			name:   "largestTxs",
+			value:  largest,
+			pack:   func() ([]byte, error) { return d.packLargestTxs(largest) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackLargestTxs(225493, b) },
+		},
+		{
+			name:   "indexDeltaBlock",
+			value:  idb,
+			pack:   func() ([]byte, error) { return packIndexDeltaBlock(idb), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackIndexDeltaBlock(b) },
+		},
+		{
+			name:   "indexHash",
+			value:  ihe,
+			pack:   func() ([]byte, error) { return packIndexHashEntry(ihe), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackIndexHashEntry(b) },
+		},
+		{
+			name:  "methodSignatures",
+			value: []string{"transfer(address,uint256)", "many_msg_babbage(bytes1)"},
+			pack: func() ([]byte, error) {
+				return packMethodSignatures([]string{"transfer(address,uint256)", "many_msg_babbage(bytes1)"}), nil
+			},
+			unpack: func(b []byte) (interface{}, error) { return unpackMethodSignatures(b) },
+		},
+		{
+			name:  "silentPayment",
+			value: sp,
+			pack: func() ([]byte, error) {
+				return packSilentPayment(&silentPaymentOutput{match: bchain.SilentPaymentMatch{K: sp.K, Tweak: sp.Tweak}, value: sp.ValueSat}), nil
+			},
+			unpack: func(b []byte) (interface{}, error) {
+				r := &SilentPayment{}
+				return r, unpackSilentPayment(b, r)
+			},
+		},
+		{
+			name:   "addressContract",
+			value:  acc,
+			pack:   func() ([]byte, error) { return packAddressContract(acc), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackAddressContract(b) },
+		},
+		{
+			name:   "coinjoinTx",
+			value:  cj,
+			pack:   func() ([]byte, error) { return packCoinjoinTx(cj), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackCoinjoinTx(b) },
+		},
+		{
+			name:   "multisigWallet",
+			value:  msw,
+			pack:   func() ([]byte, error) { return packMultisigWallet(msw), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackMultisigWallet(b) },
+		},
+		{
+			name:   "multisigWalletScan",
+			value:  mswScan,
+			pack:   func() ([]byte, error) { return packMultisigWallet(mswScan), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackMultisigWallet(b) },
+		},
+		{
+			name:   "multisigWalletToken",
+			value:  mswToken,
+			pack:   func() ([]byte, error) { return packMultisigWallet(mswToken), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackMultisigWallet(b) },
+		},
+		{
+			name:   "walletAccount",
+			value:  wac,
+			pack:   func() ([]byte, error) { return packWalletAccount(wac), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackWalletAccount("savings", b) },
+		},
+		{
+			name:   "walletAccountToken",
+			value:  wacToken,
+			pack:   func() ([]byte, error) { return packWalletAccount(wacToken), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackWalletAccount("savings", b) },
+		},
+		{
+			name:   "multisigEvent",
+			value:  mse,
+			pack:   func() ([]byte, error) { return d.packMultisigEvent(mse) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackMultisigEvent(b) },
+		},
+		{
+			name:   "multisigEventDisconnected",
+			value:  &mseDisconnected,
+			pack:   func() ([]byte, error) { return d.packMultisigEvent(&mseDisconnected) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackMultisigEvent(b) },
+		},
+		{
+			name:   "inscription",
+			value:  ins,
+			pack:   func() ([]byte, error) { return d.packInscription(ins) },
+			unpack: func(b []byte) (interface{}, error) { return d.unpackInscription(b) },
+		},
+		{
+			name:   "inscriptionLocations",
+			value:  insLocations,
+			pack:   func() ([]byte, error) { return packInscriptionLocations(insLocations), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackInscriptionLocations(b) },
+		},
+		{
+			name:   "paymentIDVouts",
+			value:  []uint32{0, 2, 300},
+			pack:   func() ([]byte, error) { return packPaymentIDVouts([]uint32{0, 2, 300}), nil },
+			unpack: func(b []byte) (interface{}, error) { return unpackPaymentIDVouts(b) },
+		},
+		{
+			name:  "nameOp",
+			value: nr,
+			pack: func() ([]byte, error) {
+				return packNameOp(nr.Vout, &bchain.NameOperation{Op: nr.Op, Value: nr.Value, Owner: nr.Owner}), nil
+			},
+			unpack: func(b []byte) (interface{}, error) {
+				r := &NameRecord{}
+				return r, unpackNameOp(b, r)
+			},
+		},
+	}
+}
+
+// TestPacking_Golden checks that the values are packed byte-exactly as in the golden file
+// and that the golden values are unpacked to the original values. A change of the packed format
+// must be accompanied by the increase of dbVersion (and a migration), the golden file is then
+// regenerated by running the test with the flag -update-golden
+func TestPacking_Golden(t *testing.T) {
+	fixtures := packingFixtures()
+	var golden packingGolden
+	if !*updateGolden {
+		b, err := ioutil.ReadFile(packingGoldenFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(b, &golden); err != nil {
+			t.Fatal(err)
+		}
+		if golden.DbVersion != dbVersion {
+			t.Fatalf("Golden file was generated by db version %d, current db version is %d, regenerate it with -update-golden", golden.DbVersion, dbVersion)
+		}
+	} else {
+		golden = packingGolden{DbVersion: dbVersion, Values: make(map[string]string)}
+	}
+	names := make(map[string]struct{})
+	for _, f := range fixtures {
+		names[f.name] = struct{}{}
+		t.Run(f.name, func(t *testing.T) {
+			b, err := f.pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the packing must not depend on map iteration or other random order
+			for i := 0; i < 10; i++ {
+				bb, err := f.pack()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, bb) {
+					t.Fatalf("Packing is not deterministic, %x != %x", b, bb)
+				}
+			}
+			h := hex.EncodeToString(b)
+			if *updateGolden {
+				golden.Values[f.name] = h
+				return
+			}
+			g, found := golden.Values[f.name]
+			if !found {
+				t.Fatal("Missing in the golden file, regenerate it with -update-golden")
+			}
+			if h != g {
+				t.Errorf("Packed %v, golden %v: the packed format changed, increase dbVersion, add migration and regenerate the golden file", h, g)
+			}
+			gb, err := hex.DecodeString(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.unpack(gb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, f.value) {
+				t.Errorf("Unpacked golden %+v, want %+v", got, f.value)
+			}
+		})
+	}
+	if *updateGolden {
+		b, err := json.MarshalIndent(&golden, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(packingGoldenFile, append(b, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	var stale []string
+	for n := range golden.Values {
+		if _, found := names[n]; !found {
+			stale = append(stale, n)
+		}
+	}
+	sort.Strings(stale)
+	if len(stale) > 0 {
+		t.Errorf("Golden values %v have no fixture, regenerate the golden file with -update-golden", stale)
+	}
+}
+
+// TestPacking_KeyOrder checks that the packed keys of the columns iterated by height are ordered by height
+func TestPacking_KeyOrder(t *testing.T) {
+	addrDesc := addressToAddrDesc(dbtestdata.Addr1, bitcoinTestnetParser())
+	heights := []uint32{0, 1, 127, 128, 255, 256, 65535, 65536, 225493, 1 << 24, 1<<32 - 1}
+	keys := []struct {
+		name string
+		pack func(height uint32) []byte
+	}{
+		{"height", packUint},
+		{"addresses", func(height uint32) []byte { return packAddressKey(addrDesc, height) }},
+		{"heightAddresses", func(height uint32) []byte { return packHeightAddressKey(height, addrDesc) }},
+		{"fees", packBlockFeeStatsKey},
+	}
+	for _, k := range keys {
+		for i := 1; i < len(heights); i++ {
+			if bytes.Compare(k.pack(heights[i-1]), k.pack(heights[i])) >= 0 {
+				t.Errorf("%s: key of height %d is not lower than key of height %d", k.name, heights[i-1], heights[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"time"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// PaymentIDTx is a transaction with the outputs carrying the payment id
+type PaymentIDTx struct {
+	PaymentID []byte
+	Height    uint32
+	Txid      string
+	Vouts     []uint32
+}
+
+// paymentIDOutputs are the outputs of a block transaction with the payment id before they are stored, btxID is the packed txid
+type paymentIDOutputs struct {
+	paymentID []byte
+	height    uint32
+	btxID     []byte
+	vouts     []uint32
+}
+
+// SetPaymentIDs enables the index of the payment ids attached to the outputs
+// the payment ids of the disconnected blocks are found in the output scripts in txAddresses,
+// therefore the index must not be combined with the index filter, which removes the scripts of the filtered outputs
+func (d *RocksDB) SetPaymentIDs(enabled bool) {
+	d.paymentIDs = enabled
+}
+
+// PaymentIDsEnabled returns true if the payment ids are indexed
+func (d *RocksDB) PaymentIDsEnabled() bool {
+	return d.paymentIDs
+}
+
+// computePaymentIDs returns the payment ids attached to the outputs of the block transactions
+func (d *RocksDB) computePaymentIDs(block *bchain.Block) []paymentIDOutputs {
+	if !d.paymentIDs {
+		return nil
+	}
+	var r []paymentIDOutputs
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		var btxID []byte
+		// the index of the payment id in r, the outputs of the transaction with the same payment id are stored together
+		txPaymentIDs := make(map[string]int)
+		for j := range tx.Vout {
+			addrDesc, err := d.chainParser.GetAddrDescFromVout(&tx.Vout[j])
+			if err != nil || len(addrDesc) == 0 {
+				continue
+			}
+			m, err := d.chainParser.GetOutputMemo(addrDesc)
+			if err == bchain.ErrNotSupported {
+				return nil
+			}
+			if err != nil || m == nil || len(m.PaymentID) == 0 {
+				continue
+			}
+			if btxID == nil {
+				if btxID, err = d.chainParser.PackTxid(tx.Txid); err != nil {
+					break
+				}
+			}
+			if k, found := txPaymentIDs[string(m.PaymentID)]; found {
+				r[k].vouts = append(r[k].vouts, tx.Vout[j].N)
+				continue
+			}
+			txPaymentIDs[string(m.PaymentID)] = len(r)
+			r = append(r, paymentIDOutputs{paymentID: m.PaymentID, height: block.Height, btxID: btxID, vouts: []uint32{tx.Vout[j].N}})
+		}
+	}
+	return r
+}
+
+func packPaymentIDKey(paymentID []byte, height uint32, btxID []byte) []byte {
+	key := append(packString(string(paymentID), nil), packUint(height)...)
+	return append(key, btxID...)
+}
+
+func (d *RocksDB) unpackPaymentIDKey(key []byte, p *PaymentIDTx) error {
+	id, l, err := unpackString(key)
+	if err != nil {
+		return err
+	}
+	if len(key) != l+packedHeightBytes+d.chainParser.PackedTxidLen() {
+		return errors.New("Invalid payment id key")
+	}
+	p.PaymentID = []byte(id)
+	p.Height = unpackUint(key[l:])
+	p.Txid, err = d.chainParser.UnpackTxid(key[l+packedHeightBytes:])
+	return err
+}
+
+func packPaymentIDVouts(vouts []uint32) []byte {
+	varBuf := make([]byte, vlq.MaxLen32)
+	l := packVaruint(uint(len(vouts)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	for _, v := range vouts {
+		l = packVaruint(uint(v), varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf
+}
+
+func unpackPaymentIDVouts(buf []byte) ([]uint32, error) {
+	n, l := unpackVaruint(buf)
+	if l <= 0 || int(n) > len(buf) {
+		return nil, errors.New("Invalid packed payment id vouts")
+	}
+	vouts := make([]uint32, n)
+	for i := range vouts {
+		v, ll := unpackVaruint(buf[l:])
+		if ll <= 0 {
+			return nil, errors.New("Invalid packed payment id vouts")
+		}
+		vouts[i] = uint32(v)
+		l += ll
+	}
+	if l != len(buf) {
+		return nil, errors.New("Invalid packed payment id vouts")
+	}
+	return vouts, nil
+}
+
+func (d *RocksDB) storePaymentIDs(wb *gorocksdb.WriteBatch, outputs []paymentIDOutputs) {
+	for i := range outputs {
+		o := &outputs[i]
+		wb.PutCF(d.cfh[cfPaymentIDs], packPaymentIDKey(o.paymentID, o.height, o.btxID), packPaymentIDVouts(o.vouts))
+	}
+}
+
+// disconnectedPaymentIDs adds the payment ids of the outputs of the disconnected transaction to paymentIDs
+func (d *RocksDB) disconnectedPaymentIDs(ta *TxAddresses, paymentIDs map[string]struct{}) {
+	if !d.paymentIDs {
+		return
+	}
+	for i := range ta.Outputs {
+		if len(ta.Outputs[i].AddrDesc) == 0 {
+			continue
+		}
+		m, err := d.chainParser.GetOutputMemo(ta.Outputs[i].AddrDesc)
+		if err == bchain.ErrNotSupported {
+			return
+		}
+		if err == nil && m != nil && len(m.PaymentID) > 0 {
+			paymentIDs[string(m.PaymentID)] = struct{}{}
+		}
+	}
+}
+
+// deletePaymentIDs deletes the transactions with the payment ids in the blocks lower..higher
+func (d *RocksDB) deletePaymentIDs(wb *gorocksdb.WriteBatch, paymentIDs map[string]struct{}, lower uint32, higher uint32) {
+	for id := range paymentIDs {
+		d.deleteHeightRange(wb, cfPaymentIDs, packString(id, nil), lower, higher)
+	}
+}
+
+// GetPaymentIDTxs returns at most limit transactions with the outputs carrying the payment id ordered by height and txid,
+// starting by the transaction fromTxid in the block fromHeight (by the first transaction of the block if fromTxid is empty)
+func (d *RocksDB) GetPaymentIDTxs(paymentID []byte, fromHeight uint32, fromTxid string, limit int) (r []PaymentIDTx, err error) {
+	defer func(s time.Time) { d.observeMethod("GetPaymentIDTxs", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	r = []PaymentIDTx{}
+	prefix := packString(string(paymentID), nil)
+	var btxID []byte
+	if fromTxid != "" {
+		if btxID, err = d.chainParser.PackTxid(fromTxid); err != nil {
+			return nil, err
+		}
+	}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfPaymentIDs])
+	defer it.Close()
+	for it.Seek(packPaymentIDKey(paymentID, fromHeight, btxID)); it.Valid() && len(r) < limit; it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		var p PaymentIDTx
+		if err = d.unpackPaymentIDKey(key, &p); err != nil {
+			return nil, errors.Annotatef(err, "payment id %x", key)
+		}
+		if p.Vouts, err = unpackPaymentIDVouts(it.Value().Data()); err != nil {
+			return nil, errors.Annotatef(err, "payment id %x", key)
+		}
+		r = append(r, p)
+	}
+	return r, nil
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	// migrateCatchUpRounds limits the number of the rounds copying the writes made during the migration before the db is paused
+	migrateCatchUpRounds = 10
+	// migrateCatchUpBatches is the number of the copied batches under which the db is paused and the rest of the writes is copied
+	migrateCatchUpBatches = 100
+)
+
+// copyUpdates writes the batches from the WAL of the db src starting at the sequence next to the db dst,
+// returns the sequence following the last copied batch and the number of copied batches
+func copyUpdates(src, dst *gorocksdb.DB, wo *gorocksdb.WriteOptions, next uint64) (uint64, int, error) {
+	if src.GetLatestSequenceNumber() < next {
+		return next, 0, nil
+	}
+	it, err := src.GetUpdatesSince(next)
+	if err != nil {
+		return next, 0, errors.Annotatef(err, "GetUpdatesSince %v", next)
+	}
+	defer it.Destroy()
+	batches := 0
+	for ; it.Valid(); it.Next() {
+		wb, seq := it.GetBatch()
+		count := uint64(wb.Count())
+		if seq+count <= next {
+			wb.Destroy()
+			continue
+		}
+		if seq > next {
+			wb.Destroy()
+			return next, batches, errors.Errorf("WAL from sequence %v to %v is not available", next, seq)
+		}
+		err = dst.Write(wo, wb)
+		wb.Destroy()
+		if err != nil {
+			return next, batches, errors.Annotatef(err, "sequence %v", seq)
+		}
+		next = seq + count
+		batches++
+	}
+	return next, batches, it.Err()
+}
+
+// MigrateTo moves the live db to the directory path (typically on a bigger volume), which must not exist.
+// The checkpoint of the db is created in path - the table files are hard linked if path is on the same filesystem, otherwise copied -
+// and the writes made in the meantime are copied from the WAL of the db. Then the function pause is called, it must stop all access
+// to the db and return the function resuming it. The rest of the writes is copied, the handle is switched to the db in path
+// and the access is resumed. The original db is left in place, it can be removed after blockbook is restarted with the new path.
+// If the migration fails, the db is not changed and path is removed.
+func (d *RocksDB) MigrateTo(path string, pause func() (func(), error)) error {
+	if d.readOnly {
+		return errors.New("Read only db cannot be migrated")
+	}
+	if filepath.Clean(path) == filepath.Clean(d.path) {
+		return errors.New("The db is already in the directory")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return errors.Errorf("%v already exists", path)
+	}
+	start := time.Now()
+	old := d.db
+	// the WAL files must not be deleted until the writes made during the migration are copied
+	if err := old.DisableFileDeletions(); err != nil {
+		return err
+	}
+	deletionsEnabled := false
+	defer func() {
+		if !deletionsEnabled {
+			if err := old.EnableFileDeletions(false); err != nil {
+				glog.Error("rocksdb: migration: ", err)
+			}
+		}
+	}()
+	next := old.GetLatestSequenceNumber()
+	cp, err := old.NewCheckpoint()
+	if err != nil {
+		return err
+	}
+	err = cp.CreateCheckpoint(path, 0)
+	cp.Destroy()
+	if err != nil {
+		os.RemoveAll(path)
+		return errors.Annotatef(err, "checkpoint")
+	}
+	glog.Infof("rocksdb: migration to %v, checkpoint at sequence %v created in %v", path, next, time.Since(start))
+	ndb, ncfh, _, err := openDB(path, d.cache, d.maxOpenFiles, false)
+	if err != nil {
+		os.RemoveAll(path)
+		return err
+	}
+	abort := func(err error) error {
+		for _, h := range ncfh {
+			h.Destroy()
+		}
+		ndb.Close()
+		os.RemoveAll(path)
+		return err
+	}
+	for i := 0; i < migrateCatchUpRounds; i++ {
+		var batches int
+		if next, batches, err = copyUpdates(old, ndb, d.wo, next); err != nil {
+			return abort(err)
+		}
+		glog.Infof("rocksdb: migration to %v, copied %v batches, sequence %v", path, batches, next)
+		if batches < migrateCatchUpBatches {
+			break
+		}
+	}
+	resume, err := pause()
+	if err != nil {
+		return abort(errors.Annotatef(err, "pause"))
+	}
+	defer resume()
+	d.stopMultisigScan()
+	defer d.startMultisigScan()
+	// the handle is closed also for the callers not stopped by pause, no write can be made during the final copy
+	d.closeHandle()
+	defer d.openHandle()
+	paused := time.Now()
+	if next, _, err = copyUpdates(old, ndb, d.wo, next); err != nil {
+		return abort(err)
+	}
+	d.stopWarmup()
+	d.stopCompaction()
+	d.releaseAllReadSnapshots()
+	if err = old.EnableFileDeletions(false); err != nil {
+		glog.Error("rocksdb: migration: ", err)
+	}
+	deletionsEnabled = true
+	d.closeDB()
+	oldPath := d.path
+	d.db, d.cfh, d.path = ndb, ncfh, path
+	d.invalidateBestBlock()
+	d.startWarmup()
+	d.startCompaction()
+	glog.Infof("rocksdb: migrated from %v to %v at sequence %v in %v, paused for %v, the original db can be removed after restart with the new path",
+		oldPath, path, next, time.Since(start), time.Since(paused))
+	return nil
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+)
+
+// ReorgEvent is a reorganization of the chain handled by the index, the blocks above ForkHeight
+// up to OldTipHeight were disconnected and the index was synchronized to the new tip
+// Detected and Resolved are the unix times of the detection of the fork and of the end of the following resync
+type ReorgEvent struct {
+	OldTipHeight uint32 `json:"oldTipHeight"`
+	OldTipHash   string `json:"oldTipHash"`
+	NewTipHeight uint32 `json:"newTipHeight"`
+	NewTipHash   string `json:"newTipHash"`
+	ForkHeight   uint32 `json:"forkHeight"`
+	Depth        uint32 `json:"depth"`
+	Detected     int64  `json:"detected"`
+	Resolved     int64  `json:"resolved"`
+}
+
+// packReorgKey packs the key of the reorg event, the events are ordered by the time of detection
+func packReorgKey(detectedNano int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(detectedNano))
+	return buf
+}
+
+func (d *RocksDB) packReorgEvent(e *ReorgEvent) ([]byte, error) {
+	varBuf := make([]byte, vlq.MaxLen64)
+	buf := make([]byte, 0, 96)
+	for _, h := range []string{e.OldTipHash, e.NewTipHash} {
+		// the hash of the new tip is empty if the index was left empty
+		if h == "" {
+			buf = append(buf, make([]byte, d.chainParser.PackedTxidLen())...)
+			continue
+		}
+		b, err := d.chainParser.PackBlockHash(h)
+		if err != nil {
+			return nil, errors.Annotatef(err, "block hash %v", h)
+		}
+		buf = append(buf, b...)
+	}
+	for _, v := range []uint{uint(e.OldTipHeight), uint(e.NewTipHeight), uint(e.ForkHeight), uint(e.Detected), uint(e.Resolved)} {
+		l := packVaruint(v, varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf, nil
+}
+
+func (d *RocksDB) unpackReorgEvent(buf []byte) (*ReorgEvent, error) {
+	pl := d.chainParser.PackedTxidLen()
+	if len(buf) < 2*pl+5 {
+		return nil, errors.New("Invalid packed reorg event")
+	}
+	var e ReorgEvent
+	var err error
+	if e.OldTipHash, err = d.chainParser.UnpackBlockHash(buf[:pl]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(buf[pl:2*pl], make([]byte, pl)) {
+		if e.NewTipHash, err = d.chainParser.UnpackBlockHash(buf[pl : 2*pl]); err != nil {
+			return nil, err
+		}
+	}
+	buf = buf[2*pl:]
+	var v [5]uint
+	for i := range v {
+		var l int
+		if v[i], l = unpackVaruint(buf); l <= 0 {
+			return nil, errors.New("Invalid packed reorg event")
+		}
+		buf = buf[l:]
+	}
+	e.OldTipHeight = uint32(v[0])
+	e.NewTipHeight = uint32(v[1])
+	e.ForkHeight = uint32(v[2])
+	e.Detected = int64(v[3])
+	e.Resolved = int64(v[4])
+	e.Depth = e.OldTipHeight - e.ForkHeight
+	return &e, nil
+}
+
+// StoreReorgEvent stores the record of the handled reorganization of the chain, detectedNano orders the records
+func (d *RocksDB) StoreReorgEvent(e *ReorgEvent, detectedNano int64) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	buf, err := d.packReorgEvent(e)
+	if err != nil {
+		return err
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfReorgs], packReorgKey(detectedNano), buf)
+}
+
+// GetReorgHistory returns at most limit of the latest reorganizations of the chain, the latest first
+func (d *RocksDB) GetReorgHistory(limit int) ([]ReorgEvent, error) {
+	if err := d.enterHandle(); err != nil {
+		return nil, err
+	}
+	defer d.releaseHandle()
+	r := []ReorgEvent{}
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfReorgs])
+	defer it.Close()
+	for it.SeekToLast(); it.Valid() && len(r) < limit; it.Prev() {
+		e, err := d.unpackReorgEvent(it.Value().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "reorg event %x", it.Key().Data())
+		}
+		r = append(r, *e)
+	}
+	return r, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"time"
+
+	"github.com/tecbot/gorocksdb"
+)
+
+// computeRewards returns map of packed txids of the coinbase transactions in block to the reward types of their outputs
+// only the transactions classified by the parser are returned, nil if the parser does not classify the rewards
+func (d *RocksDB) computeRewards(block *bchain.Block) map[string][]byte {
+	var r map[string][]byte
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		rt, err := d.chainParser.GetTxRewardTypes(tx, block.Height)
+		if err == bchain.ErrNotSupported {
+			return nil
+		}
+		if err != nil || rt == nil {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		buf := make([]byte, len(rt))
+		for j, t := range rt {
+			buf[j] = byte(t)
+		}
+		if r == nil {
+			r = make(map[string][]byte)
+		}
+		r[string(btxID)] = buf
+	}
+	return r
+}
+
+func (d *RocksDB) storeRewards(wb *gorocksdb.WriteBatch, rewards map[string][]byte) error {
+	for btxID, buf := range rewards {
+		wb.PutCF(d.cfh[cfRewards], []byte(btxID), buf)
+	}
+	return nil
+}
+
+// GetTxRewardTypes returns the reward types of the outputs of a coinbase transaction
+// returns nil if the transaction was not classified
+func (d *RocksDB) GetTxRewardTypes(txid string) (types []bchain.RewardType, err error) {
+	defer func(s time.Time) { d.observeMethod("GetTxRewardTypes", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfRewards], btxID)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	r := make([]bchain.RewardType, len(buf))
+	for i, b := range buf {
+		r[i] = bchain.RewardType(b)
+	}
+	return r, nil
+}
@@ -10,6 +10,7 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/bsm/go-vlq"
@@ -22,7 +23,7 @@ import (
 // when doing huge scan, it is better to close it and reopen from time to time to free the resources
 const refreshIterator = 5000000
 const packedHeightBytes = 4
-const dbVersion = 3
+const dbVersion = 4
 const maxAddrDescLen = 1024
 
 // RepairRocksDB calls RocksDb db repair function
@@ -32,26 +33,95 @@ func RepairRocksDB(name string) error {
 	return gorocksdb.RepairDb(name, opts)
 }
 
+// connectBlockStats are the cumulative numbers of the hits and misses of the lookups during the connect of blocks
 type connectBlockStats struct {
-	txAddressesHit  int
-	txAddressesMiss int
-	balancesHit     int
-	balancesMiss    int
+	txAddressesHit      int
+	txAddressesCacheHit int
+	txAddressesMiss     int
+	balancesHit         int
+	balancesMiss        int
 }
 
 // RocksDB handle
+//
+// The exported methods reading or writing the db are safe for concurrent use, they enter the gate of the handle
+// and fail with an error when the db is being closed, reopened or migrated to another directory.
+// The configuration methods (the Set* methods not returning an error, LoadInternalState) must be called before the handle
+// is used concurrently. ConnectBlock, DisconnectBlock*, the bulk connect and the sync must be run from a single goroutine,
+// which also owns the connect block stats.
 type RocksDB struct {
-	path         string
-	db           *gorocksdb.DB
-	wo           *gorocksdb.WriteOptions
-	ro           *gorocksdb.ReadOptions
-	cfh          []*gorocksdb.ColumnFamilyHandle
-	chainParser  bchain.BlockChainParser
-	is           *common.InternalState
-	metrics      *common.Metrics
-	cache        *gorocksdb.Cache
-	maxOpenFiles int
-	cbs          connectBlockStats
+	path            string
+	db              *gorocksdb.DB
+	wo              *gorocksdb.WriteOptions
+	ro              *gorocksdb.ReadOptions
+	cfh             []*gorocksdb.ColumnFamilyHandle
+	chainParser     bchain.BlockChainParser
+	is              *common.InternalState
+	metrics         *common.Metrics
+	cache           *blockCaches
+	maxOpenFiles    int
+	cbs             connectBlockStats
+	cbsReported     connectBlockStats
+	cbsWindow       connectBlockStatsWindow
+	cbsWindowSize   int
+	trace           traceFilter
+	dust            *DustFilter
+	coinjoin        *CoinjoinFilter
+	silentPayments  []*SilentPaymentsWallet
+	snapshots       readSnapshots
+	scriptTemplates map[string]struct{}
+	indexFilter     *IndexFilter
+	watched         watchedOutpoints
+	watchedAddrs    watchedAddresses
+	multisig        multisigWallets
+	ordinals        bool
+	paymentIDs      bool
+	burns           bool
+	burnAddresses   map[string]struct{}
+	readOnly        bool
+	best            bestBlockCache
+	warmup          cacheWarmup
+	compaction      compactor
+	// handle guards d.db and d.cfh against the switch by Reopen, MigrateTo and Close
+	handle *handleGate
+	// addedColumns are the columns created in the existing db when it was opened
+	addedColumns []string
+	// missingColumns are the columns not existing in the db opened read only, they have no handle
+	missingColumns []string
+	// dataVersion is the version of the data of an older db opened read only, which is read in its own format,
+	// 0 is the current version
+	dataVersion uint32
+	// txAddressesCache is nil if the cache is disabled
+	txAddressesCache *txAddressesCache
+	// txStore is the shared store of the tx cache, nil if the tx cache is in the transactions column
+	txStore TxCacheStore
+	// txDeletes queues the transactions removed from the shared store in background
+	txDeletes chan []byte
+	// anomalies are the triggered guards of the amount math not yet stored
+	anomalies amountAnomalies
+	// txRepair fetches the transactions missing in txAddresses, nil if the read-repair is disabled
+	txRepair TxFetchFunc
+	// indexDeltaBlocks is the number of the last blocks, for which the write sets are kept in the indexDelta column
+	indexDeltaBlocks uint32
+	// feeStats is true if the fee stats of the blocks and the mempool snapshots are stored in the fees column
+	feeStats bool
+	// largestTxs is true if the largest transactions of the last blocks are kept in the largestTxs column
+	largestTxs bool
+	// holdingStats is true if the holding stats of the addresses are computed
+	holdingStats bool
+	// blockSupply is true if the supply changes of the blocks are recorded in the blockSupply column
+	blockSupply bool
+	// lastSupply is the supply change of the last recorded block, the base of the totals of the next block,
+	// nil if it must be read from the db
+	lastSupply *BlockSupply
+	// counterparties is true if the sketches of the counterparties of the addresses are updated
+	counterparties bool
+	// indexHash is true if the rolling hashes of the writes of the connected blocks are kept in the indexHash column
+	indexHash bool
+	// methodSignatures are the signatures of the contract methods loaded from the file, keyed by the selector
+	methodSignatures map[string][]string
+	// methodSignaturesMux serializes the updates of the methodSignatures column
+	methodSignaturesMux sync.Mutex
 }
 
 const (
@@ -62,42 +132,273 @@ const (
 	cfAddressBalance
 	cfBlockTxs
 	cfTransactions
+	cfFees
+	cfDustTxs
+	cfScriptTemplates
+	cfWatchedOutpoints
+	cfRewards
+	cfHeightAddresses
+	cfScriptAnnotations
+	cfArchive
+	cfWatchedAddresses
+	cfErc20Contracts
+	cfReorgs
+	cfCoinControl
+	cfBlockSupply
+	cfSilentPayments
+	cfNameOps
+	cfAddressContracts
+	cfCoinjoinTxs
+	cfMultisigWallets
+	cfMultisigEvents
+	cfInscriptions
+	cfInscriptionOutputs
+	cfPaymentIDs
+	cfBlockBurns
+	cfBurnTotals
+	cfAmountAnomalies
+	cfWithdrawals
+	cfIndexDelta
+	cfHoldingStats
+	cfLargestTxs
+	cfWalletAccounts
+	cfIndexHash
+	cfMethodSignatures
+	cfInscriptionAddresses
 )
 
-var cfNames = []string{"default", "height", "addresses", "txAddresses", "addressBalance", "blockTxs", "transactions"}
+var cfNames = []string{"default", "height", "addresses", "txAddresses", "addressBalance", "blockTxs", "transactions", "fees", "dustTxs", "scriptTemplates", "watchedOutpoints", "rewards", "heightAddresses", "scriptAnnotations", "archive", "watchedAddresses", "erc20Contracts", "reorgs", "coinControl", "blockSupply", "silentPayments", "nameOps", "addressContracts", "coinjoinTxs", "multisigWallets", "multisigEvents", "inscriptions", "inscriptionOutputs", "paymentIds", "blockBurns", "burnTotals", "amountAnomalies", "withdrawals", "indexDelta", "holdingStats", "largestTxs", "walletAccounts", "indexHash", "methodSignatures", "inscriptionAddresses"}
 
-func openDB(path string, c *gorocksdb.Cache, openFiles int) (*gorocksdb.DB, []*gorocksdb.ColumnFamilyHandle, error) {
+// openDB opens the db with all columns, the columns missing in an existing db are created (unless the db is opened read only)
+// and their names are returned, so that the internal state can record that they do not contain the data of the older blocks
+func openDB(path string, c *blockCaches, openFiles int, readOnly bool) (*gorocksdb.DB, []*gorocksdb.ColumnFamilyHandle, []string, error) {
 	// opts with bloom filter
-	opts := createAndSetDBOptions(10, c, openFiles)
+	opts := createAndSetDBOptions(10, c.shared, openFiles)
 	// opts for addresses without bloom filter
 	// from documentation: if most of your queries are executed using iterators, you shouldn't set bloom filter
-	optsAddresses := createAndSetDBOptions(0, c, openFiles)
-	// default, height, addresses, txAddresses, addressBalance, blockTxids, transactions
-	fcOptions := []*gorocksdb.Options{opts, opts, optsAddresses, opts, opts, opts, opts}
-	db, cfh, err := gorocksdb.OpenDbColumnFamilies(opts, path, cfNames, fcOptions)
+	optsAddresses := createAndSetDBOptions(0, c.shared, openFiles)
+	// default, height, addresses, txAddresses, addressBalance, blockTxids, transactions, fees, dustTxs, scriptTemplates, watchedOutpoints, rewards, heightAddresses, scriptAnnotations, archive, watchedAddresses, erc20Contracts, reorgs, coinControl, blockSupply, silentPayments, nameOps, addressContracts, coinjoinTxs, multisigWallets, multisigEvents, inscriptions, inscriptionOutputs, paymentIds, blockBurns, burnTotals, amountAnomalies, withdrawals, indexDelta, holdingStats, largestTxs, walletAccounts, indexHash, methodSignatures, inscriptionAddresses
+	fcOptions := []*gorocksdb.Options{opts, opts, optsAddresses, opts, opts, opts, opts, opts, opts, optsAddresses, opts, opts, optsAddresses, opts, opts, opts, opts, opts, optsAddresses, optsAddresses, optsAddresses, optsAddresses, opts, opts, opts, opts, opts, opts, opts, opts, optsAddresses, opts, optsAddresses, opts, opts, opts, opts, opts, opts, optsAddresses}
+	// the columns with own cache get the same options with their cache
+	for i := range fcOptions {
+		if c.columns[i] != nil {
+			bloomBits := 10
+			if fcOptions[i] == optsAddresses {
+				bloomBits = 0
+			}
+			fcOptions[i] = createAndSetDBOptions(bloomBits, c.columns[i], openFiles)
+		}
+	}
+	var db *gorocksdb.DB
+	var cfh []*gorocksdb.ColumnFamilyHandle
+	var err error
+	existing, err := gorocksdb.ListColumnFamilies(opts, path)
+	if readOnly {
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return openDBReadOnly(opts, path, existing, fcOptions)
+	}
+	if err != nil {
+		// the db does not exist yet, it is created with all columns
+		db, cfh, err = gorocksdb.OpenDbColumnFamilies(opts, path, cfNames, fcOptions)
+		return db, cfh, nil, err
+	}
+	// open the existing columns, all of them must be opened, even those unknown to this version
+	index := make(map[string]int, len(cfNames))
+	for i, n := range cfNames {
+		index[n] = i
+	}
+	found := make([]bool, len(cfNames))
+	var names []string
+	var namesOptions []*gorocksdb.Options
+	for _, n := range existing {
+		if i, ok := index[n]; ok {
+			found[i] = true
+			namesOptions = append(namesOptions, fcOptions[i])
+		} else {
+			namesOptions = append(namesOptions, opts)
+		}
+		names = append(names, n)
+	}
+	db, h, err := gorocksdb.OpenDbColumnFamilies(opts, path, names, namesOptions)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	return db, cfh, nil
+	cfh = make([]*gorocksdb.ColumnFamilyHandle, len(cfNames))
+	for j, n := range names {
+		if i, ok := index[n]; ok {
+			cfh[i] = h[j]
+		} else {
+			h[j].Destroy()
+		}
+	}
+	var created []string
+	for i, n := range cfNames {
+		if found[i] {
+			continue
+		}
+		if cfh[i], err = db.CreateColumnFamily(fcOptions[i], n); err != nil {
+			for _, h := range cfh {
+				if h != nil {
+					h.Destroy()
+				}
+			}
+			db.Close()
+			return nil, nil, nil, errors.Annotatef(err, "CreateColumnFamily %v", n)
+		}
+		glog.Info("rocksdb: created column ", n)
+		created = append(created, n)
+	}
+	return db, cfh, created, nil
+}
+
+// openDBReadOnly opens only the existing known columns of the db, the handles of the columns missing in an older db are nil
+// and the names of these columns are returned
+func openDBReadOnly(opts *gorocksdb.Options, path string, existing []string, fcOptions []*gorocksdb.Options) (*gorocksdb.DB, []*gorocksdb.ColumnFamilyHandle, []string, error) {
+	found := make(map[string]bool, len(existing))
+	for _, n := range existing {
+		found[n] = true
+	}
+	var names, missing []string
+	var namesOptions []*gorocksdb.Options
+	var indexes []int
+	for i, n := range cfNames {
+		if !found[n] {
+			missing = append(missing, n)
+			continue
+		}
+		names = append(names, n)
+		namesOptions = append(namesOptions, fcOptions[i])
+		indexes = append(indexes, i)
+	}
+	db, h, err := gorocksdb.OpenDbForReadOnlyColumnFamilies(opts, path, names, namesOptions, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cfh := make([]*gorocksdb.ColumnFamilyHandle, len(cfNames))
+	for j, i := range indexes {
+		cfh[i] = h[j]
+	}
+	if len(missing) > 0 {
+		glog.Info("rocksdb: columns ", missing, " do not exist in the db opened read only")
+	}
+	return db, cfh, missing, nil
 }
 
 // NewRocksDB opens an internal handle to RocksDB environment.  Close
 // needs to be called to release it.
 func NewRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser, metrics *common.Metrics) (d *RocksDB, err error) {
 	glog.Infof("rocksdb: opening %s, required data version %v, cache size %v, max open files %v", path, dbVersion, cacheSize, maxOpenFiles)
-	c := gorocksdb.NewLRUCache(cacheSize)
-	db, cfh, err := openDB(path, c, maxOpenFiles)
+	d, err = newRocksDB(path, cacheSize, maxOpenFiles, parser, metrics, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.loadWatchedOutpoints(); err != nil {
+		return nil, err
+	}
+	if err = d.loadWatchedAddresses(); err != nil {
+		return nil, err
+	}
+	if err = d.loadMultisigWallets(); err != nil {
+		return nil, err
+	}
+	d.startMultisigScan()
+	return d, nil
+}
+
+// NewRocksDBReadOnly opens the db in read only mode, it can be used to inspect the db while it is used by a running blockbook.
+// The returned handle must not be used to connect or disconnect blocks.
+// The db of an older version, which can be migrated to the current version, is read in the format of its version.
+func NewRocksDBReadOnly(path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser) (d *RocksDB, err error) {
+	glog.Infof("rocksdb: opening %s read only, cache size %v, max open files %v", path, cacheSize, maxOpenFiles)
+	if d, err = newRocksDB(path, cacheSize, maxOpenFiles, parser, nil, true); err != nil {
+		return nil, err
+	}
+	if err = d.loadDataVersion(); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// loadDataVersion sets the version of the data from the lowest version of the columns in the stored internal state
+func (d *RocksDB) loadDataVersion() error {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfDefault], []byte(internalStateKey))
+	if err != nil {
+		return err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil
+	}
+	is, err := common.UnpackInternalState(val.Data())
+	if err != nil {
+		return err
+	}
+	version := uint32(dbVersion)
+	for i := range is.DbColumns {
+		if v := is.DbColumns[i].Version; v != 0 && v < version {
+			version = v
+		}
+	}
+	if version == dbVersion {
+		return nil
+	}
+	if !canMigrate(version) {
+		return errors.Errorf("DB version %v cannot be read by the required version %v", version, dbVersion)
+	}
+	glog.Info("rocksdb: ", d.path, " has data version ", version, ", it is read in the format of its version")
+	d.dataVersion = version
+	return nil
+}
+
+// DataVersion returns the version of the data of the db
+func (d *RocksDB) DataVersion() uint32 {
+	if d.dataVersion != 0 {
+		return d.dataVersion
+	}
+	return dbVersion
+}
+
+func newRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockChainParser, metrics *common.Metrics, readOnly bool) (*RocksDB, error) {
+	c := newBlockCaches(cacheSize)
+	db, cfh, columns, err := openDB(path, c, maxOpenFiles, readOnly)
 	if err != nil {
 		return nil, err
 	}
+	// the db opened read only returns the missing columns, otherwise the created columns
+	var addedColumns, missingColumns []string
+	if readOnly {
+		missingColumns = columns
+	} else {
+		addedColumns = columns
+	}
 	wo := gorocksdb.NewDefaultWriteOptions()
 	ro := gorocksdb.NewDefaultReadOptions()
-	return &RocksDB{path, db, wo, ro, cfh, parser, nil, metrics, c, maxOpenFiles, connectBlockStats{}}, nil
+	return &RocksDB{
+		path:           path,
+		db:             db,
+		wo:             wo,
+		ro:             ro,
+		cfh:            cfh,
+		chainParser:    parser,
+		metrics:        metrics,
+		cache:          c,
+		maxOpenFiles:   maxOpenFiles,
+		readOnly:       readOnly,
+		addedColumns:   addedColumns,
+		missingColumns: missingColumns,
+		handle:         newHandleGate(),
+	}, nil
 }
 
 func (d *RocksDB) closeDB() error {
 	for _, h := range d.cfh {
-		h.Destroy()
+		// the columns missing in the db opened read only have no handle
+		if h != nil {
+			h.Destroy()
+		}
 	}
 	d.db.Close()
 	d.db = nil
@@ -107,14 +408,21 @@ func (d *RocksDB) closeDB() error {
 // Close releases the RocksDB environment opened in NewRocksDB.
 func (d *RocksDB) Close() error {
 	if d.db != nil {
+		// the background workers must be stopped before the state is stored as closed
+		d.stopWarmup()
+		d.stopCompaction()
+		d.stopMultisigScan()
 		// store the internal state of the app
-		if d.is != nil && d.is.DbState == common.DbStateOpen {
-			d.is.DbState = common.DbStateClosed
+		if d.is != nil && d.is.GetDbState() == common.DbStateOpen && !d.readOnly {
+			d.is.SetDbState(common.DbStateClosed)
 			if err := d.StoreInternalState(d.is); err != nil {
 				glog.Info("internalState: ", err)
 			}
 		}
+		// the calls in progress must finish before the handle is destroyed, the new calls fail
+		d.closeHandle()
 		glog.Infof("rocksdb: close")
+		d.releaseAllReadSnapshots()
 		d.closeDB()
 		d.wo.Destroy()
 		d.ro.Destroy()
@@ -123,33 +431,54 @@ func (d *RocksDB) Close() error {
 }
 
 // Reopen reopens the database
-// It closes and reopens db, nobody can access the database during the operation!
+// It closes and reopens db, the calls in progress are waited for and the calls made during the operation fail
 func (d *RocksDB) Reopen() error {
+	d.stopMultisigScan()
+	defer d.startMultisigScan()
+	d.closeHandle()
+	defer d.openHandle()
+	d.stopWarmup()
+	d.stopCompaction()
+	d.releaseAllReadSnapshots()
 	err := d.closeDB()
 	if err != nil {
 		return err
 	}
 	d.db = nil
-	db, cfh, err := openDB(d.path, d.cache, d.maxOpenFiles)
+	db, cfh, _, err := openDB(d.path, d.cache, d.maxOpenFiles, d.readOnly)
 	if err != nil {
 		return err
 	}
 	d.db, d.cfh = db, cfh
+	d.invalidateBestBlock()
+	d.startWarmup()
+	d.startCompaction()
 	return nil
 }
 
 func (d *RocksDB) GetMemoryStats() string {
+	if err := d.enterHandle(); err != nil {
+		return ""
+	}
+	defer d.releaseHandle()
 	type columnStats struct {
 		name           string
 		indexAndFilter string
 		memtable       string
+		// ownCacheUsage is the usage of the own cache of the column, -1 if the column uses the shared cache
+		ownCacheUsage int
 	}
 	cs := make([]columnStats, len(cfNames))
 	for i := 0; i < len(cfNames); i++ {
 		cs[i].name = cfNames[i]
 		cs[i].indexAndFilter = d.db.GetPropertyCF("rocksdb.estimate-table-readers-mem", d.cfh[i])
 		cs[i].memtable = d.db.GetPropertyCF("rocksdb.cur-size-all-mem-tables", d.cfh[i])
+		cs[i].ownCacheUsage = -1
+		if c := d.cache.columns[i]; c != nil {
+			cs[i].ownCacheUsage = c.GetUsage()
+		}
 	}
+	cacheUsage, pinnedCacheUsage := d.cache.usage()
 	m := struct {
 		cacheUsage       int
 		pinnedCacheUsage int
@@ -157,8 +486,8 @@ func (d *RocksDB) GetMemoryStats() string {
 		memtable         string
 		columns          []columnStats
 	}{
-		cacheUsage:       d.cache.GetUsage(),
-		pinnedCacheUsage: d.cache.GetPinnedUsage(),
+		cacheUsage:       cacheUsage,
+		pinnedCacheUsage: pinnedCacheUsage,
 		indexAndFilter:   d.db.GetProperty("rocksdb.estimate-table-readers-mem"),
 		memtable:         d.db.GetProperty("rocksdb.cur-size-all-mem-tables"),
 		columns:          cs,
@@ -189,6 +518,11 @@ func (d *RocksDB) GetTransactions(address string, lower uint32, higher uint32, f
 // GetAddrDescTransactions finds all input/output transactions for address descriptor
 // Transaction are passed to callback function.
 func (d *RocksDB) GetAddrDescTransactions(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn func(txid string, vout uint32, isOutput bool) error) (err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescTransactions", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	kstart := packAddressKey(addrDesc, lower)
 	kstop := packAddressKey(addrDesc, higher)
 
@@ -201,12 +535,14 @@ func (d *RocksDB) GetAddrDescTransactions(addrDesc bchain.AddressDescriptor, low
 		if bytes.Compare(key, kstop) > 0 {
 			break
 		}
-		outpoints, err := d.unpackOutpoints(val)
+		outpoints, err := d.unpackAddressOutpoints(val)
 		if err != nil {
 			return err
 		}
 		if glog.V(2) {
 			glog.Infof("rocksdb: output %s: %s", hex.EncodeToString(key), hex.EncodeToString(val))
+		} else if _, h, err := unpackAddressKey(key); err == nil && d.traced(addrDesc, h) {
+			glog.Infof("rocksdb: trace output %s: %s", hex.EncodeToString(key), hex.EncodeToString(val))
 		}
 		for _, o := range outpoints {
 			var vout uint32
@@ -233,24 +569,203 @@ func (d *RocksDB) GetAddrDescTransactions(addrDesc bchain.AddressDescriptor, low
 	return nil
 }
 
+// GetAddrDescHeightTransactions finds the transactions of address descriptor in the blocks from lower to higher,
+// the unique txids of each block are passed to callback function at once in ascending order of the heights
+func (d *RocksDB) GetAddrDescHeightTransactions(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn func(height uint32, txids []string) error) (err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescHeightTransactions", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	kstart := packAddressKey(addrDesc, lower)
+	kstop := packAddressKey(addrDesc, higher)
+
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		height, txids, err := d.unpackAddressHeightTxids(key, it.Value().Data())
+		if err != nil {
+			return err
+		}
+		if err := fn(height, txids); err != nil {
+			if _, ok := err.(*StopIteration); ok {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAddrDescHeightTransactionsReverse is GetAddrDescHeightTransactions passing the blocks in descending order of the heights,
+// it allows reading the newest part of the history of an address without reading the whole history
+func (d *RocksDB) GetAddrDescHeightTransactionsReverse(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn func(height uint32, txids []string) error) (err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescHeightTransactionsReverse", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	kstart := packAddressKey(addrDesc, lower)
+	kstop := packAddressKey(addrDesc, higher)
+
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+
+	for seekLastNotGreater(it, kstop); it.Valid(); it.Prev() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstart) < 0 {
+			break
+		}
+		if len(key) != len(kstop) {
+			continue
+		}
+		height, txids, err := d.unpackAddressHeightTxids(key, it.Value().Data())
+		if err != nil {
+			return err
+		}
+		if err := fn(height, txids); err != nil {
+			if _, ok := err.(*StopIteration); ok {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAddrDescTransactionsReverse is GetAddrDescTransactions passing the transactions from the newest,
+// the blocks in descending order of the heights and the outpoints of a block in the reverse order
+func (d *RocksDB) GetAddrDescTransactionsReverse(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn func(txid string, vout uint32, isOutput bool) error) (err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescTransactionsReverse", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	kstart := packAddressKey(addrDesc, lower)
+	kstop := packAddressKey(addrDesc, higher)
+
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+
+	for seekLastNotGreater(it, kstop); it.Valid(); it.Prev() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstart) < 0 {
+			break
+		}
+		if len(key) != len(kstop) {
+			continue
+		}
+		outpoints, err := d.unpackAddressOutpoints(it.Value().Data())
+		if err != nil {
+			return err
+		}
+		for i := len(outpoints) - 1; i >= 0; i-- {
+			o := &outpoints[i]
+			vout, isOutput := uint32(o.index), true
+			if o.index < 0 {
+				vout, isOutput = uint32(^o.index), false
+			}
+			tx, err := d.chainParser.UnpackTxid(o.btxID)
+			if err != nil {
+				return err
+			}
+			if err := fn(tx, vout, isOutput); err != nil {
+				if _, ok := err.(*StopIteration); ok {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// seekLastNotGreater positions the iterator to the last key not greater than key
+func seekLastNotGreater(it *gorocksdb.Iterator, key []byte) {
+	it.Seek(key)
+	if !it.Valid() {
+		it.SeekToLast()
+	} else if bytes.Compare(it.Key().Data(), key) > 0 {
+		it.Prev()
+	}
+}
+
+// unpackAddressHeightTxids returns the height and the unique txids of the record of the addresses column
+func (d *RocksDB) unpackAddressHeightTxids(key, val []byte) (uint32, []string, error) {
+	_, height, err := unpackAddressKey(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	outpoints, err := d.unpackAddressOutpoints(val)
+	if err != nil {
+		return 0, nil, err
+	}
+	txids := make([]string, 0, len(outpoints))
+	seen := make(map[string]struct{}, len(outpoints))
+	for _, o := range outpoints {
+		if _, found := seen[string(o.btxID)]; found {
+			continue
+		}
+		seen[string(o.btxID)] = struct{}{}
+		txid, err := d.chainParser.UnpackTxid(o.btxID)
+		if err != nil {
+			return 0, nil, err
+		}
+		txids = append(txids, txid)
+	}
+	return height, txids, nil
+}
+
 const (
 	opInsert = 0
 	opDelete = 1
 )
 
 // ConnectBlock indexes addresses in the block and stores them in db
-func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
+func (d *RocksDB) ConnectBlock(block *bchain.Block) (err error) {
+	defer func(s time.Time) { d.observeMethod("ConnectBlock", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	return d.writeBlock(block, opInsert)
 }
 
 // DisconnectBlock removes addresses in the block from the db
-func (d *RocksDB) DisconnectBlock(block *bchain.Block) error {
+func (d *RocksDB) DisconnectBlock(block *bchain.Block) (err error) {
+	defer func(s time.Time) { d.observeMethod("DisconnectBlock", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	return d.writeBlock(block, opDelete)
 }
 
-func (d *RocksDB) writeBlock(block *bchain.Block, op int) error {
+func (d *RocksDB) writeBlock(block *bchain.Block, op int) (err error) {
 	wb := gorocksdb.NewWriteBatch()
 	defer wb.Destroy()
+	defer func() {
+		// the cached txAddresses could be modified by the block which was not written
+		if err != nil {
+			d.txAddressesCache.purge()
+			d.clearAmountAnomalies()
+			// discard the watched outpoints and addresses found in the block, which was not written
+			d.clearWatchedOutpointsSpent()
+			d.clearWatchedAddressActivity()
+		}
+	}()
+	if op == opInsert {
+		defer func(start time.Time) {
+			if err == nil {
+				d.observeConnectBlockStats(block.Height, time.Since(start))
+			}
+		}(time.Now())
+	}
 
 	if glog.V(2) {
 		switch op {
@@ -262,6 +777,12 @@ func (d *RocksDB) writeBlock(block *bchain.Block, op int) error {
 	}
 
 	isUTXO := d.chainParser.IsUTXOChain()
+	var txAddressesMap map[string]*TxAddresses
+	var supply *BlockSupply
+	if isUTXO {
+		d.anomalies.balancesMux.Lock()
+		defer d.anomalies.balancesMux.Unlock()
+	}
 
 	if err := d.writeHeightFromBlock(wb, block, op); err != nil {
 		return err
@@ -273,11 +794,13 @@ func (d *RocksDB) writeBlock(block *bchain.Block, op int) error {
 			return errors.New("DisconnectBlock is not supported for UTXO chains")
 		}
 		addresses := make(map[string][]outpoint)
-		txAddressesMap := make(map[string]*TxAddresses)
+		txAddressesMap = make(map[string]*TxAddresses)
 		balances := make(map[string]*AddrBalance)
 		if err := d.processAddressesUTXO(block, addresses, txAddressesMap, balances); err != nil {
 			return err
 		}
+		d.checkWatchedAddresses(block.Height, addresses)
+		d.checkMultisigWallets(block, addresses)
 		if err := d.storeAddresses(wb, block.Height, addresses); err != nil {
 			return err
 		}
@@ -287,16 +810,96 @@ func (d *RocksDB) writeBlock(block *bchain.Block, op int) error {
 		if err := d.storeBalances(wb, balances); err != nil {
 			return err
 		}
+		if err := d.storeAmountAnomalies(wb); err != nil {
+			return err
+		}
 		if err := d.storeAndCleanupBlockTxs(wb, block); err != nil {
 			return err
 		}
+		if err := d.storeBlockFeeStats(wb, d.computeBlockFeeStats(block, txAddressesMap)); err != nil {
+			return err
+		}
+		if d.blockSupply {
+			prevSupply, err := d.prevBlockSupply(block.Height)
+			if err != nil {
+				return err
+			}
+			supply = d.computeBlockSupply(block, txAddressesMap, prevSupply)
+			d.storeBlockSupply(wb, supply)
+		}
+		burns := d.computeBlockBurns(block, txAddressesMap)
+		d.storeBlockBurns(wb, block.Height, burns)
+		burnTotals := make(burnsUpdate)
+		if err := d.updateBurnTotals(burnTotals, burns, false); err != nil {
+			return err
+		}
+		d.storeBurnTotals(wb, burnTotals)
+		holding := make(holdingUpdate)
+		if err := d.computeHoldingTimes(holding, block, txAddressesMap, cachedBlockTimes(d.dbBlockTime)); err != nil {
+			return err
+		}
+		d.storeHoldingStats(wb, holding)
+		d.storeSilentPayments(wb, d.computeSilentPayments(block, txAddressesMap))
+		d.storeNameOps(wb, d.computeNameOps(block))
+		d.storePaymentIDs(wb, d.computePaymentIDs(block))
+		ordinals := newOrdinalsUpdate()
+		if err := d.computeOrdinals(block, txAddressesMap, ordinals); err != nil {
+			return err
+		}
+		if err := d.storeOrdinals(wb, ordinals); err != nil {
+			return err
+		}
+		if err := d.storeDustTxs(wb, d.computeDustTxs(block, txAddressesMap)); err != nil {
+			return err
+		}
+		d.storeCoinjoinTxs(wb, d.computeCoinjoinTxs(block, txAddressesMap))
+		if err := d.storeRewards(wb, d.computeRewards(block)); err != nil {
+			return err
+		}
+		if err := d.storeScriptAnnotations(wb, d.computeScriptAnnotations(block)); err != nil {
+			return err
+		}
+		if err := d.storeScriptTemplateOutpoints(wb, block.Height, d.computeScriptTemplateOutpoints(block, txAddressesMap)); err != nil {
+			return err
+		}
 	} else {
 		if err := d.writeAddressesNonUTXO(wb, block, op); err != nil {
 			return err
 		}
 	}
 
-	return d.db.Write(d.wo, wb)
+	if op == opInsert {
+		if err := d.storeLargestTxs(wb, block.Height, d.computeLargestTxs(block)); err != nil {
+			return err
+		}
+		if err := d.storeIndexHashOfBatch(wb, block.Height); err != nil {
+			return err
+		}
+		if err := d.storeIndexDelta(wb, block.Height, block.Hash, block.Prev); err != nil {
+			return err
+		}
+	} else {
+		wb.DeleteCF(d.cfh[cfLargestTxs], packUint(block.Height))
+		wb.DeleteCF(d.cfh[cfIndexDelta], packUint(block.Height))
+		wb.DeleteCF(d.cfh[cfIndexHash], packUint(block.Height))
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		d.invalidateBestBlock()
+		return err
+	}
+	if op == opInsert {
+		d.setBestBlock(block.Height, block.Hash)
+		d.txAddressesCache.add(txAddressesMap)
+		if supply != nil {
+			d.lastSupply = supply
+		}
+	} else {
+		d.invalidateBestBlock()
+	}
+	d.notifyWatchedOutpointsSpent()
+	d.notifyWatchedAddressActivity()
+	d.notifyMultisigEvents()
+	return nil
 }
 
 // Addresses index
@@ -335,6 +938,10 @@ type AddrBalance struct {
 	Txs        uint32
 	SentSat    big.Int
 	BalanceSat big.Int
+	// Nonce is the next nonce of the account, used only by account based chains
+	Nonce uint64
+	// Counterparties is the sketch of the distinct counterparties of the address, nil if it is not kept
+	Counterparties *CounterpartySketch
 }
 
 func (ab *AddrBalance) ReceivedSat() *big.Int {
@@ -348,41 +955,53 @@ type blockTxs struct {
 	inputs []outpoint
 }
 
-func (d *RocksDB) resetValueSatToZero(valueSat *big.Int, addrDesc bchain.AddressDescriptor, logText string) {
+// resetValueSatToZero resets the negative balance or sent amount of the address in the block at height and records the anomaly
+func (d *RocksDB) resetValueSatToZero(valueSat *big.Int, addrDesc bchain.AddressDescriptor, kind AmountAnomalyKind, height uint32) {
+	logText := "balance"
+	if kind == AmountAnomalyNegativeSent {
+		logText = "sent amount"
+	}
 	ad, _, err := d.chainParser.GetAddressesFromAddrDesc(addrDesc)
 	if err != nil {
-		glog.Warningf("rocksdb: unparsable address hex '%v' reached negative %s %v, resetting to 0. Parser error %v", addrDesc, logText, valueSat.String(), err)
+		glog.Warningf("rocksdb: height %d, unparsable address hex '%v' reached negative %s %v, resetting to 0. Parser error %v", height, addrDesc, logText, valueSat.String(), err)
 	} else {
-		glog.Warningf("rocksdb: address %v hex '%v' reached negative %s %v, resetting to 0", ad, addrDesc, logText, valueSat.String())
+		glog.Warningf("rocksdb: height %d, address %v hex '%v' reached negative %s %v, resetting to 0", height, ad, addrDesc, logText, valueSat.String())
 	}
+	d.recordAmountAnomaly(addrDesc, kind, height, valueSat)
 	valueSat.SetInt64(0)
 }
 
-func (d *RocksDB) GetAndResetConnectBlockStats() string {
-	s := fmt.Sprintf("%+v", d.cbs)
-	d.cbs = connectBlockStats{}
-	return s
+func (d *RocksDB) processAddressesUTXO(block *bchain.Block, addresses map[string][]outpoint, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance) error {
+	blockTxIDs, blockTxAddresses, err := d.processOutputsUTXO(block)
+	if err != nil {
+		return err
+	}
+	return d.processTxAddressesUTXO(block, blockTxIDs, blockTxAddresses, addresses, txAddressesMap, balances)
 }
 
-func (d *RocksDB) processAddressesUTXO(block *bchain.Block, addresses map[string][]outpoint, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance) error {
+// processOutputsUTXO packs the txids of the block transactions and creates their txAddresses containing only the outputs
+// it does not access the db, therefore it can be called for any block regardless of the state of the index
+func (d *RocksDB) processOutputsUTXO(block *bchain.Block) ([][]byte, []*TxAddresses, error) {
 	blockTxIDs := make([][]byte, len(block.Txs))
 	blockTxAddresses := make([]*TxAddresses, len(block.Txs))
-	// first process all outputs so that inputs can point to txs in this block
 	for txi := range block.Txs {
 		tx := &block.Txs[txi]
 		btxID, err := d.chainParser.PackTxid(tx.Txid)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		blockTxIDs[txi] = btxID
 		ta := TxAddresses{Height: block.Height}
 		ta.Outputs = make([]TxOutput, len(tx.Vout))
-		txAddressesMap[string(btxID)] = &ta
 		blockTxAddresses[txi] = &ta
 		for i, output := range tx.Vout {
 			tao := &ta.Outputs[i]
 			tao.ValueSat = output.ValueSat
 			addrDesc, err := d.chainParser.GetAddrDescFromVout(&output)
+			if bigintTruncated(&tao.ValueSat) {
+				glog.Warningf("rocksdb: height %d, tx %v, vout %v has value longer than %d bytes, it is truncated", block.Height, tx.Txid, i, maxPackedBigintBytes-1)
+				d.recordAmountAnomaly(addrDesc, AmountAnomalyTruncatedValue, block.Height, &tao.ValueSat)
+			}
 			if err != nil || len(addrDesc) == 0 || len(addrDesc) > maxAddrDescLen {
 				if err != nil {
 					// do not log ErrAddressMissing, transactions can be without to address (for example eth contracts)
@@ -395,36 +1014,22 @@ func (d *RocksDB) processAddressesUTXO(block *bchain.Block, addresses map[string
 				continue
 			}
 			tao.AddrDesc = addrDesc
-			strAddrDesc := string(addrDesc)
-			// check that the address was used already in this block
-			o, processed := addresses[strAddrDesc]
-			if processed {
-				// check that the address was already used in this tx
-				processed = processedInTx(o, btxID)
-			}
-			addresses[strAddrDesc] = append(o, outpoint{
-				btxID: btxID,
-				index: int32(i),
-			})
-			ab, e := balances[strAddrDesc]
-			if !e {
-				ab, err = d.GetAddrDescBalance(addrDesc)
-				if err != nil {
-					return err
-				}
-				if ab == nil {
-					ab = &AddrBalance{}
-				}
-				balances[strAddrDesc] = ab
-				d.cbs.balancesMiss++
-			} else {
-				d.cbs.balancesHit++
-			}
-			// add number of trx in balance only once, address can be multiple times in tx
-			if !processed {
-				ab.Txs++
-			}
-			ab.BalanceSat.Add(&ab.BalanceSat, &output.ValueSat)
+		}
+	}
+	return blockTxIDs, blockTxAddresses, nil
+}
+
+// processTxAddressesUTXO adds the outputs of the block transactions to the addresses and balances and spends the outputs referenced by their inputs
+// blockTxAddresses are the txAddresses created by processOutputsUTXO, the block must contain the txids and the inputs of the transactions
+func (d *RocksDB) processTxAddressesUTXO(block *bchain.Block, blockTxIDs [][]byte, blockTxAddresses []*TxAddresses, addresses map[string][]outpoint, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance) error {
+	// first process all outputs so that inputs can point to txs in this block
+	for txi := range block.Txs {
+		tx := &block.Txs[txi]
+		btxID := blockTxIDs[txi]
+		ta := blockTxAddresses[txi]
+		txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))] = ta
+		if err := d.addTxOutputsUTXO(tx.Txid, btxID, ta, block.Height, addresses, balances, nil); err != nil {
+			return err
 		}
 	}
 	// process inputs
@@ -447,16 +1052,25 @@ func (d *RocksDB) processAddressesUTXO(block *bchain.Block, addresses map[string
 			stxID := string(btxID)
 			ita, e := txAddressesMap[stxID]
 			if !e {
-				ita, err = d.getTxAddresses(btxID)
-				if err != nil {
-					return err
-				}
-				if ita == nil {
-					glog.Warningf("rocksdb: height %d, tx %v, input tx %v not found in txAddresses", block.Height, tx.Txid, input.Txid)
-					continue
+				if ita = d.txAddressesCache.get(stxID); ita != nil {
+					d.cbs.txAddressesCacheHit++
+				} else {
+					ita, err = d.getTxAddresses(btxID)
+					if err != nil {
+						return err
+					}
+					if ita == nil {
+						glog.Warningf("rocksdb: height %d, tx %v, input tx %v not found in txAddresses", block.Height, tx.Txid, input.Txid)
+						if ita, err = d.repairTxAddresses(input.Txid, btxID, block.Height, addresses, txAddressesMap, balances); err != nil {
+							return err
+						}
+						if ita == nil {
+							continue
+						}
+					}
+					d.cbs.txAddressesMiss++
 				}
 				txAddressesMap[stxID] = ita
-				d.cbs.txAddressesMiss++
 			} else {
 				d.cbs.txAddressesHit++
 			}
@@ -472,6 +1086,7 @@ func (d *RocksDB) processAddressesUTXO(block *bchain.Block, addresses map[string
 			tai.ValueSat = ot.ValueSat
 			// mark the output as spent in tx
 			ot.Spent = true
+			d.checkWatchedOutpoint(btxID, input.Vout, tx.Txid, i, block.Height, &ot.ValueSat)
 			if len(ot.AddrDesc) == 0 {
 				if !logged {
 					glog.Warningf("rocksdb: height %d, tx %v, input tx %v vout %v skipping empty address", block.Height, tx.Txid, input.Txid, input.Vout)
@@ -479,6 +1094,12 @@ func (d *RocksDB) processAddressesUTXO(block *bchain.Block, addresses map[string
 				}
 				continue
 			}
+			if d.isTxOutputFiltered(ot) {
+				continue
+			}
+			if d.traced(ot.AddrDesc, block.Height) {
+				glog.Infof("rocksdb: trace height %d, tx %v, vin %v spends %v:%v, %v, value %v", block.Height, tx.Txid, i, input.Txid, input.Vout, ot.AddrDesc, ot.ValueSat.String())
+			}
 			strAddrDesc := string(ot.AddrDesc)
 			// check that the address was used already in this block
 			o, processed := addresses[strAddrDesc]
@@ -510,11 +1131,69 @@ func (d *RocksDB) processAddressesUTXO(block *bchain.Block, addresses map[string
 			}
 			ab.BalanceSat.Sub(&ab.BalanceSat, &ot.ValueSat)
 			if ab.BalanceSat.Sign() < 0 {
-				d.resetValueSatToZero(&ab.BalanceSat, ot.AddrDesc, "balance")
+				d.resetValueSatToZero(&ab.BalanceSat, ot.AddrDesc, AmountAnomalyNegativeBalance, block.Height)
 			}
 			ab.SentSat.Add(&ab.SentSat, &ot.ValueSat)
+			d.checkTruncatedBalance(ab, ot.AddrDesc, block.Height)
 		}
 	}
+	d.addCounterparties(blockTxAddresses, balances)
+	return nil
+}
+
+// addTxOutputsUTXO adds the outputs of the transaction to the addresses of the block at height and to the balances,
+// the outputs, for which skip returns true, are not added
+func (d *RocksDB) addTxOutputsUTXO(txid string, btxID []byte, ta *TxAddresses, height uint32, addresses map[string][]outpoint, balances map[string]*AddrBalance, skip func(i int, addrDesc bchain.AddressDescriptor) (bool, error)) error {
+	for i := range ta.Outputs {
+		tao := &ta.Outputs[i]
+		addrDesc := tao.AddrDesc
+		// the filtered outputs keep the address in txAddresses, but they are not indexed
+		if len(addrDesc) == 0 || d.isTxOutputFiltered(tao) {
+			continue
+		}
+		if skip != nil {
+			if skipped, err := skip(i, addrDesc); err != nil {
+				return err
+			} else if skipped {
+				continue
+			}
+		}
+		if d.traced(addrDesc, height) {
+			glog.Infof("rocksdb: trace height %d, tx %v, vout %v, %v, value %v", height, txid, i, addrDesc, tao.ValueSat.String())
+		}
+		strAddrDesc := string(addrDesc)
+		// check that the address was used already in this block
+		o, processed := addresses[strAddrDesc]
+		if processed {
+			// check that the address was already used in this tx
+			processed = processedInTx(o, btxID)
+		}
+		addresses[strAddrDesc] = append(o, outpoint{
+			btxID: btxID,
+			index: int32(i),
+		})
+		ab, e := balances[strAddrDesc]
+		if !e {
+			var err error
+			ab, err = d.GetAddrDescBalance(addrDesc)
+			if err != nil {
+				return err
+			}
+			if ab == nil {
+				ab = &AddrBalance{}
+			}
+			balances[strAddrDesc] = ab
+			d.cbs.balancesMiss++
+		} else {
+			d.cbs.balancesHit++
+		}
+		// add number of trx in balance only once, address can be multiple times in tx
+		if !processed {
+			ab.Txs++
+		}
+		ab.BalanceSat.Add(&ab.BalanceSat, &tao.ValueSat)
+		d.checkTruncatedBalance(ab, addrDesc, height)
+	}
 	return nil
 }
 
@@ -531,8 +1210,9 @@ func (d *RocksDB) storeAddresses(wb *gorocksdb.WriteBatch, height uint32, addres
 	for addrDesc, outpoints := range addresses {
 		ba := bchain.AddressDescriptor(addrDesc)
 		key := packAddressKey(ba, height)
-		val := d.packOutpoints(outpoints)
+		val := d.packAddressOutpoints(outpoints)
 		wb.PutCF(d.cfh[cfAddresses], key, val)
+		wb.PutCF(d.cfh[cfHeightAddresses], packHeightAddressKey(height, ba), []byte{})
 	}
 	return nil
 }
@@ -548,24 +1228,69 @@ func (d *RocksDB) storeTxAddresses(wb *gorocksdb.WriteBatch, am map[string]*TxAd
 }
 
 func (d *RocksDB) storeBalances(wb *gorocksdb.WriteBatch, abm map[string]*AddrBalance) error {
-	// allocate buffer big enough for number of txs + 2 bigints
-	buf := make([]byte, vlq.MaxLen32+2*maxPackedBigintBytes)
+	// allocate buffer big enough for number of txs + 2 bigints + nonce + counterparty sketch
+	buf := make([]byte, vlq.MaxLen32+2*maxPackedBigintBytes+vlq.MaxLen64+1+CounterpartySketchRegisters)
 	for addrDesc, ab := range abm {
 		// balance with 0 transactions is removed from db - happens in disconnect
 		if ab == nil || ab.Txs <= 0 {
 			wb.DeleteCF(d.cfh[cfAddressBalance], bchain.AddressDescriptor(addrDesc))
 		} else {
-			l := packVaruint(uint(ab.Txs), buf)
-			ll := packBigint(&ab.SentSat, buf[l:])
-			l += ll
-			ll = packBigint(&ab.BalanceSat, buf[l:])
-			l += ll
+			l := packAddrBalance(ab, buf)
 			wb.PutCF(d.cfh[cfAddressBalance], bchain.AddressDescriptor(addrDesc), buf[:l])
 		}
 	}
 	return nil
 }
 
+// packAddrBalance packs the balance to buf, which must be big enough for number of txs + 2 bigints + nonce + counterparty sketch
+// returns the number of written bytes
+func packAddrBalance(ab *AddrBalance, buf []byte) int {
+	l := packVaruint(uint(ab.Txs), buf)
+	ll := packBigint(&ab.SentSat, buf[l:])
+	l += ll
+	ll = packBigint(&ab.BalanceSat, buf[l:])
+	l += ll
+	// nonce is stored only by account based chains or as zero before the counterparty sketch
+	if ab.Nonce > 0 || ab.Counterparties != nil {
+		l += packVaruint(uint(ab.Nonce), buf[l:])
+	}
+	if ab.Counterparties != nil {
+		l += copy(buf[l:], packCounterpartySketch(ab.Counterparties, nil))
+	}
+	return l
+}
+
+// unpackAddrBalance returns nil if buf is too short to contain the balance
+func unpackAddrBalance(buf []byte) *AddrBalance {
+	// 3 is minimum length of addrBalance - 1 byte txs, 1 byte sent, 1 byte balance
+	if len(buf) < 3 {
+		return nil
+	}
+	txs, l := unpackVaruint(buf)
+	sentSat, sl := unpackBigint(buf[l:])
+	l += sl
+	balanceSat, bl := unpackBigint(buf[l:])
+	l += bl
+	var nonce uint
+	var counterparties *CounterpartySketch
+	if l < len(buf) {
+		var nl int
+		nonce, nl = unpackVaruint(buf[l:])
+		l += nl
+		if nl > 0 && l < len(buf) {
+			// the invalid sketch is dropped, it is only an estimate
+			counterparties, _, _ = unpackCounterpartySketch(buf[l:])
+		}
+	}
+	return &AddrBalance{
+		Txs:            uint32(txs),
+		SentSat:        sentSat,
+		BalanceSat:     balanceSat,
+		Nonce:          uint64(nonce),
+		Counterparties: counterparties,
+	}
+}
+
 func (d *RocksDB) storeAndCleanupBlockTxs(wb *gorocksdb.WriteBatch, block *bchain.Block) error {
 	pl := d.chainParser.PackedTxidLen()
 	buf := make([]byte, 0, pl*len(block.Txs))
@@ -602,6 +1327,7 @@ func (d *RocksDB) storeAndCleanupBlockTxs(wb *gorocksdb.WriteBatch, block *bchai
 	keep := d.chainParser.KeepBlockAddresses()
 	// cleanup old block address
 	if block.Height > uint32(keep) {
+		pruned := 0
 		for rh := block.Height - uint32(keep); rh < block.Height; rh-- {
 			key = packUint(rh)
 			val, err := d.db.GetCF(d.ro, d.cfh[cfBlockTxs], key)
@@ -613,6 +1339,10 @@ func (d *RocksDB) storeAndCleanupBlockTxs(wb *gorocksdb.WriteBatch, block *bchai
 			}
 			val.Free()
 			d.db.DeleteCF(d.wo, d.cfh[cfBlockTxs], key)
+			pruned++
+		}
+		if pruned > 0 {
+			d.prunedBlockTxs(pruned, block.Height-uint32(keep))
 		}
 	}
 	return nil
@@ -649,25 +1379,18 @@ func (d *RocksDB) getBlockTxs(height uint32) ([]blockTxs, error) {
 	return bt, nil
 }
 
-func (d *RocksDB) GetAddrDescBalance(addrDesc bchain.AddressDescriptor) (*AddrBalance, error) {
+func (d *RocksDB) GetAddrDescBalance(addrDesc bchain.AddressDescriptor) (ab *AddrBalance, err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescBalance", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	val, err := d.db.GetCF(d.ro, d.cfh[cfAddressBalance], addrDesc)
 	if err != nil {
-		return nil, err
-	}
-	defer val.Free()
-	buf := val.Data()
-	// 3 is minimum length of addrBalance - 1 byte txs, 1 byte sent, 1 byte balance
-	if len(buf) < 3 {
-		return nil, nil
-	}
-	txs, l := unpackVaruint(buf)
-	sentSat, sl := unpackBigint(buf[l:])
-	balanceSat, _ := unpackBigint(buf[l+sl:])
-	return &AddrBalance{
-		Txs:        uint32(txs),
-		SentSat:    sentSat,
-		BalanceSat: balanceSat,
-	}, nil
+		return nil, err
+	}
+	defer val.Free()
+	return unpackAddrBalance(val.Data()), nil
 }
 
 // GetAddressBalance returns address balance for an address or nil if address not found
@@ -679,6 +1402,22 @@ func (d *RocksDB) GetAddressBalance(address string) (*AddrBalance, error) {
 	return d.GetAddrDescBalance(addrDesc)
 }
 
+// txAddressesKey returns the key of the transaction in the txAddresses column
+// the transactions flagged by the parser as duplicates of earlier transactions are keyed by txid+height,
+// so that they do not overwrite the data of the earlier transactions
+func (d *RocksDB) txAddressesKey(btxID []byte, txid string, height uint32) []byte {
+	if h, found := d.chainParser.GetDuplicateTxids()[txid]; found && h == height {
+		return duplicateTxAddressesKey(btxID, height)
+	}
+	return btxID
+}
+
+func duplicateTxAddressesKey(btxID []byte, height uint32) []byte {
+	key := make([]byte, 0, len(btxID)+4)
+	key = append(key, btxID...)
+	return append(key, packUint(height)...)
+}
+
 func (d *RocksDB) getTxAddresses(btxID []byte) (*TxAddresses, error) {
 	val, err := d.db.GetCF(d.ro, d.cfh[cfTxAddresses], btxID)
 	if err != nil {
@@ -694,49 +1433,92 @@ func (d *RocksDB) getTxAddresses(btxID []byte) (*TxAddresses, error) {
 }
 
 // GetTxAddresses returns TxAddresses for given txid or nil if not found
-func (d *RocksDB) GetTxAddresses(txid string) (*TxAddresses, error) {
+// for a txid duplicated by a later transaction the later transaction is returned, as it is by the backend
+func (d *RocksDB) GetTxAddresses(txid string) (ta *TxAddresses, err error) {
+	defer func(s time.Time) { d.observeMethod("GetTxAddresses", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	btxID, err := d.chainParser.PackTxid(txid)
 	if err != nil {
 		return nil, err
 	}
+	if h, found := d.chainParser.GetDuplicateTxids()[txid]; found {
+		if ta, err = d.getTxAddresses(duplicateTxAddressesKey(btxID, h)); err != nil || ta != nil {
+			return ta, err
+		}
+	}
 	return d.getTxAddresses(btxID)
 }
 
+// addrDescRefs assigns the indexes to the distinct addrDescs of a txAddresses entry in the order of their first occurrence,
+// a repeated addrDesc is packed as a reference to its first occurrence (since db version 4), the reference is stored
+// in place of the addrDesc length as maxAddrDescLen+1+index, which does not collide with the length of a stored addrDesc
+type addrDescRefs map[string]int
+
+// ref returns the index of the addrDesc packed earlier in the entry or -1, in which case the addrDesc is registered
+func (r addrDescRefs) ref(addrDesc bchain.AddressDescriptor) int {
+	if r == nil || len(addrDesc) == 0 {
+		return -1
+	}
+	s := string(addrDesc)
+	if i, found := r[s]; found {
+		return i
+	}
+	r[s] = len(r)
+	return -1
+}
+
 func packTxAddresses(ta *TxAddresses, buf []byte, varBuf []byte) []byte {
 	buf = buf[:0]
 	l := packVaruint(uint(ta.Height), varBuf)
 	buf = append(buf, varBuf[:l]...)
 	l = packVaruint(uint(len(ta.Inputs)), varBuf)
 	buf = append(buf, varBuf[:l]...)
+	var refs addrDescRefs
+	if len(ta.Inputs)+len(ta.Outputs) > 1 {
+		refs = make(addrDescRefs)
+	}
 	for i := range ta.Inputs {
-		buf = appendTxInput(&ta.Inputs[i], buf, varBuf)
+		buf = appendTxInput(&ta.Inputs[i], buf, varBuf, refs)
 	}
 	l = packVaruint(uint(len(ta.Outputs)), varBuf)
 	buf = append(buf, varBuf[:l]...)
 	for i := range ta.Outputs {
-		buf = appendTxOutput(&ta.Outputs[i], buf, varBuf)
+		buf = appendTxOutput(&ta.Outputs[i], buf, varBuf, refs)
 	}
 	return buf
 }
 
-func appendTxInput(txi *TxInput, buf []byte, varBuf []byte) []byte {
-	la := len(txi.AddrDesc)
-	l := packVaruint(uint(la), varBuf)
-	buf = append(buf, varBuf[:l]...)
-	buf = append(buf, txi.AddrDesc...)
-	l = packBigint(&txi.ValueSat, varBuf)
+func appendTxInput(txi *TxInput, buf []byte, varBuf []byte, refs addrDescRefs) []byte {
+	if r := refs.ref(txi.AddrDesc); r >= 0 {
+		l := packVaruint(uint(maxAddrDescLen+1+r), varBuf)
+		buf = append(buf, varBuf[:l]...)
+	} else {
+		l := packVaruint(uint(len(txi.AddrDesc)), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		buf = append(buf, txi.AddrDesc...)
+	}
+	l := packBigint(&txi.ValueSat, varBuf)
 	buf = append(buf, varBuf[:l]...)
 	return buf
 }
 
-func appendTxOutput(txo *TxOutput, buf []byte, varBuf []byte) []byte {
+func appendTxOutput(txo *TxOutput, buf []byte, varBuf []byte, refs addrDescRefs) []byte {
+	r := refs.ref(txo.AddrDesc)
 	la := len(txo.AddrDesc)
+	if r >= 0 {
+		la = maxAddrDescLen + 1 + r
+	}
 	if txo.Spent {
 		la = ^la
 	}
 	l := packVarint(la, varBuf)
 	buf = append(buf, varBuf[:l]...)
-	buf = append(buf, txo.AddrDesc...)
+	if r < 0 {
+		buf = append(buf, txo.AddrDesc...)
+	}
 	l = packBigint(&txo.ValueSat, varBuf)
 	buf = append(buf, varBuf[:l]...)
 	return buf
@@ -749,38 +1531,73 @@ func unpackTxAddresses(buf []byte) (*TxAddresses, error) {
 	inputs, ll := unpackVaruint(buf[l:])
 	l += ll
 	ta.Inputs = make([]TxInput, inputs)
+	// descs are the distinct addrDescs of the entry, to which the repeated addrDescs refer
+	var descs []bchain.AddressDescriptor
+	var err error
 	for i := uint(0); i < inputs; i++ {
-		l += unpackTxInput(&ta.Inputs[i], buf[l:])
+		if ll, err = unpackTxInput(&ta.Inputs[i], buf[l:], &descs); err != nil {
+			return nil, err
+		}
+		l += ll
 	}
 	outputs, ll := unpackVaruint(buf[l:])
 	l += ll
 	ta.Outputs = make([]TxOutput, outputs)
 	for i := uint(0); i < outputs; i++ {
-		l += unpackTxOutput(&ta.Outputs[i], buf[l:])
+		if ll, err = unpackTxOutput(&ta.Outputs[i], buf[l:], &descs); err != nil {
+			return nil, err
+		}
+		l += ll
 	}
 	return &ta, nil
 }
 
-func unpackTxInput(ti *TxInput, buf []byte) int {
+// unpackAddrDesc unpacks the addrDesc of the given packed length or reference, the unpacked addrDesc is registered in descs
+func unpackAddrDesc(al int, buf []byte, descs *[]bchain.AddressDescriptor) (bchain.AddressDescriptor, int, error) {
+	if al > maxAddrDescLen {
+		r := al - maxAddrDescLen - 1
+		if r >= len(*descs) {
+			return nil, 0, errors.Errorf("Invalid addrDesc reference %d", r)
+		}
+		return (*descs)[r], 0, nil
+	}
+	if al > len(buf) {
+		return nil, 0, errors.New("Invalid packed addrDesc")
+	}
+	addrDesc := make(bchain.AddressDescriptor, al)
+	copy(addrDesc, buf[:al])
+	if al > 0 {
+		*descs = append(*descs, addrDesc)
+	}
+	return addrDesc, al, nil
+}
+
+func unpackTxInput(ti *TxInput, buf []byte, descs *[]bchain.AddressDescriptor) (int, error) {
 	al, l := unpackVaruint(buf)
-	ti.AddrDesc = make([]byte, al)
-	copy(ti.AddrDesc, buf[l:l+int(al)])
-	al += uint(l)
-	ti.ValueSat, l = unpackBigint(buf[al:])
-	return l + int(al)
+	var ll int
+	var err error
+	if ti.AddrDesc, ll, err = unpackAddrDesc(int(al), buf[l:], descs); err != nil {
+		return 0, err
+	}
+	l += ll
+	ti.ValueSat, ll = unpackBigint(buf[l:])
+	return l + ll, nil
 }
 
-func unpackTxOutput(to *TxOutput, buf []byte) int {
+func unpackTxOutput(to *TxOutput, buf []byte, descs *[]bchain.AddressDescriptor) (int, error) {
 	al, l := unpackVarint(buf)
 	if al < 0 {
 		to.Spent = true
 		al = ^al
 	}
-	to.AddrDesc = make([]byte, al)
-	copy(to.AddrDesc, buf[l:l+al])
-	al += l
-	to.ValueSat, l = unpackBigint(buf[al:])
-	return l + al
+	var ll int
+	var err error
+	if to.AddrDesc, ll, err = unpackAddrDesc(al, buf[l:], descs); err != nil {
+		return 0, err
+	}
+	l += ll
+	to.ValueSat, ll = unpackBigint(buf[l:])
+	return l + ll, nil
 }
 
 func (d *RocksDB) packOutpoints(outpoints []outpoint) []byte {
@@ -810,6 +1627,80 @@ func (d *RocksDB) unpackOutpoints(buf []byte) ([]outpoint, error) {
 	return outpoints, nil
 }
 
+// packAddressOutpoints packs outpoints in the format of the addresses column (since db version 4)
+// outpoints with the same txid are grouped and the txid is stored only once, followed by the indexes
+// the first index is stored as is, the following indexes as the difference from the previous index of the txid
+// the lowest bit of the packed index signals that another index of the same txid follows
+func (d *RocksDB) packAddressOutpoints(outpoints []outpoint) []byte {
+	txids := make([]string, 0, len(outpoints))
+	indexes := make(map[string][]int32, len(outpoints))
+	for _, o := range outpoints {
+		s := string(o.btxID)
+		is, found := indexes[s]
+		if !found {
+			txids = append(txids, s)
+		}
+		indexes[s] = append(is, o.index)
+	}
+	buf := make([]byte, 0, len(txids)*(d.chainParser.PackedTxidLen()+1))
+	bvout := make([]byte, vlq.MaxLen32)
+	for _, txid := range txids {
+		buf = append(buf, txid...)
+		is := indexes[txid]
+		var prev int32
+		for i, index := range is {
+			v := (index - prev) << 1
+			if i < len(is)-1 {
+				v |= 1
+			}
+			l := packVarint32(v, bvout)
+			buf = append(buf, bvout[:l]...)
+			prev = index
+		}
+	}
+	return buf
+}
+
+func (d *RocksDB) unpackAddressOutpoints(buf []byte) ([]outpoint, error) {
+	// the older db opened read only is read in the format of its version
+	if d.dataVersion != 0 && d.dataVersion <= dbVersionV3 {
+		return d.unpackOutpoints(buf)
+	}
+	return d.unpackGroupedOutpoints(buf)
+}
+
+// unpackGroupedOutpoints unpacks the outpoints grouped by txid with the delta encoded indexes
+func (d *RocksDB) unpackGroupedOutpoints(buf []byte) ([]outpoint, error) {
+	txidUnpackedLen := d.chainParser.PackedTxidLen()
+	outpoints := make([]outpoint, 0)
+	for i := 0; i < len(buf); {
+		if i+txidUnpackedLen >= len(buf) {
+			return nil, errors.New("Inconsistent data in unpackAddressOutpoints")
+		}
+		btxID := append([]byte(nil), buf[i:i+txidUnpackedLen]...)
+		i += txidUnpackedLen
+		var prev int32
+		for more := true; more; {
+			if i >= len(buf) {
+				return nil, errors.New("Inconsistent data in unpackAddressOutpoints")
+			}
+			v, l := unpackVarint32(buf[i:])
+			if l <= 0 {
+				return nil, errors.New("Inconsistent data in unpackAddressOutpoints")
+			}
+			i += l
+			more = v&1 == 1
+			index := v>>1 + prev
+			prev = index
+			outpoints = append(outpoints, outpoint{
+				btxID: btxID,
+				index: index,
+			})
+		}
+	}
+	return outpoints, nil
+}
+
 func (d *RocksDB) unpackNOutpoints(buf []byte) ([]outpoint, int, error) {
 	txidUnpackedLen := d.chainParser.PackedTxidLen()
 	n, p := unpackVaruint(buf)
@@ -885,17 +1776,24 @@ func (d *RocksDB) writeAddressesNonUTXO(wb *gorocksdb.WriteBatch, block *bchain.
 			}
 		}
 	}
+	if op == opInsert {
+		d.checkWatchedAddresses(block.Height, addresses)
+	}
 	for addrDesc, outpoints := range addresses {
 		key := packAddressKey(bchain.AddressDescriptor(addrDesc), block.Height)
+		hkey := packHeightAddressKey(block.Height, bchain.AddressDescriptor(addrDesc))
 		switch op {
 		case opInsert:
-			val := d.packOutpoints(outpoints)
+			val := d.packAddressOutpoints(outpoints)
 			wb.PutCF(d.cfh[cfAddresses], key, val)
+			wb.PutCF(d.cfh[cfHeightAddresses], hkey, []byte{})
 		case opDelete:
 			wb.DeleteCF(d.cfh[cfAddresses], key)
+			wb.DeleteCF(d.cfh[cfHeightAddresses], hkey)
 		}
 	}
-	return nil
+	d.writeWithdrawals(wb, block, op)
+	return d.updateAccountBalances(wb, block, addresses, op)
 }
 
 // Block index
@@ -907,6 +1805,32 @@ type BlockInfo struct {
 	Txs    uint32
 	Size   uint32
 	Height uint32 // Height is not packed!
+	// Extra are the chain specific fields of the block packed by the parser
+	Extra bchain.BlockExtra `json:",omitempty"`
+	// Weight (BIP141) and SigOps (legacy signature operations) of the block, zero if not known
+	Weight uint32 `json:",omitempty"`
+	SigOps uint32 `json:",omitempty"`
+}
+
+// blockInfoExtraVersion is the version of the extension of the packed block info containing the chain specific fields,
+// blockInfoStatsVersion is the version of the extension containing the weight and the sigops followed by the chain specific fields,
+// the extensions of unknown versions are ignored
+const (
+	blockInfoExtraVersion = 1
+	blockInfoStatsVersion = 2
+)
+
+func blockInfoFromBlock(block *bchain.Block) *BlockInfo {
+	return &BlockInfo{
+		Hash:   block.Hash,
+		Time:   block.Time,
+		Txs:    uint32(len(block.Txs)),
+		Size:   uint32(block.Size),
+		Height: block.Height,
+		Extra:  block.Extra,
+		Weight: uint32(block.Weight),
+		SigOps: uint32(block.SigOps),
+	}
 }
 
 func (d *RocksDB) packBlockInfo(block *BlockInfo) ([]byte, error) {
@@ -922,6 +1846,23 @@ func (d *RocksDB) packBlockInfo(block *BlockInfo) ([]byte, error) {
 	packed = append(packed, varBuf[:l]...)
 	l = packVaruint(uint(block.Size), varBuf)
 	packed = append(packed, varBuf[:l]...)
+	var extra []byte
+	if len(block.Extra) > 0 {
+		if extra, err = d.chainParser.PackBlockExtra(block.Extra); err != nil {
+			return nil, errors.Annotatef(err, "PackBlockExtra %v", block.Hash)
+		}
+	}
+	if block.Weight > 0 {
+		packed = append(packed, blockInfoStatsVersion)
+		l = packVaruint(uint(block.Weight), varBuf)
+		packed = append(packed, varBuf[:l]...)
+		l = packVaruint(uint(block.SigOps), varBuf)
+		packed = append(packed, varBuf[:l]...)
+		packed = append(packed, extra...)
+	} else if len(extra) > 0 {
+		packed = append(packed, blockInfoExtraVersion)
+		packed = append(packed, extra...)
+	}
 	return packed, nil
 }
 
@@ -937,17 +1878,102 @@ func (d *RocksDB) unpackBlockInfo(buf []byte) (*BlockInfo, error) {
 	}
 	t := unpackUint(buf[pl:])
 	txs, l := unpackVaruint(buf[pl+4:])
-	size, _ := unpackVaruint(buf[pl+4+l:])
-	return &BlockInfo{
+	size, ls := unpackVaruint(buf[pl+4+l:])
+	bi := &BlockInfo{
 		Hash: txid,
 		Time: int64(t),
 		Txs:  uint32(txs),
 		Size: uint32(size),
-	}, nil
+	}
+	// the block info can be followed by the versioned extension with the stats and the chain specific fields
+	ext := buf[pl+4+l+ls:]
+	if len(ext) > 2 && ext[0] == blockInfoStatsVersion {
+		weight, lw := unpackVaruint(ext[1:])
+		if lw <= 0 {
+			return nil, errors.Errorf("Invalid block info stats %v", txid)
+		}
+		sigOps, lo := unpackVaruint(ext[1+lw:])
+		if lo <= 0 {
+			return nil, errors.Errorf("Invalid block info stats %v", txid)
+		}
+		bi.Weight = uint32(weight)
+		bi.SigOps = uint32(sigOps)
+		if ext = ext[1+lw+lo:]; len(ext) > 0 {
+			if bi.Extra, err = d.chainParser.UnpackBlockExtra(ext); err != nil {
+				return nil, errors.Annotatef(err, "UnpackBlockExtra %v", txid)
+			}
+		}
+	} else if len(ext) > 1 && ext[0] == blockInfoExtraVersion {
+		if bi.Extra, err = d.chainParser.UnpackBlockExtra(ext[1:]); err != nil {
+			return nil, errors.Annotatef(err, "UnpackBlockExtra %v", txid)
+		}
+	}
+	return bi, nil
+}
+
+// bestBlockCache holds the best block of the db so that the queries do not have to create an iterator over the height column
+// the cache is updated or invalidated after each write to the height column
+type bestBlockCache struct {
+	mux        sync.RWMutex
+	valid      bool
+	generation uint64
+	height     uint32
+	hash       string
+}
+
+func (d *RocksDB) setBestBlock(height uint32, hash string) {
+	d.best.mux.Lock()
+	d.best.valid = true
+	d.best.generation++
+	d.best.height = height
+	d.best.hash = hash
+	d.best.mux.Unlock()
+}
+
+func (d *RocksDB) invalidateBestBlock() {
+	d.best.mux.Lock()
+	d.best.valid = false
+	d.best.generation++
+	d.best.mux.Unlock()
 }
 
 // GetBestBlock returns the block hash of the block with highest height in the db
-func (d *RocksDB) GetBestBlock() (uint32, string, error) {
+func (d *RocksDB) GetBestBlock() (height uint32, hash string, err error) {
+	defer func(s time.Time) { d.observeMethod("GetBestBlock", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	d.best.mux.RLock()
+	if d.best.valid {
+		height, hash := d.best.height, d.best.hash
+		d.best.mux.RUnlock()
+		return height, hash, nil
+	}
+	generation := d.best.generation
+	d.best.mux.RUnlock()
+	height, hash, err = d.getBestBlockFromDB()
+	if err != nil {
+		return height, hash, err
+	}
+	d.best.mux.Lock()
+	// do not store the value if the height column was changed in the meantime
+	if d.best.generation == generation {
+		d.best.valid = true
+		d.best.height = height
+		d.best.hash = hash
+	}
+	d.best.mux.Unlock()
+	return height, hash, nil
+}
+
+// GetBestHeight returns the height of the best block in the db, it uses the cached value
+func (d *RocksDB) GetBestHeight() (uint32, error) {
+	height, _, err := d.GetBestBlock()
+	return height, err
+}
+
+func (d *RocksDB) getBestBlockFromDB() (uint32, string, error) {
 	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeight])
 	defer it.Close()
 	if it.SeekToLast(); it.Valid() {
@@ -964,7 +1990,12 @@ func (d *RocksDB) GetBestBlock() (uint32, string, error) {
 }
 
 // GetBlockHash returns block hash at given height or empty string if not found
-func (d *RocksDB) GetBlockHash(height uint32) (string, error) {
+func (d *RocksDB) GetBlockHash(height uint32) (hash string, err error) {
+	defer func(s time.Time) { d.observeMethod("GetBlockHash", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	key := packUint(height)
 	val, err := d.db.GetCF(d.ro, d.cfh[cfHeight], key)
 	if err != nil {
@@ -979,14 +2010,19 @@ func (d *RocksDB) GetBlockHash(height uint32) (string, error) {
 }
 
 // GetBlockInfo returns block info stored in db
-func (d *RocksDB) GetBlockInfo(height uint32) (*BlockInfo, error) {
+func (d *RocksDB) GetBlockInfo(height uint32) (bi *BlockInfo, err error) {
+	defer func(s time.Time) { d.observeMethod("GetBlockInfo", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	key := packUint(height)
 	val, err := d.db.GetCF(d.ro, d.cfh[cfHeight], key)
 	if err != nil {
 		return nil, err
 	}
 	defer val.Free()
-	bi, err := d.unpackBlockInfo(val.Data())
+	bi, err = d.unpackBlockInfo(val.Data())
 	if err != nil || bi == nil {
 		return nil, err
 	}
@@ -994,14 +2030,55 @@ func (d *RocksDB) GetBlockInfo(height uint32) (*BlockInfo, error) {
 	return bi, err
 }
 
+// HeightAtTime returns the height of the first block with time not lower than t or best+1 if there is no such block,
+// the times of the blocks are not strictly increasing, therefore the result is approximate
+func (d *RocksDB) HeightAtTime(t int64, best uint32) (uint32, error) {
+	lo, hi := uint32(0), best+1
+	for lo < hi {
+		m := lo + (hi-lo)/2
+		bi, err := d.GetBlockInfo(m)
+		if err != nil {
+			return 0, err
+		}
+		// the missing blocks (of the db synchronized from a later height) are before any time
+		if bi == nil || bi.Time < t {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	return lo, nil
+}
+
+// GetBlockInfos returns the block infos of the indexed blocks in the range of heights lower-higher
+func (d *RocksDB) GetBlockInfos(lower uint32, higher uint32) (bis []BlockInfo, err error) {
+	defer func(s time.Time) { d.observeMethod("GetBlockInfos", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeight])
+	defer it.Close()
+	r := make([]BlockInfo, 0)
+	for it.Seek(packUint(lower)); it.Valid(); it.Next() {
+		height := unpackUint(it.Key().Data())
+		if height > higher {
+			break
+		}
+		bi, err := d.unpackBlockInfo(it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		if bi != nil {
+			bi.Height = height
+			r = append(r, *bi)
+		}
+	}
+	return r, nil
+}
+
 func (d *RocksDB) writeHeightFromBlock(wb *gorocksdb.WriteBatch, block *bchain.Block, op int) error {
-	return d.writeHeight(wb, block.Height, &BlockInfo{
-		Hash:   block.Hash,
-		Time:   block.Time,
-		Txs:    uint32(len(block.Txs)),
-		Size:   uint32(block.Size),
-		Height: block.Height,
-	}, op)
+	return d.writeHeight(wb, block.Height, blockInfoFromBlock(block), op)
 }
 
 func (d *RocksDB) writeHeight(wb *gorocksdb.WriteBatch, height uint32, bi *BlockInfo, op int) error {
@@ -1023,51 +2100,6 @@ func (d *RocksDB) writeHeight(wb *gorocksdb.WriteBatch, height uint32, bi *Block
 
 // Disconnect blocks
 
-func (d *RocksDB) allAddressesScan(lower uint32, higher uint32) ([][]byte, [][]byte, error) {
-	glog.Infof("db: doing full scan of addresses column")
-	addrKeys := [][]byte{}
-	addrValues := [][]byte{}
-	var totalOutputs, count uint64
-	var seekKey []byte
-	for {
-		var key []byte
-		it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
-		if totalOutputs == 0 {
-			it.SeekToFirst()
-		} else {
-			it.Seek(seekKey)
-			it.Next()
-		}
-		for count = 0; it.Valid() && count < refreshIterator; it.Next() {
-			totalOutputs++
-			count++
-			key = it.Key().Data()
-			l := len(key)
-			if l > packedHeightBytes {
-				height := unpackUint(key[l-packedHeightBytes : l])
-				if height >= lower && height <= higher {
-					addrKey := make([]byte, len(key))
-					copy(addrKey, key)
-					addrKeys = append(addrKeys, addrKey)
-					value := it.Value().Data()
-					addrValue := make([]byte, len(value))
-					copy(addrValue, value)
-					addrValues = append(addrValues, addrValue)
-				}
-			}
-		}
-		seekKey = make([]byte, len(key))
-		copy(seekKey, key)
-		valid := it.Valid()
-		it.Close()
-		if !valid {
-			break
-		}
-	}
-	glog.Infof("rocksdb: scanned %d addresses, found %d to disconnect", totalOutputs, len(addrKeys))
-	return addrKeys, addrValues, nil
-}
-
 func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32, txid string, inputs []outpoint, txa *TxAddresses,
 	txAddressesToUpdate map[string]*TxAddresses, balances map[string]*AddrBalance) error {
 	addresses := make(map[string]struct{})
@@ -1086,32 +2118,36 @@ func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32,
 	}
 	for i, t := range txa.Inputs {
 		if len(t.AddrDesc) > 0 {
-			s := string(t.AddrDesc)
-			_, exist := addresses[s]
-			if !exist {
-				addresses[s] = struct{}{}
-			}
-			b, err := getAddressBalance(t.AddrDesc)
-			if err != nil {
-				return err
-			}
-			if b != nil {
-				// subtract number of txs only once
+			// the spent filtered output is not in the balance of its address
+			if !d.isOutputFiltered(t.AddrDesc, &t.ValueSat) {
+				s := string(t.AddrDesc)
+				_, exist := addresses[s]
 				if !exist {
-					b.Txs--
+					addresses[s] = struct{}{}
 				}
-				b.SentSat.Sub(&b.SentSat, &t.ValueSat)
-				if b.SentSat.Sign() < 0 {
-					d.resetValueSatToZero(&b.SentSat, t.AddrDesc, "sent amount")
+				b, err := getAddressBalance(t.AddrDesc)
+				if err != nil {
+					return err
+				}
+				if b != nil {
+					// subtract number of txs only once
+					if !exist {
+						b.Txs--
+					}
+					b.SentSat.Sub(&b.SentSat, &t.ValueSat)
+					if b.SentSat.Sign() < 0 {
+						d.resetValueSatToZero(&b.SentSat, t.AddrDesc, AmountAnomalyNegativeSent, height)
+					}
+					b.BalanceSat.Add(&b.BalanceSat, &t.ValueSat)
+				} else {
+					ad, _, _ := d.chainParser.GetAddressesFromAddrDesc(t.AddrDesc)
+					glog.Warningf("Balance for address %s (%s) not found", ad, t.AddrDesc)
 				}
-				b.BalanceSat.Add(&b.BalanceSat, &t.ValueSat)
-			} else {
-				ad, _, _ := d.chainParser.GetAddressesFromAddrDesc(t.AddrDesc)
-				glog.Warningf("Balance for address %s (%s) not found", ad, t.AddrDesc)
 			}
-			s = string(inputs[i].btxID)
+			s := string(inputs[i].btxID)
 			sa, exist := txAddressesToUpdate[s]
 			if !exist {
+				var err error
 				sa, err = d.getTxAddresses(inputs[i].btxID)
 				if err != nil {
 					return err
@@ -1121,8 +2157,9 @@ func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32,
 			sa.Outputs[inputs[i].index].Spent = false
 		}
 	}
-	for _, t := range txa.Outputs {
-		if len(t.AddrDesc) > 0 {
+	for i := range txa.Outputs {
+		t := &txa.Outputs[i]
+		if len(t.AddrDesc) > 0 && !d.isTxOutputFiltered(t) {
 			s := string(t.AddrDesc)
 			_, exist := addresses[s]
 			if !exist {
@@ -1139,7 +2176,7 @@ func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32,
 				}
 				b.BalanceSat.Sub(&b.BalanceSat, &t.ValueSat)
 				if b.BalanceSat.Sign() < 0 {
-					d.resetValueSatToZero(&b.BalanceSat, t.AddrDesc, "balance")
+					d.resetValueSatToZero(&b.BalanceSat, t.AddrDesc, AmountAnomalyNegativeBalance, height)
 				}
 			} else {
 				ad, _, _ := d.chainParser.GetAddressesFromAddrDesc(t.AddrDesc)
@@ -1148,6 +2185,9 @@ func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32,
 		}
 	}
 	for a := range addresses {
+		if d.traced(bchain.AddressDescriptor(a), height) {
+			glog.Infof("rocksdb: trace disconnect height %d, tx %v, %v", height, hex.EncodeToString([]byte(txid)), bchain.AddressDescriptor(a))
+		}
 		key := packAddressKey([]byte(a), height)
 		wb.DeleteCF(d.cfh[cfAddresses], key)
 	}
@@ -1156,7 +2196,17 @@ func (d *RocksDB) disconnectTxAddresses(wb *gorocksdb.WriteBatch, height uint32,
 
 // DisconnectBlockRangeUTXO removes all data belonging to blocks in range lower-higher
 // if they are in the range kept in the cfBlockTxids column
-func (d *RocksDB) DisconnectBlockRangeUTXO(lower uint32, higher uint32) error {
+func (d *RocksDB) DisconnectBlockRangeUTXO(lower uint32, higher uint32) (err error) {
+	defer func(s time.Time) { d.observeMethod("DisconnectBlockRangeUTXO", s, err) }(time.Now())
+	// the scan of the history of the multisig wallets must not read the disconnected blocks
+	d.stopMultisigScan()
+	defer d.startMultisigScan()
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	d.anomalies.balancesMux.Lock()
+	defer d.anomalies.balancesMux.Unlock()
 	glog.Infof("db: disconnecting blocks %d-%d", lower, higher)
 	blocks := make([][]blockTxs, higher-lower+1)
 	for height := lower; height <= higher; height++ {
@@ -1174,14 +2224,27 @@ func (d *RocksDB) DisconnectBlockRangeUTXO(lower uint32, higher uint32) error {
 	txAddressesToUpdate := make(map[string]*TxAddresses)
 	txsToDelete := make(map[string]struct{})
 	balances := make(map[string]*AddrBalance)
+	names := make(map[string]struct{})
+	paymentIDs := make(map[string]struct{})
+	ordinals := newOrdinalsUpdate()
+	holding := make(holdingUpdate)
+	blockTime := cachedBlockTimes(d.dbBlockTime)
 	for height := higher; height >= lower; height-- {
 		blockTxs := blocks[height-lower]
+		spendTime, _, err := blockTime(height)
+		if err != nil {
+			return err
+		}
+		if err := d.disconnectCoinbaseOrdinals(ordinals, height, blockTxs); err != nil {
+			return err
+		}
 		glog.Info("Disconnecting block ", height, " containing ", len(blockTxs), " transactions")
 		// go backwards to avoid interim negative balance
 		// when connecting block, amount is first in tx on the output side, then in another tx on the input side
 		// when disconnecting, it must be done backwards
 		for i := len(blockTxs) - 1; i >= 0; i-- {
-			txid := blockTxs[i].btxID
+			ut, _ := d.chainParser.UnpackTxid(blockTxs[i].btxID)
+			txid := d.txAddressesKey(blockTxs[i].btxID, ut, height)
 			s := string(txid)
 			txsToDelete[s] = struct{}{}
 			txa, err := d.getTxAddresses(txid)
@@ -1189,59 +2252,134 @@ func (d *RocksDB) DisconnectBlockRangeUTXO(lower uint32, higher uint32) error {
 				return err
 			}
 			if txa == nil {
-				ut, _ := d.chainParser.UnpackTxid(txid)
 				glog.Warning("TxAddress for txid ", ut, " not found")
 				continue
 			}
+			d.disconnectedNames(txa, names)
+			d.disconnectedPaymentIDs(txa, paymentIDs)
+			if err := d.disconnectOrdinals(ordinals, blockTxs[i].btxID, blockTxs[i].inputs, txa); err != nil {
+				return err
+			}
 			if err := d.disconnectTxAddresses(wb, height, s, blockTxs[i].inputs, txa, txAddressesToUpdate, balances); err != nil {
 				return err
 			}
+			if err := d.disconnectHoldingTimes(holding, height, spendTime, blockTxs[i].inputs, txa, txAddressesToUpdate, blockTime); err != nil {
+				return err
+			}
 		}
-		key := packUint(height)
-		wb.DeleteCF(d.cfh[cfBlockTxs], key)
-		wb.DeleteCF(d.cfh[cfHeight], key)
+		d.deleteScriptTemplateOutpoints(wb, height)
+	}
+	d.deleteHeightRange(wb, cfBlockTxs, nil, lower, higher)
+	d.deleteHeightRange(wb, cfHeight, nil, lower, higher)
+	d.deleteHeightRange(wb, cfHeightAddresses, nil, lower, higher)
+	d.deleteHeightRange(wb, cfArchive, nil, lower, higher)
+	d.deleteHeightRange(wb, cfIndexDelta, nil, lower, higher)
+	d.deleteHeightRange(wb, cfIndexHash, nil, lower, higher)
+	d.deleteHeightRange(wb, cfLargestTxs, nil, lower, higher)
+	d.deleteHeightRange(wb, cfFees, []byte{feesBlockKeyPrefix}, lower, higher)
+	d.deleteHeightRange(wb, cfBlockSupply, nil, lower, higher)
+	d.lastSupply = nil
+	if err := d.disconnectBlockBurns(wb, lower, higher); err != nil {
+		return err
+	}
+	if err := d.deleteSilentPayments(wb, lower, higher); err != nil {
+		return err
+	}
+	d.deleteNameOps(wb, names, lower, higher)
+	d.deletePaymentIDs(wb, paymentIDs, lower, higher)
+	if err := d.storeOrdinals(wb, ordinals); err != nil {
+		return err
 	}
 	d.storeTxAddresses(wb, txAddressesToUpdate)
 	d.storeBalances(wb, balances)
+	d.storeHoldingStats(wb, holding)
+	if err := d.storeAmountAnomalies(wb); err != nil {
+		return err
+	}
 	for s := range txsToDelete {
 		b := []byte(s)
 		wb.DeleteCF(d.cfh[cfTransactions], b)
+		d.deleteSharedTx(b)
 		wb.DeleteCF(d.cfh[cfTxAddresses], b)
+		wb.DeleteCF(d.cfh[cfDustTxs], b)
+		wb.DeleteCF(d.cfh[cfCoinjoinTxs], b)
+		wb.DeleteCF(d.cfh[cfRewards], b)
+		wb.DeleteCF(d.cfh[cfScriptAnnotations], b)
 	}
-	err := d.db.Write(d.wo, wb)
+	multisigDone, err := d.disconnectMultisigEvents(wb, lower, higher)
+	if err != nil {
+		return err
+	}
+	err = d.db.Write(d.wo, wb)
+	multisigDone(err)
+	d.invalidateBestBlock()
+	// the txAddresses of the spent outputs were modified
+	d.txAddressesCache.purge()
 	if err == nil {
 		glog.Infof("rocksdb: blocks %d-%d disconnected", lower, higher)
+		if len(txsToDelete) >= compactionMinDeletes {
+			d.scheduleCompaction(d.disconnectedHeightRanges(lower, higher)...)
+		}
 	}
 	return err
 }
 
-// DisconnectBlockRangeNonUTXO performs full range scan to remove a range of blocks
-// it is very slow operation
-func (d *RocksDB) DisconnectBlockRangeNonUTXO(lower uint32, higher uint32) error {
+// DisconnectBlockRangeNonUTXO removes a range of blocks, the addresses to disconnect are found using the heightAddresses column
+func (d *RocksDB) DisconnectBlockRangeNonUTXO(lower uint32, higher uint32) (err error) {
+	defer func(s time.Time) { d.observeMethod("DisconnectBlockRangeNonUTXO", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	glog.Infof("db: disconnecting blocks %d-%d", lower, higher)
-	addrKeys, _, err := d.allAddressesScan(lower, higher)
+	addrKeys, addrValues, heightValues, err := d.heightAddressesScan(lower, higher)
 	if err != nil {
 		return err
 	}
 	glog.Infof("rocksdb: about to disconnect %d addresses ", len(addrKeys))
 	wb := gorocksdb.NewWriteBatch()
 	defer wb.Destroy()
-	for _, addrKey := range addrKeys {
+	addresses := make(map[string][]outpoint)
+	undos := make(map[string][]nonceUndo)
+	for i, addrKey := range addrKeys {
 		if glog.V(2) {
 			glog.Info("address ", hex.EncodeToString(addrKey))
 		}
 		// delete address:height from the index
 		wb.DeleteCF(d.cfh[cfAddresses], addrKey)
-	}
-	for height := lower; height <= higher; height++ {
-		if glog.V(2) {
-			glog.Info("height ", height)
+		wb.DeleteCF(d.cfh[cfWithdrawals], addrKey)
+		addrDesc, height, err := unpackAddressKey(addrKey)
+		if err != nil {
+			return err
 		}
-		wb.DeleteCF(d.cfh[cfHeight], packUint(height))
+		outpoints, err := d.unpackAddressOutpoints(addrValues[i])
+		if err != nil {
+			return err
+		}
+		addresses[string(addrDesc)] = append(addresses[string(addrDesc)], outpoints...)
+		_, sentTxs := countAccountTxs(outpoints)
+		undos[string(addrDesc)] = append(undos[string(addrDesc)], unpackNonceUndo(height, sentTxs, heightValues[i]))
+	}
+	changes := getAccountChanges(addresses)
+	for addrDesc, c := range changes {
+		c.undos = undos[addrDesc]
 	}
+	if err := d.storeAccountChanges(wb, lower, changes, opDelete); err != nil {
+		return err
+	}
+	d.deleteHeightRange(wb, cfHeight, nil, lower, higher)
+	d.deleteHeightRange(wb, cfHeightAddresses, nil, lower, higher)
+	d.deleteHeightRange(wb, cfArchive, nil, lower, higher)
+	d.deleteHeightRange(wb, cfIndexDelta, nil, lower, higher)
+	d.deleteHeightRange(wb, cfIndexHash, nil, lower, higher)
+	d.deleteHeightRange(wb, cfLargestTxs, nil, lower, higher)
 	err = d.db.Write(d.wo, wb)
+	d.invalidateBestBlock()
 	if err == nil {
 		glog.Infof("rocksdb: blocks %d-%d disconnected", lower, higher)
+		if len(addrKeys) >= compactionMinDeletes {
+			d.scheduleCompaction(d.disconnectedHeightRanges(lower, higher)...)
+		}
 	}
 	return err
 }
@@ -1261,6 +2399,10 @@ func dirSize(path string) (int64, error) {
 
 // DatabaseSizeOnDisk returns size of the database in bytes
 func (d *RocksDB) DatabaseSizeOnDisk() int64 {
+	if err := d.enterHandle(); err != nil {
+		return 0
+	}
+	defer d.releaseHandle()
 	size, err := dirSize(d.path)
 	if err != nil {
 		glog.Error("rocksdb: DatabaseSizeOnDisk: ", err)
@@ -1270,17 +2412,23 @@ func (d *RocksDB) DatabaseSizeOnDisk() int64 {
 }
 
 // GetTx returns transaction stored in db and height of the block containing it
-func (d *RocksDB) GetTx(txid string) (*bchain.Tx, uint32, error) {
+func (d *RocksDB) GetTx(txid string) (tx *bchain.Tx, height uint32, err error) {
+	defer func(s time.Time) { d.observeMethod("GetTx", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	key, err := d.chainParser.PackTxid(txid)
 	if err != nil {
 		return nil, 0, err
 	}
-	val, err := d.db.GetCF(d.ro, d.cfh[cfTransactions], key)
+	data, err := d.txCacheStore().Get(key)
 	if err != nil {
 		return nil, 0, err
 	}
-	defer val.Free()
-	data := val.Data()
+	if d.txStore != nil && data != nil {
+		return d.unpackSharedTx(data)
+	}
 	if len(data) > 4 {
 		return d.chainParser.UnpackTx(data)
 	}
@@ -1288,7 +2436,12 @@ func (d *RocksDB) GetTx(txid string) (*bchain.Tx, uint32, error) {
 }
 
 // PutTx stores transactions in db
-func (d *RocksDB) PutTx(tx *bchain.Tx, height uint32, blockTime int64) error {
+func (d *RocksDB) PutTx(tx *bchain.Tx, height uint32, blockTime int64) (err error) {
+	defer func(s time.Time) { d.observeMethod("PutTx", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	key, err := d.chainParser.PackTxid(tx.Txid)
 	if err != nil {
 		return nil
@@ -1297,28 +2450,32 @@ func (d *RocksDB) PutTx(tx *bchain.Tx, height uint32, blockTime int64) error {
 	if err != nil {
 		return err
 	}
-	err = d.db.PutCF(d.wo, d.cfh[cfTransactions], key, buf)
-	if err == nil {
-		d.is.AddDBColumnStats(cfTransactions, 1, int64(len(key)), int64(len(buf)))
+	if d.txStore != nil {
+		// the transaction of the block not connected yet is not shared, the replica with the block stores it
+		if buf, err = d.packSharedTx(buf, height); err != nil || buf == nil {
+			return err
+		}
 	}
-	return err
+	return d.txCacheStore().Put(key, buf)
 }
 
 // DeleteTx removes transactions from db
-func (d *RocksDB) DeleteTx(txid string) error {
+func (d *RocksDB) DeleteTx(txid string) (err error) {
+	defer func(s time.Time) { d.observeMethod("DeleteTx", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
 	key, err := d.chainParser.PackTxid(txid)
 	if err != nil {
 		return nil
 	}
-	// use write batch so that this delete matches other deletes
-	wb := gorocksdb.NewWriteBatch()
-	defer wb.Destroy()
-	d.internalDeleteTx(wb, key)
-	return d.db.Write(d.wo, wb)
+	return d.txCacheStore().Delete(key)
 }
 
-// internalDeleteTx checks if tx is cached and updates internal state accordingly
+// internalDeleteTx checks if tx is cached and updates internal state accordingly, the tx is removed also from the shared store
 func (d *RocksDB) internalDeleteTx(wb *gorocksdb.WriteBatch, key []byte) {
+	d.deleteSharedTx(key)
 	val, err := d.db.GetCF(d.ro, d.cfh[cfTransactions], key)
 	// ignore error, it is only for statistics
 	if err == nil {
@@ -1358,44 +2515,108 @@ func (d *RocksDB) LoadInternalState(rpcCoin string) (*common.InternalState, erro
 			return nil, errors.Errorf("Coins do not match. DB coin %v, RPC coin %v", is.Coin, rpcCoin)
 		}
 	}
+	// the filter of the indexed outputs cannot be changed, the connected blocks would not be reindexed
+	if rules := d.indexFilter.Rules(); rules != is.IndexFilter {
+		_, hash, err := d.getBestBlockFromDB()
+		if err != nil {
+			return nil, err
+		}
+		if hash != "" {
+			return nil, errors.Errorf("Index filter does not match. DB index filter '%v', index filter '%v'", is.IndexFilter, rules)
+		}
+		is.IndexFilter = rules
+	}
+	// the columns added to the existing db contain only the data of the blocks connected after they were created
+	var addedFrom uint32
+	if len(d.addedColumns) > 0 {
+		best, hash, err := d.getBestBlockFromDB()
+		if err != nil {
+			return nil, err
+		}
+		if hash != "" {
+			addedFrom = best + 1
+		}
+	}
 	// make sure that column stats match the columns
 	sc := is.DbColumns
 	nc := make([]common.InternalStateColumn, len(cfNames))
+	migrateFrom := uint32(dbVersion)
 	for i := 0; i < len(nc); i++ {
 		nc[i].Name = cfNames[i]
 		nc[i].Version = dbVersion
 		for j := 0; j < len(sc); j++ {
 			if sc[j].Name == nc[i].Name {
 				// check the version of the column, if it does not match, the db is not compatible
+				// unless it can be migrated
 				if sc[j].Version != dbVersion {
-					return nil, errors.Errorf("DB version %v of column '%v' does not match the required version %v. DB is not compatible.", sc[j].Version, sc[j].Name, dbVersion)
+					if !canMigrate(sc[j].Version) {
+						return nil, errors.Errorf("DB version %v of column '%v' does not match the required version %v. DB is not compatible.", sc[j].Version, sc[j].Name, dbVersion)
+					}
+					if sc[j].Version < migrateFrom {
+						migrateFrom = sc[j].Version
+					}
 				}
 				nc[i].Rows = sc[j].Rows
 				nc[i].KeyBytes = sc[j].KeyBytes
 				nc[i].ValueBytes = sc[j].ValueBytes
 				nc[i].Updated = sc[j].Updated
+				nc[i].FromHeight = sc[j].FromHeight
 				break
 			}
 		}
+		for _, n := range d.addedColumns {
+			if n == nc[i].Name {
+				nc[i].FromHeight = addedFrom
+				glog.Info("rocksdb: column ", n, " contains data from height ", addedFrom)
+			}
+		}
 	}
 	is.DbColumns = nc
+	// the compactions queued before the restart are not resumed, rocksdb compacts the ranges eventually by itself
+	is.PendingCompactions = 0
+	if migrateFrom != dbVersion {
+		if err := d.migrate(is, migrateFrom); err != nil {
+			return nil, err
+		}
+	}
 	// after load, reset the synchronization data
-	is.IsSynchronized = false
+	is.ResetSyncPhase()
+	if is.InterruptedSyncPhase != "" {
+		glog.Warning("rocksdb: synchronization was interrupted in phase ", is.InterruptedSyncPhase, ", last verified block ", is.VerifiedHeight, " ", is.VerifiedHash)
+	}
+	// the verified block must be in the index, it is not if the state was stored before the blocks were disconnected
+	if is.VerifiedHash != "" {
+		hash, err := d.GetBlockHash(is.VerifiedHeight)
+		if err != nil {
+			return nil, err
+		}
+		if hash != is.VerifiedHash {
+			best, bestHash, err := d.getBestBlockFromDB()
+			if err != nil {
+				return nil, err
+			}
+			glog.Warning("rocksdb: verified block ", is.VerifiedHeight, " ", is.VerifiedHash, " is not in the index, using the best block ", best, " ", bestHash)
+			is.VerifiedHeight, is.VerifiedHash = best, bestHash
+		}
+	}
 	is.IsMempoolSynchronized = false
 	var t time.Time
 	is.LastMempoolSync = t
-	is.SyncMode = false
 	return is, nil
 }
 
 func (d *RocksDB) SetInconsistentState(inconsistent bool) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
 	if d.is == nil {
 		return errors.New("Internal state not created")
 	}
 	if inconsistent {
-		d.is.DbState = common.DbStateInconsistent
+		d.is.SetDbState(common.DbStateInconsistent)
 	} else {
-		d.is.DbState = common.DbStateOpen
+		d.is.SetDbState(common.DbStateOpen)
 	}
 	return d.storeState(d.is)
 }
@@ -1407,6 +2628,10 @@ func (d *RocksDB) SetInternalState(is *common.InternalState) {
 
 // StoreInternalState stores the internal state to db
 func (d *RocksDB) StoreInternalState(is *common.InternalState) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
 	if d.metrics != nil {
 		for c := 0; c < len(cfNames); c++ {
 			rows, keyBytes, valueBytes := d.is.GetDBColumnStatValues(c)
@@ -7,6 +7,7 @@ import (
 	"blockbook/bchain/coins/btc"
 	"blockbook/common"
 	"blockbook/tests/dbtestdata"
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -17,10 +18,12 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	vlq "github.com/bsm/go-vlq"
 	"github.com/jakm/btcutil/chaincfg"
 	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
 )
 
 // simplified explanation of signed varint packing, used in many index data structures
@@ -163,13 +166,25 @@ func verifyAfterUTXOBlock1(t *testing.T, d *RocksDB, afterDisconnect bool) {
 			t.Fatal(err)
 		}
 	}
-	// the vout is encoded as signed varint, i.e. value * 2 for non negative values
+	// the vout is shifted left by one bit, the lowest bit signals that another vout of the same tx follows
+	// the result is encoded as signed varint, i.e. value * 2 for non negative values
 	if err := checkColumn(d, cfAddresses, []keyPair{
 		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser) + "000370d5", dbtestdata.TxidB1T1 + "00", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser) + "000370d5", dbtestdata.TxidB1T1 + "02", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser) + "000370d5", dbtestdata.TxidB1T1 + "04", nil},
 		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "00", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "02", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "04", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "04", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "08", nil},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
+	if err := checkColumn(d, cfHeightAddresses, []keyPair{
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser), "", nil},
 	}); err != nil {
 		{
 			t.Fatal(err)
@@ -251,24 +266,36 @@ func verifyAfterUTXOBlock2(t *testing.T, d *RocksDB) {
 	}
 	if err := checkColumn(d, cfAddresses, []keyPair{
 		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser) + "000370d5", dbtestdata.TxidB1T1 + "00", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser) + "000370d5", dbtestdata.TxidB1T1 + "02", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser) + "000370d5", dbtestdata.TxidB1T1 + "04", nil},
 		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "00", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "02", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "04", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "00" + dbtestdata.TxidB2T2 + "01", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr7, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "02", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "04", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser) + "000370d5", dbtestdata.TxidB1T2 + "08", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "00" + dbtestdata.TxidB2T2 + "03", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr7, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "04", nil},
 		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr8, d.chainParser) + "000370d6", dbtestdata.TxidB2T2 + "00", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr9, d.chainParser) + "000370d6", dbtestdata.TxidB2T2 + "02", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "01", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "03", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser) + "000370d6", dbtestdata.TxidB2T3 + "00" + dbtestdata.TxidB2T3 + "01", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr9, d.chainParser) + "000370d6", dbtestdata.TxidB2T2 + "04", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "03", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser) + "000370d6", dbtestdata.TxidB2T1 + "07", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser) + "000370d6", dbtestdata.TxidB2T3 + "02" + "03", nil},
 		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.AddrA, d.chainParser) + "000370d6", dbtestdata.TxidB2T4 + "00", nil},
-		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser) + "000370d6", dbtestdata.TxidB2T2 + "03", nil},
+		keyPair{dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser) + "000370d6", dbtestdata.TxidB2T2 + "07", nil},
 	}); err != nil {
 		{
 			t.Fatal(err)
 		}
 	}
+	hkp := []keyPair{}
+	for _, a := range []string{dbtestdata.Addr1, dbtestdata.Addr2, dbtestdata.Addr3, dbtestdata.Addr4, dbtestdata.Addr5} {
+		hkp = append(hkp, keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(a, d.chainParser), "", nil})
+	}
+	for _, a := range []string{dbtestdata.Addr2, dbtestdata.Addr3, dbtestdata.Addr4, dbtestdata.Addr5, dbtestdata.Addr6, dbtestdata.Addr7, dbtestdata.Addr8, dbtestdata.Addr9, dbtestdata.AddrA} {
+		hkp = append(hkp, keyPair{"000370d6" + dbtestdata.AddressToPubKeyHex(a, d.chainParser), "", nil})
+	}
+	if err := checkColumn(d, cfHeightAddresses, hkp); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
 	if err := checkColumn(d, cfTxAddresses, []keyPair{
 		keyPair{
 			dbtestdata.TxidB1T1,
@@ -438,6 +465,8 @@ func TestRocksDB_Index_UTXO(t *testing.T) {
 		BitcoinParser: bitcoinTestnetParser(),
 	})
 	defer closeAndDestroyRocksDB(t, d)
+	// the inputs of the 2nd block are read from the txAddresses cache
+	d.SetTxAddressesCacheSize(100)
 
 	// connect 1st block - will log warnings about missing UTXO transactions in txAddresses column
 	block1 := dbtestdata.GetTestUTXOBlock1(d.chainParser)
@@ -445,6 +474,9 @@ func TestRocksDB_Index_UTXO(t *testing.T) {
 		t.Fatal(err)
 	}
 	verifyAfterUTXOBlock1(t, d, false)
+	if l := d.txAddressesCache.len(); l != len(block1.Txs) {
+		t.Fatalf("txAddressesCache len = %v, want %v", l, len(block1.Txs))
+	}
 
 	// connect 2nd block - use some outputs from the 1st block as the inputs and 1 input uses tx from the same block
 	block2 := dbtestdata.GetTestUTXOBlock2(d.chainParser)
@@ -452,6 +484,9 @@ func TestRocksDB_Index_UTXO(t *testing.T) {
 		t.Fatal(err)
 	}
 	verifyAfterUTXOBlock2(t, d)
+	if d.cbs.txAddressesCacheHit == 0 {
+		t.Error("txAddressesCache was not used")
+	}
 
 	// get transactions for various addresses / low-high ranges
 	verifyGetTransactions(t, d, dbtestdata.Addr2, 0, 1000000, []txidVoutOutput{
@@ -548,11 +583,18 @@ func TestRocksDB_Index_UTXO(t *testing.T) {
 
 	// disconnect the 2nd block, verify that the db contains only data from the 1st block with restored unspentTxs
 	// and that the cached tx is removed
+	if h, err := d.GetBestHeight(); err != nil || h != 225494 {
+		t.Fatalf("GetBestHeight() = %v, %v, want 225494", h, err)
+	}
 	err = d.DisconnectBlockRangeUTXO(225494, 225494)
 	if err != nil {
 		t.Fatal(err)
 	}
 	verifyAfterUTXOBlock1(t, d, true)
+	// the cached best block must be invalidated by the disconnect
+	if h, hash, err := d.GetBestBlock(); err != nil || h != 225493 || hash != "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997" {
+		t.Fatalf("GetBestBlock() = %v, %v, %v, want 225493", h, hash, err)
+	}
 	if err := checkColumn(d, cfTransactions, []keyPair{}); err != nil {
 		{
 			t.Fatal(err)
@@ -666,6 +708,199 @@ func Test_BulkConnect_UTXO(t *testing.T) {
 	verifyAfterUTXOBlock2(t, d)
 }
 
+func Test_ShardSync_UTXO(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	defer os.RemoveAll(d.shardsPath())
+	d.SetLargestTxs(true)
+	d.SetBurns(true)
+	d.SetBurnAddresses([]bchain.AddressDescriptor{addressToAddrDesc(dbtestdata.Addr5, d.chainParser)})
+
+	// outputs pass of each block to its own shard, in the reverse order
+	blocks := []*bchain.Block{dbtestdata.GetTestUTXOBlock1(d.chainParser), dbtestdata.GetTestUTXOBlock2(d.chainParser)}
+	shards := make([]*RocksDB, len(blocks))
+	for i := len(blocks) - 1; i >= 0; i-- {
+		s, err := d.openShard(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeShard(s)
+		shards[i] = s
+		if err := d.connectShardBlock(s, blocks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checkColumn(d, cfHeight, []keyPair{}); err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.connectShardBlock(shards[0], 225493, false); err != nil {
+		t.Fatal(err)
+	}
+	// the rows of the block are copied to the index with its inputs pass, the block not yet connected has none
+	for _, h := range []uint32{225493, 225494} {
+		val, err := d.db.GetCF(d.ro, d.cfh[cfBlockBurns], packUint(h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (val.Size() > 0) != (h == 225493) {
+			t.Errorf("blockBurns of block %v: %x", h, val.Data())
+		}
+		val.Free()
+	}
+	if err := bc.connectShardBlock(shards[1], 225494, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.connectShardBlock(shards[1], 225495, false); err == nil {
+		t.Error("connectShardBlock of a block missing in the shard did not fail")
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyAfterUTXOBlock2(t, d)
+	for _, b := range blocks {
+		want, err := d.packLargestTxs(d.computeLargestTxs(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := d.db.GetCF(d.ro, d.cfh[cfLargestTxs], packUint(b.Height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val.Data(), want) {
+			t.Errorf("largestTxs of block %v = %x, want %x", b.Height, val.Data(), want)
+		}
+		val.Free()
+	}
+}
+
+func Test_ShardSync_Unsupported(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.checkShardedSync(); err != nil {
+		t.Fatal(err)
+	}
+	d.SetOrdinals(true)
+	d.SetHoldingStats(true)
+	err := d.checkShardedSync()
+	if err == nil || err.Error() != "The sharded sync does not support ordinals, holding stats" {
+		t.Errorf("checkShardedSync() = %v, want error of ordinals and holding stats", err)
+	}
+}
+
+func TestRocksDB_MigrateTo(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	oldPath := d.path
+	defer os.RemoveAll(oldPath)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MigrateTo(oldPath, nil); err == nil {
+		t.Error("MigrateTo() to the same directory did not fail")
+	}
+	path := oldPath + ".migrated"
+	resumed := false
+	err := d.MigrateTo(path, func() (func(), error) {
+		// the block connected after the checkpoint is copied from the WAL
+		if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+		return func() { resumed = true }, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resumed {
+		t.Error("MigrateTo() did not resume")
+	}
+	if d.path != path {
+		t.Errorf("path = %v, want %v", d.path, path)
+	}
+	verifyAfterUTXOBlock2(t, d)
+
+	// the failed pause leaves the db in place
+	err = d.MigrateTo(oldPath+".failed", func() (func(), error) {
+		return nil, errors.New("timeout")
+	})
+	if err == nil {
+		t.Error("MigrateTo() with failed pause did not fail")
+	}
+	if _, err := os.Stat(oldPath + ".failed"); !os.IsNotExist(err) {
+		t.Error("MigrateTo() with failed pause did not remove the directory")
+	}
+	if d.path != path {
+		t.Errorf("path = %v, want %v", d.path, path)
+	}
+}
+
+func TestRocksDB_HandleGate(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	path := d.path
+	defer os.RemoveAll(path)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	// the call in progress holds the handle, Reopen waits until it is released and the new calls fail meanwhile
+	if err := d.enterHandle(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := make(chan error)
+	go func() {
+		reopened <- d.Reopen()
+	}()
+	for {
+		d.handle.mux.Lock()
+		closed := d.handle.closed
+		d.handle.mux.Unlock()
+		if closed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, err := d.GetBestBlock(); err != errHandleClosed {
+		t.Errorf("GetBestBlock() during Reopen error = %v, want %v", err, errHandleClosed)
+	}
+	select {
+	case <-reopened:
+		t.Fatal("Reopen() did not wait for the call in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.releaseHandle()
+	if err := <-reopened; err != nil {
+		t.Fatal(err)
+	}
+	height, _, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225493 {
+		t.Errorf("GetBestBlock() height = %v, want 225493", height)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.GetBestBlock(); err != errHandleClosed {
+		t.Errorf("GetBestBlock() after Close error = %v, want %v", err, errHandleClosed)
+	}
+}
+
 func Test_packBigint_unpackBigint(t *testing.T) {
 	bigbig1, _ := big.NewInt(0).SetString("123456789123456789012345", 10)
 	bigbig2, _ := big.NewInt(0).SetString("12345678912345678901234512389012345123456789123456789012345123456789123456789012345", 10)
@@ -773,7 +1008,7 @@ func Test_packTxAddresses_unpackTxAddresses(t *testing.T) {
 	}{
 		{
 			name: "1",
-			hex:  "7b0216001443aac20a116e09ea4f7914be1c55e4c17aa600b70016001454633aa8bd2e552bd4e89c01e73c1b7905eb58460811207cb68a199872012d001443aac20a116e09ea4f7914be1c55e4c17aa600b70101",
+			hex:  "7b0216001443aac20a116e09ea4f7914be1c55e4c17aa600b70016001454633aa8bd2e552bd4e89c01e73c1b7905eb58460811207cb68a1998720190030101",
 			data: &TxAddresses{
 				Height: 123,
 				Inputs: []TxInput{
@@ -841,6 +1076,42 @@ func Test_packTxAddresses_unpackTxAddresses(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "repeated addresses",
+			hex:  "01031976a914d2a37ce20ac9ec4f15dd05a7c6e8e9fbdb99850e88ac01018801010288010103033276a9146b2044146a4438e6e5bfbc65f147afeb64d14fbb88ac010590030101900400",
+			data: &TxAddresses{
+				Height: 1,
+				Inputs: []TxInput{
+					{
+						AddrDesc: addressToAddrDesc("mzii3fuRSpExMLJEHdHveW8NmiX8MPgavk", parser),
+						ValueSat: *big.NewInt(1),
+					},
+					{
+						AddrDesc: addressToAddrDesc("mzii3fuRSpExMLJEHdHveW8NmiX8MPgavk", parser),
+						ValueSat: *big.NewInt(2),
+					},
+					{
+						AddrDesc: addressToAddrDesc("mzii3fuRSpExMLJEHdHveW8NmiX8MPgavk", parser),
+						ValueSat: *big.NewInt(3),
+					},
+				},
+				Outputs: []TxOutput{
+					{
+						AddrDesc: addressToAddrDesc("mqHPFTRk23JZm9W1ANuEFtwTYwxjESSgKs", parser),
+						ValueSat: *big.NewInt(5),
+					},
+					{
+						AddrDesc: addressToAddrDesc("mzii3fuRSpExMLJEHdHveW8NmiX8MPgavk", parser),
+						ValueSat: *big.NewInt(1),
+						Spent:    true,
+					},
+					{
+						AddrDesc: addressToAddrDesc("mqHPFTRk23JZm9W1ANuEFtwTYwxjESSgKs", parser),
+						ValueSat: *big.NewInt(0),
+					},
+				},
+			},
+		},
 		{
 			name: "empty address",
 			hex:  "baef9a1501000204d2020002162e010162",
@@ -893,4 +1164,2835 @@ func Test_packTxAddresses_unpackTxAddresses(t *testing.T) {
 			}
 		})
 	}
+	// reference to an addrDesc not present in the entry
+	if _, err := unpackTxAddresses([]byte{0x01, 0x01, 0x88, 0x01, 0x00, 0x00}); err == nil {
+		t.Error("unpackTxAddresses() expected error for invalid addrDesc reference")
+	}
+}
+
+func Test_packBlockFeeStats_unpackBlockFeeStats(t *testing.T) {
+	tests := []struct {
+		name string
+		data *BlockFeeStats
+	}{
+		{
+			name: "rates",
+			data: &BlockFeeStats{
+				Height:       123456,
+				Txs:          1234,
+				TotalFeesSat: *big.NewInt(98765432),
+				FeeRates:     []uint64{1000, 2500, 10000, 50001, 1234567},
+			},
+		},
+		{
+			name: "no rates",
+			data: &BlockFeeStats{
+				Height:       1,
+				TotalFeesSat: *big.NewInt(0),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := packBlockFeeStats(tt.data)
+			got, err := unpackBlockFeeStats(tt.data.Height, b)
+			if err != nil {
+				t.Errorf("unpackBlockFeeStats() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.data) {
+				t.Errorf("unpackBlockFeeStats() = %+v, want %+v", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestRocksDB_FeeStats(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	// the fee stats are stored only for the blocks connected after they were enabled
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	d.SetFeeStats(true)
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := d.GetBlockFeeStats(225493, 225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs) != 1 || fs[0].Height != 225494 || fs[0].TotalFeesSat.Sign() <= 0 {
+		t.Errorf("GetBlockFeeStats() = %+v, want the stats of block 225494", fs)
+	}
+}
+
+func TestRocksDB_DustFilter(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	f := &DustFilter{MinOutputs: 2}
+	f.ThresholdSat.SetInt64(12345)
+	d.SetDustFilter(f)
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		txid string
+		want bool
+	}{
+		// only one output of the value under the threshold
+		{dbtestdata.TxidB1T1, false},
+		{dbtestdata.TxidB1T2, true},
+	}
+	for _, tt := range tests {
+		got, err := d.IsDustTx(tt.txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("IsDustTx(%v) = %v, want %v", tt.txid, got, tt.want)
+		}
+	}
+}
+
+func TestRocksDB_GetBlockAffectedAddresses(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetBlockAffectedAddresses(225493)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ordered by the address descriptors
+	want := []bchain.AddressDescriptor{
+		addressToAddrDesc(dbtestdata.Addr1, d.chainParser),
+		addressToAddrDesc(dbtestdata.Addr2, d.chainParser),
+		addressToAddrDesc(dbtestdata.Addr3, d.chainParser),
+		addressToAddrDesc(dbtestdata.Addr4, d.chainParser),
+		addressToAddrDesc(dbtestdata.Addr5, d.chainParser),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBlockAffectedAddresses(225493) = %v, want %v", got, want)
+	}
+	if got, err = d.GetBlockAffectedAddresses(225494); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetBlockAffectedAddresses(225494) = %v, want empty", got)
+	}
+}
+
+func TestClassifyCoinjoin(t *testing.T) {
+	outputs := func(values ...int64) []TxOutput {
+		r := make([]TxOutput, len(values))
+		for i, v := range values {
+			r[i].AddrDesc = bchain.AddressDescriptor{0x76, byte(i)}
+			r[i].ValueSat.SetInt64(v)
+		}
+		return r
+	}
+	wasabi := make([]int64, 12)
+	for i := range wasabi {
+		wasabi[i] = 10000000
+	}
+	// the equal outputs to the same address are counted once
+	sameAddress := outputs(1000, 1000, 1000)
+	sameAddress[1].AddrDesc = sameAddress[0].AddrDesc
+	tests := []struct {
+		name    string
+		inputs  int
+		outputs []TxOutput
+		want    *CoinjoinTx
+	}{
+		{
+			name:    "whirlpool",
+			inputs:  5,
+			outputs: outputs(5000000, 5000000, 5000000, 5000000, 5000000),
+			want:    &CoinjoinTx{Type: CoinjoinWhirlpool, EqualOutputs: 5, DenominationSat: *big.NewInt(5000000)},
+		},
+		{
+			name:    "not whirlpool denomination",
+			inputs:  5,
+			outputs: outputs(4000000, 4000000, 4000000, 4000000, 4000000),
+			want:    &CoinjoinTx{Type: CoinjoinGeneric, EqualOutputs: 5, DenominationSat: *big.NewInt(4000000)},
+		},
+		{
+			name:    "wasabi",
+			inputs:  20,
+			outputs: append(outputs(wasabi...), outputs(123, 456)...),
+			want:    &CoinjoinTx{Type: CoinjoinWasabi, EqualOutputs: 12, DenominationSat: *big.NewInt(10000000)},
+		},
+		{
+			name:    "equal outputs and equal change, the larger value wins",
+			inputs:  3,
+			outputs: outputs(100, 100, 100, 7000, 7000, 7000),
+			want:    &CoinjoinTx{Type: CoinjoinGeneric, EqualOutputs: 3, DenominationSat: *big.NewInt(7000)},
+		},
+		{
+			name:    "fewer inputs than equal outputs",
+			inputs:  1,
+			outputs: outputs(1000, 1000, 1000, 1000),
+		},
+		{
+			name:    "too few equal outputs",
+			inputs:  4,
+			outputs: outputs(1000, 1000, 2000, 3000),
+		},
+		{
+			name:    "same address",
+			inputs:  3,
+			outputs: sameAddress,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyCoinjoin(tt.inputs, tt.outputs, 3)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classifyCoinjoin() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRocksDB_ReadSnapshot(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := d.CreateReadSnapshot(time.Minute, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.BestHeight != 225493 {
+		t.Errorf("CreateReadSnapshot() BestHeight = %v, want 225493", s.BestHeight)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := d.ReadSnapshotView(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	height, _, err := v.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225493 {
+		t.Errorf("GetBestBlock() from snapshot = %v, want 225493", height)
+	}
+	ta, err := v.GetTxAddresses(dbtestdata.TxidB2T1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ta != nil {
+		t.Errorf("GetTxAddresses() from snapshot = %+v, want nil", ta)
+	}
+	// the released snapshot is kept until its view is done
+	if err := d.ReleaseReadSnapshot(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.ReadSnapshotView(s.ID); err == nil {
+		t.Error("ReadSnapshotView() of released snapshot, expected error")
+	}
+	if height, _, err = v.GetBestBlock(); err != nil || height != 225493 {
+		t.Errorf("GetBestBlock() from released snapshot = %v, %v, want 225493", height, err)
+	}
+	if len(d.snapshots.m) != 1 || s.ro == nil {
+		t.Error("released snapshot in use destroyed")
+	}
+	d.DoneReadSnapshotView(s)
+	if len(d.snapshots.m) != 0 || s.ro != nil {
+		t.Error("released snapshot not destroyed after its view is done")
+	}
+	// the expired snapshot is destroyed after its view is done too
+	s, err = d.CreateReadSnapshot(time.Minute, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = d.ReadSnapshotView(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.Expires = time.Now().Add(-time.Second)
+	if _, _, err := d.ReadSnapshotView(s.ID); err == nil {
+		t.Error("ReadSnapshotView() of expired snapshot, expected error")
+	}
+	if s.ro == nil {
+		t.Error("expired snapshot in use destroyed")
+	}
+	d.DoneReadSnapshotView(s)
+	if len(d.snapshots.m) != 0 || s.ro != nil {
+		t.Error("expired snapshot not destroyed after its view is done")
+	}
+	// the number of the snapshots of one owner is limited
+	for i := 0; i < MaxReadSnapshotsPerOwner; i++ {
+		if _, err = d.CreateReadSnapshot(time.Minute, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = d.CreateReadSnapshot(time.Minute, "a"); err == nil {
+		t.Error("CreateReadSnapshot() over the limit of the owner, expected error")
+	}
+	if _, err = d.CreateReadSnapshot(time.Minute, "b"); err != nil {
+		t.Errorf("CreateReadSnapshot() of another owner: %v", err)
+	}
+}
+
+func TestScriptSkeleton(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "P2PKH",
+			script: "76a914010d39800f86122416e28f485029acf77507169288ac",
+			want:   "76a91488ac",
+		},
+		{
+			name:   "P2SH",
+			script: "a9144a21db08fb6882cb152e1ff06780a430740f770487",
+			want:   "a91487",
+		},
+		{
+			name:   "OP_RETURN with PUSHDATA1",
+			script: "6a4c0401020304",
+			want:   "6a4c04",
+		},
+		{
+			name:    "truncated",
+			script:  "76a914010d39",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.script)
+			got, err := ScriptSkeleton(b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ScriptSkeleton() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && hex.EncodeToString(got) != tt.want {
+				t.Errorf("ScriptSkeleton() = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRocksDB_ScriptTemplates(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	p2sh, _ := hex.DecodeString("a91487")
+	d.SetScriptTemplates([][]byte{p2sh})
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err := d.GetScriptTemplateOutputs(p2sh, 0, ^uint32(0), func(txid string, vout uint32, height uint32) error {
+		got = append(got, fmt.Sprint(txid, ":", vout, ":", height))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		dbtestdata.TxidB1T2 + ":1:225493",
+		dbtestdata.TxidB1T2 + ":2:225493",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetScriptTemplateOutputs() = %v, want %v", got, want)
+	}
+}
+
+func TestRocksDB_IndexFilter(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	for _, s := range []string{"unknown", "below=-1", "below=x", "address=x", "script=zz"} {
+		if _, err := ParseIndexFilter(s, d.chainParser); err == nil {
+			t.Errorf("ParseIndexFilter(%v) expected error", s)
+		}
+	}
+	f, err := ParseIndexFilter("opreturn, below=10000,address="+dbtestdata.Addr3, d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.String(); got != "opreturn, below=10000, addresses 1" {
+		t.Errorf("IndexFilter.String() = %v", got)
+	}
+	rules := "opreturn,below=10000,addrdesc=" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser)
+	if got := f.Rules(); got != rules {
+		t.Errorf("IndexFilter.Rules() = %v, want %v", got, rules)
+	}
+	// the filter is stored in the internal state of the db without blocks
+	d.SetIndexFilter(f)
+	is, err := d.LoadInternalState("btc-testnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.IndexFilter != rules {
+		t.Errorf("InternalState.IndexFilter = %v, want %v", is.IndexFilter, rules)
+	}
+	d.SetInternalState(is)
+	if err := d.storeState(is); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		txid string
+		want []string
+	}{
+		// the output of Addr2 is above the limit
+		{dbtestdata.TxidB1T1, []string{dbtestdata.Addr1, dbtestdata.Addr2}},
+		// Addr3 is skipped, the outputs of Addr4 and Addr5 are below the limit, they keep their addresses
+		{dbtestdata.TxidB1T2, []string{dbtestdata.Addr3, dbtestdata.Addr4, dbtestdata.Addr5}},
+	}
+	for _, tt := range tests {
+		ta, err := d.GetTxAddresses(tt.txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for i := range ta.Outputs {
+			a := ""
+			if len(ta.Outputs[i].AddrDesc) > 0 {
+				addrs, _, err := d.chainParser.GetAddressesFromAddrDesc(ta.Outputs[i].AddrDesc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				a = addrs[0]
+			}
+			got = append(got, a)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetTxAddresses(%v) outputs %v, want %v", tt.txid, got, tt.want)
+		}
+		if tt.txid == dbtestdata.TxidB1T2 && ta.Outputs[0].ValueSat.Cmp(dbtestdata.SatB1T2A3) != 0 {
+			t.Errorf("GetTxAddresses(%v) value %v, want %v", tt.txid, ta.Outputs[0].ValueSat.String(), dbtestdata.SatB1T2A3)
+		}
+	}
+	addrDesc, _ := d.chainParser.GetAddrDescFromAddress(dbtestdata.Addr3)
+	if ab, err := d.GetAddrDescBalance(addrDesc); err != nil || ab != nil {
+		t.Errorf("GetAddrDescBalance(%v) = %+v, %v, want nil", dbtestdata.Addr3, ab, err)
+	}
+	// the spend of the filtered output does not touch the balance of the address
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if ab, err := d.GetAddrDescBalance(addrDesc); err != nil || ab != nil {
+		t.Errorf("GetAddrDescBalance(%v) after spend = %+v, %v, want nil", dbtestdata.Addr3, ab, err)
+	}
+	if len(d.anomalies.pending) != 0 {
+		t.Errorf("amount anomalies after spend of filtered output = %+v", d.anomalies.pending)
+	}
+	// the db with connected blocks is refused with another filter
+	if _, err := d.LoadInternalState("btc-testnet"); err != nil {
+		t.Errorf("LoadInternalState() with the same filter error %v", err)
+	}
+	d.SetIndexFilter(nil)
+	if _, err := d.LoadInternalState("btc-testnet"); err == nil {
+		t.Error("LoadInternalState() without filter expected error")
+	}
+	d.SetIndexFilter(f)
+}
+
+func TestRocksDB_WatchedOutpoints(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	var got []WatchedOutpointSpent
+	d.SetOnWatchedOutpointSpent(func(spent []WatchedOutpointSpent) {
+		got = append(got, spent...)
+	})
+	for _, wo := range []WatchedOutpoint{
+		{Txid: dbtestdata.TxidB1T1, Vout: 0, Label: "unspent"},
+		{Txid: dbtestdata.TxidB1T1, Vout: 1, Webhook: "http://localhost/hook", Label: "spent"},
+	} {
+		if err := d.WatchOutpoint(&wo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("unexpected notification after block 1: %+v", got)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 notification after block 2, got %+v", got)
+	}
+	s := got[0]
+	if s.Txid != dbtestdata.TxidB1T1 || s.Vout != 1 || s.Label != "spent" || s.Webhook != "http://localhost/hook" ||
+		s.SpendingTxid != dbtestdata.TxidB2T1 || s.Vin != 1 || s.Height != 225494 || s.ValueSat.Cmp(dbtestdata.SatB1T1A2) != 0 {
+		t.Errorf("unexpected notification %+v", s)
+	}
+
+	// the watched outpoints must survive reload from the db
+	if err := d.UnwatchOutpoint(dbtestdata.TxidB1T1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.loadWatchedOutpoints(); err != nil {
+		t.Fatal(err)
+	}
+	wos := d.GetWatchedOutpoints()
+	want := []WatchedOutpoint{{Txid: dbtestdata.TxidB1T1, Vout: 1, Webhook: "http://localhost/hook", Label: "spent"}}
+	if !reflect.DeepEqual(wos, want) {
+		t.Errorf("GetWatchedOutpoints() = %+v, want %+v", wos, want)
+	}
+}
+
+func TestRocksDB_WatchedAddresses(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	var got []WatchedAddressActivity
+	d.SetOnWatchedAddressActivity(func(activity []WatchedAddressActivity) {
+		got = append(got, activity...)
+	})
+	if err := d.WatchAddresses([]WatchedAddress{
+		{Address: dbtestdata.Addr3, Label: "deposit", Webhook: "http://localhost/hook"},
+		{Address: dbtestdata.AddrA},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WatchAddresses([]WatchedAddress{{Address: "invalid"}}); err == nil {
+		t.Error("WatchAddresses() expected error for invalid address")
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	want := []WatchedAddressActivity{
+		{WatchedAddress: WatchedAddress{Address: dbtestdata.Addr3, Label: "deposit", Webhook: "http://localhost/hook"}, Txid: dbtestdata.TxidB1T2, Height: 225493},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("activity after block 1 = %+v, want %+v", got, want)
+	}
+	got = nil
+	if _, err := d.UnwatchAddresses([]string{dbtestdata.AddrA}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	want = []WatchedAddressActivity{
+		{WatchedAddress: WatchedAddress{Address: dbtestdata.Addr3, Label: "deposit", Webhook: "http://localhost/hook"}, Txid: dbtestdata.TxidB2T1, Height: 225494},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("activity after block 2 = %+v, want %+v", got, want)
+	}
+
+	// the watched addresses must survive reload from the db
+	if err := d.loadWatchedAddresses(); err != nil {
+		t.Fatal(err)
+	}
+	was := d.GetWatchedAddresses()
+	if !reflect.DeepEqual(was, []WatchedAddress{want[0].WatchedAddress}) {
+		t.Errorf("GetWatchedAddresses() = %+v, want %+v", was, []WatchedAddress{want[0].WatchedAddress})
+	}
+}
+
+// the activity of watched addresses in bulk connect is notified after the blocks are written to the db
+func TestRocksDB_WatchedAddresses_BulkConnect(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	var got []WatchedAddressActivity
+	d.SetOnWatchedAddressActivity(func(activity []WatchedAddressActivity) {
+		// the notified transactions must be in the db
+		for _, a := range activity {
+			if ta, err := d.GetTxAddresses(a.Txid); err != nil || ta == nil {
+				t.Errorf("tx %v notified before it was written, %v", a.Txid, err)
+			}
+		}
+		got = append(got, activity...)
+	})
+	if err := d.WatchAddresses([]WatchedAddress{{Address: dbtestdata.Addr3}}); err != nil {
+		t.Fatal(err)
+	}
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("activity notified before the bulk was written: %+v", got)
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []WatchedAddressActivity{
+		{WatchedAddress: WatchedAddress{Address: dbtestdata.Addr3}, Txid: dbtestdata.TxidB1T2, Height: 225493},
+		{WatchedAddress: WatchedAddress{Address: dbtestdata.Addr3}, Txid: dbtestdata.TxidB2T1, Height: 225494},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("activity after bulk connect = %+v, want %+v", got, want)
+	}
+}
+
+func TestRocksDB_ReorgHistory(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	got, err := d.GetReorgHistory(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("GetReorgHistory() = %+v, want empty", got)
+	}
+	events := []ReorgEvent{
+		{
+			OldTipHeight: 225494,
+			OldTipHash:   "00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6",
+			NewTipHeight: 225494,
+			NewTipHash:   "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997",
+			ForkHeight:   225493,
+			Depth:        1,
+			Detected:     1534859200,
+			Resolved:     1534859201,
+		},
+		{
+			OldTipHeight: 225494,
+			OldTipHash:   "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997",
+			ForkHeight:   0,
+			Depth:        225494,
+			Detected:     1534859300,
+			Resolved:     1534859300,
+		},
+	}
+	for i := range events {
+		if err := d.StoreReorgEvent(&events[i], events[i].Detected*1e9); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = d.GetReorgHistory(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ReorgEvent{events[1], events[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetReorgHistory() = %+v, want %+v", got, want)
+	}
+	got, err = d.GetReorgHistory(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("GetReorgHistory(1) = %+v, want %+v", got, want[:1])
+	}
+}
+
+func TestRocksDB_HeightGaps(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	block1 := dbtestdata.GetTestUTXOBlock1(d.chainParser)
+	block2 := dbtestdata.GetTestUTXOBlock2(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	gaps, err := d.FindHeightGaps(225493)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 0 {
+		t.Errorf("FindHeightGaps() = %+v, want no gaps", gaps)
+	}
+	// the index starts at block 225493, the heights below it are not missing
+	if gaps, err = d.FindHeightGaps(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 0 {
+		t.Errorf("FindHeightGaps(0) = %+v, want no gaps", gaps)
+	}
+	bi, err := d.GetBlockInfo(225493)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash which lost the record of block 1
+	if err := d.db.DeleteCF(d.wo, d.cfh[cfHeight], packUint(225493)); err != nil {
+		t.Fatal(err)
+	}
+	gaps, err = d.FindHeightGaps(225490)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []HeightGap{{Lower: 225490, Higher: 225493}}; !reflect.DeepEqual(gaps, want) {
+		t.Errorf("FindHeightGaps() = %+v, want %+v", gaps, want)
+	}
+
+	indexed, err := d.isBlockIndexed(block1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !indexed {
+		t.Error("isBlockIndexed(block1) = false, want true")
+	}
+	notIndexed := *block2
+	notIndexed.Height = 225495
+	if indexed, err = d.isBlockIndexed(&notIndexed); err != nil {
+		t.Fatal(err)
+	}
+	if indexed {
+		t.Error("isBlockIndexed(block at 225495) = true, want false")
+	}
+
+	if err := d.restoreBlockInfo(block1); err != nil {
+		t.Fatal(err)
+	}
+	if gaps, err = d.FindHeightGaps(225493); err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 0 {
+		t.Errorf("FindHeightGaps() after restore = %+v, want no gaps", gaps)
+	}
+	restored, err := d.GetBlockInfo(225493)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, bi) {
+		t.Errorf("GetBlockInfo() = %+v, want %+v", restored, bi)
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225494 || hash != block2.Hash {
+		t.Errorf("GetBestBlock() = %v %v, want 225494 %v", height, hash, block2.Hash)
+	}
+}
+
+func TestRocksDB_CacheWarmup(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	// empty db
+	if err := d.warmCache(10, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.warmCache(10, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	close(stop)
+	if err := d.warmCache(10, stop); err != nil {
+		t.Fatal(err)
+	}
+	// the background warmup must be stopped by Reopen and Close
+	d.SetCacheWarmup(1)
+	if err := d.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	d.SetCacheWarmup(0)
+	if d.warmup.stop != nil {
+		t.Error("SetCacheWarmup(0) did not stop the warmup")
+	}
+}
+
+func TestRocksDB_AddedColumn(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	// d is replaced by the reopened db
+	defer func() { closeAndDestroyRocksDB(t, d) }()
+	if len(d.addedColumns) != 0 {
+		t.Errorf("addedColumns of a new db = %v, want none", d.addedColumns)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StoreInternalState(d.is); err != nil {
+		t.Fatal(err)
+	}
+	// simulate a db created by a version without the archive column
+	if err := d.db.DropColumnFamily(d.cfh[cfArchive]); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := NewRocksDB(d.path, 100000, -1, d.chainParser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = nd
+	if !reflect.DeepEqual(d.addedColumns, []string{"archive"}) {
+		t.Errorf("addedColumns = %v, want [archive]", d.addedColumns)
+	}
+	is, err := d.LoadInternalState("btc-testnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInternalState(is)
+	if h := is.GetDBColumnFromHeight("archive"); h != 225494 {
+		t.Errorf("GetDBColumnFromHeight(archive) = %v, want 225494", h)
+	}
+	if h := is.GetDBColumnFromHeight("height"); h != 0 {
+		t.Errorf("GetDBColumnFromHeight(height) = %v, want 0", h)
+	}
+	// the created column is usable
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRocksDB_ReadOnlyMissingColumn(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	// d is replaced by the db opened read only
+	defer func() { closeAndDestroyRocksDB(t, d) }()
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StoreInternalState(d.is); err != nil {
+		t.Fatal(err)
+	}
+	// simulate a db created by a version without the archive column
+	if err := d.db.DropColumnFamily(d.cfh[cfArchive]); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewRocksDBReadOnly(d.path, 100000, -1, d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = rd
+	if !reflect.DeepEqual(d.missingColumns, []string{"archive"}) || len(d.addedColumns) != 0 {
+		t.Errorf("missingColumns = %v, addedColumns = %v, want [archive] and none", d.missingColumns, d.addedColumns)
+	}
+	if d.cfh[cfArchive] != nil || d.cfh[cfHeight] == nil {
+		t.Error("handles of the columns of the db opened read only do not match the existing columns")
+	}
+	bi, err := d.GetBlockInfo(225493)
+	if err != nil || bi == nil {
+		t.Fatalf("GetBlockInfo() = %+v, %v", bi, err)
+	}
+	if err := d.DumpColumn("archive", nil, func(key, value []byte) bool { return true }); err == nil {
+		t.Error("DumpColumn() of the missing column expected error")
+	}
+	rows := 0
+	if err := d.DumpColumn("height", nil, func(key, value []byte) bool { rows++; return true }); err != nil || rows != 1 {
+		t.Errorf("DumpColumn(height) = %v rows, %v, want 1 row", rows, err)
+	}
+}
+
+func Test_packAddressOutpoints_unpackAddressOutpoints(t *testing.T) {
+	d := &RocksDB{chainParser: bitcoinTestnetParser()}
+	b1, _ := hex.DecodeString(dbtestdata.TxidB1T1)
+	b2, _ := hex.DecodeString(dbtestdata.TxidB2T1)
+	tests := []struct {
+		name string
+		data []outpoint
+		want []outpoint
+		hex  string
+	}{
+		{
+			name: "single",
+			data: []outpoint{{b1, 1}},
+			hex:  dbtestdata.TxidB1T1 + "04",
+		},
+		{
+			name: "repeated txid",
+			data: []outpoint{{b1, 0}, {b2, ^1}, {b1, ^0}, {b1, 10}},
+			want: []outpoint{{b1, 0}, {b1, ^0}, {b1, 10}, {b2, ^1}},
+			hex:  dbtestdata.TxidB1T1 + "02" + "01" + "2c" + dbtestdata.TxidB2T1 + "07",
+		},
+		{
+			name: "consecutive indexes",
+			data: []outpoint{{b1, 40}, {b1, 41}, {b1, 42}, {b1, 300}},
+			hex:  dbtestdata.TxidB1T1 + "8122" + "06" + "06" + "8808",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := d.packAddressOutpoints(tt.data)
+			if h := hex.EncodeToString(b); h != tt.hex {
+				t.Errorf("packAddressOutpoints() = %v, want %v", h, tt.hex)
+			}
+			got, err := d.unpackAddressOutpoints(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == nil {
+				want = tt.data
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("unpackAddressOutpoints() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRocksDB_MigrateOutpointsV2(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	b1, _ := hex.DecodeString(dbtestdata.TxidB2T3)
+	key := packAddressKey(addressToAddrDesc(dbtestdata.Addr5, d.chainParser), 225494)
+	// store outpoints in the format of version 3
+	if err := d.db.PutCF(d.wo, d.cfh[cfAddresses], key, d.packOutpoints([]outpoint{{b1, 0}, {b1, ^0}})); err != nil {
+		t.Fatal(err)
+	}
+	for i := range d.is.DbColumns {
+		d.is.DbColumns[i].Version = dbVersionV3
+	}
+	if err := d.storeState(d.is); err != nil {
+		t.Fatal(err)
+	}
+	is, err := d.LoadInternalState("btc-testnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.DbColumns[cfAddresses].Version != dbVersion {
+		t.Errorf("Version = %v, want %v", is.DbColumns[cfAddresses].Version, dbVersion)
+	}
+	if err := checkColumn(d, cfAddresses, []keyPair{
+		keyPair{hex.EncodeToString(key), dbtestdata.TxidB2T3 + "02" + "03", nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkColumn(d, cfHeightAddresses, []keyPair{
+		keyPair{"000370d6" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser), "", nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// repackOutpointsV3 rewrites the addresses column of the db in the format of version 3, the simple list of txid+index
+func repackOutpointsV3(t *testing.T, d *RocksDB) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		outpoints, err := d.unpackAddressOutpoints(it.Value().Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wb.PutCF(d.cfh[cfAddresses], append([]byte(nil), it.Key().Data()...), d.packOutpoints(outpoints))
+	}
+	if err := d.db.Write(d.wo, wb); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRocksDB_MigrateAddedHeightAddresses(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	// d is replaced by the reopened db
+	defer func() { closeAndDestroyRocksDB(t, d) }()
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	// simulate a db of version 3, which did not have the heightAddresses column
+	repackOutpointsV3(t, d)
+	for i := range d.is.DbColumns {
+		d.is.DbColumns[i].Version = dbVersionV3
+	}
+	if err := d.StoreInternalState(d.is); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.db.DropColumnFamily(d.cfh[cfHeightAddresses]); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := NewRocksDB(d.path, 100000, -1, d.chainParser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = nd
+	is, err := d.LoadInternalState("btc-testnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInternalState(is)
+	if h := is.GetDBColumnFromHeight("heightAddresses"); h != 0 {
+		t.Errorf("GetDBColumnFromHeight(heightAddresses) = %v, want 0", h)
+	}
+	if err := checkColumn(d, cfHeightAddresses, []keyPair{
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser), "", nil},
+		keyPair{"000370d5" + dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser), "", nil},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testDuplicateTxidParser flags the transactions of the map as the duplicates of earlier transactions
+type testDuplicateTxidParser struct {
+	*testBitcoinParser
+	duplicates map[string]uint32
+}
+
+func (p *testDuplicateTxidParser) GetDuplicateTxids() map[string]uint32 {
+	return p.duplicates
+}
+
+func TestRocksDB_MigrateDuplicateTxids(t *testing.T) {
+	d := setupRocksDB(t, &testDuplicateTxidParser{
+		testBitcoinParser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+		duplicates:        map[string]uint32{dbtestdata.TxidB1T1: 225494},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	earlier, err := d.GetTxAddresses(dbtestdata.TxidB1T1)
+	if err != nil || earlier == nil {
+		t.Fatalf("GetTxAddresses() = %+v, %v", earlier, err)
+	}
+	// simulate a db of version 3, in which the duplicate in block 225494 overwrote the earlier transaction
+	repackOutpointsV3(t, d)
+	duplicate := *earlier
+	duplicate.Height = 225494
+	btxID, _ := d.chainParser.PackTxid(dbtestdata.TxidB1T1)
+	if err := d.db.PutCF(d.wo, d.cfh[cfTxAddresses], btxID, packTxAddresses(&duplicate, nil, make([]byte, maxPackedBigintBytes))); err != nil {
+		t.Fatal(err)
+	}
+	for i := range d.is.DbColumns {
+		d.is.DbColumns[i].Version = dbVersionV3
+	}
+	if err := d.storeState(d.is); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.LoadInternalState("btc-testnet"); err != nil {
+		t.Fatal(err)
+	}
+	// the lookup by txid returns the duplicate, the earlier transaction is restored under the txid
+	ta, err := d.GetTxAddresses(dbtestdata.TxidB1T1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ta, &duplicate) {
+		t.Errorf("GetTxAddresses() = %+v, want %+v", ta, &duplicate)
+	}
+	ta, err = d.getTxAddresses(btxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ta, earlier) {
+		t.Errorf("getTxAddresses() of the earlier transaction = %+v, want %+v", ta, earlier)
+	}
+	// the migration is not repeated on the migrated db
+	if err := d.migrateDuplicateTxids(); err != nil {
+		t.Fatal(err)
+	}
+	if ta, err = d.getTxAddresses(btxID); err != nil || ta == nil || ta.Height != 225493 {
+		t.Errorf("getTxAddresses() of the earlier transaction after repeated migration = %+v, %v", ta, err)
+	}
+}
+
+func Test_packScriptAnnotations_unpackScriptAnnotations(t *testing.T) {
+	data := map[int][]bchain.ScriptAnnotation{
+		3: {{Classifier: "vault", Type: "timelock", Fields: map[string]string{"key": "02ab", "delay": "144"}}},
+		0: {{Classifier: "vault", Type: "recovery"}},
+	}
+	want := "02" +
+		"00" + "01" + "057661756c74" + "087265636f76657279" + "00" +
+		"03" + "01" + "057661756c74" + "0874696d656c6f636b" + "02" + "0564656c6179" + "03313434" + "036b6579" + "0430326162"
+	b := packScriptAnnotations(data)
+	if h := hex.EncodeToString(b); h != want {
+		t.Errorf("packScriptAnnotations() = %v, want %v", h, want)
+	}
+	got, err := unpackScriptAnnotations(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("unpackScriptAnnotations() = %+v, want %+v", got, data)
+	}
+	if _, err := unpackScriptAnnotations(b[:len(b)-2]); err == nil {
+		t.Error("unpackScriptAnnotations() of truncated data, expected error")
+	}
+}
+
+func Test_txAddressesCache(t *testing.T) {
+	c := newTxAddressesCache(2)
+	c.add(map[string]*TxAddresses{"a": {Height: 1}, "b": {Height: 2}})
+	// access a so that b is the least recently used
+	if ta := c.get("a"); ta == nil || ta.Height != 1 {
+		t.Fatalf("get(a) = %+v", ta)
+	}
+	c.add(map[string]*TxAddresses{"c": {Height: 3}})
+	if ta := c.get("b"); ta != nil {
+		t.Errorf("get(b) = %+v, expected evicted", ta)
+	}
+	if ta := c.get("c"); ta == nil || ta.Height != 3 {
+		t.Errorf("get(c) = %+v", ta)
+	}
+	c.add(map[string]*TxAddresses{"a": {Height: 4}})
+	if ta := c.get("a"); ta == nil || ta.Height != 4 {
+		t.Errorf("get(a) = %+v, expected replaced value", ta)
+	}
+	if c.len() != 2 {
+		t.Errorf("len() = %v, want 2", c.len())
+	}
+	c.purge()
+	if c.len() != 0 || c.get("a") != nil {
+		t.Error("purge() did not remove the items")
+	}
+	// disabled cache
+	var n *txAddressesCache
+	n.add(map[string]*TxAddresses{"a": {Height: 1}})
+	if n.get("a") != nil {
+		t.Error("disabled cache returned value")
+	}
+}
+
+func TestRocksDB_Compaction(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	block1 := dbtestdata.GetTestUTXOBlock1(d.chainParser)
+	block2 := dbtestdata.GetTestUTXOBlock2(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	ranges := d.disconnectedHeightRanges(225494, 225494)
+	for _, r := range ranges {
+		if !bytes.Equal(r.start, packUint(225494)) && !bytes.Equal(r.start, append([]byte{feesBlockKeyPrefix}, packUint(225494)...)) {
+			t.Errorf("range %+v of column %v does not start at the disconnected height", r, cfNames[r.cf])
+		}
+	}
+	d.scheduleCompaction(ranges...)
+	d.waitForCompaction()
+	pending, last := d.is.GetCompactionState()
+	if pending != 0 || last.IsZero() {
+		t.Errorf("GetCompactionState() = %v, %v, want 0 pending and the time of the last compaction", pending, last)
+	}
+	if len(d.compaction.queue) != 0 {
+		t.Errorf("compaction queue = %+v, want empty", d.compaction.queue)
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225493 || hash != "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997" {
+		t.Errorf("GetBestBlock() = %v, %v, want 225493 and the hash of block 1", height, hash)
+	}
+
+	// pruning of the blockTxs column triggers the compaction after compactionPrunedBlocks blocks
+	d.prunedBlockTxs(compactionPrunedBlocks-1, 100)
+	if d.compaction.pruned != compactionPrunedBlocks-1 {
+		t.Errorf("pruned = %v, want %v", d.compaction.pruned, compactionPrunedBlocks-1)
+	}
+	d.prunedBlockTxs(1, 101)
+	d.waitForCompaction()
+	if d.compaction.pruned != 0 {
+		t.Errorf("pruned = %v, want 0", d.compaction.pruned)
+	}
+	if pending, _ = d.is.GetCompactionState(); pending != 0 {
+		t.Errorf("GetCompactionState() = %v pending, want 0", pending)
+	}
+}
+
+func TestRocksDB_CoinControl(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	ccs := []CoinControl{
+		{Txid: dbtestdata.TxidB2T2, Vout: 0, Label: "savings", Frozen: true},
+		{Txid: dbtestdata.TxidB1T1, Vout: 300, Label: "exchange"},
+	}
+	if err := d.SetCoinControl("wallet", ccs); err != nil {
+		t.Fatal(err)
+	}
+	// the wallet "w" is a prefix of "wallet" in string but not in the packed key
+	if err := d.SetCoinControl("w", []CoinControl{{Txid: dbtestdata.TxidB2T1, Vout: 1, Frozen: true}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetCoinControl("wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CoinControl{ccs[1], ccs[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetCoinControl() = %+v, want %+v", got, want)
+	}
+
+	// output without label which is not frozen is removed
+	if err := d.SetCoinControl("wallet", []CoinControl{{Txid: dbtestdata.TxidB1T1, Vout: 300}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = d.GetCoinControl("wallet"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ccs[:1]) {
+		t.Errorf("GetCoinControl() = %+v, want %+v", got, ccs[:1])
+	}
+	if got, err = d.GetCoinControl("other"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetCoinControl(other) = %+v, want empty", got)
+	}
+}
+
+func TestRocksDB_IndexedSupply(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetBlockSupply(true)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	connected := &IndexedSupply{FromHeight: 225493, ToHeight: 225494, Blocks: 2}
+	connected.OutputsSat.SetInt64(2787879804798)
+	connected.InputsSat.SetInt64(1551851863406)
+	want := connected
+	got, err := d.GetIndexedSupply(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIndexedSupply(225494) = %+v, want %+v", got, want)
+	}
+	if got, err = d.GetIndexedSupply(225492); err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("GetIndexedSupply(225492) = %+v, want nil", got)
+	}
+
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	want = &IndexedSupply{FromHeight: 225493, ToHeight: 225493, Blocks: 1}
+	want.OutputsSat.SetInt64(1234667912345)
+	if got, err = d.GetIndexedSupply(225494); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIndexedSupply() after disconnect = %+v, want %+v", got, want)
+	}
+
+	// the totals of the reconnected block continue from the record of the previous block in the db
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = d.GetIndexedSupply(225494); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, connected) {
+		t.Errorf("GetIndexedSupply() after reconnect = %+v, want %+v", got, connected)
+	}
+}
+
+func TestRocksDB_SilentPayments(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	tweak := make([]byte, silentPaymentTweakLen)
+	tweak[31] = 1
+	sps := []SilentPayment{
+		{Wallet: "wallet", Height: 225493, Txid: dbtestdata.TxidB1T1, Vout: 0, Tweak: tweak},
+		{Wallet: "wallet", Height: 225494, Txid: dbtestdata.TxidB2T1, Vout: 1, K: 1, Tweak: tweak},
+		// the wallet "w" is a prefix of "wallet" in string but not in the packed key
+		{Wallet: "w", Height: 225494, Txid: dbtestdata.TxidB2T2, Vout: 0, Tweak: tweak},
+	}
+	for i := range sps {
+		sp := &sps[i]
+		sp.ValueSat.SetInt64(int64(1000 * (i + 1)))
+		btxID, err := d.chainParser.PackTxid(sp.Txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := silentPaymentOutput{match: bchain.SilentPaymentMatch{K: sp.K, Tweak: sp.Tweak}, value: sp.ValueSat}
+		if err = d.db.PutCF(d.wo, d.cfh[cfSilentPayments], d.packSilentPaymentKey(sp.Wallet, sp.Height, btxID, sp.Vout), packSilentPayment(&o)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := d.GetSilentPayments("wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sps[:2]) {
+		t.Errorf("GetSilentPayments() = %+v, want %+v", got, sps[:2])
+	}
+
+	// the outputs of all wallets in the disconnected blocks are removed
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = d.GetSilentPayments("wallet"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sps[:1]) {
+		t.Errorf("GetSilentPayments() after disconnect = %+v, want %+v", got, sps[:1])
+	}
+	if got, err = d.GetSilentPayments("w"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetSilentPayments(w) after disconnect = %+v, want empty", got)
+	}
+}
+
+// testNameParser reports the outputs paying to Addr3 and Addr7 as the operations of the name d/test
+type testNameParser struct {
+	*testBitcoinParser
+}
+
+func (p *testNameParser) GetNameOperation(addrDesc bchain.AddressDescriptor) (*bchain.NameOperation, error) {
+	switch {
+	case bytes.Equal(addrDesc, addressToAddrDesc(dbtestdata.Addr3, p)):
+		return &bchain.NameOperation{Op: bchain.NameOpFirstUpdate, Name: []byte("d/test"), Value: []byte("1"), Owner: addrDesc}, nil
+	case bytes.Equal(addrDesc, addressToAddrDesc(dbtestdata.Addr7, p)):
+		return &bchain.NameOperation{Op: bchain.NameOpUpdate, Name: []byte("d/test"), Value: []byte("2"), Owner: addrDesc}, nil
+	}
+	return nil, nil
+}
+
+func TestRocksDB_NameOps(t *testing.T) {
+	d := setupRocksDB(t, &testNameParser{
+		testBitcoinParser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	want := []NameRecord{
+		{
+			Name:   []byte("d/test"),
+			Height: 225493,
+			Txid:   dbtestdata.TxidB1T2,
+			Vout:   0,
+			Op:     bchain.NameOpFirstUpdate,
+			Value:  []byte("1"),
+			Owner:  addressToAddrDesc(dbtestdata.Addr3, d.chainParser),
+		},
+		{
+			Name:   []byte("d/test"),
+			Height: 225494,
+			Txid:   dbtestdata.TxidB2T1,
+			Vout:   1,
+			Op:     bchain.NameOpUpdate,
+			Value:  []byte("2"),
+			Owner:  addressToAddrDesc(dbtestdata.Addr7, d.chainParser),
+		},
+	}
+	got, err := d.GetNameHistory([]byte("d/test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetNameHistory() = %+v, want %+v", got, want)
+	}
+	if got, err = d.GetNameHistory([]byte("d/tes")); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetNameHistory(d/tes) = %+v, want empty", got)
+	}
+
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = d.GetNameHistory([]byte("d/test")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("GetNameHistory() after disconnect = %+v, want %+v", got, want[:1])
+	}
+}
+
+// testPaymentIDParser attaches the payment id inv-1 to the outputs paying to Addr3 and Addr5 and inv-2 to the outputs paying to Addr7
+type testPaymentIDParser struct {
+	*testBitcoinParser
+}
+
+func (p *testPaymentIDParser) GetOutputMemo(addrDesc bchain.AddressDescriptor) (*bchain.OutputMemo, error) {
+	switch {
+	case bytes.Equal(addrDesc, addressToAddrDesc(dbtestdata.Addr3, p)), bytes.Equal(addrDesc, addressToAddrDesc(dbtestdata.Addr5, p)):
+		return &bchain.OutputMemo{PaymentID: []byte("inv-1")}, nil
+	case bytes.Equal(addrDesc, addressToAddrDesc(dbtestdata.Addr7, p)):
+		return &bchain.OutputMemo{Memo: "invoice 2", PaymentID: []byte("inv-2")}, nil
+	}
+	return nil, nil
+}
+
+func TestRocksDB_PaymentIDs(t *testing.T) {
+	d := setupRocksDB(t, &testPaymentIDParser{
+		testBitcoinParser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetPaymentIDs(true)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	want := []PaymentIDTx{
+		{PaymentID: []byte("inv-1"), Height: 225493, Txid: dbtestdata.TxidB1T2, Vouts: []uint32{0, 2}},
+		{PaymentID: []byte("inv-1"), Height: 225494, Txid: dbtestdata.TxidB2T3, Vouts: []uint32{0}},
+	}
+	got, err := d.GetPaymentIDTxs([]byte("inv-1"), 0, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetPaymentIDTxs(inv-1) = %+v, want %+v", got, want)
+	}
+	// the pages starting by the height and by the txid
+	for _, p := range []struct {
+		height uint32
+		txid   string
+		limit  int
+		want   []PaymentIDTx
+	}{
+		{0, "", 1, want[:1]},
+		{225494, "", 1, want[1:]},
+		{225493, dbtestdata.TxidB1T2, 2, want},
+		{225494, dbtestdata.TxidB2T3, 2, want[1:]},
+	} {
+		got, err := d.GetPaymentIDTxs([]byte("inv-1"), p.height, p.txid, p.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, p.want) {
+			t.Errorf("GetPaymentIDTxs(inv-1, %v, %v, %v) = %+v, want %+v", p.height, p.txid, p.limit, got, p.want)
+		}
+	}
+	if got, err = d.GetPaymentIDTxs([]byte("inv-2"), 0, "", 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Txid != dbtestdata.TxidB2T1 || !reflect.DeepEqual(got[0].Vouts, []uint32{1}) {
+		t.Errorf("GetPaymentIDTxs(inv-2) = %+v", got)
+	}
+	if got, err = d.GetPaymentIDTxs([]byte("inv"), 0, "", 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetPaymentIDTxs(inv) = %+v, want empty", got)
+	}
+
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = d.GetPaymentIDTxs([]byte("inv-1"), 0, "", 100); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("GetPaymentIDTxs(inv-1) after disconnect = %+v, want %+v", got, want[:1])
+	}
+	if got, err = d.GetPaymentIDTxs([]byte("inv-2"), 0, "", 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetPaymentIDTxs(inv-2) after disconnect = %+v, want empty", got)
+	}
+}
+
+// testBurnsParser treats the outputs to Addr1 as unspendable
+type testBurnsParser struct {
+	*testBitcoinParser
+}
+
+func (p *testBurnsParser) IsAddrDescUnspendable(addrDesc bchain.AddressDescriptor) bool {
+	return bytes.Equal(addrDesc, addressToAddrDesc(dbtestdata.Addr1, p))
+}
+
+func TestRocksDB_Burns(t *testing.T) {
+	d := setupRocksDB(t, &testBurnsParser{
+		testBitcoinParser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	addr5 := addressToAddrDesc(dbtestdata.Addr5, d.chainParser)
+	addr6 := addressToAddrDesc(dbtestdata.Addr6, d.chainParser)
+	d.SetBurns(true)
+	d.SetBurnAddresses([]bchain.AddressDescriptor{addr5, addr6})
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	want := &BurnTotals{
+		Outputs:     4,
+		Unspendable: BurnStats{Outputs: 1},
+		// ordered by the address descriptor, p2pkh Addr6 before p2sh Addr5
+		Addresses: []BurnStats{{AddrDesc: addr6, Outputs: 1}, {AddrDesc: addr5, Outputs: 2}},
+	}
+	want.BurnedSat.SetInt64(317383969937)
+	want.Unspendable.BurnedSat.SetInt64(100000000)
+	want.Addresses[0].BurnedSat.SetInt64(317283951061)
+	want.Addresses[1].BurnedSat.SetInt64(18876)
+	got, err := d.GetBurnTotals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBurnTotals() = %+v, want %+v", got, want)
+	}
+	bs, err := d.GetAddrDescBurns(addr5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bs, &want.Addresses[1]) {
+		t.Errorf("GetAddrDescBurns(Addr5) = %+v, want %+v", bs, want.Addresses[1])
+	}
+	if bs, err = d.GetAddrDescBurns(addressToAddrDesc(dbtestdata.Addr2, d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if bs != nil {
+		t.Errorf("GetAddrDescBurns(Addr2) = %+v, want nil", bs)
+	}
+	// the outputs of the transactions missing in txAddressesMap are parsed from the block
+	stored, err := d.getBlockBurns(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if burns := d.computeBlockBurns(dbtestdata.GetTestUTXOBlock2(d.chainParser), nil); !reflect.DeepEqual(burns, stored) {
+		t.Errorf("computeBlockBurns() without txAddresses = %+v, want %+v", burns, stored)
+	}
+
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	want = &BurnTotals{
+		Outputs:     2,
+		Unspendable: want.Unspendable,
+		Addresses:   []BurnStats{{AddrDesc: addr5, Outputs: 1}},
+	}
+	want.BurnedSat.SetInt64(100009876)
+	want.Addresses[0].BurnedSat.SetInt64(9876)
+	if got, err = d.GetBurnTotals(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetBurnTotals() after disconnect = %+v, want %+v", got, want)
+	}
+	if bs, err = d.GetAddrDescBurns(addr6); err != nil {
+		t.Fatal(err)
+	}
+	if bs != nil {
+		t.Errorf("GetAddrDescBurns(Addr6) after disconnect = %+v, want nil", bs)
+	}
+	if burns, err := d.getBlockBurns(225494); err != nil || burns != nil {
+		t.Errorf("getBlockBurns(225494) after disconnect = %+v, %v, want nil", burns, err)
+	}
+	d.SetBurns(false)
+	if burns := d.computeBlockBurns(dbtestdata.GetTestUTXOBlock2(d.chainParser), nil); burns != nil {
+		t.Errorf("computeBlockBurns() with the burns disabled = %+v, want nil", burns)
+	}
+}
+
+func TestRocksDB_HoldingStats(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetHoldingStats(true)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	addr2 := addressToAddrDesc(dbtestdata.Addr2, d.chainParser)
+	// the output of block 225493 spent in block 225494, 1102 seconds later
+	want := &HoldingStats{Outputs: 1, HeldSeconds: 1102}
+	want.ValueSat.SetInt64(12345)
+	want.CoinSeconds.SetInt64(12345 * 1102)
+	hs, err := d.GetAddrDescHoldingStats(addr2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hs, want) {
+		t.Errorf("GetAddrDescHoldingStats(Addr2) = %+v, want %+v", hs, want)
+	}
+	// the output spent in the same block is held for zero seconds
+	want = &HoldingStats{Outputs: 1}
+	want.ValueSat.SetInt64(317283951061)
+	if hs, err = d.GetAddrDescHoldingStats(addressToAddrDesc(dbtestdata.Addr6, d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hs, want) {
+		t.Errorf("GetAddrDescHoldingStats(Addr6) = %+v, want %+v", hs, want)
+	}
+	// unspent output
+	if hs, err = d.GetAddrDescHoldingStats(addressToAddrDesc(dbtestdata.Addr7, d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if hs != nil {
+		t.Errorf("GetAddrDescHoldingStats(Addr7) = %+v, want nil", hs)
+	}
+
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if hs, err = d.GetAddrDescHoldingStats(addr2); err != nil {
+		t.Fatal(err)
+	}
+	if hs != nil {
+		t.Errorf("GetAddrDescHoldingStats(Addr2) after disconnect = %+v, want nil", hs)
+	}
+}
+
+func TestRocksDB_LargestTxs(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetLargestTxs(true)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	type tx struct {
+		txid   string
+		height uint32
+		value  int64
+	}
+	check := func(name string, window uint32, n int, want []tx) {
+		got, err := d.GetLargestTxs(window, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := make([]tx, len(got))
+		for i := range got {
+			g[i] = tx{got[i].Txid, got[i].Height, got[i].ValueSat.Int64()}
+		}
+		if !reflect.DeepEqual(g, want) {
+			t.Errorf("%v: GetLargestTxs(%v, %v) = %+v, want %+v", name, window, n, g, want)
+		}
+	}
+	check("two blocks", 2, 3, []tx{
+		{dbtestdata.TxidB2T1, 225494, 1234567902122},
+		{dbtestdata.TxidB1T2, 225493, 1234567900000},
+		{dbtestdata.TxidB2T2, 225494, 317283951000},
+	})
+	// the coinbase transaction is not included
+	check("last block", 1, 10, []tx{
+		{dbtestdata.TxidB2T1, 225494, 1234567902122},
+		{dbtestdata.TxidB2T2, 225494, 317283951000},
+		{dbtestdata.TxidB2T3, 225494, 9000},
+	})
+
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	check("after disconnect", 2, 10, []tx{
+		{dbtestdata.TxidB1T2, 225493, 1234567900000},
+		{dbtestdata.TxidB1T1, 225493, 100012345},
+	})
+
+	// the block connected with the largest transactions disabled is not recorded
+	d.SetLargestTxs(false)
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	check("disabled", 2, 10, []tx{
+		{dbtestdata.TxidB1T2, 225493, 1234567900000},
+		{dbtestdata.TxidB1T1, 225493, 100012345},
+	})
+}
+
+// testOrdinalsParser reveals two inscriptions in the second input of TxidB2T1, the second one with the pointer to the sat 100
+type testOrdinalsParser struct {
+	*testBitcoinParser
+}
+
+func (p *testOrdinalsParser) GetInscriptions(tx *bchain.Tx) ([]bchain.InscriptionEnvelope, error) {
+	if tx.Txid != dbtestdata.TxidB2T1 {
+		return nil, nil
+	}
+	pointer := uint64(100)
+	return []bchain.InscriptionEnvelope{
+		{Index: 0, Input: 1, ContentType: "text/plain", ContentLength: 5},
+		{Index: 1, Input: 1, ContentType: "image/png", ContentLength: 1000, Pointer: &pointer},
+	}, nil
+}
+
+func TestRocksDB_Ordinals(t *testing.T) {
+	d := setupRocksDB(t, &testOrdinalsParser{
+		testBitcoinParser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetOrdinals(true)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	// the block spending the output of Addr8 holding the second inscription
+	txid3 := strings.Repeat("3a", 32)
+	block3 := &bchain.Block{
+		BlockHeader: bchain.BlockHeader{Height: 225495, Hash: strings.Repeat("3b", 32)},
+		Txs: []bchain.Tx{
+			{
+				Txid: txid3,
+				Vin:  []bchain.Vin{{Txid: dbtestdata.TxidB2T2, Vout: 0}},
+				Vout: []bchain.Vout{
+					{N: 0, ScriptPubKey: bchain.ScriptPubKey{Hex: dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser)}, ValueSat: *big.NewInt(50)},
+					{N: 1, ScriptPubKey: bchain.ScriptPubKey{Hex: dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser)}, ValueSat: *big.NewInt(118641975000)},
+				},
+			},
+		},
+	}
+	if err := d.ConnectBlock(block3); err != nil {
+		t.Fatal(err)
+	}
+	// the first inscription is on the first sat of the second input, i.e. after the sats of the output of Addr6
+	ins0 := Inscription{ID: dbtestdata.TxidB2T1 + "i0", Height: 225494, ContentType: "text/plain", ContentLength: 5,
+		Txid: dbtestdata.TxidB2T1, Vout: 1, Offset: 1234567890123 - 317283951061}
+	ins1 := Inscription{ID: dbtestdata.TxidB2T1 + "i1", Height: 225494, ContentType: "image/png", ContentLength: 1000,
+		Txid: txid3, Vout: 1, Offset: 50}
+	checkInscriptions := func(phase string, inscriptions []Inscription, addresses map[string][]Inscription) {
+		t.Helper()
+		for i := range inscriptions {
+			got, err := d.GetInscription(inscriptions[i].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, &inscriptions[i]) {
+				t.Errorf("%v: GetInscription(%v) = %+v, want %+v", phase, inscriptions[i].ID, got, inscriptions[i])
+			}
+		}
+		for a, want := range addresses {
+			got, err := d.GetAddrDescInscriptions(addressToAddrDesc(a, d.chainParser))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%v: GetAddrDescInscriptions(%v) = %+v, want %+v", phase, a, got, want)
+			}
+		}
+	}
+	checkInscriptions("connect", []Inscription{ins0, ins1}, map[string][]Inscription{
+		dbtestdata.Addr7: {ins0},
+		dbtestdata.Addr2: {ins1},
+		dbtestdata.Addr8: {},
+	})
+
+	// the inscription is returned to the spent output
+	if err := d.DisconnectBlockRangeUTXO(225495, 225495); err != nil {
+		t.Fatal(err)
+	}
+	ins1.Txid, ins1.Vout, ins1.Offset = dbtestdata.TxidB2T2, 0, 100
+	checkInscriptions("disconnect 225495", []Inscription{ins0, ins1}, map[string][]Inscription{
+		dbtestdata.Addr8: {ins1},
+		dbtestdata.Addr2: {},
+	})
+
+	// the inscription spent as the fee is moved to the coinbase after the subsidy of 5000 sats
+	coinbase3, txid3b := strings.Repeat("3c", 32), strings.Repeat("3d", 32)
+	fee := 118641975500 - 50
+	block3b := &bchain.Block{
+		BlockHeader: bchain.BlockHeader{Height: 225495, Hash: strings.Repeat("3e", 32)},
+		Txs: []bchain.Tx{
+			{
+				Txid: coinbase3,
+				Vin:  []bchain.Vin{{Coinbase: "03bf1e15"}},
+				Vout: []bchain.Vout{
+					{N: 0, ScriptPubKey: bchain.ScriptPubKey{Hex: dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser)}, ValueSat: *big.NewInt(5000)},
+					{N: 1, ScriptPubKey: bchain.ScriptPubKey{Hex: dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser)}, ValueSat: *big.NewInt(int64(fee))},
+				},
+			},
+			{
+				Txid: txid3b,
+				Vin:  []bchain.Vin{{Txid: dbtestdata.TxidB2T2, Vout: 0}},
+				Vout: []bchain.Vout{
+					{N: 0, ScriptPubKey: bchain.ScriptPubKey{Hex: dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser)}, ValueSat: *big.NewInt(50)},
+				},
+			},
+		},
+	}
+	if err := d.ConnectBlock(block3b); err != nil {
+		t.Fatal(err)
+	}
+	insFee := ins1
+	insFee.Txid, insFee.Vout, insFee.Offset = coinbase3, 1, 50
+	checkInscriptions("fee to coinbase", []Inscription{ins0, insFee}, map[string][]Inscription{
+		dbtestdata.Addr3: {insFee},
+		dbtestdata.Addr8: {},
+		dbtestdata.Addr2: {},
+	})
+	if err := d.DisconnectBlockRangeUTXO(225495, 225495); err != nil {
+		t.Fatal(err)
+	}
+	checkInscriptions("disconnect fee to coinbase", []Inscription{ins0, ins1}, map[string][]Inscription{
+		dbtestdata.Addr8: {ins1},
+		dbtestdata.Addr3: {},
+	})
+
+	// the inscriptions revealed in the disconnected block are removed
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{ins0.ID, ins1.ID} {
+		if got, err := d.GetInscription(id); err != nil || got != nil {
+			t.Errorf("GetInscription(%v) after disconnect = %+v, %v, want nil", id, got, err)
+		}
+	}
+	if got, err := d.GetOutputInscriptions(dbtestdata.TxidB2T1, 1); err != nil || len(got) != 0 {
+		t.Errorf("GetOutputInscriptions() after disconnect = %+v, %v, want empty", got, err)
+	}
+	if _, err := d.GetInscription(dbtestdata.TxidB2T1); err == nil {
+		t.Error("GetInscription() with invalid id expected error")
+	}
+}
+
+// testMultisigParser interprets the descriptor as a comma separated list of addresses, the index selects the address
+type testMultisigParser struct {
+	*testBitcoinParser
+}
+
+func (p *testMultisigParser) DeriveMultisigAddrDescs(descriptor string, from, to uint32) ([]bchain.AddressDescriptor, error) {
+	addrs := strings.Split(descriptor, ",")
+	var r []bchain.AddressDescriptor
+	for i := from; i < to && int(i) < len(addrs); i++ {
+		r = append(r, addressToAddrDesc(addrs[i], p))
+	}
+	return r, nil
+}
+
+func TestRocksDB_MultisigWallets(t *testing.T) {
+	d := setupRocksDB(t, &testMultisigParser{
+		testBitcoinParser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	var got []MultisigEvent
+	d.SetOnMultisigEvents(func(events []MultisigEvent) {
+		got = append(got, events...)
+	})
+	if err := d.RegisterMultisigWallet(&MultisigWallet{Name: "bad/name", Descriptors: []string{dbtestdata.Addr5}}); err == nil {
+		t.Error("RegisterMultisigWallet() expected error for invalid name")
+	}
+	// with the lookahead 1 the second address is derived only after the first one is used
+	wallet := MultisigWallet{
+		Name:        "vault",
+		Descriptors: []string{dbtestdata.Addr5 + "," + dbtestdata.Addr3},
+		Lookahead:   1,
+		Webhook:     "http://localhost/hook",
+	}
+	if err := d.RegisterMultisigWallet(&wallet); err != nil {
+		t.Fatal(err)
+	}
+	// the wallet registered without token gets a random token, the feed is public only with the token
+	if len(wallet.Token) != 32 || !d.ValidMultisigWalletToken("vault", wallet.Token) {
+		t.Errorf("generated token %q is not valid", wallet.Token)
+	}
+	if d.ValidMultisigWalletToken("vault", "") || d.ValidMultisigWalletToken("vault", "0123456789abcdef0123456789abcdef") || d.ValidMultisigWalletToken("cold", wallet.Token) {
+		t.Error("ValidMultisigWalletToken() accepted an invalid wallet or token")
+	}
+	if err := d.RegisterMultisigWallet(&MultisigWallet{Name: "short", Descriptors: []string{dbtestdata.Addr5}, Token: "abc"}); err == nil {
+		t.Error("RegisterMultisigWallet() expected error for short token")
+	}
+	addr3 := addressToAddrDesc(dbtestdata.Addr3, d.chainParser)
+	addr5 := addressToAddrDesc(dbtestdata.Addr5, d.chainParser)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	want := []MultisigEvent{
+		{Seq: multisigLiveSeq, Wallet: "vault", Type: MultisigEventFunding, Txid: dbtestdata.TxidB1T2, Address: dbtestdata.Addr5, Index: 0, Height: 225493, Time: 1534858021, Webhook: wallet.Webhook, Token: wallet.Token, AddrDesc: addr5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events after block 1 = %+v, want %+v", got, want)
+	}
+
+	got = nil
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	// the events of the block are ordered by the transactions in the block
+	want = []MultisigEvent{
+		{Seq: multisigLiveSeq + 1, Wallet: "vault", Type: MultisigEventSpend, Txid: dbtestdata.TxidB2T1, Address: dbtestdata.Addr3, Index: 1, Height: 225494, Time: 1534859123, Webhook: wallet.Webhook, Token: wallet.Token, AddrDesc: addr3},
+		{Seq: multisigLiveSeq + 2, Wallet: "vault", Type: MultisigEventFunding, Txid: dbtestdata.TxidB2T3, Address: dbtestdata.Addr5, Index: 0, Height: 225494, Time: 1534859123, Webhook: wallet.Webhook, Token: wallet.Token, AddrDesc: addr5},
+		{Seq: multisigLiveSeq + 3, Wallet: "vault", Type: MultisigEventSpend, Txid: dbtestdata.TxidB2T3, Address: dbtestdata.Addr5, Index: 0, Height: 225494, Time: 1534859123, Webhook: wallet.Webhook, Token: wallet.Token, AddrDesc: addr5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events after block 2 = %+v, want %+v", got, want)
+	}
+
+	// mempool transaction spending the wallet output
+	got = nil
+	d.OnNewTxAddr("mempooltx", addr3, false)
+	if len(got) != 1 || got[0].Seq != multisigLiveSeq+4 || got[0].Type != MultisigEventSpend || got[0].Height != 0 || got[0].Index != 1 {
+		t.Errorf("mempool events = %+v, want spend with seq %d", multisigLiveSeq+4, got)
+	}
+
+	// the feed is read from the db, webhook is not stored with the event
+	feed, err := d.GetMultisigEvents("vault", multisigLiveSeq+1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 2 || feed[0].Seq != multisigLiveSeq+1 || feed[1].Seq != multisigLiveSeq+2 || feed[0].Height != 225494 || feed[0].Webhook != "" {
+		t.Errorf("GetMultisigEvents(vault, 1, 2) = %+v", feed)
+	}
+	if feed, err = d.GetMultisigEvents("vault", multisigLiveSeq+4, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 1 || feed[0].Txid != "mempooltx" || feed[0].Address != dbtestdata.Addr3 {
+		t.Errorf("GetMultisigEvents(vault, 4, 100) = %+v", feed)
+	}
+
+	// the wallet and its usage must survive reload from the db
+	if err := d.loadMultisigWallets(); err != nil {
+		t.Fatal(err)
+	}
+	if ws := d.GetMultisigWallets(); !reflect.DeepEqual(ws, []MultisigWallet{wallet}) {
+		t.Errorf("GetMultisigWallets() = %+v, want %+v", ws, []MultisigWallet{wallet})
+	}
+	mw := d.multisig.wallets["vault"]
+	if mw.nextSeq != multisigLiveSeq+5 || !reflect.DeepEqual(mw.used, []uint32{2}) || len(d.multisig.addrs) != 2 {
+		t.Errorf("reloaded wallet nextSeq %d, used %v, addresses %d", mw.nextSeq, mw.used, len(d.multisig.addrs))
+	}
+
+	// the update without token keeps the token
+	update := MultisigWallet{Name: "vault", Descriptors: wallet.Descriptors, Lookahead: 1, Webhook: wallet.Webhook}
+	if err := d.RegisterMultisigWallet(&update); err != nil {
+		t.Fatal(err)
+	}
+	if update.Token != wallet.Token {
+		t.Errorf("token after update = %q, want %q", update.Token, wallet.Token)
+	}
+
+	// the events of the disconnected block stay in the feed marked as disconnected and are notified again
+	got = nil
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Errorf("events of disconnected block = %+v, want 3 events", got)
+	}
+	for i := range got {
+		if !got[i].Disconnected || got[i].Height != 225494 || got[i].Token != wallet.Token || got[i].Webhook != wallet.Webhook || got[i].Seq < multisigLiveSeq+1 || got[i].Seq > multisigLiveSeq+3 {
+			t.Errorf("event of disconnected block = %+v", got[i])
+		}
+	}
+	if feed, err = d.GetMultisigEvents("vault", 0, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 5 || feed[0].Disconnected || !feed[1].Disconnected || !feed[2].Disconnected || !feed[3].Disconnected || feed[4].Disconnected {
+		t.Errorf("GetMultisigEvents() after disconnect = %+v", feed)
+	}
+
+	removed, err := d.UnregisterMultisigWallet("vault")
+	if err != nil || !removed {
+		t.Fatalf("UnregisterMultisigWallet() = %v, %v", removed, err)
+	}
+	if feed, err = d.GetMultisigEvents("vault", 0, 100); err != nil || len(feed) != 0 {
+		t.Errorf("GetMultisigEvents() after unregister = %+v, %v", feed, err)
+	}
+	if len(d.multisig.addrs) != 0 {
+		t.Errorf("addresses after unregister = %d, want 0", len(d.multisig.addrs))
+	}
+}
+
+func TestRocksDB_MultisigWalletScan(t *testing.T) {
+	d := setupRocksDB(t, &testMultisigParser{
+		testBitcoinParser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	addr3 := addressToAddrDesc(dbtestdata.Addr3, d.chainParser)
+	addr5 := addressToAddrDesc(dbtestdata.Addr5, d.chainParser)
+	waitScan := func(name string) *MultisigScan {
+		for i := 0; i < 500; i++ {
+			if w := d.GetMultisigWallet(name); w != nil && w.Scan != nil && w.Scan.Done {
+				return w.Scan
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("scan of multisig wallet %v did not finish", name)
+		return nil
+	}
+	// the order of the events of a block is not defined
+	sortEvents := func(events []MultisigEvent) {
+		sort.Slice(events, func(i, j int) bool {
+			if events[i].Height != events[j].Height {
+				return events[i].Height < events[j].Height
+			}
+			if events[i].Address != events[j].Address {
+				return events[i].Address < events[j].Address
+			}
+			return events[i].Type < events[j].Type
+		})
+	}
+	feed := func(name string) []MultisigEvent {
+		events, err := d.GetMultisigEvents(name, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sortEvents(events)
+		for i := range events {
+			events[i].Seq = 0
+		}
+		return events
+	}
+
+	if err := d.RegisterMultisigWallet(&MultisigWallet{Name: "both", Descriptors: []string{dbtestdata.Addr5}, Birthday: 1, BirthdayTime: 1}); err == nil {
+		t.Error("RegisterMultisigWallet() expected error for both birthday and birthdayTime")
+	}
+	// only the second block is scanned, the second address is derived when the first one is found used in the scanned block
+	if err := d.RegisterMultisigWallet(&MultisigWallet{Name: "vault", Descriptors: []string{dbtestdata.Addr5 + "," + dbtestdata.Addr3}, Lookahead: 1, Birthday: 225494}); err != nil {
+		t.Fatal(err)
+	}
+	scan := waitScan("vault")
+	if want := (MultisigScan{FromHeight: 225494, ToHeight: 225494, ScannedHeight: 225494, Done: true, Progress: 1}); *scan != want {
+		t.Errorf("scan of vault = %+v, want %+v", *scan, want)
+	}
+	want := []MultisigEvent{
+		{Wallet: "vault", Type: MultisigEventSpend, Txid: dbtestdata.TxidB2T1, Address: dbtestdata.Addr3, Index: 1, Height: 225494, Time: 1534859123, AddrDesc: addr3},
+		{Wallet: "vault", Type: MultisigEventFunding, Txid: dbtestdata.TxidB2T3, Address: dbtestdata.Addr5, Index: 0, Height: 225494, Time: 1534859123, AddrDesc: addr5},
+		{Wallet: "vault", Type: MultisigEventSpend, Txid: dbtestdata.TxidB2T3, Address: dbtestdata.Addr5, Index: 0, Height: 225494, Time: 1534859123, AddrDesc: addr5},
+	}
+	sortEvents(want)
+	if got := feed("vault"); !reflect.DeepEqual(got, want) {
+		t.Errorf("feed of vault = %+v, want %+v", got, want)
+	}
+
+	// the birthday time is converted to the first block not older than 2 hours before the time
+	w := MultisigWallet{Name: "old", Descriptors: []string{dbtestdata.Addr5}, BirthdayTime: 1534858021 + 3600}
+	if err := d.RegisterMultisigWallet(&w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Birthday != 225493 || w.BirthdayTime != 0 {
+		t.Errorf("birthday of old = %v, birthdayTime %v, want 225493, 0", w.Birthday, w.BirthdayTime)
+	}
+	waitScan("old")
+	want = []MultisigEvent{
+		{Wallet: "old", Type: MultisigEventFunding, Txid: dbtestdata.TxidB1T2, Address: dbtestdata.Addr5, Index: 0, Height: 225493, Time: 1534858021, AddrDesc: addr5},
+		{Wallet: "old", Type: MultisigEventFunding, Txid: dbtestdata.TxidB2T3, Address: dbtestdata.Addr5, Index: 0, Height: 225494, Time: 1534859123, AddrDesc: addr5},
+		{Wallet: "old", Type: MultisigEventSpend, Txid: dbtestdata.TxidB2T3, Address: dbtestdata.Addr5, Index: 0, Height: 225494, Time: 1534859123, AddrDesc: addr5},
+	}
+	sortEvents(want)
+	if got := feed("old"); !reflect.DeepEqual(got, want) {
+		t.Errorf("feed of old = %+v, want %+v", got, want)
+	}
+
+	// the scan state survives reload from the db and the finished scan is not repeated
+	if err := d.loadMultisigWallets(); err != nil {
+		t.Fatal(err)
+	}
+	mw := d.multisig.wallets["vault"]
+	if mw.Birthday != 225494 || mw.scanned != 225494 || mw.scanTo != 225494 || !reflect.DeepEqual(mw.used, []uint32{2}) {
+		t.Errorf("reloaded vault birthday %d, scanned %d, scanTo %d, used %v", mw.Birthday, mw.scanned, mw.scanTo, mw.used)
+	}
+	if d.nextMultisigScan() != nil {
+		t.Error("nextMultisigScan() returned a wallet with finished scan")
+	}
+
+	// the scan ends before the disconnected block, the block connected instead of it is checked by the connect
+	if err := d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if mw = d.multisig.wallets["vault"]; mw.scanned != 225493 || mw.scanTo != 225493 {
+		t.Errorf("vault after disconnect scanned %d, scanTo %d, want 225493, 225493", mw.scanned, mw.scanTo)
+	}
+	if mw = d.multisig.wallets["old"]; mw.scanned != 225493 || mw.scanTo != 225493 {
+		t.Errorf("old after disconnect scanned %d, scanTo %d, want 225493, 225493", mw.scanned, mw.scanTo)
+	}
+	if d.nextMultisigScan() != nil {
+		t.Error("nextMultisigScan() returned a wallet after disconnect")
+	}
+
+	// the address derived by the scan is scanned up to the best block, the connect checked the block 2 without it;
+	// the scan is run directly, as if the wallet was registered before the block 2 was connected
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	d.multisig.mux.Lock()
+	d.multisig.scanStop = make(chan struct{})
+	d.multisig.mux.Unlock()
+	if err := d.RegisterMultisigWallet(&MultisigWallet{Name: "late", Descriptors: []string{dbtestdata.Addr5 + "," + dbtestdata.Addr3}, Lookahead: 1, Birthday: 225493}); err != nil {
+		t.Fatal(err)
+	}
+	d.multisig.mux.Lock()
+	mw = d.multisig.wallets["late"]
+	mw.scanTo = 225493
+	d.multisig.mux.Unlock()
+	if err := d.scanMultisigWallet(mw, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	// the history is ordered by the height before the live events
+	want = []MultisigEvent{
+		{Seq: 225493 << multisigHistorySeqBits, Wallet: "late", Type: MultisigEventFunding, Txid: dbtestdata.TxidB1T2, Address: dbtestdata.Addr5, Index: 0, Height: 225493, Time: 1534858021, AddrDesc: addr5},
+		{Seq: 225493<<multisigHistorySeqBits + 1, Wallet: "late", Type: MultisigEventFunding, Txid: dbtestdata.TxidB1T2, Address: dbtestdata.Addr3, Index: 1, Height: 225493, Time: 1534858021, AddrDesc: addr3},
+		{Seq: 225494 << multisigHistorySeqBits, Wallet: "late", Type: MultisigEventSpend, Txid: dbtestdata.TxidB2T1, Address: dbtestdata.Addr3, Index: 1, Height: 225494, Time: 1534859123, AddrDesc: addr3},
+	}
+	events, err := d.GetMultisigEvents("late", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("feed of late = %+v, want %+v", events, want)
+	}
+	// the interrupted scan repeated from the frontier does not duplicate the events
+	d.multisig.mux.Lock()
+	mw.scanned = 225492
+	d.multisig.mux.Unlock()
+	if err := d.scanMultisigWallet(mw, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = d.GetMultisigEvents("late", 0, 100); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("feed of late after repeated scan = %+v, want %+v", events, want)
+	}
+}
+
+func TestRocksDB_GetAddrDescHeightTransactionsReverse(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	type heightTxids struct {
+		height uint32
+		txids  []string
+	}
+	get := func(addr string, lower, higher uint32, stop bool) []heightTxids {
+		var r []heightTxids
+		err := d.GetAddrDescHeightTransactionsReverse(addressToAddrDesc(addr, d.chainParser), lower, higher, func(height uint32, txids []string) error {
+			r = append(r, heightTxids{height, txids})
+			if stop {
+				return &StopIteration{}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	tests := []struct {
+		name          string
+		addr          string
+		lower, higher uint32
+		stop          bool
+		want          []heightTxids
+	}{
+		{
+			name:   "all",
+			addr:   dbtestdata.Addr5,
+			higher: ^uint32(0),
+			want:   []heightTxids{{225494, []string{dbtestdata.TxidB2T3}}, {225493, []string{dbtestdata.TxidB1T2}}},
+		},
+		{
+			name:   "stop",
+			addr:   dbtestdata.Addr5,
+			higher: ^uint32(0),
+			stop:   true,
+			want:   []heightTxids{{225494, []string{dbtestdata.TxidB2T3}}},
+		},
+		{
+			name:   "higher",
+			addr:   dbtestdata.Addr3,
+			higher: 225493,
+			want:   []heightTxids{{225493, []string{dbtestdata.TxidB1T2}}},
+		},
+		{
+			name:   "lower",
+			addr:   dbtestdata.Addr3,
+			lower:  225494,
+			higher: ^uint32(0),
+			want:   []heightTxids{{225494, []string{dbtestdata.TxidB2T1}}},
+		},
+		{
+			name:   "none",
+			addr:   dbtestdata.Addr3,
+			higher: 225492,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(tt.addr, tt.lower, tt.higher, tt.stop); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAddrDescHeightTransactionsReverse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRocksDB_GetAddrDescsHeightTransactionsReverse(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	type heightTxs struct {
+		height uint32
+		txs    []AddressGroupTx
+	}
+	get := func(addrs []string, lower, higher uint32, stop bool) []heightTxs {
+		addrDescs := make([]bchain.AddressDescriptor, len(addrs))
+		for i, a := range addrs {
+			addrDescs[i] = addressToAddrDesc(a, d.chainParser)
+		}
+		var r []heightTxs
+		err := d.GetAddrDescsHeightTransactionsReverse(addrDescs, lower, higher, func(height uint32, txs []AddressGroupTx) error {
+			r = append(r, heightTxs{height, txs})
+			if stop {
+				return &StopIteration{}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	tests := []struct {
+		name          string
+		addrs         []string
+		lower, higher uint32
+		stop          bool
+		want          []heightTxs
+	}{
+		{
+			name:   "merged",
+			addrs:  []string{dbtestdata.Addr5, dbtestdata.Addr4, dbtestdata.Addr3},
+			higher: ^uint32(0),
+			want: []heightTxs{
+				{225494, []AddressGroupTx{{dbtestdata.TxidB2T3, true, true}, {dbtestdata.TxidB2T2, true, false}, {dbtestdata.TxidB2T1, true, false}}},
+				{225493, []AddressGroupTx{{dbtestdata.TxidB1T2, false, true}}},
+			},
+		},
+		{
+			name:   "stop",
+			addrs:  []string{dbtestdata.Addr1, dbtestdata.Addr5},
+			higher: ^uint32(0),
+			stop:   true,
+			want:   []heightTxs{{225494, []AddressGroupTx{{dbtestdata.TxidB2T3, true, true}}}},
+		},
+		{
+			name:   "range",
+			addrs:  []string{dbtestdata.Addr1, dbtestdata.Addr2, dbtestdata.Addr6},
+			higher: 225493,
+			want:   []heightTxs{{225493, []AddressGroupTx{{dbtestdata.TxidB1T1, false, true}}}},
+		},
+		{
+			name:   "none",
+			addrs:  []string{dbtestdata.Addr6, dbtestdata.Addr3},
+			higher: 225492,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(tt.addrs, tt.lower, tt.higher, tt.stop); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAddrDescsHeightTransactionsReverse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRocksDB_GetAddrDescTransactionsReverse(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	type txOutpoint struct {
+		txid     string
+		vout     uint32
+		isOutput bool
+	}
+	// the reverse iteration returns the outpoints of the forward iteration in the reverse order
+	for _, addr := range []string{dbtestdata.Addr3, dbtestdata.Addr5, dbtestdata.Addr6, dbtestdata.AddrA} {
+		addrDesc := addressToAddrDesc(addr, d.chainParser)
+		var forward, reverse []txOutpoint
+		if err := d.GetAddrDescTransactions(addrDesc, 0, ^uint32(0), func(txid string, vout uint32, isOutput bool) error {
+			forward = append([]txOutpoint{{txid, vout, isOutput}}, forward...)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.GetAddrDescTransactionsReverse(addrDesc, 0, ^uint32(0), func(txid string, vout uint32, isOutput bool) error {
+			reverse = append(reverse, txOutpoint{txid, vout, isOutput})
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(forward) == 0 || !reflect.DeepEqual(reverse, forward) {
+			t.Errorf("%v: GetAddrDescTransactionsReverse() = %+v, want %+v", addr, reverse, forward)
+		}
+	}
+	// the iteration is limited by the heights and stopped by the callback
+	var got []string
+	if err := d.GetAddrDescTransactionsReverse(addressToAddrDesc(dbtestdata.Addr5, d.chainParser), 0, 225493, func(txid string, vout uint32, isOutput bool) error {
+		got = append(got, txid)
+		return &StopIteration{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{dbtestdata.TxidB1T2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAddrDescTransactionsReverse() to height 225493 = %v, want %v", got, want)
+	}
+}
+
+func TestRocksDB_DiffIndex(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	o := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, o)
+
+	for _, idx := range []*RocksDB{d, o} {
+		if err := idx.ConnectBlock(dbtestdata.GetTestUTXOBlock1(idx.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.ConnectBlock(dbtestdata.GetTestUTXOBlock2(idx.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diff := func(balances bool) []IndexDiff {
+		var r []IndexDiff
+		if err := d.DiffIndex(o, 225493, 225494, balances, func(diff *IndexDiff) error {
+			r = append(r, *diff)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	if got := diff(true); len(got) != 0 {
+		t.Errorf("DiffIndex() of equal dbs = %+v, want empty", got)
+	}
+
+	// remove the history and the balance of Addr3 from the second db
+	addrDesc := addressToAddrDesc(dbtestdata.Addr3, d.chainParser)
+	if err := o.db.DeleteCF(o.wo, o.cfh[cfAddresses], packAddressKey(addrDesc, 225493)); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.db.DeleteCF(o.wo, o.cfh[cfAddressBalance], addrDesc); err != nil {
+		t.Fatal(err)
+	}
+	ab, err := d.GetAddrDescBalance(addrDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := IndexDiff{Height: 225493, Kind: DiffHistory, Key: dbtestdata.Addr3, A: dbtestdata.TxidB1T2 + ":out0"}
+	want := []IndexDiff{
+		history,
+		{Height: 225493, Kind: DiffBalance, Key: dbtestdata.Addr3, A: describeAddrBalance(ab)},
+	}
+	if got := diff(true); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffIndex() = %+v, want %+v", got, want)
+	}
+	if got := diff(false); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("DiffIndex() without balances = %+v, want %+v", got, want[:1])
+	}
+	// the iteration is stopped by StopIteration
+	var got []IndexDiff
+	if err := d.DiffIndex(o, 225493, 225494, true, func(diff *IndexDiff) error {
+		got = append(got, *diff)
+		return &StopIteration{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("DiffIndex() stopped = %+v, want %+v", got, want[:1])
+	}
+}
+
+func TestRocksDB_DiffIndexDataVersion(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	o := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, o)
+
+	for _, idx := range []*RocksDB{d, o} {
+		if err := idx.ConnectBlock(dbtestdata.GetTestUTXOBlock1(idx.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.ConnectBlock(dbtestdata.GetTestUTXOBlock2(idx.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// repack the addresses column of the second db to the format of version 3
+	repackOutpointsV3(t, o)
+	for i := range o.is.DbColumns {
+		o.is.DbColumns[i].Version = dbVersionV3
+	}
+	if err := o.storeState(o.is); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.loadDataVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if v := o.DataVersion(); v != dbVersionV3 {
+		t.Errorf("DataVersion() = %v, want %v", v, dbVersionV3)
+	}
+	if v := d.DataVersion(); v != dbVersion {
+		t.Errorf("DataVersion() = %v, want %v", v, dbVersion)
+	}
+	// each db is read in the format of its version
+	var got []IndexDiff
+	if err := d.DiffIndex(o, 225493, 225494, true, func(diff *IndexDiff) error {
+		got = append(got, *diff)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("DiffIndex() of the dbs of versions %v and %v = %+v, want empty", dbVersion, dbVersionV3, got)
+	}
+}
+
+func TestRocksDB_DiffBackend(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	chain, err := dbtestdata.NewFakeBlockChain(d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	var got []IndexDiff
+	if err := d.DiffBackend(chain, 225493, 225494, func(diff *IndexDiff) error {
+		got = append(got, *diff)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	b2 := dbtestdata.GetTestUTXOBlock2(d.chainParser)
+	want := []IndexDiff{{Height: 225494, Kind: DiffBlock, Key: b2.Hash, B: "hash " + b2.Hash}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffBackend() = %+v, want %+v", got, want)
+	}
+
+	if err := d.ConnectBlock(b2); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := d.DiffBackend(chain, 225493, 225494, func(diff *IndexDiff) error {
+		got = append(got, *diff)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("DiffBackend() of synchronized db = %+v, want empty", got)
+	}
+}
+
+// sameBalance compares the balances by value, the zero big ints may differ in the internal representation
+func sameBalance(a, b *AddrBalance) bool {
+	return a != nil && b != nil && a.Txs == b.Txs && a.BalanceSat.Cmp(&b.BalanceSat) == 0 && a.SentSat.Cmp(&b.SentSat) == 0 && a.Nonce == b.Nonce
+}
+
+func TestRocksDB_AmountAnomalies(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	addr2 := addressToAddrDesc(dbtestdata.Addr2, d.chainParser)
+	addr3 := addressToAddrDesc(dbtestdata.Addr3, d.chainParser)
+	storeBalance := func(addrDesc bchain.AddressDescriptor, ab *AddrBalance) {
+		wb := gorocksdb.NewWriteBatch()
+		defer wb.Destroy()
+		if err := d.storeBalances(wb, map[string]*AddrBalance{string(addrDesc): ab}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.db.Write(d.wo, wb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	// lose the balance of Addr2, the spend of its output in the block 2 makes the balance negative
+	storeBalance(addr2, &AddrBalance{Txs: 1})
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	want := []AmountAnomaly{{AddrDesc: addr2, Kind: AmountAnomalyNegativeBalance, Count: 1, FirstHeight: 225494, LastHeight: 225494}}
+	want[0].ValueSat.Neg(dbtestdata.SatB1T1A2)
+	got, err := d.GetAmountAnomalies(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAmountAnomalies(nil) = %+v, want %+v", got, want)
+	}
+	if got, err = d.GetAmountAnomalies(addr3); err != nil || len(got) != 0 {
+		t.Errorf("GetAmountAnomalies(Addr3) = %+v, %v, want none", got, err)
+	}
+
+	r, err := d.RecomputeAddrDescBalance(addr2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the balance reset to zero is the right one, the sent amount is kept by the reset
+	if r.Changed || r.Unresolved || r.New.Txs != 2 || r.New.BalanceSat.Sign() != 0 || r.New.SentSat.Cmp(dbtestdata.SatB1T1A2) != 0 {
+		t.Errorf("RecomputeAddrDescBalance(Addr2) = %+v", r)
+	}
+	if got, err = d.GetAmountAnomalies(nil); err != nil || len(got) != 0 {
+		t.Errorf("GetAmountAnomalies(nil) after recompute = %+v, %v, want none", got, err)
+	}
+
+	ab, err := d.GetAddrDescBalance(addr3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeBalance(addr3, &AddrBalance{Txs: 7, BalanceSat: *big.NewInt(5)})
+	if r, err = d.RecomputeAddrDescBalance(addr3); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Changed || r.Unresolved || !sameBalance(&r.New, ab) {
+		t.Errorf("RecomputeAddrDescBalance(Addr3) = %+v, want balance %+v", r, ab)
+	}
+	if got, err := d.GetAddrDescBalance(addr3); err != nil || !sameBalance(got, ab) {
+		t.Errorf("GetAddrDescBalance(Addr3) after recompute = %+v, %v, want %+v", got, err, ab)
+	}
+}
+
+func TestParseCachePartitions(t *testing.T) {
+	got, err := ParseCachePartitions("txAddresses=0.4, addressBalance=0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"txAddresses": 0.4, "addressBalance": 0.2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCachePartitions() = %v, want %v", got, want)
+	}
+	for _, s := range []string{"", "txAddresses", "unknown=0.1", "txAddresses=0", "txAddresses=x", "txAddresses=0.6,addressBalance=0.4", "txAddresses=0.1,txAddresses=0.2"} {
+		if _, err := ParseCachePartitions(s); err == nil {
+			t.Errorf("ParseCachePartitions(%q): expected error", s)
+		}
+	}
+}
+
+func TestRocksDB_CachePartitions(t *testing.T) {
+	SetCachePartitions(map[string]float64{"txAddresses": 0.5, "addresses": 0.25})
+	defer SetCachePartitions(nil)
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	for i, c := range d.cache.columns {
+		if own := i == cfTxAddresses || i == cfAddresses; own != (c != nil) {
+			t.Errorf("column %v: own cache %v", cfNames[i], c != nil)
+		}
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterUTXOBlock2(t, d)
+	if err := d.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterUTXOBlock2(t, d)
+}
+
+func TestRocksDB_TxAddressesRepair(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	block1 := dbtestdata.GetTestUTXOBlock1(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	// lose the txAddresses of the transaction spent by the block 2
+	btxID, err := d.chainParser.PackTxid(dbtestdata.TxidB1T1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.db.DeleteCF(d.wo, d.cfh[cfTxAddresses], btxID); err != nil {
+		t.Fatal(err)
+	}
+	var fetched []string
+	d.SetTxAddressesRepair(func(txid string) (*bchain.Tx, uint32, error) {
+		fetched = append(fetched, txid)
+		for i := range block1.Txs {
+			if block1.Txs[i].Txid == txid {
+				return &block1.Txs[i], block1.Height, nil
+			}
+		}
+		return nil, 0, errors.New("not found")
+	})
+	if err = d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fetched, []string{dbtestdata.TxidB1T1}) {
+		t.Errorf("fetched %v, want %v", fetched, []string{dbtestdata.TxidB1T1})
+	}
+	addr2 := addressToAddrDesc(dbtestdata.Addr2, d.chainParser)
+	ta, err := d.GetTxAddresses(dbtestdata.TxidB1T1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ta == nil || ta.Height != 225493 || len(ta.Outputs) != 2 || ta.Outputs[0].Spent || !ta.Outputs[1].Spent ||
+		!bytes.Equal(ta.Outputs[1].AddrDesc, addr2) || ta.Outputs[1].ValueSat.Cmp(dbtestdata.SatB1T1A2) != 0 {
+		t.Errorf("repaired txAddresses of %v = %+v", dbtestdata.TxidB1T1, ta)
+	}
+	// the input of the spending transaction is resolved from the repaired txAddresses
+	ta, err = d.GetTxAddresses(dbtestdata.TxidB2T1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ta == nil || len(ta.Inputs) != 2 || !bytes.Equal(ta.Inputs[1].AddrDesc, addr2) || ta.Inputs[1].ValueSat.Cmp(dbtestdata.SatB1T1A2) != 0 {
+		t.Errorf("txAddresses of %v = %+v", dbtestdata.TxidB2T1, ta)
+	}
+	// the outputs already in the addresses index are not added to the balances again
+	checkRepairedBalance := func(d *RocksDB) {
+		ab, err := d.GetAddrDescBalance(addr2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ab == nil || ab.Txs != 2 || ab.BalanceSat.Sign() != 0 || ab.SentSat.Cmp(dbtestdata.SatB1T1A2) != 0 {
+			t.Errorf("balance of %v = %+v", dbtestdata.Addr2, ab)
+		}
+		anomalies, err := d.GetAmountAnomalies(addr2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(anomalies) != 0 {
+			t.Errorf("amount anomalies of %v = %+v", dbtestdata.Addr2, anomalies)
+		}
+	}
+	checkRepairedBalance(d)
+	// the block 1 is not indexed at all, the outputs of the repaired transactions are added to the balances before their spend
+	m := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, m)
+	m.SetTxAddressesRepair(func(txid string) (*bchain.Tx, uint32, error) {
+		for i := range block1.Txs {
+			if block1.Txs[i].Txid == txid {
+				return &block1.Txs[i], block1.Height, nil
+			}
+		}
+		return nil, 0, errors.New("not found")
+	})
+	if err = m.ConnectBlock(dbtestdata.GetTestUTXOBlock2(m.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	checkRepairedBalance(m)
+}
+
+func TestRocksDB_IndexDelta(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	d.SetIndexDeltaBlocks(10)
+	m := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, m)
+	// the mirror starts from a copy of the db with the block 1
+	for _, db := range []*RocksDB{d, m} {
+		if err := db.ConnectBlock(dbtestdata.GetTestUTXOBlock1(db.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetIndexDelta(225000); err == nil {
+		t.Error("GetIndexDelta of the blocks, which are not kept, did not fail")
+	}
+	delta, err := d.GetIndexDelta(225492)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the block 1 already in the mirror is skipped
+	connected, err := m.ApplyIndexDelta(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connected != 1 {
+		t.Errorf("ApplyIndexDelta connected %d blocks, want 1", connected)
+	}
+	for col := range cfNames {
+		if col == cfDefault || col == cfIndexDelta {
+			continue
+		}
+		want := make(map[string]string)
+		it := d.db.NewIteratorCF(d.ro, d.cfh[col])
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			want[hex.EncodeToString(it.Key().Data())] = hex.EncodeToString(it.Value().Data())
+		}
+		it.Close()
+		got := make(map[string]string)
+		it = m.db.NewIteratorCF(m.ro, m.cfh[col])
+		for it.SeekToFirst(); it.Valid(); it.Next() {
+			got[hex.EncodeToString(it.Key().Data())] = hex.EncodeToString(it.Value().Data())
+		}
+		it.Close()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("column %v of the mirror = %v, want %v", cfNames[col], got, want)
+		}
+	}
+	height, hash, err := m.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225494 || hash != dbtestdata.GetTestUTXOBlock2(m.chainParser).Hash {
+		t.Errorf("best block of the mirror = %d %v", height, hash)
+	}
+	// the mirror on another branch
+	if err = d.DisconnectBlockRangeUTXO(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestUTXOBlock2(d.chainParser)
+	block2.Hash = "0000000000000000000000000000000000000000000000000000000000000001"
+	if err = d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	if delta, err = d.GetIndexDelta(225493); err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.ApplyIndexDelta(delta)
+	if fe, ok := err.(*IndexDeltaForkError); !ok || fe.Height != 225494 {
+		t.Errorf("ApplyIndexDelta error %v, want IndexDeltaForkError at height 225494", err)
+	}
+	// the mirror disconnects its branch and follows the source
+	var since []uint32
+	connected, err = m.SyncIndexDelta(func(h uint32) ([]byte, error) {
+		since = append(since, h)
+		return d.GetIndexDelta(h)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connected != 1 || !reflect.DeepEqual(since, []uint32{225493, 225492, 225493}) {
+		t.Errorf("SyncIndexDelta connected %d blocks, requested %v", connected, since)
+	}
+	if height, hash, err = m.GetBestBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if height != 225494 || hash != block2.Hash {
+		t.Errorf("best block of the mirror = %d %v, want 225494 %v", height, hash, block2.Hash)
+	}
+	// the bulk connect would not record the write sets
+	if _, err = d.InitBulkConnect(); err != ErrBulkConnectIndexDelta {
+		t.Errorf("InitBulkConnect error %v, want %v", err, ErrBulkConnectIndexDelta)
+	}
 }
@@ -0,0 +1,342 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SchemaField is a field of the key or the value of a record, the fields are stored one after another
+// in the order of the description, the encoding of the field is given by Type (one of SchemaEncodings)
+type SchemaField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Length is the length in bytes of the field of type bytes with fixed length
+	Length int `json:"length,omitempty"`
+	// Const is the constant value of the field identifying the kind of the record
+	Const string `json:"const,omitempty"`
+	// Count is the name of the field containing the number of the items of the array,
+	// the array without Count continues to the end of the value
+	Count string `json:"count,omitempty"`
+	// Optional field may be missing at the end of the value
+	Optional bool          `json:"optional,omitempty"`
+	Items    []SchemaField `json:"items,omitempty"`
+}
+
+// SchemaRecord is a format of the records of a column, most of the columns have only one format
+type SchemaRecord struct {
+	Description string        `json:"description,omitempty"`
+	Key         []SchemaField `json:"key"`
+	Value       []SchemaField `json:"value"`
+}
+
+// SchemaColumn describes the records of a column family
+type SchemaColumn struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Records     []SchemaRecord `json:"records"`
+}
+
+// SchemaEncoding describes the encoding of a field type
+type SchemaEncoding struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// Schema is the machine readable description of the data format of the db, see docs/rocksdb.md
+type Schema struct {
+	DbVersion uint32           `json:"dbVersion"`
+	Encodings []SchemaEncoding `json:"encodings"`
+	Columns   []SchemaColumn   `json:"columns"`
+}
+
+// SchemaEncodings are the encodings of the field types used in the schema
+var SchemaEncodings = []SchemaEncoding{
+	{"byte", "one byte"},
+	{"uint32", "unsigned integer stored as 4 bytes in big endian"},
+	{"uint64", "unsigned integer stored as 8 bytes in big endian"},
+	{"int64", "signed integer stored as 8 bytes in big endian (two's complement)"},
+	{"vuint", "variable length unsigned integer, big endian groups of 7 bits, the highest bit is set in all bytes except the last one (github.com/bsm/go-vlq)"},
+	{"vint", "variable length signed integer, zigzag encoded ((i << 1) ^ (i >> 63)) and stored as vuint"},
+	{"bigInt", "unsigned big integer stored as the length of the number (1 byte) followed by the bytes of the number in big endian, zero is stored as one byte 0"},
+	{"bytes", "array of bytes, of the given length or, without length, up to the fixed length fields following it at the end of the key or value"},
+	{"varBytes", "array of bytes (or string) preceded by its length stored as vuint"},
+	{"txid", "packed txid, its length is given by the coin parser (PackedTxidLen, 32 bytes for all supported coins)"},
+	{"hash", "packed block hash, 32 bytes"},
+	{"json", "json document"},
+	{"array", "items of the given fields stored one after another"},
+	{"indexes", "indexes of inputs or outputs of a transaction, the first stored as vint (index<<1|more), the following as vint (delta<<1|more), where delta is the difference from the previous index and the bit more is set if another index follows; an input index is stored as bitwise complement ^index"},
+	{"inputAddrDesc", "(addrDesc_len vuint)+(addrDesc []byte), addrDesc_len greater than 1024 is the reference 1025+i to the i-th distinct non empty addrDesc stored earlier in the value, no addrDesc bytes follow it"},
+	{"outputAddrDesc", "(addrDesc_len vint)+(addrDesc []byte), the length (or the reference as in inputAddrDesc) of a spent output is stored as bitwise complement ^addrDesc_len"},
+}
+
+func schemaField(name, typ string) SchemaField {
+	return SchemaField{Name: name, Type: typ}
+}
+
+func schemaBytes(name string, length int) SchemaField {
+	return SchemaField{Name: name, Type: "bytes", Length: length}
+}
+
+func schemaArray(name, count string, items ...SchemaField) SchemaField {
+	return SchemaField{Name: name, Type: "array", Count: count, Items: items}
+}
+
+func schemaColumn(name, description string, key, value []SchemaField) SchemaColumn {
+	return SchemaColumn{Name: name, Description: description, Records: []SchemaRecord{{Key: key, Value: value}}}
+}
+
+func schemaFields(fields ...SchemaField) []SchemaField {
+	return fields
+}
+
+// schemaColumns are the descriptions of the columns indexed by the column constants,
+// they must be updated together with the pack functions, docs/rocksdb-schema.md is generated from them
+var schemaColumns = []SchemaColumn{
+	cfDefault: schemaColumn("default", "internal state of the db in json under the key internalState",
+		schemaFields(SchemaField{Name: "key", Type: "bytes", Const: internalStateKey}),
+		schemaFields(schemaField("internalState", "json"))),
+	cfHeight: {
+		Name:        "height",
+		Description: "block hash and additional data about the block, optionally followed by a versioned extension",
+		Records: []SchemaRecord{
+			{
+				Description: "block info with the optional extension of version 1 containing the chain specific fields packed by the coin specific function PackBlockExtra",
+				Key:         schemaFields(schemaField("height", "uint32")),
+				Value: schemaFields(schemaField("hash", "hash"), schemaField("time", "uint32"), schemaField("nr_txs", "vuint"), schemaField("size", "vuint"),
+					SchemaField{Name: "extension_version", Type: "byte", Optional: true}, SchemaField{Name: "extra", Type: "bytes", Optional: true}),
+			},
+			{
+				Description: "block info with the extension of version 2 containing the weight and the legacy sigops of the block followed by the optional chain specific fields",
+				Key:         schemaFields(schemaField("height", "uint32")),
+				Value: schemaFields(schemaField("hash", "hash"), schemaField("time", "uint32"), schemaField("nr_txs", "vuint"), schemaField("size", "vuint"),
+					schemaField("extension_version", "byte"), schemaField("weight", "vuint"), schemaField("sigops", "vuint"),
+					SchemaField{Name: "extra", Type: "bytes", Optional: true}),
+			},
+		},
+	},
+	cfAddresses: schemaColumn("addresses", "outpoints of the transactions of the address in the block, grouped by txid",
+		schemaFields(schemaField("addrDesc", "bytes"), schemaField("height", "uint32")),
+		schemaFields(schemaArray("outpoints", "", schemaField("txid", "txid"), schemaField("indexes", "indexes")))),
+	cfTxAddresses: {
+		Name:        "txAddresses",
+		Description: "block height and the addrDescs and amounts of the inputs and outputs of the transaction",
+		Records: []SchemaRecord{
+			{
+				Key: schemaFields(schemaField("txid", "txid")),
+				Value: schemaFields(schemaField("height", "vuint"),
+					schemaField("nr_inputs", "vuint"), schemaArray("inputs", "nr_inputs", schemaField("addrDesc", "inputAddrDesc"), schemaField("amount", "bigInt")),
+					schemaField("nr_outputs", "vuint"), schemaArray("outputs", "nr_outputs", schemaField("addrDesc", "outputAddrDesc"), schemaField("amount", "bigInt"))),
+			},
+			{
+				Description: "transaction duplicating the txid of an earlier transaction (before BIP30)",
+				Key:         schemaFields(schemaField("txid", "txid"), schemaField("height", "uint32")),
+				Value: schemaFields(schemaField("height", "vuint"),
+					schemaField("nr_inputs", "vuint"), schemaArray("inputs", "nr_inputs", schemaField("addrDesc", "inputAddrDesc"), schemaField("amount", "bigInt")),
+					schemaField("nr_outputs", "vuint"), schemaArray("outputs", "nr_outputs", schemaField("addrDesc", "outputAddrDesc"), schemaField("amount", "bigInt"))),
+			},
+		},
+	},
+	cfAddressBalance: schemaColumn("addressBalance", "number of transactions, sent amount and balance of the address, account based chains store the next nonce instead of the amounts, optionally the sketch of the counterparties",
+		schemaFields(schemaField("addrDesc", "bytes")),
+		schemaFields(schemaField("nr_txs", "vuint"), schemaField("sent_amount", "bigInt"), schemaField("balance", "bigInt"),
+			SchemaField{Name: "nonce", Type: "vuint", Optional: true}, SchemaField{Name: "counterparties", Type: "bytes", Optional: true})),
+	cfBlockTxs: schemaColumn("blockTxs", "txids and input points of the transactions of the recent blocks, used in case of rollback",
+		schemaFields(schemaField("height", "uint32")),
+		schemaFields(schemaArray("txs", "", schemaField("txid", "txid"), schemaField("nr_inputs", "vuint"),
+			schemaArray("inputs", "nr_inputs", schemaField("txid", "txid"), schemaField("index", "vint"))))),
+	cfTransactions: schemaColumn("transactions", "transaction cache, the data are packed by the coin specific function PackTx",
+		schemaFields(schemaField("txid", "txid")),
+		schemaFields(schemaField("txdata", "bytes"))),
+	cfFees: {
+		Name:        "fees",
+		Description: "fee statistics of the blocks and snapshots of the mempool",
+		Records: []SchemaRecord{
+			{
+				Description: "fee statistics of the block, fee rates are percentiles (10, 25, 50, 75, 90) of fees per 1000 virtual bytes",
+				Key:         schemaFields(SchemaField{Name: "prefix", Type: "byte", Const: string(feesBlockKeyPrefix)}, schemaField("height", "uint32")),
+				Value:       schemaFields(schemaField("nr_txs", "vuint"), schemaField("total_fees", "bigInt"), schemaArray("fee_rates", "", schemaField("fee_rate", "vuint"))),
+			},
+			{
+				Description: "snapshot of the mempool at the unix time",
+				Key:         schemaFields(SchemaField{Name: "prefix", Type: "byte", Const: string(feesMempoolKeyPrefix)}, schemaField("time", "uint32")),
+				Value:       schemaFields(schemaField("nr_mempool_txs", "vuint"), schemaArray("fee_estimates", "", schemaField("blocks", "vuint"), schemaField("fee_per_kb", "bigInt"))),
+			},
+		},
+	},
+	cfDustTxs: schemaColumn("dustTxs", "number of dust outputs of the transaction tagged as dust attack",
+		schemaFields(schemaField("txid", "txid")),
+		schemaFields(schemaField("nr_dust_outputs", "vuint"))),
+	cfScriptTemplates: schemaColumn("scriptTemplates", "outpoints of the outputs matching the script skeleton with the sha256 hash template_hash",
+		schemaFields(schemaBytes("template_hash", 32), schemaField("height", "uint32")),
+		schemaFields(schemaArray("outpoints", "", schemaField("txid", "txid"), schemaField("indexes", "indexes")))),
+	cfWatchedOutpoints: schemaColumn("watchedOutpoints", "webhook and label of the watched outpoint",
+		schemaFields(schemaField("txid", "txid"), schemaField("vout", "vuint")),
+		schemaFields(schemaField("webhook", "varBytes"), schemaField("label", "varBytes"))),
+	cfRewards: schemaColumn("rewards", "reward type of each output of the coinbase transaction (0 - not a reward, 1 - mining, 2 - masternode, 3 - superblock)",
+		schemaFields(schemaField("txid", "txid")),
+		schemaFields(schemaArray("reward_types", "", schemaField("reward_type", "byte")))),
+	cfHeightAddresses: schemaColumn("heightAddresses", "keys of the addresses column partitioned by block height, the value is empty or, for account based chains, the next nonce of the address before the block if the block changed it",
+		schemaFields(schemaField("height", "uint32"), schemaField("addrDesc", "bytes")),
+		schemaFields(schemaArray("nonce", "", schemaField("nonce", "vuint")))),
+	cfScriptAnnotations: schemaColumn("scriptAnnotations", "annotations of the outputs of the transaction by the script classifiers",
+		schemaFields(schemaField("txid", "txid")),
+		schemaFields(schemaField("nr_outputs", "vuint"), schemaArray("outputs", "nr_outputs", schemaField("vout", "vuint"),
+			schemaField("nr_annotations", "vuint"), schemaArray("annotations", "nr_annotations", schemaField("classifier", "varBytes"), schemaField("type", "varBytes"),
+				schemaField("nr_fields", "vuint"), schemaArray("fields", "nr_fields", schemaField("name", "varBytes"), schemaField("value", "varBytes")))))),
+	cfArchive: schemaColumn("archive", "block hash and CID of the block document published to IPFS",
+		schemaFields(schemaField("height", "uint32")),
+		schemaFields(schemaField("hash", "hash"), schemaField("cid", "varBytes"))),
+	cfWatchedAddresses: schemaColumn("watchedAddresses", "address, label and webhook of the watched address",
+		schemaFields(schemaField("addrDesc", "bytes")),
+		schemaFields(schemaField("address", "varBytes"), schemaField("label", "varBytes"), schemaField("webhook", "varBytes"))),
+	cfErc20Contracts: schemaColumn("erc20Contracts", "metadata of the ERC-20 contract and the unix time when they were read",
+		schemaFields(schemaField("addrDesc", "bytes")),
+		schemaFields(schemaField("time", "vuint"), schemaField("decimals", "vuint"), schemaField("contract", "varBytes"), schemaField("name", "varBytes"), schemaField("symbol", "varBytes"))),
+	cfReorgs: schemaColumn("reorgs", "chain reorganization detected at the unix time in nanoseconds",
+		schemaFields(schemaField("detected", "int64")),
+		schemaFields(schemaField("old_tip_hash", "hash"), schemaField("new_tip_hash", "hash"), schemaField("old_tip_height", "vuint"),
+			schemaField("new_tip_height", "vuint"), schemaField("fork_height", "vuint"), schemaField("detected", "vuint"), schemaField("resolved", "vuint"))),
+	cfCoinControl: schemaColumn("coinControl", "label and flags of the unspent output set by the user of the wallet, the lowest bit of flags is frozen",
+		schemaFields(schemaField("wallet", "varBytes"), schemaField("txid", "txid"), schemaField("vout", "vuint")),
+		schemaFields(schemaField("flags", "byte"), schemaField("label", "varBytes"))),
+	cfBlockSupply: schemaColumn("blockSupply", "sums of the outputs, inputs and unspendable outputs of the transactions of the block and their totals from the first recorded block",
+		schemaFields(schemaField("height", "uint32")),
+		schemaFields(schemaField("outputs", "bigInt"), schemaField("inputs", "bigInt"), schemaField("burned", "bigInt"),
+			schemaField("from_height", "uint32"), schemaField("blocks", "uint32"),
+			schemaField("total_outputs", "bigInt"), schemaField("total_inputs", "bigInt"), schemaField("total_burned", "bigInt"))),
+	cfSilentPayments: schemaColumn("silentPayments", "value, BIP352 index k and spend key tweak of the output paying to the silent payments wallet",
+		schemaFields(schemaField("wallet", "varBytes"), schemaField("height", "uint32"), schemaField("txid", "txid"), schemaField("vout", "vuint")),
+		schemaFields(schemaField("value", "bigInt"), schemaField("k", "vuint"), schemaBytes("tweak", 32))),
+	cfNameOps: schemaColumn("nameOps", "name operation (2 - name_firstupdate, 3 - name_update) with the value of the name and the owner addrDesc",
+		schemaFields(schemaField("name", "varBytes"), schemaField("height", "uint32"), schemaField("txid", "txid")),
+		schemaFields(schemaField("vout", "vuint"), schemaField("type", "byte"), schemaField("value", "varBytes"), schemaField("owner", "bytes"))),
+	cfAddressContracts: schemaColumn("addressContracts", "flag if there is a contract code at the address and the unix time of the check, the lowest bit of flags is contract",
+		schemaFields(schemaField("addrDesc", "bytes")),
+		schemaFields(schemaField("flags", "byte"), schemaField("checked", "vuint"))),
+	cfCoinjoinTxs: schemaColumn("coinjoinTxs", "type (1 - generic, 2 - whirlpool, 3 - wasabi), number of equal outputs and their value of the transaction tagged as coinjoin",
+		schemaFields(schemaField("txid", "txid")),
+		schemaFields(schemaField("type", "byte"), schemaField("equal_outputs", "vuint"), schemaField("denomination", "bigInt"))),
+	cfMultisigWallets: schemaColumn("multisigWallets", "output descriptors, number of used addresses of each descriptor, lookahead, webhook and the next sequence number of the feed of the multisig wallet",
+		schemaFields(schemaField("name", "bytes")),
+		schemaFields(schemaField("name", "varBytes"), schemaField("nr_descriptors", "vuint"), schemaArray("descriptors", "nr_descriptors", schemaField("descriptor", "varBytes"), schemaField("used", "vuint")),
+			schemaField("lookahead", "vuint"), schemaField("webhook", "varBytes"), schemaField("next_seq", "vuint"))),
+	cfMultisigEvents: schemaColumn("multisigEvents", "event of the feed of the multisig wallet, type 0 - funding, 1 - spend, height 0 - mempool transaction",
+		schemaFields(schemaField("wallet", "varBytes"), schemaField("seq", "uint64")),
+		schemaFields(schemaField("type", "byte"), schemaField("txid", "txid"), schemaField("addrDesc", "varBytes"), schemaField("descriptor", "vuint"),
+			schemaField("index", "vuint"), schemaField("height", "vuint"), schemaField("time", "vuint"))),
+	cfInscriptions: schemaColumn("inscriptions", "genesis height, content type and length and the current location (txid, vout and offset of the sat) of the ordinals inscription",
+		schemaFields(schemaField("genesis_txid", "txid"), schemaField("index", "vuint")),
+		schemaFields(schemaField("height", "uint32"), schemaField("content_type", "varBytes"), schemaField("content_length", "vuint"),
+			schemaField("txid", "txid"), schemaField("vout", "vuint"), schemaField("offset", "vuint"))),
+	cfInscriptionOutputs: schemaColumn("inscriptionOutputs", "inscriptions held by the unspent output and the offsets of their sats, vout 4294967295 - inscriptions spent as the fee",
+		schemaFields(schemaField("txid", "txid"), schemaField("vout", "vuint")),
+		schemaFields(schemaField("nr_inscriptions", "vuint"), schemaArray("inscriptions", "nr_inscriptions", schemaField("inscription", "varBytes"), schemaField("offset", "vuint")))),
+	cfPaymentIDs: schemaColumn("paymentIds", "outputs of the transaction carrying the payment id",
+		schemaFields(schemaField("payment_id", "varBytes"), schemaField("height", "uint32"), schemaField("txid", "txid")),
+		schemaFields(schemaField("nr_vouts", "vuint"), schemaArray("vouts", "nr_vouts", schemaField("vout", "vuint")))),
+	cfBlockBurns: schemaColumn("blockBurns", "number and value of the burned outputs of the block by the burn address, empty addrDesc - unspendable outputs",
+		schemaFields(schemaField("height", "uint32")),
+		schemaFields(schemaField("nr_burns", "vuint"), schemaArray("burns", "nr_burns", schemaField("addrDesc", "varBytes"), schemaField("outputs", "vuint"), schemaField("burned", "bigInt")))),
+	cfBurnTotals: schemaColumn("burnTotals", "cumulative number and value of the burned outputs of the burn address, empty addrDesc - unspendable outputs",
+		schemaFields(schemaField("addrDesc", "bytes")),
+		schemaFields(schemaField("outputs", "vuint"), schemaField("burned", "bigInt"))),
+	cfAmountAnomalies: schemaColumn("amountAnomalies", "negative balances reset to zero and amounts truncated when stored, kind 0 - negative balance, 1 - negative sent amount, 2 - truncated balance, 3 - truncated output value",
+		schemaFields(schemaField("addrDesc", "bytes"), schemaField("kind", "byte")),
+		schemaFields(schemaField("count", "vuint"), schemaField("first_height", "uint32"), schemaField("last_height", "uint32"), schemaField("value", "bigInt"))),
+	cfWithdrawals: schemaColumn("withdrawals", "withdrawals from the beacon chain credited to the address in the block, amount in wei",
+		schemaFields(schemaField("addrDesc", "bytes"), schemaField("height", "uint32")),
+		schemaFields(schemaField("nr_withdrawals", "vuint"), schemaArray("withdrawals", "nr_withdrawals", schemaField("index", "vuint"), schemaField("validator_index", "vuint"), schemaField("amount", "bigInt")))),
+	cfIndexDelta: schemaColumn("indexDelta", "writes of the connected block to the other columns for the mirrors, op 0 - put, 1 - delete (without value), column - index in the list of columns",
+		schemaFields(schemaField("height", "uint32")),
+		schemaFields(schemaField("height", "uint32"), schemaField("hash", "varBytes"), schemaField("prev_hash", "varBytes"), schemaField("nr_writes", "vuint"),
+			schemaArray("writes", "nr_writes", schemaField("op", "byte"), schemaField("column", "vuint"), schemaField("key", "varBytes"), schemaField("value", "varBytes")))),
+	cfHoldingStats: schemaColumn("holdingStats", "number and value of the spent outputs of the address, sum of the times for which they were held (seconds) and sum of the values multiplied by the times",
+		schemaFields(schemaField("addrDesc", "bytes")),
+		schemaFields(schemaField("outputs", "vuint"), schemaField("value", "bigInt"), schemaField("held_seconds", "vuint"), schemaField("coin_seconds", "bigInt"))),
+	cfLargestTxs: schemaColumn("largestTxs", "transactions of the block with the highest total value of the outputs, from the largest, kept for the last blocks",
+		schemaFields(schemaField("height", "uint32")),
+		schemaFields(schemaField("nr_txs", "vuint"), schemaArray("txs", "nr_txs", schemaField("txid", "txid"), schemaField("value", "bigInt")))),
+	cfWalletAccounts: schemaColumn("walletAccounts", "output descriptors, the gap of the addresses discovery and the token of the public view of the wallet account",
+		schemaFields(schemaField("name", "bytes")),
+		schemaFields(schemaField("nr_descriptors", "vuint"), schemaArray("descriptors", "nr_descriptors", schemaField("descriptor", "varBytes")), schemaField("gap", "vuint"),
+			schemaField("token", "varBytes"))),
+	cfIndexHash: schemaColumn("indexHash", "rolling hashes of the writes of the blocks of the window from from_height to the columns, kept for the last blocks and for the last block of each window",
+		schemaFields(schemaField("height", "uint32")),
+		schemaFields(schemaField("from_height", "uint32"), schemaField("nr_columns", "vuint"), schemaArray("columns", "nr_columns", schemaField("column", "varBytes"), schemaField("hash", "bytes")))),
+	cfMethodSignatures: schemaColumn("methodSignatures", "signatures of the contract methods with the selector added by the internal server",
+		schemaFields(schemaField("selector", "bytes")),
+		schemaFields(schemaField("nr_signatures", "vuint"), schemaArray("signatures", "nr_signatures", schemaField("signature", "varBytes")))),
+	cfInscriptionAddresses: schemaColumn("inscriptionAddresses", "unspent output of the address holding inscriptions, the value is empty",
+		schemaFields(schemaField("addrDesc", "varBytes"), schemaField("txid", "txid"), schemaField("vout", "vuint")),
+		schemaFields()),
+}
+
+// GetSchema returns the description of the column families, key formats and value encodings of the current dbVersion
+func GetSchema() *Schema {
+	return &Schema{
+		DbVersion: dbVersion,
+		Encodings: SchemaEncodings,
+		Columns:   schemaColumns,
+	}
+}
+
+// markdownField formats the field in the pseudo types of docs/rocksdb.md, e.g. (height uint32)
+func markdownField(f *SchemaField) string {
+	var r string
+	switch {
+	case f.Type == "array":
+		r = "[" + f.Count + "](" + markdownFields(f.Items) + ")"
+		if f.Name != "" {
+			r = "(" + f.Name + " " + r + ")"
+		}
+	case f.Const != "":
+		r = fmt.Sprintf("(%s %s %q)", f.Name, f.Type, f.Const)
+	case f.Type == "bytes" && f.Length > 0:
+		r = fmt.Sprintf("(%s [%d]byte)", f.Name, f.Length)
+	case f.Type == "bytes":
+		r = "(" + f.Name + " []byte)"
+	default:
+		r = "(" + f.Name + " " + f.Type + ")"
+	}
+	if f.Optional {
+		r = "[" + r + "]"
+	}
+	return r
+}
+
+func markdownFields(fields []SchemaField) string {
+	s := make([]string, len(fields))
+	for i := range fields {
+		s[i] = markdownField(&fields[i])
+	}
+	return strings.Join(s, "+")
+}
+
+func markdownCell(s string) string {
+	return strings.Replace(s, "|", "\\|", -1)
+}
+
+// Markdown returns the schema as the tables of the encodings and the columns in markdown,
+// the table of the columns in docs/rocksdb-schema.md is generated by this function
+func (s *Schema) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Format of the column families\n\n")
+	fmt.Fprintf(&b, "This file is generated from the description of the db format in db/schema.go, do not edit it by hand. ")
+	fmt.Fprintf(&b, "It is regenerated by running the unit tests of the package db with the flag -update-golden.\n\n")
+	fmt.Fprintf(&b, "Data format version: %d\n\n", s.DbVersion)
+	fmt.Fprintf(&b, "## Encodings\n\n| Type | Encoding |\n|---|---|\n")
+	for _, e := range s.Encodings {
+		fmt.Fprintf(&b, "| %s | %s |\n", e.Type, markdownCell(e.Description))
+	}
+	fmt.Fprintf(&b, "\n## Columns\n\n| Column | Key | Value | Description |\n|---|---|---|---|\n")
+	for _, c := range s.Columns {
+		for _, r := range c.Records {
+			d := c.Description
+			if r.Description != "" {
+				d = r.Description
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", c.Name, markdownCell(markdownFields(r.Key)), markdownCell(markdownFields(r.Value)), markdownCell(d))
+		}
+	}
+	return b.String()
+}
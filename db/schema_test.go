@@ -0,0 +1,75 @@
+// +build unittest
+
+package db
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+const schemaDocFile = "../docs/rocksdb-schema.md"
+
+func checkSchemaFields(t *testing.T, column string, fields []SchemaField, types map[string]bool) {
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if !types[f.Type] {
+			t.Errorf("column %v, field %v: unknown type %v", column, f.Name, f.Type)
+		}
+		if f.Count != "" && !names[f.Count] {
+			t.Errorf("column %v, field %v: count field %v does not precede the array", column, f.Name, f.Count)
+		}
+		if (f.Type == "array") != (len(f.Items) > 0) {
+			t.Errorf("column %v, field %v: items must be set exactly for arrays", column, f.Name)
+		}
+		names[f.Name] = true
+		checkSchemaFields(t, column, f.Items, types)
+	}
+}
+
+func TestGetSchema(t *testing.T) {
+	s := GetSchema()
+	if s.DbVersion != dbVersion {
+		t.Errorf("DbVersion = %v, want %v", s.DbVersion, dbVersion)
+	}
+	types := make(map[string]bool)
+	for _, e := range s.Encodings {
+		types[e.Type] = true
+	}
+	if len(s.Columns) != len(cfNames) {
+		t.Fatalf("schema describes %v columns, db has %v", len(s.Columns), len(cfNames))
+	}
+	for i, c := range s.Columns {
+		if c.Name != cfNames[i] {
+			t.Errorf("column %v: name %v, want %v", i, c.Name, cfNames[i])
+		}
+		if len(c.Records) == 0 {
+			t.Errorf("column %v: no records", c.Name)
+		}
+		for _, r := range c.Records {
+			checkSchemaFields(t, c.Name, r.Key, types)
+			checkSchemaFields(t, c.Name, r.Value, types)
+		}
+	}
+	if _, err := json.Marshal(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// docs/rocksdb-schema.md must be regenerated (go test -tags unittest ./db -update-golden) after a change of the schema
+func TestSchema_Markdown(t *testing.T) {
+	md := GetSchema().Markdown()
+	if *updateGolden {
+		if err := ioutil.WriteFile(schemaDocFile, []byte(md), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	b, err := ioutil.ReadFile(schemaDocFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != md {
+		t.Errorf("%v is not generated from the current schema, run the test with -update-golden", schemaDocFile)
+	}
+}
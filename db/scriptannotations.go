@@ -0,0 +1,167 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"sort"
+	"time"
+
+	"github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// computeScriptAnnotations returns map of packed txids to packed annotations of their outputs by the registered script classifiers
+// only the transactions with at least one annotated output are returned
+func (d *RocksDB) computeScriptAnnotations(block *bchain.Block) map[string][]byte {
+	if !bchain.HasScriptClassifiers() {
+		return nil
+	}
+	var r map[string][]byte
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		annotations := make(map[int][]bchain.ScriptAnnotation)
+		for j := range tx.Vout {
+			addrDesc, err := d.chainParser.GetAddrDescFromVout(&tx.Vout[j])
+			if err != nil || len(addrDesc) == 0 {
+				continue
+			}
+			if a := bchain.ClassifyScript(tx, j, addrDesc); len(a) > 0 {
+				annotations[j] = a
+			}
+		}
+		if len(annotations) == 0 {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		if r == nil {
+			r = make(map[string][]byte)
+		}
+		r[string(btxID)] = packScriptAnnotations(annotations)
+	}
+	return r
+}
+
+func (d *RocksDB) storeScriptAnnotations(wb *gorocksdb.WriteBatch, annotations map[string][]byte) error {
+	for btxID, buf := range annotations {
+		wb.PutCF(d.cfh[cfScriptAnnotations], []byte(btxID), buf)
+	}
+	return nil
+}
+
+func packScriptAnnotations(annotations map[int][]bchain.ScriptAnnotation) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	outputs := make([]int, 0, len(annotations))
+	for n := range annotations {
+		outputs = append(outputs, n)
+	}
+	sort.Ints(outputs)
+	buf := make([]byte, 0, 64)
+	l := packVaruint(uint(len(outputs)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for _, n := range outputs {
+		l = packVaruint(uint(n), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packVaruint(uint(len(annotations[n])), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		for _, a := range annotations[n] {
+			buf = packString(a.Classifier, buf)
+			buf = packString(a.Type, buf)
+			keys := make([]string, 0, len(a.Fields))
+			for k := range a.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			l = packVaruint(uint(len(keys)), varBuf)
+			buf = append(buf, varBuf[:l]...)
+			for _, k := range keys {
+				buf = packString(k, buf)
+				buf = packString(a.Fields[k], buf)
+			}
+		}
+	}
+	return buf
+}
+
+func unpackScriptAnnotations(buf []byte) (map[int][]bchain.ScriptAnnotation, error) {
+	errInvalid := errors.New("Invalid packed script annotations")
+	nOutputs, l := unpackVaruint(buf)
+	if l <= 0 {
+		return nil, errInvalid
+	}
+	buf = buf[l:]
+	r := make(map[int][]bchain.ScriptAnnotation, nOutputs)
+	for i := uint(0); i < nOutputs; i++ {
+		n, l := unpackVaruint(buf)
+		if l <= 0 {
+			return nil, errInvalid
+		}
+		buf = buf[l:]
+		na, l := unpackVaruint(buf)
+		if l <= 0 {
+			return nil, errInvalid
+		}
+		buf = buf[l:]
+		as := make([]bchain.ScriptAnnotation, na)
+		for j := range as {
+			a := &as[j]
+			var err error
+			if a.Classifier, l, err = unpackString(buf); err != nil {
+				return nil, err
+			}
+			buf = buf[l:]
+			if a.Type, l, err = unpackString(buf); err != nil {
+				return nil, err
+			}
+			buf = buf[l:]
+			nf, l := unpackVaruint(buf)
+			if l <= 0 {
+				return nil, errInvalid
+			}
+			buf = buf[l:]
+			if nf > 0 {
+				a.Fields = make(map[string]string, nf)
+			}
+			for k := uint(0); k < nf; k++ {
+				var key, value string
+				if key, l, err = unpackString(buf); err != nil {
+					return nil, err
+				}
+				buf = buf[l:]
+				if value, l, err = unpackString(buf); err != nil {
+					return nil, err
+				}
+				buf = buf[l:]
+				a.Fields[key] = value
+			}
+		}
+		r[int(n)] = as
+	}
+	return r, nil
+}
+
+// GetScriptAnnotations returns the annotations of the outputs of the transaction by the script classifiers
+// returns nil if no output of the transaction was annotated
+func (d *RocksDB) GetScriptAnnotations(txid string) (annotations map[int][]bchain.ScriptAnnotation, err error) {
+	defer func(s time.Time) { d.observeMethod("GetScriptAnnotations", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfScriptAnnotations], btxID)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return unpackScriptAnnotations(buf)
+}
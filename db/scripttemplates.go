@@ -0,0 +1,169 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// bitcoin script push opcodes
+const (
+	opPushData1 = 0x4c
+	opPushData2 = 0x4d
+	opPushData4 = 0x4e
+)
+
+// ScriptSkeleton returns the skeleton of the output script - the script with the pushed data removed,
+// only the opcodes (including the push opcodes with data length) are kept
+// e.g. P2PKH script 76a914<20 bytes>88ac has skeleton 76a91488ac
+func ScriptSkeleton(script []byte) ([]byte, error) {
+	s := make([]byte, 0, len(script))
+	for i := 0; i < len(script); {
+		op := script[i]
+		var l, ll int
+		switch {
+		case op > 0 && op < opPushData1:
+			l = int(op)
+		case op == opPushData1:
+			ll = 1
+		case op == opPushData2:
+			ll = 2
+		case op == opPushData4:
+			ll = 4
+		}
+		if i+1+ll > len(script) {
+			return nil, errors.New("Invalid script, truncated push opcode")
+		}
+		switch ll {
+		case 1:
+			l = int(script[i+1])
+		case 2:
+			l = int(binary.LittleEndian.Uint16(script[i+1:]))
+		case 4:
+			l = int(binary.LittleEndian.Uint32(script[i+1:]))
+		}
+		s = append(s, script[i:i+1+ll]...)
+		i += 1 + ll
+		if l < 0 || i+l > len(script) {
+			return nil, errors.New("Invalid script, truncated push data")
+		}
+		i += l
+	}
+	return s, nil
+}
+
+// ScriptTemplateHash returns the hash of the script skeleton, under which the matching outputs are indexed
+func ScriptTemplateHash(skeleton []byte) []byte {
+	h := sha256.Sum256(skeleton)
+	return h[:]
+}
+
+// SetScriptTemplates sets the script skeletons, outputs matching them are indexed in the scriptTemplates column
+// the templates must be set before the first block is connected, changing them does not reindex already connected blocks
+func (d *RocksDB) SetScriptTemplates(skeletons [][]byte) {
+	d.scriptTemplates = make(map[string]struct{}, len(skeletons))
+	for _, s := range skeletons {
+		d.scriptTemplates[string(ScriptTemplateHash(s))] = struct{}{}
+	}
+}
+
+// IsScriptTemplateIndexed returns true if the outputs matching the skeleton are indexed
+func (d *RocksDB) IsScriptTemplateIndexed(skeleton []byte) bool {
+	_, found := d.scriptTemplates[string(ScriptTemplateHash(skeleton))]
+	return found
+}
+
+// computeScriptTemplateOutpoints finds outputs of the block transactions matching the configured script templates
+// it must be called after processAddressesUTXO, the txAddressesMap must contain the block transactions
+func (d *RocksDB) computeScriptTemplateOutpoints(block *bchain.Block, txAddressesMap map[string]*TxAddresses) map[string][]outpoint {
+	if len(d.scriptTemplates) == 0 {
+		return nil
+	}
+	r := make(map[string][]outpoint)
+	for i := range block.Txs {
+		btxID, err := d.chainParser.PackTxid(block.Txs[i].Txid)
+		if err != nil {
+			continue
+		}
+		ta := txAddressesMap[string(d.txAddressesKey(btxID, block.Txs[i].Txid, block.Height))]
+		if ta == nil {
+			continue
+		}
+		for n := range ta.Outputs {
+			s, err := ScriptSkeleton(ta.Outputs[n].AddrDesc)
+			if err != nil {
+				continue
+			}
+			h := string(ScriptTemplateHash(s))
+			if _, found := d.scriptTemplates[h]; found {
+				r[h] = append(r[h], outpoint{btxID: btxID, index: int32(n)})
+			}
+		}
+	}
+	return r
+}
+
+func (d *RocksDB) storeScriptTemplateOutpoints(wb *gorocksdb.WriteBatch, height uint32, templates map[string][]outpoint) error {
+	for h, outpoints := range templates {
+		wb.PutCF(d.cfh[cfScriptTemplates], packAddressKey([]byte(h), height), d.packAddressOutpoints(outpoints))
+	}
+	return nil
+}
+
+// deleteScriptTemplateOutpoints removes the configured templates of the block with given height
+func (d *RocksDB) deleteScriptTemplateOutpoints(wb *gorocksdb.WriteBatch, height uint32) {
+	for h := range d.scriptTemplates {
+		wb.DeleteCF(d.cfh[cfScriptTemplates], packAddressKey([]byte(h), height))
+	}
+}
+
+// GetScriptTemplateOutputs finds outputs matching the script skeleton in the blocks lower-higher
+// the outputs are passed to callback function, the iteration stops if the callback returns error
+func (d *RocksDB) GetScriptTemplateOutputs(skeleton []byte, lower uint32, higher uint32, fn func(txid string, vout uint32, height uint32) error) (err error) {
+	defer func(s time.Time) { d.observeMethod("GetScriptTemplateOutputs", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	h := ScriptTemplateHash(skeleton)
+	kstart := packAddressKey(h, lower)
+	kstop := packAddressKey(h, higher)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfScriptTemplates])
+	defer it.Close()
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		_, height, err := unpackAddressKey(key)
+		if err != nil {
+			return err
+		}
+		outpoints, err := d.unpackAddressOutpoints(it.Value().Data())
+		if err != nil {
+			return err
+		}
+		for _, o := range outpoints {
+			tx, err := d.chainParser.UnpackTxid(o.btxID)
+			if err != nil {
+				return err
+			}
+			if err := fn(tx, uint32(o.index), height); err != nil {
+				if _, ok := err.(*StopIteration); ok {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	if glog.V(1) {
+		glog.Infof("rocksdb: script template %x get %d-%d done", skeleton, lower, higher)
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/common"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// sharded sync
+// experimental mode of the initial sync of UTXO chains, the blocks are processed in two passes
+// 1) outputs pass - disjoint block ranges (shards) are fetched in parallel, the outputs of their transactions are processed
+//    and stored together with the txids and inputs to temporary shard dbs; this pass does not depend on the previous blocks
+// 2) inputs pass - the blocks are read from the shards in the order of height, the rows computed only from the outputs
+//    are copied to the index and the inputs are spent sequentially using the bulk connect
+// the index is written only in the inputs pass block by block, an interrupted sync continues from the last connected block
+// the indexes needing the data of the spent outputs or the witness data of the transactions are not supported
+
+// size of the cache of each shard db, the shard data are written once and read once
+const shardCacheSize = 1 << 26
+
+// checkShardedSync returns error if an index not supported by the sharded sync is enabled
+func (d *RocksDB) checkShardedSync() error {
+	var unsupported []string
+	if len(d.silentPayments) > 0 {
+		unsupported = append(unsupported, "silent payments")
+	}
+	if d.ordinals {
+		unsupported = append(unsupported, "ordinals")
+	}
+	if d.holdingStats {
+		unsupported = append(unsupported, "holding stats")
+	}
+	if len(unsupported) > 0 {
+		return errors.Errorf("The sharded sync does not support %v", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+func (d *RocksDB) shardsPath() string {
+	return d.path + ".shards"
+}
+
+// openShard creates an empty temporary db of the shard i
+func (d *RocksDB) openShard(i int) (*RocksDB, error) {
+	path := d.shardsPath() + "/" + strconv.Itoa(i)
+	if err := os.RemoveAll(path); err != nil {
+		return nil, err
+	}
+	return NewRocksDB(path, shardCacheSize, d.maxOpenFiles, d.chainParser, nil)
+}
+
+// closeShard closes the shard db and removes its files
+func closeShard(s *RocksDB) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.path)
+}
+
+// packShardBlock packs the data of the block needed by the inputs pass - the block info followed by
+// the packed txid, vsize, inputs and txAddresses with only outputs of each transaction
+func (d *RocksDB) packShardBlock(block *bchain.Block, blockTxIDs [][]byte, blockTxAddresses []*TxAddresses) ([]byte, error) {
+	bi, err := d.packBlockInfo(blockInfoFromBlock(block))
+	if err != nil {
+		return nil, err
+	}
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(len(bi)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	buf = append(buf, bi...)
+	zeroTx := make([]byte, d.chainParser.PackedTxidLen())
+	var taBuf []byte
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		o := make([]outpoint, len(tx.Vin))
+		for v := range tx.Vin {
+			vin := &tx.Vin[v]
+			btxID, err := d.chainParser.PackTxid(vin.Txid)
+			if err != nil {
+				if err != bchain.ErrTxidMissing {
+					return nil, err
+				}
+				btxID = zeroTx
+			}
+			o[v].btxID = btxID
+			o[v].index = int32(vin.Vout)
+		}
+		buf = append(buf, blockTxIDs[i]...)
+		l = packVaruint(uint(tx.VSize), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packVaruint(uint(len(o)), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		buf = append(buf, d.packOutpoints(o)...)
+		taBuf = packTxAddresses(blockTxAddresses[i], taBuf, varBuf)
+		l = packVaruint(uint(len(taBuf)), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		buf = append(buf, taBuf...)
+	}
+	return buf, nil
+}
+
+// unpackShardBlock unpacks the data packed by packShardBlock, the returned block contains only the data needed by the inputs pass
+func (d *RocksDB) unpackShardBlock(height uint32, buf []byte) (*bchain.Block, [][]byte, []*TxAddresses, error) {
+	errInconsistent := errors.Errorf("Inconsistent data of shard block %d", height)
+	pl := d.chainParser.PackedTxidLen()
+	bl, p := unpackVaruint(buf)
+	if p+int(bl) > len(buf) {
+		return nil, nil, nil, errInconsistent
+	}
+	bi, err := d.unpackBlockInfo(buf[p : p+int(bl)])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if bi == nil {
+		return nil, nil, nil, errInconsistent
+	}
+	p += int(bl)
+	block := &bchain.Block{
+		BlockHeader: bchain.BlockHeader{
+			Hash:   bi.Hash,
+			Height: height,
+			Size:   int(bi.Size),
+			Time:   bi.Time,
+		},
+		Txs:   make([]bchain.Tx, bi.Txs),
+		Extra: bi.Extra,
+	}
+	blockTxIDs := make([][]byte, bi.Txs)
+	blockTxAddresses := make([]*TxAddresses, bi.Txs)
+	zeroTx := make([]byte, pl)
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		if p+pl > len(buf) {
+			return nil, nil, nil, errInconsistent
+		}
+		blockTxIDs[i] = append([]byte(nil), buf[p:p+pl]...)
+		if tx.Txid, err = d.chainParser.UnpackTxid(blockTxIDs[i]); err != nil {
+			return nil, nil, nil, err
+		}
+		p += pl
+		vsize, l := unpackVaruint(buf[p:])
+		tx.VSize = int64(vsize)
+		p += l
+		inputs, l, err := d.unpackNOutpoints(buf[p:])
+		if err != nil {
+			return nil, nil, nil, errInconsistent
+		}
+		p += l
+		tx.Vin = make([]bchain.Vin, len(inputs))
+		for v := range inputs {
+			if !bytes.Equal(inputs[v].btxID, zeroTx) {
+				if tx.Vin[v].Txid, err = d.chainParser.UnpackTxid(inputs[v].btxID); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			tx.Vin[v].Vout = uint32(inputs[v].index)
+		}
+		tl, l := unpackVaruint(buf[p:])
+		p += l
+		if p+int(tl) > len(buf) {
+			return nil, nil, nil, errInconsistent
+		}
+		if blockTxAddresses[i], err = unpackTxAddresses(buf[p : p+int(tl)]); err != nil {
+			return nil, nil, nil, err
+		}
+		p += int(tl)
+	}
+	return block, blockTxIDs, blockTxAddresses, nil
+}
+
+// connectShardBlock performs the outputs pass of the block and stores its results to the shard db s,
+// the rows computed from the outputs are stored as a write batch of the shard under the height of the block
+func (d *RocksDB) connectShardBlock(s *RocksDB, block *bchain.Block) error {
+	blockTxIDs, blockTxAddresses, err := d.processOutputsUTXO(block)
+	if err != nil {
+		return err
+	}
+	buf, err := d.packShardBlock(block, blockTxIDs, blockTxAddresses)
+	if err != nil {
+		return err
+	}
+	// dust and coinjoin txs and script templates are computed only from the outputs of the block transactions
+	txAddressesMap := make(map[string]*TxAddresses, len(block.Txs))
+	for i := range block.Txs {
+		txAddressesMap[string(d.txAddressesKey(blockTxIDs[i], block.Txs[i].Txid, block.Height))] = blockTxAddresses[i]
+	}
+	rows := gorocksdb.NewWriteBatch()
+	defer rows.Destroy()
+	if err := s.storeDustTxs(rows, d.computeDustTxs(block, txAddressesMap)); err != nil {
+		return err
+	}
+	s.storeCoinjoinTxs(rows, d.computeCoinjoinTxs(block, txAddressesMap))
+	if err := s.storeScriptTemplateOutpoints(rows, block.Height, d.computeScriptTemplateOutpoints(block, txAddressesMap)); err != nil {
+		return err
+	}
+	if err := s.storeRewards(rows, d.computeRewards(block)); err != nil {
+		return err
+	}
+	if err := s.storeScriptAnnotations(rows, d.computeScriptAnnotations(block)); err != nil {
+		return err
+	}
+	s.storeNameOps(rows, d.computeNameOps(block))
+	s.storePaymentIDs(rows, d.computePaymentIDs(block))
+	s.storeBlockBurns(rows, block.Height, d.computeBlockBurns(block, txAddressesMap))
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	wb.PutCF(s.cfh[cfBlockTxs], packUint(block.Height), buf)
+	wb.PutCF(s.cfh[cfDefault], packUint(block.Height), rows.Data())
+	return s.db.Write(s.wo, wb)
+}
+
+// copyShardRows copies the rows computed by the outputs pass of the block from the shard db s to the index
+func (d *RocksDB) copyShardRows(s *RocksDB, height uint32) error {
+	val, err := s.db.GetCF(s.ro, s.cfh[cfDefault], packUint(height))
+	if err != nil {
+		return err
+	}
+	defer val.Free()
+	if val.Size() == 0 {
+		return errors.Errorf("Rows of block %d not found in shard %v", height, s.path)
+	}
+	ids, err := s.columnIDs()
+	if err != nil {
+		return err
+	}
+	rows := gorocksdb.WriteBatchFrom(val.Data())
+	defer rows.Destroy()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	it := rows.NewIterator()
+	for it.Next() {
+		r := it.Record()
+		column, found := ids[r.CF]
+		if !found {
+			return errors.Errorf("Unknown column family id %v in shard %v", r.CF, s.path)
+		}
+		switch r.Type {
+		case gorocksdb.WriteBatchValueRecord, gorocksdb.WriteBatchCFValueRecord:
+			wb.PutCF(d.cfh[column], r.Key, r.Value)
+		case gorocksdb.WriteBatchDeletionRecord, gorocksdb.WriteBatchCFDeletionRecord:
+			wb.DeleteCF(d.cfh[column], r.Key)
+		default:
+			return errors.Errorf("Unsupported write batch record type %v in shard %v", r.Type, s.path)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return d.db.Write(d.wo, wb)
+}
+
+// connectShardBlock copies the rows of the block of given height stored in the shard db s to the index
+// and performs the inputs pass of the block
+func (b *BulkConnect) connectShardBlock(s *RocksDB, height uint32, storeBlockTxs bool) (err error) {
+	b.height = height
+	defer func(start time.Time) {
+		if err == nil {
+			b.d.observeConnectBlockStats(height, time.Since(start))
+		}
+	}(time.Now())
+	val, err := s.db.GetCF(s.ro, s.cfh[cfBlockTxs], packUint(height))
+	if err != nil {
+		return err
+	}
+	defer val.Free()
+	if val.Size() == 0 {
+		return errors.Errorf("Block %d not found in shard %v", height, s.path)
+	}
+	block, blockTxIDs, blockTxAddresses, err := b.d.unpackShardBlock(height, val.Data())
+	if err != nil {
+		return err
+	}
+	if err := b.d.copyShardRows(s, height); err != nil {
+		return err
+	}
+	addresses := make(map[string][]outpoint)
+	if err := b.d.processTxAddressesUTXO(block, blockTxIDs, blockTxAddresses, addresses, b.txAddressesMap, b.balances); err != nil {
+		return err
+	}
+	b.d.checkWatchedAddresses(block.Height, addresses)
+	b.d.checkMultisigWallets(block, addresses)
+	// the burns of the block were copied from the shard, only the totals are updated in order
+	burns, err := b.d.getBlockBurns(height)
+	if err != nil {
+		return err
+	}
+	if err := b.d.updateBurnTotals(b.burnTotals, burns, false); err != nil {
+		return err
+	}
+	supply, err := b.computeBlockSupply(block)
+	if err != nil {
+		return err
+	}
+	return b.connectBulkAddresses(bulkAddresses{
+		bi: BlockInfo{
+			Hash:   block.Hash,
+			Time:   block.Time,
+			Txs:    uint32(len(block.Txs)),
+			Size:   uint32(block.Size),
+			Height: block.Height,
+		},
+		addresses: addresses,
+		fees:      b.d.computeBlockFeeStats(block, b.txAddressesMap),
+		supply:    supply,
+		largest:   b.d.computeShardLargestTxs(block, blockTxAddresses),
+	}, block, storeBlockTxs)
+}
+
+// ConnectBlocksSharded is an experimental alternative of ConnectBlocksParallel for UTXO chains
+// the range lower-higher is split to w.syncShards disjoint ranges, the outputs pass of the ranges runs in parallel,
+// then the inputs pass runs sequentially over the whole range
+func (w *SyncWorker) ConnectBlocksSharded(lower, higher uint32) error {
+	if err := w.db.checkShardedSync(); err != nil {
+		return err
+	}
+	shards := uint32(w.syncShards)
+	if shards > higher-lower+1 {
+		shards = higher - lower + 1
+	}
+	size := (higher - lower + 1) / shards
+	dbs := make([]*RocksDB, shards)
+	defer func() {
+		for _, s := range dbs {
+			if s != nil {
+				if err := closeShard(s); err != nil {
+					glog.Error("sync: closeShard error ", err)
+				}
+			}
+		}
+		os.RemoveAll(w.db.shardsPath())
+	}()
+	var err error
+	for i := range dbs {
+		if dbs[i], err = w.db.openShard(i); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	terminating := make(chan struct{})
+	errs := make(chan error, shards)
+	var wg sync.WaitGroup
+	for i := uint32(0); i < shards; i++ {
+		from := lower + i*size
+		to := from + size - 1
+		if i == shards-1 {
+			to = higher
+		}
+		wg.Add(1)
+		go func(s *RocksDB, from, to uint32) {
+			defer wg.Done()
+			errs <- w.connectShard(s, from, to, terminating)
+		}(dbs[i], from, to)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-w.chanOsSignal:
+		close(terminating)
+		<-done
+		return errors.New("connectBlocksSharded interrupted in the outputs pass")
+	case <-w.chanStop:
+		close(terminating)
+		<-done
+		return errors.New("connectBlocksSharded interrupted in the outputs pass")
+	case <-done:
+	}
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	glog.Info("sync: outputs pass of blocks ", lower, "-", higher, " finished in ", time.Since(start))
+	if w.dryRun {
+		return nil
+	}
+	bc, err := w.db.InitBulkConnect()
+	if err != nil {
+		return err
+	}
+	keep := uint32(w.chain.GetChainParser().KeepBlockAddresses())
+	start = time.Now()
+	for h := lower; h <= higher; h++ {
+		select {
+		case <-w.chanOsSignal:
+			// the blocks connected so far are stored by Close, the sync continues from the next block
+			if err = bc.Close(); err != nil {
+				glog.Error("sync: bulkconnect.Close error ", err)
+			}
+			return errors.Errorf("connectBlocksSharded interrupted at height %d", h)
+		case <-w.chanStop:
+			if err = bc.Close(); err != nil {
+				glog.Error("sync: bulkconnect.Close error ", err)
+			}
+			return errors.Errorf("connectBlocksSharded interrupted at height %d", h)
+		default:
+		}
+		if !w.throttleBlock(w.chanOsSignal, nil) {
+			if err = bc.Close(); err != nil {
+				glog.Error("sync: bulkconnect.Close error ", err)
+			}
+			return errors.Errorf("connectBlocksSharded interrupted at height %d", h)
+		}
+		i := (h - lower) / size
+		if i >= shards {
+			i = shards - 1
+		}
+		if err = bc.connectShardBlock(dbs[i], h, h+keep > higher); err != nil {
+			return err
+		}
+		if h > 0 && h%1000 == 0 {
+			glog.Info("connected block ", h, ", elapsed ", time.Since(start))
+			start = time.Now()
+		}
+		if h == higher {
+			// prevent overflow of h if higher is the maximum uint32
+			break
+		}
+	}
+	return bc.Close()
+}
+
+// connectShard fetches the blocks from-to and stores the results of their outputs pass to the shard db s
+func (w *SyncWorker) connectShard(s *RocksDB, from, to uint32, terminating chan struct{}) error {
+	start := time.Now()
+	for h := from; h <= to; h++ {
+		var block *bchain.Block
+		for {
+			select {
+			case <-terminating:
+				return nil
+			default:
+			}
+			hash, err := w.chain.GetBlockHash(h)
+			if err == nil {
+				block, err = w.chain.GetBlock(hash, h)
+			}
+			if err == nil {
+				break
+			}
+			glog.Error("connectShard ", from, "-", to, " block ", h, " error ", err, ". Retrying...")
+			w.metrics.IndexResyncErrors.With(common.Labels{"error": err.Error()}).Inc()
+			time.Sleep(time.Millisecond * 500)
+		}
+		if !w.dryRun {
+			if err := w.db.connectShardBlock(s, block); err != nil {
+				return err
+			}
+		}
+		if h > from && (h-from)%1000 == 0 {
+			glog.Info("shard ", from, "-", to, ": processed outputs of block ", h, ", elapsed ", time.Since(start))
+		}
+		if h == to {
+			break
+		}
+	}
+	glog.Info("shard ", from, "-", to, ": outputs pass finished in ", time.Since(start))
+	return nil
+}
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+const silentPaymentTweakLen = 32
+
+// SilentPaymentsWallet is a silent payments (BIP352) wallet, the outputs paying to which are detected during block connect,
+// ScanKey is the 32 bytes scan private key and SpendPubKey the 33 bytes compressed spend public key of the wallet
+type SilentPaymentsWallet struct {
+	Name        string
+	ScanKey     []byte
+	SpendPubKey []byte
+}
+
+// NewSilentPaymentsWallet creates the wallet from the hex encoded keys
+func NewSilentPaymentsWallet(name, scanKey, spendPubKey string) (*SilentPaymentsWallet, error) {
+	if name == "" {
+		return nil, errors.New("Missing wallet name")
+	}
+	w := &SilentPaymentsWallet{Name: name}
+	var err error
+	if w.ScanKey, err = hex.DecodeString(scanKey); err != nil || len(w.ScanKey) != 32 {
+		return nil, errors.Errorf("Wallet %v: scan key must be 32 hex encoded bytes", name)
+	}
+	if w.SpendPubKey, err = hex.DecodeString(spendPubKey); err != nil || len(w.SpendPubKey) != 33 {
+		return nil, errors.Errorf("Wallet %v: spend public key must be 33 hex encoded bytes (compressed key)", name)
+	}
+	return w, nil
+}
+
+// SilentPayment is an output paying to a silent payments wallet, Tweak is the tweak of the spend key needed to spend the output
+type SilentPayment struct {
+	Wallet   string
+	Height   uint32
+	Txid     string
+	Vout     uint32
+	K        uint32
+	ValueSat big.Int
+	Tweak    []byte
+}
+
+// silentPaymentOutput is the detected output before it is stored, btxID is the packed txid
+type silentPaymentOutput struct {
+	wallet string
+	height uint32
+	btxID  []byte
+	match  bchain.SilentPaymentMatch
+	value  big.Int
+}
+
+// SetSilentPaymentsWallets enables the detection of the outputs paying to the wallets during block connect, nil disables it
+// the detection needs the witness data of the block transactions, the sharded sync is refused when it is enabled
+func (d *RocksDB) SetSilentPaymentsWallets(wallets []*SilentPaymentsWallet) {
+	d.silentPayments = wallets
+}
+
+// GetSilentPaymentsWallet returns the configured wallet with the name or nil
+func (d *RocksDB) GetSilentPaymentsWallet(name string) *SilentPaymentsWallet {
+	for _, w := range d.silentPayments {
+		if w.Name == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// scanSilentPayments detects the outputs of the block transactions paying to the wallets,
+// getTxAddresses returns the processed txAddresses of the transaction, whose inputs contain the spent output scripts
+func (d *RocksDB) scanSilentPayments(block *bchain.Block, wallets []*SilentPaymentsWallet, getTxAddresses func(btxID []byte, txid string) (*TxAddresses, error)) ([]silentPaymentOutput, error) {
+	var r []silentPaymentOutput
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		if len(tx.Vin) == 0 || tx.Vin[0].Coinbase != "" {
+			continue
+		}
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		ta, err := getTxAddresses(btxID, tx.Txid)
+		if err != nil {
+			return nil, err
+		}
+		if ta == nil || len(ta.Inputs) != len(tx.Vin) {
+			continue
+		}
+		prevouts := make([]bchain.AddressDescriptor, len(ta.Inputs))
+		for j := range ta.Inputs {
+			prevouts[j] = ta.Inputs[j].AddrDesc
+		}
+		for _, w := range wallets {
+			matches, err := d.chainParser.ScanSilentPayments(tx, prevouts, w.ScanKey, w.SpendPubKey)
+			if err != nil {
+				if err == bchain.ErrNotSupported {
+					return nil, err
+				}
+				glog.V(1).Info("rocksdb: silent payments of tx ", tx.Txid, ": ", err)
+				continue
+			}
+			for _, m := range matches {
+				if int(m.Vout) >= len(ta.Outputs) {
+					continue
+				}
+				r = append(r, silentPaymentOutput{
+					wallet: w.Name,
+					height: block.Height,
+					btxID:  btxID,
+					match:  m,
+					value:  ta.Outputs[m.Vout].ValueSat,
+				})
+			}
+		}
+	}
+	return r, nil
+}
+
+// computeSilentPayments detects the outputs paying to the configured wallets,
+// it must be called after processAddressesUTXO, the txAddressesMap must contain the block transactions
+func (d *RocksDB) computeSilentPayments(block *bchain.Block, txAddressesMap map[string]*TxAddresses) []silentPaymentOutput {
+	if len(d.silentPayments) == 0 {
+		return nil
+	}
+	r, err := d.scanSilentPayments(block, d.silentPayments, func(btxID []byte, txid string) (*TxAddresses, error) {
+		return txAddressesMap[string(d.txAddressesKey(btxID, txid, block.Height))], nil
+	})
+	if err != nil {
+		glog.Error("rocksdb: silent payments of block ", block.Height, ": ", err)
+	}
+	return r
+}
+
+func (d *RocksDB) packSilentPaymentKey(wallet string, height uint32, btxID []byte, vout uint32) []byte {
+	key := append(packString(wallet, nil), packUint(height)...)
+	key = append(key, btxID...)
+	varBuf := make([]byte, vlq.MaxLen32)
+	l := packVaruint(uint(vout), varBuf)
+	return append(key, varBuf[:l]...)
+}
+
+func (d *RocksDB) unpackSilentPaymentKey(key []byte, sp *SilentPayment) error {
+	var l int
+	var err error
+	if sp.Wallet, l, err = unpackString(key); err != nil {
+		return err
+	}
+	pl := d.chainParser.PackedTxidLen()
+	if len(key) < l+4+pl+1 {
+		return errors.New("Invalid silent payment key")
+	}
+	sp.Height = unpackUint(key[l:])
+	l += 4
+	if sp.Txid, err = d.chainParser.UnpackTxid(key[l : l+pl]); err != nil {
+		return err
+	}
+	vout, ll := unpackVaruint(key[l+pl:])
+	if ll <= 0 {
+		return errors.New("Invalid silent payment key")
+	}
+	sp.Vout = uint32(vout)
+	return nil
+}
+
+func packSilentPayment(o *silentPaymentOutput) []byte {
+	buf := make([]byte, maxPackedBigintBytes+vlq.MaxLen32)
+	l := packBigint(&o.value, buf)
+	l += packVaruint(uint(o.match.K), buf[l:])
+	return append(buf[:l], o.match.Tweak...)
+}
+
+func unpackSilentPayment(buf []byte, sp *SilentPayment) error {
+	if len(buf) == 0 || 1+int(buf[0]) > len(buf) {
+		return errors.New("Invalid packed silent payment")
+	}
+	var l int
+	sp.ValueSat, l = unpackBigint(buf)
+	k, ll := unpackVaruint(buf[l:])
+	if ll <= 0 || len(buf) != l+ll+silentPaymentTweakLen {
+		return errors.New("Invalid packed silent payment")
+	}
+	sp.K = uint32(k)
+	sp.Tweak = append([]byte(nil), buf[l+ll:]...)
+	return nil
+}
+
+func (d *RocksDB) storeSilentPayments(wb *gorocksdb.WriteBatch, outputs []silentPaymentOutput) {
+	for i := range outputs {
+		o := &outputs[i]
+		if len(o.match.Tweak) != silentPaymentTweakLen {
+			continue
+		}
+		wb.PutCF(d.cfh[cfSilentPayments], d.packSilentPaymentKey(o.wallet, o.height, o.btxID, o.match.Vout), packSilentPayment(o))
+	}
+}
+
+// silentPaymentsWallets returns the names of the wallets with stored outputs, including the wallets no longer configured
+func (d *RocksDB) silentPaymentsWallets() ([]string, error) {
+	var r []string
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfSilentPayments])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		w, _, err := unpackString(it.Key().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "silent payment %x", it.Key().Data())
+		}
+		// the keys are ordered by the wallet
+		if len(r) == 0 || r[len(r)-1] != w {
+			r = append(r, w)
+		}
+	}
+	return r, nil
+}
+
+// deleteSilentPayments deletes the outputs of all wallets in the blocks lower..higher
+func (d *RocksDB) deleteSilentPayments(wb *gorocksdb.WriteBatch, lower uint32, higher uint32) error {
+	wallets, err := d.silentPaymentsWallets()
+	if err != nil {
+		return err
+	}
+	for _, w := range wallets {
+		d.deleteHeightRange(wb, cfSilentPayments, packString(w, nil), lower, higher)
+	}
+	return nil
+}
+
+// RescanSilentPayments detects the outputs of the already connected block paying to the wallet and stores them,
+// the block must be read from the backend including the witness data, returns the number of found outputs
+func (d *RocksDB) RescanSilentPayments(block *bchain.Block, wallet *SilentPaymentsWallet) (int, error) {
+	if err := d.enterHandle(); err != nil {
+		return 0, err
+	}
+	defer d.releaseHandle()
+	outputs, err := d.scanSilentPayments(block, []*SilentPaymentsWallet{wallet}, func(btxID []byte, txid string) (*TxAddresses, error) {
+		return d.getTxAddresses(d.txAddressesKey(btxID, txid, block.Height))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(outputs) == 0 {
+		return 0, nil
+	}
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	d.storeSilentPayments(wb, outputs)
+	return len(outputs), d.db.Write(d.wo, wb)
+}
+
+// GetSilentPayments returns the stored outputs paying to the wallet ordered by height
+func (d *RocksDB) GetSilentPayments(wallet string) (r []SilentPayment, err error) {
+	defer func(s time.Time) { d.observeMethod("GetSilentPayments", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	r = []SilentPayment{}
+	prefix := packString(wallet, nil)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfSilentPayments])
+	defer it.Close()
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		var sp SilentPayment
+		if err = d.unpackSilentPaymentKey(key, &sp); err != nil {
+			return nil, errors.Annotatef(err, "silent payment %x", key)
+		}
+		if err = unpackSilentPayment(it.Value().Data(), &sp); err != nil {
+			return nil, errors.Annotatef(err, "silent payment %x", key)
+		}
+		r = append(r, sp)
+	}
+	return r, nil
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	// DefaultReadSnapshotTTL is used if no ttl is specified when creating read snapshot
+	DefaultReadSnapshotTTL = time.Minute
+	// MaxReadSnapshotTTL is the maximal time a read snapshot can be pinned
+	MaxReadSnapshotTTL = 10 * time.Minute
+	// maximal number of concurrently pinned snapshots, each snapshot prevents compaction of the changed data
+	maxReadSnapshots = 64
+	// MaxReadSnapshotsPerOwner is the maximal number of concurrently pinned snapshots created by one owner (client)
+	MaxReadSnapshotsPerOwner = 4
+)
+
+// ReadSnapshot is a handle to a pinned point-in-time state of the database
+type ReadSnapshot struct {
+	ID         string
+	Expires    time.Time
+	BestHeight uint32
+	BestHash   string
+	owner      string
+	snapshot   *gorocksdb.Snapshot
+	ro         *gorocksdb.ReadOptions
+	// readers is the number of the views in use, the snapshot removed by release or expiry is destroyed after the last view is done
+	readers int
+	removed bool
+}
+
+type readSnapshots struct {
+	mux sync.Mutex
+	// m contains the snapshots until they are destroyed, the removed snapshots only until their last view is done
+	m map[string]*ReadSnapshot
+}
+
+// CreateReadSnapshot pins the current state of the database for the time ttl, owner identifies the creator (client),
+// who can pin at most MaxReadSnapshotsPerOwner snapshots at once;
+// the returned snapshot can be used by ReadSnapshotView to get consistent results of multiple queries
+func (d *RocksDB) CreateReadSnapshot(ttl time.Duration, owner string) (*ReadSnapshot, error) {
+	if err := d.enterHandle(); err != nil {
+		return nil, err
+	}
+	defer d.releaseHandle()
+	if ttl <= 0 {
+		ttl = DefaultReadSnapshotTTL
+	} else if ttl > MaxReadSnapshotTTL {
+		ttl = MaxReadSnapshotTTL
+	}
+	d.snapshots.mux.Lock()
+	defer d.snapshots.mux.Unlock()
+	d.releaseExpiredReadSnapshots()
+	pinned, owned := 0, 0
+	for _, s := range d.snapshots.m {
+		if !s.removed {
+			pinned++
+			if s.owner == owner {
+				owned++
+			}
+		}
+	}
+	if pinned >= maxReadSnapshots {
+		return nil, errors.New("Too many read snapshots")
+	}
+	if owned >= MaxReadSnapshotsPerOwner {
+		return nil, errors.New("Too many read snapshots of the client")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	s := &ReadSnapshot{
+		ID:       hex.EncodeToString(id),
+		Expires:  time.Now().Add(ttl),
+		owner:    owner,
+		snapshot: d.db.NewSnapshot(),
+		ro:       gorocksdb.NewDefaultReadOptions(),
+	}
+	s.ro.SetFillCache(false)
+	s.ro.SetSnapshot(s.snapshot)
+	var err error
+	if s.BestHeight, s.BestHash, err = d.readSnapshotView(s).GetBestBlock(); err != nil {
+		d.releaseReadSnapshot(s)
+		return nil, err
+	}
+	if d.snapshots.m == nil {
+		d.snapshots.m = make(map[string]*ReadSnapshot)
+	}
+	d.snapshots.m[s.ID] = s
+	glog.V(1).Info("rocksdb: created read snapshot ", s.ID, " at height ", s.BestHeight)
+	return s, nil
+}
+
+// ReadSnapshotView returns handle to the database, which reads the data from the pinned snapshot with given id,
+// the view must be used only for reading and DoneReadSnapshotView must be called when the view is no longer used;
+// the snapshot is kept until then even if it expires or is released
+func (d *RocksDB) ReadSnapshotView(id string) (*RocksDB, *ReadSnapshot, error) {
+	d.snapshots.mux.Lock()
+	defer d.snapshots.mux.Unlock()
+	d.releaseExpiredReadSnapshots()
+	s, found := d.snapshots.m[id]
+	if !found || s.removed {
+		return nil, nil, errors.New("Read snapshot not found or expired")
+	}
+	s.readers++
+	return d.readSnapshotView(s), s, nil
+}
+
+// DoneReadSnapshotView ends the use of the view returned by ReadSnapshotView
+func (d *RocksDB) DoneReadSnapshotView(s *ReadSnapshot) {
+	d.snapshots.mux.Lock()
+	defer d.snapshots.mux.Unlock()
+	if s.readers > 0 {
+		s.readers--
+	}
+	if s.readers == 0 && s.removed {
+		d.destroyReadSnapshot(s)
+	}
+}
+
+// ReleaseReadSnapshot releases the snapshot with given id before it expires
+func (d *RocksDB) ReleaseReadSnapshot(id string) error {
+	d.snapshots.mux.Lock()
+	defer d.snapshots.mux.Unlock()
+	s, found := d.snapshots.m[id]
+	if !found || s.removed {
+		return errors.New("Read snapshot not found or expired")
+	}
+	d.releaseReadSnapshot(s)
+	return nil
+}
+
+func (d *RocksDB) readSnapshotView(s *ReadSnapshot) *RocksDB {
+	return &RocksDB{
+		path:            d.path,
+		db:              d.db,
+		wo:              d.wo,
+		ro:              s.ro,
+		cfh:             d.cfh,
+		chainParser:     d.chainParser,
+		is:              d.is,
+		metrics:         d.metrics,
+		cache:           d.cache,
+		maxOpenFiles:    d.maxOpenFiles,
+		dust:            d.dust,
+		scriptTemplates: d.scriptTemplates,
+		handle:          d.handle,
+		txStore:         d.txStore,
+		txDeletes:       d.txDeletes,
+	}
+}
+
+// releaseReadSnapshot removes the snapshot, which is destroyed now or after its last view is done,
+// it must be called with the lock held
+func (d *RocksDB) releaseReadSnapshot(s *ReadSnapshot) {
+	s.removed = true
+	if s.readers == 0 {
+		d.destroyReadSnapshot(s)
+	}
+}
+
+// destroyReadSnapshot must be called with the lock held
+func (d *RocksDB) destroyReadSnapshot(s *ReadSnapshot) {
+	if s.ro == nil {
+		return
+	}
+	delete(d.snapshots.m, s.ID)
+	s.ro.Destroy()
+	d.db.ReleaseSnapshot(s.snapshot)
+	s.ro = nil
+	s.snapshot = nil
+	glog.V(1).Info("rocksdb: released read snapshot ", s.ID)
+}
+
+// releaseExpiredReadSnapshots must be called with the lock held
+func (d *RocksDB) releaseExpiredReadSnapshots() {
+	now := time.Now()
+	for _, s := range d.snapshots.m {
+		if !s.removed && s.Expires.Before(now) {
+			d.releaseReadSnapshot(s)
+		}
+	}
+}
+
+// releaseAllReadSnapshots is called before the database is closed, after the calls in progress finished,
+// the snapshots are destroyed regardless of their views, which cannot be used after the close of the database anyway
+func (d *RocksDB) releaseAllReadSnapshots() {
+	d.snapshots.mux.Lock()
+	defer d.snapshots.mux.Unlock()
+	for _, s := range d.snapshots.m {
+		s.removed = true
+		d.destroyReadSnapshot(s)
+	}
+}
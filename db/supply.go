@@ -0,0 +1,200 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"math/big"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// BlockSupply is the change of the coin supply made by a block, the coins created by the block are the outputs
+// of its transactions minus their inputs, Burned is the value of the unspendable outputs of the block,
+// Total is the sum of the supply changes of the indexed blocks up to and including the block
+type BlockSupply struct {
+	Height     uint32
+	OutputsSat big.Int
+	InputsSat  big.Int
+	BurnedSat  big.Int
+	Total      IndexedSupply
+}
+
+// IndexedSupply is the sum of the supply changes of the indexed blocks in the range FromHeight-ToHeight
+type IndexedSupply struct {
+	FromHeight uint32
+	ToHeight   uint32
+	Blocks     uint32
+	OutputsSat big.Int
+	InputsSat  big.Int
+	BurnedSat  big.Int
+}
+
+// SetBlockSupply enables the recording of the supply changes of the blocks in the blockSupply column during the block connect,
+// the totals start at the first block connected after it was enabled
+func (d *RocksDB) SetBlockSupply(enabled bool) {
+	d.blockSupply = enabled
+}
+
+// BlockSupplyEnabled returns true if the supply changes of the blocks are recorded
+func (d *RocksDB) BlockSupplyEnabled() bool {
+	return d.blockSupply
+}
+
+// computeBlockSupply computes the supply change of the block from the already processed txAddresses
+// it must be called after processAddressesUTXO, the txAddressesMap must contain the block transactions
+// the inputs not found in the index have zero value, they are counted as created coins
+// the totals are the totals of prev, the supply change of the last indexed block before the block, plus the change of the block
+func (d *RocksDB) computeBlockSupply(block *bchain.Block, txAddressesMap map[string]*TxAddresses, prev *BlockSupply) *BlockSupply {
+	bs := &BlockSupply{Height: block.Height}
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		if err != nil {
+			continue
+		}
+		ta := txAddressesMap[string(d.txAddressesKey(btxID, tx.Txid, block.Height))]
+		if ta == nil {
+			continue
+		}
+		for j := range ta.Inputs {
+			bs.InputsSat.Add(&bs.InputsSat, &ta.Inputs[j].ValueSat)
+		}
+		for j := range ta.Outputs {
+			o := &ta.Outputs[j]
+			bs.OutputsSat.Add(&bs.OutputsSat, &o.ValueSat)
+			if d.chainParser.IsAddrDescUnspendable(o.AddrDesc) {
+				bs.BurnedSat.Add(&bs.BurnedSat, &o.ValueSat)
+			}
+		}
+	}
+	bs.addTotal(prev)
+	return bs
+}
+
+// addTotal sets the totals of the block supply change to the totals of prev plus the change of the block
+func (bs *BlockSupply) addTotal(prev *BlockSupply) {
+	t := &bs.Total
+	if prev != nil {
+		t.FromHeight = prev.Total.FromHeight
+		t.Blocks = prev.Total.Blocks
+		t.OutputsSat.Set(&prev.Total.OutputsSat)
+		t.InputsSat.Set(&prev.Total.InputsSat)
+		t.BurnedSat.Set(&prev.Total.BurnedSat)
+	} else {
+		t.FromHeight = bs.Height
+		t.Blocks = 0
+		t.OutputsSat.SetInt64(0)
+		t.InputsSat.SetInt64(0)
+		t.BurnedSat.SetInt64(0)
+	}
+	t.ToHeight = bs.Height
+	t.Blocks++
+	t.OutputsSat.Add(&t.OutputsSat, &bs.OutputsSat)
+	t.InputsSat.Add(&t.InputsSat, &bs.InputsSat)
+	t.BurnedSat.Add(&t.BurnedSat, &bs.BurnedSat)
+}
+
+func packBlockSupply(bs *BlockSupply) []byte {
+	buf := make([]byte, 0, 80)
+	varBuf := make([]byte, maxPackedBigintBytes)
+	for _, v := range []*big.Int{&bs.OutputsSat, &bs.InputsSat, &bs.BurnedSat} {
+		l := packBigint(v, varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	buf = append(buf, packUint(bs.Total.FromHeight)...)
+	buf = append(buf, packUint(bs.Total.Blocks)...)
+	for _, v := range []*big.Int{&bs.Total.OutputsSat, &bs.Total.InputsSat, &bs.Total.BurnedSat} {
+		l := packBigint(v, varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf
+}
+
+// unpackBigints unpacks the bigints from the start of the buffer and returns the number of the unpacked bytes
+func unpackBigints(buf []byte, values ...*big.Int) (int, error) {
+	l := 0
+	for _, v := range values {
+		if l >= len(buf) || l+1+int(buf[l]) > len(buf) {
+			return 0, errors.New("Invalid block supply")
+		}
+		var ll int
+		*v, ll = unpackBigint(buf[l:])
+		l += ll
+	}
+	return l, nil
+}
+
+func unpackBlockSupply(height uint32, buf []byte) (*BlockSupply, error) {
+	bs := &BlockSupply{Height: height}
+	l, err := unpackBigints(buf, &bs.OutputsSat, &bs.InputsSat, &bs.BurnedSat)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < l+2*packedHeightBytes {
+		return nil, errors.New("Invalid block supply")
+	}
+	bs.Total.FromHeight = unpackUint(buf[l:])
+	bs.Total.Blocks = unpackUint(buf[l+packedHeightBytes:])
+	bs.Total.ToHeight = height
+	if _, err = unpackBigints(buf[l+2*packedHeightBytes:], &bs.Total.OutputsSat, &bs.Total.InputsSat, &bs.Total.BurnedSat); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+func (d *RocksDB) storeBlockSupply(wb *gorocksdb.WriteBatch, bs *BlockSupply) {
+	if bs == nil {
+		return
+	}
+	wb.PutCF(d.cfh[cfBlockSupply], packUint(bs.Height), packBlockSupply(bs))
+}
+
+// getBlockSupplyUpTo returns the supply change of the last block up to the height recorded in the column, nil if there is none
+func (d *RocksDB) getBlockSupplyUpTo(height uint32) (*BlockSupply, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBlockSupply])
+	defer it.Close()
+	it.SeekForPrev(packUint(height))
+	if !it.Valid() {
+		return nil, nil
+	}
+	h := unpackUint(it.Key().Data())
+	bs, err := unpackBlockSupply(h, it.Value().Data())
+	if err != nil {
+		return nil, errors.Annotatef(err, "height %v", h)
+	}
+	return bs, nil
+}
+
+// getPrevBlockSupply returns the supply change of the last block below the height recorded in the column, nil if there is none
+func (d *RocksDB) getPrevBlockSupply(height uint32) (*BlockSupply, error) {
+	if height == 0 {
+		return nil, nil
+	}
+	return d.getBlockSupplyUpTo(height - 1)
+}
+
+// prevBlockSupply returns the supply change of the last recorded block below the height, the base of the totals of the block,
+// the supply change of the last connected block is kept in memory, the db is read after the start and the disconnect of blocks
+func (d *RocksDB) prevBlockSupply(height uint32) (*BlockSupply, error) {
+	if d.lastSupply != nil && d.lastSupply.Height < height {
+		return d.lastSupply, nil
+	}
+	return d.getPrevBlockSupply(height)
+}
+
+// GetIndexedSupply returns the sum of the supply changes of the indexed blocks up to the height,
+// which is kept in the record of the last block up to the height,
+// returns nil if no block up to the height has the supply change recorded
+func (d *RocksDB) GetIndexedSupply(height uint32) (r *IndexedSupply, err error) {
+	defer func(s time.Time) { d.observeMethod("GetIndexedSupply", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	bs, err := d.getBlockSupplyUpTo(height)
+	if err != nil || bs == nil {
+		return nil, err
+	}
+	return &bs.Total, nil
+}
@@ -17,10 +17,15 @@ type SyncWorker struct {
 	db                     *RocksDB
 	chain                  bchain.BlockChain
 	syncWorkers, syncChunk int
+	syncShards             int
+	throttle               *SyncThrottle
+	throttleNext           time.Time
 	dryRun                 bool
 	startHeight            uint32
 	startHash              string
 	chanOsSignal           chan os.Signal
+	chanStop               chan struct{}
+	stopOnce               sync.Once
 	metrics                *common.Metrics
 	is                     *common.InternalState
 }
@@ -38,18 +43,38 @@ func NewSyncWorker(db *RocksDB, chain bchain.BlockChain, syncWorkers, syncChunk
 		dryRun:       dryRun,
 		startHeight:  uint32(minStartHeight),
 		chanOsSignal: chanOsSignal,
+		chanStop:     make(chan struct{}),
 		metrics:      metrics,
 		is:           is,
 	}, nil
 }
 
+// SetShards enables the experimental sharded initial sync of UTXO chains, see ConnectBlocksSharded, values lower than 2 disable it,
+// it returns error if an index not supported by the sharded sync is enabled
+func (w *SyncWorker) SetShards(shards int) error {
+	if shards > 1 && w.chain.GetChainParser().IsUTXOChain() {
+		if err := w.db.checkShardedSync(); err != nil {
+			return err
+		}
+	}
+	w.syncShards = shards
+	return nil
+}
+
+// Stop interrupts the running and all following syncs at the next safe point, after the block being connected is stored,
+// it is used by the shutdown after the OS signal was consumed, so that the db can be closed in a consistent state
+func (w *SyncWorker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.chanStop)
+	})
+}
+
 var errSynced = errors.New("synced")
 
 // ResyncIndex synchronizes index to the top of the blockchain
 // onNewBlock is called when new block is connected, but not in initial parallel sync
 func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
 	start := time.Now()
-	w.is.StartedSync()
 
 	err := w.resyncIndex(onNewBlock, initialSync)
 
@@ -61,12 +86,17 @@ func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 		w.metrics.IndexDBSize.Set(float64(w.db.DatabaseSizeOnDisk()))
 		bh, _, err := w.db.GetBestBlock()
 		if err == nil {
-			w.is.FinishedSync(bh)
+			if err = w.is.FinishedSync(bh); err != nil {
+				glog.Error("resync: ", err)
+			}
+			w.storeSyncState()
 		}
 		return nil
 	case errSynced:
 		// this is not actually error but flag that resync wasn't necessary
-		w.is.FinishedSyncNoChange()
+		if err := w.is.FinishedSyncNoChange(); err != nil {
+			glog.Error("resync: ", err)
+		}
 		w.metrics.IndexDBSize.Set(float64(w.db.DatabaseSizeOnDisk()))
 		return nil
 	}
@@ -76,7 +106,36 @@ func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 	return err
 }
 
+// setSyncPhase moves the synchronization to the phase and stores the internal state, so that the phase survives a restart
+func (w *SyncWorker) setSyncPhase(phase common.SyncPhase) {
+	if err := w.is.SetSyncPhase(phase); err != nil {
+		glog.Error("resync: ", err)
+		return
+	}
+	w.storeSyncState()
+}
+
+func (w *SyncWorker) storeSyncState() {
+	if w.dryRun {
+		return
+	}
+	if err := w.db.StoreInternalState(w.is); err != nil {
+		glog.Error("resync: StoreInternalState error ", err)
+	}
+}
+
+// verifiedBestBlock records the best block of the index as the last verified block
+func (w *SyncWorker) verifiedBestBlock() {
+	height, hash, err := w.db.GetBestBlock()
+	if err != nil {
+		glog.Error("resync: GetBestBlock error ", err)
+		return
+	}
+	w.is.SetVerifiedBlock(height, hash)
+}
+
 func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+	w.setSyncPhase(common.SyncPhaseHeaders)
 	remoteBestHash, err := w.chain.GetBestBlockHash()
 	if err != nil {
 		return err
@@ -88,6 +147,7 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 	// If the locally indexed block is the same as the best block on the network, we're done.
 	if localBestHash == remoteBestHash {
 		glog.Infof("resync: synced at %d %s", localBestHeight, localBestHash)
+		w.is.SetVerifiedBlock(localBestHeight, localBestHash)
 		return errSynced
 	}
 	if localBestHash != "" {
@@ -102,6 +162,7 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 			return w.handleFork(localBestHeight, localBestHash, onNewBlock, initialSync)
 		}
 		glog.Info("resync: local at ", localBestHeight, " is behind")
+		w.is.SetVerifiedBlock(localBestHeight, localBestHash)
 		w.startHeight = localBestHeight + 1
 	} else {
 		// database is empty, start genesis
@@ -112,8 +173,9 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 		return err
 	}
 	// if parallel operation is enabled and the number of blocks to be connected is large,
-	// use parallel routine to load majority of blocks
-	if w.syncWorkers > 1 {
+	// use parallel routine to load majority of blocks; the bulk connect does not record the index delta,
+	// with the index delta enabled the blocks are connected one by one
+	if (w.syncWorkers > 1 || w.syncShards > 1) && w.db.indexDeltaBlocks == 0 {
 		remoteBestHeight, err := w.chain.GetBestBlockHeight()
 		if err != nil {
 			return err
@@ -123,16 +185,24 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 			return errors.New("resync: remote best height error")
 		}
 		if remoteBestHeight-w.startHeight > uint32(w.syncChunk) {
-			glog.Infof("resync: parallel sync of blocks %d-%d, using %d workers", w.startHeight, remoteBestHeight, w.syncWorkers)
-			err = w.ConnectBlocksParallel(w.startHeight, remoteBestHeight)
+			w.setSyncPhase(common.SyncPhaseBodies)
+			if w.syncShards > 1 && w.chain.GetChainParser().IsUTXOChain() {
+				glog.Infof("resync: sharded sync of blocks %d-%d, using %d shards", w.startHeight, remoteBestHeight, w.syncShards)
+				err = w.ConnectBlocksSharded(w.startHeight, remoteBestHeight)
+			} else {
+				glog.Infof("resync: parallel sync of blocks %d-%d, using %d workers", w.startHeight, remoteBestHeight, w.syncWorkers)
+				err = w.ConnectBlocksParallel(w.startHeight, remoteBestHeight)
+			}
 			if err != nil {
 				return err
 			}
+			w.verifiedBestBlock()
 			// after parallel load finish the sync using standard way,
 			// new blocks may have been created in the meantime
 			return w.resyncIndex(onNewBlock, initialSync)
 		}
 	}
+	w.setSyncPhase(common.SyncPhaseCatchUp)
 	return w.connectBlocks(onNewBlock, initialSync)
 }
 
@@ -158,10 +228,37 @@ func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, on
 		}
 		hashes = append(hashes, local)
 	}
+	detected := time.Now()
+	w.setSyncPhase(common.SyncPhaseRollback)
 	if err := w.DisconnectBlocks(height+1, localBestHeight, hashes); err != nil {
 		return err
 	}
-	return w.resyncIndex(onNewBlock, initialSync)
+	w.verifiedBestBlock()
+	err := w.resyncIndex(onNewBlock, initialSync)
+	w.recordReorg(localBestHeight, localBestHash, height, detected)
+	return err
+}
+
+// recordReorg stores the record of the handled reorganization and updates the metrics,
+// the new tip is the best block of the index after the resync which followed the disconnect of the forked blocks
+func (w *SyncWorker) recordReorg(oldTipHeight uint32, oldTipHash string, forkHeight uint32, detected time.Time) {
+	e := ReorgEvent{
+		OldTipHeight: oldTipHeight,
+		OldTipHash:   oldTipHash,
+		ForkHeight:   forkHeight,
+		Depth:        oldTipHeight - forkHeight,
+		Detected:     detected.Unix(),
+		Resolved:     time.Now().Unix(),
+	}
+	var err error
+	if e.NewTipHeight, e.NewTipHash, err = w.db.GetBestBlock(); err != nil {
+		glog.Error("resync: reorg at height ", forkHeight, ", GetBestBlock error ", err)
+	}
+	glog.Infof("resync: reorg of depth %d at height %d, old tip %d %s, new tip %d %s", e.Depth, forkHeight, e.OldTipHeight, e.OldTipHash, e.NewTipHeight, e.NewTipHash)
+	w.metrics.ReorgDepth.Observe(float64(e.Depth))
+	if err = w.db.StoreReorgEvent(&e, detected.UnixNano()); err != nil {
+		glog.Error("resync: StoreReorgEvent error ", err)
+	}
 }
 
 func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
@@ -173,15 +270,26 @@ func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync
 
 	var lastRes, empty blockResult
 
+	// while regular sync, OS sig is handled by waitForSignalAndShutdown, which stops the worker
+	var chanOsSignal chan os.Signal
+	if initialSync {
+		chanOsSignal = w.chanOsSignal
+	}
+
 	connect := func(res blockResult) error {
 		lastRes = res
 		if res.err != nil {
 			return res.err
 		}
+		if !w.throttleBlock(chanOsSignal, nil) {
+			return errors.Errorf("connectBlocks interrupted at height %d", res.block.Height)
+		}
 		err := w.db.ConnectBlock(res.block)
 		if err != nil {
 			return err
 		}
+		// the blocks are fetched following the link to the next block, the connected block extends the verified chain
+		w.is.SetVerifiedBlock(res.block.Height, res.block.Hash)
 		if onNewBlock != nil {
 			onNewBlock(res.block.Hash, res.block.Height)
 		}
@@ -192,25 +300,23 @@ func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync
 		return nil
 	}
 
-	if initialSync {
-	ConnectLoop:
-		for {
-			select {
-			case <-w.chanOsSignal:
-				return errors.Errorf("connectBlocks interrupted at height %d", lastRes.block.Height)
-			case res := <-bch:
-				if res == empty {
-					break ConnectLoop
-				}
-				err := connect(res)
-				if err != nil {
-					return err
-				}
-			}
+	interrupted := func() error {
+		if lastRes.block == nil {
+			return errors.New("connectBlocks interrupted")
 		}
-	} else {
-		// while regular sync, OS sig is handled by waitForSignalAndShutdown
-		for res := range bch {
+		return errors.Errorf("connectBlocks interrupted at height %d", lastRes.block.Height)
+	}
+ConnectLoop:
+	for {
+		select {
+		case <-chanOsSignal:
+			return interrupted()
+		case <-w.chanStop:
+			return interrupted()
+		case res := <-bch:
+			if res == empty {
+				break ConnectLoop
+			}
 			err := connect(res)
 			if err != nil {
 				return err
@@ -225,19 +331,31 @@ func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync
 	return nil
 }
 
-// ConnectBlocksParallel uses parallel goroutines to get data from blockchain daemon
+// ConnectBlocksParallel fetches the blocks from the backend by concurrent workers and connects them in the bulk mode,
+// the number of the concurrent fetches is tuned up to syncWorkers by the latency of the backend and the backlog of the writer
 func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
+	if w.db.indexDeltaBlocks > 0 {
+		return ErrBulkConnectIndexDelta
+	}
 	type hashHeight struct {
 		hash   string
 		height uint32
 	}
 	var err error
 	var wg sync.WaitGroup
-	bch := make([]chan *bchain.Block, w.syncWorkers)
-	for i := 0; i < w.syncWorkers; i++ {
-		bch[i] = make(chan *bchain.Block)
-	}
-	hch := make(chan hashHeight, w.syncWorkers)
+	fc := newFetchConcurrency(w.syncWorkers, func(limit int) {
+		if w.metrics != nil {
+			w.metrics.IndexSyncConcurrency.Set(float64(limit))
+		}
+		glog.V(1).Info("sync: concurrency of block fetches ", limit)
+	})
+	// the blocks being fetched or waiting for the writer are limited by the window,
+	// the slot is taken before the hash of the block is sent to the workers and returned after the block is connected
+	window := make(chan struct{}, 2*w.syncWorkers)
+	bch := make(chan *bchain.Block, w.syncWorkers)
+	hch := make(chan hashHeight)
+	// backlog is the number of the fetched blocks waiting for the writer
+	var backlog int32
 	hchClosed := atomic.Value{}
 	hchClosed.Store(false)
 	writeBlockDone := make(chan struct{})
@@ -250,22 +368,38 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 		}
 		lastBlock := lower - 1
 		keep := uint32(w.chain.GetChainParser().KeepBlockAddresses())
+		// the workers finish the blocks out of order
+		pending := make(map[uint32]*bchain.Block)
 	WriteBlockLoop:
 		for {
 			select {
-			case b := <-bch[(lastBlock+1)%uint32(w.syncWorkers)]:
+			case b := <-bch:
 				if b == nil {
 					// channel is closed and empty - work is done
+					if len(pending) > 0 {
+						// a worker exited in the error loop, the rest is connected by the following sync
+						glog.Error("writeBlockWorker missing block ", lastBlock+1, ", ", len(pending), " fetched blocks not connected")
+					}
 					break WriteBlockLoop
 				}
-				if b.Height != lastBlock+1 {
-					glog.Fatal("writeBlockWorker skipped block, expected block ", lastBlock+1, ", new block ", b.Height)
-				}
-				err := bc.ConnectBlock(b, b.Height+keep > higher)
-				if err != nil {
-					glog.Fatal("writeBlockWorker ", b.Height, " ", b.Hash, " error ", err)
+				pending[b.Height] = b
+				for {
+					b, found := pending[lastBlock+1]
+					if !found {
+						break
+					}
+					delete(pending, b.Height)
+					if !w.throttleBlock(nil, terminating) {
+						break WriteBlockLoop
+					}
+					err := bc.ConnectBlock(b, b.Height+keep > higher)
+					if err != nil {
+						glog.Fatal("writeBlockWorker ", b.Height, " ", b.Hash, " error ", err)
+					}
+					lastBlock = b.Height
+					atomic.AddInt32(&backlog, -1)
+					<-window
 				}
-				lastBlock = b.Height
 			case <-terminating:
 				break WriteBlockLoop
 			}
@@ -281,27 +415,42 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 		var err error
 		var block *bchain.Block
 	GetBlockLoop:
-		for hh := range hch {
+		for fc.acquire() {
+			hh, ok := <-hch
+			if !ok {
+				fc.release()
+				break
+			}
 			for {
+				start := time.Now()
 				block, err = w.chain.GetBlock(hh.hash, hh.height)
 				if err != nil {
 					// signal came while looping in the error loop
 					if hchClosed.Load() == true {
+						fc.release()
 						glog.Error("getBlockWorker ", i, " connect block error ", err, ". Exiting...")
 						return
 					}
 					glog.Error("getBlockWorker ", i, " connect block error ", err, ". Retrying...")
 					w.metrics.IndexResyncErrors.With(common.Labels{"error": err.Error()}).Inc()
+					fc.failed()
 					time.Sleep(time.Millisecond * 500)
+					// the retry is a new fetch, it must wait for the lowered limit
+					if !fc.acquire() {
+						return
+					}
 				} else {
+					fc.done(time.Since(start), int(atomic.LoadInt32(&backlog)))
 					break
 				}
 			}
 			if w.dryRun {
+				<-window
 				continue
 			}
+			atomic.AddInt32(&backlog, 1)
 			select {
-			case bch[hh.height%uint32(w.syncWorkers)] <- block:
+			case bch <- block:
 			case <-terminating:
 				break GetBlockLoop
 			}
@@ -316,43 +465,62 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 	var hash string
 	start := time.Now()
 	msTime := time.Now().Add(1 * time.Minute)
+	stop := func(h uint32) {
+		err = errors.Errorf("connectBlocksParallel interrupted at height %d", h)
+		// signal all workers to terminate their loops (error loops are interrupted below)
+		close(terminating)
+	}
+	// slot is true if the slot of the window for the block h is taken
+	slot := false
 ConnectLoop:
 	for h := lower; h <= higher; {
+		if !slot {
+			select {
+			case <-w.chanOsSignal:
+				stop(h)
+				break ConnectLoop
+			case <-w.chanStop:
+				stop(h)
+				break ConnectLoop
+			case window <- struct{}{}:
+				slot = true
+			}
+		}
+		hash, err = w.chain.GetBlockHash(h)
+		if err != nil {
+			glog.Error("GetBlockHash error ", err)
+			w.metrics.IndexResyncErrors.With(common.Labels{"error": err.Error()}).Inc()
+			time.Sleep(time.Millisecond * 500)
+			continue
+		}
 		select {
 		case <-w.chanOsSignal:
-			err = errors.Errorf("connectBlocksParallel interrupted at height %d", h)
-			// signal all workers to terminate their loops (error loops are interrupted below)
-			close(terminating)
+			stop(h)
 			break ConnectLoop
-		default:
-			hash, err = w.chain.GetBlockHash(h)
-			if err != nil {
-				glog.Error("GetBlockHash error ", err)
-				w.metrics.IndexResyncErrors.With(common.Labels{"error": err.Error()}).Inc()
-				time.Sleep(time.Millisecond * 500)
-				continue
-			}
-			hch <- hashHeight{hash, h}
-			if h > 0 && h%1000 == 0 {
-				glog.Info("connecting block ", h, " ", hash, ", elapsed ", time.Since(start), " ", w.db.GetAndResetConnectBlockStats())
-				start = time.Now()
-			}
-			if msTime.Before(time.Now()) {
-				glog.Info(w.db.GetMemoryStats())
-				w.metrics.IndexDBSize.Set(float64(w.db.DatabaseSizeOnDisk()))
-				msTime = time.Now().Add(10 * time.Minute)
-			}
-			h++
+		case <-w.chanStop:
+			stop(h)
+			break ConnectLoop
+		case hch <- hashHeight{hash, h}:
+			slot = false
+		}
+		if h > 0 && h%1000 == 0 {
+			glog.Info("connecting block ", h, " ", hash, ", elapsed ", time.Since(start))
+			start = time.Now()
+		}
+		if msTime.Before(time.Now()) {
+			glog.Info(w.db.GetMemoryStats())
+			w.metrics.IndexDBSize.Set(float64(w.db.DatabaseSizeOnDisk()))
+			msTime = time.Now().Add(10 * time.Minute)
 		}
+		h++
 	}
 	close(hch)
-	// signal stop to workers that are in a error loop
+	// signal stop to workers that are in a error loop or waiting for a free fetch
 	hchClosed.Store(true)
+	fc.close()
 	// wait for workers and close bch that will stop writer loop
 	wg.Wait()
-	for i := 0; i < w.syncWorkers; i++ {
-		close(bch[i])
-	}
+	close(bch)
 	<-writeBlockDone
 	return err
 }
@@ -399,11 +567,11 @@ func (w *SyncWorker) DisconnectBlocks(lower uint32, higher uint32, hashes []stri
 	}
 	blocks := make([]*bchain.Block, len(hashes))
 	var err error
-	// try to get all blocks first to see if we can avoid full scan
+	// try to get all blocks first to disconnect them exactly as they were connected
 	for i, hash := range hashes {
 		blocks[i], err = w.chain.GetBlock(hash, 0)
 		if err != nil {
-			// cannot get a block, we must do full range scan
+			// cannot get a block, find the data to disconnect using the heightAddresses index
 			return w.db.DisconnectBlockRangeNonUTXO(lower, higher)
 		}
 	}
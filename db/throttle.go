@@ -0,0 +1,121 @@
+package db
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// syncThrottlePause is the interval in which a paused sync checks again the pending writes and the API latency
+const syncThrottlePause = time.Second
+
+// SyncThrottle limits the synchronization so that an index catching up with the backend does not starve the API
+// on a shared host, zero value of a limit means no limit
+type SyncThrottle struct {
+	// MaxBlocksPerSecond limits the rate in which the blocks are connected
+	MaxBlocksPerSecond float64
+	// MaxPendingWriteBytes pauses the sync while the size of the immutable memtables and the estimated pending compaction of the db exceed it
+	MaxPendingWriteBytes uint64
+	// MaxAPILatency pauses the sync while the latency returned by APILatency exceeds it
+	MaxAPILatency time.Duration
+	// APILatency returns the recent 95th percentile of the duration of the API requests, except the streaming and export endpoints
+	APILatency func() time.Duration
+}
+
+// SetThrottle sets the limits applied before each block is connected, nil disables the throttling
+func (w *SyncWorker) SetThrottle(t *SyncThrottle) {
+	if t != nil && t.MaxBlocksPerSecond <= 0 && t.MaxPendingWriteBytes == 0 && (t.MaxAPILatency <= 0 || t.APILatency == nil) {
+		t = nil
+	}
+	w.throttle = t
+	w.throttleNext = time.Time{}
+}
+
+// pendingWriteBytes returns the size of the data written to the db but not yet compacted, the sum of the immutable memtables
+// waiting for the flush and of the estimated pending compaction of all columns; the active memtables are not counted,
+// they are not flushed until they are full, which does not happen while the sync is paused, so the pause would never end
+func (d *RocksDB) pendingWriteBytes() uint64 {
+	var r uint64
+	property := func(p string, i int) uint64 {
+		v, err := strconv.ParseUint(d.db.GetPropertyCF(p, d.cfh[i]), 10, 64)
+		if err != nil {
+			return 0
+		}
+		return v
+	}
+	for i := range d.cfh {
+		// cur-size-all-mem-tables is the size of the active and of the unflushed immutable memtables
+		if all, active := property("rocksdb.cur-size-all-mem-tables", i), property("rocksdb.cur-size-active-mem-table", i); all > active {
+			r += all - active
+		}
+		r += property("rocksdb.estimate-pending-compaction-bytes", i)
+	}
+	return r
+}
+
+// throttleReason returns the reason why the sync must be paused or empty string if it can continue
+func (w *SyncWorker) throttleReason() string {
+	t := w.throttle
+	if t.MaxPendingWriteBytes > 0 {
+		if p := w.db.pendingWriteBytes(); p > t.MaxPendingWriteBytes {
+			return "pending writes " + strconv.FormatUint(p, 10) + " bytes"
+		}
+	}
+	if t.MaxAPILatency > 0 && t.APILatency != nil {
+		if l := t.APILatency(); l > t.MaxAPILatency {
+			return "API latency " + l.String()
+		}
+	}
+	return ""
+}
+
+// throttleBlock waits until the next block can be connected according to the throttle limits,
+// it returns false if the wait was interrupted by the OS signal, by the stop channel or by the Stop of the worker
+func (w *SyncWorker) throttleBlock(chanOsSignal <-chan os.Signal, stop <-chan struct{}) bool {
+	t := w.throttle
+	if t == nil {
+		return true
+	}
+	wait := func(d time.Duration) bool {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-chanOsSignal:
+		case <-stop:
+		case <-w.chanStop:
+		}
+		return false
+	}
+	var paused time.Time
+	for {
+		reason := w.throttleReason()
+		if reason == "" {
+			break
+		}
+		if paused.IsZero() {
+			paused = time.Now()
+			glog.Info("sync: paused, ", reason)
+		}
+		if !wait(syncThrottlePause) {
+			return false
+		}
+	}
+	if !paused.IsZero() {
+		glog.Info("sync: resumed after ", time.Since(paused))
+	}
+	if t.MaxBlocksPerSecond > 0 {
+		now := time.Now()
+		if w.throttleNext.After(now) {
+			if !wait(w.throttleNext.Sub(now)) {
+				return false
+			}
+			now = w.throttleNext
+		}
+		w.throttleNext = now.Add(time.Duration(float64(time.Second) / t.MaxBlocksPerSecond))
+	}
+	return true
+}
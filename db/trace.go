@@ -0,0 +1,67 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+// TraceFilter specifies which index operations are logged verbosely regardless of the glog verbosity
+// empty AddrDesc matches all addresses, the height range is inclusive
+type TraceFilter struct {
+	AddrDesc bchain.AddressDescriptor `json:"addrDesc,omitempty"`
+	Lower    uint32                   `json:"lower"`
+	Higher   uint32                   `json:"higher"`
+}
+
+type traceFilter struct {
+	// enabled is checked atomically so that the hot paths are not slowed down when tracing is off
+	enabled int32
+	mux     sync.RWMutex
+	f       TraceFilter
+}
+
+// SetTraceFilter enables targeted verbose logging of the index operations matching the filter
+func (d *RocksDB) SetTraceFilter(f *TraceFilter) {
+	d.trace.mux.Lock()
+	defer d.trace.mux.Unlock()
+	d.trace.f = *f
+	atomic.StoreInt32(&d.trace.enabled, 1)
+	glog.Infof("rocksdb: trace filter set to %+v", f)
+}
+
+// ClearTraceFilter disables targeted verbose logging
+func (d *RocksDB) ClearTraceFilter() {
+	d.trace.mux.Lock()
+	defer d.trace.mux.Unlock()
+	atomic.StoreInt32(&d.trace.enabled, 0)
+	d.trace.f = TraceFilter{}
+	glog.Info("rocksdb: trace filter cleared")
+}
+
+// GetTraceFilter returns the active trace filter or nil if tracing is off
+func (d *RocksDB) GetTraceFilter() *TraceFilter {
+	if atomic.LoadInt32(&d.trace.enabled) == 0 {
+		return nil
+	}
+	d.trace.mux.RLock()
+	defer d.trace.mux.RUnlock()
+	f := d.trace.f
+	return &f
+}
+
+// traced returns true if the operation on addrDesc at given height matches the active trace filter
+func (d *RocksDB) traced(addrDesc bchain.AddressDescriptor, height uint32) bool {
+	if atomic.LoadInt32(&d.trace.enabled) == 0 {
+		return false
+	}
+	d.trace.mux.RLock()
+	defer d.trace.mux.RUnlock()
+	if height < d.trace.f.Lower || height > d.trace.f.Higher {
+		return false
+	}
+	return len(d.trace.f.AddrDesc) == 0 || bytes.Equal(d.trace.f.AddrDesc, addrDesc)
+}
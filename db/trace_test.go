@@ -0,0 +1,40 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/bchain"
+	"testing"
+)
+
+func TestRocksDB_traced(t *testing.T) {
+	d := &RocksDB{}
+	a1 := bchain.AddressDescriptor{1, 2, 3}
+	a2 := bchain.AddressDescriptor{4, 5, 6}
+	if d.traced(a1, 10) || d.GetTraceFilter() != nil {
+		t.Fatal("traced without filter")
+	}
+	d.SetTraceFilter(&TraceFilter{Lower: 10, Higher: 20})
+	for _, tt := range []struct {
+		addrDesc bchain.AddressDescriptor
+		height   uint32
+		want     bool
+	}{
+		{a1, 9, false},
+		{a1, 10, true},
+		{a2, 20, true},
+		{a2, 21, false},
+	} {
+		if got := d.traced(tt.addrDesc, tt.height); got != tt.want {
+			t.Errorf("traced(%v, %d) = %v, want %v", tt.addrDesc, tt.height, got, tt.want)
+		}
+	}
+	d.SetTraceFilter(&TraceFilter{AddrDesc: a1, Higher: 20})
+	if !d.traced(a1, 0) || d.traced(a2, 0) {
+		t.Error("address filter does not match")
+	}
+	d.ClearTraceFilter()
+	if d.traced(a1, 10) || d.GetTraceFilter() != nil {
+		t.Error("traced after ClearTraceFilter")
+	}
+}
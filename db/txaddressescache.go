@@ -0,0 +1,95 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+)
+
+// txAddressesCache is a bounded LRU cache of unpacked TxAddresses keyed by packed txid, which survives across the block connects
+// consecutive blocks frequently spend outputs created a few blocks earlier, the cache saves reading and unpacking of them from the db
+// the cached values are modified in place by the connect of a block, therefore the cache is purged if the connect fails
+type txAddressesCache struct {
+	mux      sync.Mutex
+	capacity int
+	lru      *list.List
+	items    map[string]*list.Element
+}
+
+type txAddressesCacheItem struct {
+	btxID string
+	ta    *TxAddresses
+}
+
+func newTxAddressesCache(capacity int) *txAddressesCache {
+	return &txAddressesCache{
+		capacity: capacity,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+// get returns the cached TxAddresses or nil, the disabled (nil) cache always returns nil
+func (c *txAddressesCache) get(btxID string) *TxAddresses {
+	if c == nil {
+		return nil
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	e, found := c.items[btxID]
+	if !found {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*txAddressesCacheItem).ta
+}
+
+// add adds the TxAddresses written to the db to the cache, the least recently used items are evicted
+func (c *txAddressesCache) add(txAddressesMap map[string]*TxAddresses) {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for btxID, ta := range txAddressesMap {
+		if e, found := c.items[btxID]; found {
+			e.Value.(*txAddressesCacheItem).ta = ta
+			c.lru.MoveToFront(e)
+			continue
+		}
+		c.items[btxID] = c.lru.PushFront(&txAddressesCacheItem{btxID: btxID, ta: ta})
+	}
+	for c.lru.Len() > c.capacity {
+		e := c.lru.Back()
+		delete(c.items, e.Value.(*txAddressesCacheItem).btxID)
+		c.lru.Remove(e)
+	}
+}
+
+// purge removes all items from the cache
+func (c *txAddressesCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.lru.Init()
+	c.items = make(map[string]*list.Element, c.capacity)
+}
+
+func (c *txAddressesCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.lru.Len()
+}
+
+// SetTxAddressesCacheSize sets the maximum number of TxAddresses cached between the block connects, 0 disables the cache
+func (d *RocksDB) SetTxAddressesCacheSize(size int) {
+	if size > 0 {
+		d.txAddressesCache = newTxAddressesCache(size)
+	} else {
+		d.txAddressesCache = nil
+	}
+}
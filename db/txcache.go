@@ -30,6 +30,13 @@ func NewTxCache(db *RocksDB, chain bchain.BlockChain, metrics *common.Metrics, i
 	}, nil
 }
 
+// WithDB returns copy of the TxCache, which uses given db handle (for example a read snapshot view)
+func (c *TxCache) WithDB(db *RocksDB) *TxCache {
+	r := *c
+	r.db = db
+	return &r
+}
+
 // GetTransaction returns transaction either from RocksDB or if not present from blockchain
 // it the transaction is confirmed, it is stored in the RocksDB
 func (c *TxCache) GetTransaction(txid string) (*bchain.Tx, uint32, error) {
@@ -39,11 +46,19 @@ func (c *TxCache) GetTransaction(txid string) (*bchain.Tx, uint32, error) {
 	if c.enabled {
 		tx, h, err = c.db.GetTx(txid)
 		if err != nil {
-			return nil, 0, err
+			// the shared store may be unavailable, the transaction is then fetched from the backend
+			if c.db.txStore == nil {
+				return nil, 0, err
+			}
+			glog.Warning("txcache: GetTx ", txid, ": ", err)
+			tx = nil
 		}
 		if tx != nil {
 			// number of confirmations is not stored in cache, they change all the time
-			_, bestheight, _ := c.is.GetSyncState()
+			bestheight, err := c.db.GetBestHeight()
+			if err != nil {
+				return nil, 0, err
+			}
 			tx.Confirmations = bestheight - h + 1
 			c.metrics.TxCacheEfficiency.With(common.Labels{"status": "hit"}).Inc()
 			return tx, h, nil
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"blockbook/common"
+	"bytes"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// TxFetchFunc returns the transaction and the height of the block containing it from the backend
+type TxFetchFunc func(txid string) (*bchain.Tx, uint32, error)
+
+// maxTxFetchAttempts is the number of attempts to read the transaction and the best height from the backend
+// without a new block arriving in between
+const maxTxFetchAttempts = 3
+
+// SetTxAddressesRepair enables the read-repair of the missing txAddresses of the transactions spent by the connected blocks,
+// the missing transactions are fetched by fetch, nil disables the repair
+func (d *RocksDB) SetTxAddressesRepair(fetch TxFetchFunc) {
+	d.txRepair = fetch
+}
+
+// SetTxAddressesRepair enables the read-repair of the missing txAddresses, the transactions are fetched from the backend
+func (w *SyncWorker) SetTxAddressesRepair(enabled bool) {
+	if enabled {
+		w.db.SetTxAddressesRepair(w.fetchTxWithHeight)
+	} else {
+		w.db.SetTxAddressesRepair(nil)
+	}
+}
+
+// fetchTxWithHeight returns the confirmed transaction and the height of its block computed from its confirmations
+func (w *SyncWorker) fetchTxWithHeight(txid string) (*bchain.Tx, uint32, error) {
+	for i := 0; i < maxTxFetchAttempts; i++ {
+		best, err := w.chain.GetBestBlockHeight()
+		if err != nil {
+			return nil, 0, errors.Annotatef(err, "GetBestBlockHeight")
+		}
+		tx, err := w.chain.GetTransaction(txid)
+		if err != nil {
+			return nil, 0, errors.Annotatef(err, "GetTransaction %v", txid)
+		}
+		if tx.Confirmations == 0 || tx.Confirmations > best+1 {
+			return nil, 0, errors.Errorf("Transaction %v is not confirmed", txid)
+		}
+		if after, err := w.chain.GetBestBlockHeight(); err != nil {
+			return nil, 0, errors.Annotatef(err, "GetBestBlockHeight")
+		} else if after == best {
+			return tx, best - tx.Confirmations + 1, nil
+		}
+	}
+	return nil, 0, errors.Errorf("Transaction %v: the best block changes, cannot compute the height", txid)
+}
+
+// repairTxAddresses fetches the transaction missing in txAddresses, which is spent by the block at height, and reconstructs
+// its txAddresses, which are stored by the caller with the block; the inputs are resolved from the stored txAddresses
+// of the spent transactions, the unresolved inputs are left empty. The outputs, which are not in the addresses index
+// at the height of the transaction, are added to the addresses of the connected block and to the balances, so that
+// their spend does not drive the balances negative. Returns nil if the repair is disabled or failed.
+func (d *RocksDB) repairTxAddresses(txid string, btxID []byte, height uint32, addresses map[string][]outpoint, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance) (*TxAddresses, error) {
+	if d.txRepair == nil {
+		return nil, nil
+	}
+	tx, txHeight, err := d.txRepair(txid)
+	if err == nil && txHeight > height {
+		err = errors.Errorf("Transaction %v is in block %d above the connected block", txid, txHeight)
+	}
+	if err != nil {
+		glog.Errorf("rocksdb: height %d, cannot repair txAddresses of tx %v: %v", height, txid, err)
+		d.countTxAddressesRepair("failed")
+		return nil, nil
+	}
+	_, blockTxAddresses, err := d.processOutputsUTXO(&bchain.Block{
+		BlockHeader: bchain.BlockHeader{Height: txHeight},
+		Txs:         []bchain.Tx{*tx},
+	})
+	if err != nil {
+		glog.Errorf("rocksdb: height %d, cannot repair txAddresses of tx %v: %v", height, txid, err)
+		d.countTxAddressesRepair("failed")
+		return nil, nil
+	}
+	ta := blockTxAddresses[0]
+	ta.Inputs = make([]TxInput, len(tx.Vin))
+	unresolved := 0
+	for i := range tx.Vin {
+		input := &tx.Vin[i]
+		ibtxID, err := d.chainParser.PackTxid(input.Txid)
+		if err != nil {
+			// coinbase input
+			continue
+		}
+		ita := txAddressesMap[string(ibtxID)]
+		if ita == nil {
+			if ita, err = d.getTxAddresses(ibtxID); err != nil {
+				glog.Errorf("rocksdb: repair txAddresses of tx %v, input tx %v: %v", txid, input.Txid, err)
+			}
+		}
+		if ita == nil || len(ita.Outputs) <= int(input.Vout) {
+			unresolved++
+			continue
+		}
+		ta.Inputs[i].AddrDesc = ita.Outputs[input.Vout].AddrDesc
+		ta.Inputs[i].ValueSat = ita.Outputs[input.Vout].ValueSat
+	}
+	added := 0
+	indexed := make(map[string][]outpoint)
+	err = d.addTxOutputsUTXO(txid, btxID, ta, height, addresses, balances, func(i int, addrDesc bchain.AddressDescriptor) (bool, error) {
+		o, found := indexed[string(addrDesc)]
+		if !found {
+			val, err := d.db.GetCF(d.ro, d.cfh[cfAddresses], packAddressKey(addrDesc, txHeight))
+			if err != nil {
+				return false, err
+			}
+			defer val.Free()
+			if len(val.Data()) > 0 {
+				if o, err = d.unpackAddressOutpoints(val.Data()); err != nil {
+					return false, err
+				}
+			}
+			indexed[string(addrDesc)] = o
+		}
+		for _, op := range o {
+			if op.index == int32(i) && bytes.Equal(op.btxID, btxID) {
+				return true, nil
+			}
+		}
+		added++
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	glog.Warningf("rocksdb: height %d, repaired txAddresses of tx %v from block %d, %d unresolved inputs, %d outputs added to the balances", height, txid, txHeight, unresolved, added)
+	d.countTxAddressesRepair("repaired")
+	return ta, nil
+}
+
+func (d *RocksDB) countTxAddressesRepair(result string) {
+	if d.metrics != nil {
+		d.metrics.TxAddressesRepairs.With(common.Labels{"result": result}).Inc()
+	}
+}
@@ -0,0 +1,258 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bufio"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// TxCacheStore stores the packed transactions of the tx cache keyed by the packed txid. The default store is the transactions
+// column of the db, a shared store (Redis or memcached) lets the replicas of blockbook use one tx cache.
+// Get returns nil if the transaction is not stored.
+type TxCacheStore interface {
+	Get(key []byte) ([]byte, error)
+	Put(key []byte, val []byte) error
+	Delete(key []byte) error
+	Close() error
+}
+
+// NewTxCacheStore creates the shared tx cache store given by the url redis://[:password@]host:port[/db] or memcached://host:port,
+// the keys are prefixed by prefix so that more coins can share one store, the stored transactions expire after ttl
+func NewTxCacheStore(storeURL string, prefix string, ttl time.Duration) (TxCacheStore, error) {
+	u, err := url.Parse(storeURL)
+	if err != nil {
+		return nil, errors.Annotatef(err, "tx cache store")
+	}
+	if u.Host == "" {
+		return nil, errors.New("Missing host of tx cache store")
+	}
+	if ttl < time.Second {
+		return nil, errors.New("Tx cache store ttl must be at least 1s")
+	}
+	switch u.Scheme {
+	case "redis":
+		return newRedisTxStore(u, prefix, ttl)
+	case "memcached":
+		return newMemcachedTxStore(u.Host, prefix, ttl), nil
+	}
+	return nil, errors.Errorf("Unknown tx cache store %v, expecting redis:// or memcached://", u.Scheme)
+}
+
+// SetTxCacheStore sets the store of the transactions of the tx cache, nil means the transactions column of the db
+func (d *RocksDB) SetTxCacheStore(s TxCacheStore) {
+	d.txStore = s
+	if s != nil {
+		d.txDeletes = make(chan []byte, sharedTxDeleteQueue)
+		go deleteSharedTxs(s, d.txDeletes)
+	}
+}
+
+// txCacheStore returns the store of the tx cache, the column store of the db reads by the read options of d (e.g. of a snapshot view)
+func (d *RocksDB) txCacheStore() TxCacheStore {
+	if d.txStore != nil {
+		return d.txStore
+	}
+	return &txColumnStore{d: d}
+}
+
+// txColumnStore is the default store of the tx cache in the transactions column
+type txColumnStore struct {
+	d *RocksDB
+}
+
+func (s *txColumnStore) Get(key []byte) ([]byte, error) {
+	val, err := s.d.db.GetCF(s.d.ro, s.d.cfh[cfTransactions], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if len(val.Data()) == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), val.Data()...), nil
+}
+
+func (s *txColumnStore) Put(key []byte, val []byte) error {
+	err := s.d.db.PutCF(s.d.wo, s.d.cfh[cfTransactions], key, val)
+	if err == nil {
+		s.d.is.AddDBColumnStats(cfTransactions, 1, int64(len(key)), int64(len(val)))
+	}
+	return err
+}
+
+func (s *txColumnStore) Delete(key []byte) error {
+	// use write batch so that this delete matches other deletes
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	s.d.internalDeleteTx(wb, key)
+	return s.d.db.Write(s.d.wo, wb)
+}
+
+func (s *txColumnStore) Close() error {
+	return nil
+}
+
+// sharedTxDeleteQueue is the number of the transactions waiting for the removal from the shared store, the removals
+// over it are dropped, the entries expire and their block hash is checked by GetTx anyway
+const sharedTxDeleteQueue = 10000
+
+// deleteSharedTx queues the removal of the transaction given by the packed txid from the shared tx cache store when
+// the transaction is removed from the column, the disconnect of the blocks does not wait for the store
+func (d *RocksDB) deleteSharedTx(key []byte) {
+	if d.txStore == nil {
+		return
+	}
+	select {
+	case d.txDeletes <- append([]byte(nil), key...):
+	default:
+	}
+}
+
+// deleteSharedTxs removes the queued transactions from the shared store, the errors are only logged
+func deleteSharedTxs(s TxCacheStore, keys chan []byte) {
+	for key := range keys {
+		if err := s.Delete(key); err != nil {
+			glog.Warning("rocksdb: tx cache store delete ", hex.EncodeToString(key), ": ", err)
+		}
+	}
+}
+
+// packSharedTx prefixes the packed transaction stored to the shared store by the packed hash of its block in the local chain,
+// nil is returned if the block is not connected yet, the transactions of the mempool (height 0) are stored without hash
+func (d *RocksDB) packSharedTx(buf []byte, height uint32) ([]byte, error) {
+	var hash []byte
+	if height > 0 {
+		bi, err := d.GetBlockInfo(height)
+		if err != nil || bi == nil {
+			return nil, err
+		}
+		if hash, err = d.chainParser.PackBlockHash(bi.Hash); err != nil {
+			return nil, err
+		}
+	}
+	return append(packString(string(hash), nil), buf...), nil
+}
+
+// unpackSharedTx returns the transaction read from the shared store or nil if its block is not the block of the local chain,
+// a replica behind on a reorg can store the transaction of an orphaned block
+func (d *RocksDB) unpackSharedTx(data []byte) (*bchain.Tx, uint32, error) {
+	hash, l, err := unpackString(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data)-l <= 4 {
+		return nil, 0, nil
+	}
+	tx, height, err := d.chainParser.UnpackTx(data[l:])
+	if err != nil || height == 0 {
+		return tx, height, err
+	}
+	bi, err := d.GetBlockInfo(height)
+	if err != nil || bi == nil {
+		return nil, 0, err
+	}
+	local, err := d.chainParser.PackBlockHash(bi.Hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	if hash != string(local) {
+		return nil, 0, nil
+	}
+	return tx, height, nil
+}
+
+const (
+	storeConnections = 16
+	storeTimeout     = 2 * time.Second
+)
+
+// storeConn is a connection to the shared store with the buffered reader of the replies
+type storeConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// storePool keeps the idle connections to the shared store, the connection which failed is closed and not returned to the pool
+type storePool struct {
+	mux    sync.Mutex
+	addr   string
+	idle   []*storeConn
+	closed bool
+	// init is called on a new connection, e.g. to authenticate it
+	init func(c *storeConn) error
+}
+
+func (p *storePool) get() (*storeConn, error) {
+	p.mux.Lock()
+	if p.closed {
+		p.mux.Unlock()
+		return nil, errors.New("Tx cache store is closed")
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mux.Unlock()
+		if err := c.SetDeadline(time.Now().Add(storeTimeout)); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+	p.mux.Unlock()
+	nc, err := net.DialTimeout("tcp", p.addr, storeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &storeConn{Conn: nc, r: bufio.NewReader(nc)}
+	if err = c.SetDeadline(time.Now().Add(storeTimeout)); err == nil && p.init != nil {
+		err = p.init(c)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// put returns the connection to the pool if err is nil, otherwise the connection is closed
+func (p *storePool) put(c *storeConn, err error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err != nil || p.closed || len(p.idle) >= storeConnections {
+		c.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+func (p *storePool) close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closed = true
+	for _, c := range p.idle {
+		c.Close()
+	}
+	p.idle = nil
+	return nil
+}
+
+// readLine reads the line of the reply terminated by \r\n
+func (c *storeConn) readLine() (string, error) {
+	l, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(l, "\r\n") {
+		return "", errors.Errorf("Invalid reply line %q", l)
+	}
+	return l[:len(l)-2], nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// memcachedMaxTTL is the longest expiration in seconds, memcached takes the longer expiration as unix time
+const memcachedMaxTTL = 30 * 24 * 60 * 60
+
+// memcachedTxStore stores the transactions in memcached using the text protocol, the keys are hex encoded
+// as memcached does not allow the control characters and spaces in the keys
+type memcachedTxStore struct {
+	pool   storePool
+	prefix string
+	ttl    int64
+}
+
+func newMemcachedTxStore(addr string, prefix string, ttl time.Duration) *memcachedTxStore {
+	s := &memcachedTxStore{
+		pool:   storePool{addr: addr},
+		prefix: prefix,
+		ttl:    int64(ttl / time.Second),
+	}
+	if s.ttl > memcachedMaxTTL {
+		s.ttl = memcachedMaxTTL
+	}
+	return s
+}
+
+func (s *memcachedTxStore) key(key []byte) string {
+	return s.prefix + hex.EncodeToString(key)
+}
+
+// command sends the command and returns the first line of the reply, read reads the rest of the reply
+func (s *memcachedTxStore) command(cmd string, read func(c *storeConn, reply string) error) error {
+	c, err := s.pool.get()
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(c, cmd); err == nil {
+		var reply string
+		if reply, err = c.readLine(); err == nil {
+			err = read(c, reply)
+		}
+	}
+	s.pool.put(c, err)
+	return err
+}
+
+func (s *memcachedTxStore) Get(key []byte) ([]byte, error) {
+	var val []byte
+	err := s.command("get "+s.key(key)+"\r\n", func(c *storeConn, reply string) error {
+		if reply == "END" {
+			return nil
+		}
+		// VALUE <key> <flags> <bytes>
+		f := strings.Fields(reply)
+		if len(f) != 4 || f[0] != "VALUE" {
+			return errors.Errorf("Unexpected memcached reply %q", reply)
+		}
+		n, err := strconv.Atoi(f[3])
+		if err != nil || n < 0 {
+			return errors.Errorf("Unexpected memcached reply %q", reply)
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, b); err != nil {
+			return err
+		}
+		if reply, err = c.readLine(); err != nil {
+			return err
+		}
+		if reply != "END" {
+			return errors.Errorf("Unexpected memcached reply %q", reply)
+		}
+		val = b[:n]
+		return nil
+	})
+	return val, err
+}
+
+func (s *memcachedTxStore) Put(key []byte, val []byte) error {
+	cmd := "set " + s.key(key) + " 0 " + strconv.FormatInt(s.ttl, 10) + " " + strconv.Itoa(len(val)) + "\r\n" + string(val) + "\r\n"
+	return s.command(cmd, func(c *storeConn, reply string) error {
+		if reply != "STORED" {
+			return errors.Errorf("Unexpected memcached reply %q", reply)
+		}
+		return nil
+	})
+}
+
+func (s *memcachedTxStore) Delete(key []byte) error {
+	return s.command("delete "+s.key(key)+"\r\n", func(c *storeConn, reply string) error {
+		if reply != "DELETED" && reply != "NOT_FOUND" {
+			return errors.Errorf("Unexpected memcached reply %q", reply)
+		}
+		return nil
+	})
+}
+
+func (s *memcachedTxStore) Close() error {
+	return s.pool.close()
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// redisTxStore stores the transactions in Redis using the RESP protocol, the values expire after ttl
+type redisTxStore struct {
+	pool   storePool
+	prefix string
+	ttl    time.Duration
+}
+
+func newRedisTxStore(u *url.URL, prefix string, ttl time.Duration) (*redisTxStore, error) {
+	var auth []string
+	if u.User != nil {
+		if password, set := u.User.Password(); set {
+			auth = []string{"AUTH", password}
+		}
+	}
+	var dbIndex string
+	if p := strings.Trim(u.Path, "/"); p != "" {
+		if _, err := strconv.Atoi(p); err != nil {
+			return nil, errors.Errorf("Invalid redis db %v", p)
+		}
+		dbIndex = p
+	}
+	s := &redisTxStore{
+		pool:   storePool{addr: u.Host},
+		prefix: prefix,
+		ttl:    ttl,
+	}
+	s.pool.init = func(c *storeConn) error {
+		if auth != nil {
+			if _, err := redisCommand(c, auth...); err != nil {
+				return err
+			}
+		}
+		if dbIndex != "" {
+			if _, err := redisCommand(c, "SELECT", dbIndex); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return s, nil
+}
+
+// redisError is the error reply of redis, the connection stays usable after it
+type redisError string
+
+func (e redisError) Error() string {
+	return "Redis error: " + string(e)
+}
+
+// redisCommand sends the command and returns the reply, the bulk string or the integer or status as string,
+// nil is returned for the nil bulk string
+func redisCommand(c *storeConn, args ...string) ([]byte, error) {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, "\r\n"...)
+	for _, a := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(a)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, a...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	l, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if l == "" {
+		return nil, errors.New("Empty redis reply")
+	}
+	switch l[0] {
+	case '+', ':':
+		return []byte(l[1:]), nil
+	case '-':
+		return nil, redisError(l[1:])
+	case '$':
+		n, err := strconv.Atoi(l[1:])
+		if err != nil {
+			return nil, errors.Errorf("Invalid redis reply %q", l)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+	return nil, errors.Errorf("Unexpected redis reply %q", l)
+}
+
+func (s *redisTxStore) command(args ...string) ([]byte, error) {
+	c, err := s.pool.get()
+	if err != nil {
+		return nil, err
+	}
+	r, err := redisCommand(c, args...)
+	if _, ok := err.(redisError); ok {
+		s.pool.put(c, nil)
+	} else {
+		s.pool.put(c, err)
+	}
+	return r, err
+}
+
+func (s *redisTxStore) Get(key []byte) ([]byte, error) {
+	return s.command("GET", s.prefix+string(key))
+}
+
+func (s *redisTxStore) Put(key []byte, val []byte) error {
+	_, err := s.command("SET", s.prefix+string(key), string(val), "PX", strconv.FormatInt(int64(s.ttl/time.Millisecond), 10))
+	return err
+}
+
+func (s *redisTxStore) Delete(key []byte) error {
+	_, err := s.command("DEL", s.prefix+string(key))
+	return err
+}
+
+func (s *redisTxStore) Close() error {
+	return s.pool.close()
+}
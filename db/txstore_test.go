@@ -0,0 +1,305 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStoreServer serves the minimal subset of the redis or memcached protocol from a map
+type fakeStoreServer struct {
+	mux  sync.Mutex
+	data map[string]string
+	ln   net.Listener
+}
+
+func newFakeStoreServer(t *testing.T, serve func(s *fakeStoreServer, r *bufio.Reader, w io.Writer) error) *fakeStoreServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeStoreServer{data: make(map[string]string), ln: ln}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for serve(s, r, c) == nil {
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func serveFakeRedis(s *fakeStoreServer, r *bufio.Reader, w io.Writer) error {
+	l, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(l[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if l, err = r.ReadString('\n'); err != nil {
+			return err
+		}
+		sl, _ := strconv.Atoi(strings.TrimSpace(l[1:]))
+		b := make([]byte, sl+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return err
+		}
+		args[i] = string(b[:sl])
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	switch args[0] {
+	case "GET":
+		v, found := s.data[args[1]]
+		if !found {
+			_, err = io.WriteString(w, "$-1\r\n")
+		} else {
+			_, err = io.WriteString(w, "$"+strconv.Itoa(len(v))+"\r\n"+v+"\r\n")
+		}
+	case "SET":
+		if len(args) != 5 || args[3] != "PX" {
+			_, err = io.WriteString(w, "-ERR syntax error\r\n")
+		} else {
+			s.data[args[1]] = args[2]
+			_, err = io.WriteString(w, "+OK\r\n")
+		}
+	case "DEL":
+		_, found := s.data[args[1]]
+		delete(s.data, args[1])
+		if found {
+			_, err = io.WriteString(w, ":1\r\n")
+		} else {
+			_, err = io.WriteString(w, ":0\r\n")
+		}
+	case "AUTH":
+		if args[1] != "secret" {
+			_, err = io.WriteString(w, "-WRONGPASS invalid password\r\n")
+		} else {
+			_, err = io.WriteString(w, "+OK\r\n")
+		}
+	default:
+		_, err = io.WriteString(w, "-ERR unknown command\r\n")
+	}
+	return err
+}
+
+func serveFakeMemcached(s *fakeStoreServer, r *bufio.Reader, w io.Writer) error {
+	l, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	f := strings.Fields(l)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	switch f[0] {
+	case "get":
+		if v, found := s.data[f[1]]; found {
+			_, err = io.WriteString(w, "VALUE "+f[1]+" 0 "+strconv.Itoa(len(v))+"\r\n"+v+"\r\n")
+		}
+		if err == nil {
+			_, err = io.WriteString(w, "END\r\n")
+		}
+	case "set":
+		n, _ := strconv.Atoi(f[4])
+		b := make([]byte, n+2)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return err
+		}
+		s.data[f[1]] = string(b[:n])
+		_, err = io.WriteString(w, "STORED\r\n")
+	case "delete":
+		_, found := s.data[f[1]]
+		delete(s.data, f[1])
+		if found {
+			_, err = io.WriteString(w, "DELETED\r\n")
+		} else {
+			_, err = io.WriteString(w, "NOT_FOUND\r\n")
+		}
+	default:
+		_, err = io.WriteString(w, "ERROR\r\n")
+	}
+	return err
+}
+
+func TestTxCacheStore(t *testing.T) {
+	redis := newFakeStoreServer(t, serveFakeRedis)
+	defer redis.ln.Close()
+	memcached := newFakeStoreServer(t, serveFakeMemcached)
+	defer memcached.ln.Close()
+	tests := []struct {
+		name    string
+		url     string
+		server  *fakeStoreServer
+		wantKey string
+	}{
+		{name: "redis", url: "redis://:secret@" + redis.ln.Addr().String(), server: redis, wantKey: "test:\x00\r\n\xff"},
+		{name: "memcached", url: "memcached://" + memcached.ln.Addr().String(), server: memcached, wantKey: "test:000d0aff"},
+	}
+	key := []byte{0, '\r', '\n', 0xff}
+	val := []byte("packed\r\ntx\x00 END\r\n")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewTxCacheStore(tt.url, "test:", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			got, err := s.Get(key)
+			if err != nil || got != nil {
+				t.Fatalf("Get() of missing key = %q, %v, want nil", got, err)
+			}
+			if err = s.Put(key, val); err != nil {
+				t.Fatal(err)
+			}
+			tt.server.mux.Lock()
+			stored := tt.server.data[tt.wantKey]
+			tt.server.mux.Unlock()
+			if stored != string(val) {
+				t.Errorf("stored value of key %q = %q, want %q", tt.wantKey, stored, val)
+			}
+			// the connections are reused from the pool
+			for i := 0; i < 3; i++ {
+				if got, err = s.Get(key); err != nil || string(got) != string(val) {
+					t.Fatalf("Get() = %q, %v, want %q", got, err, val)
+				}
+			}
+			if err = s.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.Delete(key); err != nil {
+				t.Fatal("Delete() of missing key: ", err)
+			}
+			if got, err = s.Get(key); err != nil || got != nil {
+				t.Fatalf("Get() after Delete() = %q, %v, want nil", got, err)
+			}
+		})
+	}
+
+	s, err := NewTxCacheStore("redis://:wrong@"+redis.ln.Addr().String(), "test:", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err = s.Get(key); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Get() with wrong password: error %v, want WRONGPASS", err)
+	}
+	for _, u := range []string{"mongodb://localhost:27017", "redis://", "redis://localhost:6379/x"} {
+		if _, err := NewTxCacheStore(u, "test:", time.Hour); err == nil {
+			t.Errorf("NewTxCacheStore(%v): expected error", u)
+		}
+	}
+}
+
+// mapTxStore is the shared tx cache store in memory
+type mapTxStore struct {
+	mux  sync.Mutex
+	data map[string][]byte
+}
+
+func (s *mapTxStore) Get(key []byte) ([]byte, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.data[string(key)], nil
+}
+
+func (s *mapTxStore) Put(key []byte, val []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.data[string(key)] = val
+	return nil
+}
+
+func (s *mapTxStore) Delete(key []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.data, string(key))
+	return nil
+}
+
+func (s *mapTxStore) Close() error {
+	return nil
+}
+
+func TestRocksDB_SharedTxCache(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+	s := &mapTxStore{data: make(map[string][]byte)}
+	d.SetTxCacheStore(s)
+
+	block1 := dbtestdata.GetTestUTXOBlock1(d.chainParser)
+	block2 := dbtestdata.GetTestUTXOBlock2(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	// the transaction of the block not connected yet is not shared
+	tx := &block2.Txs[0]
+	if err := d.PutTx(tx, block2.Height, tx.Blocktime); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.data) != 0 {
+		t.Errorf("stored transactions of not connected block = %d, want 0", len(s.data))
+	}
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PutTx(tx, block2.Height, tx.Blocktime); err != nil {
+		t.Fatal(err)
+	}
+	gtx, height, err := d.GetTx(tx.Txid)
+	if err != nil || gtx == nil || gtx.Txid != tx.Txid || height != block2.Height {
+		t.Fatalf("GetTx() = %v, %v, %v", gtx, height, err)
+	}
+
+	// the transaction stored by a replica with another block at the height is not used
+	key, err := d.chainParser.PackTxid(tx.Txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := d.chainParser.PackTx(tx, block2.Height, tx.Blocktime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan, err := d.chainParser.PackBlockHash("0000000000000000000000000000000000000000000000000000000000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(key, append(packString(string(orphan), nil), buf...))
+	if gtx, _, err = d.GetTx(tx.Txid); err != nil || gtx != nil {
+		t.Errorf("GetTx() of orphaned transaction = %v, %v, want nil", gtx, err)
+	}
+
+	// the transactions of the disconnected block are removed from the store in background
+	if err := d.PutTx(tx, block2.Height, tx.Blocktime); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DisconnectBlockRangeUTXO(block2.Height, block2.Height); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if v, _ := s.Get(key); v == nil {
+			break
+		}
+		if i == 500 {
+			t.Fatal("the transaction of the disconnected block was not removed from the store")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
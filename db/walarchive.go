@@ -0,0 +1,432 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+const (
+	// walArchivePeriod is the period in which the new write batches are archived, if not notified earlier by a new block
+	walArchivePeriod = time.Minute
+	// walArchiveBaseDir is the directory of the archive with the checkpoint of the db, from which the segments are replayed
+	walArchiveBaseDir = "base"
+	// walArchiveBaseFile is the file of the archive describing the checkpoint, it is written after the checkpoint is complete
+	walArchiveBaseFile = "base.json"
+	// walArchiveSegmentExt is the extension of the archived segments, the name of the segment is the sequence of its first batch
+	walArchiveSegmentExt = ".wal"
+	// walRecordHeaderLen is the length of the header of the record of write batch: sequence, count, time and length of data
+	walRecordHeaderLen = 8 + 4 + 8 + 4
+)
+
+// walTTLSeconds is the time for which rocksdb keeps the obsolete WAL files, 0 means they are deleted as soon as possible
+var walTTLSeconds uint64
+
+// SetWalRetention sets the time for which the obsolete WAL files are kept by rocksdb, so that they can be archived,
+// it must be called before the db is opened
+func SetWalRetention(ttl time.Duration) {
+	walTTLSeconds = uint64(ttl / time.Second)
+	glog.Info("rocksdb: WAL files retained for ", ttl)
+}
+
+// walArchiveBase describes the checkpoint of the db in the archive
+type walArchiveBase struct {
+	Sequence uint64 `json:"sequence"`
+	Time     int64  `json:"time"`
+}
+
+// walRecord is the archived write batch; the time is the time of archiving, not of the write
+type walRecord struct {
+	seq   uint64
+	count uint32
+	time  int64
+	data  []byte
+}
+
+// WalArchiver copies the write batches from the WAL of the db to segment files in a directory,
+// together with the checkpoint of the db made at the first start, they allow the point in time recovery of the db
+type WalArchiver struct {
+	d       *RocksDB
+	dir     string
+	next    uint64
+	chanRun chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewWalArchiver creates an archiver of the WAL of the db to the directory dir,
+// if the directory does not contain a checkpoint of the db yet, it is created
+func NewWalArchiver(d *RocksDB, dir string) (*WalArchiver, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a := &WalArchiver{
+		d:       d,
+		dir:     dir,
+		chanRun: make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	base, err := readWalArchiveBase(dir)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		if base, err = a.createBase(); err != nil {
+			return nil, errors.Annotatef(err, "checkpoint")
+		}
+	}
+	a.next = base.Sequence
+	segments, err := walArchiveSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		records, err := readWalArchiveSegment(segments[len(segments)-1])
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			r := records[len(records)-1]
+			a.next = r.seq + uint64(r.count)
+		}
+	}
+	glog.Info("walarchive: directory ", dir, ", base sequence ", base.Sequence, ", next sequence ", a.next)
+	return a, nil
+}
+
+// createBase creates the checkpoint of the db in the archive, the sequence is read before the checkpoint,
+// the replay of the batches already contained in the checkpoint does not change the result
+func (a *WalArchiver) createBase() (*walArchiveBase, error) {
+	tmp := filepath.Join(a.dir, walArchiveBaseDir+".tmp")
+	baseDir := filepath.Join(a.dir, walArchiveBaseDir)
+	for _, p := range []string{tmp, baseDir} {
+		if err := os.RemoveAll(p); err != nil {
+			return nil, err
+		}
+	}
+	base := &walArchiveBase{
+		Sequence: a.d.db.GetLatestSequenceNumber(),
+		Time:     time.Now().Unix(),
+	}
+	cp, err := a.d.db.NewCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	defer cp.Destroy()
+	if err = cp.CreateCheckpoint(tmp, 0); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp, baseDir); err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(filepath.Join(a.dir, walArchiveBaseFile), buf); err != nil {
+		return nil, err
+	}
+	glog.Info("walarchive: created checkpoint of the db at sequence ", base.Sequence)
+	return base, nil
+}
+
+// Run archives the WAL periodically and each time it is notified by Archive, until Close is called
+func (a *WalArchiver) Run() {
+	defer close(a.done)
+	glog.Info("walarchive: starting")
+	ticker := time.NewTicker(walArchivePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.closing:
+			// archive the batches written since the last run before the db is closed
+			if err := a.archive(); err != nil {
+				glog.Error("walarchive: ", err)
+			}
+			glog.Info("walarchive: stopped")
+			return
+		case <-ticker.C:
+		case <-a.chanRun:
+		}
+		if err := a.archive(); err != nil {
+			glog.Error("walarchive: ", err)
+		}
+	}
+}
+
+// Archive notifies the archiver that new data was written, it does not block
+func (a *WalArchiver) Archive() {
+	select {
+	case a.chanRun <- struct{}{}:
+	default:
+	}
+}
+
+// OnNewBlock is the callback invoked after a new block is connected
+func (a *WalArchiver) OnNewBlock(hash string, height uint32) {
+	a.Archive()
+}
+
+// Close stops the archiver after the final archiving, it must be called before the db is closed
+func (a *WalArchiver) Close() {
+	a.once.Do(func() {
+		close(a.closing)
+		<-a.done
+	})
+}
+
+// archive writes the batches from the sequence next to the latest one to a new segment
+func (a *WalArchiver) archive() error {
+	latest := a.d.db.GetLatestSequenceNumber()
+	if latest < a.next {
+		return nil
+	}
+	it, err := a.d.db.GetUpdatesSince(a.next)
+	if err != nil {
+		return errors.Annotatef(err, "GetUpdatesSince %v", a.next)
+	}
+	defer it.Destroy()
+	var records []walRecord
+	next := a.next
+	now := time.Now().Unix()
+	for ; it.Valid(); it.Next() {
+		wb, seq := it.GetBatch()
+		count := uint32(wb.Count())
+		if seq+uint64(count) <= next {
+			wb.Destroy()
+			continue
+		}
+		if seq > next {
+			wb.Destroy()
+			return errors.Errorf("WAL from sequence %v to %v is not available, it was deleted before it was archived, start a new archive", next, seq)
+		}
+		records = append(records, walRecord{seq: seq, count: count, time: now, data: append([]byte(nil), wb.Data()...)})
+		next = seq + uint64(count)
+		wb.Destroy()
+	}
+	if err = it.Err(); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	name := filepath.Join(a.dir, fmt.Sprintf("%020d%s", records[0].seq, walArchiveSegmentExt))
+	if err = writeFileAtomic(name, packWalRecords(records)); err != nil {
+		return err
+	}
+	glog.V(1).Info("walarchive: archived ", len(records), " batches, sequence ", a.next, "-", next-1)
+	a.next = next
+	return nil
+}
+
+func packWalRecords(records []walRecord) []byte {
+	l := 0
+	for i := range records {
+		l += walRecordHeaderLen + len(records[i].data)
+	}
+	buf := make([]byte, 0, l)
+	var h [walRecordHeaderLen]byte
+	for i := range records {
+		r := &records[i]
+		binary.BigEndian.PutUint64(h[0:], r.seq)
+		binary.BigEndian.PutUint32(h[8:], r.count)
+		binary.BigEndian.PutUint64(h[12:], uint64(r.time))
+		binary.BigEndian.PutUint32(h[20:], uint32(len(r.data)))
+		buf = append(buf, h[:]...)
+		buf = append(buf, r.data...)
+	}
+	return buf
+}
+
+func unpackWalRecords(buf []byte) ([]walRecord, error) {
+	var records []walRecord
+	for len(buf) > 0 {
+		if len(buf) < walRecordHeaderLen {
+			return nil, errors.New("Invalid WAL archive record")
+		}
+		l := int(binary.BigEndian.Uint32(buf[20:]))
+		if len(buf) < walRecordHeaderLen+l {
+			return nil, errors.New("Invalid WAL archive record")
+		}
+		records = append(records, walRecord{
+			seq:   binary.BigEndian.Uint64(buf[0:]),
+			count: binary.BigEndian.Uint32(buf[8:]),
+			time:  int64(binary.BigEndian.Uint64(buf[12:])),
+			data:  buf[walRecordHeaderLen : walRecordHeaderLen+l],
+		})
+		buf = buf[walRecordHeaderLen+l:]
+	}
+	return records, nil
+}
+
+func readWalArchiveBase(dir string) (*walArchiveBase, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, walArchiveBaseFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var base walArchiveBase
+	if err = json.Unmarshal(buf, &base); err != nil {
+		return nil, errors.Annotatef(err, "%v", walArchiveBaseFile)
+	}
+	return &base, nil
+}
+
+// walArchiveSegments returns the paths of the segments in the archive in the order of their sequences
+func walArchiveSegments(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), walArchiveSegmentExt) {
+			segments = append(segments, filepath.Join(dir, f.Name()))
+		}
+	}
+	// the names are zero padded sequences
+	sort.Strings(segments)
+	return segments, nil
+}
+
+func readWalArchiveSegment(path string) ([]walRecord, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	records, err := unpackWalRecords(buf)
+	if err != nil {
+		return nil, errors.Annotatef(err, "%v", path)
+	}
+	return records, nil
+}
+
+// writeFileAtomic writes the file under a temporary name and renames it, so that a partially written file is never seen
+func writeFileAtomic(name string, buf []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// RestoreWalArchive creates the db in the directory path from the checkpoint in the archive and replays the archived batches,
+// if until is not zero, only the batches archived until that time are replayed; the directory path must not exist
+func RestoreWalArchive(archiveDir, path string, cacheSize, maxOpenFiles int, until time.Time) error {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return errors.Errorf("%v already exists", path)
+	}
+	base, err := readWalArchiveBase(archiveDir)
+	if err != nil {
+		return err
+	}
+	if base == nil {
+		return errors.Errorf("%v does not contain a checkpoint of the db", archiveDir)
+	}
+	if !until.IsZero() && until.Unix() < base.Time {
+		return errors.Errorf("the checkpoint of the db was created at %v, after the requested time", time.Unix(base.Time, 0).UTC())
+	}
+	if err = os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(filepath.Join(archiveDir, walArchiveBaseDir))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err = copyFile(filepath.Join(archiveDir, walArchiveBaseDir, f.Name()), filepath.Join(path, f.Name())); err != nil {
+			return err
+		}
+	}
+	glog.Info("walarchive: restored checkpoint at sequence ", base.Sequence, " to ", path)
+	d, err := newRocksDB(path, cacheSize, maxOpenFiles, nil, nil, false)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	segments, err := walArchiveSegments(archiveDir)
+	if err != nil {
+		return err
+	}
+	next := base.Sequence
+	batches := 0
+	var last int64
+replay:
+	for _, s := range segments {
+		records, err := readWalArchiveSegment(s)
+		if err != nil {
+			return err
+		}
+		for i := range records {
+			r := &records[i]
+			if !until.IsZero() && r.time > until.Unix() {
+				break replay
+			}
+			if r.seq+uint64(r.count) <= next {
+				continue
+			}
+			if r.seq > next {
+				return errors.Errorf("the archive does not contain the batches from sequence %v to %v", next, r.seq)
+			}
+			wb := gorocksdb.WriteBatchFrom(r.data)
+			err = d.db.Write(d.wo, wb)
+			wb.Destroy()
+			if err != nil {
+				return errors.Annotatef(err, "sequence %v", r.seq)
+			}
+			next = r.seq + uint64(r.count)
+			last = r.time
+			batches++
+		}
+	}
+	if batches == 0 {
+		glog.Info("walarchive: no batches replayed")
+	} else {
+		glog.Info("walarchive: replayed ", batches, " batches to sequence ", next-1, ", archived at ", time.Unix(last, 0).UTC())
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// +build unittest
+
+package db
+
+import (
+	"blockbook/tests/dbtestdata"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWalRecords(t *testing.T) {
+	records := []walRecord{
+		{seq: 1, count: 3, time: 1546300800, data: []byte{1, 2, 3}},
+		{seq: 4, count: 1, time: 1546300860, data: []byte{}},
+		{seq: 0xfffffffff, count: 0xffff, time: 1546300920, data: []byte{0xff}},
+	}
+	got, err := unpackWalRecords(packWalRecords(records))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("unpackWalRecords = %+v, want %+v", got, records)
+	}
+	if _, err = unpackWalRecords(packWalRecords(records)[:walRecordHeaderLen+2]); err == nil {
+		t.Error("unpackWalRecords of truncated data: expected error")
+	}
+}
+
+func TestWalArchive(t *testing.T) {
+	d := setupRocksDB(t, bitcoinTestnetParser())
+	defer closeAndDestroyRocksDB(t, d)
+	tmp, err := ioutil.TempDir("", "testwal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	archiveDir := filepath.Join(tmp, "archive")
+
+	if err = d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewWalArchiver(d, archiveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ConnectBlock(dbtestdata.GetTestUTXOBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.archive(); err != nil {
+		t.Fatal(err)
+	}
+	// the archiver started again continues after the archived batches
+	next := a.next
+	if a, err = NewWalArchiver(d, archiveDir); err != nil {
+		t.Fatal(err)
+	}
+	if a.next != next {
+		t.Errorf("next sequence after restart = %v, want %v", a.next, next)
+	}
+
+	tests := []struct {
+		name       string
+		until      time.Time
+		wantErr    bool
+		bestHeight uint32
+		bestHash   string
+	}{
+		{
+			name:       "all",
+			bestHeight: 225494,
+			bestHash:   "00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6",
+		},
+		{
+			name:    "before checkpoint",
+			until:   time.Now().Add(-time.Hour),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmp, tt.name)
+			err := RestoreWalArchive(archiveDir, path, 100000, -1, tt.until)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RestoreWalArchive error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			r, err := NewRocksDB(path, 100000, -1, d.chainParser, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			height, hash, err := r.GetBestBlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if height != tt.bestHeight || hash != tt.bestHash {
+				t.Errorf("GetBestBlock = %v %v, want %v %v", height, hash, tt.bestHeight, tt.bestHash)
+			}
+		})
+	}
+	if err = RestoreWalArchive(archiveDir, filepath.Join(tmp, "all"), 100000, -1, time.Time{}); err == nil {
+		t.Error("restore to existing directory: expected error")
+	}
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"crypto/subtle"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/juju/errors"
+)
+
+const (
+	// DefaultWalletAccountGap is the number of consecutive unused addresses, after which the discovery of the addresses
+	// of a ranged descriptor of an account stops
+	DefaultWalletAccountGap = 20
+	// MaxWalletAccountGap is the maximum gap of an account
+	MaxWalletAccountGap = 1000
+	// MaxWalletAccountDescriptors is the maximum number of descriptors of an account
+	MaxWalletAccountDescriptors = 20
+)
+
+// WalletAccount is a set of output descriptors of one wallet (e.g. the receive and change descriptors of the legacy, segwit
+// and taproot accounts of the same seed), which is presented as one account with the merged balance, history and utxos;
+// the addresses of the descriptors are discovered at each request up to Gap consecutive unused addresses.
+// The public view of the account is served only with the Token, which is generated at registration if not given.
+type WalletAccount struct {
+	Name        string   `json:"name"`
+	Token       string   `json:"token,omitempty"`
+	Descriptors []string `json:"descriptors"`
+	Gap         uint32   `json:"gap,omitempty"`
+}
+
+func packWalletAccount(a *WalletAccount) []byte {
+	varBuf := make([]byte, vlq.MaxLen64)
+	l := packVaruint(uint(len(a.Descriptors)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	for _, desc := range a.Descriptors {
+		buf = packString(desc, buf)
+	}
+	l = packVaruint(uint(a.Gap), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	if a.Token != "" {
+		buf = packString(a.Token, buf)
+	}
+	return buf
+}
+
+func unpackWalletAccount(name string, buf []byte) (*WalletAccount, error) {
+	invalid := errors.New("Invalid packed wallet account")
+	n, l := unpackVaruint(buf)
+	if l <= 0 || n > MaxWalletAccountDescriptors {
+		return nil, invalid
+	}
+	a := &WalletAccount{Name: name, Descriptors: make([]string, n)}
+	for i := range a.Descriptors {
+		desc, ll, err := unpackString(buf[l:])
+		if err != nil {
+			return nil, err
+		}
+		a.Descriptors[i] = desc
+		l += ll
+	}
+	gap, ll := unpackVaruint(buf[l:])
+	if ll <= 0 {
+		return nil, invalid
+	}
+	a.Gap = uint32(gap)
+	l += ll
+	// the account registered before the tokens ends here
+	if l == len(buf) {
+		return a, nil
+	}
+	token, ll, err := unpackString(buf[l:])
+	if err != nil || l+ll != len(buf) {
+		return nil, invalid
+	}
+	a.Token = token
+	return a, nil
+}
+
+// RegisterWalletAccount validates the descriptors of the account and stores it, the account of the same name is replaced,
+// the update without token keeps the token of the account, a new account gets a random token
+func (d *RocksDB) RegisterWalletAccount(a *WalletAccount) (err error) {
+	defer func(s time.Time) { d.observeMethod("RegisterWalletAccount", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	// the accounts follow the naming rules of the multisig wallets
+	if !validMultisigWalletName(a.Name) {
+		return errors.Errorf("Invalid wallet account name '%v', expecting 1-%d characters a-z, A-Z, 0-9, '-', '_' or '.'", a.Name, maxMultisigNameLen)
+	}
+	if len(a.Descriptors) == 0 || len(a.Descriptors) > MaxWalletAccountDescriptors {
+		return errors.Errorf("Invalid number of descriptors %d, expecting 1-%d", len(a.Descriptors), MaxWalletAccountDescriptors)
+	}
+	// the tokens follow the rules of the tokens of the multisig wallets
+	if a.Token != "" && !validMultisigToken(a.Token) {
+		return errors.Errorf("Invalid token, expecting %d-%d characters a-z, A-Z, 0-9, '-' or '_'", minMultisigTokenLen, maxMultisigTokenLen)
+	}
+	if a.Gap == 0 {
+		a.Gap = DefaultWalletAccountGap
+	} else if a.Gap > MaxWalletAccountGap {
+		return errors.Errorf("Gap exceeds %d", MaxWalletAccountGap)
+	}
+	seen := make(map[string]struct{}, len(a.Descriptors))
+	for _, desc := range a.Descriptors {
+		if _, found := seen[desc]; found {
+			return errors.Errorf("Duplicate descriptor %v", desc)
+		}
+		seen[desc] = struct{}{}
+		if _, err = d.chainParser.DeriveAddrDescs(desc, 0, 1); err != nil {
+			return err
+		}
+	}
+	if a.Token == "" {
+		val, err := d.db.GetCF(d.ro, d.cfh[cfWalletAccounts], []byte(a.Name))
+		if err != nil {
+			return err
+		}
+		var old *WalletAccount
+		if val.Size() > 0 {
+			old, err = unpackWalletAccount(a.Name, val.Data())
+		}
+		val.Free()
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			a.Token = old.Token
+		}
+	}
+	if a.Token == "" {
+		if a.Token, err = newMultisigToken(); err != nil {
+			return err
+		}
+	}
+	return d.db.PutCF(d.wo, d.cfh[cfWalletAccounts], []byte(a.Name), packWalletAccount(a))
+}
+
+// UnregisterWalletAccount removes the account, it returns false if the account is not registered
+func (d *RocksDB) UnregisterWalletAccount(name string) (removed bool, err error) {
+	defer func(s time.Time) { d.observeMethod("UnregisterWalletAccount", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	val, err := d.db.GetCF(d.ro, d.cfh[cfWalletAccounts], []byte(name))
+	if err != nil {
+		return false, err
+	}
+	found := val.Size() > 0
+	val.Free()
+	if !found {
+		return false, nil
+	}
+	return true, d.db.DeleteCF(d.wo, d.cfh[cfWalletAccounts], []byte(name))
+}
+
+// GetWalletAccount returns the registered account or nil if there is no account of the name
+func (d *RocksDB) GetWalletAccount(name string) (a *WalletAccount, err error) {
+	defer func(s time.Time) { d.observeMethod("GetWalletAccount", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	val, err := d.db.GetCF(d.ro, d.cfh[cfWalletAccounts], []byte(name))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	if val.Size() == 0 {
+		return nil, nil
+	}
+	return unpackWalletAccount(name, val.Data())
+}
+
+// ValidWalletAccountToken returns true if the token is the token of the account
+func ValidWalletAccountToken(a *WalletAccount, token string) bool {
+	return a != nil && a.Token != "" && subtle.ConstantTimeCompare([]byte(a.Token), []byte(token)) == 1
+}
+
+// GetWalletAccounts returns all registered accounts sorted by name
+func (d *RocksDB) GetWalletAccounts() (r []WalletAccount, err error) {
+	defer func(s time.Time) { d.observeMethod("GetWalletAccounts", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfWalletAccounts])
+	defer it.Close()
+	r = make([]WalletAccount, 0)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		a, err := unpackWalletAccount(string(it.Key().Data()), it.Value().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "wallet account %v", string(it.Key().Data()))
+		}
+		r = append(r, *a)
+	}
+	return r, nil
+}
@@ -0,0 +1,79 @@
+// +build unittest
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRocksDB_WalletAccounts(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	wpkh := "wpkh(03a0434d9e47f3c86235477c7b1ae6ae5d3442d49b1943c2b752a68e2a47e247c7)"
+	pkh := "pkh(03774ae7f858a9411e5ef4246b70c65aac5649980be5c17891bbec17895da008cb)"
+	for _, a := range []WalletAccount{
+		{Name: "bad/name", Descriptors: []string{wpkh}},
+		{Name: "empty"},
+		{Name: "unsupported", Descriptors: []string{"raw(6a)"}},
+		{Name: "duplicate", Descriptors: []string{wpkh, wpkh}},
+		{Name: "gap", Descriptors: []string{wpkh}, Gap: MaxWalletAccountGap + 1},
+		{Name: "token", Descriptors: []string{wpkh}, Token: "short"},
+	} {
+		if err := d.RegisterWalletAccount(&a); err == nil {
+			t.Errorf("RegisterWalletAccount(%v) expected error", a.Name)
+		}
+	}
+	alice := WalletAccount{Name: "alice", Descriptors: []string{wpkh, pkh}}
+	if err := d.RegisterWalletAccount(&alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.Gap != DefaultWalletAccountGap {
+		t.Errorf("default gap %d, want %d", alice.Gap, DefaultWalletAccountGap)
+	}
+	if len(alice.Token) != 32 || !ValidWalletAccountToken(&alice, alice.Token) || ValidWalletAccountToken(&alice, "") {
+		t.Errorf("generated token %q", alice.Token)
+	}
+	// the update without token keeps the token
+	token := alice.Token
+	alice = WalletAccount{Name: "alice", Descriptors: []string{wpkh, pkh}}
+	if err := d.RegisterWalletAccount(&alice); err != nil || alice.Token != token {
+		t.Errorf("RegisterWalletAccount(alice) update token %q, %v, want %q", alice.Token, err, token)
+	}
+	bob := WalletAccount{Name: "bob", Descriptors: []string{pkh}, Gap: 5, Token: "bob-secret-token-1"}
+	if err := d.RegisterWalletAccount(&bob); err != nil {
+		t.Fatal(err)
+	}
+	if bob.Token != "bob-secret-token-1" || ValidWalletAccountToken(&bob, token) {
+		t.Errorf("given token %q", bob.Token)
+	}
+	got, err := d.GetWalletAccount("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, &alice) {
+		t.Errorf("GetWalletAccount() = %+v, want %+v", got, alice)
+	}
+	if got, err = d.GetWalletAccount("carol"); err != nil || got != nil {
+		t.Errorf("GetWalletAccount(carol) = %+v, %v, want nil", got, err)
+	}
+	all, err := d.GetWalletAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []WalletAccount{alice, bob}) {
+		t.Errorf("GetWalletAccounts() = %+v", all)
+	}
+	if removed, err := d.UnregisterWalletAccount("alice"); err != nil || !removed {
+		t.Errorf("UnregisterWalletAccount(alice) = %v, %v", removed, err)
+	}
+	if removed, err := d.UnregisterWalletAccount("alice"); err != nil || removed {
+		t.Errorf("UnregisterWalletAccount(alice) again = %v, %v", removed, err)
+	}
+	if all, err = d.GetWalletAccounts(); err != nil || !reflect.DeepEqual(all, []WalletAccount{bob}) {
+		t.Errorf("GetWalletAccounts() after removal = %+v, %v", all, err)
+	}
+}
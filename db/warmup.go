@@ -0,0 +1,125 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// cacheWarmup reads the data of the recent blocks to the block cache after the db is opened,
+// so that the first api requests after a restart do not wait for the disk
+type cacheWarmup struct {
+	blocks int
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// SetCacheWarmup sets the number of recent blocks, the data of which are read to the block cache
+// after the db is opened or reopened, and starts the warmup in background, 0 disables the warmup
+func (d *RocksDB) SetCacheWarmup(blocks int) {
+	d.stopWarmup()
+	d.warmup.blocks = blocks
+	d.startWarmup()
+}
+
+func (d *RocksDB) startWarmup() {
+	if d.warmup.blocks <= 0 || d.db == nil {
+		return
+	}
+	stop := make(chan struct{})
+	d.warmup.stop = stop
+	d.warmup.wg.Add(1)
+	go func() {
+		defer d.warmup.wg.Done()
+		if err := d.warmCache(d.warmup.blocks, stop); err != nil {
+			glog.Error("rocksdb: cache warmup: ", err)
+		}
+	}()
+}
+
+// stopWarmup stops the running warmup and waits for its end, it must be called before the db is closed
+func (d *RocksDB) stopWarmup() {
+	if d.warmup.stop != nil {
+		close(d.warmup.stop)
+		d.warmup.stop = nil
+	}
+	d.warmup.wg.Wait()
+}
+
+// warmCache reads the height and blockTxs records of the recent blocks, the txAddresses of their transactions
+// and the addresses and balances of the addresses active in these blocks
+func (d *RocksDB) warmCache(blocks int, stop chan struct{}) error {
+	start := time.Now()
+	best, hash, err := d.GetBestBlock()
+	if err != nil || hash == "" {
+		return err
+	}
+	var lower uint32
+	if best >= uint32(blocks) {
+		lower = best - uint32(blocks) + 1
+	}
+	stopped := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+	warm := func(cf int, key []byte) error {
+		val, err := d.db.GetCF(d.ro, d.cfh[cf], key)
+		if err != nil {
+			return err
+		}
+		val.Free()
+		return nil
+	}
+	txs, addresses := 0, 0
+	for height := lower; height <= best; height++ {
+		if stopped() {
+			return nil
+		}
+		if err := warm(cfHeight, packUint(height)); err != nil {
+			return err
+		}
+		if !d.chainParser.IsUTXOChain() {
+			continue
+		}
+		bt, err := d.getBlockTxs(height)
+		if err != nil {
+			return err
+		}
+		for i := range bt {
+			if err := warm(cfTxAddresses, bt[i].btxID); err != nil {
+				return err
+			}
+		}
+		txs += len(bt)
+	}
+	startKey, endKey := heightRangeKeys(nil, lower, best)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeightAddresses])
+	defer it.Close()
+	for it.Seek(startKey); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if string(key) >= string(endKey) {
+			break
+		}
+		if len(key) <= packedHeightBytes {
+			continue
+		}
+		if addresses%1000 == 0 && stopped() {
+			return nil
+		}
+		height, addrDesc := unpackHeightAddressKey(key)
+		if err := warm(cfAddresses, packAddressKey(addrDesc, height)); err != nil {
+			return err
+		}
+		if err := warm(cfAddressBalance, addrDesc); err != nil {
+			return err
+		}
+		addresses++
+	}
+	glog.Infof("rocksdb: cache warmup of blocks %d-%d, %d txs, %d addresses, finished in %v", lower, best, txs, addresses, time.Since(start))
+	return nil
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// WatchedOutpoint is an output, about which spending the users are notified
+type WatchedOutpoint struct {
+	Txid    string `json:"txid"`
+	Vout    uint32 `json:"vout"`
+	Webhook string `json:"webhook,omitempty"`
+	Label   string `json:"label,omitempty"`
+}
+
+// WatchedOutpointSpent describes the spending of a watched outpoint
+type WatchedOutpointSpent struct {
+	WatchedOutpoint
+	SpendingTxid string  `json:"spendingTxid"`
+	Vin          int     `json:"vin"`
+	Height       uint32  `json:"height"`
+	ValueSat     big.Int `json:"-"`
+}
+
+// OnWatchedOutpointSpentFunc is used to send notification about spent watched outpoints
+type OnWatchedOutpointSpentFunc func(spent []WatchedOutpointSpent)
+
+type watchedOutpoints struct {
+	// count is checked without lock in processAddressesUTXO, usually there are no watched outpoints
+	count   int32
+	mux     sync.RWMutex
+	m       map[string]*WatchedOutpoint
+	onSpent OnWatchedOutpointSpentFunc
+	// pending are the spent outpoints found in the block being connected
+	pending []WatchedOutpointSpent
+}
+
+func packWatchedOutpointKey(btxID []byte, vout uint32) []byte {
+	buf := make([]byte, len(btxID)+vlq.MaxLen32)
+	copy(buf, btxID)
+	l := packVaruint(uint(vout), buf[len(btxID):])
+	return buf[:len(btxID)+l]
+}
+
+func packString(s string, buf []byte) []byte {
+	varBuf := make([]byte, vlq.MaxLen32)
+	l := packVaruint(uint(len(s)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	return append(buf, s...)
+}
+
+func unpackString(buf []byte) (string, int, error) {
+	sl, l := unpackVaruint(buf)
+	if l <= 0 || l+int(sl) > len(buf) {
+		return "", 0, errors.New("Invalid packed string")
+	}
+	return string(buf[l : l+int(sl)]), l + int(sl), nil
+}
+
+// loadWatchedOutpoints loads the watched outpoints from the db to memory
+func (d *RocksDB) loadWatchedOutpoints() error {
+	m := make(map[string]*WatchedOutpoint)
+	pl := d.chainParser.PackedTxidLen()
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfWatchedOutpoints])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		val := it.Value().Data()
+		if len(key) <= pl {
+			return errors.New("Invalid watched outpoint key")
+		}
+		txid, err := d.chainParser.UnpackTxid(key[:pl])
+		if err != nil {
+			return err
+		}
+		vout, _ := unpackVaruint(key[pl:])
+		wo := &WatchedOutpoint{Txid: txid, Vout: uint32(vout)}
+		var l int
+		if wo.Webhook, l, err = unpackString(val); err != nil {
+			return err
+		}
+		if wo.Label, _, err = unpackString(val[l:]); err != nil {
+			return err
+		}
+		m[string(key)] = wo
+	}
+	d.watched.mux.Lock()
+	d.watched.m = m
+	atomic.StoreInt32(&d.watched.count, int32(len(m)))
+	d.watched.mux.Unlock()
+	if len(m) > 0 {
+		glog.Info("rocksdb: loaded ", len(m), " watched outpoints")
+	}
+	return nil
+}
+
+// SetOnWatchedOutpointSpent sets the function called when watched outpoints are spent in a connected block
+func (d *RocksDB) SetOnWatchedOutpointSpent(fn OnWatchedOutpointSpentFunc) {
+	d.watched.mux.Lock()
+	d.watched.onSpent = fn
+	d.watched.mux.Unlock()
+}
+
+// WatchOutpoint registers the outpoint to be watched
+func (d *RocksDB) WatchOutpoint(wo *WatchedOutpoint) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	btxID, err := d.chainParser.PackTxid(wo.Txid)
+	if err != nil {
+		return err
+	}
+	key := packWatchedOutpointKey(btxID, wo.Vout)
+	val := packString(wo.Label, packString(wo.Webhook, nil))
+	d.watched.mux.Lock()
+	defer d.watched.mux.Unlock()
+	if err := d.db.PutCF(d.wo, d.cfh[cfWatchedOutpoints], key, val); err != nil {
+		return err
+	}
+	w := *wo
+	d.watched.m[string(key)] = &w
+	atomic.StoreInt32(&d.watched.count, int32(len(d.watched.m)))
+	return nil
+}
+
+// UnwatchOutpoint removes the outpoint from the watched outpoints
+func (d *RocksDB) UnwatchOutpoint(txid string, vout uint32) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	btxID, err := d.chainParser.PackTxid(txid)
+	if err != nil {
+		return err
+	}
+	key := packWatchedOutpointKey(btxID, vout)
+	d.watched.mux.Lock()
+	defer d.watched.mux.Unlock()
+	if err := d.db.DeleteCF(d.wo, d.cfh[cfWatchedOutpoints], key); err != nil {
+		return err
+	}
+	delete(d.watched.m, string(key))
+	atomic.StoreInt32(&d.watched.count, int32(len(d.watched.m)))
+	return nil
+}
+
+// GetWatchedOutpoints returns all watched outpoints
+func (d *RocksDB) GetWatchedOutpoints() []WatchedOutpoint {
+	d.watched.mux.RLock()
+	defer d.watched.mux.RUnlock()
+	r := make([]WatchedOutpoint, 0, len(d.watched.m))
+	for _, wo := range d.watched.m {
+		r = append(r, *wo)
+	}
+	return r
+}
+
+// checkWatchedOutpoint is called from processAddressesUTXO when an output is marked as spent
+func (d *RocksDB) checkWatchedOutpoint(btxID []byte, vout uint32, spendingTxid string, vin int, height uint32, value *big.Int) {
+	if atomic.LoadInt32(&d.watched.count) == 0 {
+		return
+	}
+	d.watched.mux.Lock()
+	defer d.watched.mux.Unlock()
+	if wo, found := d.watched.m[string(packWatchedOutpointKey(btxID, vout))]; found {
+		s := WatchedOutpointSpent{
+			WatchedOutpoint: *wo,
+			SpendingTxid:    spendingTxid,
+			Vin:             vin,
+			Height:          height,
+		}
+		s.ValueSat.Set(value)
+		d.watched.pending = append(d.watched.pending, s)
+	}
+}
+
+// notifyWatchedOutpointsSpent sends notification about the spent outpoints found in the connected block
+// it must be called after the block is written to the db
+func (d *RocksDB) notifyWatchedOutpointsSpent() {
+	d.watched.mux.Lock()
+	pending := d.watched.pending
+	d.watched.pending = nil
+	fn := d.watched.onSpent
+	d.watched.mux.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	for i := range pending {
+		glog.Warning("rocksdb: watched outpoint ", pending[i].Txid, ":", pending[i].Vout, " spent by tx ", pending[i].SpendingTxid, " in block ", pending[i].Height)
+	}
+	if fn != nil {
+		fn(pending)
+	}
+}
+
+// clearWatchedOutpointsSpent discards the spent outpoints of a block, which was not written to the db
+func (d *RocksDB) clearWatchedOutpointsSpent() {
+	d.watched.mux.Lock()
+	d.watched.pending = nil
+	d.watched.mux.Unlock()
+}
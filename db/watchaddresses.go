@@ -0,0 +1,219 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// WatchedAddress is an address, about which transactions in the connected blocks the users are notified
+type WatchedAddress struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// WatchedAddressActivity describes a transaction of a watched address in a connected block
+type WatchedAddressActivity struct {
+	WatchedAddress
+	Txid   string `json:"txid"`
+	Height uint32 `json:"height"`
+}
+
+// OnWatchedAddressActivityFunc is used to send notification about transactions of watched addresses
+type OnWatchedAddressActivityFunc func(activity []WatchedAddressActivity)
+
+type watchedAddresses struct {
+	// count is checked without lock when a block is connected, usually there are no watched addresses
+	count      int32
+	mux        sync.RWMutex
+	m          map[string]*WatchedAddress
+	onActivity OnWatchedAddressActivityFunc
+	// pending is the activity found in the block being connected
+	pending []WatchedAddressActivity
+}
+
+func packWatchedAddress(wa *WatchedAddress) []byte {
+	return packString(wa.Webhook, packString(wa.Label, packString(wa.Address, nil)))
+}
+
+func unpackWatchedAddress(buf []byte) (*WatchedAddress, error) {
+	wa := &WatchedAddress{}
+	var l, ll int
+	var err error
+	if wa.Address, l, err = unpackString(buf); err != nil {
+		return nil, err
+	}
+	if wa.Label, ll, err = unpackString(buf[l:]); err != nil {
+		return nil, err
+	}
+	if wa.Webhook, _, err = unpackString(buf[l+ll:]); err != nil {
+		return nil, err
+	}
+	return wa, nil
+}
+
+// loadWatchedAddresses loads the watched addresses from the db to memory
+func (d *RocksDB) loadWatchedAddresses() error {
+	m := make(map[string]*WatchedAddress)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfWatchedAddresses])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		wa, err := unpackWatchedAddress(it.Value().Data())
+		if err != nil {
+			return errors.Annotatef(err, "watched address %x", it.Key().Data())
+		}
+		m[string(it.Key().Data())] = wa
+	}
+	d.watchedAddrs.mux.Lock()
+	d.watchedAddrs.m = m
+	atomic.StoreInt32(&d.watchedAddrs.count, int32(len(m)))
+	d.watchedAddrs.mux.Unlock()
+	if len(m) > 0 {
+		glog.Info("rocksdb: loaded ", len(m), " watched addresses")
+	}
+	return nil
+}
+
+// SetOnWatchedAddressActivity sets the function called when watched addresses have transactions in a connected block
+func (d *RocksDB) SetOnWatchedAddressActivity(fn OnWatchedAddressActivityFunc) {
+	d.watchedAddrs.mux.Lock()
+	d.watchedAddrs.onActivity = fn
+	d.watchedAddrs.mux.Unlock()
+}
+
+// WatchAddresses registers the addresses to be watched in one write, already watched addresses are updated
+func (d *RocksDB) WatchAddresses(was []WatchedAddress) error {
+	if err := d.enterHandle(); err != nil {
+		return err
+	}
+	defer d.releaseHandle()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	keys := make([]string, len(was))
+	for i := range was {
+		addrDesc, err := d.chainParser.GetAddrDescFromAddress(was[i].Address)
+		if err != nil {
+			return errors.Annotatef(err, "address %v", was[i].Address)
+		}
+		keys[i] = string(addrDesc)
+		wb.PutCF(d.cfh[cfWatchedAddresses], addrDesc, packWatchedAddress(&was[i]))
+	}
+	d.watchedAddrs.mux.Lock()
+	defer d.watchedAddrs.mux.Unlock()
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return err
+	}
+	for i := range was {
+		wa := was[i]
+		d.watchedAddrs.m[keys[i]] = &wa
+	}
+	atomic.StoreInt32(&d.watchedAddrs.count, int32(len(d.watchedAddrs.m)))
+	return nil
+}
+
+// UnwatchAddresses removes the addresses from the watched addresses, returns the number of removed addresses
+func (d *RocksDB) UnwatchAddresses(addresses []string) (int, error) {
+	if err := d.enterHandle(); err != nil {
+		return 0, err
+	}
+	defer d.releaseHandle()
+	wb := gorocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	keys := make([]string, len(addresses))
+	for i, a := range addresses {
+		addrDesc, err := d.chainParser.GetAddrDescFromAddress(a)
+		if err != nil {
+			return 0, errors.Annotatef(err, "address %v", a)
+		}
+		keys[i] = string(addrDesc)
+		wb.DeleteCF(d.cfh[cfWatchedAddresses], addrDesc)
+	}
+	d.watchedAddrs.mux.Lock()
+	defer d.watchedAddrs.mux.Unlock()
+	if err := d.db.Write(d.wo, wb); err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, k := range keys {
+		if _, found := d.watchedAddrs.m[k]; found {
+			delete(d.watchedAddrs.m, k)
+			removed++
+		}
+	}
+	atomic.StoreInt32(&d.watchedAddrs.count, int32(len(d.watchedAddrs.m)))
+	return removed, nil
+}
+
+// GetWatchedAddresses returns all watched addresses sorted by address
+func (d *RocksDB) GetWatchedAddresses() []WatchedAddress {
+	d.watchedAddrs.mux.RLock()
+	r := make([]WatchedAddress, 0, len(d.watchedAddrs.m))
+	for _, wa := range d.watchedAddrs.m {
+		r = append(r, *wa)
+	}
+	d.watchedAddrs.mux.RUnlock()
+	sort.Slice(r, func(i, j int) bool { return r[i].Address < r[j].Address })
+	return r
+}
+
+// checkWatchedAddresses finds the transactions of the watched addresses among the addresses of the block being connected,
+// the activity is collected until the block (in bulk connect all blocks of the bulk) is written to the db
+func (d *RocksDB) checkWatchedAddresses(height uint32, addresses map[string][]outpoint) {
+	if atomic.LoadInt32(&d.watchedAddrs.count) == 0 {
+		return
+	}
+	d.watchedAddrs.mux.Lock()
+	defer d.watchedAddrs.mux.Unlock()
+	for addrDesc, outpoints := range addresses {
+		wa, found := d.watchedAddrs.m[addrDesc]
+		if !found {
+			continue
+		}
+		txids := make(map[string]struct{}, len(outpoints))
+		for _, o := range outpoints {
+			if _, found := txids[string(o.btxID)]; found {
+				continue
+			}
+			txids[string(o.btxID)] = struct{}{}
+			txid, err := d.chainParser.UnpackTxid(o.btxID)
+			if err != nil {
+				glog.Error("rocksdb: watched address ", wa.Address, ": ", err)
+				continue
+			}
+			d.watchedAddrs.pending = append(d.watchedAddrs.pending, WatchedAddressActivity{
+				WatchedAddress: *wa,
+				Txid:           txid,
+				Height:         height,
+			})
+		}
+	}
+}
+
+// notifyWatchedAddressActivity sends notification about the transactions of watched addresses found in the connected blocks
+// it must be called after the block is written to the db
+func (d *RocksDB) notifyWatchedAddressActivity() {
+	d.watchedAddrs.mux.Lock()
+	pending := d.watchedAddrs.pending
+	d.watchedAddrs.pending = nil
+	fn := d.watchedAddrs.onActivity
+	d.watchedAddrs.mux.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	glog.Info("rocksdb: ", len(pending), " transactions of watched addresses in blocks ", pending[0].Height, "-", pending[len(pending)-1].Height)
+	if fn != nil {
+		fn(pending)
+	}
+}
+
+// clearWatchedAddressActivity discards the activity of watched addresses in a block, which was not written to the db
+func (d *RocksDB) clearWatchedAddressActivity() {
+	d.watchedAddrs.mux.Lock()
+	d.watchedAddrs.pending = nil
+	d.watchedAddrs.mux.Unlock()
+}
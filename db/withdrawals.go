@@ -0,0 +1,178 @@
+package db
+
+import (
+	"blockbook/bchain"
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/tecbot/gorocksdb"
+)
+
+// Withdrawal is the withdrawal from the beacon chain credited to the address in the block at Height
+type Withdrawal struct {
+	Height         uint32
+	Index          uint64
+	ValidatorIndex uint64
+	AmountSat      big.Int
+}
+
+func packWithdrawals(ws []bchain.Withdrawal) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	l := packVaruint(uint(len(ws)), varBuf)
+	buf := append([]byte(nil), varBuf[:l]...)
+	for i := range ws {
+		l = packVaruint(uint(ws[i].Index), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packVaruint(uint(ws[i].ValidatorIndex), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packBigint(&ws[i].AmountSat, varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf
+}
+
+func unpackWithdrawals(height uint32, buf []byte) ([]Withdrawal, error) {
+	n, l := unpackVaruint(buf)
+	if l <= 0 || int(n) > len(buf) {
+		return nil, errors.New("Invalid packed withdrawals")
+	}
+	r := make([]Withdrawal, n)
+	for i := range r {
+		w := &r[i]
+		w.Height = height
+		index, ll := unpackVaruint(buf[l:])
+		if ll <= 0 {
+			return nil, errors.New("Invalid packed withdrawals")
+		}
+		l += ll
+		validatorIndex, ll := unpackVaruint(buf[l:])
+		if ll <= 0 || l+ll >= len(buf) {
+			return nil, errors.New("Invalid packed withdrawals")
+		}
+		l += ll
+		if l+1+int(buf[l]) > len(buf) {
+			return nil, errors.New("Invalid packed withdrawals")
+		}
+		w.Index = uint64(index)
+		w.ValidatorIndex = uint64(validatorIndex)
+		w.AmountSat, ll = unpackBigint(buf[l:])
+		l += ll
+	}
+	if l != len(buf) {
+		return nil, errors.New("Invalid packed withdrawals")
+	}
+	return r, nil
+}
+
+// blockWithdrawals groups the withdrawals of the block by the address descriptors of their recipients
+func (d *RocksDB) blockWithdrawals(block *bchain.Block) map[string][]bchain.Withdrawal {
+	if len(block.Withdrawals) == 0 {
+		return nil
+	}
+	r := make(map[string][]bchain.Withdrawal)
+	for i := range block.Withdrawals {
+		w := &block.Withdrawals[i]
+		addrDesc, err := d.chainParser.GetAddrDescFromAddress(w.Address)
+		if err != nil {
+			glog.Warningf("rocksdb: addrDesc: %v - height %d, withdrawal %d", err, block.Height, w.Index)
+			continue
+		}
+		r[string(addrDesc)] = append(r[string(addrDesc)], *w)
+	}
+	return r
+}
+
+// writeWithdrawals stores or deletes the withdrawals of the block by the recipient and height, the recipients are recorded
+// also in the heightAddresses column, so that the withdrawals are removed by the disconnect of the block
+func (d *RocksDB) writeWithdrawals(wb *gorocksdb.WriteBatch, block *bchain.Block, op int) {
+	for addrDesc, ws := range d.blockWithdrawals(block) {
+		key := packAddressKey(bchain.AddressDescriptor(addrDesc), block.Height)
+		hkey := packHeightAddressKey(block.Height, bchain.AddressDescriptor(addrDesc))
+		switch op {
+		case opInsert:
+			wb.PutCF(d.cfh[cfWithdrawals], key, packWithdrawals(ws))
+			wb.PutCF(d.cfh[cfHeightAddresses], hkey, []byte{})
+		case opDelete:
+			wb.DeleteCF(d.cfh[cfWithdrawals], key)
+			wb.DeleteCF(d.cfh[cfHeightAddresses], hkey)
+		}
+	}
+}
+
+// GetAddrDescWithdrawals returns the withdrawals from the beacon chain to the address descriptor in the blocks
+// from lower to higher height, the newest withdrawals first
+func (d *RocksDB) GetAddrDescWithdrawals(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32) (r []Withdrawal, err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescWithdrawals", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	kstart := packAddressKey(addrDesc, lower)
+	kstop := packAddressKey(addrDesc, higher)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfWithdrawals])
+	defer it.Close()
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		_, height, err := unpackAddressKey(key)
+		if err != nil {
+			return nil, err
+		}
+		ws, err := unpackWithdrawals(height, it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, ws...)
+	}
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return r, nil
+}
+
+// WithdrawalsBlock is the number of the withdrawals to an address in the block at Height
+type WithdrawalsBlock struct {
+	Height uint32
+	Count  int
+}
+
+// GetAddrDescWithdrawalsSummary returns the blocks with the withdrawals from the beacon chain to the address descriptor,
+// the newest first, and the sum of the withdrawals, without returning the withdrawals themselves
+func (d *RocksDB) GetAddrDescWithdrawalsSummary(addrDesc bchain.AddressDescriptor) (blocks []WithdrawalsBlock, total big.Int, err error) {
+	defer func(s time.Time) { d.observeMethod("GetAddrDescWithdrawalsSummary", s, err) }(time.Now())
+	if err = d.enterHandle(); err != nil {
+		return
+	}
+	defer d.releaseHandle()
+	kstart := packAddressKey(addrDesc, 0)
+	kstop := packAddressKey(addrDesc, ^uint32(0))
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfWithdrawals])
+	defer it.Close()
+	for it.Seek(kstart); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, kstop) > 0 {
+			break
+		}
+		_, height, err := unpackAddressKey(key)
+		if err != nil {
+			return nil, total, err
+		}
+		ws, err := unpackWithdrawals(height, it.Value().Data())
+		if err != nil {
+			return nil, total, err
+		}
+		for i := range ws {
+			total.Add(&total, &ws[i].AmountSat)
+		}
+		blocks = append(blocks, WithdrawalsBlock{Height: height, Count: len(ws)})
+	}
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks, total, nil
+}
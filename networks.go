@@ -0,0 +1,241 @@
+package main
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins"
+	"blockbook/common"
+	"blockbook/db"
+	"blockbook/server"
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// network is an additional network (typically testnet or regtest) indexed by the same process as the main network,
+// it has its own backend, db and sync loops and its public interface is served by the public server under /<prefix>/
+type network struct {
+	prefix          string
+	configFile      string
+	dbPath          string
+	coin            string
+	chain           bchain.BlockChain
+	index           *db.RocksDB
+	txCache         *db.TxCache
+	metrics         *common.Metrics
+	syncWorker      *db.SyncWorker
+	internalState   *common.InternalState
+	public          *server.PublicServer
+	chanSyncIndex   chan struct{}
+	chanSyncMempool chan struct{}
+	// chanOsSignal is never signalled, the sync of the network is interrupted by the Stop of the sync worker
+	chanOsSignal chan os.Signal
+	done         chan struct{}
+	loopsDone    []chan struct{}
+}
+
+// parseNetworks parses the comma separated list of the additional networks in the format <prefix>:<blockchaincfg>:<datadir>
+func parseNetworks(s string) ([]*network, error) {
+	var networks []*network
+	prefixes := make(map[string]struct{})
+	for _, n := range strings.Split(s, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		parts := strings.SplitN(n, ":", 3)
+		if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+			return nil, errors.Errorf("Invalid network %v, expecting <prefix>:<blockchaincfg>:<datadir>", n)
+		}
+		prefix := parts[0]
+		if prefix == "" || strings.IndexFunc(prefix, func(c rune) bool {
+			return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-')
+		}) >= 0 {
+			return nil, errors.Errorf("Invalid network prefix '%v', expecting characters a-z, 0-9 or '-'", prefix)
+		}
+		// the prefix must not shadow the paths of the main network
+		switch prefix {
+		case "api", "static", "socket.io", "tx", "address", "search", "blocks", "block", "spending", "sendtx":
+			return nil, errors.Errorf("Network prefix '%v' collides with a path of the public interface", prefix)
+		}
+		if _, found := prefixes[prefix]; found {
+			return nil, errors.Errorf("Duplicate network prefix '%v'", prefix)
+		}
+		prefixes[prefix] = struct{}{}
+		networks = append(networks, &network{
+			prefix:          prefix,
+			configFile:      parts[1],
+			dbPath:          parts[2],
+			chanSyncIndex:   make(chan struct{}),
+			chanSyncMempool: make(chan struct{}),
+			chanOsSignal:    make(chan os.Signal, 1),
+			done:            make(chan struct{}),
+		})
+	}
+	return networks, nil
+}
+
+// open connects the backend of the network and opens its db
+func (n *network) open() error {
+	coin, coinShortcut, coinLabel, err := coins.GetCoinNameFromConfig(n.configFile)
+	if err != nil {
+		return errors.Annotatef(err, "config")
+	}
+	n.coin = coin
+	if n.metrics, err = common.GetMetrics(coin); err != nil {
+		return errors.Annotatef(err, "metrics")
+	}
+	if n.chain, err = getBlockChainWithRetry(coin, n.configFile, n.pushSynchronizationHandler, n.metrics, 60); err != nil {
+		return errors.Annotatef(err, "rpc")
+	}
+	if n.index, err = db.NewRocksDB(n.dbPath, *dbCache, *dbMaxOpenFiles, n.chain.GetChainParser(), n.metrics); err != nil {
+		return errors.Annotatef(err, "rocksDB")
+	}
+	n.index.SetTxAddressesCacheSize(*txAddrCache)
+	if n.internalState, err = newInternalState(coin, coinShortcut, coinLabel, n.index); err != nil {
+		return errors.Annotatef(err, "internalState")
+	}
+	n.index.SetInternalState(n.internalState)
+	if n.internalState.DbState != common.DbStateClosed {
+		if n.internalState.DbState == common.DbStateInconsistent {
+			return errors.New("internalState: database is in inconsistent state and cannot be used")
+		}
+		glog.Warning("network ", n.prefix, ": internalState: database was left in open state, possibly previous ungraceful shutdown")
+	}
+	if n.syncWorker, err = db.NewSyncWorker(n.index, n.chain, *syncWorkers, *syncChunk, -1, *dryRun, n.chanOsSignal, n.metrics, n.internalState); err != nil {
+		return errors.Annotatef(err, "NewSyncWorker")
+	}
+	n.internalState.DbState = common.DbStateOpen
+	if err = n.index.StoreInternalState(n.internalState); err != nil {
+		return errors.Annotatef(err, "internalState")
+	}
+	if n.txCache, err = db.NewTxCache(n.index, n.chain, n.metrics, n.internalState, !*noTxCache); err != nil {
+		return errors.Annotatef(err, "txCache")
+	}
+	glog.Info("network ", n.prefix, ": ", coin, " opened, datadir ", n.dbPath)
+	return nil
+}
+
+// mount creates the public interface of the network and serves it by the public server under /<prefix>/
+func (n *network) mount(public *server.PublicServer) error {
+	var err error
+	if n.public, err = server.NewPublicServer(public.NetworkBinding(n.prefix), *certFiles, n.index, n.chain, n.txCache, "", n.metrics, n.internalState, *debugMode); err != nil {
+		return err
+	}
+	n.public.SetLargeAddressTxs(uint32(*largeAddressTxs))
+	public.MountNetwork(n.prefix, n.public)
+	return nil
+}
+
+// run synchronizes the network and keeps it synchronized if sync is set, afterwards it enables the full public interface
+func (n *network) run() {
+	defer close(n.done)
+	if *synchronize {
+		n.internalState.InitialSync = true
+		if err := n.syncWorker.ResyncIndex(nil, true); err != nil {
+			glog.Error("network ", n.prefix, ": resyncIndex ", err)
+			return
+		}
+		count, err := n.chain.ResyncMempool(nil)
+		if err != nil {
+			glog.Error("network ", n.prefix, ": resyncMempool ", err)
+			return
+		}
+		n.internalState.FinishedMempoolSync(count)
+		n.loopsDone = []chan struct{}{make(chan struct{}), make(chan struct{})}
+		go n.syncIndexLoop(n.loopsDone[0])
+		go n.syncMempoolLoop(n.loopsDone[1])
+		n.internalState.InitialSync = false
+	}
+	if n.public != nil {
+		n.public.ConnectFullPublicInterface()
+	}
+}
+
+func (n *network) syncIndexLoop(done chan struct{}) {
+	defer close(done)
+	tickAndDebounce(time.Duration(*resyncIndexPeriodMs)*time.Millisecond, debounceResyncIndexMs*time.Millisecond, n.chanSyncIndex, func() {
+		var onNewBlock bchain.OnNewBlockFunc
+		if n.public != nil {
+			onNewBlock = n.public.OnNewBlock
+		}
+		if err := n.syncWorker.ResyncIndex(onNewBlock, false); err != nil {
+			glog.Error("network ", n.prefix, ": syncIndexLoop ", errors.ErrorStack(err))
+		}
+		if err := n.index.StoreInternalState(n.internalState); err != nil {
+			glog.Error("network ", n.prefix, ": storeInternalState ", errors.ErrorStack(err))
+		}
+	})
+}
+
+func (n *network) syncMempoolLoop(done chan struct{}) {
+	defer close(done)
+	tickAndDebounce(time.Duration(*resyncMempoolPeriodMs)*time.Millisecond, debounceResyncMempoolMs*time.Millisecond, n.chanSyncMempool, func() {
+		var onNewTxAddr bchain.OnNewTxAddrFunc
+		if n.public != nil {
+			onNewTxAddr = n.public.OnNewTxAddr
+		}
+		n.internalState.StartedMempoolSync()
+		if count, err := n.chain.ResyncMempool(onNewTxAddr); err != nil {
+			glog.Error("network ", n.prefix, ": syncMempoolLoop ", errors.ErrorStack(err))
+		} else {
+			n.internalState.FinishedMempoolSync(count)
+		}
+	})
+}
+
+func (n *network) pushSynchronizationHandler(nt bchain.NotificationType) {
+	if atomic.LoadInt32(&inShutdown) != 0 {
+		return
+	}
+	glog.V(1).Info("network ", n.prefix, ": MQ: notification ", nt)
+	if nt == bchain.NotificationNewBlock {
+		n.chanSyncIndex <- struct{}{}
+	} else if nt == bchain.NotificationNewTx {
+		n.chanSyncMempool <- struct{}{}
+	} else {
+		glog.Error("network ", n.prefix, ": MQ: unknown notification sent")
+	}
+}
+
+// shutdown stops the sync of the network and its public interface and disconnects the backend,
+// it is called by waitForSignalAndShutdown after the main public server is shut down,
+// returns error if the requests of its public server or its sync did not finish in time
+func (n *network) shutdown(ctx context.Context) (err error) {
+	if n.syncWorker != nil {
+		n.syncWorker.Stop()
+	}
+	if n.public != nil {
+		if err = n.public.Shutdown(ctx); err != nil {
+			glog.Error("network ", n.prefix, ": public server: shutdown error: ", err)
+		}
+	}
+	select {
+	case <-n.done:
+	case <-ctx.Done():
+		glog.Error("network ", n.prefix, ": sync did not stop in time")
+		return errors.New("sync did not stop in time")
+	}
+	close(n.chanSyncIndex)
+	close(n.chanSyncMempool)
+	for _, done := range n.loopsDone {
+		<-done
+	}
+	if n.chain != nil {
+		if err := n.chain.Shutdown(ctx); err != nil {
+			glog.Error("network ", n.prefix, ": rpc: shutdown error: ", err)
+		}
+	}
+	return err
+}
+
+// close closes the db of the network, storing its internal state as closed
+func (n *network) close() {
+	if n.index != nil {
+		n.index.Close()
+	}
+}
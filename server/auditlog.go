@@ -0,0 +1,413 @@
+package server
+
+import (
+	"blockbook/bchain"
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+const (
+	auditLogFilePrefix = "audit-"
+	auditLogFileSuffix = ".log"
+	auditLogDayFormat  = "2006-01-02"
+	// auditLogQueue is the number of records waiting to be written, the records over it are dropped so that the requests are never blocked
+	auditLogQueue = 4096
+)
+
+// AuditLogConfig is the configuration of the audit log of the API queries, it is specified
+// as <directory>[;<option>=<value>]..., see docs/build.md
+type AuditLogConfig struct {
+	// Dir is the directory of the log files, one file per UTC day
+	Dir string
+	// Retention is the age, after which the log files are removed
+	Retention time.Duration
+	// HashAddresses replaces the addresses in the parameters by their keyed hashes
+	HashAddresses bool
+	// HashCaller replaces the caller (the value of CallerHeader or the IP address) by its keyed hash
+	HashCaller bool
+	// CallerHeader is the request header identifying the caller (e.g. an API key set by a proxy), the IP address is used if it is missing
+	CallerHeader string
+	// MaxParams is the maximum length of the logged parameters, longer parameters are truncated
+	MaxParams int
+	// Salt is the key of the hashes, a random key is used if empty, so that the hashes cannot be correlated between restarts
+	Salt string
+}
+
+// ParseAuditLogConfig parses the configuration of the audit log
+func ParseAuditLogConfig(s string) (*AuditLogConfig, error) {
+	parts := strings.Split(s, ";")
+	c := &AuditLogConfig{
+		Dir:           strings.TrimSpace(parts[0]),
+		Retention:     30 * 24 * time.Hour,
+		HashAddresses: true,
+		HashCaller:    true,
+		MaxParams:     128,
+	}
+	if c.Dir == "" {
+		return nil, errors.New("Missing audit log directory")
+	}
+	for _, opt := range parts[1:] {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("Invalid audit log option '%v'", opt)
+		}
+		var err error
+		switch kv[0] {
+		case "retention":
+			if c.Retention, err = time.ParseDuration(kv[1]); err != nil || c.Retention <= 0 {
+				return nil, errors.Errorf("Invalid retention '%v'", kv[1])
+			}
+		case "hashaddresses":
+			if c.HashAddresses, err = strconv.ParseBool(kv[1]); err != nil {
+				return nil, errors.Errorf("Invalid hashaddresses value '%v'", kv[1])
+			}
+		case "hashcaller":
+			if c.HashCaller, err = strconv.ParseBool(kv[1]); err != nil {
+				return nil, errors.Errorf("Invalid hashcaller value '%v'", kv[1])
+			}
+		case "caller":
+			c.CallerHeader = kv[1]
+		case "maxparams":
+			if c.MaxParams, err = strconv.Atoi(kv[1]); err != nil || c.MaxParams < 0 {
+				return nil, errors.Errorf("Invalid maxparams '%v'", kv[1])
+			}
+		case "salt":
+			c.Salt = kv[1]
+		default:
+			return nil, errors.Errorf("Unknown audit log option '%v'", kv[0])
+		}
+	}
+	return c, nil
+}
+
+// auditRecord is one API query in the audit log, Method is the API method prefixed by the additional network
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Params    string    `json:"params,omitempty"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latencyMs"`
+	Caller    string    `json:"caller,omitempty"`
+}
+
+// AuditLog writes the API queries of the public server to the files rotated daily and removes the files older than the retention,
+// the records are written asynchronously and dropped if the writing does not keep up with the requests
+type AuditLog struct {
+	config  *AuditLogConfig
+	key     []byte
+	records chan *auditRecord
+	done    chan struct{}
+	dropped uint64
+	// closed guards records, the requests still running during the shutdown must not write to the closed channel
+	mux    sync.RWMutex
+	closed bool
+	// owned by the writer goroutine
+	day  string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// NewAuditLog creates the directory of the audit log and starts the writer of the records
+func NewAuditLog(c *AuditLogConfig) (*AuditLog, error) {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return nil, err
+	}
+	a := &AuditLog{
+		config:  c,
+		records: make(chan *auditRecord, auditLogQueue),
+		done:    make(chan struct{}),
+	}
+	if c.Salt != "" {
+		a.key = []byte(c.Salt)
+	} else {
+		a.key = make([]byte, 32)
+		if _, err := rand.Read(a.key); err != nil {
+			return nil, err
+		}
+	}
+	go a.run()
+	return a, nil
+}
+
+// Close writes the pending records and closes the log file
+func (a *AuditLog) Close() {
+	a.mux.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.records)
+	}
+	a.mux.Unlock()
+	<-a.done
+}
+
+func (a *AuditLog) log(r *auditRecord) {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.records <- r:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+func (a *AuditLog) run() {
+	defer close(a.done)
+	for r := range a.records {
+		if err := a.write(r); err != nil {
+			glog.Error("audit log: ", err)
+		}
+		if len(a.records) == 0 && a.buf != nil {
+			if err := a.buf.Flush(); err != nil {
+				glog.Error("audit log: ", err)
+			}
+			if d := atomic.SwapUint64(&a.dropped, 0); d > 0 {
+				glog.Warning("audit log: ", d, " records dropped, the writing does not keep up with the requests")
+			}
+		}
+	}
+	a.closeFile()
+}
+
+func (a *AuditLog) write(r *auditRecord) error {
+	if day := r.Time.UTC().Format(auditLogDayFormat); day != a.day {
+		if err := a.rotate(day, r.Time); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err = a.buf.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *AuditLog) closeFile() {
+	if a.file == nil {
+		return
+	}
+	if err := a.buf.Flush(); err != nil {
+		glog.Error("audit log: ", err)
+	}
+	if err := a.file.Close(); err != nil {
+		glog.Error("audit log: ", err)
+	}
+	a.file, a.buf = nil, nil
+}
+
+// rotate switches to the file of the day and removes the expired files
+func (a *AuditLog) rotate(day string, now time.Time) error {
+	a.closeFile()
+	f, err := os.OpenFile(filepath.Join(a.config.Dir, auditLogFilePrefix+day+auditLogFileSuffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	a.day, a.file, a.buf = day, f, bufio.NewWriter(f)
+	return a.removeExpired(now)
+}
+
+// removeExpired removes the log files, all records of which are older than the retention
+func (a *AuditLog) removeExpired(now time.Time) error {
+	files, err := ioutil.ReadDir(a.config.Dir)
+	if err != nil {
+		return err
+	}
+	limit := now.Add(-a.config.Retention)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, auditLogFilePrefix) || !strings.HasSuffix(name, auditLogFileSuffix) {
+			continue
+		}
+		day, err := time.Parse(auditLogDayFormat, name[len(auditLogFilePrefix):len(name)-len(auditLogFileSuffix)])
+		if err != nil {
+			continue
+		}
+		if day.Add(24 * time.Hour).Before(limit) {
+			if err := os.Remove(filepath.Join(a.config.Dir, name)); err != nil {
+				return err
+			}
+			glog.Info("audit log: removed expired ", name)
+		}
+	}
+	return nil
+}
+
+// hash returns the keyed hash of the value, the same values have the same hashes while the key is not changed
+func (a *AuditLog) hash(v string) string {
+	m := hmac.New(sha256.New, a.key)
+	m.Write([]byte(v))
+	return "#" + hex.EncodeToString(m.Sum(nil)[:8])
+}
+
+// isAddress returns true if the value is an address of the coin of the parser
+func isAddress(parser bchain.BlockChainParser, v string) bool {
+	addrDesc, err := parser.GetAddrDescFromAddress(v)
+	if err != nil || len(addrDesc) == 0 {
+		return false
+	}
+	// some parsers accept any hex string, the address must be the canonical form of the descriptor
+	a, _, err := parser.GetAddressesFromAddrDesc(addrDesc)
+	return err == nil && len(a) == 1 && strings.EqualFold(a[0], v)
+}
+
+// redact replaces the addresses in the comma separated list of values by their hashes
+func (a *AuditLog) redact(parser bchain.BlockChainParser, v string) string {
+	if !a.config.HashAddresses || parser == nil || v == "" {
+		return v
+	}
+	values := strings.Split(v, ",")
+	for i := range values {
+		if isAddress(parser, values[i]) {
+			values[i] = a.hash(values[i])
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+// params returns the parameters of the request in the path and in the query with the addresses redacted, truncated to MaxParams
+func (a *AuditLog) params(parser bchain.BlockChainParser, path string, r *http.Request) string {
+	var p []string
+	if path != "" {
+		segments := strings.Split(path, "/")
+		for i := range segments {
+			segments[i] = a.redact(parser, segments[i])
+		}
+		p = append(p, strings.Join(segments, "/"))
+	}
+	q := r.URL.Query()
+	if len(q) > 0 {
+		keys := make([]string, 0, len(q))
+		for k := range q {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var kv []string
+		for _, k := range keys {
+			for _, v := range q[k] {
+				kv = append(kv, k+"="+a.redact(parser, v))
+			}
+		}
+		p = append(p, "?"+strings.Join(kv, "&"))
+	}
+	s := strings.Join(p, "")
+	if len(s) > a.config.MaxParams {
+		s = s[:a.config.MaxParams] + "..."
+	}
+	return s
+}
+
+func (a *AuditLog) caller(r *http.Request) string {
+	var c string
+	if a.config.CallerHeader != "" {
+		c = r.Header.Get(a.config.CallerHeader)
+	}
+	if c == "" {
+		c = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			c = host
+		}
+	}
+	if a.config.HashCaller && c != "" {
+		return a.hash(c)
+	}
+	return c
+}
+
+// statusWriter records the status of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush allows streaming of the responses
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// handler logs the API requests (under <path>[<network>/]api/) handled by h, network returns the parser
+// and the remaining path of the additional network, to which the path relative to the server belongs
+func (a *AuditLog) handler(h http.Handler, path string, parser bchain.BlockChainParser, network func(rel string) (string, bchain.BlockChainParser, string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel := strings.TrimPrefix(r.URL.Path, path)
+		prefix, p, rel := network(rel)
+		if p == nil {
+			p = parser
+		}
+		if !strings.HasPrefix(rel, "api/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		method, params := rel, ""
+		if i := strings.IndexByte(rel[4:], '/'); i >= 0 {
+			method, params = rel[:4+i], rel[4+i+1:]
+		}
+		if prefix != "" {
+			method = prefix + "/" + method
+		}
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			status := sw.status
+			if status == 0 {
+				// the handler panicked or did not write anything
+				status = http.StatusOK
+				if e := recover(); e != nil {
+					status = http.StatusInternalServerError
+					defer panic(e)
+				}
+			}
+			a.log(&auditRecord{
+				Time:      start.UTC(),
+				Method:    method,
+				Params:    a.params(p, params, r),
+				Status:    status,
+				LatencyMs: float64(time.Since(start)) / 1e6,
+				Caller:    a.caller(r),
+			})
+		}()
+		h.ServeHTTP(sw, r)
+	})
+}
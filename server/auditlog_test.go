@@ -0,0 +1,164 @@
+// +build unittest
+
+package server
+
+import (
+	"blockbook/bchain"
+	"blockbook/bchain/coins/btc"
+	"blockbook/tests/dbtestdata"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAuditLogConfig(t *testing.T) {
+	c, err := ParseAuditLogConfig("/var/log/audit;retention=48h;hashaddresses=false;caller=X-Api-Key;maxparams=64;salt=s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AuditLogConfig{Dir: "/var/log/audit", Retention: 48 * time.Hour, HashCaller: true, CallerHeader: "X-Api-Key", MaxParams: 64, Salt: "s"}
+	if *c != want {
+		t.Errorf("ParseAuditLogConfig() = %+v, want %+v", *c, want)
+	}
+	c, err = ParseAuditLogConfig("audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Retention != 30*24*time.Hour || !c.HashAddresses || !c.HashCaller || c.MaxParams != 128 {
+		t.Errorf("unexpected defaults %+v", c)
+	}
+	for _, s := range []string{"", ";retention=1h", "audit;retention=-1h", "audit;hashcaller=x", "audit;maxparams=a", "audit;foo=bar", "audit;salt"} {
+		if _, err := ParseAuditLogConfig(s); err == nil {
+			t.Errorf("ParseAuditLogConfig(%v) expected error", s)
+		}
+	}
+}
+
+func readAuditRecords(t *testing.T, dir string) []auditRecord {
+	files, err := filepath.Glob(filepath.Join(dir, auditLogFilePrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []auditRecord
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			var r auditRecord
+			if err := json.Unmarshal([]byte(l), &r); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func TestAuditLog_handler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testauditlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	parser := btc.NewBitcoinParser(btc.GetChainParams("test"), &btc.Configuration{})
+	a, err := NewAuditLog(&AuditLogConfig{Dir: dir, Retention: time.Hour, HashAddresses: true, HashCaller: true, CallerHeader: "X-Api-Key", MaxParams: 128, Salt: "salt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+	networks := map[string]bchain.BlockChainParser{"test": parser}
+	handler := a.handler(h, "/", parser, func(rel string) (string, bchain.BlockChainParser, string) {
+		if i := strings.IndexByte(rel, '/'); i > 0 {
+			if p, found := networks[rel[:i]]; found {
+				return rel[:i], p, rel[i+1:]
+			}
+		}
+		return "", nil, rel
+	})
+	for _, u := range []string{
+		"/api/address/" + dbtestdata.Addr3 + "?page=2",
+		"/test/api/utxo/" + dbtestdata.Addr3 + "," + dbtestdata.Addr1,
+		"/api/missing",
+		"/address/" + dbtestdata.Addr3,
+		"/api/tx/" + dbtestdata.TxidB1T2,
+		"/api/estimatefee/" + strings.Repeat("1", 200),
+	} {
+		r := httptest.NewRequest("GET", u, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if strings.HasPrefix(u, "/test/") {
+			r.Header.Set("X-Api-Key", "key")
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	a.Close()
+	// the records after Close are ignored
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/tx/x", nil))
+
+	records := readAuditRecords(t, dir)
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5: %+v", len(records), records)
+	}
+	h3, h1 := a.hash(dbtestdata.Addr3), a.hash(dbtestdata.Addr1)
+	ip := a.hash("192.0.2.1")
+	want := []struct {
+		method, params, caller string
+		status                 int
+	}{
+		{"api/address", h3 + "?page=2", ip, 200},
+		{"test/api/utxo", h3 + "," + h1, a.hash("key"), 200},
+		{"api/missing", "", ip, 404},
+		{"api/tx", dbtestdata.TxidB1T2, ip, 200},
+		{"api/estimatefee", strings.Repeat("1", 128) + "...", ip, 200},
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Method != w.method || r.Params != w.params || r.Caller != w.caller || r.Status != w.status {
+			t.Errorf("record %d = %+v, want %+v", i, r, w)
+		}
+	}
+	if strings.Contains(records[0].Params, dbtestdata.Addr3) || len(h3) != 17 {
+		t.Errorf("address not hashed %v", records[0].Params)
+	}
+}
+
+func TestAuditLog_removeExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testauditlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"audit-2018-08-01.log", "audit-2018-08-19.log", "audit-2018-08-20.log", "audit-x.log", "other.log"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte("{}\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := &AuditLog{config: &AuditLogConfig{Dir: dir, Retention: 24 * time.Hour}}
+	if err := a.removeExpired(time.Date(2018, 8, 21, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	if got, want := strings.Join(names, ","), "audit-2018-08-20.log,audit-x.log,other.log"; got != want {
+		t.Errorf("removeExpired() left %v, want %v", got, want)
+	}
+}
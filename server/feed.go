@@ -0,0 +1,157 @@
+package server
+
+import (
+	"blockbook/api"
+	"blockbook/common"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func atomTime(t int64) string {
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
+
+// requestOrigin returns the scheme and the host of the request
+func requestOrigin(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// feedBaseURL returns the absolute url of the public interface, to which the request of the handler at path was sent
+func feedBaseURL(r *http.Request, path string) string {
+	base := r.URL.Path
+	if i := strings.Index(base, path); i >= 0 {
+		base = base[:i]
+	}
+	return requestOrigin(r) + base
+}
+
+// newAddressAtomFeed converts the address feed to Atom feed with links to the explorer pages of the address and its transactions
+func (s *PublicServer) newAddressAtomFeed(f *api.AddressFeed, base string, self string) *atomFeed {
+	addressURL := base + "address/" + f.Address
+	af := &atomFeed{
+		Xmlns:  atomNamespace,
+		ID:     addressURL,
+		Title:  fmt.Sprintf("%v address %v", f.CoinName, f.Address),
+		Author: "Blockbook",
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: addressURL},
+		},
+		Entries: make([]atomEntry, len(f.Entries)),
+	}
+	if len(f.Entries) > 0 {
+		af.Updated = atomTime(f.Entries[0].Blocktime)
+	} else {
+		af.Updated = atomTime(time.Now().Unix())
+	}
+	shortcut := s.is.CoinShortcut
+	for i := range f.Entries {
+		e := &f.Entries[i]
+		var title string
+		switch {
+		case e.Sent == "0":
+			title = fmt.Sprintf("Received %v %v", e.Received, shortcut)
+		case e.Received == "0":
+			title = fmt.Sprintf("Sent %v %v", e.Sent, shortcut)
+		default:
+			title = fmt.Sprintf("Sent %v %v, received %v %v", e.Sent, shortcut, e.Received, shortcut)
+		}
+		txURL := base + "tx/" + e.Txid
+		af.Entries[i] = atomEntry{
+			ID:      txURL,
+			Title:   title,
+			Updated: atomTime(e.Blocktime),
+			Link:    atomLink{Rel: "alternate", Type: "text/html", Href: txURL},
+			Summary: fmt.Sprintf("Transaction %v in block %d, received %v %v, sent %v %v", e.Txid, e.Blockheight, e.Received, shortcut, e.Sent, shortcut),
+		}
+	}
+	return af
+}
+
+// apiAddressFeed returns the Atom feed of the newest confirmed transactions of the address given in path,
+// the number of transactions is given by the parameter count
+func (s *PublicServer) apiAddressFeed(w http.ResponseWriter, r *http.Request) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-feed"}).Inc()
+	start := time.Now()
+	status := "ok"
+	defer func() { s.observeRequest("apiAddressFeed", start, status) }()
+	var address string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		address = r.URL.Path[i+1:]
+	}
+	if address == "" {
+		status = s.writeStreamError(w, "apiAddressFeed", api.NewApiError("Missing address", true))
+		return
+	}
+	var count int
+	if c := r.URL.Query().Get("count"); c != "" {
+		var err error
+		if count, err = strconv.Atoi(c); err != nil {
+			status = s.writeStreamError(w, "apiAddressFeed", api.NewApiError("Parameter 'count' is not a number", true))
+			return
+		}
+	}
+	worker, err := s.getWorker(r)
+	if err != nil {
+		status = s.writeStreamError(w, "apiAddressFeed", err)
+		return
+	}
+	f, err := worker.GetAddressFeed(address, count)
+	if err != nil {
+		status = s.writeStreamError(w, "apiAddressFeed", err)
+		return
+	}
+	// the feed contains only the address, the txids and the amounts
+	self := requestOrigin(r) + r.URL.RequestURI()
+	if h := s.screenAddress(f.Address); h != nil && h.Redact {
+		self = strings.Replace(self, f.Address, RedactedAddress, -1)
+		f.Address = RedactedAddress
+	}
+	af := s.newAddressAtomFeed(f, feedBaseURL(r, "api/address-feed/"), self)
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		glog.Error("apiAddressFeed ", address, " error: ", err)
+		status = "error"
+		return
+	}
+	if err := xml.NewEncoder(w).Encode(af); err != nil {
+		glog.Error("apiAddressFeed ", address, " error: ", err)
+		status = "error"
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// compressMinBytes is the size of the response, from which the response is compressed
+const compressMinBytes = 1024
+
+// HTTPOptions are the http features of a listener, they are specified as options of the listener
+// or for the main binding of the server as a semicolon separated list of <option>=<value>, see docs/build.md
+type HTTPOptions struct {
+	// CORSOrigins are the origins allowed by the CORS policy, * allows any origin
+	CORSOrigins []string
+	// Gzip enables the gzip compression of large json responses
+	Gzip bool
+	// DisableHTTP2 disables the HTTP/2 protocol negotiated by TLS (the tls listeners support it by default)
+	DisableHTTP2 bool
+}
+
+// ParseHTTPOptions parses semicolon separated list of http options
+func ParseHTTPOptions(s string) (*HTTPOptions, error) {
+	o := &HTTPOptions{}
+	for _, opt := range strings.Split(s, ";") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("Invalid http option '%v'", opt)
+		}
+		ok, err := o.parseOption(kv[0], kv[1])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.Errorf("Unknown http option '%v'", kv[0])
+		}
+	}
+	return o, nil
+}
+
+// parseOption sets the option, returns false if the option is not a http option
+func (o *HTTPOptions) parseOption(key, value string) (bool, error) {
+	switch key {
+	case "cors":
+		if value == "" {
+			return true, errors.New("Empty cors origin")
+		}
+		o.CORSOrigins = append(o.CORSOrigins, value)
+	case "compress":
+		// brotli would need an encoder, which is not among the dependencies
+		if value != "gzip" {
+			return true, errors.Errorf("Unsupported compression '%v', supported is gzip", value)
+		}
+		o.Gzip = true
+	case "http2":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return true, errors.Errorf("Invalid http2 value '%v'", value)
+		}
+		o.DisableHTTP2 = !b
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// configure sets the protocol options of the server
+func (o *HTTPOptions) configure(srv *http.Server) {
+	if o.DisableHTTP2 {
+		// non nil empty map prevents the automatic configuration of HTTP/2
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+}
+
+// allowedOrigin returns the value of the header Access-Control-Allow-Origin for the origin or empty string
+func (o *HTTPOptions) allowedOrigin(origin string) string {
+	for _, a := range o.CORSOrigins {
+		if a == "*" {
+			return "*"
+		}
+		if strings.EqualFold(a, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// handler adds the CORS headers and the compression to the responses of the handler
+func (o *HTTPOptions) handler(h http.Handler) http.Handler {
+	if len(o.CORSOrigins) == 0 && !o.Gzip {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(o.CORSOrigins) > 0 {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				w.Header().Add("Vary", "Origin")
+				if allowed := o.allowedOrigin(origin); allowed != "" {
+					w.Header().Set("Access-Control-Allow-Origin", allowed)
+					// preflight request
+					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+						w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+						if rh := r.Header.Get("Access-Control-Request-Headers"); rh != "" {
+							w.Header().Set("Access-Control-Allow-Headers", rh)
+						}
+						w.Header().Set("Access-Control-Max-Age", "86400")
+						w.WriteHeader(http.StatusNoContent)
+						return
+					}
+				}
+			}
+		}
+		// the upgraded connections (websocket) must not be wrapped, they are hijacked
+		if o.Gzip && r.Header.Get("Upgrade") == "" && acceptsGzip(r) {
+			gw := &gzipResponseWriter{ResponseWriter: w}
+			defer gw.close()
+			w = gw
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, e := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		e = strings.TrimSpace(e)
+		if i := strings.Index(e, ";"); i >= 0 {
+			if strings.TrimSpace(e[i+1:]) == "q=0" {
+				continue
+			}
+			e = strings.TrimSpace(e[:i])
+		}
+		if e == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the beginning of the response, the response is compressed
+// if it is json and at least compressMinBytes long, otherwise it is passed through unchanged
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= compressMinBytes {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide starts the compressed or uncompressed response and writes the buffered data
+func (w *gzipResponseWriter) decide(large bool) error {
+	w.decided = true
+	hdr := w.ResponseWriter.Header()
+	if large && hdr.Get("Content-Encoding") == "" && strings.HasPrefix(hdr.Get("Content-Type"), "application/json") {
+		hdr.Set("Content-Encoding", "gzip")
+		hdr.Add("Vary", "Accept-Encoding")
+		hdr.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends the data written so far, the streamed responses are compressed regardless of their size
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes the hijacking of the connection to the wrapped writer, the response is not compressed
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Hijack is not supported")
+	}
+	w.decided = true
+	return h.Hijack()
+}
+
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,104 @@
+// +build unittest
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseHTTPOptions(t *testing.T) {
+	o, err := ParseHTTPOptions("cors=https://a.example.com; cors=https://b.example.com;compress=gzip;http2=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.CORSOrigins) != 2 || !o.Gzip || !o.DisableHTTP2 {
+		t.Errorf("unexpected options %+v", o)
+	}
+	ls, err := ParseListeners("tcp::9131;cors=*;compress=gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls[0].HTTP.CORSOrigins) != 1 || !ls[0].HTTP.Gzip || ls[0].HTTP.DisableHTTP2 {
+		t.Errorf("unexpected listener options %+v", ls[0].HTTP)
+	}
+	for _, s := range []string{"compress=br", "http2=x", "cors=", "foo=bar", "cors"} {
+		if _, err := ParseHTTPOptions(s); err == nil {
+			t.Errorf("ParseHTTPOptions(%v) expected error", s)
+		}
+	}
+}
+
+func TestHTTPOptions_handler(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("a", 2*compressMinBytes) + `"}`
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.URL.Path == "/large" {
+			w.Write([]byte(large))
+		} else {
+			w.Write([]byte(`{}`))
+		}
+	})
+	o := &HTTPOptions{CORSOrigins: []string{"https://wallet.example.com"}, Gzip: true}
+	handler := o.handler(h)
+
+	// preflight
+	r := httptest.NewRequest("OPTIONS", "/large", nil)
+	r.Header.Set("Origin", "https://wallet.example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") != "https://wallet.example.com" {
+		t.Errorf("preflight: status %v, headers %v", rr.Code, rr.Header())
+	}
+
+	// origin not allowed
+	r = httptest.NewRequest("GET", "/small", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "" || rr.Body.String() != `{}` {
+		t.Errorf("not allowed origin: headers %v, body %v", rr.Header(), rr.Body.String())
+	}
+
+	// small response is not compressed
+	r = httptest.NewRequest("GET", "/small", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != `{}` {
+		t.Errorf("small response: headers %v, body %v", rr.Header(), rr.Body.String())
+	}
+
+	// large response is compressed
+	rr = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/large", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	handler.ServeHTTP(rr, r)
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large response: headers %v", rr.Header())
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(rr.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != large {
+		t.Errorf("large response: decompressed body differs")
+	}
+
+	// client not accepting gzip
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/large", nil))
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != large {
+		t.Errorf("large response without gzip: headers %v", rr.Header())
+	}
+}
@@ -7,8 +7,15 @@ import (
 	"blockbook/db"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/golang/glog"
 
@@ -25,6 +32,12 @@ type InternalServer struct {
 	chainParser bchain.BlockChainParser
 	is          *common.InternalState
 	api         *api.Worker
+	listeners   []*ListenerConfig
+	servers     listenerServers
+	handler     http.Handler
+	requests    *requestTracker
+	migration   dbMigration
+	quotas      *Quotas
 }
 
 // NewInternalServer creates new internal http interface to blockbook and returns its handle
@@ -36,9 +49,11 @@ func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.B
 
 	addr, path := splitBinding(binding)
 	serveMux := http.NewServeMux()
+	requests := &requestTracker{}
 	https := &http.Server{
-		Addr:    addr,
-		Handler: serveMux,
+		Addr: addr,
+		// the requests are tracked so that the server can be paused during the migration of the db, except the migration itself
+		Handler: requests.handler(serveMux, path+"admin/migrate-db"),
 	}
 	s := &InternalServer{
 		https:       https,
@@ -49,17 +64,54 @@ func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.B
 		chainParser: chain.GetChainParser(),
 		is:          is,
 		api:         api,
+		handler:     https.Handler,
+		requests:    requests,
 	}
 
 	serveMux.Handle(path+"favicon.ico", http.FileServer(http.Dir("./static/")))
 	serveMux.HandleFunc(path+"metrics", promhttp.Handler().ServeHTTP)
+	serveMux.HandleFunc(path+"schema", s.schema)
+	serveMux.HandleFunc(path+"index-delta", s.indexDelta)
+	serveMux.HandleFunc(path+"index-hash", s.indexHash)
+	serveMux.HandleFunc(path+"connect-block-stats", s.connectBlockStats)
+	serveMux.HandleFunc(path+"report/received/", s.receivedReport)
+	serveMux.HandleFunc(path+"admin/loglevel", s.logLevel)
+	serveMux.HandleFunc(path+"admin/trace", s.trace)
+	serveMux.HandleFunc(path+"admin/watch", s.watch)
+	serveMux.HandleFunc(path+"admin/watch-addresses", s.watchAddresses)
+	serveMux.HandleFunc(path+"admin/coin-control", s.coinControl)
+	serveMux.HandleFunc(path+"admin/erc20-refresh", s.erc20Refresh)
+	serveMux.HandleFunc(path+"admin/silent-payments", s.silentPayments)
+	serveMux.HandleFunc(path+"admin/multisig-wallets", s.multisigWallets)
+	serveMux.HandleFunc(path+"admin/accounts", s.walletAccounts)
+	serveMux.HandleFunc(path+"admin/quotas", s.quotaConfig)
+	serveMux.HandleFunc(path+"admin/method-signatures", s.methodSignatures)
+	serveMux.HandleFunc(path+"admin/amount-anomalies", s.amountAnomalies)
+	serveMux.HandleFunc(path+"admin/migrate-db", s.migrateDb)
 	serveMux.HandleFunc(path, s.index)
 
 	return s, nil
 }
 
+// SetListeners sets additional listeners of the server, it must be called before Run
+func (s *InternalServer) SetListeners(listeners []*ListenerConfig) {
+	s.listeners = listeners
+	s.servers = newListenerServers(s.handler, listeners)
+}
+
+// SetHTTPOptions sets the http options of the main binding of the server, it must be called before Run
+func (s *InternalServer) SetHTTPOptions(o *HTTPOptions) {
+	s.https.Handler = o.handler(s.handler)
+	o.configure(s.https)
+}
+
 // Run starts the server
 func (s *InternalServer) Run() error {
+	ls, err := openListeners(s.listeners)
+	if err != nil {
+		return err
+	}
+	s.servers.serve("internal server", s.certFiles, s.listeners, ls)
 	if s.certFiles == "" {
 		glog.Info("internal server: starting to listen on http://", s.https.Addr)
 		return s.https.ListenAndServe()
@@ -71,13 +123,26 @@ func (s *InternalServer) Run() error {
 // Close closes the server
 func (s *InternalServer) Close() error {
 	glog.Infof("internal server: closing")
+	s.servers.close()
 	return s.https.Close()
 }
 
-// Shutdown shuts down the server
+// Shutdown shuts down the server, it refuses new requests and waits until the requests in progress finish,
+// so that the db can be closed afterwards
 func (s *InternalServer) Shutdown(ctx context.Context) error {
 	glog.Infof("internal server: shutdown")
-	return s.https.Shutdown(ctx)
+	s.requests.close()
+	err := s.servers.shutdown(ctx)
+	if e := s.https.Shutdown(ctx); e != nil {
+		err = e
+	}
+	if e := s.requests.wait(ctx); e != nil {
+		glog.Error("internal server: ", e)
+		if err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
 func (s *InternalServer) index(w http.ResponseWriter, r *http.Request) {
@@ -96,3 +161,398 @@ func (s *InternalServer) index(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(buf)
 }
+
+func (s *InternalServer) writeJSON(w http.ResponseWriter, data interface{}) {
+	buf, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
+
+// schema returns the description of the data format of the db
+func (s *InternalServer) schema(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, db.GetSchema())
+}
+
+// indexDelta returns the packed write sets of the blocks connected after the block given by the parameter since,
+// a mirror applies them to its copy of the db
+func (s *InternalServer) indexDelta(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 32)
+	if err != nil {
+		http.Error(w, "Missing or invalid parameter 'since'", http.StatusBadRequest)
+		return
+	}
+	buf, err := s.db.GetIndexDelta(uint32(since))
+	if err != nil {
+		glog.Error("internal server: index delta: ", err)
+		http.Error(w, fmt.Sprintf("Index delta failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(buf)
+}
+
+// indexHash returns the rolling hashes of the index at the block given by the parameter height, by default at the best block
+func (s *InternalServer) indexHash(w http.ResponseWriter, r *http.Request) {
+	var height uint32
+	if h := r.URL.Query().Get("height"); h != "" {
+		v, err := strconv.ParseUint(h, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid parameter 'height'", http.StatusBadRequest)
+			return
+		}
+		height = uint32(v)
+	} else {
+		best, _, err := s.db.GetBestBlock()
+		if err != nil {
+			glog.Error("internal server: index hash: ", err)
+			http.Error(w, fmt.Sprintf("Index hash failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		height = best
+	}
+	ih, err := s.db.GetIndexHash(height)
+	if err != nil {
+		glog.Error("internal server: index hash: ", err)
+		http.Error(w, fmt.Sprintf("Index hash failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if ih == nil {
+		http.Error(w, fmt.Sprintf("Index hash of block %d is not available", height), http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, ih)
+}
+
+// connectBlockStats returns the stats of the last windows of the connected blocks, the oldest first
+func (s *InternalServer) connectBlockStats(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.is.GetConnectBlockStats())
+}
+
+// logLevel returns (GET) or changes (POST) the glog verbosity at runtime,
+// the POST parameters v (verbosity level) and vmodule (comma-separated list of pattern=N settings) are optional
+func (s *InternalServer) logLevel(w http.ResponseWriter, r *http.Request) {
+	type resLogLevel struct {
+		V       string `json:"v"`
+		Vmodule string `json:"vmodule"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		q := r.URL.Query()
+		for _, name := range []string{"v", "vmodule"} {
+			if _, ok := q[name]; ok {
+				if err := flag.Set(name, q.Get(name)); err != nil {
+					http.Error(w, fmt.Sprintf("Invalid parameter '%v': %v", name, err), http.StatusBadRequest)
+					return
+				}
+				glog.Infof("internal server: log %v set to '%v'", name, q.Get(name))
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSON(w, resLogLevel{
+		V:       flag.Lookup("v").Value.String(),
+		Vmodule: flag.Lookup("vmodule").Value.String(),
+	})
+}
+
+// trace returns (GET), sets (POST) or clears (DELETE) the filter of targeted verbose logging of index operations,
+// the POST parameters are address (empty for all addresses), from and to (range of block heights)
+func (s *InternalServer) trace(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		q := r.URL.Query()
+		f := db.TraceFilter{Higher: math.MaxUint32}
+		if a := q.Get("address"); a != "" {
+			addrDesc, err := s.chainParser.GetAddrDescFromAddress(a)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid address '%v': %v", a, err), http.StatusBadRequest)
+				return
+			}
+			f.AddrDesc = addrDesc
+		}
+		if h := q.Get("from"); h != "" {
+			l, err := strconv.ParseUint(h, 10, 32)
+			if err != nil {
+				http.Error(w, "Parameter 'from' is not a valid height", http.StatusBadRequest)
+				return
+			}
+			f.Lower = uint32(l)
+		}
+		if h := q.Get("to"); h != "" {
+			l, err := strconv.ParseUint(h, 10, 32)
+			if err != nil {
+				http.Error(w, "Parameter 'to' is not a valid height", http.StatusBadRequest)
+				return
+			}
+			f.Higher = uint32(l)
+		}
+		if f.Lower > f.Higher {
+			http.Error(w, "Parameter 'from' is greater than 'to'", http.StatusBadRequest)
+			return
+		}
+		s.db.SetTraceFilter(&f)
+	case http.MethodDelete:
+		s.db.ClearTraceFilter()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSON(w, s.db.GetTraceFilter())
+}
+
+// watch returns and optionally changes the list of watched outpoints, spending of which is notified
+// parameters: txid and vout (the outpoint), webhook (url to POST the notification to), label, remove (removes the outpoint)
+func (s *InternalServer) watch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if txid := q.Get("txid"); txid != "" {
+		vout, err := strconv.ParseUint(q.Get("vout"), 10, 32)
+		if err != nil {
+			http.Error(w, "Parameter 'vout' is not a valid output index", http.StatusBadRequest)
+			return
+		}
+		if _, ok := q["remove"]; ok {
+			err = s.db.UnwatchOutpoint(txid, uint32(vout))
+		} else {
+			wo := db.WatchedOutpoint{
+				Txid:    txid,
+				Vout:    uint32(vout),
+				Webhook: q.Get("webhook"),
+				Label:   q.Get("label"),
+			}
+			if wo.Webhook != "" && !validWebhook(wo.Webhook) {
+				http.Error(w, "Parameter 'webhook' is not a valid http(s) url", http.StatusBadRequest)
+				return
+			}
+			err = s.db.WatchOutpoint(&wo)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid outpoint '%v:%v': %v", txid, vout, err), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("internal server: watch %v:%v, remove %v", txid, vout, q["remove"] != nil)
+	}
+	s.writeJSON(w, s.db.GetWatchedOutpoints())
+}
+
+// coinControl returns the coin control data of the wallet given by the parameter wallet,
+// POST request with the parameters txid, vout, label and frozen sets the data of one output of the wallet
+func (s *InternalServer) coinControl(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	wallet := q.Get("wallet")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		vout, err := strconv.ParseUint(q.Get("vout"), 10, 32)
+		if err != nil {
+			http.Error(w, "Parameter 'vout' is not a valid output index", http.StatusBadRequest)
+			return
+		}
+		cc := &db.CoinControl{
+			Txid:   q.Get("txid"),
+			Vout:   uint32(vout),
+			Label:  q.Get("label"),
+			Frozen: q.Get("frozen") == "true",
+		}
+		if err := s.api.SetCoinControl(wallet, cc); err != nil {
+			if apiErr, ok := err.(*api.ApiError); ok && apiErr.Public {
+				http.Error(w, apiErr.Text, http.StatusBadRequest)
+				return
+			}
+			glog.Error("internal server: coin control: ", err)
+			http.Error(w, fmt.Sprintf("Coin control of wallet '%v' failed: %v", wallet, err), http.StatusInternalServerError)
+			return
+		}
+		glog.Infof("internal server: coin control of wallet %v, output %v:%v, frozen %v", wallet, cc.Txid, cc.Vout, cc.Frozen)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ccs, err := s.api.GetCoinControl(wallet)
+	if err != nil {
+		if apiErr, ok := err.(*api.ApiError); ok && apiErr.Public {
+			http.Error(w, apiErr.Text, http.StatusBadRequest)
+			return
+		}
+		glog.Error("internal server: coin control: ", err)
+		http.Error(w, fmt.Sprintf("Coin control of wallet '%v' failed: %v", wallet, err), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, ccs)
+}
+
+// erc20Refresh reads again the metadata of ERC-20 token contract given by the parameter contract and updates the cache,
+// it is used when the contract changed its name, symbol or decimals
+func (s *InternalServer) erc20Refresh(w http.ResponseWriter, r *http.Request) {
+	contract := r.URL.Query().Get("contract")
+	if contract == "" {
+		http.Error(w, "Missing parameter 'contract'", http.StatusBadRequest)
+		return
+	}
+	c, err := s.api.RefreshErc20Contract(contract)
+	if err != nil {
+		if apiErr, ok := err.(*api.ApiError); ok && apiErr.Public {
+			http.Error(w, apiErr.Text, http.StatusBadRequest)
+			return
+		}
+		glog.Error("internal server: erc20 refresh: ", err)
+		http.Error(w, fmt.Sprintf("Refresh of contract '%v' failed: %v", contract, err), http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("internal server: erc20 contract %v refreshed, name '%v', symbol '%v', decimals %v", contract, c.Name, c.Symbol, c.Decimals)
+	s.writeJSON(w, c)
+}
+
+// silentPayments returns the history of the silent payments wallet given by the parameter wallet,
+// with the parameters from and to (block heights) the blocks are first rescanned for the outputs paying to the wallet
+func (s *InternalServer) silentPayments(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	wallet := q.Get("wallet")
+	if wallet == "" {
+		http.Error(w, "Missing parameter 'wallet'", http.StatusBadRequest)
+		return
+	}
+	writeError := func(err error) {
+		if apiErr, ok := err.(*api.ApiError); ok && apiErr.Public {
+			http.Error(w, apiErr.Text, http.StatusBadRequest)
+			return
+		}
+		glog.Error("internal server: silent payments: ", err)
+		http.Error(w, fmt.Sprintf("Silent payments of wallet '%v' failed: %v", wallet, err), http.StatusInternalServerError)
+	}
+	if q.Get("from") != "" || q.Get("to") != "" {
+		var heights [2]uint32
+		for i, name := range []string{"from", "to"} {
+			h, err := strconv.ParseUint(q.Get(name), 10, 32)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Parameter '%v' is not a valid height", name), http.StatusBadRequest)
+				return
+			}
+			heights[i] = uint32(h)
+		}
+		found, err := s.api.RescanSilentPayments(wallet, heights[0], heights[1])
+		if err != nil {
+			writeError(err)
+			return
+		}
+		glog.Infof("internal server: silent payments wallet %v rescanned, blocks %d-%d, found %d outputs", wallet, heights[0], heights[1], found)
+	}
+	h, err := s.api.GetSilentPaymentsHistory(wallet)
+	if err != nil {
+		writeError(err)
+		return
+	}
+	s.writeJSON(w, h)
+}
+
+// amountAnomalies lists (GET) the triggered guards of the amount math, optionally of the address given by the parameter address,
+// or recomputes (POST) the balance of the address, or of all listed addresses if the parameter address is not given
+func (s *InternalServer) amountAnomalies(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	var res interface{}
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		res, err = s.api.GetAmountAnomalies(address)
+	case http.MethodPost:
+		if address != "" {
+			var br *api.BalanceRecompute
+			if br, err = s.api.RecomputeAddressBalance(address); err == nil {
+				glog.Infof("internal server: balance of address %v recomputed, changed %v, unresolved %v", address, br.Changed, br.Unresolved)
+			}
+			res = br
+		} else {
+			var brs []api.BalanceRecompute
+			if brs, err = s.api.RecomputeAnomalousBalances(); err == nil {
+				glog.Infof("internal server: balances of %d addresses with amount anomalies recomputed", len(brs))
+			}
+			res = brs
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		if apiErr, ok := err.(*api.ApiError); ok && apiErr.Public {
+			http.Error(w, apiErr.Text, http.StatusBadRequest)
+			return
+		}
+		glog.Error("internal server: amount anomalies: ", err)
+		http.Error(w, fmt.Sprintf("Amount anomalies failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, res)
+}
+
+// maxReportBody is the limit of the size of the body of report request
+const maxReportBody = 128 * 1024
+
+// receivedReport returns the total value received by a set of addresses in the range of blocks given by the parameters
+// from and to (block heights) and fromTime and toTime (unix time), the addresses are separated by commas in the url path
+// or by commas or white space in the body of POST request; the report scans the history of up to 1000 addresses,
+// therefore it is served only by the internal server
+func (s *InternalServer) receivedReport(w http.ResponseWriter, r *http.Request) {
+	var list string
+	if r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReportBody))
+		if err != nil {
+			http.Error(w, "Missing addresses", http.StatusBadRequest)
+			return
+		}
+		list = string(data)
+	} else if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		list = r.URL.Path[i+1:]
+	}
+	addresses := strings.FieldsFunc(list, func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})
+	q := r.URL.Query()
+	var from uint32
+	to := ^uint32(0)
+	for _, p := range []struct {
+		name string
+		v    *uint32
+	}{{"from", &from}, {"to", &to}} {
+		if v := q.Get(p.name); v != "" {
+			h, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Parameter '%v' is not a valid height", p.name), http.StatusBadRequest)
+				return
+			}
+			*p.v = uint32(h)
+		}
+	}
+	var fromTime, toTime int64
+	for _, p := range []struct {
+		name string
+		v    *int64
+	}{{"fromTime", &fromTime}, {"toTime", &toTime}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || t <= 0 {
+				http.Error(w, fmt.Sprintf("Parameter '%v' is not a valid unix time", p.name), http.StatusBadRequest)
+				return
+			}
+			*p.v = t
+		}
+	}
+	res, err := s.api.GetReceivedReport(addresses, from, to, fromTime, toTime)
+	if err != nil {
+		if apiErr, ok := err.(*api.ApiError); ok && apiErr.Public {
+			http.Error(w, apiErr.Text, http.StatusBadRequest)
+			return
+		}
+		glog.Error("internal server: received report: ", err)
+		http.Error(w, fmt.Sprintf("Received report failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, res)
+}
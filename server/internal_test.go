@@ -0,0 +1,99 @@
+// +build unittest
+
+package server
+
+import (
+	"blockbook/bchain/coins/btc"
+	"blockbook/db"
+	"blockbook/tests/dbtestdata"
+	"encoding/json"
+	"flag"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestInternalServer_logLevel(t *testing.T) {
+	s := &InternalServer{}
+	v := flag.Lookup("v").Value.String()
+	defer flag.Set("v", v)
+	tests := []struct {
+		method string
+		query  string
+		status int
+		want   string
+	}{
+		{http.MethodGet, "?v=3", http.StatusOK, v},
+		{http.MethodPost, "?v=3", http.StatusOK, "3"},
+		{http.MethodGet, "", http.StatusOK, "3"},
+		{http.MethodPost, "?v=x", http.StatusBadRequest, ""},
+		{http.MethodPut, "?v=1", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "", http.StatusOK, "3"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		s.logLevel(rr, httptest.NewRequest(tt.method, "/admin/loglevel"+tt.query, nil))
+		if rr.Code != tt.status {
+			t.Errorf("%v %v: status %v, want %v", tt.method, tt.query, rr.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var res struct {
+			V string `json:"v"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.V != tt.want {
+			t.Errorf("%v %v: v = %v, want %v", tt.method, tt.query, res.V, tt.want)
+		}
+	}
+}
+
+func TestInternalServer_trace(t *testing.T) {
+	parser := btc.NewBitcoinParser(btc.GetChainParams("test"), &btc.Configuration{})
+	s := &InternalServer{db: &db.RocksDB{}, chainParser: parser}
+	addrDesc, err := parser.GetAddrDescFromAddress(dbtestdata.Addr1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method string
+		query  string
+		status int
+		want   *db.TraceFilter
+	}{
+		{http.MethodGet, "?from=10", http.StatusOK, nil},
+		{http.MethodPost, "?from=10", http.StatusOK, &db.TraceFilter{Lower: 10, Higher: math.MaxUint32}},
+		{http.MethodPost, "?address=" + dbtestdata.Addr1 + "&from=10&to=20", http.StatusOK, &db.TraceFilter{AddrDesc: addrDesc, Lower: 10, Higher: 20}},
+		{http.MethodPost, "?from=x", http.StatusBadRequest, nil},
+		{http.MethodPost, "?from=20&to=10", http.StatusBadRequest, nil},
+		{http.MethodPost, "?address=xyz", http.StatusBadRequest, nil},
+		{http.MethodGet, "", http.StatusOK, &db.TraceFilter{AddrDesc: addrDesc, Lower: 10, Higher: 20}},
+		{http.MethodPut, "", http.StatusMethodNotAllowed, nil},
+		{http.MethodDelete, "", http.StatusOK, nil},
+		{http.MethodGet, "", http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		s.trace(rr, httptest.NewRequest(tt.method, "/admin/trace"+tt.query, nil))
+		if rr.Code != tt.status {
+			t.Errorf("%v %v: status %v, want %v", tt.method, tt.query, rr.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var got *db.TraceFilter
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v %v: filter %+v, want %+v", tt.method, tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindowSize       = 1024
+	latencyWindowMaxAge     = time.Minute
+	latencyWindowMinSamples = 20
+)
+
+// latencyExcludedMethods are the streaming and export endpoints, the duration of their requests is given by the size
+// of the response and by the speed of the client, so any client could pause the sync by a slow download
+var latencyExcludedMethods = map[string]bool{
+	"apiAddressStream": true,
+	"apiAddressExport": true,
+	"apiAddressFeed":   true,
+}
+
+type latencySample struct {
+	end      time.Time
+	duration time.Duration
+}
+
+// latencyWindow keeps the durations of the last requests in a ring buffer to compute the recent percentiles,
+// the prometheus histograms cannot be queried by blockbook itself
+type latencyWindow struct {
+	mux     sync.Mutex
+	samples [latencyWindowSize]latencySample
+	next    int
+	count   int
+}
+
+func (l *latencyWindow) observe(end time.Time, d time.Duration) {
+	l.mux.Lock()
+	l.samples[l.next] = latencySample{end: end, duration: d}
+	l.next = (l.next + 1) % latencyWindowSize
+	if l.count < latencyWindowSize {
+		l.count++
+	}
+	l.mux.Unlock()
+}
+
+// percentile returns the p-th percentile (0 < p <= 1) of the durations of the requests which ended in latencyWindowMaxAge before now,
+// it returns 0 if there are not enough recent requests to make the percentile meaningful
+func (l *latencyWindow) percentile(now time.Time, p float64) time.Duration {
+	from := now.Add(-latencyWindowMaxAge)
+	l.mux.Lock()
+	d := make([]time.Duration, 0, l.count)
+	for i := 0; i < l.count; i++ {
+		if s := &l.samples[i]; s.end.After(from) {
+			d = append(d, s.duration)
+		}
+	}
+	l.mux.Unlock()
+	if len(d) < latencyWindowMinSamples {
+		return 0
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	i := int(float64(len(d))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(d) {
+		i = len(d) - 1
+	}
+	return d[i]
+}
+
+// APILatency returns the 95th percentile of the duration of the API requests finished in the last minute,
+// except the streaming and export endpoints, or 0 if there were only a few requests
+func (s *PublicServer) APILatency() time.Duration {
+	return s.latency.percentile(time.Now(), 0.95)
+}
@@ -0,0 +1,35 @@
+// +build unittest
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_latencyWindow(t *testing.T) {
+	var l latencyWindow
+	now := time.Now()
+	for i := 1; i < latencyWindowMinSamples; i++ {
+		l.observe(now, time.Duration(i)*time.Millisecond)
+	}
+	if got := l.percentile(now, 0.95); got != 0 {
+		t.Errorf("percentile of too few samples = %v, want 0", got)
+	}
+	// old samples are ignored
+	for i := 0; i < latencyWindowSize; i++ {
+		l.observe(now.Add(-2*latencyWindowMaxAge), time.Second)
+	}
+	for i := 1; i <= 100; i++ {
+		l.observe(now, time.Duration(i)*time.Millisecond)
+	}
+	if got, want := l.percentile(now, 0.95), 95*time.Millisecond; got != want {
+		t.Errorf("percentile = %v, want %v", got, want)
+	}
+	if got, want := l.percentile(now, 1), 100*time.Millisecond; got != want {
+		t.Errorf("percentile 1 = %v, want %v", got, want)
+	}
+	if got := l.percentile(now.Add(2*latencyWindowMaxAge), 0.95); got != 0 {
+		t.Errorf("percentile after window = %v, want 0", got)
+	}
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// ListenerConfig describes an additional listener of a http server
+// the listener is specified as <network>:<address>[;<option>=<value>]..., networks are tcp, unix and onion (Tor onion service),
+// options allow and deny restrict the access to tcp listeners, options cors, compress and http2 set the http features
+// of the listener, the format is described in docs/build.md
+type ListenerConfig struct {
+	Network string
+	Address string
+	Allow   []*net.IPNet
+	Deny    []*net.IPNet
+	Options map[string]string
+	HTTP    HTTPOptions
+}
+
+// ParseListeners parses comma separated list of listener specifications
+func ParseListeners(s string) ([]*ListenerConfig, error) {
+	var r []*ListenerConfig
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		lc, err := parseListener(spec)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, lc)
+	}
+	return r, nil
+}
+
+func parseListener(spec string) (*ListenerConfig, error) {
+	parts := strings.Split(spec, ";")
+	i := strings.Index(parts[0], ":")
+	if i <= 0 || i == len(parts[0])-1 {
+		return nil, errors.Errorf("Invalid listener '%v', expecting <network>:<address>", spec)
+	}
+	lc := &ListenerConfig{
+		Network: parts[0][:i],
+		Address: parts[0][i+1:],
+		Options: make(map[string]string),
+	}
+	switch lc.Network {
+	case "tcp", "unix", "onion":
+	default:
+		return nil, errors.Errorf("Invalid listener '%v', unsupported network '%v'", spec, lc.Network)
+	}
+	for _, o := range parts[1:] {
+		kv := strings.SplitN(o, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("Invalid listener '%v', option '%v'", spec, o)
+		}
+		switch kv[0] {
+		case "allow", "deny":
+			n, err := parseIPNet(kv[1])
+			if err != nil {
+				return nil, errors.Annotatef(err, "listener '%v'", spec)
+			}
+			if kv[0] == "allow" {
+				lc.Allow = append(lc.Allow, n)
+			} else {
+				lc.Deny = append(lc.Deny, n)
+			}
+		case "mode", "port", "key", "password", "cookie":
+			lc.Options[kv[0]] = kv[1]
+		default:
+			ok, err := lc.HTTP.parseOption(kv[0], kv[1])
+			if err != nil {
+				return nil, errors.Annotatef(err, "listener '%v'", spec)
+			}
+			if !ok {
+				return nil, errors.Errorf("Invalid listener '%v', unknown option '%v'", spec, kv[0])
+			}
+		}
+	}
+	if (len(lc.Allow) > 0 || len(lc.Deny) > 0) && lc.Network != "tcp" {
+		return nil, errors.Errorf("Invalid listener '%v', access policy is supported only by tcp listeners", spec)
+	}
+	return lc, nil
+}
+
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.Errorf("Invalid IP address '%v'", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowed checks the access policy of the listener for the remote address
+func (lc *ListenerConfig) IsAllowed(addr net.Addr) bool {
+	if len(lc.Allow) == 0 && len(lc.Deny) == 0 {
+		return true
+	}
+	ta, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	if containsIP(lc.Deny, ta.IP) {
+		return false
+	}
+	return len(lc.Allow) == 0 || containsIP(lc.Allow, ta.IP)
+}
+
+func (lc *ListenerConfig) String() string {
+	return lc.Network + ":" + lc.Address
+}
+
+// policyListener closes the accepted connections which are not allowed by the access policy of the listener
+type policyListener struct {
+	net.Listener
+	config *ListenerConfig
+}
+
+func (l *policyListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.config.IsAllowed(c.RemoteAddr()) {
+			return c, nil
+		}
+		glog.V(1).Info("listener ", l.config, ": connection from ", c.RemoteAddr(), " denied")
+		c.Close()
+	}
+}
+
+// onionListener removes the onion service when closed
+type onionListener struct {
+	net.Listener
+	control   net.Conn
+	closeOnce sync.Once
+}
+
+func (l *onionListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() {
+		// the onion service is removed by Tor when the control connection which created it is closed
+		l.control.Close()
+	})
+	return err
+}
+
+// Listen opens the listener
+func (lc *ListenerConfig) Listen() (net.Listener, error) {
+	switch lc.Network {
+	case "tcp":
+		l, err := net.Listen("tcp", lc.Address)
+		if err != nil {
+			return nil, err
+		}
+		return &policyListener{Listener: l, config: lc}, nil
+	case "unix":
+		// remove stale socket left by previous run
+		if fi, err := os.Stat(lc.Address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(lc.Address)
+		}
+		l, err := net.Listen("unix", lc.Address)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := lc.Options["mode"]; ok {
+			mode, err := strconv.ParseUint(m, 8, 32)
+			if err != nil {
+				l.Close()
+				return nil, errors.Annotatef(err, "listener %v, mode", lc)
+			}
+			if err = os.Chmod(lc.Address, os.FileMode(mode)); err != nil {
+				l.Close()
+				return nil, err
+			}
+		}
+		return l, nil
+	case "onion":
+		return lc.listenOnion()
+	}
+	return nil, errors.Errorf("Unsupported network '%v'", lc.Network)
+}
+
+// IsSecure returns true if the connections of the listener do not need TLS
+func (lc *ListenerConfig) IsSecure() bool {
+	return lc.Network == "unix" || lc.Network == "onion"
+}
+
+// listenOnion listens on a local port and publishes it as an onion service using the Tor controller
+func (lc *ListenerConfig) listenOnion() (net.Listener, error) {
+	virtualPort := 80
+	if p, ok := lc.Options["port"]; ok {
+		vp, err := strconv.ParseUint(p, 10, 16)
+		if err != nil || vp == 0 {
+			return nil, errors.Errorf("Invalid onion port '%v'", p)
+		}
+		virtualPort = int(vp)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	control, err := net.Dial("tcp", lc.Address)
+	if err != nil {
+		l.Close()
+		return nil, errors.Annotatef(err, "Tor controller %v", lc.Address)
+	}
+	serviceID, err := lc.addOnion(control, virtualPort, l.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		control.Close()
+		l.Close()
+		return nil, errors.Annotatef(err, "Tor controller %v", lc.Address)
+	}
+	glog.Info("listener ", lc, ": published onion service ", serviceID, ".onion:", virtualPort)
+	return &onionListener{Listener: l, control: control}, nil
+}
+
+func torCommand(rw *bufio.ReadWriter, cmd string) ([]string, error) {
+	if _, err := rw.WriteString(cmd + "\r\n"); err != nil {
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 {
+			return nil, errors.Errorf("Invalid reply '%v'", line)
+		}
+		if line[:3] != "250" {
+			return nil, errors.Errorf("Command failed: %v", line)
+		}
+		lines = append(lines, line[4:])
+		// the last line of the reply has space after the status code
+		if line[3] == ' ' {
+			return lines, nil
+		}
+	}
+}
+
+func (lc *ListenerConfig) addOnion(control net.Conn, virtualPort, targetPort int) (string, error) {
+	rw := bufio.NewReadWriter(bufio.NewReader(control), bufio.NewWriter(control))
+	auth := "AUTHENTICATE"
+	if p, ok := lc.Options["password"]; ok {
+		auth += " " + strconv.Quote(p)
+	} else if f, ok := lc.Options["cookie"]; ok {
+		cookie, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		auth += " " + hex.EncodeToString(cookie)
+	}
+	if _, err := torCommand(rw, auth); err != nil {
+		return "", err
+	}
+	keyFile := lc.Options["key"]
+	key := "NEW:ED25519-V3"
+	if keyFile != "" {
+		if k, err := ioutil.ReadFile(keyFile); err == nil {
+			key = strings.TrimSpace(string(k))
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	lines, err := torCommand(rw, fmt.Sprintf("ADD_ONION %s Port=%d,127.0.0.1:%d", key, virtualPort, targetPort))
+	if err != nil {
+		return "", err
+	}
+	var serviceID string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "ServiceID=") {
+			serviceID = line[len("ServiceID="):]
+		} else if strings.HasPrefix(line, "PrivateKey=") && keyFile != "" {
+			// store the new key so that the onion address is the same after restart
+			if err := ioutil.WriteFile(keyFile, []byte(line[len("PrivateKey="):]+"\n"), 0600); err != nil {
+				return "", err
+			}
+		}
+	}
+	if serviceID == "" {
+		return "", errors.New("Missing ServiceID in ADD_ONION reply")
+	}
+	return serviceID, nil
+}
+
+// openListeners opens all listeners, so that configuration errors are reported before the server starts
+func openListeners(configs []*ListenerConfig) ([]net.Listener, error) {
+	ls := make([]net.Listener, 0, len(configs))
+	for _, lc := range configs {
+		l, err := lc.Listen()
+		if err != nil {
+			for _, o := range ls {
+				o.Close()
+			}
+			return nil, errors.Annotatef(err, "listener %v", lc)
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// listenerServers are the http servers of the additional listeners, each listener has its own server with its http options
+type listenerServers []*http.Server
+
+func newListenerServers(handler http.Handler, configs []*ListenerConfig) listenerServers {
+	ss := make(listenerServers, len(configs))
+	for i, lc := range configs {
+		ss[i] = &http.Server{Handler: lc.HTTP.handler(handler)}
+		lc.HTTP.configure(ss[i])
+	}
+	return ss
+}
+
+// serve serves the servers on the opened listeners, the listeners are closed by the shutdown of the servers
+func (ss listenerServers) serve(name string, certFiles string, configs []*ListenerConfig, ls []net.Listener) {
+	for i := range ls {
+		go func(srv *http.Server, lc *ListenerConfig, l net.Listener) {
+			var err error
+			if certFiles == "" || lc.IsSecure() {
+				glog.Info(name, ": starting to listen on ", lc, " (http)")
+				err = srv.Serve(l)
+			} else {
+				glog.Info(name, ": starting to listen on ", lc, " (https)")
+				err = srv.ServeTLS(l, fmt.Sprint(certFiles, ".crt"), fmt.Sprint(certFiles, ".key"))
+			}
+			if err != nil && err != http.ErrServerClosed {
+				glog.Error(name, ": listener ", lc, " error ", err)
+			}
+		}(ss[i], configs[i], ls[i])
+	}
+}
+
+func (ss listenerServers) close() error {
+	var err error
+	for _, srv := range ss {
+		if e := srv.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (ss listenerServers) shutdown(ctx context.Context) error {
+	var err error
+	for _, srv := range ss {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+// +build unittest
+
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseListeners(t *testing.T) {
+	ls, err := ParseListeners("tcp:[::1]:9131;allow=10.0.0.0/8;allow=::1;deny=10.0.0.1, unix:/tmp/bb.sock;mode=660,onion:127.0.0.1:9051;port=443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 3 {
+		t.Fatalf("expected 3 listeners, got %v", len(ls))
+	}
+	if ls[0].Network != "tcp" || ls[0].Address != "[::1]:9131" || ls[1].String() != "unix:/tmp/bb.sock" || ls[2].Options["port"] != "443" {
+		t.Errorf("unexpected listeners %v %v %v", ls[0], ls[1], ls[2])
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"10.0.0.1", false},
+		{"::1", true},
+		{"192.168.1.1", false},
+	}
+	for _, tt := range tests {
+		if got := ls[0].IsAllowed(&net.TCPAddr{IP: net.ParseIP(tt.ip)}); got != tt.want {
+			t.Errorf("IsAllowed(%v) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if !ls[1].IsAllowed(&net.UnixAddr{Name: "@", Net: "unix"}) {
+		t.Error("unix listener without policy must allow all connections")
+	}
+
+	for _, s := range []string{"udp:127.0.0.1:1", "tcp:", "unix:/tmp/bb.sock;allow=127.0.0.1", "tcp::9130;allow=x", "tcp::9130;foo=bar"} {
+		if _, err := ParseListeners(s); err == nil {
+			t.Errorf("ParseListeners(%v) expected error", s)
+		}
+	}
+}
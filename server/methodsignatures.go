@@ -0,0 +1,94 @@
+package server
+
+import (
+	"blockbook/bchain"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// maxMethodSignatureBody is the maximum size of the posted method signature
+const maxMethodSignatureBody = 4 * 1024
+
+// resMethodSignatures are the known signatures of the selector
+type resMethodSignatures struct {
+	Selector   string   `json:"selector"`
+	Signatures []string `json:"signatures"`
+}
+
+// methodSignatures returns (GET with the parameter selector) the known signatures of the selector of a contract method,
+// adds (POST with {"signature":"name(type,...)"} in the body) or removes (DELETE with the parameter signature) a signature
+// of the dictionary used to decode the contract calls
+func (s *InternalServer) methodSignatures(w http.ResponseWriter, r *http.Request) {
+	var selector string
+	switch r.Method {
+	case http.MethodGet:
+		selector = strings.ToLower(r.URL.Query().Get("selector"))
+		if selector == "" {
+			http.Error(w, "Missing parameter 'selector'", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		var req struct {
+			Signature string `json:"signature"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxMethodSignatureBody)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid method signature: %v", err), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if selector, err = s.db.AddMethodSignature(req.Signature); err != nil {
+			if err == bchain.ErrNotSupported {
+				http.Error(w, "Method signatures are not supported by the coin", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Invalid method signature '%v': %v", req.Signature, err), http.StatusBadRequest)
+			return
+		}
+		glog.Info("internal server: method signature ", req.Signature, " added, selector ", selector)
+	case http.MethodDelete:
+		signature := r.URL.Query().Get("signature")
+		if signature == "" {
+			http.Error(w, "Missing parameter 'signature'", http.StatusBadRequest)
+			return
+		}
+		selector, err := s.chainParser.GetMethodSelector(signature)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid method signature '%v': %v", signature, err), http.StatusBadRequest)
+			return
+		}
+		removed, err := s.db.RemoveMethodSignature(signature)
+		if err != nil {
+			glog.Error("internal server: method signature ", signature, ": ", err)
+			http.Error(w, fmt.Sprintf("Removal of method signature '%v' failed: %v", signature, err), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, fmt.Sprintf("Method signature '%v' was not added", signature), http.StatusNotFound)
+			return
+		}
+		glog.Info("internal server: method signature ", signature, " removed")
+		s.writeMethodSignatures(w, selector)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeMethodSignatures(w, selector)
+}
+
+func (s *InternalServer) writeMethodSignatures(w http.ResponseWriter, selector string) {
+	signatures, err := s.db.GetMethodSignatures(selector)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid selector: %v", err), http.StatusBadRequest)
+		return
+	}
+	if signatures == nil {
+		signatures = []string{}
+	}
+	s.writeJSON(w, resMethodSignatures{Selector: selector, Signatures: signatures})
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// dbMigration is the state of the migration of the db to another directory started by the internal server
+type dbMigration struct {
+	mux     sync.Mutex
+	migrate func(path string) error
+	status  dbMigrationStatus
+}
+
+type dbMigrationStatus struct {
+	Path     string `json:"path,omitempty"`
+	Running  bool   `json:"running"`
+	Started  string `json:"started,omitempty"`
+	Finished string `json:"finished,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SetDbMigration enables the endpoint admin/migrate-db, the function migrate moves the db to the given directory
+func (s *InternalServer) SetDbMigration(migrate func(path string) error) {
+	s.migration.mux.Lock()
+	s.migration.migrate = migrate
+	s.migration.mux.Unlock()
+}
+
+// Pause makes the new requests wait and waits until the requests in progress finish, so that the db can be switched,
+// if the context is done first, the server is resumed and the error is returned
+func (s *InternalServer) Pause(ctx context.Context) error {
+	s.requests.pause()
+	if err := s.requests.wait(ctx); err != nil {
+		s.requests.resume()
+		return err
+	}
+	return nil
+}
+
+// Resume lets the requests waiting since Pause continue
+func (s *InternalServer) Resume() {
+	s.requests.resume()
+}
+
+// migrateDb starts the migration of the db to the directory given by the parameter path and returns its status,
+// the migration runs in background, without the parameter the status of the last migration is returned
+func (s *InternalServer) migrateDb(w http.ResponseWriter, r *http.Request) {
+	m := &s.migration
+	path := r.URL.Query().Get("path")
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.migrate == nil {
+		http.Error(w, "Migration of the db is not enabled", http.StatusBadRequest)
+		return
+	}
+	if path != "" {
+		if m.status.Running {
+			http.Error(w, "Migration of the db to "+m.status.Path+" is already running", http.StatusConflict)
+			return
+		}
+		migrate := m.migrate
+		m.status = dbMigrationStatus{Path: path, Running: true, Started: time.Now().UTC().Format(time.RFC3339)}
+		glog.Info("internal server: migration of the db to ", path, " started")
+		go func() {
+			err := migrate(path)
+			m.mux.Lock()
+			defer m.mux.Unlock()
+			m.status.Running = false
+			m.status.Finished = time.Now().UTC().Format(time.RFC3339)
+			if err != nil {
+				glog.Error("internal server: migration of the db to ", path, ": ", err)
+				m.status.Error = err.Error()
+			} else {
+				glog.Info("internal server: migration of the db to ", path, " finished")
+			}
+		}()
+	}
+	s.writeJSON(w, m.status)
+}
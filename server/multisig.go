@@ -0,0 +1,121 @@
+package server
+
+import (
+	"blockbook/api"
+	"blockbook/bchain"
+	"blockbook/common"
+	"blockbook/db"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// maxMultisigWalletBody is the maximum size of the registered multisig wallet
+const maxMultisigWalletBody = 64 * 1024
+
+// multisigWallets lists (GET) the registered multisig wallets, registers or updates (POST with the wallet as json in the body)
+// or removes (DELETE with the parameter name) a multisig wallet
+func (s *InternalServer) multisigWallets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, s.db.GetMultisigWallets())
+	case http.MethodPost:
+		var mw db.MultisigWallet
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxMultisigWalletBody)).Decode(&mw); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid multisig wallet: %v", err), http.StatusBadRequest)
+			return
+		}
+		if mw.Webhook != "" && !validWebhook(mw.Webhook) {
+			http.Error(w, "Webhook is not a valid http(s) url", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.RegisterMultisigWallet(&mw); err != nil {
+			if err == bchain.ErrNotSupported {
+				http.Error(w, "Multisig wallets are not supported by the coin", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Invalid multisig wallet '%v': %v", mw.Name, err), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("internal server: multisig wallet %v registered, %d descriptors, lookahead %d, birthday %d", mw.Name, len(mw.Descriptors), mw.Lookahead, mw.Birthday)
+		s.writeJSON(w, s.db.GetMultisigWallet(mw.Name))
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "Missing parameter 'name'", http.StatusBadRequest)
+			return
+		}
+		removed, err := s.db.UnregisterMultisigWallet(name)
+		if err != nil {
+			glog.Error("internal server: multisig wallet ", name, ": ", err)
+			http.Error(w, fmt.Sprintf("Removal of multisig wallet '%v' failed: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, fmt.Sprintf("Multisig wallet '%v' is not registered", name), http.StatusNotFound)
+			return
+		}
+		glog.Info("internal server: multisig wallet ", name, " removed")
+		s.writeJSON(w, s.db.GetMultisigWallets())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// apiMultisigFeed returns the activity feed of the multisig wallet given in path, parameters token (the token of the wallet),
+// from (the first returned sequence number) and limit (the maximum number of events)
+func (s *PublicServer) apiMultisigFeed(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-multisig"}).Inc()
+	var wallet string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		wallet = r.URL.Path[i+1:]
+	}
+	if wallet == "" {
+		return nil, api.NewApiError("Missing wallet, expecting api/multisig/<wallet>", true)
+	}
+	q := r.URL.Query()
+	var from uint64
+	if p := q.Get("from"); p != "" {
+		var err error
+		if from, err = strconv.ParseUint(p, 10, 64); err != nil {
+			return nil, api.NewApiError("Parameter 'from' is not a valid sequence number", true)
+		}
+	}
+	var limit int
+	if p := q.Get("limit"); p != "" {
+		var err error
+		if limit, err = strconv.Atoi(p); err != nil {
+			return nil, api.NewApiError("Parameter 'limit' is not a number", true)
+		}
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetMultisigFeed(wallet, q.Get("token"), from, limit)
+}
+
+// OnMultisigEvents notifies users subscribed to blockbook/multisig of the wallet about its new events
+func (s *PublicServer) OnMultisigEvents(events []db.MultisigEvent) {
+	s.socketio.OnMultisigEvents(events)
+}
+
+// OnMultisigEvents posts the events to the webhooks of the multisig wallets asynchronously
+func (n *WebhookNotifier) OnMultisigEvents(events []db.MultisigEvent) {
+	for i := range events {
+		if events[i].Webhook == "" {
+			continue
+		}
+		data, err := json.Marshal(&events[i])
+		if err != nil {
+			glog.Error("webhook: ", err)
+			continue
+		}
+		go n.post(events[i].Webhook, data)
+	}
+}
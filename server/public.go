@@ -5,18 +5,22 @@ import (
 	"blockbook/bchain"
 	"blockbook/common"
 	"blockbook/db"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"math/big"
+	"net"
 	"net/http"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/golang/glog"
 )
@@ -31,6 +35,7 @@ type PublicServer struct {
 	certFiles        string
 	socketio         *SocketIoServer
 	https            *http.Server
+	serveMux         *http.ServeMux
 	db               *db.RocksDB
 	txCache          *db.TxCache
 	chain            bchain.BlockChain
@@ -42,6 +47,14 @@ type PublicServer struct {
 	is               *common.InternalState
 	templates        []*template.Template
 	debug            bool
+	listeners        []*ListenerConfig
+	servers          listenerServers
+	handler          http.Handler
+	requests         *requestTracker
+	latency          latencyWindow
+	networks         map[string]bchain.BlockChainParser
+	screener         AddressScreener
+	quotas           *Quotas
 }
 
 // NewPublicServer creates new public server http interface to blockbook and returns its handle
@@ -60,15 +73,19 @@ func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bch
 
 	addr, path := splitBinding(binding)
 	serveMux := http.NewServeMux()
+	requests := &requestTracker{}
+	socketio.requests = requests
 	https := &http.Server{
-		Addr:    addr,
-		Handler: serveMux,
+		Addr: addr,
+		// the socket.io messages are tracked by the socket.io server
+		Handler: requests.handler(serveMux, path+"socket.io/"),
 	}
 
 	s := &PublicServer{
 		binding:          binding,
 		certFiles:        certFiles,
 		https:            https,
+		serveMux:         serveMux,
 		api:              api,
 		socketio:         socketio,
 		db:               db,
@@ -80,6 +97,8 @@ func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bch
 		metrics:          metrics,
 		is:               is,
 		debug:            debugMode,
+		requests:         requests,
+		handler:          https.Handler,
 	}
 	s.templates = parseTemplates()
 
@@ -94,8 +113,96 @@ func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bch
 	return s, nil
 }
 
+// SetListeners sets additional listeners of the server, it must be called before Run
+func (s *PublicServer) SetListeners(listeners []*ListenerConfig) {
+	s.listeners = listeners
+	s.servers = newListenerServers(s.handler, listeners)
+}
+
+// SetHTTPOptions sets the http options of the main binding of the server, it must be called before Run
+func (s *PublicServer) SetHTTPOptions(o *HTTPOptions) {
+	s.https.Handler = o.handler(s.handler)
+	o.configure(s.https)
+}
+
+// SetLargeAddressTxs sets the number of transactions, above which the history of an address is returned only in the summary-only mode,
+// 0 disables the limit
+func (s *PublicServer) SetLargeAddressTxs(n uint32) {
+	s.api.SetLargeAddressTxs(n)
+	s.socketio.api.SetLargeAddressTxs(n)
+}
+
+// NetworkBinding returns the binding of the public interface of the additional network served under /<prefix>/ by the server
+func (s *PublicServer) NetworkBinding(prefix string) string {
+	addr, path := splitBinding(s.binding)
+	return addr + path + prefix + "/"
+}
+
+// MountNetwork serves the public interface of the additional network under /<prefix>/, it must be called before Run;
+// the requests of the network are tracked by both servers except the socket.io messages, which are tracked by the network
+func (s *PublicServer) MountNetwork(prefix string, n *PublicServer) {
+	_, path := splitBinding(s.binding)
+	s.requests.skip = append(s.requests.skip, path+prefix+"/socket.io/")
+	s.serveMux.Handle(path+prefix+"/", n.handler)
+	if s.networks == nil {
+		s.networks = make(map[string]bchain.BlockChainParser)
+	}
+	s.networks[prefix] = n.chainParser
+	if s.screener != nil {
+		n.SetAddressScreener(s.screener)
+	}
+	if s.quotas != nil {
+		n.socketio.quotas = s.quotas
+	}
+}
+
+// SetAddressScreener screens the addresses in the API responses and in the socket.io notifications of the server
+// and of the networks mounted afterwards, it must be called before Run
+func (s *PublicServer) SetAddressScreener(screener AddressScreener) {
+	s.screener = screener
+	s.socketio.screener = screener
+}
+
+// SetAuditLog logs the API requests of the server, including the requests of the mounted networks, to the audit log,
+// it must be called before SetListeners and SetHTTPOptions
+func (s *PublicServer) SetAuditLog(a *AuditLog) {
+	_, path := splitBinding(s.binding)
+	s.handler = a.handler(s.handler, path, s.chainParser, s.auditNetwork)
+	s.https.Handler = s.handler
+}
+
+// SetQuotas limits the API requests of the server, including the requests of the mounted networks, and the socket.io messages
+// by the quotas of the clients, it must be called before SetAuditLog, SetListeners and SetHTTPOptions,
+// so that the rejected requests are logged
+func (s *PublicServer) SetQuotas(q *Quotas) {
+	_, path := splitBinding(s.binding)
+	s.quotas = q
+	s.socketio.quotas = q
+	s.handler = q.handler(s.handler, path, func(rel string) string {
+		_, _, r := s.auditNetwork(rel)
+		return r
+	})
+	s.https.Handler = s.handler
+}
+
+// auditNetwork returns the prefix and the parser of the mounted network, to which the path relative to the server belongs,
+// and the path relative to the network
+func (s *PublicServer) auditNetwork(rel string) (string, bchain.BlockChainParser, string) {
+	if i := strings.IndexByte(rel, '/'); i > 0 {
+		if p, found := s.networks[rel[:i]]; found {
+			return rel[:i], p, rel[i+1:]
+		}
+	}
+	return "", nil, rel
+}
+
 // Run starts the server
 func (s *PublicServer) Run() error {
+	ls, err := openListeners(s.listeners)
+	if err != nil {
+		return err
+	}
+	s.servers.serve("public server", s.certFiles, s.listeners, ls)
 	if s.certFiles == "" {
 		glog.Info("public server: starting to listen on http://", s.https.Addr)
 		return s.https.ListenAndServe()
@@ -106,7 +213,7 @@ func (s *PublicServer) Run() error {
 
 // ConnectFullPublicInterface enables complete public functionality
 func (s *PublicServer) ConnectFullPublicInterface() {
-	serveMux := s.https.Handler.(*http.ServeMux)
+	serveMux := s.serveMux
 	_, path := splitBinding(s.binding)
 	// support for tests of socket.io interface
 	serveMux.Handle(path+"test.html", http.FileServer(http.Dir("./static/")))
@@ -129,9 +236,42 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 	serveMux.HandleFunc(path+"api/tx/", s.jsonHandler(s.apiTx))
 	serveMux.HandleFunc(path+"api/tx-specific/", s.jsonHandler(s.apiTxSpecific))
 	serveMux.HandleFunc(path+"api/address/", s.jsonHandler(s.apiAddress))
+	serveMux.HandleFunc(path+"api/address-stream/", s.apiAddressStream)
+	serveMux.HandleFunc(path+"api/address-export/", s.apiAddressExport)
+	serveMux.HandleFunc(path+"api/address-feed/", s.apiAddressFeed)
 	serveMux.HandleFunc(path+"api/block/", s.jsonHandler(s.apiBlock))
+	serveMux.HandleFunc(path+"api/block-addresses/", s.jsonHandler(s.apiBlockAddresses))
 	serveMux.HandleFunc(path+"api/sendtx/", s.jsonHandler(s.apiSendTx))
 	serveMux.HandleFunc(path+"api/estimatefee/", s.jsonHandler(s.apiEstimateFee))
+	serveMux.HandleFunc(path+"api/feehistory/", s.jsonHandler(s.apiFeeHistory))
+	serveMux.HandleFunc(path+"api/blockstats/", s.jsonHandler(s.apiBlockStats))
+	serveMux.HandleFunc(path+"api/largest-txs/", s.jsonHandler(s.apiLargestTxs))
+	serveMux.HandleFunc(path+"api/validate-payment/", s.jsonHandler(s.apiValidatePayment))
+	serveMux.HandleFunc(path+"api/snapshot/", s.jsonHandler(s.apiSnapshot))
+	serveMux.HandleFunc(path+"api/script-template/", s.jsonHandler(s.apiScriptTemplate))
+	serveMux.HandleFunc(path+"api/nonce/", s.jsonHandler(s.apiNonce))
+	serveMux.HandleFunc(path+"api/address-summary/", s.jsonHandler(s.apiAddressSummary))
+	serveMux.HandleFunc(path+"api/addresses/", s.jsonHandler(s.apiAddressGroup))
+	serveMux.HandleFunc(path+"api/search/", s.jsonHandler(s.apiSearch))
+	serveMux.HandleFunc(path+"api/emission", s.jsonHandler(s.apiEmission))
+	serveMux.HandleFunc(path+"api/coin-supply/", s.jsonHandler(s.apiCoinSupply))
+	serveMux.HandleFunc(path+"api/burns/", s.jsonHandler(s.apiBurns))
+	serveMux.HandleFunc(path+"api/flows/", s.jsonHandler(s.apiFlows))
+	serveMux.HandleFunc(path+"api/mempool-eviction/", s.jsonHandler(s.apiMempoolEviction))
+	serveMux.HandleFunc(path+"api/tx-proof/", s.jsonHandler(s.apiTxProof))
+	serveMux.HandleFunc(path+"api/reorgs", s.jsonHandler(s.apiReorgs))
+	serveMux.HandleFunc(path+"api/verify-message/", s.jsonHandler(s.apiVerifyMessage))
+	serveMux.HandleFunc(path+"api/decode-and-test/", s.jsonHandler(s.apiDecodeAndTest))
+	serveMux.HandleFunc(path+"api/simulate-tx/", s.jsonHandler(s.apiSimulateTx))
+	serveMux.HandleFunc(path+"api/name/", s.jsonHandler(s.apiName))
+	serveMux.HandleFunc(path+"api/inscription/", s.jsonHandler(s.apiInscription))
+	serveMux.HandleFunc(path+"api/inscriptions/", s.jsonHandler(s.apiAddressInscriptions))
+	serveMux.HandleFunc(path+"api/payment-id/", s.jsonHandler(s.apiPaymentID))
+	serveMux.HandleFunc(path+"api/utxo/", s.jsonHandler(s.apiUtxo))
+	serveMux.HandleFunc(path+"api/coin-control/", s.jsonHandler(s.apiCoinControl))
+	serveMux.HandleFunc(path+"api/multisig/", s.jsonHandler(s.apiMultisigFeed))
+	serveMux.HandleFunc(path+"api/account/", s.jsonHandler(s.apiWalletAccount))
+	serveMux.HandleFunc(path+"api/account-utxo/", s.jsonHandler(s.apiWalletAccountUtxo))
 	// socket.io interface
 	serveMux.Handle(path+"socket.io/", s.socketio.GetHandler())
 }
@@ -139,13 +279,42 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 // Close closes the server
 func (s *PublicServer) Close() error {
 	glog.Infof("public server: closing")
+	s.servers.close()
 	return s.https.Close()
 }
 
-// Shutdown shuts down the server
+// Shutdown shuts down the server, it refuses new requests and waits until the requests in progress
+// including the socket.io messages finish, so that the db can be closed afterwards
 func (s *PublicServer) Shutdown(ctx context.Context) error {
 	glog.Infof("public server: shutdown")
-	return s.https.Shutdown(ctx)
+	s.requests.close()
+	err := s.servers.shutdown(ctx)
+	if e := s.https.Shutdown(ctx); e != nil {
+		err = e
+	}
+	if e := s.requests.wait(ctx); e != nil {
+		glog.Error("public server: ", e)
+		if err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Pause makes the new requests including the socket.io messages wait and waits until the requests in progress finish,
+// so that the db can be switched; if the context is done first, the server is resumed and the error is returned
+func (s *PublicServer) Pause(ctx context.Context) error {
+	s.requests.pause()
+	if err := s.requests.wait(ctx); err != nil {
+		s.requests.resume()
+		return err
+	}
+	return nil
+}
+
+// Resume lets the requests waiting since Pause continue
+func (s *PublicServer) Resume() {
+	s.requests.resume()
 }
 
 // OnNewBlock notifies users subscribed to bitcoind/hashblock about new block
@@ -153,6 +322,16 @@ func (s *PublicServer) OnNewBlock(hash string, height uint32) {
 	s.socketio.OnNewBlockHash(hash)
 }
 
+// OnWatchedOutpointSpent notifies users subscribed to blockbook/spentoutpoint about spent watched outpoints
+func (s *PublicServer) OnWatchedOutpointSpent(spent []db.WatchedOutpointSpent) {
+	s.socketio.OnWatchedOutpointSpent(spent)
+}
+
+// OnMempoolEviction notifies users about transactions removed from the mempool without being confirmed
+func (s *PublicServer) OnMempoolEviction(evictions []bchain.MempoolEviction) {
+	s.socketio.OnMempoolEviction(evictions)
+}
+
 // OnNewTxAddr notifies users subscribed to bitcoind/addresstxid about new block
 func (s *PublicServer) OnNewTxAddr(txid string, desc bchain.AddressDescriptor, isOutput bool) {
 	s.socketio.OnNewTxAddr(txid, desc, isOutput)
@@ -190,17 +369,40 @@ func getFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
 
+// getMethodName returns the name of the handler method without the package and receiver, used as the label of the metrics
+func getMethodName(handler interface{}) string {
+	n := getFunctionName(handler)
+	if i := strings.LastIndexByte(n, '.'); i >= 0 {
+		n = n[i+1:]
+	}
+	return strings.TrimSuffix(n, "-fm")
+}
+
+// observeRequest records the duration and the status (ok, badrequest, error or panic) of the request
+func (s *PublicServer) observeRequest(method string, start time.Time, status string) {
+	s.metrics.APIRequests.With(common.Labels{"method": method, "status": status}).Inc()
+	now := time.Now()
+	s.metrics.APIReqDuration.With(common.Labels{"method": method, "status": status}).Observe(float64(now.Sub(start)) / 1e6) // in milliseconds
+	if !latencyExcludedMethods[method] {
+		s.latency.observe(now, now.Sub(start))
+	}
+}
+
 func (s *PublicServer) jsonHandler(handler func(r *http.Request) (interface{}, error)) func(w http.ResponseWriter, r *http.Request) {
 	type jsonError struct {
 		Text       string `json:"error"`
 		HTTPStatus int    `json:"-"`
 	}
+	method := getMethodName(handler)
 	return func(w http.ResponseWriter, r *http.Request) {
 		var data interface{}
 		var err error
+		start := time.Now()
 		defer func() {
+			status := "ok"
 			if e := recover(); e != nil {
 				glog.Error(getFunctionName(handler), " recovered from panic: ", e)
+				status = "panic"
 				if s.debug {
 					data = jsonError{fmt.Sprint("Internal server error: recovered from panic ", e), http.StatusInternalServerError}
 				} else {
@@ -210,10 +412,21 @@ func (s *PublicServer) jsonHandler(handler func(r *http.Request) (interface{}, e
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
 			if e, isError := data.(jsonError); isError {
 				w.WriteHeader(e.HTTPStatus)
+				if status == "ok" {
+					if e.HTTPStatus == http.StatusBadRequest {
+						status = "badrequest"
+					} else {
+						status = "error"
+					}
+				}
 			}
 			json.NewEncoder(w).Encode(data)
+			s.observeRequest(method, start, status)
 		}()
 		data, err = handler(r)
+		if err == nil {
+			data, err = screenData(s.screener, data)
+		}
 		if err != nil || data == nil {
 			if apiErr, ok := err.(*api.ApiError); ok {
 				if apiErr.Public {
@@ -256,13 +469,18 @@ func (s *PublicServer) newTemplateDataWithError(text string) *TemplateData {
 }
 
 func (s *PublicServer) htmlTemplateHandler(handler func(w http.ResponseWriter, r *http.Request) (tpl, *TemplateData, error)) func(w http.ResponseWriter, r *http.Request) {
+	method := getMethodName(handler)
 	return func(w http.ResponseWriter, r *http.Request) {
 		var t tpl
 		var data *TemplateData
 		var err error
+		var hits map[string]*ScreeningHit
+		start := time.Now()
 		defer func() {
+			status := "ok"
 			if e := recover(); e != nil {
 				glog.Error(getFunctionName(handler), " recovered from panic: ", e)
+				status = "panic"
 				t = errorInternalTpl
 				if s.debug {
 					data = s.newTemplateDataWithError(fmt.Sprint("Internal server error: recovered from panic ", e))
@@ -277,10 +495,28 @@ func (s *PublicServer) htmlTemplateHandler(handler func(w http.ResponseWriter, r
 				if t == errorInternalTpl {
 					w.WriteHeader(http.StatusInternalServerError)
 				}
-				if err := s.templates[t].ExecuteTemplate(w, "base.html", data); err != nil {
+				if len(hits) > 0 {
+					// the redacted addresses are replaced in the rendered page
+					var b bytes.Buffer
+					err := s.templates[t].ExecuteTemplate(&b, "base.html", data)
+					if err == nil {
+						_, err = w.Write(redactText(b.Bytes(), hits))
+					}
+					if err != nil {
+						glog.Error(err)
+					}
+				} else if err := s.templates[t].ExecuteTemplate(w, "base.html", data); err != nil {
 					glog.Error(err)
 				}
 			}
+			if status == "ok" {
+				if t == errorTpl {
+					status = "badrequest"
+				} else if t == errorInternalTpl {
+					status = "error"
+				}
+			}
+			s.observeRequest(method, start, status)
 		}()
 		if s.debug {
 			// reload templates on each request
@@ -306,6 +542,9 @@ func (s *PublicServer) htmlTemplateHandler(handler func(w http.ResponseWriter, r
 					data = s.newTemplateDataWithError("Internal server error")
 				}
 			}
+		} else if data != nil && t != errorTpl {
+			hits = screenHits(s.screener, data)
+			data.Screening = screeningAnnotations(hits)
 		}
 	}
 }
@@ -344,9 +583,11 @@ type TemplateData struct {
 	PrevPage         int
 	NextPage         int
 	PagingRange      []int
+	NextCursor       string
 	TOSLink          string
 	SendTxHex        string
 	Status           string
+	Screening        []*ScreeningAnnotation
 }
 
 func parseTemplates() []*template.Template {
@@ -441,7 +682,7 @@ func (s *PublicServer) explorerAddress(w http.ResponseWriter, r *http.Request) (
 		if ec != nil {
 			page = 0
 		}
-		address, err = s.api.GetAddress(r.URL.Path[i+1:], page, txsOnPage, false)
+		address, err = s.api.GetAddress(r.URL.Path[i+1:], page, txsOnPage, false, nil, r.URL.Query().Get("cursor"))
 		if err != nil {
 			return errorTpl, nil, err
 		}
@@ -451,6 +692,7 @@ func (s *PublicServer) explorerAddress(w http.ResponseWriter, r *http.Request) (
 	data.Address = address
 	data.Page = address.Page
 	data.PagingRange, data.PrevPage, data.NextPage = getPagingRange(address.Page, address.TotalPages)
+	data.NextCursor = address.NextCursor
 	return addressTpl, data, nil
 }
 
@@ -509,27 +751,27 @@ func (s *PublicServer) explorerIndex(w http.ResponseWriter, r *http.Request) (tp
 
 func (s *PublicServer) explorerSearch(w http.ResponseWriter, r *http.Request) (tpl, *TemplateData, error) {
 	q := strings.TrimSpace(r.URL.Query().Get("q"))
-	var tx *api.Tx
-	var address *api.Address
-	var block *api.Block
-	var err error
 	s.metrics.ExplorerViews.With(common.Labels{"action": "search"}).Inc()
 	if len(q) > 0 {
-		block, err = s.api.GetBlock(q, 0, 1)
-		if err == nil {
-			http.Redirect(w, r, joinURL("/block/", block.Hash), 302)
-			return noTpl, nil, nil
+		res, err := s.api.Search(q)
+		if err != nil {
+			return errorTpl, nil, err
 		}
-		tx, err = s.api.GetTransaction(q, false)
-		if err == nil {
-			http.Redirect(w, r, joinURL("/tx/", tx.Txid), 302)
-			return noTpl, nil, nil
+		// the search does not lead to the redacted address, e.g. found by its name
+		for _, h := range screenHits(s.screener, res) {
+			if h.Redact {
+				return errorTpl, nil, api.NewApiError(fmt.Sprintf("No matching records found for '%v'", q), true)
+			}
 		}
-		address, err = s.api.GetAddress(q, 0, 1, true)
-		if err == nil {
-			http.Redirect(w, r, joinURL("/address/", address.AddrStr), 302)
-			return noTpl, nil, nil
+		switch res.Type {
+		case api.SearchTypeBlock:
+			http.Redirect(w, r, joinURL("/block/", res.Hash), 302)
+		case api.SearchTypeTx:
+			http.Redirect(w, r, joinURL("/tx/", res.Txid), 302)
+		case api.SearchTypeAddress:
+			http.Redirect(w, r, joinURL("/address/", res.Address), 302)
 		}
+		return noTpl, nil, nil
 	}
 	return errorTpl, nil, api.NewApiError(fmt.Sprintf("No matching records found for '%v'", q), true)
 }
@@ -610,6 +852,38 @@ func getPagingRange(page int, total int) ([]int, int, int) {
 	return r, pp, np
 }
 
+// getWorker returns api worker reading from the read snapshot specified by the query parameter snapshot
+// or the default worker if the parameter is not present, the snapshot is kept until the request finishes;
+// the amounts in the responses of the worker are formatted according to the query parameters amounts (coin or base) and locale
+func (s *PublicServer) getWorker(r *http.Request) (*api.Worker, error) {
+	w := s.api
+	q := r.URL.Query()
+	if id := q.Get("snapshot"); id != "" {
+		var err error
+		var done func()
+		if w, done, err = s.api.WithReadSnapshot(id); err != nil {
+			return nil, err
+		}
+		// the context of the request is canceled when the handler returns
+		go func() {
+			<-r.Context().Done()
+			done()
+		}()
+	}
+	if q.Get("amounts") != "" || q.Get("locale") != "" {
+		unit, err := api.ParseAmountUnit(q.Get("amounts"))
+		if err != nil {
+			return nil, err
+		}
+		f, err := api.NewAmountFormatter(s.chainParser, unit, q.Get("locale"))
+		if err != nil {
+			return nil, err
+		}
+		w = w.WithAmountFormatter(f)
+	}
+	return w, nil
+}
+
 func (s *PublicServer) apiIndex(r *http.Request) (interface{}, error) {
 	s.metrics.ExplorerViews.With(common.Labels{"action": "api-index"}).Inc()
 	return s.api.GetSystemInfo(false)
@@ -655,7 +929,11 @@ func (s *PublicServer) apiTx(r *http.Request) (interface{}, error) {
 				return nil, api.NewApiError("Parameter 'spending' cannot be converted to boolean", true)
 			}
 		}
-		tx, err = s.api.GetTransaction(txid, spendingTxs)
+		var w *api.Worker
+		if w, err = s.getWorker(r); err != nil {
+			return nil, err
+		}
+		tx, err = w.GetTransaction(txid, spendingTxs)
 	}
 	return tx, err
 }
@@ -680,11 +958,318 @@ func (s *PublicServer) apiAddress(r *http.Request) (interface{}, error) {
 		if ec != nil {
 			page = 0
 		}
-		address, err = s.api.GetAddress(r.URL.Path[i+1:], page, txsInAPI, true)
+		var filter *api.AddressFilter
+		if filter, err = parseAddressFilter(r); err != nil {
+			return nil, err
+		}
+		pageSize := txsInAPI
+		if v := r.URL.Query().Get("pageSize"); v != "" {
+			if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 || pageSize > txsInAPI {
+				return nil, api.NewApiError(fmt.Sprintf("Parameter 'pageSize' must be a number from 1 to %d", txsInAPI), true)
+			}
+		}
+		var w *api.Worker
+		if w, err = s.getWorker(r); err != nil {
+			return nil, err
+		}
+		cursor := r.URL.Query().Get("cursor")
+		// the history anchored by time starts at the newest transaction before the time and continues by the cursor
+		if v := r.URL.Query().Get("before"); v != "" && cursor == "" {
+			t, ec := strconv.ParseInt(v, 10, 64)
+			if ec != nil || t <= 0 {
+				return nil, api.NewApiError("Parameter 'before' is not a valid unix time", true)
+			}
+			if cursor, err = w.AddressCursorBeforeTime(t); err != nil {
+				return nil, err
+			}
+		}
+		address, err = w.GetAddress(r.URL.Path[i+1:], page, pageSize, true, filter, cursor)
 	}
 	return address, err
 }
 
+// addressStreamFlushItems is the number of transactions after which the streamed address history is flushed to the client
+const addressStreamFlushItems = 100
+
+// apiAddressStream writes the whole address history as a chunked json response as the transactions are read from the db,
+// the memory usage does not depend on the size of the history; parameters are details (txids or txs) and the address filter
+// an error after the start of the stream is reported in the error field of the object
+func (s *PublicServer) apiAddressStream(w http.ResponseWriter, r *http.Request) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-stream"}).Inc()
+	start := time.Now()
+	status := "ok"
+	defer func() {
+		if e := recover(); e != nil {
+			glog.Error("apiAddressStream recovered from panic: ", e)
+			status = "panic"
+		}
+		s.observeRequest("apiAddressStream", start, status)
+	}()
+	writeError := func(err error) {
+		status = s.writeStreamError(w, "apiAddressStream", err)
+	}
+	var address string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		address = r.URL.Path[i+1:]
+	}
+	if address == "" {
+		writeError(api.NewApiError("Missing address", true))
+		return
+	}
+	onlyTxids := true
+	switch r.URL.Query().Get("details") {
+	case "", "txids":
+	case "txs":
+		onlyTxids = false
+	default:
+		writeError(api.NewApiError("Parameter 'details' must be 'txids' or 'txs'", true))
+		return
+	}
+	filter, err := parseAddressFilter(r)
+	if err != nil {
+		writeError(err)
+		return
+	}
+	worker, err := s.getWorker(r)
+	if err != nil {
+		writeError(err)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	started := false
+	items := 0
+	err = worker.StreamAddressHistory(address, onlyTxids, filter, func(h *api.AddressHistoryHeader) error {
+		v, err := screenData(s.screener, h)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		started = true
+		// the header object is left open for the list of transactions
+		b = b[:len(b)-1]
+		if onlyTxids {
+			b = append(b, `,"transactions":[`...)
+		} else {
+			b = append(b, `,"txs":[`...)
+		}
+		_, err = w.Write(b)
+		return err
+	}, func(txid string, tx *api.Tx) error {
+		if s.requests.isClosing() {
+			return errShuttingDown
+		}
+		var b []byte
+		var err error
+		if onlyTxids {
+			b, err = json.Marshal(txid)
+		} else {
+			var v interface{}
+			if v, err = screenData(s.screener, tx); err == nil {
+				b, err = json.Marshal(v)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if items > 0 {
+			b = append([]byte{','}, b...)
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+		items++
+		if flusher != nil && items%addressStreamFlushItems == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if !started {
+		if err != nil {
+			writeError(err)
+		}
+		return
+	}
+	if err != nil {
+		glog.Error("apiAddressStream ", address, " error after ", items, " txs: ", err)
+		status = "error"
+		e, _ := json.Marshal("Internal server error")
+		w.Write(append(append([]byte(`],"error":`), e...), '}', '\n'))
+		return
+	}
+	w.Write([]byte("]}\n"))
+}
+
+// writeStreamError writes the error of a streaming handler, which was returned before anything was written, as json object
+// returns the status of the request for the metrics
+func (s *PublicServer) writeStreamError(w http.ResponseWriter, handler string, err error) string {
+	text, httpStatus, status := "Internal server error", http.StatusInternalServerError, "error"
+	if apiErr, ok := err.(*api.ApiError); ok && apiErr.Public {
+		text, httpStatus, status = apiErr.Error(), http.StatusBadRequest, "badrequest"
+	} else {
+		glog.Error(handler, " error: ", err)
+		if s.debug {
+			text = fmt.Sprintf("Internal server error: %v", err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(struct {
+		Text string `json:"error"`
+	}{text})
+	return status
+}
+
+// apiAddressExport writes the confirmed address history as CSV file for import to a tax tool selected by the parameter format
+// (koinly or cointracker), the address filter parameters are supported; an error after the start of the export aborts the response
+func (s *PublicServer) apiAddressExport(w http.ResponseWriter, r *http.Request) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-export"}).Inc()
+	start := time.Now()
+	status := "ok"
+	aborted := false
+	defer func() {
+		if e := recover(); e != nil {
+			glog.Error("apiAddressExport recovered from panic: ", e)
+			status = "panic"
+		}
+		s.observeRequest("apiAddressExport", start, status)
+		if aborted {
+			// the client sees an incomplete response instead of a truncated file
+			panic(http.ErrAbortHandler)
+		}
+	}()
+	var address string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		address = r.URL.Path[i+1:]
+	}
+	if address == "" {
+		status = s.writeStreamError(w, "apiAddressExport", api.NewApiError("Missing address", true))
+		return
+	}
+	format, err := api.ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		status = s.writeStreamError(w, "apiAddressExport", err)
+		return
+	}
+	filter, err := parseAddressFilter(r)
+	if err != nil {
+		status = s.writeStreamError(w, "apiAddressExport", err)
+		return
+	}
+	worker, err := s.getWorker(r)
+	if err != nil {
+		status = s.writeStreamError(w, "apiAddressExport", err)
+		return
+	}
+	// the rows contain only the amounts and the txids, the redacted address is left out of the name of the file
+	filename := address
+	if h := s.screenAddress(address); h != nil && h.Redact {
+		filename = RedactedAddress
+	}
+	started := false
+	err = worker.ExportAddressHistory(address, format, filter, &shutdownWriter{w, s.requests}, func() error {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.csv", filename, format))
+		started = true
+		return nil
+	})
+	if err != nil {
+		if !started {
+			status = s.writeStreamError(w, "apiAddressExport", err)
+			return
+		}
+		glog.Error("apiAddressExport ", address, " error: ", err)
+		status = "error"
+		aborted = true
+	}
+}
+
+// parseAddressFilter parses the query parameters direction (received or sent), minValue, maxValue and excludeDust
+// returns nil if no filter is specified
+func parseAddressFilter(r *http.Request) (*api.AddressFilter, error) {
+	q := r.URL.Query()
+	f := api.AddressFilter{
+		MinValue: q.Get("minValue"),
+		MaxValue: q.Get("maxValue"),
+	}
+	switch q.Get("direction") {
+	case "":
+	case "received":
+		f.Direction = api.AddressFilterDirectionReceived
+	case "sent":
+		f.Direction = api.AddressFilterDirectionSent
+	default:
+		return nil, api.NewApiError("Parameter 'direction' must be 'received' or 'sent'", true)
+	}
+	// the index holds only the native transfers of the coin, the token transfers cannot be filtered
+	switch q.Get("assets") {
+	case "", "native":
+	case "token":
+		return nil, api.NewApiError("Parameter 'assets=token' is not supported, the index does not contain token transfers", true)
+	default:
+		return nil, api.NewApiError("Parameter 'assets' must be 'native' or 'token'", true)
+	}
+	if d := q.Get("excludeDust"); len(d) > 0 {
+		var err error
+		f.ExcludeDust, err = strconv.ParseBool(d)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'excludeDust' cannot be converted to boolean", true)
+		}
+	}
+	if f == (api.AddressFilter{}) {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+func (s *PublicServer) apiAddressSummary(r *http.Request) (interface{}, error) {
+	var summary *api.AddressSummary
+	var err error
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-summary"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		var w *api.Worker
+		if w, err = s.getWorker(r); err != nil {
+			return nil, err
+		}
+		summary, err = w.GetAddressSummary(r.URL.Path[i+1:])
+	}
+	return summary, err
+}
+
+// apiAddressGroup returns the summed balances and the merged history of a group of addresses, the addresses are separated
+// by commas in the url path or by commas or white space in the body of POST request
+func (s *PublicServer) apiAddressGroup(r *http.Request) (interface{}, error) {
+	var list string
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-addresses"}).Inc()
+	if r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxAddressGroupBody))
+		if err != nil {
+			return nil, api.NewApiError("Missing addresses", true)
+		}
+		list = string(data)
+	} else if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		list = r.URL.Path[i+1:]
+	}
+	addresses := strings.FieldsFunc(list, func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})
+	page, ec := strconv.Atoi(r.URL.Query().Get("page"))
+	if ec != nil {
+		page = 0
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetAddressGroup(addresses, page, txsInAPI, true)
+}
+
+// maxAddressGroupBody is the limit of the size of the body of address group request
+const maxAddressGroupBody = 64 * 1024
+
 func (s *PublicServer) apiBlock(r *http.Request) (interface{}, error) {
 	var block *api.Block
 	var err error
@@ -694,11 +1279,30 @@ func (s *PublicServer) apiBlock(r *http.Request) (interface{}, error) {
 		if ec != nil {
 			page = 0
 		}
-		block, err = s.api.GetBlock(r.URL.Path[i+1:], page, txsInAPI)
+		var w *api.Worker
+		if w, err = s.getWorker(r); err != nil {
+			return nil, err
+		}
+		block, err = w.GetBlock(r.URL.Path[i+1:], page, txsInAPI)
 	}
 	return block, err
 }
 
+// apiBlockAddresses returns the addresses touched by the block given by height or hash in the url path
+func (s *PublicServer) apiBlockAddresses(r *http.Request) (interface{}, error) {
+	var ba *api.BlockAddresses
+	var err error
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-block-addresses"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		var w *api.Worker
+		if w, err = s.getWorker(r); err != nil {
+			return nil, err
+		}
+		ba, err = w.GetBlockAffectedAddresses(r.URL.Path[i+1:])
+	}
+	return ba, err
+}
+
 type resultSendTransaction struct {
 	Result string `json:"result"`
 }
@@ -729,6 +1333,136 @@ func (s *PublicServer) apiSendTx(r *http.Request) (interface{}, error) {
 	return nil, api.NewApiError("Missing tx blob", true)
 }
 
+// apiDecodeAndTest decodes the raw transaction (in the url path or in the body of POST request), reports the state of its inputs
+// in the index and tests its acceptance to the mempool of the backend, the transaction is not sent
+func (s *PublicServer) apiDecodeAndTest(r *http.Request) (interface{}, error) {
+	var hex string
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-decode-and-test"}).Inc()
+	if r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, api.NewApiError("Missing tx blob", true)
+		}
+		hex = strings.TrimSpace(string(data))
+	} else {
+		if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+			hex = r.URL.Path[i+1:]
+		}
+	}
+	if len(hex) == 0 {
+		return nil, api.NewApiError("Missing tx blob", true)
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.DecodeAndTest(hex)
+}
+
+// apiSimulateTx decodes the raw transaction (in the url path or in the body of POST request) and returns its effect
+// on the balances of the involved addresses and the consumed utxos, the transaction is not sent
+func (s *PublicServer) apiSimulateTx(r *http.Request) (interface{}, error) {
+	var hex string
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-simulate-tx"}).Inc()
+	if r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, api.NewApiError("Missing tx blob", true)
+		}
+		hex = strings.TrimSpace(string(data))
+	} else {
+		if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+			hex = r.URL.Path[i+1:]
+		}
+	}
+	if len(hex) == 0 {
+		return nil, api.NewApiError("Missing tx blob", true)
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.SimulateTx(hex)
+}
+
+// apiName returns the current value and owner of the name (e.g. Namecoin d/example) and its history,
+// the name is the rest of the path after api/name/ and can contain slashes
+func (s *PublicServer) apiName(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-name"}).Inc()
+	var name string
+	if i := strings.Index(r.URL.Path, "api/name/"); i >= 0 {
+		name = r.URL.Path[i+len("api/name/"):]
+	}
+	if name == "" {
+		return nil, api.NewApiError("Missing name, expecting api/name/<name>", true)
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetName(name)
+}
+
+// apiInscription returns the ordinals inscription with the id <genesis txid>i<index> and its current location
+func (s *PublicServer) apiInscription(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-inscription"}).Inc()
+	var id string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		id = r.URL.Path[i+1:]
+	}
+	if id == "" {
+		return nil, api.NewApiError("Missing inscription id, expecting api/inscription/<txid>i<index>", true)
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetInscription(id)
+}
+
+// apiAddressInscriptions returns the ordinals inscriptions held by the unspent outputs of the address
+func (s *PublicServer) apiAddressInscriptions(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-inscriptions"}).Inc()
+	var address string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		address = r.URL.Path[i+1:]
+	}
+	if address == "" {
+		return nil, api.NewApiError("Missing address, expecting api/inscriptions/<address>", true)
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetAddressInscriptions(address)
+}
+
+// apiPaymentID returns the transactions with the outputs carrying the hex encoded payment id, parameters cursor (the cursor
+// of the page returned as nextCursor) and limit (the maximum number of transactions)
+func (s *PublicServer) apiPaymentID(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-payment-id"}).Inc()
+	var paymentID string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		paymentID = r.URL.Path[i+1:]
+	}
+	if paymentID == "" {
+		return nil, api.NewApiError("Missing payment id, expecting api/payment-id/<hex payment id>", true)
+	}
+	q := r.URL.Query()
+	var limit int
+	if p := q.Get("limit"); p != "" {
+		var err error
+		if limit, err = strconv.Atoi(p); err != nil {
+			return nil, api.NewApiError("Parameter 'limit' is not a number", true)
+		}
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetPaymentIDTxs(paymentID, q.Get("cursor"), limit)
+}
+
 type resultEstimateFeeAsString struct {
 	Result string `json:"result"`
 }
@@ -765,3 +1499,382 @@ func (s *PublicServer) apiEstimateFee(r *http.Request) (interface{}, error) {
 	}
 	return nil, api.NewApiError("Missing parameter 'number of blocks'", true)
 }
+
+// default number of blocks returned by apiFeeHistory if parameter from is not specified
+const feeHistoryBlocks = 144
+
+func (s *PublicServer) apiFeeHistory(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-feehistory"}).Inc()
+	q := r.URL.Query()
+	to, err := s.db.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if p := q.Get("to"); p != "" {
+		h, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'to' is not a valid height", true)
+		}
+		to = uint32(h)
+	}
+	var from uint32
+	if to > feeHistoryBlocks {
+		from = to - feeHistoryBlocks + 1
+	}
+	if p := q.Get("from"); p != "" {
+		h, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'from' is not a valid height", true)
+		}
+		from = uint32(h)
+	}
+	resolution := 1
+	if p := q.Get("resolution"); p != "" {
+		var err error
+		resolution, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'resolution' is not a number", true)
+		}
+	}
+	return s.api.GetFeeHistory(from, to, resolution)
+}
+
+// apiBlockStats returns the statistics of the blocks in range given by the parameters from and to (block heights),
+// by default of the last feeHistoryBlocks blocks
+func (s *PublicServer) apiBlockStats(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-blockstats"}).Inc()
+	q := r.URL.Query()
+	to, err := s.db.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if p := q.Get("to"); p != "" {
+		h, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'to' is not a valid height", true)
+		}
+		to = uint32(h)
+	}
+	var from uint32
+	if to > feeHistoryBlocks {
+		from = to - feeHistoryBlocks + 1
+	}
+	if p := q.Get("from"); p != "" {
+		h, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'from' is not a valid height", true)
+		}
+		from = uint32(h)
+	}
+	return s.api.GetBlockStats(from, to)
+}
+
+func (s *PublicServer) apiValidatePayment(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-validate-payment"}).Inc()
+	return s.api.ValidatePaymentRequest(r.URL.Query().Get("uri"))
+}
+
+// apiSnapshot creates read snapshot with ttl in seconds given by query parameter ttl, each client can pin
+// at most db.MaxReadSnapshotsPerOwner snapshots; DELETE request with snapshot id in path releases the snapshot
+func (s *PublicServer) apiSnapshot(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-snapshot"}).Inc()
+	if r.Method == http.MethodDelete {
+		var id string
+		if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+			id = r.URL.Path[i+1:]
+		}
+		if id == "" {
+			return nil, api.NewApiError("Missing snapshot id", true)
+		}
+		if err := s.api.ReleaseReadSnapshot(id); err != nil {
+			return nil, err
+		}
+		return struct {
+			Result string `json:"result"`
+		}{"released"}, nil
+	}
+	var ttl time.Duration
+	if t := r.URL.Query().Get("ttl"); t != "" {
+		sec, err := strconv.Atoi(t)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'ttl' is not a number", true)
+		}
+		ttl = time.Duration(sec) * time.Second
+	}
+	return s.api.CreateReadSnapshot(ttl, s.clientID(r))
+}
+
+// clientID identifies the client of the request in the same way as the quotas, by default by the remote address
+func (s *PublicServer) clientID(r *http.Request) string {
+	if s.quotas != nil {
+		_, id := s.quotas.Config().client(r.Header, r.RemoteAddr)
+		return id
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func (s *PublicServer) apiScriptTemplate(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-script-template"}).Inc()
+	var script string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		script = r.URL.Path[i+1:]
+	}
+	if script == "" {
+		return nil, api.NewApiError("Missing script template", true)
+	}
+	q := r.URL.Query()
+	to, err := s.db.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	if p := q.Get("to"); p != "" {
+		h, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'to' is not a valid height", true)
+		}
+		to = uint32(h)
+	}
+	var from uint32
+	if p := q.Get("from"); p != "" {
+		h, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'from' is not a valid height", true)
+		}
+		from = uint32(h)
+	}
+	return s.api.GetScriptTemplateOutputs(script, from, to)
+}
+
+func (s *PublicServer) apiSearch(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-search"}).Inc()
+	q := r.URL.Query().Get("q")
+	if i := strings.LastIndexByte(r.URL.Path, '/'); q == "" && i > 0 {
+		q = r.URL.Path[i+1:]
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.Search(q)
+}
+
+// apiFlows returns the paths of transfers between two addresses, the url is api/flows/<from address>/<to address>?maxHops=n
+func (s *PublicServer) apiFlows(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-flows"}).Inc()
+	var from, to string
+	if i := strings.Index(r.URL.Path, "api/flows/"); i >= 0 {
+		p := strings.Split(r.URL.Path[i+len("api/flows/"):], "/")
+		if len(p) == 2 {
+			from, to = p[0], p[1]
+		}
+	}
+	if from == "" || to == "" {
+		return nil, api.NewApiError("Missing addresses, expecting api/flows/<from>/<to>", true)
+	}
+	maxHops := 2
+	if p := r.URL.Query().Get("maxHops"); p != "" {
+		var err error
+		if maxHops, err = strconv.Atoi(p); err != nil {
+			return nil, api.NewApiError("Parameter 'maxHops' is not a number", true)
+		}
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetFlows(from, to, maxHops)
+}
+
+func (s *PublicServer) apiMempoolEviction(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-mempool-eviction"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		if txid := r.URL.Path[i+1:]; txid != "" {
+			w, err := s.getWorker(r)
+			if err != nil {
+				return nil, err
+			}
+			return w.GetMempoolEviction(txid)
+		}
+	}
+	return nil, api.NewApiError("Missing txid", true)
+}
+
+func (s *PublicServer) apiTxProof(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-tx-proof"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		if txid := r.URL.Path[i+1:]; txid != "" {
+			w, err := s.getWorker(r)
+			if err != nil {
+				return nil, err
+			}
+			return w.GetTxProofBundle(txid)
+		}
+	}
+	return nil, api.NewApiError("Missing txid", true)
+}
+
+// apiVerifyMessage verifies the signature of message, the parameters signature and message are passed
+// in the query or, because of their length, in the urlencoded form of POST request
+func (s *PublicServer) apiVerifyMessage(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-verify-message"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		if address := r.URL.Path[i+1:]; address != "" {
+			signature := r.FormValue("signature")
+			if signature == "" {
+				return nil, api.NewApiError("Missing signature", true)
+			}
+			w, err := s.getWorker(r)
+			if err != nil {
+				return nil, err
+			}
+			return w.VerifyMessage(address, signature, r.FormValue("message"))
+		}
+	}
+	return nil, api.NewApiError("Missing address", true)
+}
+
+// apiUtxo returns the unspent outputs of the address, the query parameter wallet adds the coin control data of the wallet
+// and excludefrozen=true omits the outputs frozen in the wallet
+func (s *PublicServer) apiUtxo(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-utxo"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		if address := r.URL.Path[i+1:]; address != "" {
+			q := r.URL.Query()
+			excludeFrozen := q.Get("excludefrozen") == "true"
+			wallet := q.Get("wallet")
+			if excludeFrozen && wallet == "" {
+				return nil, api.NewApiError("Parameter 'excludefrozen' requires parameter 'wallet'", true)
+			}
+			w, err := s.getWorker(r)
+			if err != nil {
+				return nil, err
+			}
+			return w.GetAddressUtxo(address, wallet, excludeFrozen)
+		}
+	}
+	return nil, api.NewApiError("Missing address", true)
+}
+
+// apiCoinControl returns the coin control data of the wallet given in path,
+// the data are set by the admin/coin-control endpoint of the internal server
+func (s *PublicServer) apiCoinControl(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-coin-control"}).Inc()
+	if r.Method != http.MethodGet {
+		return nil, api.NewApiError("Coin control data cannot be set by the public API", true)
+	}
+	var wallet string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		wallet = r.URL.Path[i+1:]
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetCoinControl(wallet)
+}
+
+func (s *PublicServer) apiReorgs(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-reorgs"}).Inc()
+	limit := 100
+	if p := r.URL.Query().Get("limit"); p != "" {
+		l, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'limit' is not a number", true)
+		}
+		limit = l
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetReorgHistory(limit)
+}
+
+func (s *PublicServer) apiEmission(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-emission"}).Inc()
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetEmissionSchedule()
+}
+
+// apiCoinSupply returns the audit of the coin supply at the height given in path, the best block if the height is missing
+func (s *PublicServer) apiCoinSupply(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-coin-supply"}).Inc()
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	var height uint32
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 && r.URL.Path[i+1:] != "" {
+		h, err := strconv.ParseUint(r.URL.Path[i+1:], 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Height is not a valid number", true)
+		}
+		height = uint32(h)
+	} else if height, err = s.db.GetBestHeight(); err != nil {
+		return nil, err
+	}
+	return w.GetCoinSupply(height)
+}
+
+// apiBurns returns the burned outputs to the address given in path, the chain-wide burned supply if the address is missing
+func (s *PublicServer) apiBurns(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-burns"}).Inc()
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		if address := r.URL.Path[i+1:]; address != "" {
+			return w.GetAddressBurns(address)
+		}
+	}
+	return w.GetBurns()
+}
+
+// largestTxsWindow and largestTxsCount are the default parameters of apiLargestTxs
+const (
+	largestTxsWindow = 144
+	largestTxsCount  = 10
+)
+
+// apiLargestTxs returns the transactions with the highest total value of the outputs in the last blocks,
+// the number of the blocks is given by the parameter window, the number of the transactions by the parameter n
+func (s *PublicServer) apiLargestTxs(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-largest-txs"}).Inc()
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	q := r.URL.Query()
+	window := uint32(largestTxsWindow)
+	if p := q.Get("window"); p != "" {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, api.NewApiError("Parameter 'window' is not a number", true)
+		}
+		window = uint32(v)
+	}
+	n := largestTxsCount
+	if p := q.Get("n"); p != "" {
+		if n, err = strconv.Atoi(p); err != nil {
+			return nil, api.NewApiError("Parameter 'n' is not a number", true)
+		}
+	}
+	return w.GetLargestTxs(window, n)
+}
+
+func (s *PublicServer) apiNonce(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-nonce"}).Inc()
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		if address := r.URL.Path[i+1:]; address != "" {
+			return s.api.GetNextNonce(address)
+		}
+	}
+	return nil, api.NewApiError("Missing address", true)
+}
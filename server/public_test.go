@@ -8,7 +8,10 @@ import (
 	"blockbook/common"
 	"blockbook/db"
 	"blockbook/tests/dbtestdata"
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -47,6 +50,11 @@ func setupRocksDB(t *testing.T, parser bchain.BlockChainParser) (*db.RocksDB, *c
 		t.Fatal(err)
 	}
 	d.SetInternalState(is)
+	// index the P2PKH outputs
+	d.SetScriptTemplates([][]byte{{0x76, 0xa9, 0x14, 0x88, 0xac}})
+	// record the fee stats and the supply changes of the blocks
+	d.SetFeeStats(true)
+	d.SetBlockSupply(true)
 	// import data
 	if err := d.ConnectBlock(dbtestdata.GetTestUTXOBlock1(parser)); err != nil {
 		t.Fatal(err)
@@ -372,6 +380,24 @@ func httpTests(t *testing.T, ts *httptest.Server) {
 				`{"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6"}`,
 			},
 		},
+		{
+			name:        "apiBlockAddresses",
+			r:           newGetRequest(ts.URL + "/api/block-addresses/225493"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"height":225493,"hash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","addresses":["mfcWp7DB6NuaZsExybTTXpVgWz559Np4Ti","mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz","mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","2Mz1CYoppGGsLNUGF2YDhTif6J661JitALS","2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"]}`,
+			},
+		},
+		{
+			name:        "apiBlockAddresses - not indexed",
+			r:           newGetRequest(ts.URL + "/api/block-addresses/1000000"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Block not found in the index"}`,
+			},
+		},
 		{
 			name:        "apiTx",
 			r:           newGetRequest(ts.URL + "/api/tx/05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07"),
@@ -408,6 +434,335 @@ func httpTests(t *testing.T, ts *httptest.Server) {
 				`{"page":1,"totalPages":1,"itemsOnPage":1000,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":2,"transactions":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
 			},
 		},
+		{
+			name:        "apiAddressGroup",
+			r:           newGetRequest(ts.URL + "/api/addresses/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw,mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz,mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz"],"balance":"0","totalReceived":"12345.67902468","totalSent":"12345.67902468","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":3,"transactions":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
+			},
+		},
+		{
+			name:        "apiAddressGroup internal transfer",
+			r:           newGetRequest(ts.URL + "/api/addresses/2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1,2Mz1CYoppGGsLNUGF2YDhTif6J661JitALS?page=5"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1","2Mz1CYoppGGsLNUGF2YDhTif6J661JitALS"],"balance":"0.00009","totalReceived":"0.00009877","totalSent":"0.00000877","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":3,"transactions":["3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
+			},
+		},
+		{
+			name:        "apiAddressGroup missing addresses",
+			r:           newGetRequest(ts.URL + "/api/addresses/"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Missing addresses"}`,
+			},
+		},
+		{
+			name:        "apiAddressStream",
+			r:           newGetRequest(ts.URL + "/api/address-stream/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":2,"transactions":["effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25"]}`,
+			},
+		},
+		{
+			name:        "apiAddressStream details",
+			r:           newGetRequest(ts.URL + "/api/address-stream/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?details=txs&direction=sent"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"txApperances":2,"txs":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25"`,
+				`]}`,
+			},
+		},
+		{
+			name:        "apiAddressStream invalid details",
+			r:           newGetRequest(ts.URL + "/api/address-stream/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?details=all"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'details' must be 'txids' or 'txs'"}`,
+			},
+		},
+		{
+			name:        "apiAddressExport koinly",
+			r:           newGetRequest(ts.URL + "/api/address-export/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?format=koinly"),
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: []string{
+				"Date,Sent Amount,Sent Currency,Received Amount,Received Currency,Fee Amount,Fee Currency,Net Worth Amount,Net Worth Currency,Label,Description,TxHash\n" +
+					"2018-08-21 13:27:01 UTC,,,12345.67890123,FAKE,,,,,,,effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75\n" +
+					"2018-08-21 13:45:23 UTC,12345.67889778,FAKE,,,0.00000345,FAKE,,,,,7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25\n",
+			},
+		},
+		{
+			name:        "apiAddressExport cointracker",
+			r:           newGetRequest(ts.URL + "/api/address-export/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?format=cointracker&direction=sent"),
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: []string{
+				"Date,Received Quantity,Received Currency,Sent Quantity,Sent Currency,Fee Amount,Fee Currency,Tag\n" +
+					"08/21/2018 13:45:23,,,12345.67889778,FAKE,0.00000345,FAKE,\n",
+			},
+		},
+		{
+			name:        "apiAddressExport invalid format",
+			r:           newGetRequest(ts.URL + "/api/address-export/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?format=turbotax"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Unknown export format 'turbotax', expecting 'koinly' or 'cointracker'"}`,
+			},
+		},
+		{
+			name:        "apiAddressFeed",
+			r:           newGetRequest(ts.URL + "/api/address-feed/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"),
+			status:      http.StatusOK,
+			contentType: "application/atom+xml; charset=utf-8",
+			body: []string{
+				`<?xml version="1.0" encoding="UTF-8"?>`,
+				`<feed xmlns="http://www.w3.org/2005/Atom"><id>http://`,
+				`/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw</id><title>Fakecoin address mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw</title><updated>2018-08-21T13:45:23Z</updated><author><name>Blockbook</name></author>`,
+				`/api/address-feed/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"></link>`,
+				`/tx/7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25</id><title>Sent 12345.67890123 FAKE</title><updated>2018-08-21T13:45:23Z</updated>`,
+				`<summary>Transaction 7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25 in block 225494, received 0 FAKE, sent 12345.67890123 FAKE</summary></entry>`,
+				`/tx/effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75</id><title>Received 12345.67890123 FAKE</title><updated>2018-08-21T13:27:01Z</updated>`,
+			},
+		},
+		{
+			name:        "apiAddressFeed invalid count",
+			r:           newGetRequest(ts.URL + "/api/address-feed/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?count=x"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'count' is not a number"}`,
+			},
+		},
+		{
+			name:        "apiAddress base units",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?amounts=base&locale=en"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1,234,567,890,123","totalSent":"1,234,567,890,123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":2,"transactions":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
+			},
+		},
+		{
+			name:        "apiAddress localized",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?locale=de"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"totalReceived":"12.345,67890123","totalSent":"12.345,67890123"`,
+			},
+		},
+		{
+			name:        "apiAddress invalid amount unit",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?amounts=bits"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Unknown amount unit 'bits', expecting 'coin' or 'base'"}`,
+			},
+		},
+		{
+			name:        "apiAddress received filter",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?direction=received&minValue=1"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":1,"transactions":["effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
+			},
+		},
+		{
+			name:        "apiAddress sent filter",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?direction=sent&maxValue=1"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":0}`,
+			},
+		},
+		{
+			name:        "apiAddress native assets filter",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?direction=sent&maxValue=1&assets=native"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":0}`,
+			},
+		},
+		{
+			name:        "apiAddress token assets filter",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?assets=token"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'assets=token' is not supported, the index does not contain token transfers"}`,
+			},
+		},
+		{
+			name:        "apiAddress invalid assets filter",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?assets=nft"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'assets' must be 'native' or 'token'"}`,
+			},
+		},
+		{
+			name:        "apiAddress cursor",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?cursor=225494:0"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":0,"totalPages":0,"itemsOnPage":1000,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":2,"transactions":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"],"summaryOnly":true}`,
+			},
+		},
+		{
+			name:        "apiAddress cursor older block",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?cursor=225493:0"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":0,"totalPages":0,"itemsOnPage":1000,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":2,"transactions":["effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"],"summaryOnly":true}`,
+			},
+		},
+		{
+			name:        "apiAddress before time",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?before=1534859123&pageSize=1"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"page":0,"totalPages":0,"itemsOnPage":1,"addrStr":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","unconfirmedBalance":"0","unconfirmedTxApperances":0,"txApperances":2,"transactions":["effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"],"summaryOnly":true}`,
+			},
+		},
+		{
+			name:        "apiAddress invalid pageSize",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?pageSize=0"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'pageSize' must be a number from 1 to 1000"}`,
+			},
+		},
+		{
+			name:        "apiAddress invalid cursor",
+			r:           newGetRequest(ts.URL + "/api/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?cursor=x"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid cursor 'x', expecting \u003cheight\u003e:\u003cskip\u003e"}`,
+			},
+		},
+		{
+			name:        "apiAddressSummary",
+			r:           newGetRequest(ts.URL + "/api/address-summary/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12345.67890123","totalSent":"12345.67890123","txs":2,"averageTxValue":"12345.67890123","firstActivity":{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","height":225493,"time":1534858021},"lastActivity":{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","height":225494,"time":1534859123},"counterparties":[`,
+				`"scannedTxs":2`,
+			},
+		},
+		{
+			name:        "apiAddressSummary base units",
+			r:           newGetRequest(ts.URL + "/api/address-summary/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?amounts=base"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","txs":2,"averageTxValue":"1234567890123",`,
+			},
+		},
+		{
+			name:        "apiAddressSummary localized",
+			r:           newGetRequest(ts.URL + "/api/address-summary/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?locale=de"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"12.345,67890123","totalSent":"12.345,67890123","txs":2,"averageTxValue":"12.345,67890123",`,
+			},
+		},
+		{
+			name:        "apiAddressSummary invalid address",
+			r:           newGetRequest(ts.URL + "/api/address-summary/xyz"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid address`,
+			},
+		},
+		{
+			name:        "apiAddressSummary unknown address",
+			r:           newGetRequest(ts.URL + "/api/address-summary/mfcHP2WMCVLsVZA8yrovmhMgxNFW9r98xw"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Address not found"}`,
+			},
+		},
+		{
+			name:        "apiFeeHistory",
+			r:           newGetRequest(ts.URL + "/api/feehistory/?from=225493&to=225494"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"from":225493,"to":225494,"resolution":1,"feeRatePercentiles":[10,25,50,75,90]`,
+				`"mempool":[{"time":1534858100,"txs":10,"estimates":[{"blocks":2,"feePerKB":"0.00002"},{"blocks":6,"feePerKB":"0.00001"}]},{"time":1534858400,"txs":20,"estimates":[{"blocks":2,"feePerKB":"0.00004"},{"blocks":6,"feePerKB":"0.00001"}]},{"time":1534858700,"txs":31,"estimates":[{"blocks":2,"feePerKB":"0.00003"}]}]`,
+			},
+		},
+		{
+			name:        "apiFeeHistory resolution",
+			r:           newGetRequest(ts.URL + "/api/feehistory/?from=225493&to=225494&resolution=2"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"mempool":[{"time":1534858100,"txs":15,"estimates":[{"blocks":2,"feePerKB":"0.00003"},{"blocks":6,"feePerKB":"0.00001"}]},{"time":1534858700,"txs":31,"estimates":[{"blocks":2,"feePerKB":"0.00003"}]}]`,
+			},
+		},
+		{
+			name:        "apiFeeHistory invalid range",
+			r:           newGetRequest(ts.URL + "/api/feehistory/?from=225494&to=225493"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'to' must not be lower than parameter 'from'"}`,
+			},
+		},
+		{
+			name:        "apiScriptTemplate skeleton",
+			r:           newGetRequest(ts.URL + "/api/script-template/76a91488ac"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"skeleton":"76a91488ac","from":0,"to":225494`,
+				`{"txid":"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","vout":0,"height":225493}`,
+			},
+		},
+		{
+			name:        "apiScriptTemplate script",
+			r:           newGetRequest(ts.URL + "/api/script-template/76a914010d39800f86122416e28f485029acf77507169288ac?to=225493"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"skeleton":"76a91488ac","from":0,"to":225493`,
+				`{"txid":"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","vout":0,"height":225493}`,
+			},
+		},
+		{
+			name:        "apiScriptTemplate not indexed",
+			r:           newGetRequest(ts.URL + "/api/script-template/a914e921fc4912a315078f370d959f2c4f7b6d2a683c87"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Script template a91487 is not indexed"}`,
+			},
+		},
 		{
 			name:        "apiSendTx",
 			r:           newGetRequest(ts.URL + "/api/sendtx/1234567890"),
@@ -435,6 +790,288 @@ func httpTests(t *testing.T, ts *httptest.Server) {
 				`{"error":"Missing tx blob"}`,
 			},
 		},
+		{
+			name:        "apiDecodeAndTest",
+			r:           newPostRequest(ts.URL+"/api/decode-and-test/", "010000000375acb49486d6bb2240fdbef2a421f5fb8e4c43bff58a1c6b533d3809f59efdef0000000000ffffffff259d2eed514f6c15fb341a64578708568f797647b681eda1aa68f26340e23b7c0100000000ffffffffaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa0000000000ffffffff01e8030000000000001976a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac00000000"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"00d322ccf5468713bc69cd85fe3a82915df5c2836b99f8ea027ef7bb33a697aa","tested":false,"allowed":false,"vin":[{"n":0,"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vout":0,"status":"spent","addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"value":"12345.67890123"},{"n":1,"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vout":1,"status":"unspent","addresses":["mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"],"value":"9172.83951061"},{"n":2,"txid":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","vout":0,"status":"unknown"}]}`,
+			},
+		},
+		{
+			name:        "apiDecodeAndTest invalid hex",
+			r:           newGetRequest(ts.URL + "/api/decode-and-test/12345x"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Invalid hex string"}`,
+			},
+		},
+		{
+			name:        "apiSimulateTx",
+			r:           newPostRequest(ts.URL+"/api/simulate-tx/", "010000000375acb49486d6bb2240fdbef2a421f5fb8e4c43bff58a1c6b533d3809f59efdef0000000000ffffffff259d2eed514f6c15fb341a64578708568f797647b681eda1aa68f26340e23b7c0100000000ffffffffaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa0000000000ffffffff01e8030000000000001976a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac00000000"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"00d322ccf5468713bc69cd85fe3a82915df5c2836b99f8ea027ef7bb33a697aa","valueOut":"0.00001","addresses":[{"address":"mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL","balance":"9172.83951061","balanceChange":"-9172.83951061","newBalance":"0","consumedUtxos":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vout":1,"value":"9172.83951061"}]},{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","balanceChange":"0.00001","newBalance":"0.00001"}],"spentInputs":[0],"unknownInputs":[2]}`,
+			},
+		},
+		{
+			name:        "apiSimulateTx duplicate input",
+			r:           newPostRequest(ts.URL+"/api/simulate-tx/", "0100000002259d2eed514f6c15fb341a64578708568f797647b681eda1aa68f26340e23b7c0100000000ffffffff259d2eed514f6c15fb341a64578708568f797647b681eda1aa68f26340e23b7c0100000000ffffffff01e8030000000000001976a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac00000000"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"txid":"82e255fdbb16ff9dd053c43f00a3c2d80229e092532fb7c04910f97a6a22f3e0","valueOut":"0.00001","addresses":[{"address":"mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL","balance":"9172.83951061","balanceChange":"-9172.83951061","newBalance":"0","consumedUtxos":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vout":1,"value":"9172.83951061"}]},{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","balanceChange":"0.00001","newBalance":"0.00001"}],"duplicateInputs":[1]}`,
+			},
+		},
+		{
+			name:        "apiName not supported",
+			r:           newGetRequest(ts.URL + "/api/name/d/example"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Names are not supported by the coin"}`,
+			},
+		},
+		{
+			name:        "apiEmission",
+			r:           newGetRequest(ts.URL + "/api/emission"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"bestHeight":225494,"currentSubsidy":"25","nextHalving":420000,"supply":"10887375","maxSupply":"20999999.9769","eras":[{"fromHeight":0,"toHeight":209999,"subsidy":"50","supply":"10500000"},{"fromHeight":210000,"toHeight":419999,"subsidy":"25","supply":"15750000"},`,
+				`{"fromHeight":6720000,"toHeight":6929999,"subsidy":"0.00000001","supply":"20999999.9769"}]}`,
+			},
+		},
+		{
+			name:        "apiCoinSupply",
+			r:           newGetRequest(ts.URL + "/api/coin-supply/"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"fromHeight":225493,"height":225494,"expected":"50","created":"12360.27941392","burned":"0","indexed":"12360.27941392","difference":"12310.27941392","divergent":true}`,
+			},
+		},
+		{
+			name:        "apiCoinSupply height",
+			r:           newGetRequest(ts.URL + "/api/coin-supply/225493"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"fromHeight":225493,"height":225493,"expected":"25","created":"12346.67912345","burned":"0","indexed":"12346.67912345","difference":"12321.67912345","divergent":true}`,
+			},
+		},
+		{
+			name:        "apiCoinSupply above best block",
+			r:           newGetRequest(ts.URL + "/api/coin-supply/225495"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Height 225495 is above the best block 225494"}`,
+			},
+		},
+		{
+			name:        "apiMempoolEviction not removed",
+			r:           newGetRequest(ts.URL + "/api/mempool-eviction/7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Transaction 7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25 was not removed from the mempool"}`,
+			},
+		},
+		{
+			name:        "apiTxProof",
+			r:           newGetRequest(ts.URL + "/api/tx-proof/3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71"`,
+				`"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,`,
+				`"merkleRoot":"8cb556735dbbc2762d00d5b62ac125fc8238b7eeaba2946db99ebab1583d3483","pos":1,"merkle":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","3de86352519662348d9c97e1814c8fe3fcda270fe7abdfa15f27d7d4f09ae8d7"]}`,
+			},
+		},
+		{
+			name:        "apiTxProof not found",
+			r:           newGetRequest(ts.URL + "/api/tx-proof/1111111111111111111111111111111111111111111111111111111111111111"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Tx not found, Not found"}`,
+			},
+		},
+		{
+			name:        "apiVerifyMessage",
+			r:           newPostFormRequest(ts.URL+"/api/verify-message/tb1q0ugmcpjt2zfre6ger5wr0lj4me4una572deqaj", "signature", "Jyt1Plc3al/lim2ojeaGgpDFBliHxj+nBb2UYxItixgWYkdfGw/CmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE=", "message", "This is an example of a signed message."),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"tb1q0ugmcpjt2zfre6ger5wr0lj4me4una572deqaj","valid":true}`,
+			},
+		},
+		{
+			name:        "apiVerifyMessage other address",
+			r:           newGetRequest(ts.URL + "/api/verify-message/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?signature=Hyt1Plc3al%2Flim2ojeaGgpDFBliHxj%2BnBb2UYxItixgWYkdfGw%2FCmQZecQwdqG6gSzwQMC0nUtZD8GD69VGxVDE%3D&message=This+is+an+example+of+a+signed+message."),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","valid":false}`,
+			},
+		},
+		{
+			name:        "apiVerifyMessage missing signature",
+			r:           newGetRequest(ts.URL + "/api/verify-message/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?message=abc"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Missing signature"}`,
+			},
+		},
+		{
+			name:        "apiReorgs",
+			r:           newGetRequest(ts.URL + "/api/reorgs"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[]`,
+			},
+		},
+		{
+			name:        "apiReorgs invalid limit",
+			r:           newGetRequest(ts.URL + "/api/reorgs?limit=0"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Limit must be between 1 and 1000"}`,
+			},
+		},
+		{
+			name:        "apiUtxo",
+			r:           newGetRequest(ts.URL + "/api/utxo/mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"1186.419755","height":225494,"confirmations":1}]`,
+			},
+		},
+		{
+			name:        "apiCoinControl set",
+			r:           newPostFormRequest(ts.URL+"/api/coin-control/w1", "txid", "3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71", "vout", "0", "label", "other", "frozen", "false"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Coin control data cannot be set by the public API"}`,
+			},
+		},
+		{
+			name:        "apiCoinControl",
+			r:           newGetRequest(ts.URL + "/api/coin-control/w1"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"label":"savings","frozen":true}]`,
+			},
+		},
+		{
+			name:        "apiUtxo wallet",
+			r:           newGetRequest(ts.URL + "/api/utxo/mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC?wallet=w1"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"1186.419755","height":225494,"confirmations":1,"label":"savings","frozen":true}]`,
+			},
+		},
+		{
+			name:        "apiUtxo exclude frozen",
+			r:           newGetRequest(ts.URL + "/api/utxo/mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC?wallet=w1&excludefrozen=true"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[]`,
+			},
+		},
+		{
+			name:        "apiUtxo other wallet",
+			r:           newGetRequest(ts.URL + "/api/utxo/mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC?wallet=w2&excludefrozen=true"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","vout":0,"value":"1186.419755","height":225494,"confirmations":1}]`,
+			},
+		},
+		{
+			name:        "apiUtxo exclude frozen without wallet",
+			r:           newGetRequest(ts.URL + "/api/utxo/mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC?excludefrozen=true"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'excludefrozen' requires parameter 'wallet'"}`,
+			},
+		},
+		{
+			name:        "apiFlows",
+			r:           newGetRequest(ts.URL + "/api/flows/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw/mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"from":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","to":"mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC","maxHops":2,"paths":[[{"from":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","to":"mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX","txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","height":225494,"value":"3172.83951061"},{"from":"mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX","to":"mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC","txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","height":225494,"value":"1186.419755"}]]}`,
+			},
+		},
+		{
+			name:        "apiFlows direct only",
+			r:           newGetRequest(ts.URL + "/api/flows/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw/mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC?maxHops=1"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"from":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","to":"mwwoKQE5Lb1G4picHSHDQKg8jw424PF9SC","maxHops":1,"paths":[]}`,
+			},
+		},
+		{
+			name:        "apiFlows missing address",
+			r:           newGetRequest(ts.URL + "/api/flows/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Missing addresses, expecting api/flows/\u003cfrom\u003e/\u003cto\u003e"}`,
+			},
+		},
+		{
+			name:        "apiSearch block height",
+			r:           newGetRequest(ts.URL + "/api/search/225494"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"query":"225494","type":"block","height":225494,"hash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6"}`,
+			},
+		},
+		{
+			name:        "apiSearch tx",
+			r:           newGetRequest(ts.URL + "/api/search/?q=effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"query":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","type":"tx","height":225493,"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"}`,
+			},
+		},
+		{
+			name:        "apiSearch address",
+			r:           newGetRequest(ts.URL + "/api/search/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"query":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","type":"address","address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"}`,
+			},
+		},
+		{
+			name:        "apiSearch ENS",
+			r:           newGetRequest(ts.URL + "/api/search/vitalik.eth"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Search by ENS name is not supported"}`,
+			},
+		},
 		{
 			name:        "apiEstimateFee",
 			r:           newGetRequest(ts.URL + "/api/estimatefee/123?conservative=false"),
@@ -444,6 +1081,47 @@ func httpTests(t *testing.T, ts *httptest.Server) {
 				`{"result":"0.00012299"}`,
 			},
 		},
+		{
+			name:        "apiBlockStats",
+			r:           newGetRequest(ts.URL + "/api/blockstats/?from=225493&to=225494"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"from":225493,"to":225494,"feeRatePercentiles":[10,25,50,75,90],"blocks":[`,
+				`{"height":225493,"blockhash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","time":1534858021,"txs":2,"total_size":1234567`,
+				`{"height":225494,"blockhash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","time":1534859123,"txs":4,"total_size":2345678`,
+				`"total":{"blocks":2,"txs":6,"total_size":3580245,"weight_blocks":0,"total_weight":0,"sigops":0,`,
+			},
+		},
+		{
+			name:        "apiBlockStats invalid range",
+			r:           newGetRequest(ts.URL + "/api/blockstats/?from=225494&to=225493"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Parameter 'to' must not be lower than parameter 'from'"}`,
+			},
+		},
+		{
+			name:        "apiValidatePayment",
+			r:           newGetRequest(ts.URL + "/api/validate-payment/?uri=" + url.QueryEscape("bitcoin:mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?amount=0.1&label=Shop")),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"valid":true,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","amount":"0.1","label":"Shop","expired":false,"txApperances":2,"balance":"0"}`,
+			},
+		},
+		{
+			name:        "apiValidatePayment invalid",
+			r:           newGetRequest(ts.URL + "/api/validate-payment/?uri=" + url.QueryEscape("litecoin:1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2?req-foo=1&expires=1500000000&amount=0.000001")),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"valid":false`,
+				`"expired":true`,
+				`"errors":["URI scheme 'litecoin' does not match the chain, expected 'bitcoin'","Invalid address for this chain","Amount is below the dust threshold","Unsupported required parameter 'req-foo'","Payment request expired"]`,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -579,6 +1257,17 @@ func Test_PublicServer_UTXO(t *testing.T) {
 	s, dbpath := setupPublicHTTPServer(t)
 	defer closeAndDestroyPublicServer(t, s, dbpath)
 	s.ConnectFullPublicInterface()
+	for _, ms := range []db.MempoolSnapshot{
+		{Time: 1534858100, Txs: 10, FeeEstimates: []db.MempoolFeeEstimate{{Blocks: 2, FeeSat: *big.NewInt(2000)}, {Blocks: 6, FeeSat: *big.NewInt(1000)}}},
+		{Time: 1534858400, Txs: 20, FeeEstimates: []db.MempoolFeeEstimate{{Blocks: 2, FeeSat: *big.NewInt(4000)}, {Blocks: 6, FeeSat: *big.NewInt(1000)}}},
+		{Time: 1534858700, Txs: 31, FeeEstimates: []db.MempoolFeeEstimate{{Blocks: 2, FeeSat: *big.NewInt(3000)}}},
+	} {
+		if err := s.db.StoreMempoolSnapshot(&ms); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coinControlTests(t, &InternalServer{db: s.db, chainParser: s.chainParser, api: s.api})
+	receivedReportTests(t, &InternalServer{db: s.db, chainParser: s.chainParser, api: s.api})
 	// take the handler of the public server and pass it to the test server
 	ts := httptest.NewServer(s.https.Handler)
 	defer ts.Close()
@@ -587,3 +1276,104 @@ func Test_PublicServer_UTXO(t *testing.T) {
 	socketioTests(t, ts)
 
 }
+
+// coinControlTests sets the coin control data of the wallet w1 returned by the public API
+func coinControlTests(t *testing.T, s *InternalServer) {
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		status int
+		body   string
+	}{
+		{"invalid txid", http.MethodPost, "?wallet=w1&txid=xyz&vout=0&frozen=true", http.StatusBadRequest, "Invalid txid"},
+		{"output not in index", http.MethodPost, "?wallet=w1&txid=" + dbtestdata.TxidB2T2 + "&vout=5&frozen=true", http.StatusBadRequest, "Output " + dbtestdata.TxidB2T2 + ":5 not found"},
+		{"long label", http.MethodPost, "?wallet=w1&txid=" + dbtestdata.TxidB2T2 + "&vout=0&label=" + strings.Repeat("x", 257), http.StatusBadRequest, "Label must be at most 256 characters long"},
+		{"missing wallet", http.MethodPost, "?txid=" + dbtestdata.TxidB2T2 + "&vout=0&frozen=true", http.StatusBadRequest, "Wallet must be 1 to 64 characters long"},
+		{"set", http.MethodPost, "?wallet=w1&txid=" + dbtestdata.TxidB2T2 + "&vout=0&label=savings&frozen=true", http.StatusOK, `"label": "savings"`},
+		{"get", http.MethodGet, "?wallet=w1", http.StatusOK, `"label": "savings"`},
+		{"put", http.MethodPut, "?wallet=w1", http.StatusMethodNotAllowed, "Method not allowed"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		s.coinControl(rr, httptest.NewRequest(tt.method, "/admin/coin-control"+tt.query, nil))
+		if rr.Code != tt.status {
+			t.Errorf("coinControl %v: status %v, want %v", tt.name, rr.Code, tt.status)
+			continue
+		}
+		if b := rr.Body.String(); !strings.Contains(b, tt.body) {
+			t.Errorf("coinControl %v: body %v, want %v", tt.name, b, tt.body)
+		}
+	}
+}
+
+// receivedReportTests checks the report of the received values served by the internal server
+func receivedReportTests(t *testing.T, s *InternalServer) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+		want   string
+	}{
+		{
+			name:   "post",
+			method: http.MethodPost,
+			url:    "/report/received/",
+			body:   dbtestdata.Addr5 + ", " + dbtestdata.Addr1 + "\n" + dbtestdata.Addr5,
+			status: http.StatusOK,
+			want:   `{"fromHeight":0,"toHeight":225494,"received":"1.00018876","outputs":3,"addresses":[{"address":"2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1","received":"0.00018876","outputs":2},{"address":"mfcWp7DB6NuaZsExybTTXpVgWz559Np4Ti","received":"1","outputs":1}]}`,
+		},
+		{
+			name:   "time range",
+			method: http.MethodGet,
+			url:    "/report/received/" + dbtestdata.Addr5 + "," + dbtestdata.Addr1 + "?fromTime=1534859000&toTime=1534859123",
+			status: http.StatusOK,
+			want:   `{"fromHeight":225494,"toHeight":225494,"fromTime":1534859000,"toTime":1534859123,"received":"0.00009","outputs":1,"addresses":[{"address":"2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1","received":"0.00009","outputs":1},{"address":"mfcWp7DB6NuaZsExybTTXpVgWz559Np4Ti","received":"0","outputs":0}]}`,
+		},
+		{
+			name:   "invalid time",
+			method: http.MethodGet,
+			url:    "/report/received/" + dbtestdata.Addr5 + "?fromTime=yesterday",
+			status: http.StatusBadRequest,
+			want:   "Parameter 'fromTime' is not a valid unix time",
+		},
+		{
+			name:   "invalid range",
+			method: http.MethodGet,
+			url:    "/report/received/" + dbtestdata.Addr5 + "?from=10&to=5",
+			status: http.StatusBadRequest,
+			want:   "Parameter 'to' must not be lower than parameter 'from'",
+		},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		s.receivedReport(rr, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+		if rr.Code != tt.status {
+			t.Errorf("receivedReport %v: status %v, want %v", tt.name, rr.Code, tt.status)
+			continue
+		}
+		got := strings.TrimSpace(rr.Body.String())
+		if tt.status == http.StatusOK {
+			var b bytes.Buffer
+			if err := json.Compact(&b, rr.Body.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			got = b.String()
+		}
+		if got != tt.want {
+			t.Errorf("receivedReport %v: body %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_getMethodName(t *testing.T) {
+	s := &PublicServer{}
+	if got := getMethodName(s.apiTx); got != "apiTx" {
+		t.Errorf("getMethodName(apiTx) = %v, want apiTx", got)
+	}
+	if got := getMethodName(s.explorerAddress); got != "explorerAddress" {
+		t.Errorf("getMethodName(explorerAddress) = %v, want explorerAddress", got)
+	}
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"blockbook/common"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+var errTooManyRequests = errors.New("Too many requests")
+
+// quotaPruneInterval is the interval, in which the buckets of the idle clients are removed
+const quotaPruneInterval = time.Minute
+
+// defaultQuotaWeights are the weights of the methods, which are more expensive than a simple lookup,
+// the methods of the public api are prefixed by api/, the explorer pages by explorer/, the socket.io methods by socket.io/
+var defaultQuotaWeights = map[string]float64{
+	"api/address":                 2,
+	"api/address-export":          10,
+	"api/address-stream":          10,
+	"api/address-feed":            10,
+	"api/addresses":               10,
+	"api/account":                 20,
+	"api/account-utxo":            20,
+	"api/inscriptions":            10,
+	"api/utxo":                    2,
+	"api/flows":                   5,
+	"explorer/address":            5,
+	"explorer/search":             2,
+	"explorer/tx":                 2,
+	"explorer/block":              2,
+	"socket.io/getAddressHistory": 5,
+	"socket.io/getAddressTxids":   2,
+}
+
+// explorerQuotaPages are the explorer pages limited by the quotas, the static files and the index page are not limited
+var explorerQuotaPages = map[string]struct{}{
+	"tx":       {},
+	"address":  {},
+	"search":   {},
+	"blocks":   {},
+	"block":    {},
+	"spending": {},
+	"sendtx":   {},
+}
+
+// quotaMethod returns the method of the request given by the path relative to the network, api/<method> for the api requests
+// and explorer/<page> for the explorer pages, or an empty string if the request is not limited
+func quotaMethod(rel string) string {
+	if strings.HasPrefix(rel, "api/") {
+		if i := strings.IndexByte(rel[4:], '/'); i >= 0 {
+			return rel[:4+i]
+		}
+		return rel
+	}
+	page := rel
+	if i := strings.IndexByte(rel, '/'); i >= 0 {
+		page = rel[:i]
+	}
+	if _, found := explorerQuotaPages[page]; found {
+		return "explorer/" + page
+	}
+	return ""
+}
+
+// QuotaTier is the token bucket of each client of the tier: Rate tokens per second are added up to Burst tokens
+// and a request takes the number of tokens given by the weight of its method
+type QuotaTier struct {
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+}
+
+// QuotaConfig is the configuration of the quotas of the public API, it is read as json from the file given by the parameter -quotas
+// and can be replaced at runtime by the endpoint admin/quotas of the internal server, see docs/build.md
+type QuotaConfig struct {
+	// Tiers are the token buckets by the name of the tier, e.g. free and partner
+	Tiers map[string]QuotaTier `json:"tiers"`
+	// DefaultTier is the tier of the clients, which are not identified by the ClientHeader
+	DefaultTier string `json:"defaultTier"`
+	// ClientHeader is the request header with the key of the client (e.g. X-Api-Key), the keys are mapped to the tiers by Clients
+	ClientHeader string `json:"clientHeader,omitempty"`
+	// Clients maps the keys of the clients to the tiers, the clients with unknown keys are in the DefaultTier
+	Clients map[string]string `json:"clients,omitempty"`
+	// IPHeader is the request header with the address of the client set by a trusted proxy (e.g. X-Real-Ip), the remote address is used if empty
+	IPHeader string `json:"ipHeader,omitempty"`
+	// Weights are the weights of the methods overriding the default weights
+	Weights map[string]float64 `json:"weights,omitempty"`
+	// DefaultWeight is the weight of the methods without a weight, 1 if not set
+	DefaultWeight float64 `json:"defaultWeight,omitempty"`
+}
+
+// LoadQuotaConfig reads the configuration of the quotas from the json file
+func LoadQuotaConfig(file string) (*QuotaConfig, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var c QuotaConfig
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, errors.Annotatef(err, "quotas file %v", file)
+	}
+	return &c, nil
+}
+
+func (c *QuotaConfig) validate() error {
+	if len(c.Tiers) == 0 {
+		return errors.New("No quota tier")
+	}
+	for n, t := range c.Tiers {
+		if !(t.Rate > 0) || !(t.Burst >= 1) || math.IsInf(t.Rate, 0) || math.IsInf(t.Burst, 0) {
+			return errors.Errorf("Invalid quota tier '%v', rate must be positive and burst at least 1", n)
+		}
+	}
+	if _, found := c.Tiers[c.DefaultTier]; !found {
+		return errors.Errorf("Unknown default tier '%v'", c.DefaultTier)
+	}
+	for k, n := range c.Clients {
+		if _, found := c.Tiers[n]; !found {
+			return errors.Errorf("Unknown tier '%v' of client '%v'", n, k)
+		}
+	}
+	if len(c.Clients) > 0 && c.ClientHeader == "" {
+		return errors.New("Missing clientHeader identifying the clients")
+	}
+	for m, w := range c.Weights {
+		if !(w >= 0) || math.IsInf(w, 0) {
+			return errors.Errorf("Invalid weight of method '%v'", m)
+		}
+	}
+	if c.DefaultWeight < 0 || math.IsInf(c.DefaultWeight, 0) || math.IsNaN(c.DefaultWeight) {
+		return errors.New("Invalid default weight")
+	}
+	return nil
+}
+
+// quotaBucket is the token bucket of a client
+type quotaBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Quotas limit the requests of the clients of the public API and of the socket.io interface by the token buckets of their tiers
+type Quotas struct {
+	mux       sync.Mutex
+	config    *QuotaConfig
+	buckets   map[string]*quotaBucket
+	lastPrune time.Time
+	metrics   *common.Metrics
+	now       func() time.Time
+}
+
+// NewQuotas creates the quotas with the configuration, metrics may be nil
+func NewQuotas(c *QuotaConfig, metrics *common.Metrics) (*Quotas, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &Quotas{
+		config:  c,
+		buckets: make(map[string]*quotaBucket),
+		metrics: metrics,
+		now:     time.Now,
+	}, nil
+}
+
+// Config returns the current configuration of the quotas
+func (q *Quotas) Config() *QuotaConfig {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.config
+}
+
+// SetConfig replaces the configuration of the quotas, the tokens of the clients are kept up to the burst of their new tier
+func (q *Quotas) SetConfig(c *QuotaConfig) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.config = c
+	for k, b := range q.buckets {
+		t, found := c.Tiers[k[:strings.IndexByte(k, 0)]]
+		if !found {
+			delete(q.buckets, k)
+		} else if b.tokens > t.Burst {
+			b.tokens = t.Burst
+		}
+	}
+	return nil
+}
+
+// weight returns the number of tokens taken by the method
+func (c *QuotaConfig) weight(method string) float64 {
+	if w, found := c.Weights[method]; found {
+		return w
+	}
+	if w, found := defaultQuotaWeights[method]; found {
+		return w
+	}
+	if c.DefaultWeight > 0 {
+		return c.DefaultWeight
+	}
+	return 1
+}
+
+// client returns the tier and the identification of the client from the request headers and the remote address
+func (c *QuotaConfig) client(header http.Header, remoteAddr string) (string, string) {
+	if c.ClientHeader != "" {
+		if k := header.Get(c.ClientHeader); k != "" {
+			if t, found := c.Clients[k]; found {
+				return t, "key:" + k
+			}
+		}
+	}
+	ip := ""
+	if c.IPHeader != "" {
+		ip = strings.TrimSpace(header.Get(c.IPHeader))
+	}
+	if ip == "" {
+		ip = remoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			ip = host
+		}
+	}
+	return c.DefaultTier, "ip:" + ip
+}
+
+// take takes the tokens of the method from the bucket of the client identified by the headers and the remote address,
+// if there are not enough tokens, it returns false and the time after which the request can be repeated;
+// the weight higher than the burst of the tier takes the whole burst
+func (q *Quotas) take(header http.Header, remoteAddr, method string) (bool, time.Duration) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	now := q.now()
+	tierName, client := q.config.client(header, remoteAddr)
+	tier := q.config.Tiers[tierName]
+	if now.Sub(q.lastPrune) >= quotaPruneInterval {
+		q.prune(now)
+	}
+	key := tierName + "\x00" + client
+	b, found := q.buckets[key]
+	if !found {
+		b = &quotaBucket{tokens: tier.Burst, updated: now}
+		q.buckets[key] = b
+	} else if now.After(b.updated) {
+		b.tokens = math.Min(tier.Burst, b.tokens+now.Sub(b.updated).Seconds()*tier.Rate)
+		b.updated = now
+	}
+	w := math.Min(q.config.weight(method), tier.Burst)
+	if b.tokens >= w {
+		b.tokens -= w
+		return true, 0
+	}
+	if q.metrics != nil {
+		q.metrics.APIQuotaRejections.With(common.Labels{"tier": tierName}).Inc()
+	}
+	return false, time.Duration((w - b.tokens) / tier.Rate * float64(time.Second))
+}
+
+// allow takes the tokens of the method and returns true if the client did not exceed its quota
+func (q *Quotas) allow(header http.Header, remoteAddr, method string) bool {
+	ok, _ := q.take(header, remoteAddr, method)
+	return ok
+}
+
+// prune removes the buckets, which would be full by now, they are the same as the buckets of new clients
+func (q *Quotas) prune(now time.Time) {
+	for k, b := range q.buckets {
+		t := q.config.Tiers[k[:strings.IndexByte(k, 0)]]
+		if b.tokens+now.Sub(b.updated).Seconds()*t.Rate >= t.Burst {
+			delete(q.buckets, k)
+		}
+	}
+	q.lastPrune = now
+}
+
+// Clients returns the number of the clients, whose buckets are not full
+func (q *Quotas) Clients() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.buckets)
+}
+
+// handler rejects the API requests (under <path>[<network>/]api/) and the explorer pages of the clients over their quota
+// by the status 429, network returns the remaining path of the additional network, to which the path relative to the server
+// belongs; the methods of all networks share the buckets and the weights
+func (q *Quotas) handler(h http.Handler, path string, network func(rel string) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := quotaMethod(network(strings.TrimPrefix(r.URL.Path, path)))
+		if method == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if ok, retry := q.take(r.Header, r.RemoteAddr, method); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			if !strings.HasPrefix(method, "api/") {
+				http.Error(w, errTooManyRequests.Error(), http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(struct {
+				Text string `json:"error"`
+			}{errTooManyRequests.Error()})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// maxQuotaConfigBody is the maximum size of the configuration of the quotas posted to the internal server
+const maxQuotaConfigBody = 1024 * 1024
+
+// SetQuotas allows the configuration of the quotas of the public server at runtime by the endpoint admin/quotas
+func (s *InternalServer) SetQuotas(q *Quotas) {
+	s.quotas = q
+}
+
+// quotaConfig returns (GET) the configuration of the quotas and the number of the clients with the tokens taken,
+// or replaces (POST with the configuration as json in the body) the configuration
+func (s *InternalServer) quotaConfig(w http.ResponseWriter, r *http.Request) {
+	type resQuotas struct {
+		Config  *QuotaConfig `json:"config"`
+		Clients int          `json:"clients"`
+	}
+	if s.quotas == nil {
+		http.Error(w, "Quotas are not enabled", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var c QuotaConfig
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxQuotaConfigBody)).Decode(&c); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid quotas: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := s.quotas.SetConfig(&c); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid quotas: %v", err), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("internal server: quotas set, %d tiers, %d clients", len(c.Tiers), len(c.Clients))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSON(w, resQuotas{Config: s.quotas.Config(), Clients: s.quotas.Clients()})
+}
@@ -0,0 +1,168 @@
+// +build unittest
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testQuotaConfig() *QuotaConfig {
+	return &QuotaConfig{
+		Tiers: map[string]QuotaTier{
+			"free":    {Rate: 1, Burst: 4},
+			"partner": {Rate: 10, Burst: 100},
+		},
+		DefaultTier:  "free",
+		ClientHeader: "X-Api-Key",
+		Clients:      map[string]string{"k1": "partner"},
+		Weights:      map[string]float64{"api/tx": 1, "api/xpub": 3},
+	}
+}
+
+func TestQuotaConfigValidate(t *testing.T) {
+	for name, f := range map[string]func(c *QuotaConfig){
+		"no tiers":        func(c *QuotaConfig) { c.Tiers = nil },
+		"zero rate":       func(c *QuotaConfig) { c.Tiers["free"] = QuotaTier{Rate: 0, Burst: 4} },
+		"small burst":     func(c *QuotaConfig) { c.Tiers["free"] = QuotaTier{Rate: 1, Burst: 0.5} },
+		"default tier":    func(c *QuotaConfig) { c.DefaultTier = "gold" },
+		"client tier":     func(c *QuotaConfig) { c.Clients["k2"] = "gold" },
+		"client header":   func(c *QuotaConfig) { c.ClientHeader = "" },
+		"negative weight": func(c *QuotaConfig) { c.Weights["api/tx"] = -1 },
+	} {
+		c := testQuotaConfig()
+		f(c)
+		if _, err := NewQuotas(c, nil); err == nil {
+			t.Errorf("%v: NewQuotas() expected error", name)
+		}
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	q, err := NewQuotas(testQuotaConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	q.now = func() time.Time { return now }
+	free := http.Header{}
+	partner := http.Header{"X-Api-Key": []string{"k1"}}
+	unknown := http.Header{"X-Api-Key": []string{"k2"}}
+
+	// the burst of the free tier is 4 tokens, xpub weighs 3
+	if ok, _ := q.take(free, "10.0.0.1:1000", "api/xpub"); !ok {
+		t.Error("first xpub rejected")
+	}
+	if ok, _ := q.take(free, "10.0.0.1:1001", "api/tx"); !ok {
+		t.Error("tx within burst rejected")
+	}
+	ok, retry := q.take(free, "10.0.0.1:1002", "api/xpub")
+	if ok || retry != 3*time.Second {
+		t.Errorf("xpub over burst = %v, retry %v, want rejected, retry 3s", ok, retry)
+	}
+	// the unknown key is identified by the ip address
+	if ok, _ := q.take(unknown, "10.0.0.1:1003", "api/tx"); ok {
+		t.Error("unknown key not limited by the ip address")
+	}
+	// other client and partner have own buckets
+	if ok, _ := q.take(free, "10.0.0.2:1000", "api/xpub"); !ok {
+		t.Error("other client rejected")
+	}
+	for i := 0; i < 33; i++ {
+		if ok, _ := q.take(partner, "10.0.0.1:1004", "api/xpub"); !ok {
+			t.Fatalf("partner request %d rejected", i)
+		}
+	}
+	if ok, _ := q.take(partner, "10.0.0.1:1004", "api/xpub"); ok {
+		t.Error("partner over burst accepted")
+	}
+	// the tokens are refilled by the rate
+	now = now.Add(3 * time.Second)
+	if ok, _ := q.take(free, "10.0.0.1:1005", "api/xpub"); !ok {
+		t.Error("xpub after refill rejected")
+	}
+	// the weight over the burst takes the whole burst
+	c := testQuotaConfig()
+	c.Weights["api/xpub"] = 10
+	if err := q.SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Second)
+	if ok, _ := q.take(free, "10.0.0.1:1006", "api/xpub"); !ok {
+		t.Error("xpub with weight over the burst rejected")
+	}
+	if ok, _ := q.take(free, "10.0.0.1:1007", "api/tx"); ok {
+		t.Error("tx after the whole burst accepted")
+	}
+	// the full buckets are pruned
+	now = now.Add(time.Hour)
+	q.take(free, "10.0.0.3:1000", "api/tx")
+	if n := q.Clients(); n != 1 {
+		t.Errorf("Clients() after prune = %d, want 1", n)
+	}
+}
+
+func TestQuotasHandler(t *testing.T) {
+	c := testQuotaConfig()
+	c.Tiers["free"] = QuotaTier{Rate: 1, Burst: 1}
+	q, err := NewQuotas(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := q.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), "/", func(rel string) string {
+		if len(rel) > 4 && rel[:4] == "ltc/" {
+			return rel[4:]
+		}
+		return rel
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "10.0.0.1:1000"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	if w := get("/api/tx/abcd"); w.Code != http.StatusOK {
+		t.Errorf("first request status %d", w.Code)
+	}
+	// the static files are not limited
+	if w := get("/static/css/main.css"); w.Code != http.StatusOK {
+		t.Errorf("static request status %d", w.Code)
+	}
+	// the network shares the bucket
+	w := get("/ltc/api/tx/abcd")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("request over quota status %d, Retry-After %v", w.Code, w.Header().Get("Retry-After"))
+	}
+	if want := "{\"error\":\"Too many requests\"}\n"; w.Body.String() != want {
+		t.Errorf("request over quota body %q, want %q", w.Body.String(), want)
+	}
+	// the explorer pages share the bucket with the api
+	w = get("/tx/abcd")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" || w.Body.String() != "Too many requests\n" {
+		t.Errorf("explorer request over quota status %d, Retry-After %v, body %q", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+}
+
+func TestQuotaMethod(t *testing.T) {
+	for rel, want := range map[string]string{
+		"api/tx/abcd":           "api/tx",
+		"api/emission":          "api/emission",
+		"api/inscriptions/addr": "api/inscriptions",
+		"address/abcd":          "explorer/address",
+		"search/abcd":           "explorer/search",
+		"blocks":                "explorer/blocks",
+		"tx/abcd":               "explorer/tx",
+		"":                      "",
+		"static/css/main.css":   "",
+		"favicon.ico":           "",
+	} {
+		if got := quotaMethod(rel); got != want {
+			t.Errorf("quotaMethod(%q) = %q, want %q", rel, got, want)
+		}
+	}
+}
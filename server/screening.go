@@ -0,0 +1,489 @@
+package server
+
+import (
+	"blockbook/bchain"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+// RedactedAddress replaces the redacted addresses in the responses and notifications
+const RedactedAddress = "redacted"
+
+// screeningKey is the key of the annotations added to the JSON objects containing screened addresses
+const screeningKey = "screening"
+
+// ScreeningHit is the result of the screening of a listed address
+type ScreeningHit struct {
+	// List is the name of the list containing the address
+	List string
+	// Reason is the optional reason of the listing
+	Reason string
+	// Redact replaces the address by RedactedAddress, otherwise the address is only annotated
+	Redact bool
+}
+
+// AddressScreener screens the addresses appearing in the responses of the public API and in the socket.io notifications,
+// ScreenAddress returns nil if the address is not listed. It is called concurrently from the request handlers.
+type AddressScreener interface {
+	ScreenAddress(address string) *ScreeningHit
+}
+
+// ScreeningAnnotation is added to the array under the key "screening" of the JSON object, which contains the screened address
+// in a value, in an array of strings or as a key
+type ScreeningAnnotation struct {
+	// Address is empty if the address is redacted
+	Address  string `json:"address,omitempty"`
+	List     string `json:"list"`
+	Reason   string `json:"reason,omitempty"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+// addressScreening applies the screener to one JSON value
+type addressScreening struct {
+	screener AddressScreener
+	hits     int
+}
+
+// screenData returns data with the listed addresses redacted and annotated, data is returned unchanged if it contains no listed address;
+// the hits of a top level string or array of strings can be only redacted, there is no object to annotate. The typed value is screened
+// first, only the value with a listed address is converted to JSON and back to be redacted and annotated.
+func screenData(screener AddressScreener, data interface{}) (interface{}, error) {
+	if len(screenHits(screener, data)) == 0 {
+		return data, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	// keep the numbers exactly as they were encoded
+	d.UseNumber()
+	var v interface{}
+	if err = d.Decode(&v); err != nil {
+		return nil, err
+	}
+	sc := addressScreening{screener: screener}
+	v, _ = sc.screen(v)
+	return v, nil
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// screenHits returns the hits of the listed addresses in the typed value keyed by the address, the value is walked as it would be
+// encoded to JSON: the strings, the keys of the maps, the exported fields of the structs without the tag json:"-" and the raw JSON
+func screenHits(screener AddressScreener, data interface{}) map[string]*ScreeningHit {
+	if screener == nil || data == nil {
+		return nil
+	}
+	hits := make(map[string]*ScreeningHit)
+	collectScreeningHits(screener, reflect.ValueOf(data), hits)
+	return hits
+}
+
+func collectScreeningHits(screener AddressScreener, v reflect.Value, hits map[string]*ScreeningHit) {
+	switch v.Kind() {
+	case reflect.String:
+		if h := screener.ScreenAddress(v.String()); h != nil {
+			hits[v.String()] = h
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectScreeningHits(screener, v.Elem(), hits)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous || f.Tag.Get("json") == "-" {
+				continue
+			}
+			collectScreeningHits(screener, v.Field(i), hits)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			collectScreeningHits(screener, k, hits)
+			collectScreeningHits(screener, v.MapIndex(k), hits)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type() == rawMessageType {
+			var d interface{}
+			if json.Unmarshal(v.Bytes(), &d) == nil {
+				collectScreeningHits(screener, reflect.ValueOf(d), hits)
+			}
+			return
+		}
+		// the byte slices are encoded as base64
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			collectScreeningHits(screener, v.Index(i), hits)
+		}
+	}
+}
+
+// screeningAnnotations converts the hits to the sorted annotations, the redacted addresses are not disclosed
+func screeningAnnotations(hits map[string]*ScreeningHit) []*ScreeningAnnotation {
+	if len(hits) == 0 {
+		return nil
+	}
+	as := make([]*ScreeningAnnotation, 0, len(hits))
+	for address, h := range hits {
+		a := &ScreeningAnnotation{List: h.List, Reason: h.Reason, Redacted: h.Redact}
+		if !h.Redact {
+			a.Address = address
+		}
+		as = append(as, a)
+	}
+	return uniqueAnnotations(as)
+}
+
+// redactText replaces the redacted addresses of the hits in the rendered text (e.g. html page), the links to the addresses included
+func redactText(b []byte, hits map[string]*ScreeningHit) []byte {
+	for address, h := range hits {
+		if h.Redact {
+			b = bytes.Replace(b, []byte(address), []byte(RedactedAddress), -1)
+		}
+	}
+	return b
+}
+
+// screenAddress returns the hit of the address or nil if the address is not listed or there is no screener
+func (s *PublicServer) screenAddress(address string) *ScreeningHit {
+	if s.screener == nil {
+		return nil
+	}
+	return s.screener.ScreenAddress(address)
+}
+
+// screenString screens a string value, it returns the (possibly redacted) value and its annotation
+func (sc *addressScreening) screenString(s string) (string, *ScreeningAnnotation) {
+	h := sc.screener.ScreenAddress(s)
+	if h == nil {
+		return s, nil
+	}
+	sc.hits++
+	a := &ScreeningAnnotation{List: h.List, Reason: h.Reason, Redacted: h.Redact}
+	if h.Redact {
+		return RedactedAddress, a
+	}
+	a.Address = s
+	return s, a
+}
+
+// screen screens the decoded JSON value, the annotations of the strings are returned to be added to the enclosing object,
+// the objects are annotated in place
+func (sc *addressScreening) screen(v interface{}) (interface{}, []*ScreeningAnnotation) {
+	switch t := v.(type) {
+	case string:
+		s, a := sc.screenString(t)
+		if a != nil {
+			return s, []*ScreeningAnnotation{a}
+		}
+	case []interface{}:
+		var as []*ScreeningAnnotation
+		for i := range t {
+			var a []*ScreeningAnnotation
+			t[i], a = sc.screen(t[i])
+			as = append(as, a...)
+		}
+		return t, as
+	case map[string]interface{}:
+		var as []*ScreeningAnnotation
+		for k, e := range t {
+			if _, a := sc.screenString(k); a != nil {
+				as = append(as, a)
+				if a.Redacted {
+					// the key cannot be replaced, several keys could collide
+					delete(t, k)
+					continue
+				}
+			}
+			var a []*ScreeningAnnotation
+			t[k], a = sc.screen(e)
+			as = append(as, a...)
+		}
+		if len(as) > 0 {
+			t[screeningKey] = uniqueAnnotations(as)
+		}
+		return t, nil
+	}
+	return v, nil
+}
+
+// uniqueAnnotations removes the duplicate annotations and sorts them so that the output is stable
+func uniqueAnnotations(as []*ScreeningAnnotation) []*ScreeningAnnotation {
+	sort.Slice(as, func(i, j int) bool {
+		if as[i].Address != as[j].Address {
+			return as[i].Address < as[j].Address
+		}
+		if as[i].List != as[j].List {
+			return as[i].List < as[j].List
+		}
+		return as[i].Reason < as[j].Reason
+	})
+	r := as[:1]
+	for _, a := range as[1:] {
+		if *a != *r[len(r)-1] {
+			r = append(r, a)
+		}
+	}
+	return r
+}
+
+// DenylistSource is a denylist loaded from a file or from a http(s) url, specified as <file or url>[;<option>=<value>]..., see docs/build.md
+type DenylistSource struct {
+	// Location is the path of the file or the url of the list
+	Location string
+	// Name identifies the list in the annotations, the base name of the location by default
+	Name string
+	// Redact redacts the listed addresses, otherwise they are only annotated
+	Redact bool
+	// Refresh is the period of the reload of the list
+	Refresh time.Duration
+}
+
+// ParseDenylistSources parses the comma separated list of the denylist sources
+func ParseDenylistSources(s string) ([]*DenylistSource, error) {
+	var sources []*DenylistSource
+	for _, l := range strings.Split(s, ",") {
+		parts := strings.Split(l, ";")
+		src := &DenylistSource{
+			Location: strings.TrimSpace(parts[0]),
+			Refresh:  time.Hour,
+		}
+		if src.Location == "" {
+			continue
+		}
+		src.Name = strings.TrimSuffix(path.Base(src.Location), path.Ext(src.Location))
+		for _, opt := range parts[1:] {
+			opt = strings.TrimSpace(opt)
+			if opt == "" {
+				continue
+			}
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 {
+				return nil, errors.Errorf("Invalid denylist option '%v'", opt)
+			}
+			var err error
+			switch kv[0] {
+			case "name":
+				src.Name = kv[1]
+			case "redact":
+				if src.Redact, err = strconv.ParseBool(kv[1]); err != nil {
+					return nil, errors.Errorf("Invalid redact value '%v'", kv[1])
+				}
+			case "refresh":
+				if src.Refresh, err = time.ParseDuration(kv[1]); err != nil || src.Refresh < time.Second {
+					return nil, errors.Errorf("Invalid refresh '%v'", kv[1])
+				}
+			default:
+				return nil, errors.Errorf("Unknown denylist option '%v'", kv[0])
+			}
+		}
+		sources = append(sources, src)
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("Missing denylist")
+	}
+	return sources, nil
+}
+
+// denylist is the loaded content of a source, version is the modification time of the file or the ETag of the url
+type denylist struct {
+	source  *DenylistSource
+	version string
+	entries map[string]*ScreeningHit
+}
+
+// Denylist is the AddressScreener of the addresses listed in the denylists supplied by the operator,
+// the lists are reloaded periodically and the last successfully loaded content is used if the reload fails
+type Denylist struct {
+	parser bchain.BlockChainParser
+	client *http.Client
+	mux    sync.RWMutex
+	lists  []*denylist
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewDenylist loads the denylists and starts their periodic reload, the addresses are also listed in the canonical form
+// given by parser so that e.g. the case of bech32 addresses does not matter
+func NewDenylist(sources []*DenylistSource, parser bchain.BlockChainParser) (*Denylist, error) {
+	d := &Denylist{
+		parser: parser,
+		client: &http.Client{Timeout: time.Minute},
+		lists:  make([]*denylist, len(sources)),
+		done:   make(chan struct{}),
+	}
+	for i, src := range sources {
+		l, err := d.load(src, "")
+		if err != nil {
+			return nil, errors.Annotatef(err, "denylist %v", src.Name)
+		}
+		d.lists[i] = l
+		glog.Info("denylist ", src.Name, ": ", len(l.entries), " addresses")
+	}
+	for i := range sources {
+		d.wg.Add(1)
+		go d.refreshLoop(i)
+	}
+	return d, nil
+}
+
+// Close stops the reload of the lists
+func (d *Denylist) Close() {
+	close(d.done)
+	d.wg.Wait()
+}
+
+// ScreenAddress returns the hit of the first list containing the address, the lists redacting the address take precedence
+func (d *Denylist) ScreenAddress(address string) *ScreeningHit {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	var hit *ScreeningHit
+	for _, l := range d.lists {
+		if h := l.entries[address]; h != nil {
+			if h.Redact {
+				return h
+			}
+			if hit == nil {
+				hit = h
+			}
+		}
+	}
+	return hit
+}
+
+func (d *Denylist) refreshLoop(i int) {
+	defer d.wg.Done()
+	d.mux.RLock()
+	src := d.lists[i].source
+	d.mux.RUnlock()
+	ticker := time.NewTicker(src.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+		d.mux.RLock()
+		version := d.lists[i].version
+		d.mux.RUnlock()
+		l, err := d.load(src, version)
+		if err != nil {
+			glog.Error("denylist ", src.Name, ": ", err, ", keeping the previous list")
+			continue
+		}
+		if l == nil {
+			continue
+		}
+		d.mux.Lock()
+		d.lists[i] = l
+		d.mux.Unlock()
+		glog.Info("denylist ", src.Name, ": reloaded, ", len(l.entries), " addresses")
+	}
+}
+
+// load reads the list, it returns nil if the list did not change since version
+func (d *Denylist) load(src *DenylistSource, version string) (*denylist, error) {
+	var r io.ReadCloser
+	l := &denylist{source: src}
+	if strings.HasPrefix(src.Location, "http://") || strings.HasPrefix(src.Location, "https://") {
+		req, err := http.NewRequest("GET", src.Location, nil)
+		if err != nil {
+			return nil, err
+		}
+		if version != "" {
+			req.Header.Set("If-None-Match", version)
+		}
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotModified && version != "" {
+			resp.Body.Close()
+			return nil, nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, errors.Errorf("Status %v", resp.Status)
+		}
+		l.version = resp.Header.Get("ETag")
+		r = resp.Body
+	} else {
+		f, err := os.Open(src.Location)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		l.version = fi.ModTime().UTC().Format(time.RFC3339Nano)
+		if l.version == version {
+			f.Close()
+			return nil, nil
+		}
+		r = f
+	}
+	defer r.Close()
+	entries, err := d.parse(src, r)
+	if err != nil {
+		return nil, err
+	}
+	l.entries = entries
+	return l, nil
+}
+
+// parse reads the list, one <address>[,<reason>] per line, the empty lines and the lines starting by # are skipped
+func (d *Denylist) parse(src *DenylistSource, r io.Reader) (map[string]*ScreeningHit, error) {
+	entries := make(map[string]*ScreeningHit)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		t := strings.TrimSpace(scanner.Text())
+		if t == "" || t[0] == '#' {
+			continue
+		}
+		p := strings.SplitN(t, ",", 2)
+		address := strings.TrimSpace(p[0])
+		if address == "" {
+			return nil, errors.Errorf("line %d: missing address", line)
+		}
+		h := &ScreeningHit{List: src.Name, Redact: src.Redact}
+		if len(p) == 2 {
+			h.Reason = strings.TrimSpace(p[1])
+		}
+		entries[address] = h
+		if d.parser != nil {
+			// the address of another coin is listed as it is
+			if ad, err := d.parser.GetAddrDescFromAddress(address); err == nil {
+				if a, _, err := d.parser.GetAddressesFromAddrDesc(ad); err == nil && len(a) == 1 && a[0] != address {
+					entries[a[0]] = h
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,300 @@
+// +build unittest
+
+package server
+
+import (
+	"blockbook/bchain/coins/btc"
+	"blockbook/tests/dbtestdata"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseDenylistSources(t *testing.T) {
+	got, err := ParseDenylistSources("/etc/blockbook/sanctions.txt;redact=true, https://example.com/lists/risk.csv;name=risk;refresh=10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*DenylistSource{
+		{Location: "/etc/blockbook/sanctions.txt", Name: "sanctions", Redact: true, Refresh: time.Hour},
+		{Location: "https://example.com/lists/risk.csv", Name: "risk", Refresh: 10 * time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDenylistSources() = %+v, want %+v", got, want)
+	}
+	for _, s := range []string{"", "list.txt;redact=maybe", "list.txt;refresh=1ms", "list.txt;colour=red", "list.txt;name"} {
+		if _, err := ParseDenylistSources(s); err == nil {
+			t.Errorf("ParseDenylistSources(%q): expected error", s)
+		}
+	}
+}
+
+type mapScreener map[string]*ScreeningHit
+
+func (m mapScreener) ScreenAddress(address string) *ScreeningHit {
+	return m[address]
+}
+
+func Test_screenData(t *testing.T) {
+	screener := mapScreener{
+		dbtestdata.Addr1: {List: "risk", Reason: "mixer"},
+		dbtestdata.Addr2: {List: "sanctions", Redact: true},
+	}
+	type vout struct {
+		Value     json.Number `json:"value"`
+		Addresses []string    `json:"addresses"`
+	}
+	type tx struct {
+		Txid  string         `json:"txid"`
+		Vout  []vout         `json:"vout"`
+		Token map[string]int `json:"tokens,omitempty"`
+	}
+	clean := &tx{Txid: "00ff", Vout: []vout{{Value: "1.5", Addresses: []string{dbtestdata.Addr3}}}}
+	got, err := screenData(screener, clean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != clean {
+		t.Errorf("screenData() changed the data without listed addresses: %+v", got)
+	}
+	got, err = screenData(screener, &tx{
+		Txid: "00ff",
+		Vout: []vout{
+			{Value: "0.00012345678901234567", Addresses: []string{dbtestdata.Addr1, dbtestdata.Addr3}},
+			{Value: "2", Addresses: []string{dbtestdata.Addr2}},
+		},
+		Token: map[string]int{dbtestdata.Addr2: 1, dbtestdata.Addr1: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"tokens":{"` + dbtestdata.Addr1 + `":2,"screening":[{"list":"sanctions","redacted":true},{"address":"` + dbtestdata.Addr1 + `","list":"risk","reason":"mixer"}]},` +
+		`"txid":"00ff","vout":[` +
+		`{"addresses":["` + dbtestdata.Addr1 + `","` + dbtestdata.Addr3 + `"],"screening":[{"address":"` + dbtestdata.Addr1 + `","list":"risk","reason":"mixer"}],"value":0.00012345678901234567},` +
+		`{"addresses":["redacted"],"screening":[{"list":"sanctions","redacted":true}],"value":2}]}`
+	if string(b) != want {
+		t.Errorf("screenData() = %s, want %s", b, want)
+	}
+	if got, err = screenData(screener, []string{dbtestdata.Addr2, dbtestdata.Addr3}); err != nil || !reflect.DeepEqual(got, []interface{}{RedactedAddress, dbtestdata.Addr3}) {
+		t.Errorf("screenData() of top level array = %v, %v", got, err)
+	}
+}
+
+func Test_screenHits(t *testing.T) {
+	screener := mapScreener{
+		dbtestdata.Addr1: {List: "risk"},
+		dbtestdata.Addr2: {List: "sanctions", Redact: true},
+		dbtestdata.Addr3: {List: "risk"},
+		dbtestdata.Addr4: {List: "risk"},
+		dbtestdata.Addr5: {List: "risk"},
+	}
+	type embedded struct {
+		Note string
+	}
+	type value struct {
+		embedded
+		Address  *string
+		Any      interface{}
+		Keys     map[string]int
+		Raw      json.RawMessage
+		Skipped  string `json:"-"`
+		Data     []byte
+		internal string
+	}
+	addr1 := dbtestdata.Addr1
+	v := value{
+		embedded: embedded{Note: dbtestdata.Addr4},
+		Address:  &addr1,
+		Any:      []interface{}{"x", dbtestdata.Addr2},
+		Keys:     map[string]int{dbtestdata.Addr3: 1},
+		Raw:      json.RawMessage(`{"to":"` + dbtestdata.Addr5 + `"}`),
+		Skipped:  dbtestdata.Addr1 + "x",
+		Data:     []byte(dbtestdata.Addr1 + "y"),
+		internal: dbtestdata.Addr1 + "z",
+	}
+	got := screenHits(screener, &v)
+	if len(got) != 5 || got[dbtestdata.Addr1] == nil || got[dbtestdata.Addr2] == nil || got[dbtestdata.Addr3] == nil || got[dbtestdata.Addr4] == nil || got[dbtestdata.Addr5] == nil {
+		t.Errorf("screenHits() = %v", got)
+	}
+	if got = screenHits(screener, &value{Skipped: dbtestdata.Addr1, Data: []byte(dbtestdata.Addr1), internal: dbtestdata.Addr1}); len(got) != 0 {
+		t.Errorf("screenHits() of not encoded fields = %v", got)
+	}
+	if got = screenHits(nil, &v); got != nil {
+		t.Errorf("screenHits() without screener = %v", got)
+	}
+	as := screeningAnnotations(map[string]*ScreeningHit{dbtestdata.Addr1: screener[dbtestdata.Addr1], dbtestdata.Addr2: screener[dbtestdata.Addr2]})
+	if want := []*ScreeningAnnotation{{List: "sanctions", Redacted: true}, {Address: dbtestdata.Addr1, List: "risk"}}; !reflect.DeepEqual(as, want) {
+		t.Errorf("screeningAnnotations() = %+v, want %+v", as, want)
+	}
+}
+
+// Test_PublicServer_Screening checks the screening of the explorer pages and of the responses not handled by jsonHandler
+func Test_PublicServer_Screening(t *testing.T) {
+	s, dbpath := setupPublicHTTPServer(t)
+	defer closeAndDestroyPublicServer(t, s, dbpath)
+	s.SetAddressScreener(mapScreener{
+		"mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz": {List: "risk", Reason: "mixer"},
+		"mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL": {List: "sanctions", Redact: true},
+	})
+	s.ConnectFullPublicInterface()
+	ts := httptest.NewServer(s.https.Handler)
+	defer ts.Close()
+	tests := []struct {
+		name    string
+		url     string
+		body    []string
+		missing []string
+	}{
+		{
+			name: "explorerAddress",
+			url:  "/address/mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz",
+			body: []string{
+				`<div>A redacted address is listed in sanctions</div>`,
+				`<div>Address mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz is listed in risk: mixer</div>`,
+				`<a href="/address/redacted">redacted</a>`,
+			},
+			missing: []string{"mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"},
+		},
+		{
+			name:    "explorerTx",
+			url:     "/tx/7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25",
+			body:    []string{`<div>A redacted address is listed in sanctions</div>`, `<a href="/address/redacted">redacted</a>`},
+			missing: []string{"mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"},
+		},
+		{
+			name:    "explorerSearch",
+			url:     "/search/?q=mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL",
+			body:    []string{`No matching records found`},
+			missing: []string{`href="/address/mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"`},
+		},
+		{
+			name:    "apiAddressStream",
+			url:     "/api/address-stream/mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz?details=txs",
+			body:    []string{`"screening":[{"address":"mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz","list":"risk","reason":"mixer"}]`, `"addresses":["redacted"]`},
+			missing: []string{"mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"},
+		},
+		{
+			name:    "apiAddressFeed",
+			url:     "/api/address-feed/mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL",
+			body:    []string{`address redacted`},
+			missing: []string{"mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.body {
+				if !strings.Contains(string(b), s) {
+					t.Errorf("body does not contain %v, body %s", s, b)
+				}
+			}
+			for _, s := range tt.missing {
+				if strings.Contains(string(b), s) {
+					t.Errorf("body contains %v", s)
+				}
+			}
+		})
+	}
+	resp, err := http.Get(ts.URL + "/api/address-export/mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL?format=koinly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if d := resp.Header.Get("Content-Disposition"); d != "attachment; filename=redacted-koinly.csv" {
+		t.Errorf("apiAddressExport Content-Disposition %v", d)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sanctions.txt")
+	if err = ioutil.WriteFile(file, []byte("# sanctioned\n"+dbtestdata.Addr1+", entity 1\n\nTB1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KXPJZSX\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var list atomic.Value
+	list.Store(dbtestdata.Addr1 + "\n" + dbtestdata.Addr2 + ",exchange hack\n")
+	var notModified int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := list.Load().(string)
+		etag := strconv.Quote(strconv.Itoa(len(l)))
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(l))
+	}))
+	defer ts.Close()
+
+	parser := btc.NewBitcoinParser(btc.GetChainParams("test"), &btc.Configuration{})
+	d, err := NewDenylist([]*DenylistSource{
+		{Location: ts.URL + "/risk", Name: "risk", Refresh: 20 * time.Millisecond},
+		{Location: file, Name: "sanctions", Redact: true, Refresh: time.Hour},
+	}, parser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	tests := []struct {
+		address string
+		want    *ScreeningHit
+	}{
+		{dbtestdata.Addr1, &ScreeningHit{List: "sanctions", Reason: "entity 1", Redact: true}},
+		{dbtestdata.Addr2, &ScreeningHit{List: "risk", Reason: "exchange hack"}},
+		{dbtestdata.Addr3, nil},
+		{"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", &ScreeningHit{List: "sanctions", Redact: true}},
+	}
+	for _, tt := range tests {
+		if got := d.ScreenAddress(tt.address); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ScreenAddress(%v) = %+v, want %+v", tt.address, got, tt.want)
+		}
+	}
+
+	list.Store(dbtestdata.Addr3 + ",new\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for d.ScreenAddress(dbtestdata.Addr3) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the url list was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d.ScreenAddress(dbtestdata.Addr2) != nil {
+		t.Error("the address removed from the reloaded list is still listed")
+	}
+	for atomic.LoadInt32(&notModified) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the unchanged list was downloaded again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err = NewDenylist([]*DenylistSource{{Location: filepath.Join(dir, "missing.txt"), Name: "missing", Refresh: time.Hour}}, nil); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("NewDenylist() of missing file: error %v", err)
+	}
+}
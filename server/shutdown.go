@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+var errShuttingDown = errors.New("Server is shutting down")
+
+// requestTracker counts the requests in progress so that the shutdown can wait for them before the db is closed,
+// http.Server.Shutdown does not wait for the socket.io messages (the connections are hijacked) nor for the requests
+// which do not finish before its context expires
+type requestTracker struct {
+	mux     sync.Mutex
+	running int
+	closing bool
+	idle    chan struct{}
+	// paused is not nil while the new requests wait for the resume, it is closed by the resume
+	paused chan struct{}
+	// skip are the path prefixes of the requests which are not tracked, they must be set before the server runs
+	skip []string
+}
+
+// begin registers a request in progress, returns false if the server is shutting down,
+// if the server is paused, it waits until it is resumed
+func (t *requestTracker) begin() bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	for t.paused != nil && !t.closing {
+		p := t.paused
+		t.mux.Unlock()
+		<-p
+		t.mux.Lock()
+	}
+	if t.closing {
+		return false
+	}
+	t.running++
+	return true
+}
+
+// end unregisters the request registered by begin
+func (t *requestTracker) end() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.running--
+	if t.running == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// isClosing returns true if the server is shutting down, the long running requests check it to end early
+func (t *requestTracker) isClosing() bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.closing
+}
+
+// close refuses the new requests, including those waiting for the resume of the paused server
+func (t *requestTracker) close() {
+	t.mux.Lock()
+	t.closing = true
+	t.resumeLocked()
+	t.mux.Unlock()
+}
+
+// pause makes the new requests wait until resume is called, the requests in progress are waited for by wait
+func (t *requestTracker) pause() {
+	t.mux.Lock()
+	if t.paused == nil {
+		t.paused = make(chan struct{})
+	}
+	t.mux.Unlock()
+}
+
+// resume lets the requests waiting since pause continue
+func (t *requestTracker) resume() {
+	t.mux.Lock()
+	t.resumeLocked()
+	t.mux.Unlock()
+}
+
+func (t *requestTracker) resumeLocked() {
+	if t.paused != nil {
+		close(t.paused)
+		t.paused = nil
+	}
+}
+
+// wait waits until the requests in progress finish or the context is done, it must be called after close or pause
+func (t *requestTracker) wait(ctx context.Context) error {
+	t.mux.Lock()
+	if t.running == 0 {
+		t.mux.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mux.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		t.mux.Lock()
+		running := t.running
+		t.mux.Unlock()
+		return errors.Errorf("%d requests still running: %v", running, ctx.Err())
+	}
+}
+
+// handler tracks the requests of the handler except the paths with the prefix skip,
+// the requests arriving during the shutdown get the status ServiceUnavailable
+func (t *requestTracker) handler(h http.Handler, skip string) http.Handler {
+	if skip != "" {
+		t.skip = append(t.skip, skip)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range t.skip {
+			if strings.HasPrefix(r.URL.Path, s) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		if !t.begin() {
+			w.Header().Set("Connection", "close")
+			http.Error(w, errShuttingDown.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer t.end()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// shutdownWriter fails the writes of a streamed response when the server is shutting down
+type shutdownWriter struct {
+	w http.ResponseWriter
+	t *requestTracker
+}
+
+func (sw *shutdownWriter) Write(p []byte) (int, error) {
+	if sw.t.isClosing() {
+		return 0, errShuttingDown
+	}
+	return sw.w.Write(p)
+}
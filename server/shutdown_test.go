@@ -0,0 +1,153 @@
+// +build unittest
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_requestTracker(t *testing.T) {
+	rt := &requestTracker{}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := rt.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.Write([]byte("ok"))
+	}), "/socket.io/")
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	<-started
+	rt.close()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status after close = %v, want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/socket.io/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("status of skipped path after close = %v, want %v", rr.Code, http.StatusOK)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rt.wait(ctx); err == nil {
+		t.Error("wait returned before the running request finished")
+	}
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rt.wait(ctx); err != nil {
+		t.Errorf("wait error %v", err)
+	}
+}
+
+func Test_requestTracker_networkSkip(t *testing.T) {
+	rt := &requestTracker{}
+	h := rt.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), "/socket.io/")
+	// the socket.io of a mounted network is added after the handler is created
+	rt.skip = append(rt.skip, "/testnet/socket.io/")
+	rt.close()
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/socket.io/", http.StatusOK},
+		{"/testnet/socket.io/", http.StatusOK},
+		{"/testnet/api/", http.StatusServiceUnavailable},
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", tc.path, nil))
+		if rr.Code != tc.want {
+			t.Errorf("status of %v after close = %v, want %v", tc.path, rr.Code, tc.want)
+		}
+	}
+}
+
+func Test_requestTracker_pause(t *testing.T) {
+	rt := &requestTracker{}
+	h := rt.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}), "/admin/migrate-db")
+	rt.pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rt.wait(ctx); err != nil {
+		t.Fatalf("wait error %v", err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/migrate-db", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("status of skipped path when paused = %v, want %v", rr.Code, http.StatusOK)
+	}
+	done := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/", nil))
+		done <- rr.Code
+	}()
+	select {
+	case <-done:
+		t.Fatal("request finished while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	rt.resume()
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("status after resume = %v, want %v", code, http.StatusOK)
+	}
+
+	// close refuses the requests waiting for the resume
+	rt.pause()
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/api/", nil))
+		done <- rr.Code
+	}()
+	time.Sleep(10 * time.Millisecond)
+	rt.close()
+	if code := <-done; code != http.StatusServiceUnavailable {
+		t.Errorf("status after close = %v, want %v", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestInternalServer_Shutdown(t *testing.T) {
+	rt := &requestTracker{}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := rt.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), "")
+	s := &InternalServer{https: &http.Server{Handler: h}, requests: rt}
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/admin/trace", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err == nil {
+		t.Error("Shutdown returned no error before the running request finished")
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/trace", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status after shutdown = %v, want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown error %v", err)
+	}
+}
@@ -28,6 +28,9 @@ type SocketIoServer struct {
 	metrics     *common.Metrics
 	is          *common.InternalState
 	api         *api.Worker
+	requests    *requestTracker
+	screener    AddressScreener
+	quotas      *Quotas
 }
 
 // NewSocketIoServer creates new SocketIo interface to blockbook and returns its handle
@@ -170,8 +173,21 @@ func (s *SocketIoServer) onMessage(c *gosocketio.Channel, req map[string]json.Ra
 	params := req["params"]
 	defer s.metrics.SocketIOReqDuration.With(common.Labels{"method": method}).Observe(float64(time.Since(t)) / 1e3) // in microseconds
 	f, ok := onMessageHandlers[method]
-	if ok {
+	if s.requests != nil && !s.requests.begin() {
+		err = errShuttingDown
+	} else if ok && s.quotas != nil && !s.quotas.allow(c.RequestHeader(), c.Ip(), "socket.io/"+method) {
+		if s.requests != nil {
+			s.requests.end()
+		}
+		err = errTooManyRequests
+	} else if ok {
+		if s.requests != nil {
+			defer s.requests.end()
+		}
 		rv, err = f(s, params)
+		if err == nil {
+			rv, err = screenData(s.screener, rv)
+		}
 	} else {
 		err = errors.New("unknown method")
 	}
@@ -214,6 +230,9 @@ func (s *SocketIoServer) getAddressTxids(addr []string, opts *addrOpts) (res res
 	lower, higher := uint32(opts.End), uint32(opts.Start)
 	for _, address := range addr {
 		if !opts.QueryMempoolOnly {
+			if err = s.api.CheckAddressScan(address); err != nil {
+				return res, err
+			}
 			err = s.db.GetTransactions(address, lower, higher, func(txid string, vout uint32, isOutput bool) error {
 				txids = append(txids, txid)
 				return nil
@@ -579,7 +598,7 @@ type resultGetInfo struct {
 }
 
 func (s *SocketIoServer) getInfo() (res resultGetInfo, err error) {
-	height, _, err := s.db.GetBestBlock()
+	height, err := s.db.GetBestHeight()
 	if err != nil {
 		return
 	}
@@ -657,9 +676,12 @@ func (s *SocketIoServer) getMempoolEntry(txid string) (res resultGetMempoolEntry
 	return
 }
 
-// onSubscribe expects two event subscriptions based on the req parameter (including the doublequotes):
+// onSubscribe expects three event subscriptions based on the req parameter (including the doublequotes):
 // "bitcoind/hashblock"
+// "blockbook/spentoutpoint"
+// "blockbook/mempooleviction"
 // "bitcoind/addresstxid",["2MzTmvPJLZaLzD9XdN3jMtQA5NexC3rAPww","2NAZRJKr63tSdcTxTN3WaE9ZNDyXy6PgGuv"]
+// "blockbook/multisig",["wallet1:token1","wallet2:token2"]
 func (s *SocketIoServer) onSubscribe(c *gosocketio.Channel, req []byte) interface{} {
 	defer func() {
 		if r := recover(); r != nil {
@@ -679,8 +701,8 @@ func (s *SocketIoServer) onSubscribe(c *gosocketio.Channel, req []byte) interfac
 	if i > 0 {
 		var addrs []string
 		sc = r[1:i]
-		if sc != "bitcoind/addresstxid" {
-			onError(c.Id(), sc, "invalid data", "expecting bitcoind/addresstxid, req: "+r)
+		if sc != "bitcoind/addresstxid" && sc != "blockbook/multisig" {
+			onError(c.Id(), sc, "invalid data", "expecting bitcoind/addresstxid or blockbook/multisig, req: "+r)
 			return nil
 		}
 		err := json.Unmarshal([]byte(r[i+2:]), &addrs)
@@ -688,6 +710,26 @@ func (s *SocketIoServer) onSubscribe(c *gosocketio.Channel, req []byte) interfac
 			onError(c.Id(), sc, "invalid data", err.Error()+", req: "+r)
 			return nil
 		}
+		if sc == "blockbook/multisig" {
+			// the wallets are given as wallet:token, the feed is sent only to the holders of the token of the wallet
+			for _, w := range addrs {
+				i := strings.IndexByte(w, ':')
+				if i < 0 {
+					onError(c.Id(), sc, "invalid data", "expecting wallet:token")
+					return nil
+				}
+				if !s.db.ValidMultisigWalletToken(w[:i], w[i+1:]) {
+					// the token is not logged
+					onError(c.Id(), sc, "invalid wallet or token", "wallet "+w[:i])
+					return nil
+				}
+			}
+			for _, w := range addrs {
+				c.Join("blockbook/multisig-" + w)
+			}
+			s.metrics.SocketIOSubscribes.With(common.Labels{"channel": sc, "status": "success"}).Inc()
+			return nil
+		}
 		// normalize the addresses to AddressDescriptor
 		descs := make([]bchain.AddressDescriptor, len(addrs))
 		for i, a := range addrs {
@@ -703,8 +745,8 @@ func (s *SocketIoServer) onSubscribe(c *gosocketio.Channel, req []byte) interfac
 		}
 	} else {
 		sc = r[1 : len(r)-1]
-		if sc != "bitcoind/hashblock" {
-			onError(c.Id(), sc, "invalid data", "expecting bitcoind/hashblock, req: "+r)
+		if sc != "bitcoind/hashblock" && sc != "blockbook/spentoutpoint" && sc != "blockbook/mempooleviction" {
+			onError(c.Id(), sc, "invalid data", "expecting bitcoind/hashblock, blockbook/spentoutpoint or blockbook/mempooleviction, req: "+r)
 			return nil
 		}
 		c.Join(sc)
@@ -713,12 +755,71 @@ func (s *SocketIoServer) onSubscribe(c *gosocketio.Channel, req []byte) interfac
 	return nil
 }
 
+// broadcastTo sends the notification with the screened addresses to the room, it returns the number of notified channels
+func (s *SocketIoServer) broadcastTo(room, method string, data interface{}) int {
+	data, err := screenData(s.screener, data)
+	if err != nil {
+		glog.Error("broadcast ", method, ": ", err)
+		return 0
+	}
+	return s.server.BroadcastTo(room, method, data)
+}
+
 // OnNewBlockHash notifies users subscribed to bitcoind/hashblock about new block
 func (s *SocketIoServer) OnNewBlockHash(hash string) {
-	c := s.server.BroadcastTo("bitcoind/hashblock", "bitcoind/hashblock", hash)
+	c := s.broadcastTo("bitcoind/hashblock", "bitcoind/hashblock", hash)
 	glog.Info("broadcasting new block hash ", hash, " to ", c, " channels")
 }
 
+// OnWatchedOutpointSpent notifies users subscribed to blockbook/spentoutpoint about spent watched outpoints
+func (s *SocketIoServer) OnWatchedOutpointSpent(spent []db.WatchedOutpointSpent) {
+	for i := range spent {
+		n := newSpentOutpointNotification(&spent[i], s.chainParser)
+		// the labels are private to the operator, they are sent only to the webhooks
+		n.Label = ""
+		c := s.broadcastTo("blockbook/spentoutpoint", "blockbook/spentoutpoint", n)
+		glog.Info("broadcasting spent outpoint ", spent[i].Txid, ":", spent[i].Vout, " to ", c, " channels")
+	}
+}
+
+// OnMultisigEvents notifies users subscribed to blockbook/multisig of the wallet about its new events
+func (s *SocketIoServer) OnMultisigEvents(events []db.MultisigEvent) {
+	for i := range events {
+		e := &events[i]
+		c := s.broadcastTo("blockbook/multisig-"+e.Wallet+":"+e.Token, "blockbook/multisig", e)
+		if c > 0 {
+			glog.Info("broadcasting multisig event ", e.Type, " ", e.Txid, " of wallet ", e.Wallet, " to ", c, " channels")
+		}
+	}
+}
+
+// OnMempoolEviction notifies users subscribed to blockbook/mempooleviction about all transactions removed
+// from the mempool without being confirmed, users subscribed to bitcoind/addresstxid receive the event
+// blockbook/mempooleviction about the transactions of their addresses
+func (s *SocketIoServer) OnMempoolEviction(evictions []bchain.MempoolEviction) {
+	for i := range evictions {
+		e := &evictions[i]
+		c := s.broadcastTo("blockbook/mempooleviction", "blockbook/mempooleviction", e)
+		glog.Info("broadcasting mempool eviction of ", e.Txid, ", reason ", e.Reason, " to ", c, " channels")
+		notified := make(map[string]struct{}, len(e.AddrDescs))
+		for _, desc := range e.AddrDescs {
+			if _, found := notified[string(desc)]; found {
+				continue
+			}
+			notified[string(desc)] = struct{}{}
+			addr, searchable, err := s.chainParser.GetAddressesFromAddrDesc(desc)
+			if err != nil || !searchable || len(addr) != 1 {
+				continue
+			}
+			data := map[string]interface{}{"address": addr[0], "txid": e.Txid, "reason": e.Reason}
+			if e.ReplacedBy != "" {
+				data["replacedBy"] = e.ReplacedBy
+			}
+			s.broadcastTo("bitcoind/addresstxid-"+string(desc), "blockbook/mempooleviction", data)
+		}
+	}
+}
+
 // OnNewTxAddr notifies users subscribed to bitcoind/addresstxid about new block
 func (s *SocketIoServer) OnNewTxAddr(txid string, desc bchain.AddressDescriptor, isOutput bool) {
 	addr, searchable, err := s.chainParser.GetAddressesFromAddrDesc(desc)
@@ -729,7 +830,7 @@ func (s *SocketIoServer) OnNewTxAddr(txid string, desc bchain.AddressDescriptor,
 		if !isOutput {
 			data["input"] = true
 		}
-		c := s.server.BroadcastTo("bitcoind/addresstxid-"+string(desc), "bitcoind/addresstxid", data)
+		c := s.broadcastTo("bitcoind/addresstxid-"+string(desc), "bitcoind/addresstxid", data)
 		if c > 0 {
 			glog.Info("broadcasting new txid ", txid, " for addr ", addr[0], " to ", c, " channels")
 		}
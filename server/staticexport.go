@@ -0,0 +1,587 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+const (
+	// DefaultStaticExportDepth is the number of the confirmations of the block, after which it is exported
+	DefaultStaticExportDepth = 100
+	// staticExportStateFile is the file of the destination with the progress of the export
+	staticExportStateFile = "state.json"
+	// sitemapBlocks is the number of the blocks in one sitemap file, the sitemaps are limited to 50000 urls
+	sitemapBlocks = 10000
+	// sitemapIndexFile is the sitemap index listing the sitemap files of the blocks
+	sitemapIndexFile = "sitemap.xml"
+)
+
+// staticMutableFields are the fields of the exported transactions and blocks, which change after the export,
+// staticMutableVoutFields the fields of their outputs; they are not exported, the clients get them from the api
+var (
+	staticMutableFields     = []string{"confirmations", "nextblockhash"}
+	staticMutableVoutFields = []string{"spent", "spentTxId", "spentIndex", "spentHeight"}
+)
+
+// StaticStore is the destination of the exported static files, the names are relative paths separated by /
+type StaticStore interface {
+	// Get returns the content of the file, nil if the file does not exist
+	Get(name string) ([]byte, error)
+	Put(name string, content []byte) error
+	// Delete removes the file, it is not an error if the file does not exist
+	Delete(name string) error
+}
+
+// dirStaticStore stores the files in a directory, the files are replaced atomically
+type dirStaticStore struct {
+	dir string
+}
+
+func (s *dirStaticStore) Get(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (s *dirStaticStore) Put(name string, content []byte) error {
+	p := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *dirStaticStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// httpStaticStore uploads the files by http PUT to the base url, e.g. to a bucket of a CDN,
+// the credentials can be given as the user info of the url (basic auth)
+type httpStaticStore struct {
+	base   string
+	client *http.Client
+}
+
+func (s *httpStaticStore) Get(name string) ([]byte, error) {
+	res, err := s.client.Get(s.base + name)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %v: status %v", name, res.StatusCode)
+	}
+	return b, nil
+}
+
+func (s *httpStaticStore) Put(name string, content []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.base+name, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(name, ".xml") {
+		req.Header.Set("Content-Type", "application/xml")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode/100 != 2 {
+		return errors.Errorf("PUT %v: status %v, %v", name, res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+func (s *httpStaticStore) Delete(name string) error {
+	req, err := http.NewRequest(http.MethodDelete, s.base+name, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode/100 != 2 && res.StatusCode != http.StatusNotFound {
+		return errors.Errorf("DELETE %v: status %v, %v", name, res.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// NewStaticStore returns the store uploading to the url (starting by http:// or https://) or writing to the directory
+func NewStaticStore(destination string) (StaticStore, error) {
+	if strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://") {
+		if !strings.HasSuffix(destination, "/") {
+			destination += "/"
+		}
+		return &httpStaticStore{base: destination, client: &http.Client{Timeout: 60 * time.Second}}, nil
+	}
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return nil, err
+	}
+	return &dirStaticStore{dir: destination}, nil
+}
+
+// staticBlockHeight maps the height to the hash of the exported block
+type staticBlockHeight struct {
+	Height uint32 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// staticExportState is the progress of the export, Height is the last exported block, SitemapHeight the last block
+// of the last complete sitemap file
+type staticExportState struct {
+	FromHeight    uint32 `json:"fromHeight"`
+	Height        uint32 `json:"height"`
+	Hash          string `json:"hash"`
+	SitemapHeight int64  `json:"sitemapHeight"`
+}
+
+// StaticExporter pre-renders the public API responses of the blocks with at least depth confirmations and of their transactions
+// without the fields, which change after the export, as static json files in the store, so that they can be served by a web server
+// or a CDN without a request to blockbook; the files of the blocks replaced by a reorg deeper than the depth are removed
+// and the export continues by the blocks replacing them; optionally it keeps the sitemaps of the block pages of the explorer
+type StaticExporter struct {
+	s          *PublicServer
+	store      StaticStore
+	depth      uint32
+	from       int
+	sitemapURL string
+	state      *staticExportState
+	chanRun    chan struct{}
+	done       chan struct{}
+	closing    int32
+	once       sync.Once
+}
+
+// NewStaticExporter creates the exporter of the data of the public server to the store, the blocks are exported when they have depth
+// confirmations; if nothing was exported yet, the export starts at the height from, or at the first block with depth confirmations
+// if from is negative. If sitemapURL (the public url of the explorer) is set, the sitemaps of the block pages are written too.
+func NewStaticExporter(s *PublicServer, store StaticStore, depth uint32, from int, sitemapURL string) (*StaticExporter, error) {
+	if depth == 0 {
+		return nil, errors.New("The depth of the static export must be positive")
+	}
+	if sitemapURL != "" && !strings.HasSuffix(sitemapURL, "/") {
+		sitemapURL += "/"
+	}
+	e := &StaticExporter{
+		s:          s,
+		store:      store,
+		depth:      depth,
+		from:       from,
+		sitemapURL: sitemapURL,
+		chanRun:    make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	b, err := store.Get(staticExportStateFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "static export state")
+	}
+	if b != nil {
+		e.state = &staticExportState{}
+		if err = json.Unmarshal(b, e.state); err != nil {
+			return nil, errors.Annotatef(err, "static export state")
+		}
+		glog.Info("staticexport: exported blocks ", e.state.FromHeight, "-", e.state.Height)
+	}
+	return e, nil
+}
+
+// Run exports the blocks each time it is notified by Export, until Close is called
+func (e *StaticExporter) Run() {
+	defer close(e.done)
+	glog.Info("staticexport: starting, depth ", e.depth)
+	for range e.chanRun {
+		if err := e.export(); err != nil {
+			glog.Error("staticexport: ", err)
+		}
+	}
+	glog.Info("staticexport: stopped")
+}
+
+// Export notifies the exporter that new blocks were connected, it does not block
+func (e *StaticExporter) Export() {
+	select {
+	case e.chanRun <- struct{}{}:
+	default:
+	}
+}
+
+// OnNewBlock is the callback invoked after a new block is connected
+func (e *StaticExporter) OnNewBlock(hash string, height uint32) {
+	e.Export()
+}
+
+// Close stops the exporter and waits for the finish of the running export
+func (e *StaticExporter) Close() {
+	e.once.Do(func() {
+		atomic.StoreInt32(&e.closing, 1)
+		close(e.chanRun)
+		<-e.done
+	})
+}
+
+// putJSON stores the value in the form returned by the public API, screened by the address screener
+func (e *StaticExporter) putJSON(name string, v interface{}) error {
+	data, err := screenData(e.s.screener, v)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return e.store.Put(name, append(b, '\n'))
+}
+
+// putStaticJSON stores the transaction or the block like putJSON, without the fields, which change after the export
+func (e *StaticExporter) putStaticJSON(name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	// keep the numbers exactly as they were encoded
+	d.UseNumber()
+	var data interface{}
+	if err = d.Decode(&data); err != nil {
+		return err
+	}
+	stripMutableFields(data)
+	return e.putJSON(name, data)
+}
+
+// stripMutableFields removes the fields, which change after the export, from the decoded transaction or block and its transactions
+func stripMutableFields(v interface{}) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, f := range staticMutableFields {
+		delete(m, f)
+	}
+	if vout, ok := m["vout"].([]interface{}); ok {
+		for _, o := range vout {
+			if o, ok := o.(map[string]interface{}); ok {
+				for _, f := range staticMutableVoutFields {
+					delete(o, f)
+				}
+			}
+		}
+	}
+	if txs, ok := m["txs"].([]interface{}); ok {
+		for _, tx := range txs {
+			stripMutableFields(tx)
+		}
+	}
+}
+
+func (e *StaticExporter) saveState() error {
+	b, err := json.Marshal(e.state)
+	if err != nil {
+		return err
+	}
+	return e.store.Put(staticExportStateFile, b)
+}
+
+func (e *StaticExporter) export() error {
+	bestHeight, err := e.s.db.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	if bestHeight+1 < e.depth {
+		return nil
+	}
+	// the block with depth confirmations
+	last := bestHeight + 1 - e.depth
+	var height uint32
+	if e.state != nil {
+		height = e.state.Height + 1
+		// the exported data are no longer valid if the last exported block was disconnected
+		bi, err := e.s.db.GetBlockInfo(e.state.Height)
+		if err != nil {
+			return err
+		}
+		if bi != nil && bi.Hash != e.state.Hash {
+			glog.Warning("staticexport: exported block ", e.state.Height, " ", e.state.Hash, " was replaced by ", bi.Hash, ", reorg deeper than the depth of the export")
+			if height, err = e.rollback(); err != nil {
+				return errors.Annotatef(err, "rollback")
+			}
+		}
+	} else if e.from >= 0 {
+		height = uint32(e.from)
+	} else {
+		height = last
+	}
+	for ; height <= last; height++ {
+		if atomic.LoadInt32(&e.closing) != 0 {
+			return nil
+		}
+		hash, err := e.exportBlock(height)
+		if err != nil {
+			return errors.Annotatef(err, "block %d", height)
+		}
+		if e.state == nil {
+			e.state = &staticExportState{FromHeight: height, SitemapHeight: -1}
+		}
+		e.state.Height = height
+		e.state.Hash = hash
+		if err = e.saveState(); err != nil {
+			return err
+		}
+		if e.s.metrics != nil {
+			e.s.metrics.StaticExportHeight.Set(float64(height))
+		}
+	}
+	if e.sitemapURL != "" && e.state != nil {
+		return e.exportSitemaps(e.state.Height)
+	}
+	return nil
+}
+
+// exportBlock stores all pages of the block and its transactions, it returns the hash of the block
+func (e *StaticExporter) exportBlock(height uint32) (string, error) {
+	start := time.Now()
+	hash, err := e.s.db.GetBlockHash(height)
+	if err != nil {
+		return "", err
+	}
+	if hash == "" {
+		return "", errors.New("Block not found")
+	}
+	txs := 0
+	for page, pages := 1, 1; page <= pages; page++ {
+		b, err := e.s.api.GetBlock(hash, page, txsInAPI)
+		if err != nil {
+			return "", err
+		}
+		pages = b.TotalPages
+		for _, t := range b.Transactions {
+			tx, err := e.s.api.GetTransaction(t.Txid, false)
+			if err != nil {
+				return "", errors.Annotatef(err, "tx %v", t.Txid)
+			}
+			if err = e.putStaticJSON("tx/"+t.Txid+".json", tx); err != nil {
+				return "", err
+			}
+			txs++
+		}
+		if err = e.putStaticJSON(fmt.Sprintf("block/%s/%d.json", hash, page), b); err != nil {
+			return "", err
+		}
+	}
+	// the index of the heights is written last, the block is complete when it is present
+	if err = e.putJSON(fmt.Sprintf("block-height/%d.json", height), &staticBlockHeight{Height: height, Hash: hash}); err != nil {
+		return "", err
+	}
+	glog.V(1).Info("staticexport: block ", height, " ", hash, ", ", txs, " txs exported in ", time.Since(start))
+	return hash, nil
+}
+
+// rollback removes the files of the exported blocks replaced by a reorg - their pages, transactions and heights - from the last
+// exported block down to the last block, which is still in the chain, and returns the height, from which the export continues.
+// The state is moved to the last block still in the chain and the sitemaps containing the replaced blocks are written again.
+func (e *StaticExporter) rollback() (uint32, error) {
+	h := e.state.Height
+	var hash string
+	for {
+		var err error
+		if hash, err = e.s.db.GetBlockHash(h); err != nil {
+			return 0, err
+		}
+		exported, err := e.exportedBlockHash(h)
+		if err != nil {
+			return 0, err
+		}
+		if exported != "" && exported == hash {
+			break
+		}
+		// the height is removed first, the block is not complete without it
+		if err = e.store.Delete(fmt.Sprintf("block-height/%d.json", h)); err != nil {
+			return 0, err
+		}
+		if exported != "" {
+			if err = e.removeBlock(exported); err != nil {
+				return 0, errors.Annotatef(err, "block %d %v", h, exported)
+			}
+		}
+		glog.Info("staticexport: removed replaced block ", h, " ", exported)
+		if h == e.state.FromHeight {
+			// all exported blocks were replaced, the state is kept until the first block is exported again
+			return h, nil
+		}
+		h--
+	}
+	if last := int64(h/sitemapBlocks*sitemapBlocks) - 1; e.state.SitemapHeight > last {
+		e.state.SitemapHeight = last
+	}
+	e.state.Height = h
+	e.state.Hash = hash
+	if err := e.saveState(); err != nil {
+		return 0, err
+	}
+	return h + 1, nil
+}
+
+// exportedBlockHash returns the hash of the block exported at the height, empty string if the block is not exported
+func (e *StaticExporter) exportedBlockHash(height uint32) (string, error) {
+	b, err := e.store.Get(fmt.Sprintf("block-height/%d.json", height))
+	if err != nil || b == nil {
+		return "", err
+	}
+	var bh staticBlockHeight
+	if err = json.Unmarshal(b, &bh); err != nil {
+		return "", errors.Annotatef(err, "block-height/%d.json", height)
+	}
+	return bh.Hash, nil
+}
+
+// removeBlock removes the exported pages of the block and the exported files of its transactions, the pages are removed
+// from the last one, the first page with the number of the pages is removed last, so that an interrupted removal can be repeated
+func (e *StaticExporter) removeBlock(hash string) error {
+	type blockPage struct {
+		TotalPages int `json:"totalPages"`
+		Txs        []struct {
+			Txid string `json:"txid"`
+		} `json:"txs"`
+	}
+	getPage := func(p int) (*blockPage, error) {
+		name := fmt.Sprintf("block/%s/%d.json", hash, p)
+		b, err := e.store.Get(name)
+		if err != nil || b == nil {
+			return nil, err
+		}
+		var page blockPage
+		if err = json.Unmarshal(b, &page); err != nil {
+			return nil, errors.Annotatef(err, "%v", name)
+		}
+		return &page, nil
+	}
+	first, err := getPage(1)
+	if err != nil || first == nil {
+		return err
+	}
+	pages := first.TotalPages
+	if pages < 1 {
+		pages = 1
+	}
+	for p := pages; p >= 1; p-- {
+		page := first
+		if p > 1 {
+			if page, err = getPage(p); err != nil {
+				return err
+			}
+			// the page was already removed
+			if page == nil {
+				continue
+			}
+		}
+		for _, tx := range page.Txs {
+			if err = e.store.Delete("tx/" + tx.Txid + ".json"); err != nil {
+				return err
+			}
+		}
+		if err = e.store.Delete(fmt.Sprintf("block/%s/%d.json", hash, p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+func putXML(store StaticStore, name string, v interface{}) error {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return store.Put(name, append([]byte(xml.Header), b...))
+}
+
+// exportSitemaps writes the sitemaps of the block pages of the explorer up to the height, each sitemap file contains sitemapBlocks blocks,
+// the complete files are written only once, the last incomplete file at each call; the sitemap index lists all files
+func (e *StaticExporter) exportSitemaps(height uint32) error {
+	files := int(height/sitemapBlocks) + 1
+	for f := int(e.state.SitemapHeight+1) / sitemapBlocks; f < files; f++ {
+		if atomic.LoadInt32(&e.closing) != 0 {
+			return nil
+		}
+		from := uint32(f) * sitemapBlocks
+		to := from + sitemapBlocks - 1
+		if to > height {
+			to = height
+		}
+		set := sitemapURLSet{URLs: make([]sitemapURL, 0, to-from+1)}
+		for h := from; h <= to; h++ {
+			hash, err := e.s.db.GetBlockHash(h)
+			if err != nil {
+				return err
+			}
+			if hash != "" {
+				set.URLs = append(set.URLs, sitemapURL{Loc: e.sitemapURL + "block/" + hash})
+			}
+		}
+		if err := putXML(e.store, fmt.Sprintf("sitemap/blocks-%d.xml", f), &set); err != nil {
+			return err
+		}
+		if to == from+sitemapBlocks-1 {
+			e.state.SitemapHeight = int64(to)
+			if err := e.saveState(); err != nil {
+				return err
+			}
+		}
+	}
+	index := sitemapIndex{Sitemaps: make([]sitemapURL, files)}
+	for f := range index.Sitemaps {
+		index.Sitemaps[f].Loc = fmt.Sprintf("%ssitemap/blocks-%d.xml", e.sitemapURL, f)
+	}
+	return putXML(e.store, sitemapIndexFile, &index)
+}
@@ -0,0 +1,258 @@
+// +build unittest
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testStaticStore(t *testing.T, store StaticStore) {
+	b, err := store.Get("block-height/1.json")
+	if err != nil || b != nil {
+		t.Fatalf("Get() of missing file = %q, %v, want nil", b, err)
+	}
+	if err = store.Put("block-height/1.json", []byte(`{"height":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put("block-height/1.json", []byte(`{"height":1,"hash":"00"}`)); err != nil {
+		t.Fatal(err)
+	}
+	b, err = store.Get("block-height/1.json")
+	if err != nil || string(b) != `{"height":1,"hash":"00"}` {
+		t.Errorf("Get() = %q, %v", b, err)
+	}
+	if err = store.Put("block-height/2.json", []byte(`{"height":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete("block-height/2.json"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = store.Get("block-height/2.json"); err != nil || b != nil {
+		t.Errorf("Get() of deleted file = %q, %v, want nil", b, err)
+	}
+	// the missing file is not an error
+	if err = store.Delete("block-height/2.json"); err != nil {
+		t.Errorf("Delete() of missing file = %v", err)
+	}
+}
+
+func TestDirStaticStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staticexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStaticStore(filepath.Join(dir, "static"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*dirStaticStore); !ok {
+		t.Fatalf("NewStaticStore() = %T, want *dirStaticStore", store)
+	}
+	testStaticStore(t, store)
+	// no temporary file is left
+	files, err := ioutil.ReadDir(filepath.Join(dir, "static", "block-height"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "1.json" {
+		t.Errorf("files %v, want only 1.json", files)
+	}
+}
+
+func TestHTTPStaticStore(t *testing.T) {
+	var mux sync.Mutex
+	files := make(map[string][]byte)
+	types := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		switch r.Method {
+		case http.MethodGet:
+			b, found := files[name]
+			if !found {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(b)
+		case http.MethodPut:
+			b, _ := ioutil.ReadAll(r.Body)
+			files[name] = b
+			types[name] = r.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			if _, found := files[name]; !found {
+				http.NotFound(w, r)
+				return
+			}
+			delete(files, name)
+			delete(types, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+	store, err := NewStaticStore(strings.Replace(ts.URL, "http://", "http://user:secret@", 1) + "/bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*httpStaticStore); !ok {
+		t.Fatalf("NewStaticStore() = %T, want *httpStaticStore", store)
+	}
+	testStaticStore(t, store)
+	if err = putXML(store, sitemapIndexFile, &sitemapIndex{Sitemaps: []sitemapURL{{Loc: "https://explorer/sitemap/blocks-0.xml"}}}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"block-height/1.json": "application/json", "sitemap.xml": "application/xml"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("content types %v, want %v", types, want)
+	}
+	wantXML := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>https://explorer/sitemap/blocks-0.xml</loc></sitemap></sitemapindex>`
+	if string(files["sitemap.xml"]) != wantXML {
+		t.Errorf("sitemap.xml = %s, want %s", files["sitemap.xml"], wantXML)
+	}
+	// wrong credentials
+	store, _ = NewStaticStore(ts.URL + "/bucket/")
+	if err = store.Put("tx/00.json", []byte("{}")); err == nil {
+		t.Error("Put() without credentials expected error")
+	}
+}
+
+func TestNewStaticExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staticexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStaticStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewStaticExporter(nil, store, 0, -1, ""); err == nil {
+		t.Error("NewStaticExporter() with zero depth expected error")
+	}
+	e, err := NewStaticExporter(nil, store, 10, -1, "https://explorer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.state != nil || e.sitemapURL != "https://explorer/" {
+		t.Errorf("NewStaticExporter() state %+v, sitemapURL %v", e.state, e.sitemapURL)
+	}
+	e.state = &staticExportState{FromHeight: 100, Height: 120, Hash: "0000abcd", SitemapHeight: -1}
+	if err = e.saveState(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewStaticExporter(nil, store, 10, -1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.state, e.state) {
+		t.Errorf("NewStaticExporter() state %+v, want %+v", got.state, e.state)
+	}
+	if err = store.Put(staticExportStateFile, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewStaticExporter(nil, store, 10, -1, ""); err == nil {
+		t.Error("NewStaticExporter() with invalid state expected error")
+	}
+}
+
+func TestStripMutableFields(t *testing.T) {
+	tx := func() map[string]interface{} {
+		return map[string]interface{}{
+			"txid":          "00ab",
+			"confirmations": 120,
+			"blockheight":   100,
+			"vout": []interface{}{
+				map[string]interface{}{"n": 0, "value": "1", "spent": true, "spentTxId": "00cd", "spentIndex": 1, "spentHeight": 110},
+				map[string]interface{}{"n": 1, "value": "2", "spent": false},
+			},
+		}
+	}
+	stripped := func() map[string]interface{} {
+		return map[string]interface{}{
+			"txid":        "00ab",
+			"blockheight": 100,
+			"vout": []interface{}{
+				map[string]interface{}{"n": 0, "value": "1"},
+				map[string]interface{}{"n": 1, "value": "2"},
+			},
+		}
+	}
+	got := tx()
+	stripMutableFields(got)
+	if !reflect.DeepEqual(got, stripped()) {
+		t.Errorf("stripMutableFields(tx) = %v, want %v", got, stripped())
+	}
+	block := map[string]interface{}{"hash": "00ef", "previousblockhash": "00ee", "nextblockhash": "00f0", "confirmations": 120, "txs": []interface{}{tx()}}
+	stripMutableFields(block)
+	want := map[string]interface{}{"hash": "00ef", "previousblockhash": "00ee", "txs": []interface{}{stripped()}}
+	if !reflect.DeepEqual(block, want) {
+		t.Errorf("stripMutableFields(block) = %v, want %v", block, want)
+	}
+}
+
+func TestStaticExporter_removeBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staticexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStaticStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &StaticExporter{store: store}
+	for name, content := range map[string]string{
+		"block/00aa/1.json":   `{"page":1,"totalPages":2,"txs":[{"txid":"01"},{"txid":"02"}]}`,
+		"block/00aa/2.json":   `{"page":2,"totalPages":2,"txs":[{"txid":"03"}]}`,
+		"block/00bb/1.json":   `{"page":1,"totalPages":1,"txs":[{"txid":"04"}]}`,
+		"block-height/5.json": `{"height":5,"hash":"00aa"}`,
+		"tx/01.json":          `{}`,
+		"tx/03.json":          `{}`,
+		"tx/04.json":          `{}`,
+	} {
+		if err = store.Put(name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hash, err := e.exportedBlockHash(5); err != nil || hash != "00aa" {
+		t.Errorf("exportedBlockHash(5) = %v, %v", hash, err)
+	}
+	if hash, err := e.exportedBlockHash(6); err != nil || hash != "" {
+		t.Errorf("exportedBlockHash(6) = %v, %v", hash, err)
+	}
+	// the missing transaction file 02 is not an error
+	if err = e.removeBlock("00aa"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"block/00aa/1.json": false,
+		"block/00aa/2.json": false,
+		"tx/01.json":        false,
+		"tx/03.json":        false,
+		"block/00bb/1.json": true,
+		"tx/04.json":        true,
+	} {
+		if b, err := store.Get(name); err != nil || (b != nil) != want {
+			t.Errorf("%v exists %v, %v, want %v", name, b != nil, err, want)
+		}
+	}
+	// the removal of the removed block does nothing
+	if err = e.removeBlock("00aa"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"blockbook/api"
+	"blockbook/bchain"
+	"blockbook/common"
+	"blockbook/db"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// maxWalletAccountBody is the maximum size of the registered wallet account
+const maxWalletAccountBody = 64 * 1024
+
+// walletAccounts lists (GET) the registered wallet accounts, registers or updates (POST with the account as json in the body)
+// or removes (DELETE with the parameter name) a wallet account
+func (s *InternalServer) walletAccounts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		accounts, err := s.db.GetWalletAccounts()
+		if err != nil {
+			glog.Error("internal server: wallet accounts: ", err)
+			http.Error(w, fmt.Sprintf("Wallet accounts failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.writeJSON(w, accounts)
+	case http.MethodPost:
+		var a db.WalletAccount
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxWalletAccountBody)).Decode(&a); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid wallet account: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := s.db.RegisterWalletAccount(&a); err != nil {
+			if err == bchain.ErrNotSupported {
+				http.Error(w, "Wallet accounts are not supported by the coin", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Invalid wallet account '%v': %v", a.Name, err), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("internal server: wallet account %v registered, %d descriptors, gap %d", a.Name, len(a.Descriptors), a.Gap)
+		s.writeJSON(w, &a)
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "Missing parameter 'name'", http.StatusBadRequest)
+			return
+		}
+		removed, err := s.db.UnregisterWalletAccount(name)
+		if err != nil {
+			glog.Error("internal server: wallet account ", name, ": ", err)
+			http.Error(w, fmt.Sprintf("Removal of wallet account '%v' failed: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, fmt.Sprintf("Wallet account '%v' is not registered", name), http.StatusNotFound)
+			return
+		}
+		glog.Info("internal server: wallet account ", name, " removed")
+		accounts, err := s.db.GetWalletAccounts()
+		if err != nil {
+			glog.Error("internal server: wallet accounts: ", err)
+			http.Error(w, fmt.Sprintf("Wallet accounts failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.writeJSON(w, accounts)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// walletAccountName returns the name of the wallet account given in the path of the request
+func walletAccountName(r *http.Request, route string) (string, error) {
+	var name string
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		name = r.URL.Path[i+1:]
+	}
+	if name == "" {
+		return "", api.NewApiError(fmt.Sprintf("Missing account, expecting %v<account>", route), true)
+	}
+	return name, nil
+}
+
+// apiWalletAccount returns the balances, the breakdown by descriptor and one page of the merged history of the wallet account
+// given in path, parameters token (the token of the account) and page
+func (s *PublicServer) apiWalletAccount(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-account"}).Inc()
+	name, err := walletAccountName(r, "api/account/")
+	if err != nil {
+		return nil, err
+	}
+	q := r.URL.Query()
+	page, ec := strconv.Atoi(q.Get("page"))
+	if ec != nil {
+		page = 0
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetWalletAccount(name, q.Get("token"), page, txsInAPI, true)
+}
+
+// apiWalletAccountUtxo returns the unspent outputs of all descriptors of the wallet account given in path, parameter token
+func (s *PublicServer) apiWalletAccountUtxo(r *http.Request) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-account-utxo"}).Inc()
+	name, err := walletAccountName(r, "api/account-utxo/")
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.getWorker(r)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetWalletAccountUtxo(name, r.URL.Query().Get("token"))
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// a failed webhook is retried webhookRetries times, the delay before the retry doubles with every attempt
+const webhookRetries = 5
+const webhookRetryDelay = 2 * time.Second
+
+// SpentOutpointNotification is sent to the subscribers of blockbook/spentoutpoint and to the webhooks of watched outpoints
+type SpentOutpointNotification struct {
+	Txid         string `json:"txid"`
+	Vout         uint32 `json:"vout"`
+	Label        string `json:"label,omitempty"`
+	Value        string `json:"value"`
+	SpendingTxid string `json:"spendingTxid"`
+	Vin          int    `json:"vin"`
+	Height       uint32 `json:"height"`
+}
+
+func newSpentOutpointNotification(s *db.WatchedOutpointSpent, parser bchain.BlockChainParser) *SpentOutpointNotification {
+	return &SpentOutpointNotification{
+		Txid:         s.Txid,
+		Vout:         s.Vout,
+		Label:        s.Label,
+		Value:        parser.AmountToDecimalString(&s.ValueSat),
+		SpendingTxid: s.SpendingTxid,
+		Vin:          s.Vin,
+		Height:       s.Height,
+	}
+}
+
+// AddressActivityNotification is POSTed to the webhooks of watched addresses
+type AddressActivityNotification struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+	Txid    string `json:"txid"`
+	Height  uint32 `json:"height"`
+}
+
+// WebhookNotifier posts notifications about spent watched outpoints and transactions of watched addresses to their webhooks
+type WebhookNotifier struct {
+	client      *http.Client
+	chainParser bchain.BlockChainParser
+	retryDelay  time.Duration
+}
+
+// NewWebhookNotifier creates new WebhookNotifier
+func NewWebhookNotifier(parser bchain.BlockChainParser) *WebhookNotifier {
+	return &WebhookNotifier{
+		client:      &http.Client{Timeout: webhookTimeout},
+		chainParser: parser,
+		retryDelay:  webhookRetryDelay,
+	}
+}
+
+// OnWatchedOutpointSpent posts the notifications asynchronously, so that the sync is not blocked by slow webhooks
+func (n *WebhookNotifier) OnWatchedOutpointSpent(spent []db.WatchedOutpointSpent) {
+	for i := range spent {
+		if spent[i].Webhook == "" {
+			continue
+		}
+		data, err := json.Marshal(newSpentOutpointNotification(&spent[i], n.chainParser))
+		if err != nil {
+			glog.Error("webhook: ", err)
+			continue
+		}
+		go n.post(spent[i].Webhook, data)
+	}
+}
+
+// OnWatchedAddressActivity posts the notifications asynchronously, so that the sync is not blocked by slow webhooks
+func (n *WebhookNotifier) OnWatchedAddressActivity(activity []db.WatchedAddressActivity) {
+	for i := range activity {
+		if activity[i].Webhook == "" {
+			continue
+		}
+		data, err := json.Marshal(&AddressActivityNotification{
+			Address: activity[i].Address,
+			Label:   activity[i].Label,
+			Txid:    activity[i].Txid,
+			Height:  activity[i].Height,
+		})
+		if err != nil {
+			glog.Error("webhook: ", err)
+			continue
+		}
+		go n.post(activity[i].Webhook, data)
+	}
+}
+
+// post posts the data to the webhook, the failed attempt is retried with increasing delay
+// unless the webhook rejects the data by a client error status
+func (n *WebhookNotifier) post(url string, data []byte) bool {
+	delay := n.retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := n.postOnce(url, data)
+		if err == nil {
+			return true
+		}
+		if !retry || attempt >= webhookRetries {
+			glog.Error("webhook: ", url, " ", err, ", giving up after ", attempt+1, " attempts")
+			return false
+		}
+		glog.Warning("webhook: ", url, " ", err, ", retrying in ", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (n *WebhookNotifier) postOnce(url string, data []byte) (bool, error) {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+		return retry, errors.Errorf("returned status %d", resp.StatusCode)
+	}
+	return false, nil
+}
@@ -0,0 +1,46 @@
+// +build unittest
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier_post(t *testing.T) {
+	var calls int32
+	statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(statuses[int(c-1)%len(statuses)])
+	}))
+	defer ts.Close()
+	n := &WebhookNotifier{client: &http.Client{Timeout: time.Second}, retryDelay: time.Millisecond}
+
+	if !n.post(ts.URL+"/hook", []byte("{}")) {
+		t.Error("post() = false, want true after retries")
+	}
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("post() made %d attempts, want 3", c)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if n.post(ts.URL+"/reject", []byte("{}")) {
+		t.Error("post() to rejecting webhook = true, want false")
+	}
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("post() to rejecting webhook made %d attempts, want 1", c)
+	}
+
+	ts.Close()
+	if n.post(ts.URL+"/hook", []byte("{}")) {
+		t.Error("post() to closed server = true, want false")
+	}
+}
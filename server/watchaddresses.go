@@ -0,0 +1,283 @@
+package server
+
+import (
+	"blockbook/bchain"
+	"blockbook/db"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// watchImportBatch is the number of addresses written to the db in one batch during import
+	watchImportBatch = 10000
+	// maxWatchImportErrors is the maximum number of reported invalid lines of the import
+	maxWatchImportErrors = 100
+	// maxWatchImportLine is the maximum length of a line of the imported file
+	maxWatchImportLine = 64 * 1024
+)
+
+// watchImportError describes an invalid line of the imported address list
+type watchImportError struct {
+	Line    int    `json:"line"`
+	Address string `json:"address,omitempty"`
+	Error   string `json:"error"`
+}
+
+// watchImportResult is the result of the import or removal of watched addresses
+type watchImportResult struct {
+	Processed int                `json:"processed"`
+	Invalid   int                `json:"invalid"`
+	Errors    []watchImportError `json:"errors,omitempty"`
+	Watched   int                `json:"watched"`
+}
+
+func validWebhook(webhook string) bool {
+	u, err := url.Parse(webhook)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// lineError is an error of a single line of the imported list, the import continues with the next line
+type lineError struct {
+	err error
+}
+
+func (e *lineError) Error() string {
+	return e.err.Error()
+}
+
+// watchAddressReader reads the watched addresses from CSV or JSONL stream
+type watchAddressReader interface {
+	// read returns the next address and the line of the stream, *lineError for an invalid line and io.EOF at the end of the stream
+	read() (*db.WatchedAddress, int, error)
+}
+
+// csvWatchAddressReader reads lines in format address[,label[,webhook]], optionally with a header line
+// the fields can be quoted, however they cannot span multiple lines
+type csvWatchAddressReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newCsvWatchAddressReader(r io.Reader) *csvWatchAddressReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 4096), maxWatchImportLine)
+	return &csvWatchAddressReader{s: s}
+}
+
+func (c *csvWatchAddressReader) read() (*db.WatchedAddress, int, error) {
+	for c.s.Scan() {
+		c.line++
+		l := strings.TrimSpace(c.s.Text())
+		if len(l) == 0 || l[0] == '#' {
+			continue
+		}
+		rec, err := csv.NewReader(strings.NewReader(l)).Read()
+		if err != nil {
+			if pe, ok := err.(*csv.ParseError); ok {
+				err = pe.Err
+			}
+			return nil, c.line, &lineError{err}
+		}
+		if c.line == 1 && strings.EqualFold(rec[0], "address") {
+			continue
+		}
+		wa := &db.WatchedAddress{Address: strings.TrimSpace(rec[0])}
+		if len(rec) > 1 {
+			wa.Label = rec[1]
+		}
+		if len(rec) > 2 {
+			wa.Webhook = strings.TrimSpace(rec[2])
+		}
+		return wa, c.line, nil
+	}
+	if err := c.s.Err(); err != nil {
+		return nil, c.line + 1, err
+	}
+	return nil, c.line, io.EOF
+}
+
+// jsonlWatchAddressReader reads lines with json objects {"address":"...","label":"...","webhook":"..."}
+type jsonlWatchAddressReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJsonlWatchAddressReader(r io.Reader) *jsonlWatchAddressReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 4096), maxWatchImportLine)
+	return &jsonlWatchAddressReader{s: s}
+}
+
+func (j *jsonlWatchAddressReader) read() (*db.WatchedAddress, int, error) {
+	for j.s.Scan() {
+		j.line++
+		b := j.s.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		var wa db.WatchedAddress
+		if err := json.Unmarshal(b, &wa); err != nil {
+			return nil, j.line, &lineError{err}
+		}
+		wa.Address = strings.TrimSpace(wa.Address)
+		return &wa, j.line, nil
+	}
+	if err := j.s.Err(); err != nil {
+		return nil, j.line + 1, err
+	}
+	return nil, j.line, io.EOF
+}
+
+// importWatchedAddresses validates the addresses read from the stream and writes them to the db in batches
+// invalid lines are skipped and reported, remove unwatches the addresses instead of watching them
+func importWatchedAddresses(d *db.RocksDB, parser bchain.BlockChainParser, ar watchAddressReader, remove bool) (*watchImportResult, error) {
+	res := &watchImportResult{}
+	batch := make([]db.WatchedAddress, 0, watchImportBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if remove {
+			addresses := make([]string, len(batch))
+			for i := range batch {
+				addresses[i] = batch[i].Address
+			}
+			if _, err := d.UnwatchAddresses(addresses); err != nil {
+				return err
+			}
+		} else if err := d.WatchAddresses(batch); err != nil {
+			return err
+		}
+		res.Processed += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	invalid := func(line int, address string, err string) {
+		res.Invalid++
+		if len(res.Errors) < maxWatchImportErrors {
+			res.Errors = append(res.Errors, watchImportError{Line: line, Address: address, Error: err})
+		}
+	}
+	for {
+		wa, line, err := ar.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if le, ok := err.(*lineError); ok {
+				invalid(line, "", le.Error())
+				continue
+			}
+			return res, err
+		}
+		if wa.Address == "" {
+			invalid(line, "", "Missing address")
+			continue
+		}
+		if _, err := parser.GetAddrDescFromAddress(wa.Address); err != nil {
+			invalid(line, wa.Address, fmt.Sprintf("Invalid address, %v", err))
+			continue
+		}
+		if wa.Webhook != "" && !validWebhook(wa.Webhook) {
+			invalid(line, wa.Address, "Webhook is not a valid http(s) url")
+			continue
+		}
+		batch = append(batch, *wa)
+		if len(batch) == watchImportBatch {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// watchAddresses imports (POST) or exports (GET) the list of watched addresses, transactions of which are notified
+// parameters: format (csv or jsonl, default is jsonl or csv if the uploaded content type is text/csv), remove (POST removes the listed addresses)
+// the uploaded list can be sent as the request body or as the file field of a multipart form
+func (s *InternalServer) watchAddresses(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "" && format != "csv" && format != "jsonl" {
+		http.Error(w, "Parameter 'format' must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.exportWatchedAddresses(w, format)
+	case http.MethodPost:
+		body := io.Reader(r.Body)
+		contentType := r.Header.Get("Content-Type")
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			f, fh, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Missing file: %v", err), http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			body = f
+			contentType = fh.Header.Get("Content-Type")
+		}
+		if format == "" {
+			if strings.HasPrefix(contentType, "text/csv") {
+				format = "csv"
+			} else {
+				format = "jsonl"
+			}
+		}
+		var ar watchAddressReader
+		if format == "csv" {
+			ar = newCsvWatchAddressReader(body)
+		} else {
+			ar = newJsonlWatchAddressReader(body)
+		}
+		_, remove := q["remove"]
+		res, err := importWatchedAddresses(s.db, s.chainParser, ar, remove)
+		if err != nil {
+			glog.Error("internal server: watch addresses import: ", err)
+			http.Error(w, fmt.Sprintf("Import failed after %v addresses: %v", res.Processed, err), http.StatusInternalServerError)
+			return
+		}
+		res.Watched = len(s.db.GetWatchedAddresses())
+		glog.Infof("internal server: watch addresses, processed %v, invalid %v, remove %v", res.Processed, res.Invalid, remove)
+		s.writeJSON(w, res)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *InternalServer) exportWatchedAddresses(w http.ResponseWriter, format string) {
+	was := s.db.GetWatchedAddresses()
+	bw := bufio.NewWriter(w)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=watched-addresses.csv")
+		cw := csv.NewWriter(bw)
+		cw.Write([]string{"address", "label", "webhook"})
+		for i := range was {
+			cw.Write([]string{was[i].Address, was[i].Label, was[i].Webhook})
+		}
+		cw.Flush()
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=watched-addresses.jsonl")
+		e := json.NewEncoder(bw)
+		for i := range was {
+			e.Encode(&was[i])
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		glog.Error("internal server: watch addresses export: ", err)
+	}
+}
@@ -0,0 +1,70 @@
+// +build unittest
+
+package server
+
+import (
+	"blockbook/bchain/coins/btc"
+	"blockbook/db"
+	"blockbook/tests/dbtestdata"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_importWatchedAddresses(t *testing.T) {
+	parser := btc.NewBitcoinParser(
+		btc.GetChainParams("test"),
+		&btc.Configuration{BlockAddressesToKeep: 1})
+	d, _, path := setupRocksDB(t, parser)
+	defer func() {
+		d.Close()
+		os.RemoveAll(path)
+	}()
+
+	csvList := "address,label,webhook\n" +
+		"# deposit addresses\n" +
+		dbtestdata.Addr1 + ",deposit 1\n" +
+		"\n" +
+		dbtestdata.Addr2 + ",\"deposit, 2\",http://localhost/hook\n" +
+		"notanaddress,invalid\n" +
+		dbtestdata.Addr3 + ",bad hook,ftp://localhost\n"
+	res, err := importWatchedAddresses(d, parser, newCsvWatchAddressReader(strings.NewReader(csvList)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Processed != 2 || res.Invalid != 2 || len(res.Errors) != 2 || res.Errors[0].Line != 6 || res.Errors[1].Line != 7 {
+		t.Errorf("unexpected csv import result %+v", res)
+	}
+
+	jsonlList := `{"address":"` + dbtestdata.Addr4 + `","label":"cold"}` + "\n" +
+		`{"address":` + "\n" +
+		`{"label":"no address"}` + "\n" +
+		`{"address":"` + dbtestdata.Addr1 + `","label":"deposit 1 renamed"}` + "\n"
+	res, err = importWatchedAddresses(d, parser, newJsonlWatchAddressReader(strings.NewReader(jsonlList)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Processed != 2 || res.Invalid != 2 || res.Errors[0].Line != 2 || res.Errors[1].Error != "Missing address" {
+		t.Errorf("unexpected jsonl import result %+v", res)
+	}
+	want := []db.WatchedAddress{
+		{Address: dbtestdata.Addr4, Label: "cold"},
+		{Address: dbtestdata.Addr1, Label: "deposit 1 renamed"},
+		{Address: dbtestdata.Addr2, Label: "deposit, 2", Webhook: "http://localhost/hook"},
+	}
+	if got := d.GetWatchedAddresses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetWatchedAddresses() = %+v, want %+v", got, want)
+	}
+
+	res, err = importWatchedAddresses(d, parser, newCsvWatchAddressReader(strings.NewReader(dbtestdata.Addr1+"\n"+dbtestdata.Addr4+"\n")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Processed != 2 || res.Invalid != 0 {
+		t.Errorf("unexpected remove result %+v", res)
+	}
+	if got := d.GetWatchedAddresses(); !reflect.DeepEqual(got, want[2:]) {
+		t.Errorf("GetWatchedAddresses() after remove = %+v, want %+v", got, want[2:])
+	}
+}
@@ -190,10 +190,33 @@ func (c *fakeBlockChain) GetMempoolTransactionsForAddrDesc(addrDesc bchain.Addre
 	return []string{}, nil
 }
 
+func (c *fakeBlockChain) TestMempoolAccept(tx string) (v *bchain.MempoolAcceptResult, err error) {
+	return nil, bchain.ErrNotSupported
+}
+
+func (c *fakeBlockChain) GetErc20ContractInfo(contractDesc bchain.AddressDescriptor) (v *bchain.Erc20Contract, err error) {
+	return nil, bchain.ErrNotSupported
+}
+
+func (c *fakeBlockChain) IsContract(addrDesc bchain.AddressDescriptor) (v bool, err error) {
+	return false, bchain.ErrNotSupported
+}
+
 func (c *fakeBlockChain) GetMempoolEntry(txid string) (v *bchain.MempoolEntry, err error) {
 	return nil, errors.New("Not implemented")
 }
 
+func (c *fakeBlockChain) TrackMempoolEvictions(isConfirmed bchain.IsTxConfirmedFunc, isSpent bchain.IsOutpointSpentFunc, onEviction bchain.OnMempoolEvictionFunc) {
+}
+
+func (c *fakeBlockChain) GetMempoolEviction(txid string) (v *bchain.MempoolEviction, err error) {
+	return nil, nil
+}
+
+func (c *fakeBlockChain) GetMempoolPackage(txid string) (v *bchain.MempoolPackage, err error) {
+	return nil, nil
+}
+
 func (c *fakeBlockChain) GetChainParser() bchain.BlockChainParser {
 	return c.parser
 }